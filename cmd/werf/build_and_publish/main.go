@@ -10,7 +10,6 @@ import (
 	"github.com/flant/shluz"
 	"github.com/flant/werf/cmd/werf/common"
 	"github.com/flant/werf/pkg/build"
-	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/logging"
@@ -52,6 +51,9 @@ If one or more IMAGE_NAME parameters specified, werf will build images stages an
   # Build and publish with enabled drop-in shell session in the failed assembly container in the case when an error occurred
   $ werf build-and-publish --stages-storage :local --introspect-error --images-repo :minikube --tag-git-branch mybranch
 
+  # Build and publish amd64 and arm64 images, each image tag is the manifest list of the platform images
+  $ werf build-and-publish --stages-storage registry.mydomain.com/myproject/stages --images-repo registry.mydomain.com/myproject --tag-git-branch mybranch --platform linux/amd64 --platform linux/arm64
+
   # Set --stages-storage default value using $WERF_STAGES_STORAGE param and --images-repo default value using $WERF_IMAGE_REPO param
   $ export WERF_STAGES_STORAGE=:local
   $ export WERF_IMAGES_REPO=myregistry.mydomain.com/myproject
@@ -81,12 +83,19 @@ If one or more IMAGE_NAME parameters specified, werf will build images stages an
 
 	common.SetupTag(&commonCmdData, cmd)
 	common.SetupStagesStorage(&commonCmdData, cmd)
+	common.SetupStagesStorageCache(&commonCmdData, cmd)
 	common.SetupSynchronization(&commonCmdData, cmd)
+	common.SetupKubeConfig(&commonCmdData, cmd)
+	common.SetupKubeContext(&commonCmdData, cmd)
 	common.SetupImagesRepo(&commonCmdData, cmd)
 	common.SetupImagesRepoMode(&commonCmdData, cmd)
 	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read, pull and push images into the specified stages storage, to push images into the specified images repo, to pull base images")
+	common.SetupContainerRuntime(&commonCmdData, cmd)
 	common.SetupInsecureRegistry(&commonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
+	common.SetupParallelTasksLimit(&commonCmdData, cmd)
+	common.SetupPlatform(&commonCmdData, cmd)
+	common.SetupReportPath(&commonCmdData, cmd)
 
 	common.SetupLogOptions(&commonCmdData, cmd)
 	common.SetupLogProjectDir(&commonCmdData, cmd)
@@ -116,7 +125,7 @@ func runBuildAndPublish(imagesToProcess []string) error {
 		return err
 	}
 
-	if err := docker.Init(*commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
+	if err := common.InitContainerRuntime(&commonCmdData); err != nil {
 		return err
 	}
 
@@ -166,7 +175,27 @@ func runBuildAndPublish(imagesToProcess []string) error {
 		return err
 	}
 
-	tagOpts, err := common.GetTagOptions(&commonCmdData, common.TagOptionsGetterOptions{})
+	storageLockManager, err := common.GetStorageLockManager(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	stagesStorageCache, err := common.GetStagesStorageCache(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	parallelTasksLimit, err := common.GetParallelTasksLimit(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	platforms, err := common.GetPlatforms(&commonCmdData, werfConfig)
+	if err != nil {
+		return err
+	}
+
+	tagOpts, err := common.GetTagOptions(&commonCmdData, common.TagOptionsGetterOptions{ProjectDir: projectDir})
 	if err != nil {
 		return err
 	}
@@ -200,13 +229,43 @@ func runBuildAndPublish(imagesToProcess []string) error {
 		},
 	}
 
-	logboek.LogOptionalLn()
-	c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
-	defer c.Terminate()
+	buildReport := &build.BuildReport{}
 
-	if err = c.BuildAndPublish(stagesStorage, imagesRepoManager, opts); err != nil {
-		return err
+	stagesSignatures := build.NewImagesStagesSignatures()
+
+	var buildErr error
+	for _, platform := range platforms {
+		logboek.LogOptionalLn()
+		if err := common.WithPlatform(platform, func() error {
+			c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock, stagesStorage, storageLockManager, build.ConveyorOptions{StagesStorageCache: stagesStorageCache, ParallelTasksLimit: parallelTasksLimit, Platform: platform, Report: buildReport})
+			defer c.Terminate()
+
+			if err := c.BuildAndPublish(imagesRepoManager, opts); err != nil {
+				return err
+			}
+
+			stagesSignatures.Add(c)
+
+			return nil
+		}); err != nil {
+			buildErr = err
+			break
+		}
+	}
+
+	if buildErr == nil && tagOpts.TagByStagesSignature {
+		buildErr = stagesSignatures.PublishManifestLists(imagesRepoManager, storageLockManager, imagesToProcess)
+	}
+
+	if *commonCmdData.ReportPath != "" {
+		if err := buildReport.WriteFile(*commonCmdData.ReportPath); err != nil {
+			if buildErr != nil {
+				logboek.LogWarnF("WARNING: %s\n", err)
+			} else {
+				return err
+			}
+		}
 	}
 
-	return nil
+	return buildErr
 }
@@ -13,7 +13,6 @@ import (
 	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/git_repo"
-	"github.com/flant/werf/pkg/storage"
 	"github.com/flant/werf/pkg/tmp_manager"
 	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
@@ -62,6 +61,10 @@ It is safe to run this command periodically (daily is enough) by automated clean
 
 	common.SetupKubeConfig(&commonCmdData, cmd)
 	common.SetupKubeContext(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageNamespace(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageType(&commonCmdData, cmd)
+	common.SetupKeepHelmReleaseRevisions(&commonCmdData, cmd)
+	common.SetupScanResourceImagesPath(&commonCmdData, cmd)
 
 	common.SetupDryRun(&commonCmdData, cmd)
 
@@ -133,13 +136,13 @@ func runCleanup() error {
 		return err
 	}
 
-	if _, err := common.GetStagesStorage(&commonCmdData); err != nil {
+	stagesStorage, err := common.GetStagesStorage(&commonCmdData)
+	if err != nil {
 		return err
 	}
 	if _, err := common.GetSynchronization(&commonCmdData); err != nil {
 		return err
 	}
-	stagesStorage := &storage.LocalStagesStorage{}
 
 	imagesNames, err := common.GetManagedImagesNames(projectName, stagesStorage, werfConfig)
 	if err != nil {
@@ -163,6 +166,11 @@ func runCleanup() error {
 		return err
 	}
 
+	kubernetesImagesOptions, err := common.GetKubernetesImagesOptions(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
 	kubernetesContextsClients, err := kube.GetAllContextsClients(kube.GetAllContextsClientsOptions{KubeConfig: *commonCmdData.KubeConfig})
 	if err != nil {
 		return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
@@ -176,8 +184,10 @@ func runCleanup() error {
 		},
 		LocalGit:                  localGitRepo,
 		KubernetesContextsClients: kubernetesContextsClients,
+		KubernetesImagesOptions:   kubernetesImagesOptions,
 		WithoutKube:               *commonCmdData.WithoutKube,
 		Policies:                  policies,
+		Rules:                     werfConfig.Meta.Cleanup.Rules,
 	}
 
 	stagesCleanupOptions := cleaning.StagesCleanupOptions{
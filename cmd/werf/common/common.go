@@ -3,6 +3,7 @@ package common
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -20,7 +21,12 @@ import (
 	cleanup "github.com/flant/werf/pkg/cleaning"
 	"github.com/flant/werf/pkg/config"
 	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/logging"
+	"github.com/flant/werf/pkg/oci"
+	"github.com/flant/werf/pkg/platform"
+	"github.com/flant/werf/pkg/storage"
 	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
 )
@@ -37,6 +43,8 @@ type CmdData struct {
 	TagGitTag            *string
 	TagGitCommit         *string
 	TagByStagesSignature *bool
+	TagSemver            *string
+	TagTemplate          *string
 
 	Environment                      *string
 	Release                          *string
@@ -50,6 +58,9 @@ type CmdData struct {
 	StatusProgressPeriodSeconds      *int64
 	HooksStatusProgressPeriodSeconds *int64
 	ReleasesHistoryMax               *int
+	ParallelTasksLimit               *int64
+	Platform                         *[]string
+	ReportPath                       *string
 
 	Set             *[]string
 	SetString       *[]string
@@ -57,12 +68,14 @@ type CmdData struct {
 	SecretValues    *[]string
 	IgnoreSecretKey *bool
 
-	StagesStorage   *string
-	Synchronization *string
-	ImagesRepo      *string
-	ImagesRepoMode  *string
+	StagesStorage      *string
+	StagesStorageCache *string
+	Synchronization    *string
+	ImagesRepo         *string
+	ImagesRepoMode     *string
 
 	DockerConfig          *string
+	ContainerRuntime      *string
 	InsecureRegistry      *bool
 	SkipTlsVerifyRegistry *bool
 	DryRun                *bool
@@ -73,8 +86,14 @@ type CmdData struct {
 	GitCommitStrategyExpiryDays       *int64
 	StagesSignatureStrategyLimit      *int64
 	StagesSignatureStrategyExpiryDays *int64
+	SemverStrategyLimit               *int64
+	SemverStrategyExpiryDays          *int64
+	TemplateStrategyLimit             *int64
+	TemplateStrategyExpiryDays        *int64
 
-	WithoutKube *bool
+	WithoutKube              *bool
+	KeepHelmReleaseRevisions *int64
+	ScanResourceImagesPaths  *[]string
 
 	StagesToIntrospect *[]string
 
@@ -87,10 +106,18 @@ type CmdData struct {
 	LogTerminalWidth *int64
 
 	ThreeWayMergeMode *string
+
+	PrometheusUrl *string
+
+	ReleaseLock               *bool
+	ReleaseLockTimeoutSeconds *int64
 }
 
 const (
 	CleaningCommandsForceOptionDescription = "Remove containers that are based on deleting werf docker images"
+
+	KubernetesSynchronizationPrefix           = "kubernetes://"
+	DefaultKubernetesSynchronizationNamespace = "werf-synchronization"
 )
 
 func GetLongCommandDescription(text string) string {
@@ -129,6 +156,10 @@ func SetupImagesCleanupPolicies(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.GitCommitStrategyExpiryDays = new(int64)
 	cmdData.StagesSignatureStrategyLimit = new(int64)
 	cmdData.StagesSignatureStrategyExpiryDays = new(int64)
+	cmdData.SemverStrategyLimit = new(int64)
+	cmdData.SemverStrategyExpiryDays = new(int64)
+	cmdData.TemplateStrategyLimit = new(int64)
+	cmdData.TemplateStrategyExpiryDays = new(int64)
 
 	cmd.Flags().Int64VarP(cmdData.GitTagStrategyLimit, "git-tag-strategy-limit", "", -1, "Keep max number of images published with the git-tag tagging strategy in the images repo. No limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_TAG_STRATEGY_LIMIT")
 	cmd.Flags().Int64VarP(cmdData.GitTagStrategyExpiryDays, "git-tag-strategy-expiry-days", "", -1, "Keep images published with the git-tag tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_TAG_STRATEGY_EXPIRY_DAYS")
@@ -136,6 +167,10 @@ func SetupImagesCleanupPolicies(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().Int64VarP(cmdData.GitCommitStrategyExpiryDays, "git-commit-strategy-expiry-days", "", -1, "Keep images published with the git-commit tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_GIT_COMMIT_STRATEGY_EXPIRY_DAYS")
 	cmd.Flags().Int64VarP(cmdData.StagesSignatureStrategyLimit, "stages-signature-strategy-limit", "", -1, "Keep max number of images published with the stages-signature tagging strategy in the images repo. No limit by default, -1 disables the limit. Value can be specified by the $WERF_STAGES_SIGNATURE_STRATEGY_LIMIT")
 	cmd.Flags().Int64VarP(cmdData.StagesSignatureStrategyExpiryDays, "stages-signature-strategy-expiry-days", "", -1, "Keep images published with the stages-signature tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_STAGES_SIGNATURE_STRATEGY_EXPIRY_DAYS")
+	cmd.Flags().Int64VarP(cmdData.SemverStrategyLimit, "semver-strategy-limit", "", -1, "Keep max number of versions published with the semver tagging strategy in the images repo. MAJOR and MAJOR.MINOR tags and versions referenced by them are always kept. No limit by default, -1 disables the limit. Value can be specified by the $WERF_SEMVER_STRATEGY_LIMIT")
+	cmd.Flags().Int64VarP(cmdData.SemverStrategyExpiryDays, "semver-strategy-expiry-days", "", -1, "Keep versions published with the semver tagging strategy in the images repo for the specified maximum days since image published. MAJOR and MAJOR.MINOR tags and versions referenced by them are always kept. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_SEMVER_STRATEGY_EXPIRY_DAYS")
+	cmd.Flags().Int64VarP(cmdData.TemplateStrategyLimit, "template-strategy-limit", "", -1, "Keep max number of images published with the template tagging strategy in the images repo. No limit by default, -1 disables the limit. Value can be specified by the $WERF_TEMPLATE_STRATEGY_LIMIT")
+	cmd.Flags().Int64VarP(cmdData.TemplateStrategyExpiryDays, "template-strategy-expiry-days", "", -1, "Keep images published with the template tagging strategy in the images repo for the specified maximum days since image published. Republished image will be kept specified maximum days since new publication date. No days limit by default, -1 disables the limit. Value can be specified by the $WERF_TEMPLATE_STRATEGY_EXPIRY_DAYS")
 
 	_ = cmd.Flags().MarkHidden("stages-signature-strategy-limit")
 	_ = cmd.Flags().MarkHidden("stages-signature-strategy-expiry-days")
@@ -146,6 +181,77 @@ func SetupWithoutKube(cmdData *CmdData, cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(cmdData.WithoutKube, "without-kube", "", GetBoolEnvironmentDefaultFalse("WERF_WITHOUT_KUBE"), "Do not skip deployed Kubernetes images (default $WERF_KUBE_CONTEXT)")
 }
 
+func SetupKeepHelmReleaseRevisions(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.KeepHelmReleaseRevisions = new(int64)
+	cmd.Flags().Int64VarP(
+		cmdData.KeepHelmReleaseRevisions,
+		"keep-helm-release-revisions",
+		"",
+		*keepHelmReleaseRevisionsDefaultValue(),
+		"Do not remove images used in the specified number of the last revisions of every helm release, so that releases can be rolled back. Release storage is defined by --helm-release-storage-namespace and --helm-release-storage-type options. Defaults to $WERF_KEEP_HELM_RELEASE_REVISIONS or 0 (disabled)",
+	)
+}
+
+func keepHelmReleaseRevisionsDefaultValue() *int64 {
+	defaultValue := int64(0)
+
+	v, err := getInt64EnvVar("WERF_KEEP_HELM_RELEASE_REVISIONS")
+	if err != nil {
+		TerminateWithError(err.Error(), 1)
+	}
+
+	if v == nil {
+		return &defaultValue
+	} else {
+		return v
+	}
+}
+
+func SetupScanResourceImagesPath(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ScanResourceImagesPaths = new([]string)
+	cmd.Flags().StringArrayVarP(cmdData.ScanResourceImagesPaths, "scan-resource-images-path", "", []string{}, `Do not remove images used in the custom resources (can specify multiple).
+Format: GROUP/VERSION/RESOURCE=JSONPATH, e.g. argoproj.io/v1alpha1/rollouts={.spec.template.spec.containers[*].image} or serving.knative.dev/v1/services={.spec.template.spec.containers[*].image}.
+Also can be specified in $WERF_SCAN_RESOURCE_IMAGES_PATH* (e.g. $WERF_SCAN_RESOURCE_IMAGES_PATH_ROLLOUTS=argoproj.io/v1alpha1/rollouts={.spec.template.spec.containers[*].image})`)
+}
+
+func GetKubernetesImagesOptions(cmdData *CmdData) (cleanup.KubernetesImagesOptions, error) {
+	res := cleanup.KubernetesImagesOptions{
+		KeepHelmReleaseRevisions:    *cmdData.KeepHelmReleaseRevisions,
+		HelmReleaseStorageNamespace: *cmdData.HelmReleaseStorageNamespace,
+	}
+
+	if res.KeepHelmReleaseRevisions < 0 {
+		return cleanup.KubernetesImagesOptions{}, fmt.Errorf("--keep-helm-release-revisions should be greater than or equal to 0")
+	}
+
+	helmReleaseStorageType, err := GetHelmReleaseStorageType(*cmdData.HelmReleaseStorageType)
+	if err != nil {
+		return cleanup.KubernetesImagesOptions{}, err
+	}
+	res.HelmReleaseStorageType = helmReleaseStorageType
+
+	var scanResourceImagesPaths []string
+	scanResourceImagesPaths = append(scanResourceImagesPaths, *cmdData.ScanResourceImagesPaths...)
+
+	for _, keyValue := range os.Environ() {
+		parts := strings.SplitN(keyValue, "=", 2)
+		if strings.HasPrefix(parts[0], "WERF_SCAN_RESOURCE_IMAGES_PATH") {
+			scanResourceImagesPaths = append(scanResourceImagesPaths, parts[1])
+		}
+	}
+
+	for _, value := range scanResourceImagesPaths {
+		resourceImagesPath, err := cleanup.ParseResourceImagesPath(value)
+		if err != nil {
+			return cleanup.KubernetesImagesOptions{}, fmt.Errorf("bad --scan-resource-images-path value: %s", err)
+		}
+
+		res.ResourcesImagesPaths = append(res.ResourcesImagesPaths, resourceImagesPath)
+	}
+
+	return res, nil
+}
+
 func SetupTag(cmdData *CmdData, cmd *cobra.Command) {
 	var tagCustom []string
 	for _, keyValue := range os.Environ() {
@@ -160,12 +266,16 @@ func SetupTag(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.TagGitTag = new(string)
 	cmdData.TagGitCommit = new(string)
 	cmdData.TagByStagesSignature = new(bool)
+	cmdData.TagSemver = new(string)
+	cmdData.TagTemplate = new(string)
 
 	cmd.Flags().StringArrayVarP(cmdData.TagCustom, "tag-custom", "", tagCustom, "Use custom tagging strategy and tag by the specified arbitrary tags.\nOption can be used multiple times to produce multiple images with the specified tags.\nAlso can be specified in $WERF_TAG_CUSTOM* (e.g. $WERF_TAG_CUSTOM_TAG1=tag1, $WERF_TAG_CUSTOM_TAG2=tag2)")
 	cmd.Flags().StringVarP(cmdData.TagGitBranch, "tag-git-branch", "", os.Getenv("WERF_TAG_GIT_BRANCH"), "Use git-branch tagging strategy and tag by the specified git branch (option can be enabled by specifying git branch in the $WERF_TAG_GIT_BRANCH)")
 	cmd.Flags().StringVarP(cmdData.TagGitTag, "tag-git-tag", "", os.Getenv("WERF_TAG_GIT_TAG"), "Use git-tag tagging strategy and tag by the specified git tag (option can be enabled by specifying git tag in the $WERF_TAG_GIT_TAG)")
 	cmd.Flags().StringVarP(cmdData.TagGitCommit, "tag-git-commit", "", os.Getenv("WERF_TAG_GIT_COMMIT"), "Use git-commit tagging strategy and tag by the specified git commit hash (option can be enabled by specifying git commit hash in the $WERF_TAG_GIT_COMMIT)")
 	cmd.Flags().BoolVarP(cmdData.TagByStagesSignature, "tag-by-stages-signature", "", GetBoolEnvironmentDefaultFalse("WERF_TAG_BY_STAGES_SIGNATURE"), "Use stages-signature tagging strategy and tag each image by the corresponding signature of last image stage (option can be enabled by specifying $WERF_TAG_BY_STAGES_SIGNATURE=true)")
+	cmd.Flags().StringVarP(cmdData.TagSemver, "tag-semver", "", os.Getenv("WERF_TAG_SEMVER"), "Use semver tagging strategy and tag by MAJOR.MINOR.PATCH, MAJOR.MINOR and MAJOR tags parsed from the specified git tag in the form [v]MAJOR.MINOR.PATCH[-PRERELEASE]. Pre-release version is tagged only by the full version. Existing tag is never moved to an older version (option can be enabled by specifying git tag in the $WERF_TAG_SEMVER)")
+	cmd.Flags().StringVarP(cmdData.TagTemplate, "tag-template", "", os.Getenv("WERF_TAG_TEMPLATE"), "Use template tagging strategy and tag by the rendered go template, e.g. '{{ .GitBranch }}-{{ .GitCommitShort }}'. Available values: .GitTag, .GitBranch, .GitCommit, .GitCommitShort, .CIPipelineId and .CIJobId, sprig functions can be used as well (option can be enabled by specifying template in the $WERF_TAG_TEMPLATE)")
 }
 
 func SetupEnvironment(cmdData *CmdData, cmd *cobra.Command) {
@@ -235,12 +345,23 @@ func SetupHelmReleaseStorageType(cmdData *CmdData, cmd *cobra.Command) {
 		defaultValue = helm.ConfigMapStorage
 	}
 
-	cmd.Flags().StringVarP(cmdData.HelmReleaseStorageType, "helm-release-storage-type", "", defaultValue, fmt.Sprintf("helm storage driver to use. One of '%[1]s' or '%[2]s' (default $WERF_HELM_RELEASE_STORAGE_TYPE or '%[1]s')", helm.ConfigMapStorage, helm.SecretStorage))
+	cmd.Flags().StringVarP(cmdData.HelmReleaseStorageType, "helm-release-storage-type", "", defaultValue, fmt.Sprintf("helm storage driver to use. One of '%[1]s', '%[2]s' or '%[3]s' (default $WERF_HELM_RELEASE_STORAGE_TYPE or '%[1]s').\n'%[3]s' stores releases as Helm 3 secrets in the release namespace (--namespace or the namespace of the kube context), --helm-release-storage-namespace is not used", helm.ConfigMapStorage, helm.SecretStorage, helm.Helm3Storage))
 }
 
 func SetupStagesStorage(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.StagesStorage = new(string)
-	cmd.Flags().StringVarP(cmdData.StagesStorage, "stages-storage", "s", os.Getenv("WERF_STAGES_STORAGE"), "Docker Repo to store stages or :local for non-distributed build (only :local is supported for now; default $WERF_STAGES_STORAGE environment).\nMore info about stages: https://werf.io/documentation/reference/stages_and_images.html")
+	cmd.Flags().StringVarP(cmdData.StagesStorage, "stages-storage", "s", os.Getenv("WERF_STAGES_STORAGE"), "Docker Repo to store stages or :local for non-distributed build (default $WERF_STAGES_STORAGE environment).\nMore info about stages: https://werf.io/documentation/reference/stages_and_images.html")
+}
+
+func SetupStagesStorageCache(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.StagesStorageCache = new(string)
+
+	defaultValue := os.Getenv("WERF_STAGES_STORAGE_CACHE")
+	if defaultValue == "" {
+		defaultValue = ":local"
+	}
+
+	cmd.Flags().StringVarP(cmdData.StagesStorageCache, "stages-storage-cache", "", defaultValue, "Address of the cache of stages storage images by signature (default :local or $WERF_STAGES_STORAGE_CACHE if set). :local address keeps the cache in the werf local cache dir of the current host. http://HOST:PORT address allows multiple hosts to share the cache served by the 'werf stages cache-server' command.")
 }
 
 func SetupSynchronization(cmdData *CmdData, cmd *cobra.Command) {
@@ -251,7 +372,7 @@ func SetupSynchronization(cmdData *CmdData, cmd *cobra.Command) {
 		defaultValue = ":local"
 	}
 
-	cmd.Flags().StringVarP(cmdData.Synchronization, "synchronization", "", defaultValue, "Address of synchronizer for multiple werf processes to work with a single stages storage (default :local or $WERF_SYNCHRONIZATION if set). The same address should be specified for all werf processes that work with a single stages storage. :local address allows execution of werf processes from a single host only.")
+	cmd.Flags().StringVarP(cmdData.Synchronization, "synchronization", "", defaultValue, "Address of synchronizer for multiple werf processes to work with a single stages storage (default :local or $WERF_SYNCHRONIZATION if set). The same address should be specified for all werf processes that work with a single stages storage. :local address allows execution of werf processes from a single host only. kubernetes://NAMESPACE address stores locks as Leases in the specified namespace of the cluster (--kube-config and --kube-context options are used to connect to the cluster when available).")
 }
 
 func SetupStatusProgressPeriod(cmdData *CmdData, cmd *cobra.Command) {
@@ -265,6 +386,33 @@ func SetupStatusProgressPeriod(cmdData *CmdData, cmd *cobra.Command) {
 	)
 }
 
+func SetupReleaseLock(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ReleaseLock = new(bool)
+	cmd.Flags().BoolVarP(cmdData.ReleaseLock, "release-lock", "", GetBoolEnvironmentDefaultFalse("WERF_RELEASE_LOCK"), "Lock the release in the cluster with the Lease in the helm release storage namespace, so that werf processes on different hosts cannot change the same release at the same time (default $WERF_RELEASE_LOCK)")
+}
+
+func SetupReleaseLockTimeout(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ReleaseLockTimeoutSeconds = new(int64)
+
+	defaultValueP, err := getIntEnvVar("WERF_RELEASE_LOCK_TIMEOUT_SECONDS")
+	if err != nil {
+		TerminateWithError(fmt.Sprintf("bad WERF_RELEASE_LOCK_TIMEOUT_SECONDS value: %s", err), 1)
+	}
+
+	var defaultValue int64
+	if defaultValueP != nil {
+		defaultValue = *defaultValueP
+	}
+
+	cmd.Flags().Int64VarP(
+		cmdData.ReleaseLockTimeoutSeconds,
+		"release-lock-timeout",
+		"",
+		defaultValue,
+		"Timeout in seconds of waiting for the release lock held by another werf process. Defaults to $WERF_RELEASE_LOCK_TIMEOUT_SECONDS or 0 to wait forever",
+	)
+}
+
 func SetupReleasesHistoryMax(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.ReleasesHistoryMax = new(int)
 
@@ -302,6 +450,90 @@ func statusProgressPeriodDefaultValue() *int64 {
 	}
 }
 
+func SetupParallelTasksLimit(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ParallelTasksLimit = new(int64)
+	cmd.Flags().Int64VarP(
+		cmdData.ParallelTasksLimit,
+		"parallel-tasks-limit",
+		"",
+		*parallelTasksLimitDefaultValue(),
+		"Max number of images and artifacts processed in parallel: independent images are built and published concurrently, the image is reported when it is done and the logs of images are printed in the images order when all images are done in this mode. Defaults to $WERF_PARALLEL_TASKS_LIMIT or 1 (sequential processing)",
+	)
+}
+
+func parallelTasksLimitDefaultValue() *int64 {
+	defaultValue := int64(1)
+
+	v, err := getIntEnvVar("WERF_PARALLEL_TASKS_LIMIT")
+	if err != nil {
+		TerminateWithError(err.Error(), 1)
+	}
+
+	if v == nil {
+		return &defaultValue
+	} else {
+		return v
+	}
+}
+
+func SetupReportPath(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.ReportPath = new(string)
+	cmd.Flags().StringVarP(cmdData.ReportPath, "report-path", "", os.Getenv("WERF_REPORT_PATH"), "Write JSON report of built stages and published images to the specified file: stages signatures, cache hits, durations, sizes and tags (default $WERF_REPORT_PATH)")
+}
+
+func SetupPlatform(cmdData *CmdData, cmd *cobra.Command) {
+	var defaultValue []string
+	if v := os.Getenv("WERF_PLATFORM"); v != "" {
+		defaultValue = strings.Split(v, ",")
+	}
+
+	cmdData.Platform = new([]string)
+	cmd.Flags().StringArrayVarP(
+		cmdData.Platform,
+		"platform",
+		"",
+		defaultValue,
+		"Build images for the specified platform in the OS/ARCH[/VARIANT] format, e.g. linux/amd64 or linux/arm64/v8 (can specify multiple). Defaults to $WERF_PLATFORM (comma-separated) or all platforms specified by the platform directive in werf.yaml (the docker daemon platform if there are no such directives)",
+	)
+}
+
+// GetPlatforms returns target platforms of the build, the empty platform means the docker daemon platform
+func GetPlatforms(cmdData *CmdData, werfConfig *config.WerfConfig) ([]string, error) {
+	platforms := *cmdData.Platform
+	for _, p := range platforms {
+		if err := platform.Validate(p); err != nil {
+			return nil, fmt.Errorf("bad --platform value: %s", err)
+		}
+	}
+
+	if len(platforms) == 0 {
+		platforms = werfConfig.GetPlatforms()
+	}
+
+	if len(platforms) == 0 {
+		return []string{""}, nil
+	}
+
+	return platforms, nil
+}
+
+// WithPlatform runs f in the log process of the platform, when the platform is specified
+func WithPlatform(targetPlatform string, f func() error) error {
+	if targetPlatform == "" {
+		return f()
+	}
+
+	return logboek.Default.LogProcess(fmt.Sprintf("Platform %s", targetPlatform), logboek.LevelLogProcessOptions{Style: logboek.HighlightStyle()}, f)
+}
+
+func GetParallelTasksLimit(cmdData *CmdData) (int64, error) {
+	if *cmdData.ParallelTasksLimit < 1 {
+		return 0, fmt.Errorf("bad --parallel-tasks-limit value %d: should be greater than 0", *cmdData.ParallelTasksLimit)
+	}
+
+	return *cmdData.ParallelTasksLimit, nil
+}
+
 func SetupHooksStatusProgressPeriod(cmdData *CmdData, cmd *cobra.Command) {
 	cmdData.HooksStatusProgressPeriodSeconds = new(int64)
 	cmd.Flags().Int64VarP(
@@ -377,6 +609,46 @@ func SetupDockerConfig(cmdData *CmdData, cmd *cobra.Command, extraDesc string) {
 	cmd.Flags().StringVarP(cmdData.DockerConfig, "docker-config", "", defaultValue, desc)
 }
 
+func SetupContainerRuntime(cmdData *CmdData, cmd *cobra.Command) {
+	defaultValue := os.Getenv("WERF_CONTAINER_RUNTIME")
+	if defaultValue == "" {
+		defaultValue = image.DockerContainerRuntime
+	}
+
+	cmdData.ContainerRuntime = new(string)
+	cmd.Flags().StringVarP(cmdData.ContainerRuntime, "container-runtime", "", defaultValue, fmt.Sprintf("Run stapel assembly instructions with the docker daemon (%[1]s) or with the rootless runc without docker daemon (%[2]s). The %[2]s runtime requires runc binary ($WERF_RUNC_PATH or PATH) and --stages-storage REPO. Default $WERF_CONTAINER_RUNTIME or %[1]s", image.DockerContainerRuntime, oci.ContainerRuntime))
+}
+
+// InitContainerRuntime initializes docker or sets the rootless oci container backend, which does not need docker daemon
+func InitContainerRuntime(cmdData *CmdData) error {
+	switch *cmdData.ContainerRuntime {
+	case image.DockerContainerRuntime:
+		return docker.Init(*cmdData.DockerConfig, *cmdData.LogVerbose, *cmdData.LogDebug)
+	case oci.ContainerRuntime:
+		if *cmdData.StagesStorage == storage.LocalStorageAddress {
+			return fmt.Errorf("--stages-storage %s is not supported by %s container runtime: stages are stored in the docker daemon, specify --stages-storage REPO", storage.LocalStorageAddress, oci.ContainerRuntime)
+		}
+
+		// registry credentials are read from the docker config
+		if *cmdData.DockerConfig != "" {
+			if err := os.Setenv("DOCKER_CONFIG", *cmdData.DockerConfig); err != nil {
+				return fmt.Errorf("cannot set DOCKER_CONFIG to %s: %s", *cmdData.DockerConfig, err)
+			}
+		}
+
+		backend, err := oci.NewBackend()
+		if err != nil {
+			return err
+		}
+
+		image.SetContainerBackend(backend)
+
+		return nil
+	default:
+		return fmt.Errorf("bad --container-runtime value %q: %s or %s expected", *cmdData.ContainerRuntime, image.DockerContainerRuntime, oci.ContainerRuntime)
+	}
+}
+
 func SetupLogOptions(cmdData *CmdData, cmd *cobra.Command) {
 	SetupLogDebug(cmdData, cmd)
 	SetupLogVerbose(cmdData, cmd)
@@ -583,6 +855,11 @@ func SetupThreeWayMergeMode(cmdData *CmdData, cmd *cobra.Command) {
 Supported 'enabled', 'disabled' and 'onlyNewReleases', see docs for more info https://werf.io/documentation/reference/deploy_process/experimental_three_way_merge.html`)
 }
 
+func SetupPrometheusUrl(cmdData *CmdData, cmd *cobra.Command) {
+	cmdData.PrometheusUrl = new(string)
+	cmd.Flags().StringVarP(cmdData.PrometheusUrl, "prometheus-url", "", os.Getenv("WERF_PROMETHEUS_URL"), "Prometheus url to evaluate werf.io/analysis-query annotations of release resources against (default $WERF_PROMETHEUS_URL)")
+}
+
 func GetThreeWayMergeMode(threeWayMergeModeParam string) (helm.ThreeWayMergeModeType, error) {
 	switch threeWayMergeModeParam {
 	case "enabled", "disabled", "onlyNewReleases", "":
@@ -728,6 +1005,50 @@ func GetStagesSignatureStrategyExpiryDays(cmdData *CmdData) (int64, error) {
 	return *cmdData.StagesSignatureStrategyExpiryDays, nil
 }
 
+func GetSemverStrategyLimit(cmdData *CmdData) (int64, error) {
+	v, err := getInt64EnvVar("WERF_SEMVER_STRATEGY_LIMIT")
+	if err != nil {
+		return 0, err
+	}
+	if v != nil {
+		return *v, nil
+	}
+	return *cmdData.SemverStrategyLimit, nil
+}
+
+func GetSemverStrategyExpiryDays(cmdData *CmdData) (int64, error) {
+	v, err := getInt64EnvVar("WERF_SEMVER_STRATEGY_EXPIRY_DAYS")
+	if err != nil {
+		return 0, err
+	}
+	if v != nil {
+		return *v, nil
+	}
+	return *cmdData.SemverStrategyExpiryDays, nil
+}
+
+func GetTemplateStrategyLimit(cmdData *CmdData) (int64, error) {
+	v, err := getInt64EnvVar("WERF_TEMPLATE_STRATEGY_LIMIT")
+	if err != nil {
+		return 0, err
+	}
+	if v != nil {
+		return *v, nil
+	}
+	return *cmdData.TemplateStrategyLimit, nil
+}
+
+func GetTemplateStrategyExpiryDays(cmdData *CmdData) (int64, error) {
+	v, err := getInt64EnvVar("WERF_TEMPLATE_STRATEGY_EXPIRY_DAYS")
+	if err != nil {
+		return 0, err
+	}
+	if v != nil {
+		return *v, nil
+	}
+	return *cmdData.TemplateStrategyExpiryDays, nil
+}
+
 func GetImagesCleanupPolicies(cmdData *CmdData) (cleanup.ImagesCleanupPolicies, error) {
 	tagLimit, err := GetGitTagStrategyLimit(cmdData)
 	if err != nil {
@@ -759,6 +1080,26 @@ func GetImagesCleanupPolicies(cmdData *CmdData) (cleanup.ImagesCleanupPolicies,
 		return cleanup.ImagesCleanupPolicies{}, err
 	}
 
+	semverLimit, err := GetSemverStrategyLimit(cmdData)
+	if err != nil {
+		return cleanup.ImagesCleanupPolicies{}, err
+	}
+
+	semverDays, err := GetSemverStrategyExpiryDays(cmdData)
+	if err != nil {
+		return cleanup.ImagesCleanupPolicies{}, err
+	}
+
+	templateLimit, err := GetTemplateStrategyLimit(cmdData)
+	if err != nil {
+		return cleanup.ImagesCleanupPolicies{}, err
+	}
+
+	templateDays, err := GetTemplateStrategyExpiryDays(cmdData)
+	if err != nil {
+		return cleanup.ImagesCleanupPolicies{}, err
+	}
+
 	res := cleanup.ImagesCleanupPolicies{}
 
 	if tagLimit >= 0 {
@@ -785,24 +1126,106 @@ func GetImagesCleanupPolicies(cmdData *CmdData) (cleanup.ImagesCleanupPolicies,
 		res.StagesSignatureStrategyHasExpiryPeriod = true
 		res.StagesSignatureStrategyExpiryPeriod = time.Hour * 24 * time.Duration(stagesSignatureDays)
 	}
+	if semverLimit >= 0 {
+		res.SemverStrategyHasLimit = true
+		res.SemverStrategyLimit = semverLimit
+	}
+	if semverDays >= 0 {
+		res.SemverStrategyHasExpiryPeriod = true
+		res.SemverStrategyExpiryPeriod = time.Hour * 24 * time.Duration(semverDays)
+	}
+	if templateLimit >= 0 {
+		res.TemplateStrategyHasLimit = true
+		res.TemplateStrategyLimit = templateLimit
+	}
+	if templateDays >= 0 {
+		res.TemplateStrategyHasExpiryPeriod = true
+		res.TemplateStrategyExpiryPeriod = time.Hour * 24 * time.Duration(templateDays)
+	}
 
 	return res, nil
 }
 
-func GetStagesStorage(cmdData *CmdData) (string, error) {
+func GetStagesStorage(cmdData *CmdData) (storage.StagesStorage, error) {
 	if *cmdData.StagesStorage == "" {
-		return "", fmt.Errorf("--stages-storage :local param required")
-	} else if *cmdData.StagesStorage != ":local" {
-		return "", fmt.Errorf("only --stages-storage :local is supported for now, got '%s'", *cmdData.StagesStorage)
+		return nil, fmt.Errorf("--stages-storage :local or --stages-storage REPO param required")
+	} else if *cmdData.StagesStorage == storage.LocalStorageAddress {
+		return &storage.LocalStagesStorage{}, nil
 	}
-	return *cmdData.StagesStorage, nil
+
+	if _, err := name.NewRepository(*cmdData.StagesStorage, name.WeakValidation); err != nil {
+		return nil, fmt.Errorf("%s.\nThe stages storage should be a docker repository or :local", err)
+	}
+
+	return storage.NewRepoStagesStorage(*cmdData.StagesStorage), nil
+}
+
+func GetLocalStagesStorage(cmdData *CmdData) (*storage.LocalStagesStorage, error) {
+	stagesStorage, err := GetStagesStorage(cmdData)
+	if err != nil {
+		return nil, err
+	}
+
+	localStagesStorage, ok := stagesStorage.(*storage.LocalStagesStorage)
+	if !ok {
+		return nil, fmt.Errorf("only --stages-storage :local is supported by this command for now, got '%s'", stagesStorage.String())
+	}
+
+	return localStagesStorage, nil
+}
+
+func GetStagesStorageCache(cmdData *CmdData) (storage.StagesStorageCache, error) {
+	address := *cmdData.StagesStorageCache
+
+	if address == storage.LocalStorageAddress {
+		return storage.NewFileStagesStorageCache(filepath.Join(werf.GetLocalCacheDir(), "stages_storage")), nil
+	} else if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		if _, err := url.Parse(address); err != nil {
+			return nil, fmt.Errorf("bad --stages-storage-cache address %q: %s", address, err)
+		}
+		return storage.NewHttpStagesStorageCache(address), nil
+	}
+
+	return nil, fmt.Errorf("only --stages-storage-cache :local or --stages-storage-cache http(s)://HOST:PORT are supported, got '%s'", address)
 }
 
 func GetSynchronization(cmdData *CmdData) (string, error) {
-	if *cmdData.Synchronization != ":local" {
-		return "", fmt.Errorf("only --synchronization=:local is supported for now, got '%s'", *cmdData.Synchronization)
+	if *cmdData.Synchronization == storage.LocalStorageAddress || strings.HasPrefix(*cmdData.Synchronization, KubernetesSynchronizationPrefix) {
+		return *cmdData.Synchronization, nil
+	}
+	return "", fmt.Errorf("only --synchronization=:local or --synchronization=kubernetes://NAMESPACE is supported, got '%s'", *cmdData.Synchronization)
+}
+
+func GetStorageLockManager(cmdData *CmdData) (storage.LockManager, error) {
+	synchronization, err := GetSynchronization(cmdData)
+	if err != nil {
+		return nil, err
+	}
+
+	if synchronization == storage.LocalStorageAddress {
+		return &storage.FileLockManager{}, nil
 	}
-	return *cmdData.Synchronization, nil
+
+	namespace := strings.TrimPrefix(synchronization, KubernetesSynchronizationPrefix)
+	if namespace == "" {
+		namespace = DefaultKubernetesSynchronizationNamespace
+	}
+
+	if kube.Kubernetes == nil {
+		var kubeInitOptions kube.InitOptions
+		if cmdData.KubeContext != nil {
+			kubeInitOptions.KubeContext = *cmdData.KubeContext
+		}
+		if cmdData.KubeConfig != nil {
+			kubeInitOptions.KubeConfig = *cmdData.KubeConfig
+		}
+
+		if err := kube.Init(kubeInitOptions); err != nil {
+			return nil, fmt.Errorf("cannot initialize kube: %s", err)
+		}
+	}
+
+	return storage.NewKubernetesLockManager(kube.Kubernetes, namespace), nil
 }
 
 func GetImagesRepo(projectName string, cmdData *CmdData) (string, error) {
@@ -87,10 +87,10 @@ func GetKubernetesNamespace(namespaceOption string, environmentOption string, we
 
 func GetHelmReleaseStorageType(helmReleaseStorageType string) (string, error) {
 	switch helmReleaseStorageType {
-	case helm.ConfigMapStorage, helm.SecretStorage:
+	case helm.ConfigMapStorage, helm.SecretStorage, helm.Helm3Storage:
 		return helmReleaseStorageType, nil
 	default:
-		return "", fmt.Errorf("bad --helm-release-storage-type value '%s'. Use one of '%s' or '%s'", helmReleaseStorageType, helm.ConfigMapStorage, helm.SecretStorage)
+		return "", fmt.Errorf("bad --helm-release-storage-type value '%s'. Use one of '%s', '%s' or '%s'", helmReleaseStorageType, helm.ConfigMapStorage, helm.SecretStorage, helm.Helm3Storage)
 	}
 }
 
@@ -102,6 +102,10 @@ func GetHooksStatusProgressPeriod(cmdData *CmdData) time.Duration {
 	return time.Second * time.Duration(*cmdData.HooksStatusProgressPeriodSeconds)
 }
 
+func GetReleaseLockTimeout(cmdData *CmdData) time.Duration {
+	return time.Second * time.Duration(*cmdData.ReleaseLockTimeoutSeconds)
+}
+
 func GetUserExtraAnnotations(cmdData *CmdData) (map[string]string, error) {
 	extraAnnotations := map[string]string{}
 	var addAnnotations []string
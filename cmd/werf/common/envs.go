@@ -13,9 +13,13 @@ const (
 	CmdEnvAnno                  string = "environment"
 	DisableOptionsInUseLineAnno string = "disableOptionsInUseLine"
 
-	WerfDebugAnsibleArgs Env = "WERF_DEBUG_ANSIBLE_ARGS"
-	WerfSecretKey        Env = "WERF_SECRET_KEY"
-	WerfOldSecretKey     Env = "WERF_OLD_SECRET_KEY"
+	WerfDebugAnsibleArgs      Env = "WERF_DEBUG_ANSIBLE_ARGS"
+	WerfSecretKey             Env = "WERF_SECRET_KEY"
+	WerfOldSecretKey          Env = "WERF_OLD_SECRET_KEY"
+	WerfSecretAgeIdentity     Env = "WERF_SECRET_AGE_IDENTITY"
+	WerfSecretAgeIdentityFile Env = "WERF_SECRET_AGE_IDENTITY_FILE"
+	WerfSecretPgpKeyring      Env = "WERF_SECRET_PGP_KEYRING"
+	WerfSecretPgpPassphrase   Env = "WERF_SECRET_PGP_PASSPHRASE"
 )
 
 var envDescription = map[Env]string{
@@ -26,6 +30,16 @@ Secret key also can be defined in files:
 * ~/.werf/global_secret_key (globally),
 * .werf_secret_key (per project)`,
 	WerfOldSecretKey: "Use specified old secret key to rotate secrets",
+	WerfSecretAgeIdentity: `Use specified age identity (AGE-SECRET-KEY-1...) to extract secrets with the age secrets backend.
+
+Identity also can be defined in files:
+* $WERF_SECRET_AGE_IDENTITY_FILE,
+* ~/.werf/age_identity (globally)`,
+	WerfSecretAgeIdentityFile: "Use age identities from the specified file (e.g. generated by age-keygen) to extract secrets with the age secrets backend",
+	WerfSecretPgpKeyring: `Use secret keys from the specified armored or binary keyring (gpg --export-secret-keys) to extract secrets with the pgp secrets backend.
+
+Keyring also can be defined in the file ~/.werf/pgp_secret_keyring (globally)`,
+	WerfSecretPgpPassphrase: "Use specified passphrase to decrypt pgp secret keys",
 }
 
 func EnvsDescription(envs ...Env) string {
@@ -2,14 +2,22 @@ package common
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/flant/werf/pkg/build"
+	"github.com/flant/werf/pkg/git_repo"
 	"github.com/flant/werf/pkg/slug"
 	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util"
 )
 
 type TagOptionsGetterOptions struct {
 	Optional bool
+
+	// ProjectDir is used to get git metadata for the --tag-template
+	ProjectDir string
 }
 
 func GetDeployTag(cmdData *CmdData, opts TagOptionsGetterOptions) (string, tag_strategy.TagStrategy, error) {
@@ -30,6 +38,12 @@ func GetDeployTag(cmdData *CmdData, opts TagOptionsGetterOptions) (string, tag_s
 	if *cmdData.TagByStagesSignature {
 		optionsCount++
 	}
+	if *cmdData.TagSemver != "" {
+		optionsCount++
+	}
+	if *cmdData.TagTemplate != "" {
+		optionsCount++
+	}
 
 	if optionsCount > 1 {
 		return "", "", fmt.Errorf("exactly one tag option should be specified for deploy")
@@ -50,6 +64,14 @@ func GetDeployTag(cmdData *CmdData, opts TagOptionsGetterOptions) (string, tag_s
 		return tagOpts.TagsByGitTag[0], tag_strategy.GitTag, nil
 	} else if len(tagOpts.TagsByGitCommit) > 0 {
 		return tagOpts.TagsByGitCommit[0], tag_strategy.GitCommit, nil
+	} else if len(tagOpts.TagBySemverGitTags) > 0 {
+		version, err := tag_strategy.ParseSemverGitTag(tagOpts.TagBySemverGitTags[0])
+		if err != nil {
+			return "", "", err
+		}
+		return tag_strategy.SemverFullTag(version), tag_strategy.Semver, nil
+	} else if len(tagOpts.TagsByTemplate) > 0 {
+		return tagOpts.TagsByTemplate[0], tag_strategy.Template, nil
 	}
 
 	if !opts.Optional {
@@ -109,9 +131,96 @@ func GetTagOptions(cmdData *CmdData, opts TagOptionsGetterOptions) (build.TagOpt
 		emptyTags = false
 	}
 
+	if gitTag := *cmdData.TagSemver; gitTag != "" {
+		if _, err := tag_strategy.ParseSemverGitTag(gitTag); err != nil {
+			return build.TagOptions{}, fmt.Errorf("bad --tag-semver parameter '%s' specified: %s", gitTag, err)
+		}
+
+		res.TagBySemverGitTags = append(res.TagBySemverGitTags, gitTag)
+		emptyTags = false
+	}
+
+	if tagTemplate := *cmdData.TagTemplate; tagTemplate != "" {
+		templateData, err := getTagTemplateData(opts.ProjectDir)
+		if err != nil {
+			return build.TagOptions{}, fmt.Errorf("unable to get --tag-template data: %s", err)
+		}
+
+		tag, err := tag_strategy.RenderTemplate(tagTemplate, templateData)
+		if err != nil {
+			return build.TagOptions{}, fmt.Errorf("bad --tag-template parameter '%s' specified: %s", tagTemplate, err)
+		}
+
+		if err := slug.ValidateDockerTag(tag); err != nil {
+			return build.TagOptions{}, fmt.Errorf("bad --tag-template parameter '%s' specified: rendered tag '%s' is not valid: %s", tagTemplate, tag, err)
+		}
+
+		res.TagsByTemplate = append(res.TagsByTemplate, tag)
+		emptyTags = false
+	}
+
 	if emptyTags && !opts.Optional {
-		return build.TagOptions{}, fmt.Errorf("tag should be specified with --tag-by-stages-signature, --tag-custom, --tag-git-tag, --tag-git-branch or --tag-git-commit options")
+		return build.TagOptions{}, fmt.Errorf("tag should be specified with --tag-by-stages-signature, --tag-custom, --tag-git-tag, --tag-git-branch, --tag-git-commit, --tag-semver or --tag-template options")
 	}
 
 	return res, nil
 }
+
+// getTagTemplateData takes git metadata from CI environment variables (GitLab CI, GitHub Actions, Travis CI)
+// when available, because CI usually checks out the project in the detached HEAD state,
+// and from the local git repository of the project otherwise
+func getTagTemplateData(projectDir string) (tag_strategy.TemplateData, error) {
+	data := tag_strategy.TemplateData{
+		GitTag:       firstNonEmptyEnv("CI_COMMIT_TAG", "TRAVIS_TAG"),
+		GitBranch:    firstNonEmptyEnv("CI_COMMIT_BRANCH", "TRAVIS_BRANCH"),
+		GitCommit:    firstNonEmptyEnv("CI_COMMIT_SHA", "GITHUB_SHA", "TRAVIS_COMMIT"),
+		CIPipelineId: firstNonEmptyEnv("CI_PIPELINE_ID", "GITHUB_RUN_ID", "TRAVIS_BUILD_ID"),
+		CIJobId:      firstNonEmptyEnv("CI_JOB_ID", "TRAVIS_JOB_ID"),
+	}
+
+	if githubRef := os.Getenv("GITHUB_REF"); githubRef != "" {
+		if strings.HasPrefix(githubRef, "refs/tags/") && data.GitTag == "" {
+			data.GitTag = strings.TrimPrefix(githubRef, "refs/tags/")
+		} else if strings.HasPrefix(githubRef, "refs/heads/") && data.GitBranch == "" {
+			data.GitBranch = strings.TrimPrefix(githubRef, "refs/heads/")
+		}
+	}
+
+	if projectDir != "" {
+		gitDir := filepath.Join(projectDir, ".git")
+		if exist, err := util.DirExists(gitDir); err != nil {
+			return tag_strategy.TemplateData{}, err
+		} else if exist {
+			localGitRepo := &git_repo.Local{Path: projectDir, GitDir: gitDir}
+
+			if data.GitCommit == "" {
+				data.GitCommit = localGitRepo.GetHeadCommit()
+			}
+
+			if data.GitTag == "" {
+				data.GitTag = localGitRepo.GetCurrentTagName()
+			}
+
+			if data.GitBranch == "" && localGitRepo.IsBranchState() {
+				data.GitBranch = localGitRepo.GetCurrentBranchName()
+			}
+		}
+	}
+
+	data.GitCommitShort = data.GitCommit
+	if len(data.GitCommitShort) > 8 {
+		data.GitCommitShort = data.GitCommitShort[:8]
+	}
+
+	return data, nil
+}
+
+func firstNonEmptyEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/ssh_agent"
+	"github.com/flant/werf/pkg/storage"
 	"github.com/flant/werf/pkg/tag_strategy"
 	"github.com/flant/werf/pkg/tmp_manager"
 	"github.com/flant/werf/pkg/true_git"
@@ -54,7 +55,7 @@ Read more info about Helm chart structure, Helm Release name, Kubernetes Namespa
   $ werf deploy --stages-storage :local --release myrelease --namespace myns --images-repo registry.mydomain.com/myproject --tag-custom myversion`,
 		DisableFlagsInUseLine: true,
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -87,10 +88,14 @@ Read more info about Helm chart structure, Helm Release name, Kubernetes Namespa
 	common.SetupHelmReleaseStorageType(&commonCmdData, cmd)
 	common.SetupStatusProgressPeriod(&commonCmdData, cmd)
 	common.SetupHooksStatusProgressPeriod(&commonCmdData, cmd)
+	common.SetupReleaseLock(&commonCmdData, cmd)
+	common.SetupReleaseLockTimeout(&commonCmdData, cmd)
 	common.SetupReleasesHistoryMax(&commonCmdData, cmd)
 
 	common.SetupStagesStorage(&commonCmdData, cmd)
+	common.SetupStagesStorageCache(&commonCmdData, cmd)
 	common.SetupSynchronization(&commonCmdData, cmd)
+	common.SetupPlatform(&commonCmdData, cmd)
 	common.SetupImagesRepo(&commonCmdData, cmd)
 	common.SetupImagesRepoMode(&commonCmdData, cmd)
 	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage and images repo")
@@ -107,6 +112,7 @@ Read more info about Helm chart structure, Helm Release name, Kubernetes Namespa
 	common.SetupIgnoreSecretKey(&commonCmdData, cmd)
 
 	common.SetupThreeWayMergeMode(&commonCmdData, cmd)
+	common.SetupPrometheusUrl(&commonCmdData, cmd)
 
 	cmd.Flags().IntVarP(&cmdData.Timeout, "timeout", "t", 0, "Resources tracking timeout in seconds")
 
@@ -136,22 +142,6 @@ func runDeploy() error {
 		return err
 	}
 
-	deployInitOptions := deploy.InitOptions{
-		HelmInitOptions: helm.InitOptions{
-			KubeConfig:                  *commonCmdData.KubeConfig,
-			KubeContext:                 *commonCmdData.KubeContext,
-			HelmReleaseStorageNamespace: *commonCmdData.HelmReleaseStorageNamespace,
-			HelmReleaseStorageType:      helmReleaseStorageType,
-			StatusProgressPeriod:        common.GetStatusProgressPeriod(&commonCmdData),
-			HooksStatusProgressPeriod:   common.GetHooksStatusProgressPeriod(&commonCmdData),
-			ReleasesMaxHistory:          *commonCmdData.ReleasesHistoryMax,
-			InitNamespace:               true,
-		},
-	}
-	if err := deploy.Init(deployInitOptions); err != nil {
-		return err
-	}
-
 	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *commonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *commonCmdData.SkipTlsVerifyRegistry}); err != nil {
 		return err
 	}
@@ -191,13 +181,21 @@ func runDeploy() error {
 	var tagStrategy tag_strategy.TagStrategy
 	var imagesInfoGetters []images_manager.ImageInfoGetter
 	if len(werfConfig.StapelImages) != 0 || len(werfConfig.ImagesFromDockerfile) != 0 {
+		var stagesStorage storage.StagesStorage = &storage.LocalStagesStorage{}
+		var storageLockManager storage.LockManager = &storage.FileLockManager{}
+		var stagesStorageCache storage.StagesStorageCache
 		if len(werfConfig.StapelImages) != 0 {
-			_, err = common.GetStagesStorage(&commonCmdData)
+			stagesStorage, err = common.GetStagesStorage(&commonCmdData)
+			if err != nil {
+				return err
+			}
+
+			storageLockManager, err = common.GetStorageLockManager(&commonCmdData)
 			if err != nil {
 				return err
 			}
 
-			_, err = common.GetSynchronization(&commonCmdData)
+			stagesStorageCache, err = common.GetStagesStorageCache(&commonCmdData)
 			if err != nil {
 				return err
 			}
@@ -218,7 +216,7 @@ func runDeploy() error {
 			return err
 		}
 
-		tag, tagStrategy, err = common.GetDeployTag(&commonCmdData, common.TagOptionsGetterOptions{})
+		tag, tagStrategy, err = common.GetDeployTag(&commonCmdData, common.TagOptionsGetterOptions{ProjectDir: projectDir})
 		if err != nil {
 			return err
 		}
@@ -233,15 +231,36 @@ func runDeploy() error {
 			}
 		}()
 
-		logboek.LogOptionalLn()
-		c := build.NewConveyor(werfConfig, []string{}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
-		defer c.Terminate()
-
-		if err = c.ShouldBeBuilt(); err != nil {
+		platforms, err := common.GetPlatforms(&commonCmdData, werfConfig)
+		if err != nil {
 			return err
 		}
 
-		imagesInfoGetters = c.GetImageInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, tagStrategy, false)
+		// images of all platforms are published by the same tags (manifest lists),
+		// the stages-signature tag is calculated by the stages signatures of all platforms
+		stagesSignatures := build.NewImagesStagesSignatures()
+		for _, platform := range platforms {
+			logboek.LogOptionalLn()
+			if err := common.WithPlatform(platform, func() error {
+				c := build.NewConveyor(werfConfig, []string{}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock, stagesStorage, storageLockManager, build.ConveyorOptions{StagesStorageCache: stagesStorageCache, Platform: platform})
+				defer c.Terminate()
+
+				if err := c.ShouldBeBuilt(); err != nil {
+					return err
+				}
+
+				stagesSignatures.Add(c)
+
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		imagesInfoGetters, err = build.GetImageInfoGetters(werfConfig.StapelImages, werfConfig.ImagesFromDockerfile, imagesRepoManager, tag, tagStrategy, stagesSignatures, false)
+		if err != nil {
+			return err
+		}
 	}
 
 	if imagesRepoManager == nil {
@@ -258,6 +277,25 @@ func runDeploy() error {
 		return err
 	}
 
+	deployInitOptions := deploy.InitOptions{
+		HelmInitOptions: helm.InitOptions{
+			KubeConfig:                  *commonCmdData.KubeConfig,
+			KubeContext:                 *commonCmdData.KubeContext,
+			HelmReleaseStorageNamespace: *commonCmdData.HelmReleaseStorageNamespace,
+			HelmReleaseStorageType:      helmReleaseStorageType,
+			ReleaseNamespace:            namespace,
+			StatusProgressPeriod:        common.GetStatusProgressPeriod(&commonCmdData),
+			HooksStatusProgressPeriod:   common.GetHooksStatusProgressPeriod(&commonCmdData),
+			ReleaseLock:                 *commonCmdData.ReleaseLock,
+			ReleaseLockTimeout:          common.GetReleaseLockTimeout(&commonCmdData),
+			ReleasesMaxHistory:          *commonCmdData.ReleasesHistoryMax,
+			InitNamespace:               true,
+		},
+	}
+	if err := deploy.Init(deployInitOptions); err != nil {
+		return err
+	}
+
 	userExtraAnnotations, err := common.GetUserExtraAnnotations(&commonCmdData)
 	if err != nil {
 		return err
@@ -280,5 +318,6 @@ func runDeploy() error {
 		UserExtraLabels:      userExtraLabels,
 		IgnoreSecretKey:      *commonCmdData.IgnoreSecretKey,
 		ThreeWayMergeMode:    threeWayMergeMode,
+		PrometheusUrl:        *commonCmdData.PrometheusUrl,
 	})
 }
@@ -70,6 +70,8 @@ Read more info about Helm Release name, Kubernetes Namespace and how to change i
 	common.SetupHelmReleaseStorageNamespace(&commonCmdData, cmd)
 	common.SetupHelmReleaseStorageType(&commonCmdData, cmd)
 	common.SetupReleasesHistoryMax(&commonCmdData, cmd)
+	common.SetupReleaseLock(&commonCmdData, cmd)
+	common.SetupReleaseLockTimeout(&commonCmdData, cmd)
 
 	common.SetupDockerConfig(&commonCmdData, cmd, "")
 
@@ -96,19 +98,6 @@ func runDismiss() error {
 		return err
 	}
 
-	deployInitOptions := deploy.InitOptions{
-		HelmInitOptions: helm.InitOptions{
-			KubeConfig:                  *commonCmdData.KubeConfig,
-			KubeContext:                 *commonCmdData.KubeContext,
-			HelmReleaseStorageNamespace: *commonCmdData.HelmReleaseStorageNamespace,
-			HelmReleaseStorageType:      helmReleaseStorageType,
-			ReleasesMaxHistory:          *commonCmdData.ReleasesHistoryMax,
-		},
-	}
-	if err := deploy.Init(deployInitOptions); err != nil {
-		return err
-	}
-
 	common.LogKubeContext(kube.Context)
 
 	if err := docker.Init(*commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
@@ -147,6 +136,22 @@ func runDismiss() error {
 		return err
 	}
 
+	deployInitOptions := deploy.InitOptions{
+		HelmInitOptions: helm.InitOptions{
+			KubeConfig:                  *commonCmdData.KubeConfig,
+			KubeContext:                 *commonCmdData.KubeContext,
+			HelmReleaseStorageNamespace: *commonCmdData.HelmReleaseStorageNamespace,
+			HelmReleaseStorageType:      helmReleaseStorageType,
+			ReleaseNamespace:            namespace,
+			ReleasesMaxHistory:          *commonCmdData.ReleasesHistoryMax,
+			ReleaseLock:                 *commonCmdData.ReleaseLock,
+			ReleaseLockTimeout:          common.GetReleaseLockTimeout(&commonCmdData),
+		},
+	}
+	if err := deploy.Init(deployInitOptions); err != nil {
+		return err
+	}
+
 	if err := logboek.Default.LogBlock("Deploy options", logboek.LevelLogBlockOptions{}, func() error {
 		logboek.LogF("Kubernetes namespace: %s\n", namespace)
 		logboek.LogF("Helm release storage namespace: %s\n", *commonCmdData.HelmReleaseStorageNamespace)
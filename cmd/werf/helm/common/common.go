@@ -35,8 +35,8 @@ func GetEnvironmentOrStub(environmentOption string) string {
 	return environmentOption
 }
 
-func GetTagOrStub(commonCmdData *common.CmdData) (string, tag_strategy.TagStrategy, error) {
-	tag, tagStrategy, err := common.GetDeployTag(commonCmdData, common.TagOptionsGetterOptions{Optional: true})
+func GetTagOrStub(commonCmdData *common.CmdData, projectDir string) (string, tag_strategy.TagStrategy, error) {
+	tag, tagStrategy, err := common.GetDeployTag(commonCmdData, common.TagOptionsGetterOptions{Optional: true, ProjectDir: projectDir})
 	if err != nil {
 		return "", "", err
 	}
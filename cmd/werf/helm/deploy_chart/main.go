@@ -71,6 +71,8 @@ func NewCmd() *cobra.Command {
 	common.SetupHelmReleaseStorageType(&commonCmdData, cmd)
 	common.SetupStatusProgressPeriod(&commonCmdData, cmd)
 	common.SetupHooksStatusProgressPeriod(&commonCmdData, cmd)
+	common.SetupReleaseLock(&commonCmdData, cmd)
+	common.SetupReleaseLockTimeout(&commonCmdData, cmd)
 
 	common.SetupLogOptions(&commonCmdData, cmd)
 
@@ -79,6 +81,7 @@ func NewCmd() *cobra.Command {
 	common.SetupValues(&commonCmdData, cmd)
 
 	common.SetupThreeWayMergeMode(&commonCmdData, cmd)
+	common.SetupPrometheusUrl(&commonCmdData, cmd)
 
 	helm_common.SetupHelmHome(&helmCmdData, cmd)
 
@@ -128,8 +131,11 @@ func runDeployChart(chartDirOrChartReference string, releaseName string) error {
 			KubeContext:                 *commonCmdData.KubeContext,
 			HelmReleaseStorageNamespace: *commonCmdData.HelmReleaseStorageNamespace,
 			HelmReleaseStorageType:      helmReleaseStorageType,
+			ReleaseNamespace:            cmdData.Namespace,
 			StatusProgressPeriod:        common.GetStatusProgressPeriod(&commonCmdData),
 			HooksStatusProgressPeriod:   common.GetHooksStatusProgressPeriod(&commonCmdData),
+			ReleaseLock:                 *commonCmdData.ReleaseLock,
+			ReleaseLockTimeout:          common.GetReleaseLockTimeout(&commonCmdData),
 			InitNamespace:               true,
 		},
 	}
@@ -195,6 +201,7 @@ func runDeployChart(chartDirOrChartReference string, releaseName string) error {
 			Values:    *commonCmdData.Values,
 		},
 		ThreeWayMergeMode: threeWayMergeMode,
+		PrometheusUrl:     *commonCmdData.PrometheusUrl,
 	}); err != nil {
 		replaceOld := fmt.Sprintf("%s/", werfChart.Name)
 		replaceNew := fmt.Sprintf("%s/", strings.TrimRight(werfChart.ChartDir, "/"))
@@ -0,0 +1,225 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/kubedog/pkg/kube"
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/cmd/werf/common"
+	helm_common "github.com/flant/werf/cmd/werf/helm/common"
+	"github.com/flant/werf/pkg/deploy"
+	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/images_manager"
+	"github.com/flant/werf/pkg/tmp_manager"
+	"github.com/flant/werf/pkg/true_git"
+	"github.com/flant/werf/pkg/werf"
+)
+
+var cmdData struct {
+	Live   bool
+	Output string
+}
+
+var commonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show changes that werf deploy would make",
+		Long: common.GetLongCommandDescription(`Show changes that werf deploy would make.
+
+The chart is rendered with the same service values, secrets, extra annotations and labels as werf deploy uses. Rendered resources are compared with the manifests of the latest release revision or with live cluster objects (--live option). Secret values are masked in the output.`),
+		DisableFlagsInUseLine: true,
+		Annotations: map[string]string{
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+
+			return runDiff()
+		},
+	}
+
+	common.SetupDir(&commonCmdData, cmd)
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+
+	common.SetupKubeConfig(&commonCmdData, cmd)
+	common.SetupKubeContext(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageNamespace(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageType(&commonCmdData, cmd)
+
+	common.SetupNamespace(&commonCmdData, cmd)
+	common.SetupRelease(&commonCmdData, cmd)
+	common.SetupEnvironment(&commonCmdData, cmd)
+	common.SetupDockerConfig(&commonCmdData, cmd, "")
+	common.SetupAddAnnotations(&commonCmdData, cmd)
+	common.SetupAddLabels(&commonCmdData, cmd)
+
+	common.SetupSet(&commonCmdData, cmd)
+	common.SetupSetString(&commonCmdData, cmd)
+	common.SetupValues(&commonCmdData, cmd)
+	common.SetupSecretValues(&commonCmdData, cmd)
+	common.SetupIgnoreSecretKey(&commonCmdData, cmd)
+
+	common.SetupImagesRepo(&commonCmdData, cmd)
+	common.SetupImagesRepoMode(&commonCmdData, cmd)
+	common.SetupTag(&commonCmdData, cmd)
+
+	common.SetupLogOptions(&commonCmdData, cmd)
+
+	cmd.Flags().BoolVarP(&cmdData.Live, "live", "", false, "Compare with live cluster objects instead of the latest release revision")
+	cmd.Flags().StringVarP(&cmdData.Output, "output", "", string(helm.TextDiffOutput), fmt.Sprintf("Output format: %s or %s", helm.TextDiffOutput, helm.JsonDiffOutput))
+
+	return cmd
+}
+
+func runDiff() error {
+	tmp_manager.AutoGCEnabled = false
+
+	var output helm.DiffOutputType
+	switch outputType := helm.DiffOutputType(cmdData.Output); outputType {
+	case helm.TextDiffOutput, helm.JsonDiffOutput:
+		output = outputType
+	default:
+		return fmt.Errorf("bad --output value '%s': %s and %s are supported", cmdData.Output, helm.TextDiffOutput, helm.JsonDiffOutput)
+	}
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		return err
+	}
+
+	if err := true_git.Init(true_git.Options{Out: logboek.GetOutStream(), Err: logboek.GetErrStream(), LiveGitOutput: *commonCmdData.LogVerbose || *commonCmdData.LogDebug}); err != nil {
+		return err
+	}
+
+	helmReleaseStorageType, err := common.GetHelmReleaseStorageType(*commonCmdData.HelmReleaseStorageType)
+	if err != nil {
+		return err
+	}
+
+	if err := docker.Init(*commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
+		return err
+	}
+
+	if err := kube.Init(kube.InitOptions{KubeContext: *commonCmdData.KubeContext, KubeConfig: *commonCmdData.KubeConfig}); err != nil {
+		return fmt.Errorf("cannot initialize kube: %s", err)
+	}
+
+	projectDir, err := common.GetProjectDir(&commonCmdData)
+	if err != nil {
+		return fmt.Errorf("getting project dir failed: %s", err)
+	}
+
+	werfConfig, err := common.GetRequiredWerfConfig(projectDir, false)
+	if err != nil {
+		return fmt.Errorf("unable to load werf config: %s", err)
+	}
+
+	optionalImagesRepo, err := common.GetOptionalImagesRepo(werfConfig.Meta.Project, &commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	withoutImagesRepo := true
+	if optionalImagesRepo != "" {
+		withoutImagesRepo = false
+	}
+
+	imagesRepo := helm_common.GetImagesRepoOrStub(optionalImagesRepo)
+
+	imagesRepoMode, err := common.GetImagesRepoMode(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	if err != nil {
+		return err
+	}
+
+	env := helm_common.GetEnvironmentOrStub(*commonCmdData.Environment)
+
+	release, err := common.GetHelmRelease(*commonCmdData.Release, env, werfConfig)
+	if err != nil {
+		return err
+	}
+
+	namespace, err := common.GetKubernetesNamespace(*commonCmdData.Namespace, env, werfConfig)
+	if err != nil {
+		return err
+	}
+
+	deployInitOptions := deploy.InitOptions{
+		HelmInitOptions: helm.InitOptions{
+			KubeConfig:                  *commonCmdData.KubeConfig,
+			KubeContext:                 *commonCmdData.KubeContext,
+			HelmReleaseStorageNamespace: *commonCmdData.HelmReleaseStorageNamespace,
+			HelmReleaseStorageType:      helmReleaseStorageType,
+			ReleaseNamespace:            namespace,
+		},
+	}
+	if err := deploy.Init(deployInitOptions); err != nil {
+		return err
+	}
+
+	tag, tagStrategy, err := helm_common.GetTagOrStub(&commonCmdData, projectDir)
+	if err != nil {
+		return err
+	}
+
+	userExtraAnnotations, err := common.GetUserExtraAnnotations(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	userExtraLabels, err := common.GetUserExtraLabels(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	var imagesInfoGetters []images_manager.ImageInfoGetter
+	var imagesNames []string
+	for _, imageConfig := range werfConfig.StapelImages {
+		imagesNames = append(imagesNames, imageConfig.Name)
+	}
+	for _, imageConfig := range werfConfig.ImagesFromDockerfile {
+		imagesNames = append(imagesNames, imageConfig.Name)
+	}
+	for _, imageName := range imagesNames {
+		d := &images_manager.ImageInfo{Name: imageName, WithoutRegistry: withoutImagesRepo, ImagesRepoManager: imagesRepoManager, Tag: tag}
+		imagesInfoGetters = append(imagesInfoGetters, d)
+	}
+
+	return deploy.RunDiff(os.Stdout, projectDir, werfConfig, imagesRepoManager, imagesInfoGetters, tag, tagStrategy, deploy.DiffOptions{
+		RenderOptions: deploy.RenderOptions{
+			ReleaseName:          release,
+			Namespace:            namespace,
+			WithoutImagesRepo:    withoutImagesRepo,
+			Values:               *commonCmdData.Values,
+			SecretValues:         *commonCmdData.SecretValues,
+			Set:                  *commonCmdData.Set,
+			SetString:            *commonCmdData.SetString,
+			Env:                  env,
+			UserExtraAnnotations: userExtraAnnotations,
+			UserExtraLabels:      userExtraLabels,
+			IgnoreSecretKey:      *commonCmdData.IgnoreSecretKey,
+		},
+		Live:   cmdData.Live,
+		Output: output,
+	})
+}
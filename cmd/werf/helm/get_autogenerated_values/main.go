@@ -32,7 +32,7 @@ func NewCmd() *cobra.Command {
 These values includes project name, docker images ids and other`),
 		DisableFlagsInUseLine: true,
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -132,7 +132,7 @@ func runGetServiceValues() error {
 		return err
 	}
 
-	tag, tagStrategy, err := helm_common.GetTagOrStub(&commonCmdData)
+	tag, tagStrategy, err := helm_common.GetTagOrStub(&commonCmdData, projectDir)
 	if err != nil {
 		return err
 	}
@@ -99,6 +99,7 @@ func runLs(filter string) error {
 			KubeContext:                 *commonCmdData.KubeContext,
 			HelmReleaseStorageNamespace: *commonCmdData.HelmReleaseStorageNamespace,
 			HelmReleaseStorageType:      helmReleaseStorageType,
+			ReleaseNamespace:            CmdData.Namespace,
 			ReleasesMaxHistory:          0,
 		},
 	}
@@ -0,0 +1,79 @@
+package migrate_release
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/kubedog/pkg/kube"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/werf"
+)
+
+var cmdData struct {
+	helm.MigrateReleaseOptions
+}
+
+var commonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate-release RELEASE_NAME",
+		Short: "Migrate release to Helm 3 release storage",
+		Long: common.GetLongCommandDescription(`Migrate release to Helm 3 release storage.
+
+All revisions of the release are copied from the configmap or secret release storage (--helm-release-storage-type and --helm-release-storage-namespace options) into Helm 3 release secrets in the release namespace. Use --helm-release-storage-type=helm3 for the migrated release afterwards.`),
+		DisableFlagsInUseLine: true,
+		Annotations: map[string]string{
+			common.CmdEnvAnno: common.EnvsDescription(),
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+
+			if err := common.ValidateArgumentCount(1, args, cmd); err != nil {
+				return err
+			}
+
+			return runMigrateRelease(args[0])
+		},
+	}
+
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+
+	common.SetupKubeConfig(&commonCmdData, cmd)
+	common.SetupKubeContext(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageNamespace(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageType(&commonCmdData, cmd)
+
+	common.SetupLogOptions(&commonCmdData, cmd)
+
+	cmd.Flags().BoolVarP(&cmdData.DeleteHelm2Release, "delete-helm2-release", "", false, "Delete the release from the source release storage after migration")
+	cmd.Flags().BoolVarP(&cmdData.DryRun, "dry-run", "", false, "Show revisions to migrate without changes")
+
+	return cmd
+}
+
+func runMigrateRelease(releaseName string) error {
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	helmReleaseStorageType, err := common.GetHelmReleaseStorageType(*commonCmdData.HelmReleaseStorageType)
+	if err != nil {
+		return err
+	}
+
+	if err := kube.Init(kube.InitOptions{KubeContext: *commonCmdData.KubeContext, KubeConfig: *commonCmdData.KubeConfig}); err != nil {
+		return fmt.Errorf("cannot initialize kube: %s", err)
+	}
+
+	common.LogKubeContext(kube.Context)
+
+	return helm.MigrateReleaseToHelm3(releaseName, *commonCmdData.HelmReleaseStorageNamespace, helmReleaseStorageType, cmdData.MigrateReleaseOptions)
+}
@@ -33,7 +33,7 @@ func NewCmd() *cobra.Command {
 		Short:                 "Render werf chart templates to stdout",
 		DisableFlagsInUseLine: true,
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -140,7 +140,7 @@ func runRender(outputFilePath string) error {
 		return err
 	}
 
-	tag, tagStrategy, err := helm_common.GetTagOrStub(&commonCmdData)
+	tag, tagStrategy, err := helm_common.GetTagOrStub(&commonCmdData, projectDir)
 	if err != nil {
 		return err
 	}
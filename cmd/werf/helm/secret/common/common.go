@@ -10,6 +10,10 @@ import (
 
 	"github.com/flant/logboek"
 
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/deploy/secret"
+	pkg_secret "github.com/flant/werf/pkg/secret"
 	"github.com/flant/werf/pkg/util"
 )
 
@@ -19,6 +23,29 @@ type GenerateOptions struct {
 	Values         bool
 }
 
+// GetManager returns manager for the secrets backend defined in werf.yaml (werf.yaml is optional for the aes backend)
+func GetManager(projectDir string) (secret.Manager, error) {
+	secretsConfig, err := GetSecretsConfig(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret.GetManager(projectDir, secretsConfig)
+}
+
+func GetSecretsConfig(projectDir string) (config.Secrets, error) {
+	werfConfig, err := common.GetOptionalWerfConfig(projectDir, false)
+	if err != nil {
+		return config.Secrets{}, fmt.Errorf("unable to load werf config: %s", err)
+	}
+
+	if werfConfig == nil {
+		return config.Secrets{Backend: pkg_secret.AesBackend}, nil
+	}
+
+	return werfConfig.Meta.Secrets, nil
+}
+
 func ReadFileData(filePath string) ([]byte, error) {
 	if exist, err := util.FileExists(filePath); err != nil {
 		return nil, err
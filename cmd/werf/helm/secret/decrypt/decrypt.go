@@ -36,7 +36,7 @@ Encryption key should be in $WERF_SECRET_KEY or .werf_secret_key file`),
   $ cat .helm/secret/date | werf helm secret decrypt
   Tue Jun 26 09:58:10 PDT 1990`,
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -69,7 +69,7 @@ func runSecretDecrypt() error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	m, err := secret.GetManager(projectDir)
+	m, err := secret_common.GetManager(projectDir)
 	if err != nil {
 		return err
 	}
@@ -35,7 +35,7 @@ Encryption key should be in $WERF_SECRET_KEY or .werf_secret_key file`),
   # Encrypt from a pipe and save result in file
   $ date | werf helm secret encrypt -o .helm/secret/date`,
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -68,7 +68,7 @@ func runSecretEncrypt() error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	m, err := secret.GetManager(projectDir)
+	m, err := secret_common.GetManager(projectDir)
 	if err != nil {
 		return err
 	}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/flant/werf/cmd/werf/common"
 	secret_common "github.com/flant/werf/cmd/werf/helm/secret/common"
-	"github.com/flant/werf/pkg/deploy/secret"
 	"github.com/flant/werf/pkg/werf"
 )
 
@@ -23,7 +22,7 @@ Encryption key should be in $WERF_SECRET_KEY or .werf_secret_key file`),
 		Example: `  # Create/edit existing secret file
   $ werf helm secret file edit .helm/secret/privacy`,
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -58,7 +57,7 @@ func runSecretEdit(filepPath string) error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	m, err := secret.GetManager(projectDir)
+	m, err := secret_common.GetManager(projectDir)
 	if err != nil {
 		return err
 	}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/flant/werf/cmd/werf/common"
 	secret_common "github.com/flant/werf/cmd/werf/helm/secret/common"
-	"github.com/flant/werf/pkg/deploy/secret"
 	"github.com/flant/werf/pkg/werf"
 )
 
@@ -28,7 +27,7 @@ Encryption key should be in $WERF_SECRET_KEY or .werf_secret_key file`),
 		Example: `  # Encrypt and save result in file
   $ werf helm secret file encrypt tls.crt -o .helm/secret/tls.crt`,
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -75,7 +74,7 @@ func runSecretEncrypt(filePath string) error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	m, err := secret.GetManager(projectDir)
+	m, err := secret_common.GetManager(projectDir)
 	if err != nil {
 		return err
 	}
@@ -12,7 +12,9 @@ import (
 	"github.com/flant/logboek"
 
 	"github.com/flant/werf/cmd/werf/common"
+	secret_common "github.com/flant/werf/cmd/werf/helm/secret/common"
 	"github.com/flant/werf/pkg/deploy/secret"
+	pkg_secret "github.com/flant/werf/pkg/secret"
 	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
 )
@@ -29,12 +31,15 @@ func NewCmd() *cobra.Command {
 Old key should be specified in the $WERF_OLD_SECRET_KEY.
 New key should reside either in the $WERF_SECRET_KEY or .werf_secret_key file.
 
+With the age or pgp secrets backend (secrets section of the werf.yaml) command regenerates secret files for the current recipients, e.g. after a team member has been added or removed.
+Data is extracted with the own identity or with the old aes key from the $WERF_OLD_SECRET_KEY to migrate from the aes backend.
+
 Command will extract data with the old key, generate new secret data and rewrite files:
 * standard raw secret files in the .helm/secret folder;
 * standard secret values yaml file .helm/secret-values.yaml;
 * additional secret values yaml files specified with EXTRA_SECRET_VALUES_FILE_PATH params`),
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfOldSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfOldSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
@@ -65,22 +70,30 @@ func runRotateSecretKey(cmd *cobra.Command, secretValuesPaths ...string) error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	newSecret, err := secret.GetManager(projectDir)
+	secretsConfig, err := secret_common.GetSecretsConfig(projectDir)
+	if err != nil {
+		return err
+	}
+
+	newSecret, err := secret.GetManager(projectDir, secretsConfig)
 	if err != nil {
 		return err
 	}
 
+	var oldSecret secret.Manager
 	oldSecretKey := os.Getenv("WERF_OLD_SECRET_KEY")
-	if oldSecretKey == "" {
+	if oldSecretKey != "" {
+		oldSecret, err = secret.NewManager([]byte(oldSecretKey))
+		if err != nil {
+			return err
+		}
+	} else if secretsConfig.Backend == pkg_secret.AgeBackend || secretsConfig.Backend == pkg_secret.PgpBackend {
+		oldSecret = newSecret
+	} else {
 		common.PrintHelp(cmd)
 		return fmt.Errorf("WERF_OLD_SECRET_KEY environment required")
 	}
 
-	oldSecret, err := secret.NewManager([]byte(oldSecretKey))
-	if err != nil {
-		return err
-	}
-
 	return secretsRegenerate(newSecret, oldSecret, projectDir, secretValuesPaths...)
 }
 
@@ -8,7 +8,6 @@ import (
 
 	"github.com/flant/werf/cmd/werf/common"
 	secret_common "github.com/flant/werf/cmd/werf/helm/secret/common"
-	"github.com/flant/werf/pkg/deploy/secret"
 	"github.com/flant/werf/pkg/werf"
 )
 
@@ -26,7 +25,7 @@ func NewCmd() *cobra.Command {
 		Long: common.GetLongCommandDescription(`Encrypt data from FILE_PATH or pipe.
 Encryption key should be in $WERF_SECRET_KEY or .werf_secret_key file`),
 		Annotations: map[string]string{
-			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey),
+			common.CmdEnvAnno: common.EnvsDescription(common.WerfSecretKey, common.WerfSecretAgeIdentity, common.WerfSecretAgeIdentityFile, common.WerfSecretPgpKeyring, common.WerfSecretPgpPassphrase),
 		},
 		Example: `  # Encrypt and save result in file
   $ werf helm secret values encrypt test.yaml -o .helm/secret-values.yaml`,
@@ -75,7 +74,7 @@ func runSecretEncrypt(filePath string) error {
 		return fmt.Errorf("getting project dir failed: %s", err)
 	}
 
-	m, err := secret.GetManager(projectDir)
+	m, err := secret_common.GetManager(projectDir)
 	if err != nil {
 		return err
 	}
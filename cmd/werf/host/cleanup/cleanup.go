@@ -2,8 +2,10 @@ package cleanup
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 
 	"github.com/flant/logboek"
@@ -17,6 +19,10 @@ import (
 	"github.com/flant/werf/pkg/werf"
 )
 
+var cmdData struct {
+	CacheMountsMaxSize string
+}
+
 var commonCmdData common.CmdData
 
 func NewCmd() *cobra.Command {
@@ -31,6 +37,9 @@ The data include:
 * Local cache:
   * Remote git clones cache.
   * Git worktree cache.
+* Least recently used cache mounts (mounts from cache), when the total size of cache mounts exceeds --cache-mounts-max-size.
+
+Size, last usage time, fetched history depth and blobs of remote git clones are printed at the end.
 
 It is safe to run this command periodically by automated cleanup job in parallel with other werf commands such as build, deploy, stages and images cleanup.`),
 		DisableFlagsInUseLine: true,
@@ -57,10 +66,22 @@ It is safe to run this command periodically by automated cleanup job in parallel
 
 	common.SetupDryRun(&commonCmdData, cmd)
 
+	defaultCacheMountsMaxSize := os.Getenv("WERF_CACHE_MOUNTS_MAX_SIZE")
+	if defaultCacheMountsMaxSize == "" {
+		defaultCacheMountsMaxSize = "10GiB"
+	}
+
+	cmd.Flags().StringVarP(&cmdData.CacheMountsMaxSize, "cache-mounts-max-size", "", defaultCacheMountsMaxSize, "Total size limit of cache mounts of all projects on host machine, least recently used cache mounts are removed to fit the limit (default $WERF_CACHE_MOUNTS_MAX_SIZE or 10GiB)")
+
 	return cmd
 }
 
 func runGC() error {
+	cacheMountsMaxSize, err := units.RAMInBytes(cmdData.CacheMountsMaxSize)
+	if err != nil {
+		return fmt.Errorf("bad --cache-mounts-max-size %q: %s", cmdData.CacheMountsMaxSize, err)
+	}
+
 	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
 		return fmt.Errorf("initialization error: %s", err)
 	}
@@ -82,7 +103,7 @@ func runGC() error {
 	}
 
 	logboek.LogOptionalLn()
-	hostCleanupOptions := cleaning.HostCleanupOptions{DryRun: *commonCmdData.DryRun}
+	hostCleanupOptions := cleaning.HostCleanupOptions{DryRun: *commonCmdData.DryRun, CacheMountsMaxSize: cacheMountsMaxSize}
 	if err := cleaning.HostCleanup(hostCleanupOptions); err != nil {
 		return err
 	}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"path/filepath"
 
-	"github.com/flant/werf/pkg/storage"
-
 	"github.com/spf13/cobra"
 
 	"github.com/flant/kubedog/pkg/kube"
@@ -57,6 +55,10 @@ func NewCmd() *cobra.Command {
 
 	common.SetupKubeConfig(&commonCmdData, cmd)
 	common.SetupKubeContext(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageNamespace(&commonCmdData, cmd)
+	common.SetupHelmReleaseStorageType(&commonCmdData, cmd)
+	common.SetupKeepHelmReleaseRevisions(&commonCmdData, cmd)
+	common.SetupScanResourceImagesPath(&commonCmdData, cmd)
 
 	common.SetupLogOptions(&commonCmdData, cmd)
 	common.SetupLogProjectDir(&commonCmdData, cmd)
@@ -130,13 +132,13 @@ func runCleanup() error {
 		return err
 	}
 
-	if _, err := common.GetStagesStorage(&commonCmdData); err != nil {
+	stagesStorage, err := common.GetStagesStorage(&commonCmdData)
+	if err != nil {
 		return err
 	}
 	if _, err := common.GetSynchronization(&commonCmdData); err != nil {
 		return err
 	}
-	stagesStorage := &storage.LocalStagesStorage{}
 
 	imagesNames, err := common.GetManagedImagesNames(projectName, stagesStorage, werfConfig)
 	if err != nil {
@@ -160,6 +162,11 @@ func runCleanup() error {
 		return err
 	}
 
+	kubernetesImagesOptions, err := common.GetKubernetesImagesOptions(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
 	kubernetesContextsClients, err := kube.GetAllContextsClients(kube.GetAllContextsClientsOptions{KubeConfig: *commonCmdData.KubeConfig})
 	if err != nil {
 		return fmt.Errorf("unable to get Kubernetes clusters connections: %s", err)
@@ -173,8 +180,10 @@ func runCleanup() error {
 		},
 		LocalGit:                  localRepo,
 		KubernetesContextsClients: kubernetesContextsClients,
+		KubernetesImagesOptions:   kubernetesImagesOptions,
 		WithoutKube:               *commonCmdData.WithoutKube,
 		Policies:                  policies,
+		Rules:                     werfConfig.Meta.Cleanup.Rules,
 	}
 
 	logboek.LogOptionalLn()
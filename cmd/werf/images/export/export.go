@@ -0,0 +1,207 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/build"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/images_archive"
+	"github.com/flant/werf/pkg/logging"
+	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/werf"
+)
+
+var cmdData struct {
+	ToOCIArchive  string
+	ArchiveFormat string
+}
+
+var commonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [IMAGE_NAME...]",
+		Short: "Export published images from images repo into the archive",
+		Long: common.GetLongCommandDescription(`Export images published by werf from images repo into the OCI image layout directory or the docker-archive tarball.
+
+Werf labels of the images are saved into the archive, so that the images can be pushed into another images repo by werf images import with the same tags, e.g. to transfer images into the air-gapped environment.
+
+If one or more IMAGE_NAME parameters specified, werf will export only these images from werf.yaml.
+
+If tag options are specified, werf will export only the images published with these tags (the same options as for werf images publish, --tag-by-stages-signature selects all images published by stages-signature strategy).`),
+		Example: `  # Export all published images of the project into the OCI image layout directory
+  $ werf images export --images-repo registry.mydomain.com/myproject --to-oci-archive ./myproject-images
+
+  # Export published images of the backend image into the docker-archive tarball
+  $ werf images export backend --images-repo registry.mydomain.com/myproject --to-oci-archive ./backend.tar --archive-format docker-archive
+
+  # Export images published by the semver tagging strategy for the v1.2.3 git tag
+  $ werf images export --images-repo registry.mydomain.com/myproject --to-oci-archive ./myproject-images --tag-semver v1.2.3`,
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+			common.LogVersion()
+
+			return common.LogRunningTime(func() error {
+				return runExport(args)
+			})
+		},
+	}
+
+	common.SetupDir(&commonCmdData, cmd)
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+
+	common.SetupImagesRepo(&commonCmdData, cmd)
+	common.SetupImagesRepoMode(&commonCmdData, cmd)
+	common.SetupTag(&commonCmdData, cmd)
+	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read images from the specified images repo")
+	common.SetupInsecureRegistry(&commonCmdData, cmd)
+	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
+
+	common.SetupLogOptions(&commonCmdData, cmd)
+	common.SetupLogProjectDir(&commonCmdData, cmd)
+
+	cmd.Flags().StringVarP(&cmdData.ToOCIArchive, "to-oci-archive", "", os.Getenv("WERF_TO_OCI_ARCHIVE"), "Path to the OCI image layout directory or the docker-archive tarball to write images into (default $WERF_TO_OCI_ARCHIVE)")
+
+	defaultArchiveFormat := os.Getenv("WERF_ARCHIVE_FORMAT")
+	if defaultArchiveFormat == "" {
+		defaultArchiveFormat = images_archive.OCILayoutFormat
+	}
+	cmd.Flags().StringVarP(&cmdData.ArchiveFormat, "archive-format", "", defaultArchiveFormat, fmt.Sprintf("Archive format: %[1]s or %[2]s (defaults to $WERF_ARCHIVE_FORMAT or %[1]s)", images_archive.OCILayoutFormat, images_archive.DockerArchiveFormat))
+
+	return cmd
+}
+
+func runExport(imagesToProcess []string) error {
+	if cmdData.ToOCIArchive == "" {
+		return fmt.Errorf("--to-oci-archive PATH param required")
+	}
+
+	switch cmdData.ArchiveFormat {
+	case images_archive.OCILayoutFormat, images_archive.DockerArchiveFormat:
+	default:
+		return fmt.Errorf("bad --archive-format '%s': only %s or %s supported", cmdData.ArchiveFormat, images_archive.OCILayoutFormat, images_archive.DockerArchiveFormat)
+	}
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		return err
+	}
+
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *commonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *commonCmdData.SkipTlsVerifyRegistry}); err != nil {
+		return err
+	}
+
+	if err := docker.Init(*commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
+		return err
+	}
+
+	projectDir, err := common.GetProjectDir(&commonCmdData)
+	if err != nil {
+		return fmt.Errorf("getting project dir failed: %s", err)
+	}
+
+	common.ProcessLogProjectDir(&commonCmdData, projectDir)
+
+	werfConfig, err := common.GetRequiredWerfConfig(projectDir, true)
+	if err != nil {
+		return fmt.Errorf("unable to load werf config: %s", err)
+	}
+
+	logboek.LogOptionalLn()
+
+	for _, imageToProcess := range imagesToProcess {
+		if !werfConfig.HasImage(imageToProcess) {
+			return fmt.Errorf("specified image %s is not defined in werf.yaml", logging.ImageLogName(imageToProcess, false))
+		}
+	}
+
+	projectName := werfConfig.Meta.Project
+
+	imagesRepo, err := common.GetImagesRepo(projectName, &commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	imagesRepoMode, err := common.GetImagesRepoMode(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	if err != nil {
+		return err
+	}
+
+	imageNames := imagesToProcess
+	if len(imageNames) == 0 {
+		for _, image := range werfConfig.StapelImages {
+			imageNames = append(imageNames, image.Name)
+		}
+
+		for _, image := range werfConfig.ImagesFromDockerfile {
+			imageNames = append(imageNames, image.Name)
+		}
+	}
+
+	tagOpts, err := common.GetTagOptions(&commonCmdData, common.TagOptionsGetterOptions{Optional: true, ProjectDir: projectDir})
+	if err != nil {
+		return err
+	}
+
+	tagSelection, err := getTagSelection(tagOpts)
+	if err != nil {
+		return err
+	}
+
+	exportOptions := images_archive.ExportOptions{
+		ImagesRepoManager: imagesRepoManager,
+		ImagesNames:       imageNames,
+		Path:              cmdData.ToOCIArchive,
+		Format:            cmdData.ArchiveFormat,
+		Tags:              tagSelection,
+	}
+
+	logboek.LogOptionalLn()
+	return images_archive.Export(exportOptions)
+}
+
+func getTagSelection(tagOpts build.TagOptions) (images_archive.TagSelection, error) {
+	selection := images_archive.TagSelection{
+		TagsByStrategy: map[tag_strategy.TagStrategy][]string{
+			tag_strategy.Custom:    tagOpts.CustomTags,
+			tag_strategy.GitBranch: tagOpts.TagsByGitBranch,
+			tag_strategy.GitTag:    tagOpts.TagsByGitTag,
+			tag_strategy.GitCommit: tagOpts.TagsByGitCommit,
+			tag_strategy.Template:  tagOpts.TagsByTemplate,
+		},
+		StagesSignature: tagOpts.TagByStagesSignature,
+	}
+
+	for _, gitTag := range tagOpts.TagBySemverGitTags {
+		version, err := tag_strategy.ParseSemverGitTag(gitTag)
+		if err != nil {
+			return images_archive.TagSelection{}, err
+		}
+
+		selection.TagsByStrategy[tag_strategy.Semver] = append(selection.TagsByStrategy[tag_strategy.Semver], tag_strategy.SemverFullTag(version))
+	}
+
+	return selection, nil
+}
@@ -0,0 +1,150 @@
+package import_images
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/images_archive"
+	"github.com/flant/werf/pkg/logging"
+	"github.com/flant/werf/pkg/werf"
+)
+
+var cmdData struct {
+	FromOCIArchive string
+}
+
+var commonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [IMAGE_NAME...]",
+		Short: "Import images from the archive into images repo",
+		Long: common.GetLongCommandDescription(`Push images from the OCI image layout directory or the docker-archive tarball, which is written by werf images export, into images repo.
+
+Images are pushed with the names IMAGES_REPO/IMAGE_NAME:TAG, where the tag is made by werf labels of the image for the specified images repo and images repo mode, the same way as by werf images publish. Images of the platforms are combined into the manifest lists again.
+
+If one or more IMAGE_NAME parameters specified, werf will import only these images from werf.yaml.`),
+		Example: `  # Import images from the OCI image layout directory into the registry of the air-gapped environment
+  $ werf images import --images-repo registry.airgapped.local/myproject --from-oci-archive ./myproject-images
+
+  # Import images of the backend image from the docker-archive tarball using monorepo images repo mode
+  $ werf images import backend --images-repo registry.airgapped.local/myproject --images-repo-mode monorepo --from-oci-archive ./backend.tar`,
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+			common.LogVersion()
+
+			return common.LogRunningTime(func() error {
+				return runImport(args)
+			})
+		},
+	}
+
+	common.SetupDir(&commonCmdData, cmd)
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+
+	common.SetupImagesRepo(&commonCmdData, cmd)
+	common.SetupImagesRepoMode(&commonCmdData, cmd)
+	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to push images into the specified images repo")
+	common.SetupInsecureRegistry(&commonCmdData, cmd)
+	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
+
+	common.SetupLogOptions(&commonCmdData, cmd)
+	common.SetupLogProjectDir(&commonCmdData, cmd)
+
+	cmd.Flags().StringVarP(&cmdData.FromOCIArchive, "from-oci-archive", "", os.Getenv("WERF_FROM_OCI_ARCHIVE"), "Path to the OCI image layout directory or the docker-archive tarball to read images from (default $WERF_FROM_OCI_ARCHIVE)")
+
+	return cmd
+}
+
+func runImport(imagesToProcess []string) error {
+	if cmdData.FromOCIArchive == "" {
+		return fmt.Errorf("--from-oci-archive PATH param required")
+	}
+
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		return err
+	}
+
+	if err := docker_registry.Init(docker_registry.Options{InsecureRegistry: *commonCmdData.InsecureRegistry, SkipTlsVerifyRegistry: *commonCmdData.SkipTlsVerifyRegistry}); err != nil {
+		return err
+	}
+
+	if err := docker.Init(*commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
+		return err
+	}
+
+	projectDir, err := common.GetProjectDir(&commonCmdData)
+	if err != nil {
+		return fmt.Errorf("getting project dir failed: %s", err)
+	}
+
+	common.ProcessLogProjectDir(&commonCmdData, projectDir)
+
+	werfConfig, err := common.GetRequiredWerfConfig(projectDir, true)
+	if err != nil {
+		return fmt.Errorf("unable to load werf config: %s", err)
+	}
+
+	logboek.LogOptionalLn()
+
+	for _, imageToProcess := range imagesToProcess {
+		if !werfConfig.HasImage(imageToProcess) {
+			return fmt.Errorf("specified image %s is not defined in werf.yaml", logging.ImageLogName(imageToProcess, false))
+		}
+	}
+
+	projectName := werfConfig.Meta.Project
+
+	imagesRepo, err := common.GetImagesRepo(projectName, &commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	imagesRepoMode, err := common.GetImagesRepoMode(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	imagesRepoManager, err := common.GetImagesRepoManager(imagesRepo, imagesRepoMode)
+	if err != nil {
+		return err
+	}
+
+	imageNames := imagesToProcess
+	if len(imageNames) == 0 {
+		for _, image := range werfConfig.StapelImages {
+			imageNames = append(imageNames, image.Name)
+		}
+
+		for _, image := range werfConfig.ImagesFromDockerfile {
+			imageNames = append(imageNames, image.Name)
+		}
+	}
+
+	importOptions := images_archive.ImportOptions{
+		ImagesRepoManager: imagesRepoManager,
+		ImagesNames:       imageNames,
+		Path:              cmdData.FromOCIArchive,
+	}
+
+	logboek.LogOptionalLn()
+	return images_archive.Import(importOptions)
+}
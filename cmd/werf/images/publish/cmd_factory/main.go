@@ -30,7 +30,10 @@ New docker layer with service info about tagging strategy will be built for each
 
 If one or more IMAGE_NAME parameters specified, werf will publish only these images from werf.yaml.`),
 		Example: `  # Publish images into myregistry.mydomain.com/myproject images repo using 'mybranch' tag and git-branch tagging strategy
-  $ werf images publish --stages-storage :local --images-repo myregistry.mydomain.com/myproject --tag-git-branch mybranch`,
+  $ werf images publish --stages-storage :local --images-repo myregistry.mydomain.com/myproject --tag-git-branch mybranch
+
+  # Publish amd64 and arm64 images of all images from werf.yaml and combine them into the manifest list by the 'mybranch' tag
+  $ werf images publish --stages-storage registry.mydomain.com/myproject/stages --images-repo myregistry.mydomain.com/myproject --tag-git-branch mybranch --platform linux/amd64 --platform linux/arm64`,
 		DisableFlagsInUseLine: true,
 		Annotations:           map[string]string{},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -54,12 +57,17 @@ If one or more IMAGE_NAME parameters specified, werf will publish only these ima
 	common.SetupTag(commonCmdData, cmd)
 
 	common.SetupStagesStorage(commonCmdData, cmd)
+	common.SetupStagesStorageCache(commonCmdData, cmd)
 	common.SetupSynchronization(commonCmdData, cmd)
+	common.SetupKubeConfig(commonCmdData, cmd)
+	common.SetupKubeContext(commonCmdData, cmd)
 	common.SetupImagesRepo(commonCmdData, cmd)
 	common.SetupImagesRepoMode(commonCmdData, cmd)
 	common.SetupDockerConfig(commonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage and push images into images repo")
 	common.SetupInsecureRegistry(commonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(commonCmdData, cmd)
+	common.SetupParallelTasksLimit(commonCmdData, cmd)
+	common.SetupPlatform(commonCmdData, cmd)
 
 	common.SetupLogOptions(commonCmdData, cmd)
 	common.SetupLogProjectDir(commonCmdData, cmd)
@@ -116,12 +124,27 @@ func runImagesPublish(commonCmdData *common.CmdData, imagesToProcess []string) e
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	_, err = common.GetStagesStorage(commonCmdData)
+	stagesStorage, err := common.GetStagesStorage(commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	storageLockManager, err := common.GetStorageLockManager(commonCmdData)
 	if err != nil {
 		return err
 	}
 
-	_, err = common.GetSynchronization(commonCmdData)
+	stagesStorageCache, err := common.GetStagesStorageCache(commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	parallelTasksLimit, err := common.GetParallelTasksLimit(commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	platforms, err := common.GetPlatforms(commonCmdData, werfConfig)
 	if err != nil {
 		return err
 	}
@@ -141,7 +164,7 @@ func runImagesPublish(commonCmdData *common.CmdData, imagesToProcess []string) e
 		return err
 	}
 
-	tagOpts, err := common.GetTagOptions(commonCmdData, common.TagOptionsGetterOptions{})
+	tagOpts, err := common.GetTagOptions(commonCmdData, common.TagOptionsGetterOptions{ProjectDir: projectDir})
 	if err != nil {
 		return err
 	}
@@ -161,11 +184,26 @@ func runImagesPublish(commonCmdData *common.CmdData, imagesToProcess []string) e
 		TagOptions:      tagOpts,
 	}
 
-	c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
-	defer c.Terminate()
+	stagesSignatures := build.NewImagesStagesSignatures()
+	for _, platform := range platforms {
+		if err := common.WithPlatform(platform, func() error {
+			c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock, stagesStorage, storageLockManager, build.ConveyorOptions{StagesStorageCache: stagesStorageCache, ParallelTasksLimit: parallelTasksLimit, Platform: platform})
+			defer c.Terminate()
 
-	if err = c.PublishImages(imagesRepoManager, opts); err != nil {
-		return err
+			if err := c.PublishImages(imagesRepoManager, opts); err != nil {
+				return err
+			}
+
+			stagesSignatures.Add(c)
+
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if tagOpts.TagByStagesSignature {
+		return stagesSignatures.PublishManifestLists(imagesRepoManager, storageLockManager, imagesToProcess)
 	}
 
 	return nil
@@ -33,10 +33,13 @@ import (
 	managed_images_rm "github.com/flant/werf/cmd/werf/managed_images/rm"
 
 	images_cleanup "github.com/flant/werf/cmd/werf/images/cleanup"
+	images_export "github.com/flant/werf/cmd/werf/images/export"
+	images_import "github.com/flant/werf/cmd/werf/images/import"
 	images_publish "github.com/flant/werf/cmd/werf/images/publish"
 	images_purge "github.com/flant/werf/cmd/werf/images/purge"
 
 	stages_build "github.com/flant/werf/cmd/werf/stages/build"
+	stages_cache_server "github.com/flant/werf/cmd/werf/stages/cache_server"
 	stages_cleanup "github.com/flant/werf/cmd/werf/stages/cleanup"
 	stages_purge "github.com/flant/werf/cmd/werf/stages/purge"
 
@@ -50,6 +53,7 @@ import (
 	helm_delete "github.com/flant/werf/cmd/werf/helm/delete"
 	helm_dependency "github.com/flant/werf/cmd/werf/helm/dependency"
 	helm_deploy_chart "github.com/flant/werf/cmd/werf/helm/deploy_chart"
+	helm_diff "github.com/flant/werf/cmd/werf/helm/diff"
 	helm_get "github.com/flant/werf/cmd/werf/helm/get"
 	helm_get_autogenerated_values "github.com/flant/werf/cmd/werf/helm/get_autogenerated_values"
 	helm_get_namespace "github.com/flant/werf/cmd/werf/helm/get_namespace"
@@ -57,9 +61,11 @@ import (
 	helm_history "github.com/flant/werf/cmd/werf/helm/history"
 	helm_lint "github.com/flant/werf/cmd/werf/helm/lint"
 	helm_list "github.com/flant/werf/cmd/werf/helm/list"
+	helm_migrate_release "github.com/flant/werf/cmd/werf/helm/migrate_release"
 	helm_render "github.com/flant/werf/cmd/werf/helm/render"
 	helm_repo "github.com/flant/werf/cmd/werf/helm/repo"
 	helm_rollback "github.com/flant/werf/cmd/werf/helm/rollback"
+	helm_unlock_release "github.com/flant/werf/cmd/werf/helm/unlock_release"
 
 	config_list "github.com/flant/werf/cmd/werf/config/list"
 	config_render "github.com/flant/werf/cmd/werf/config/render"
@@ -180,6 +186,8 @@ func imagesCmd() *cobra.Command {
 		images_publish.NewCmd(),
 		images_cleanup.NewCmd(),
 		images_purge.NewCmd(),
+		images_export.NewCmd(),
+		images_import.NewCmd(),
 	)
 
 	return cmd
@@ -193,6 +201,7 @@ func stagesCmd() *cobra.Command {
 	cmd.AddCommand(
 		stages_build.NewCmd(),
 		stages_cleanup.NewCmd(),
+		stages_cache_server.NewCmd(),
 		stages_purge.NewCmd(),
 	)
 
@@ -223,11 +232,14 @@ func helmCmd() *cobra.Command {
 		helm_deploy_chart.NewCmd(),
 		helm_lint.NewCmd(),
 		helm_render.NewCmd(),
+		helm_diff.NewCmd(),
 		helm_list.NewCmd(),
 		helm_delete.NewCmd(),
 		helm_rollback.NewCmd(),
 		helm_get.NewCmd(),
 		helm_history.NewCmd(),
+		helm_migrate_release.NewCmd(),
+		helm_unlock_release.NewCmd(),
 		secretCmd(),
 		helm_repo.NewRepoCmd(),
 		helm_dependency.NewDependencyCmd(),
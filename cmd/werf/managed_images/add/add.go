@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"path/filepath"
 
-	"github.com/flant/werf/pkg/storage"
-
 	"github.com/flant/shluz"
 	"github.com/flant/werf/cmd/werf/common"
 	"github.com/flant/werf/pkg/docker"
@@ -97,15 +95,14 @@ func run(imageName string) error {
 		return fmt.Errorf("run command in the project directory with werf.yaml or specify --project-name=PROJECT_NAME param")
 	}
 
-	if _, err := common.GetStagesStorage(&commonCmdData); err != nil {
+	stagesStorage, err := common.GetStagesStorage(&commonCmdData)
+	if err != nil {
 		return err
 	}
 	if _, err = common.GetSynchronization(&commonCmdData); err != nil {
 		return err
 	}
 
-	stagesStorage := &storage.LocalStagesStorage{}
-
 	if err := stagesStorage.AddManagedImage(projectName, common.GetManagedImageName(imageName)); err != nil {
 		return fmt.Errorf("unable to add managed image %q for project %q: %s", imageName, projectName, err)
 	}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"path/filepath"
 
-	"github.com/flant/werf/pkg/storage"
-
 	"github.com/flant/shluz"
 	"github.com/flant/werf/cmd/werf/common"
 	"github.com/flant/werf/pkg/docker"
@@ -94,14 +92,14 @@ func run() error {
 		return fmt.Errorf("run command in the project directory with werf.yaml or specify --project-name=PROJECT_NAME param")
 	}
 
-	if _, err := common.GetStagesStorage(&commonCmdData); err != nil {
+	stagesStorage, err := common.GetStagesStorage(&commonCmdData)
+	if err != nil {
 		return err
 	}
 	if _, err = common.GetSynchronization(&commonCmdData); err != nil {
 		return err
 	}
 
-	stagesStorage := &storage.LocalStagesStorage{}
 	if images, err := stagesStorage.GetManagedImages(projectName); err != nil {
 		return fmt.Errorf("unable to list known config image names for project %q: %s", projectName, err)
 	} else {
@@ -5,8 +5,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/flant/werf/pkg/storage"
-
 	"github.com/flant/shluz"
 	"github.com/flant/werf/cmd/werf/common"
 	"github.com/flant/werf/pkg/docker"
@@ -98,13 +96,13 @@ func run(imageNames []string) error {
 		return fmt.Errorf("run command in the project directory with werf.yaml or specify --project-name=PROJECT_NAME param")
 	}
 
-	if _, err := common.GetStagesStorage(&commonCmdData); err != nil {
+	stagesStorage, err := common.GetStagesStorage(&commonCmdData)
+	if err != nil {
 		return err
 	}
 	if _, err = common.GetSynchronization(&commonCmdData); err != nil {
 		return err
 	}
-	stagesStorage := &storage.LocalStagesStorage{}
 
 	errs := []error{}
 	for _, imageName := range imageNames {
@@ -82,7 +82,7 @@ func runPurge() error {
 
 	common.ProcessLogProjectDir(&commonCmdData, projectDir)
 
-	_, err = common.GetStagesStorage(&commonCmdData)
+	_, err = common.GetLocalStagesStorage(&commonCmdData)
 	if err != nil {
 		return err
 	}
@@ -99,7 +99,10 @@ func NewCmd() *cobra.Command {
 	common.SetupSSHKey(&commonCmdData, cmd)
 
 	common.SetupStagesStorage(&commonCmdData, cmd)
+	common.SetupStagesStorageCache(&commonCmdData, cmd)
 	common.SetupSynchronization(&commonCmdData, cmd)
+	common.SetupKubeConfig(&commonCmdData, cmd)
+	common.SetupKubeContext(&commonCmdData, cmd)
 	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage")
 	common.SetupInsecureRegistry(&commonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
@@ -186,12 +189,17 @@ func runRun() error {
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	_, err = common.GetStagesStorage(&commonCmdData)
+	stagesStorage, err := common.GetStagesStorage(&commonCmdData)
 	if err != nil {
 		return err
 	}
 
-	_, err = common.GetSynchronization(&commonCmdData)
+	storageLockManager, err := common.GetStorageLockManager(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	stagesStorageCache, err := common.GetStagesStorageCache(&commonCmdData)
 	if err != nil {
 		return err
 	}
@@ -216,7 +224,7 @@ func runRun() error {
 	}
 
 	logboek.Info.LogOptionalLn()
-	c := build.NewConveyor(werfConfig, []string{imageName}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
+	c := build.NewConveyor(werfConfig, []string{imageName}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock, stagesStorage, storageLockManager, build.ConveyorOptions{StagesStorageCache: stagesStorageCache})
 	defer c.Terminate()
 
 	if err = c.ShouldBeBuilt(); err != nil {
@@ -56,7 +56,10 @@ func NewCmd() *cobra.Command {
 	common.SetupSSHKey(&commonCmdData, cmd)
 
 	common.SetupStagesStorage(&commonCmdData, cmd)
+	common.SetupStagesStorageCache(&commonCmdData, cmd)
 	common.SetupSynchronization(&commonCmdData, cmd)
+	common.SetupKubeConfig(&commonCmdData, cmd)
+	common.SetupKubeContext(&commonCmdData, cmd)
 	common.SetupDockerConfig(&commonCmdData, cmd, "Command needs granted permissions to read and pull images from the specified stages storage")
 	common.SetupInsecureRegistry(&commonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(&commonCmdData, cmd)
@@ -110,12 +113,17 @@ func run(imageName string) error {
 	}
 	defer tmp_manager.ReleaseProjectDir(projectTmpDir)
 
-	_, err = common.GetStagesStorage(&commonCmdData)
+	stagesStorage, err := common.GetStagesStorage(&commonCmdData)
 	if err != nil {
 		return err
 	}
 
-	_, err = common.GetSynchronization(&commonCmdData)
+	storageLockManager, err := common.GetStorageLockManager(&commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	stagesStorageCache, err := common.GetStagesStorageCache(&commonCmdData)
 	if err != nil {
 		return err
 	}
@@ -138,7 +146,7 @@ func run(imageName string) error {
 		return fmt.Errorf("image '%s' is not defined in werf.yaml", logging.ImageLogName(imageName, false))
 	}
 
-	c := build.NewConveyor(werfConfig, []string{imageName}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
+	c := build.NewConveyor(werfConfig, []string{imageName}, projectDir, projectTmpDir, ssh_agent.SSHAuthSock, stagesStorage, storageLockManager, build.ConveyorOptions{StagesStorageCache: stagesStorageCache})
 	defer c.Terminate()
 
 	if err = c.ShouldBeBuilt(); err != nil {
@@ -11,7 +11,6 @@ import (
 
 	"github.com/flant/werf/cmd/werf/common"
 	"github.com/flant/werf/pkg/build"
-	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/logging"
@@ -39,6 +38,15 @@ func NewCmdWithData(cmdData *CmdData, commonCmdData *common.CmdData) *cobra.Comm
   # Build stages of image 'backend' from werf.yaml
   $ werf stages build --stages-storage :local backend
 
+  # Build stages of all images from werf.yaml and store them in the docker repo, so that other hosts can reuse them
+  $ werf stages build --stages-storage registry.mydomain.com/myproject/stages
+
+  # Build stages of independent images from werf.yaml in parallel, processing up to 4 images at once
+  $ werf stages build --stages-storage :local --parallel-tasks-limit 4
+
+  # Build stages of all images from werf.yaml for amd64 and arm64 platforms
+  $ werf stages build --stages-storage registry.mydomain.com/myproject/stages --platform linux/amd64 --platform linux/arm64
+
   # Build and enable drop-in shell session in the failed assembly container in the case when an error occurred
   $ werf build --stages-storage :local --introspect-error
 
@@ -74,10 +82,17 @@ If one or more IMAGE_NAME parameters specified, werf will build only these image
 	common.SetupSSHKey(commonCmdData, cmd)
 
 	common.SetupStagesStorage(commonCmdData, cmd)
+	common.SetupStagesStorageCache(commonCmdData, cmd)
 	common.SetupSynchronization(commonCmdData, cmd)
+	common.SetupKubeConfig(commonCmdData, cmd)
+	common.SetupKubeContext(commonCmdData, cmd)
 	common.SetupDockerConfig(commonCmdData, cmd, "Command needs granted permissions to read, pull and push images into the specified stages storage, to pull base images")
+	common.SetupContainerRuntime(commonCmdData, cmd)
 	common.SetupInsecureRegistry(commonCmdData, cmd)
 	common.SetupSkipTlsVerifyRegistry(commonCmdData, cmd)
+	common.SetupParallelTasksLimit(commonCmdData, cmd)
+	common.SetupPlatform(commonCmdData, cmd)
+	common.SetupReportPath(commonCmdData, cmd)
 
 	common.SetupIntrospectStage(commonCmdData, cmd)
 
@@ -107,7 +122,7 @@ func runStagesBuild(cmdData *CmdData, commonCmdData *common.CmdData, imagesToPro
 		return err
 	}
 
-	if err := docker.Init(*commonCmdData.DockerConfig, *commonCmdData.LogVerbose, *commonCmdData.LogDebug); err != nil {
+	if err := common.InitContainerRuntime(commonCmdData); err != nil {
 		return err
 	}
 
@@ -140,7 +155,22 @@ func runStagesBuild(cmdData *CmdData, commonCmdData *common.CmdData, imagesToPro
 		return err
 	}
 
-	_, err = common.GetSynchronization(commonCmdData)
+	storageLockManager, err := common.GetStorageLockManager(commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	stagesStorageCache, err := common.GetStagesStorageCache(commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	parallelTasksLimit, err := common.GetParallelTasksLimit(commonCmdData)
+	if err != nil {
+		return err
+	}
+
+	platforms, err := common.GetPlatforms(commonCmdData, werfConfig)
 	if err != nil {
 		return err
 	}
@@ -168,13 +198,31 @@ func runStagesBuild(cmdData *CmdData, commonCmdData *common.CmdData, imagesToPro
 		IntrospectOptions: introspectOptions,
 	}
 
-	logboek.LogOptionalLn()
-	c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock)
-	defer c.Terminate()
+	buildReport := &build.BuildReport{}
 
-	if err = c.BuildStages(stagesStorage, opts); err != nil {
-		return err
+	var buildErr error
+	for _, platform := range platforms {
+		logboek.LogOptionalLn()
+		if err := common.WithPlatform(platform, func() error {
+			c := build.NewConveyor(werfConfig, imagesToProcess, projectDir, projectTmpDir, ssh_agent.SSHAuthSock, stagesStorage, storageLockManager, build.ConveyorOptions{StagesStorageCache: stagesStorageCache, ParallelTasksLimit: parallelTasksLimit, Platform: platform, Report: buildReport})
+			defer c.Terminate()
+
+			return c.BuildStages(opts)
+		}); err != nil {
+			buildErr = err
+			break
+		}
+	}
+
+	if *commonCmdData.ReportPath != "" {
+		if err := buildReport.WriteFile(*commonCmdData.ReportPath); err != nil {
+			if buildErr != nil {
+				logboek.LogWarnF("WARNING: %s\n", err)
+			} else {
+				return err
+			}
+		}
 	}
 
-	return nil
+	return buildErr
 }
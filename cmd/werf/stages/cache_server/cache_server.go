@@ -0,0 +1,93 @@
+package cache_server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/cmd/werf/common"
+	"github.com/flant/werf/pkg/storage"
+	"github.com/flant/werf/pkg/werf"
+)
+
+var cmdData struct {
+	ListenAddress string
+	CacheDir      string
+}
+
+var commonCmdData common.CmdData
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "cache-server",
+		DisableFlagsInUseLine: true,
+		Short:                 "Run stages storage cache server",
+		Long: common.GetLongCommandDescription(`Run stages storage cache server.
+
+The server keeps images of the stages storage by signature for all projects and allows multiple hosts to share the cache: every werf process started with --stages-storage-cache=http://HOST:PORT sees cache records stored by the others right away`),
+		Example: `  # Run stages storage cache server on the port 8088
+  $ werf stages cache-server --listen-address :8088
+
+  # Use stages storage cache server
+  $ werf stages build --stages-storage registry.mydomain.com/myproject/stages --stages-storage-cache http://werf-cache.mydomain.com:8088`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := common.ProcessLogOptions(&commonCmdData); err != nil {
+				common.PrintHelp(cmd)
+				return err
+			}
+
+			common.LogVersion()
+
+			return runCacheServer()
+		},
+	}
+
+	common.SetupTmpDir(&commonCmdData, cmd)
+	common.SetupHomeDir(&commonCmdData, cmd)
+
+	common.SetupLogOptions(&commonCmdData, cmd)
+
+	defaultListenAddress := os.Getenv("WERF_STAGES_CACHE_SERVER_LISTEN_ADDRESS")
+	if defaultListenAddress == "" {
+		defaultListenAddress = ":8088"
+	}
+
+	cmd.Flags().StringVarP(&cmdData.ListenAddress, "listen-address", "", defaultListenAddress, "Address to listen on (default :8088 or $WERF_STAGES_CACHE_SERVER_LISTEN_ADDRESS if set)")
+	cmd.Flags().StringVarP(&cmdData.CacheDir, "cache-dir", "", os.Getenv("WERF_STAGES_CACHE_SERVER_CACHE_DIR"), "Directory to store cache records (default stages_storage_cache_server in the werf local cache dir or $WERF_STAGES_CACHE_SERVER_CACHE_DIR if set)")
+
+	return cmd
+}
+
+func runCacheServer() error {
+	if err := werf.Init(*commonCmdData.TmpDir, *commonCmdData.HomeDir); err != nil {
+		return fmt.Errorf("initialization error: %s", err)
+	}
+
+	if err := shluz.Init(filepath.Join(werf.GetServiceDir(), "locks")); err != nil {
+		return err
+	}
+
+	cacheDir := cmdData.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(werf.GetLocalCacheDir(), "stages_storage_cache_server")
+	}
+
+	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create dir %s: %s", cacheDir, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(storage.HttpStagesStorageCacheApiPrefix+"/", storage.NewStagesStorageCacheHandler(storage.NewFileStagesStorageCache(cacheDir)))
+
+	logboek.LogLn()
+	logboek.Default.LogFDetails("Using cache dir: %s\n", cacheDir)
+	logboek.Default.LogFHighlight("Listening on %s\n", cmdData.ListenAddress)
+
+	return http.ListenAndServe(cmdData.ListenAddress, mux)
+}
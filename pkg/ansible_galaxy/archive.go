@@ -0,0 +1,120 @@
+package ansible_galaxy
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// unpackArchive unpacks the tar or tar.gz archive into the dir,
+// the only top-level directory of the archive is stripped (github archives and role tarballs)
+func unpackArchive(r io.Reader, dir string) error {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		r = br
+	}
+
+	rawDir := dir + ".raw"
+	if err := os.MkdirAll(rawDir, os.ModePerm); err != nil {
+		return err
+	}
+	defer os.RemoveAll(rawDir)
+
+	if err := untar(r, rawDir); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(rawDir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 1 && entries[0].IsDir() {
+		return os.Rename(filepath.Join(rawDir, entries[0].Name()), dir)
+	}
+
+	return os.Rename(rawDir, dir)
+}
+
+func untar(r io.Reader, dir string) error {
+	symlinks := map[string]bool{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." {
+			continue
+		}
+
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("bad archive entry %s", hdr.Name)
+		}
+
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if symlinks[parent] {
+				return fmt.Errorf("bad archive entry %s: parent %s is a symlink", hdr.Name, parent)
+			}
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm()|0600)
+			if err != nil {
+				return err
+			}
+
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+
+			symlinks[name] = true
+		default:
+			// pax headers, hardlinks and devices are not used by roles and collections
+			continue
+		}
+	}
+}
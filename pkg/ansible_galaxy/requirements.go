@@ -0,0 +1,65 @@
+package ansible_galaxy
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Requirements is the content of the ansible-galaxy requirements.yml
+type Requirements struct {
+	Roles       []*Requirement `yaml:"roles"`
+	Collections []*Requirement `yaml:"collections"`
+}
+
+// Requirement is the role or the collection entry of requirements.yml
+type Requirement struct {
+	Name    string `yaml:"name"`
+	Src     string `yaml:"src"`
+	Scm     string `yaml:"scm"`
+	Type    string `yaml:"type"`
+	Source  string `yaml:"source"`
+	Version string `yaml:"version"`
+}
+
+// UnmarshalYAML supports the short form of the entry, which is the role src or the collection name
+func (r *Requirement) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		r.Name = name
+		return nil
+	}
+
+	type plain Requirement
+	return unmarshal((*plain)(r))
+}
+
+// ReadRequirements reads requirements.yml, the old format with the list of roles is also supported
+func ReadRequirements(path string) (*Requirements, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	requirements, err := ParseRequirements(data)
+	if err != nil {
+		return nil, fmt.Errorf("bad requirements %s: %s", path, err)
+	}
+
+	return requirements, nil
+}
+
+func ParseRequirements(data []byte) (*Requirements, error) {
+	var roles []*Requirement
+	if err := yaml.Unmarshal(data, &roles); err == nil {
+		return &Requirements{Roles: roles}, nil
+	}
+
+	requirements := &Requirements{}
+	if err := yaml.UnmarshalStrict(data, requirements); err != nil {
+		return nil, err
+	}
+
+	return requirements, nil
+}
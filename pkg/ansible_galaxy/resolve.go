@@ -0,0 +1,601 @@
+package ansible_galaxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+const DefaultServer = "https://galaxy.ansible.com"
+
+// galaxy roles are downloaded from github repositories, which are specified by the galaxy server
+var githubArchiveUrlFormat = "https://github.com/%s/%s/archive/%s.tar.gz"
+
+// Content is the resolved role or collection
+type Content struct {
+	// Name is the role name or the collection name NAMESPACE.NAME
+	Name       string
+	Collection bool
+	// Dir is the directory with the files of the role or the collection
+	Dir      string
+	Checksum string
+}
+
+type ResolveOptions struct {
+	// CacheDir stores the downloaded content, which is downloaded once for each source and version
+	CacheDir string
+	// Server is the galaxy server url, DefaultServer is used by default
+	Server string
+	// LocalRoles are the names of the project roles, which satisfy the dependencies of the resolved roles
+	LocalRoles []string
+}
+
+// Resolve downloads the roles and the collections of the requirements: galaxy and git sources should be pinned by the version,
+// so that the cached content matches the requirements.
+// The dependencies of the roles (meta/main.yml) and the collections are resolved transitively after the requirements,
+// the dependency without the exact version should be specified in the requirements
+func Resolve(requirements *Requirements, options ResolveOptions) ([]*Content, error) {
+	if options.Server == "" {
+		options.Server = DefaultServer
+	}
+
+	var contents []*Content
+	names := map[string]bool{}
+
+	for _, r := range requirements.Roles {
+		content, err := resolveRole(r, options)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[contentKey(content)] {
+			return nil, fmt.Errorf("role %s is specified several times", content.Name)
+		}
+		names[contentKey(content)] = true
+
+		contents = append(contents, content)
+	}
+
+	for _, r := range requirements.Collections {
+		content, err := resolveCollection(r, options)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[contentKey(content)] {
+			return nil, fmt.Errorf("collection %s is specified several times", content.Name)
+		}
+		names[contentKey(content)] = true
+
+		contents = append(contents, content)
+	}
+
+	localRoles := map[string]bool{}
+	for _, name := range options.LocalRoles {
+		localRoles[name] = true
+	}
+
+	// contents grows with the resolved dependencies, which dependencies are resolved in turn
+	for i := 0; i < len(contents); i++ {
+		dependencies, err := resolveDependencies(contents[i], names, localRoles, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range dependencies {
+			if names[contentKey(content)] {
+				continue
+			}
+			names[contentKey(content)] = true
+
+			contents = append(contents, content)
+		}
+	}
+
+	for _, content := range contents {
+		checksum, err := util.DirChecksum(content.Dir)
+		if err != nil {
+			return nil, err
+		}
+		content.Checksum = checksum
+	}
+
+	return contents, nil
+}
+
+func resolveRole(r *Requirement, options ResolveOptions) (*Content, error) {
+	src, scm, name := r.Src, r.Scm, r.Name
+	if src == "" {
+		src, name = r.Name, ""
+	}
+
+	if strings.HasPrefix(src, "git+") {
+		src, scm = strings.TrimPrefix(src, "git+"), "git"
+	}
+
+	var key []string
+	var fetch func(dir string) error
+
+	switch {
+	case src == "":
+		return nil, fmt.Errorf("role src or name required")
+	case scm == "git":
+		if r.Version == "" {
+			return nil, fmt.Errorf("role %s: version required", src)
+		}
+
+		if name == "" {
+			name = archiveName(src)
+		}
+
+		key = []string{"role", scm, src, r.Version}
+		fetch = func(dir string) error { return gitClone(src, r.Version, dir) }
+	case scm != "":
+		return nil, fmt.Errorf("role %s: unsupported scm %q: only git supported", src, scm)
+	case isUrl(src):
+		if name == "" {
+			name = archiveName(src)
+		}
+
+		key = []string{"role", src}
+		fetch = func(dir string) error { return download(src, dir) }
+	default:
+		if len(strings.Split(src, ".")) != 2 {
+			return nil, fmt.Errorf("role %s: galaxy role NAMESPACE.NAME, git repository or archive url expected", src)
+		}
+
+		if r.Version == "" {
+			return nil, fmt.Errorf("role %s: version required", src)
+		}
+
+		if name == "" {
+			name = src
+		}
+
+		key = []string{"role", options.Server, src, r.Version}
+		fetch = func(dir string) error {
+			archiveUrl, err := galaxyRoleArchiveUrl(options.Server, src, r.Version)
+			if err != nil {
+				return err
+			}
+
+			return download(archiveUrl, dir)
+		}
+	}
+
+	dir, err := fetchCached(options.CacheDir, key, fmt.Sprintf("role %s", name), fetch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve role %s: %s", name, err)
+	}
+
+	return &Content{Name: name, Dir: dir}, nil
+}
+
+func resolveCollection(r *Requirement, options ResolveOptions) (*Content, error) {
+	name, collectionType := r.Name, r.Type
+	if name == "" {
+		return nil, fmt.Errorf("collection name required")
+	}
+
+	if collectionType == "" {
+		if strings.HasPrefix(name, "git+") {
+			collectionType = "git"
+		} else if isUrl(name) {
+			collectionType = "url"
+		} else {
+			collectionType = "galaxy"
+		}
+	}
+
+	var key []string
+	var fetch func(dir string) error
+
+	switch collectionType {
+	case "galaxy":
+		parts := strings.Split(name, ".")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("collection %s: NAMESPACE.NAME expected", name)
+		}
+
+		if r.Version == "" || strings.ContainsAny(r.Version, "<>=!*,") {
+			return nil, fmt.Errorf("collection %s: exact version required", name)
+		}
+
+		server := r.Source
+		if server == "" {
+			server = options.Server
+		}
+
+		key = []string{"collection", server, name, r.Version}
+		fetch = func(dir string) error {
+			downloadUrl, err := galaxyCollectionDownloadUrl(server, parts[0], parts[1], r.Version)
+			if err != nil {
+				return err
+			}
+
+			return download(downloadUrl, dir)
+		}
+	case "git":
+		src := strings.TrimPrefix(name, "git+")
+		if r.Version == "" {
+			return nil, fmt.Errorf("collection %s: version required", src)
+		}
+
+		key = []string{"collection", collectionType, src, r.Version}
+		fetch = func(dir string) error { return gitClone(src, r.Version, dir) }
+	case "url":
+		key = []string{"collection", name}
+		fetch = func(dir string) error { return download(name, dir) }
+	default:
+		return nil, fmt.Errorf("collection %s: unsupported type %q: galaxy, git or url expected", name, collectionType)
+	}
+
+	dir, err := fetchCached(options.CacheDir, key, fmt.Sprintf("collection %s", name), fetch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve collection %s: %s", name, err)
+	}
+
+	collectionName, _, err := readCollectionInfo(dir)
+	if err != nil {
+		return nil, fmt.Errorf("bad collection %s: %s", name, err)
+	}
+
+	return &Content{Name: collectionName, Collection: true, Dir: dir}, nil
+}
+
+func contentKey(content *Content) string {
+	if content.Collection {
+		return "collection " + content.Name
+	}
+
+	return "role " + content.Name
+}
+
+// resolveDependencies resolves the dependencies of the content, which are not resolved yet (names) and are not the project roles
+func resolveDependencies(content *Content, names, localRoles map[string]bool, options ResolveOptions) ([]*Content, error) {
+	var dependencies []*Content
+
+	if content.Collection {
+		_, collectionDependencies, err := readCollectionInfo(content.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("bad collection %s: %s", content.Name, err)
+		}
+
+		var dependencyNames []string
+		for name := range collectionDependencies {
+			dependencyNames = append(dependencyNames, name)
+		}
+		sort.Strings(dependencyNames)
+
+		for _, name := range dependencyNames {
+			if names["collection "+name] {
+				continue
+			}
+
+			version := strings.TrimPrefix(strings.TrimSpace(collectionDependencies[name]), "==")
+			if version == "" || strings.ContainsAny(version, "<>=!*,") {
+				return nil, fmt.Errorf("collection %s depends on collection %s %q: add the collection with the exact version to the requirements", content.Name, name, collectionDependencies[name])
+			}
+
+			dependency, err := resolveCollection(&Requirement{Name: name, Version: version}, options)
+			if err != nil {
+				return nil, fmt.Errorf("unable to resolve collection %s dependency: %s", content.Name, err)
+			}
+
+			dependencies = append(dependencies, dependency)
+		}
+
+		return dependencies, nil
+	}
+
+	roleDependencies, err := readRoleDependencies(content.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("bad role %s: %s", content.Name, err)
+	}
+
+	for _, r := range roleDependencies {
+		name := r.Name
+		if name == "" {
+			name = r.Src
+		}
+
+		// the role of the collection is available with the collection
+		if parts := strings.Split(name, "."); len(parts) == 3 {
+			if !names["collection "+parts[0]+"."+parts[1]] {
+				return nil, fmt.Errorf("role %s depends on role %s: add the collection %s.%s to the requirements", content.Name, name, parts[0], parts[1])
+			}
+			continue
+		}
+
+		if names["role "+name] || localRoles[name] {
+			continue
+		}
+
+		if r.Version == "" && !isUrl(strings.TrimPrefix(r.Src, "git+")) {
+			return nil, fmt.Errorf("role %s depends on role %s: add the role with the version to the requirements", content.Name, name)
+		}
+
+		dependency, err := resolveRole(r, options)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve role %s dependency: %s", content.Name, err)
+		}
+
+		dependencies = append(dependencies, dependency)
+	}
+
+	return dependencies, nil
+}
+
+// readRoleDependencies reads the dependencies of meta/main.yml: the role name or src, the role entry or the requirement entry
+func readRoleDependencies(dir string) ([]*Requirement, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "meta", "main.yml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var meta struct {
+		Dependencies []interface{} `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("bad meta/main.yml: %s", err)
+	}
+
+	var requirements []*Requirement
+	for _, dependency := range meta.Dependencies {
+		switch value := dependency.(type) {
+		case string:
+			requirements = append(requirements, &Requirement{Src: value})
+		case map[interface{}]interface{}:
+			field := func(name string) string {
+				if v, ok := value[name]; ok && v != nil {
+					return fmt.Sprintf("%v", v)
+				}
+				return ""
+			}
+
+			r := &Requirement{Name: field("name"), Src: field("src"), Scm: field("scm"), Version: field("version")}
+			if role := field("role"); role != "" {
+				if r.Src == "" {
+					r.Src = role
+				} else if r.Name == "" {
+					r.Name = role
+				}
+			}
+
+			if r.Src == "" && r.Name == "" {
+				return nil, fmt.Errorf("bad meta/main.yml: role or src of the dependency %v required", value)
+			}
+
+			requirements = append(requirements, r)
+		default:
+			return nil, fmt.Errorf("bad meta/main.yml: unexpected dependency %v", dependency)
+		}
+	}
+
+	return requirements, nil
+}
+
+// fetchCached fetches the content into the cache dir by the key only once,
+// the content is fetched into the temporary dir and renamed, so that concurrent builds do not see partial content
+func fetchCached(cacheDir string, key []string, description string, fetch func(dir string) error) (string, error) {
+	dir := filepath.Join(cacheDir, util.Sha256Hash(key...))
+	if exists, err := util.DirExists(dir); err != nil {
+		return "", err
+	} else if exists {
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	tmpDir, err := ioutil.TempDir(cacheDir, "tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	logboek.Info.LogF("Downloading ansible %s\n", description)
+
+	contentDir := filepath.Join(tmpDir, "content")
+	if err := fetch(contentDir); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(contentDir, dir); err != nil {
+		if exists, _ := util.DirExists(dir); exists {
+			return dir, nil
+		}
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func galaxyRoleArchiveUrl(server, role, version string) (string, error) {
+	parts := strings.Split(role, ".")
+	roleUrl := fmt.Sprintf("%s/api/v1/roles/?owner__username=%s&name=%s", strings.TrimSuffix(server, "/"), url.QueryEscape(parts[0]), url.QueryEscape(parts[1]))
+
+	var response struct {
+		Results []struct {
+			GithubUser string `json:"github_user"`
+			GithubRepo string `json:"github_repo"`
+		} `json:"results"`
+	}
+	if err := getJson(roleUrl, &response); err != nil {
+		return "", err
+	}
+
+	if len(response.Results) == 0 {
+		return "", fmt.Errorf("role %s not found on the galaxy server %s", role, server)
+	}
+
+	return fmt.Sprintf(githubArchiveUrlFormat, response.Results[0].GithubUser, response.Results[0].GithubRepo, version), nil
+}
+
+func galaxyCollectionDownloadUrl(server, namespace, name, version string) (string, error) {
+	versionUrl := fmt.Sprintf("%s/api/v2/collections/%s/%s/versions/%s/", strings.TrimSuffix(server, "/"), url.PathEscape(namespace), url.PathEscape(name), url.PathEscape(version))
+
+	var response struct {
+		DownloadUrl string `json:"download_url"`
+	}
+	if err := getJson(versionUrl, &response); err != nil {
+		return "", err
+	}
+
+	if response.DownloadUrl == "" {
+		return "", fmt.Errorf("no download url for collection %s.%s %s on the galaxy server %s", namespace, name, version, server)
+	}
+
+	base, err := url.Parse(versionUrl)
+	if err != nil {
+		return "", err
+	}
+
+	downloadUrl, err := base.Parse(response.DownloadUrl)
+	if err != nil {
+		return "", fmt.Errorf("bad download url %s: %s", response.DownloadUrl, err)
+	}
+
+	return downloadUrl.String(), nil
+}
+
+func getJson(u string, value interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %s", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed: %s", u, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+		return fmt.Errorf("bad response from %s: %s", u, err)
+	}
+
+	return nil
+}
+
+func download(u, dir string) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return fmt.Errorf("cannot download %s: %s", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot download %s: %s", u, resp.Status)
+	}
+
+	if err := unpackArchive(resp.Body, dir); err != nil {
+		return fmt.Errorf("cannot unpack %s: %s", u, err)
+	}
+
+	return nil
+}
+
+// gitClone checks out the tag or the commit of the repository: the content is cached by the version,
+// so that a branch, which is never refreshed in the cache, is not accepted
+func gitClone(repoUrl, version, dir string) error {
+	if strings.HasPrefix(repoUrl, "-") {
+		return fmt.Errorf("bad git repository %q", repoUrl)
+	}
+	if strings.HasPrefix(version, "-") {
+		return fmt.Errorf("bad git version %q", version)
+	}
+
+	if output, err := exec.Command("git", "clone", "--quiet", "--", repoUrl, dir).CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone %s failed: %s\n%s", repoUrl, err, output)
+	}
+
+	commit, err := gitTagOrCommit(dir, version)
+	if err != nil {
+		return err
+	}
+
+	if output, err := exec.Command("git", "-C", dir, "-c", "advice.detachedHead=false", "checkout", "--quiet", commit, "--").CombinedOutput(); err != nil {
+		return fmt.Errorf("git checkout %s failed: %s\n%s", version, err, output)
+	}
+
+	return os.RemoveAll(filepath.Join(dir, ".git"))
+}
+
+var gitCommitRegexp = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+func gitTagOrCommit(dir, version string) (string, error) {
+	revs := []string{"refs/tags/" + version}
+	if gitCommitRegexp.MatchString(version) {
+		revs = append(revs, version)
+	}
+
+	for _, rev := range revs {
+		if output, err := exec.Command("git", "-C", dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}").Output(); err == nil {
+			return strings.TrimSpace(string(output)), nil
+		}
+	}
+
+	return "", fmt.Errorf("git version %s should be a tag or a commit: branches are not refreshed in the cache", version)
+}
+
+// readCollectionInfo reads NAMESPACE.NAME and the dependencies (the versions by NAMESPACE.NAME)
+// from MANIFEST.json of the collection artifact or galaxy.yml of the collection source
+func readCollectionInfo(dir string) (string, map[string]string, error) {
+	var manifest struct {
+		CollectionInfo struct {
+			Namespace    string            `json:"namespace"`
+			Name         string            `json:"name"`
+			Dependencies map[string]string `json:"dependencies"`
+		} `json:"collection_info"`
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "MANIFEST.json")); err == nil {
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return "", nil, fmt.Errorf("bad MANIFEST.json: %s", err)
+		}
+	} else if data, err := ioutil.ReadFile(filepath.Join(dir, "galaxy.yml")); err == nil {
+		if err := yaml.Unmarshal(data, &manifest.CollectionInfo); err != nil {
+			return "", nil, fmt.Errorf("bad galaxy.yml: %s", err)
+		}
+	} else {
+		return "", nil, fmt.Errorf("MANIFEST.json or galaxy.yml not found")
+	}
+
+	if manifest.CollectionInfo.Namespace == "" || manifest.CollectionInfo.Name == "" {
+		return "", nil, fmt.Errorf("collection namespace and name required")
+	}
+
+	return fmt.Sprintf("%s.%s", manifest.CollectionInfo.Namespace, manifest.CollectionInfo.Name), manifest.CollectionInfo.Dependencies, nil
+}
+
+func isUrl(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// archiveName returns the default role name for the repository or the archive url
+func archiveName(src string) string {
+	name := path.Base(strings.TrimSuffix(src, "/"))
+	for _, ext := range []string{".git", ".tar.gz", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	return name
+}
@@ -0,0 +1,412 @@
+package ansible_galaxy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRequirements(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected Requirements
+	}{
+		{
+			data: `
+- src: acme.nginx
+  version: 1.0.0
+- git+https://git.example.com/roles/app.git
+`,
+			expected: Requirements{Roles: []*Requirement{
+				{Src: "acme.nginx", Version: "1.0.0"},
+				{Name: "git+https://git.example.com/roles/app.git"},
+			}},
+		},
+		{
+			data: `
+roles:
+- name: nginx
+  src: https://git.example.com/roles/nginx.git
+  scm: git
+  version: v2
+collections:
+- name: acme.tools
+  version: 1.2.0
+- https://example.com/collection.tar.gz
+`,
+			expected: Requirements{
+				Roles: []*Requirement{{Name: "nginx", Src: "https://git.example.com/roles/nginx.git", Scm: "git", Version: "v2"}},
+				Collections: []*Requirement{
+					{Name: "acme.tools", Version: "1.2.0"},
+					{Name: "https://example.com/collection.tar.gz"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		requirements, err := ParseRequirements([]byte(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dumpRequirements(*requirements) != dumpRequirements(test.expected) {
+			t.Errorf("requirements:\n[EXPECTED]:\n%s\n[GOT]:\n%s", dumpRequirements(test.expected), dumpRequirements(*requirements))
+		}
+	}
+
+	if _, err := ParseRequirements([]byte("roles: []\nplaybooks: []\n")); err == nil {
+		t.Errorf("unknown requirements field should fail")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "werf-ansible-galaxy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+
+		switch r.URL.String() {
+		case "/api/v1/roles/?owner__username=acme&name=nginx":
+			fmt.Fprint(w, `{"results": [{"github_user": "acme", "github_repo": "ansible-role-nginx"}]}`)
+		case "/github/acme/ansible-role-nginx/archive/1.0.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{"ansible-role-nginx-1.0.0/tasks/main.yml": "- debug: msg=nginx\n"})
+		case "/api/v2/collections/acme/tools/versions/1.2.0/":
+			fmt.Fprint(w, `{"download_url": "/download/acme-tools-1.2.0.tar.gz"}`)
+		case "/download/acme-tools-1.2.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{
+				"MANIFEST.json":           `{"collection_info": {"namespace": "acme", "name": "tools", "version": "1.2.0"}}`,
+				"plugins/modules/tool.py": "# tool module\n",
+			})
+		case "/roles/app.tar.gz":
+			writeTestArchive(t, w, map[string]string{"app/tasks/main.yml": "- debug: msg=app\n", "app/defaults/main.yml": "port: 80\n"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	defaultGithubArchiveUrlFormat := githubArchiveUrlFormat
+	githubArchiveUrlFormat = server.URL + "/github/%s/%s/archive/%s.tar.gz"
+	defer func() { githubArchiveUrlFormat = defaultGithubArchiveUrlFormat }()
+
+	requirements := &Requirements{
+		Roles: []*Requirement{
+			{Src: "acme.nginx", Version: "1.0.0"},
+			{Name: server.URL + "/roles/app.tar.gz"},
+		},
+		Collections: []*Requirement{{Name: "acme.tools", Version: "1.2.0"}},
+	}
+
+	for i := 0; i < 2; i++ {
+		contents, err := Resolve(requirements, ResolveOptions{CacheDir: cacheDir, Server: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, content := range contents {
+			files, err := listFiles(content.Dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%s %v %v", content.Name, content.Collection, files))
+		}
+
+		expected := []string{
+			"acme.nginx false [tasks/main.yml]",
+			"app false [defaults/main.yml tasks/main.yml]",
+			"acme.tools true [MANIFEST.json plugins/modules/tool.py]",
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", expected) {
+			t.Errorf("resolved content:\n[EXPECTED]:\n%q\n[GOT]:\n%q", expected, got)
+		}
+	}
+
+	// the content is downloaded only once
+	if len(requests) != 5 {
+		t.Errorf("5 requests expected, got %d: %v", len(requests), requests)
+	}
+
+	for _, r := range []*Requirement{
+		{Src: "acme.nginx"},
+		{Src: "https://git.example.com/roles/app.git", Scm: "git"},
+		{Src: "acme.nginx", Scm: "hg", Version: "1.0.0"},
+		{Src: "nginx", Version: "1.0.0"},
+	} {
+		if _, err := Resolve(&Requirements{Roles: []*Requirement{r}}, ResolveOptions{CacheDir: cacheDir, Server: server.URL}); err == nil {
+			t.Errorf("role %+v should not be resolved", *r)
+		}
+	}
+
+	if _, err := Resolve(&Requirements{Collections: []*Requirement{{Name: "acme.tools", Version: ">=1.0.0"}}}, ResolveOptions{CacheDir: cacheDir, Server: server.URL}); err == nil {
+		t.Errorf("collection without exact version should not be resolved")
+	}
+}
+
+func TestResolveDependencies(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "werf-ansible-galaxy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/api/v1/roles/?owner__username=acme&name=web":
+			fmt.Fprint(w, `{"results": [{"github_user": "acme", "github_repo": "ansible-role-web"}]}`)
+		case "/github/acme/ansible-role-web/archive/1.0.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{
+				"ansible-role-web-1.0.0/tasks/main.yml": "- debug: msg=web\n",
+				"ansible-role-web-1.0.0/meta/main.yml": `
+dependencies:
+- common
+- role: acme.nginx
+  version: 1.0.0
+  vars:
+    port: 80
+- acme.tools.tool_role
+`,
+			})
+		case "/api/v1/roles/?owner__username=acme&name=nginx":
+			fmt.Fprint(w, `{"results": [{"github_user": "acme", "github_repo": "ansible-role-nginx"}]}`)
+		case "/github/acme/ansible-role-nginx/archive/1.0.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{
+				"ansible-role-nginx-1.0.0/tasks/main.yml": "- debug: msg=nginx\n",
+				"ansible-role-nginx-1.0.0/meta/main.yml":  "dependencies: [common]\n",
+			})
+		case "/github/acme/ansible-role-nginx/archive/2.0.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{
+				"ansible-role-nginx-2.0.0/tasks/main.yml": "- debug: msg=nginx\n",
+				"ansible-role-nginx-2.0.0/meta/main.yml":  "dependencies: [acme.php]\n",
+			})
+		case "/api/v2/collections/acme/tools/versions/1.2.0/":
+			fmt.Fprint(w, `{"download_url": "/download/acme-tools-1.2.0.tar.gz"}`)
+		case "/download/acme-tools-1.2.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{
+				"MANIFEST.json": `{"collection_info": {"namespace": "acme", "name": "tools", "dependencies": {"acme.base": "==1.0.0"}}}`,
+			})
+		case "/api/v2/collections/acme/base/versions/1.0.0/":
+			fmt.Fprint(w, `{"download_url": "/download/acme-base-1.0.0.tar.gz"}`)
+		case "/download/acme-base-1.0.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{
+				"MANIFEST.json": `{"collection_info": {"namespace": "acme", "name": "base", "dependencies": {"acme.tools": ">=1.0.0"}}}`,
+			})
+		case "/api/v2/collections/acme/extra/versions/1.0.0/":
+			fmt.Fprint(w, `{"download_url": "/download/acme-extra-1.0.0.tar.gz"}`)
+		case "/download/acme-extra-1.0.0.tar.gz":
+			writeTestArchive(t, w, map[string]string{
+				"MANIFEST.json": `{"collection_info": {"namespace": "acme", "name": "extra", "dependencies": {"acme.other": ">=1.0.0"}}}`,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	defaultGithubArchiveUrlFormat := githubArchiveUrlFormat
+	githubArchiveUrlFormat = server.URL + "/github/%s/%s/archive/%s.tar.gz"
+	defer func() { githubArchiveUrlFormat = defaultGithubArchiveUrlFormat }()
+
+	options := ResolveOptions{CacheDir: cacheDir, Server: server.URL, LocalRoles: []string{"common"}}
+
+	contents, err := Resolve(&Requirements{
+		Roles:       []*Requirement{{Src: "acme.web", Version: "1.0.0"}},
+		Collections: []*Requirement{{Name: "acme.tools", Version: "1.2.0"}},
+	}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, content := range contents {
+		got = append(got, fmt.Sprintf("%s %v", content.Name, content.Collection))
+	}
+
+	expected := []string{"acme.web false", "acme.tools true", "acme.nginx false", "acme.base true"}
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", expected) {
+		t.Errorf("resolved content:\n[EXPECTED]:\n%q\n[GOT]:\n%q", expected, got)
+	}
+
+	for _, test := range []struct {
+		requirements  *Requirements
+		expectedError string
+	}{
+		{
+			requirements:  &Requirements{Roles: []*Requirement{{Src: "acme.nginx", Version: "2.0.0"}}},
+			expectedError: "role acme.nginx depends on role acme.php: add the role with the version to the requirements",
+		},
+		{
+			requirements:  &Requirements{Roles: []*Requirement{{Src: "acme.web", Version: "1.0.0"}}},
+			expectedError: "role acme.web depends on role acme.tools.tool_role: add the collection acme.tools to the requirements",
+		},
+		{
+			requirements:  &Requirements{Collections: []*Requirement{{Name: "acme.extra", Version: "1.0.0"}}},
+			expectedError: `collection acme.extra depends on collection acme.other ">=1.0.0": add the collection with the exact version to the requirements`,
+		},
+	} {
+		if _, err := Resolve(test.requirements, options); err == nil || !strings.Contains(err.Error(), test.expectedError) {
+			t.Errorf("\n[EXPECTED]: %s\n[GOT]: %v", test.expectedError, err)
+		}
+	}
+}
+
+func TestResolveGitRole(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "werf-ansible-galaxy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoDir := filepath.Join(tmpDir, "repo")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	if err := os.MkdirAll(filepath.Join(repoDir, "tasks"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "tasks", "main.yml"), []byte("- debug: msg=app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=werf", "-c", "user.email=werf@example.com", "commit", "--quiet", "-m", "init"},
+		{"tag", "v1.0.0"},
+		{"branch", "develop"},
+	} {
+		if output, err := exec.Command("git", append([]string{"-C", repoDir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, output)
+		}
+	}
+
+	output, err := exec.Command("git", "-C", repoDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := strings.TrimSpace(string(output))
+
+	for _, version := range []string{"v1.0.0", commit, commit[:10]} {
+		contents, err := Resolve(&Requirements{Roles: []*Requirement{{Src: repoDir, Scm: "git", Version: version, Name: "app"}}}, ResolveOptions{CacheDir: cacheDir})
+		if err != nil {
+			t.Fatalf("version %s: %s", version, err)
+		}
+
+		files, err := listFiles(contents[0].Dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%q", files) != fmt.Sprintf("%q", []string{"tasks/main.yml"}) {
+			t.Errorf("version %s files:\n[EXPECTED]: %q\n[GOT]: %q", version, []string{"tasks/main.yml"}, files)
+		}
+	}
+
+	for _, r := range []*Requirement{
+		{Src: repoDir, Scm: "git", Version: "develop", Name: "app"},
+		{Src: repoDir, Scm: "git", Version: "--upload-pack=touch", Name: "app"},
+		{Src: "--upload-pack=touch " + filepath.Join(tmpDir, "pwned"), Scm: "git", Version: "v1.0.0", Name: "app"},
+	} {
+		if _, err := Resolve(&Requirements{Roles: []*Requirement{r}}, ResolveOptions{CacheDir: cacheDir}); err == nil {
+			t.Errorf("role %+v should not be resolved", *r)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "pwned")); err == nil {
+		t.Errorf("git option should not be passed by the role src")
+	}
+}
+
+func TestUnpackArchiveSafety(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-ansible-galaxy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, hdrs := range map[string][]*tar.Header{
+		"traversal": {{Typeflag: tar.TypeReg, Name: "../etc/passwd"}},
+		"symlink parent": {
+			{Typeflag: tar.TypeSymlink, Name: "role/tasks", Linkname: "/etc"},
+			{Typeflag: tar.TypeReg, Name: "role/tasks/passwd"},
+		},
+	} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range hdrs {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := unpackArchive(&buf, filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: unpacking should fail", name)
+		}
+	}
+}
+
+func writeTestArchive(t *testing.T, w http.ResponseWriter, files map[string]string) {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+
+	return files, err
+}
+
+func dumpRequirements(requirements Requirements) string {
+	var result string
+	for _, r := range requirements.Roles {
+		result += fmt.Sprintf("role %+v\n", *r)
+	}
+	for _, r := range requirements.Collections {
+		result += fmt.Sprintf("collection %+v\n", *r)
+	}
+
+	return result
+}
@@ -2,6 +2,7 @@ package build
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,8 +13,8 @@ import (
 
 	"github.com/flant/logboek"
 
-	"github.com/flant/werf/pkg/stapel"
 	"github.com/flant/werf/pkg/build/stage"
+	"github.com/flant/werf/pkg/cache_mounts"
 	"github.com/flant/werf/pkg/image"
 	imagePkg "github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/storage"
@@ -56,7 +57,7 @@ func (opts *IntrospectOptions) ImageStageShouldBeIntrospected(imageName, stageNa
 }
 
 func NewBuildPhase(c *Conveyor, opts BuildPhaseOptions) *BuildPhase {
-	return &BuildPhase{BasePhase: BasePhase{c}, BuildPhaseOptions: opts}
+	return &BuildPhase{BasePhase: BasePhase{Conveyor: c}, BuildPhaseOptions: opts}
 }
 
 type BuildPhase struct {
@@ -77,6 +78,16 @@ func (phase *BuildPhase) Name() string {
 	return "build"
 }
 
+func (phase *BuildPhase) Clone(log *imageLog) Phase {
+	opts := phase.BuildPhaseOptions
+	opts.ImageBuildOptions.OutStream = log.OutStream()
+	opts.ImageBuildOptions.ErrStream = log.ErrStream()
+
+	clone := NewBuildPhase(phase.Conveyor, opts)
+	clone.log = log
+	return clone
+}
+
 func (phase *BuildPhase) BeforeImages() error {
 	return nil
 }
@@ -114,12 +125,17 @@ func (phase *BuildPhase) BeforeImageStages(img *Image) error {
 func (phase *BuildPhase) AfterImageStages(img *Image) error {
 	img.SetLastNonEmptyStage(phase.PrevNonEmptyStage)
 
-	stagesSig, err := calculateSignature("imageStages", "", phase.PrevNonEmptyStage, phase.Conveyor)
+	stagesSig, err := calculateSignature(phase.log, "imageStages", "", phase.PrevNonEmptyStage, phase.Conveyor)
 	if err != nil {
 		return fmt.Errorf("unable to calculate image %s stages-signature: %s", img.GetName(), err)
 	}
 	img.SetStagesSignature(stagesSig)
 
+	if !phase.SignaturesOnly && phase.PrevNonEmptyStage != nil {
+		lastStageImage := phase.PrevNonEmptyStage.GetImage()
+		phase.Conveyor.report.setImageResult(img, phase.Conveyor.platform, stagesSig, lastStageImage.Name(), lastStageImage.ID(), lastStageImage.Inspect().Size)
+	}
+
 	return nil
 }
 
@@ -183,7 +199,7 @@ images := c.imagesInOrder
 func (phase *BuildPhase) OnImageStage(img *Image, stg stage.Interface) (bool, error) {
 	defer func() {
 		phase.PrevStage = stg
-		logboek.Debug.LogF("Set prev stage = %q %s\n", phase.PrevStage.Name(), phase.PrevStage.GetSignature())
+		phase.log.LogF(logboek.Debug, "Set prev stage = %q %s\n", phase.PrevStage.Name(), phase.PrevStage.GetSignature())
 	}()
 
 	isEmpty, err := stg.IsEmpty(phase.Conveyor, phase.PrevBuiltImage)
@@ -210,7 +226,7 @@ func (phase *BuildPhase) OnImageStage(img *Image, stg stage.Interface) (bool, er
 	return true, nil
 }
 
-func calculateSignature(stageName, stageDependencies string, prevNonEmptyStage stage.Interface, conveyor *Conveyor) (string, error) {
+func calculateSignature(log *imageLog, stageName, stageDependencies string, prevNonEmptyStage stage.Interface, conveyor *Conveyor) (string, error) {
 	checksumArgs := []string{image.BuildCacheVersion, stageName, stageDependencies}
 	if prevNonEmptyStage != nil {
 		prevStageDependencies, err := prevNonEmptyStage.GetNextStageDependencies(conveyor)
@@ -224,7 +240,7 @@ func calculateSignature(stageName, stageDependencies string, prevNonEmptyStage s
 	signature := util.Sha3_224Hash(checksumArgs...)
 
 	blockMsg := fmt.Sprintf("Stage %s signature %s", stageName, signature)
-	_ = logboek.Debug.LogBlock(blockMsg, logboek.LevelLogBlockOptions{}, func() error {
+	_ = log.LogBlock(logboek.Debug, blockMsg, logboek.LevelLogBlockOptions{}, func() error {
 		checksumArgsNames := []string{
 			"BuildCacheVersion",
 			"stageName",
@@ -233,7 +249,7 @@ func calculateSignature(stageName, stageDependencies string, prevNonEmptyStage s
 			"prevNonEmptyStage dependencies for next stage",
 		}
 		for ind, checksumArg := range checksumArgs {
-			logboek.Debug.LogF("%s => %q\n", checksumArgsNames[ind], checksumArg)
+			log.LogF(logboek.Debug, "%s => %q\n", checksumArgsNames[ind], checksumArg)
 		}
 		return nil
 	})
@@ -247,7 +263,7 @@ func (phase *BuildPhase) calculateStageSignature(img *Image, stg stage.Interface
 		return err
 	}
 
-	stageSig, err := calculateSignature(string(stg.Name()), stageDependencies, phase.PrevNonEmptyStage, phase.Conveyor)
+	stageSig, err := calculateSignature(phase.log, string(stg.Name()), stageDependencies, phase.PrevNonEmptyStage, phase.Conveyor)
 	if err != nil {
 		return err
 	}
@@ -269,14 +285,16 @@ func (phase *BuildPhase) calculateStageSignature(img *Image, stg stage.Interface
 		}
 
 		if suitableImageFound && !i.IsExists() {
-			logboek.Debug.LogF(
+			phase.log.LogF(
+				logboek.Debug,
 				"Stage %q image %s by signature %s from stages storage cache is not exists: resetting stages storage cache\n",
 				stg.Name(), stageSig, i.Name(),
 			)
 			shouldResetCache = true
 		}
 	} else {
-		logboek.Debug.LogF(
+		phase.log.LogF(
+			logboek.Debug,
 			"Stage %q cache by signature %s is not exists in stages storage cache: resetting stages storage cache\n",
 			stg.Name(), stageSig,
 		)
@@ -306,12 +324,12 @@ func (phase *BuildPhase) calculateStageSignature(img *Image, stg stage.Interface
 	}
 
 	phase.PrevNonEmptyStage = stg
-	logboek.Debug.LogF("Set prev non empty stage = %q %s\n", phase.PrevNonEmptyStage.Name(), phase.PrevNonEmptyStage.GetSignature())
+	phase.log.LogF(logboek.Debug, "Set prev non empty stage = %q %s\n", phase.PrevNonEmptyStage.Name(), phase.PrevNonEmptyStage.GetSignature())
 	phase.PrevImage = i
-	logboek.Debug.LogF("Set prev image = %q\n", phase.PrevImage.Name())
+	phase.log.LogF(logboek.Debug, "Set prev image = %q\n", phase.PrevImage.Name())
 	if phase.PrevImage.IsExists() {
 		phase.PrevBuiltImage = phase.PrevImage
-		logboek.Debug.LogF("Set prev built image = %q\n", phase.PrevBuiltImage.Name())
+		phase.log.LogF(logboek.Debug, "Set prev built image = %q\n", phase.PrevBuiltImage.Name())
 	}
 
 	return nil
@@ -323,7 +341,8 @@ func (phase *BuildPhase) selectSuitableStagesStorageImage(stg stage.Interface, i
 	}
 
 	var imgInfo *storage.ImageInfo
-	if err := logboek.Info.LogProcess(
+	if err := phase.log.LogProcess(
+		logboek.Info,
 		fmt.Sprintf("Selecting suitable image for stage %s by signature %s", stg.Name(), stg.GetSignature()),
 		logboek.LevelLogProcessOptions{},
 		func() error {
@@ -343,15 +362,16 @@ func (phase *BuildPhase) selectSuitableStagesStorageImage(stg stage.Interface, i
 		panic(err)
 	}
 
-	_ = logboek.Debug.LogBlock("Selected cache image", logboek.LevelLogBlockOptions{Style: logboek.HighlightStyle()}, func() error {
-		logboek.Debug.LogF(string(imgInfoData))
+	_ = phase.log.LogBlock(logboek.Debug, "Selected cache image", logboek.LevelLogBlockOptions{Style: logboek.HighlightStyle()}, func() error {
+		phase.log.LogF(logboek.Debug, string(imgInfoData))
 		return nil
 	})
 
 	i := phase.Conveyor.GetOrCreateStageImage(phase.PrevImage, imgInfo.ImageName)
 	stg.SetImage(i)
 
-	if err := logboek.Info.LogProcess(
+	if err := phase.log.LogProcess(
+		logboek.Info,
 		fmt.Sprintf("Sync stage %s signature %s image %s from stages storage", stg.Name(), stg.GetSignature(), i.Name()),
 		logboek.LevelLogProcessOptions{},
 		func() error {
@@ -371,7 +391,8 @@ func (phase *BuildPhase) getImagesBySignatureFromCache(stageName, stageSig strin
 	var cacheExists bool
 	var cacheImagesDescs []*storage.ImageInfo
 
-	err := logboek.Info.LogProcess(
+	err := phase.log.LogProcess(
+		logboek.Info,
 		fmt.Sprintf("Getting stage %s images by signature %s from stages storage cache", stageName, stageSig),
 		logboek.LevelLogProcessOptions{},
 		func() error {
@@ -395,7 +416,8 @@ func (phase *BuildPhase) atomicGetImagesBySignatureFromStagesStorageWithCacheRes
 
 	var originImagesDescs []*storage.ImageInfo
 	var err error
-	if err := logboek.Info.LogProcess(
+	if err := phase.log.LogProcess(
+		logboek.Info,
 		fmt.Sprintf("Getting stage %s images by signature %s from stages storage", stageName, stageSig),
 		logboek.LevelLogProcessOptions{},
 		func() error {
@@ -410,7 +432,8 @@ func (phase *BuildPhase) atomicGetImagesBySignatureFromStagesStorageWithCacheRes
 		return nil, err
 	}
 
-	if err := logboek.Info.LogProcess(
+	if err := phase.log.LogProcess(
+		logboek.Info,
 		fmt.Sprintf("Storing stage %s images by signature %s into stages storage cache", stageName, stageSig),
 		logboek.LevelLogProcessOptions{},
 		func() error {
@@ -432,7 +455,8 @@ func (phase *BuildPhase) atomicStoreStageCache(stageName, stageSig string, image
 	}
 	defer phase.Conveyor.StorageLockManager.UnlockStageCache(phase.Conveyor.projectName(), stageSig)
 
-	return logboek.Info.LogProcess(
+	return phase.log.LogProcess(
+		logboek.Info,
 		fmt.Sprintf("Storing stage %q images by signature %s into stages storage cache", stageName, stageSig),
 		logboek.LevelLogProcessOptions{},
 		func() error {
@@ -447,7 +471,11 @@ func (phase *BuildPhase) atomicStoreStageCache(stageName, stageSig string, image
 func (phase *BuildPhase) prepareStage(img *Image, stg stage.Interface) error {
 	if !phase.isBaseImagePrepared {
 		if !img.isDockerfileImage {
-			if err := img.PrepareBaseImage(phase.Conveyor); err != nil {
+			phase.Conveyor.baseImagesMutex.Lock()
+			err := img.PrepareBaseImage(phase.Conveyor, phase.log)
+			phase.Conveyor.baseImagesMutex.Unlock()
+
+			if err != nil {
 				return fmt.Errorf("prepare base image %s failed: %s", img.GetBaseImage().Name(), err)
 			}
 		}
@@ -456,7 +484,7 @@ func (phase *BuildPhase) prepareStage(img *Image, stg stage.Interface) error {
 
 	stageImage := stg.GetImage()
 
-	if phase.Conveyor.GetImageBySignature(stg.GetSignature()) != nil || stageImage.IsExists() {
+	if phase.Conveyor.GetImageBySignature(stg.GetSignature()) == stageImage || stageImage.IsExists() {
 		// Do not prepare this image second time, because it has been already prepared for this conveyor instance
 		return nil
 	}
@@ -470,6 +498,10 @@ func (phase *BuildPhase) prepareStage(img *Image, stg stage.Interface) error {
 		imagePkg.WerfStageSignatureLabel: stg.GetSignature(),
 	}
 
+	if phase.Conveyor.platform != "" {
+		serviceLabels[imagePkg.WerfPlatformLabel] = phase.Conveyor.platform
+	}
+
 	switch stg.(type) {
 	case *stage.DockerfileStage:
 		var buildArgs []string
@@ -509,12 +541,13 @@ func (phase *BuildPhase) buildStage(img *Image, stg stage.Interface) error {
 	isUsingCache := stg.GetImage().IsExists()
 
 	if isUsingCache {
-		logboek.Default.LogFHighlight("Use cache image for %s\n", stg.LogDetailedName())
+		phase.log.LogFHighlight(logboek.Default, "Use cache image for %s\n", stg.LogDetailedName())
 
-		logImageInfo(stg.GetImage(), phase.PrevNonEmptyStageImageSize, isUsingCache)
+		logImageInfo(phase.log, stg.GetImage(), phase.PrevNonEmptyStageImageSize, isUsingCache)
 
-		logboek.LogOptionalLn()
+		phase.log.LogOptionalLn(logboek.Default)
 
+		phase.reportStage(img, stg, isUsingCache, 0)
 		phase.PrevNonEmptyStageImageSize = stg.GetImage().Inspect().Size
 
 		if phase.IntrospectOptions.ImageStageShouldBeIntrospected(img.GetName(), string(stg.Name())) {
@@ -526,29 +559,39 @@ func (phase *BuildPhase) buildStage(img *Image, stg stage.Interface) error {
 		return nil
 	}
 
-	_, err := stapel.GetOrCreateContainer()
+	_, err := image.GetContainerBackend().GetOrCreateStapelContainer()
 	if err != nil {
 		return fmt.Errorf("get or create stapel container failed: %s", err)
 	}
 
+	// the info section of the image processed in parallel is logged when the log is replayed
+	prevNonEmptyStageImageSize := phase.PrevNonEmptyStageImageSize
 	infoSectionFunc := func(err error) {
 		if err != nil {
 			_ = logboek.WithIndent(func() error {
-				logImageCommands(stg.GetImage())
+				logImageCommands(nil, stg.GetImage())
 				return nil
 			})
 			return
 		}
-		logImageInfo(stg.GetImage(), phase.PrevNonEmptyStageImageSize, isUsingCache)
+		logImageInfo(nil, stg.GetImage(), prevNonEmptyStageImageSize, isUsingCache)
 	}
 
-	if err := logboek.Default.LogProcess(
+	buildStartedAt := time.Now()
+	if err := phase.log.LogProcess(
+		logboek.Default,
 		fmt.Sprintf("Building %s", stg.LogDetailedName()),
 		logboek.LevelLogProcessOptions{
 			InfoSectionFunc: infoSectionFunc,
 			Style:           logboek.HighlightStyle(),
 		},
 		func() (err error) {
+			releaseCacheMounts, err := phase.useCacheMounts(stg)
+			if err != nil {
+				return err
+			}
+			defer releaseCacheMounts()
+
 			if err := stg.PreRunHook(phase.Conveyor); err != nil {
 				return fmt.Errorf("%s preRunHook failed: %s", stg.LogDetailedName(), err)
 			}
@@ -559,6 +602,7 @@ func (phase *BuildPhase) buildStage(img *Image, stg stage.Interface) error {
 		return err
 	}
 
+	phase.reportStage(img, stg, isUsingCache, time.Since(buildStartedAt))
 	phase.PrevNonEmptyStageImageSize = stg.GetImage().Inspect().Size
 
 	if phase.IntrospectOptions.ImageStageShouldBeIntrospected(img.GetName(), string(stg.Name())) {
@@ -570,15 +614,67 @@ func (phase *BuildPhase) buildStage(img *Image, stg stage.Interface) error {
 	return nil
 }
 
-func (phase *BuildPhase) atomicBuildStageImage(img *Image, stg stage.Interface) error {
-	stageImage := stg.GetImage()
+// useCacheMounts locks cache mounts of the stage for the build time: locked and private caches are used by one stage at a time.
+// Cache mounts are locked in the order of names, so that stages declaring the same caches in a different order cannot deadlock
+func (phase *BuildPhase) useCacheMounts(stg stage.Interface) (func(), error) {
+	var releaseFuncs []func()
+	release := func() {
+		for i := len(releaseFuncs) - 1; i >= 0; i-- {
+			releaseFuncs[i]()
+		}
+	}
 
-	if err := logboek.WithTag(fmt.Sprintf("%s/%s", img.LogName(), stg.Name()), img.LogTagStyle(), func() error {
-		return stageImage.Build(phase.ImageBuildOptions)
-	}); err != nil {
-		return fmt.Errorf("failed to build image for stage %q with signature %s: %s", stg.Name(), stg.GetSignature(), err)
+	cacheMounts := append([]*cache_mounts.CacheMount{}, stg.GetCacheMounts()...)
+	sort.Slice(cacheMounts, func(i, j int) bool {
+		return cacheMounts[i].Name() < cacheMounts[j].Name()
+	})
+
+	for _, cacheMount := range cacheMounts {
+		cacheMount := cacheMount
+
+		if cacheMount.ShouldBeLocked() {
+			if err := phase.Conveyor.StorageLockManager.LockCacheMount(cacheMount.ProjectName, cacheMount.Name()); err != nil {
+				release()
+				return nil, fmt.Errorf("unable to lock cache mount %s: %s", cacheMount.Id, err)
+			}
+			releaseFuncs = append(releaseFuncs, func() {
+				_ = phase.Conveyor.StorageLockManager.UnlockCacheMount(cacheMount.ProjectName, cacheMount.Name())
+			})
+		}
+
+		if err := cacheMount.Use(); err != nil {
+			release()
+			return nil, fmt.Errorf("unable to use cache mount %s: %s", cacheMount.Id, err)
+		}
+		releaseFuncs = append(releaseFuncs, func() {
+			_ = cacheMount.Release()
+		})
 	}
 
+	return release, nil
+}
+
+func (phase *BuildPhase) reportStage(img *Image, stg stage.Interface, isUsingCache bool, duration time.Duration) {
+	stageImage := stg.GetImage()
+	size := stageImage.Inspect().Size
+
+	phase.Conveyor.report.addStage(img, phase.Conveyor.platform, &StageReport{
+		Name:            string(stg.Name()),
+		Signature:       stg.GetSignature(),
+		ImageName:       stageImage.Name(),
+		ImageID:         stageImage.ID(),
+		CacheHit:        isUsingCache,
+		DurationSeconds: duration.Seconds(),
+		Size:            size,
+		SizeDelta:       size - phase.PrevNonEmptyStageImageSize,
+	})
+}
+
+// atomicBuildStageImage builds the stage image holding the stage lock: the stage with the same signature,
+// which is built by another werf process or another image of the conveyor meanwhile, is used instead of building it once more
+func (phase *BuildPhase) atomicBuildStageImage(img *Image, stg stage.Interface) error {
+	stageImage := stg.GetImage()
+
 	if err := phase.Conveyor.StorageLockManager.LockStage(phase.Conveyor.projectName(), stg.GetSignature()); err != nil {
 		return fmt.Errorf("unable to lock project %s signature %s: %s", phase.Conveyor.projectName(), stg.GetSignature(), err)
 	}
@@ -591,7 +687,8 @@ func (phase *BuildPhase) atomicBuildStageImage(img *Image, stg stage.Interface)
 
 	if len(imagesDescs) > 0 {
 		var imgInfo *storage.ImageInfo
-		if err := logboek.Info.LogProcess(
+		if err := phase.log.LogProcess(
+			logboek.Info,
 			fmt.Sprintf("Selecting suitable image for stage %q by signature %s", stg.Name(), stg.GetSignature()),
 			logboek.LevelLogProcessOptions{},
 			func() error {
@@ -603,14 +700,16 @@ func (phase *BuildPhase) atomicBuildStageImage(img *Image, stg stage.Interface)
 		}
 
 		if imgInfo != nil {
-			logboek.Default.LogF(
-				"Discarding newly built image for stage %q by signature %s: detected already existing image %s in the stages storage\n",
+			phase.log.LogF(
+				logboek.Default,
+				"Skipping build of stage %q by signature %s: detected already existing image %s in the stages storage\n",
 				stg.Name(), stg.GetSignature(), imgInfo.ImageName,
 			)
 			i := phase.Conveyor.GetOrCreateStageImage(phase.PrevImage, imgInfo.ImageName)
 			stg.SetImage(i)
 
-			if err := logboek.Info.LogProcess(
+			if err := phase.log.LogProcess(
+				logboek.Info,
 				fmt.Sprintf("Sync stage %q signature %s image %s from stages storage", stg.Name(), stg.GetSignature(), i.Name()),
 				logboek.LevelLogProcessOptions{},
 				func() error {
@@ -627,6 +726,14 @@ func (phase *BuildPhase) atomicBuildStageImage(img *Image, stg stage.Interface)
 		}
 	}
 
+	buildFunc := func() error {
+		return stageImage.Build(phase.ImageBuildOptions)
+	}
+
+	if err := phase.log.WithTag(fmt.Sprintf("%s/%s", img.LogName(), stg.Name()), img.LogTagStyle(), buildFunc); err != nil {
+		return fmt.Errorf("failed to build image for stage %q with signature %s: %s", stg.Name(), stg.GetSignature(), err)
+	}
+
 	newStageImageName := phase.generateUniqStageImageName(stg.GetSignature(), imagesDescs)
 
 	stageImageObj := phase.Conveyor.GetStageImage(stageImage.Name())
@@ -635,7 +742,8 @@ func (phase *BuildPhase) atomicBuildStageImage(img *Image, stg stage.Interface)
 	stageImageObj.SetName(newStageImageName)
 	phase.Conveyor.SetStageImage(stageImageObj)
 
-	if err := logboek.Info.LogProcess(
+	if err := phase.log.LogProcess(
+		logboek.Info,
 		fmt.Sprintf("Store stage %q signature %s image %s into stages storage", stageImage.Name(), stg.GetSignature(), stageImage.Name()),
 		logboek.LevelLogProcessOptions{},
 		func() error {
@@ -664,7 +772,7 @@ func (phase *BuildPhase) generateUniqStageImageName(signature string, imagesDesc
 		timeNow := time.Now().UTC()
 		timeNowMicroseconds := timeNow.Unix()*1000 + int64(timeNow.Nanosecond()/1000000)
 		uniqueID := fmt.Sprintf("%d", timeNowMicroseconds)
-		imageName = fmt.Sprintf(image.LocalImageStageImageFormat, phase.Conveyor.projectName(), signature, uniqueID)
+		imageName = phase.Conveyor.StagesStorage.ConstructStageImageName(phase.Conveyor.projectName(), signature, uniqueID)
 
 		for _, imgInfo := range imagesDescs {
 			if imgInfo.ImageName == imageName {
@@ -694,19 +802,19 @@ var (
 	logImageInfoFormat        = fmt.Sprintf("  %%%ds: %%s\n", logImageInfoLeftPartWidth)
 )
 
-func logImageInfo(img imagePkg.ImageInterface, prevStageImageSize int64, isUsingCache bool) {
+func logImageInfo(log *imageLog, img imagePkg.ImageInterface, prevStageImageSize int64, isUsingCache bool) {
 	parts := strings.Split(img.Name(), ":")
 	repository, tag := parts[0], parts[1]
 
-	logboek.Default.LogFDetails(logImageInfoFormat, "repository", repository)
-	logboek.Default.LogFDetails(logImageInfoFormat, "image_id", stringid.TruncateID(img.ID()))
-	logboek.Default.LogFDetails(logImageInfoFormat, "created", img.Inspect().Created)
-	logboek.Default.LogFDetails(logImageInfoFormat, "tag", tag)
+	log.LogFDetails(logboek.Default, logImageInfoFormat, "repository", repository)
+	log.LogFDetails(logboek.Default, logImageInfoFormat, "image_id", stringid.TruncateID(img.ID()))
+	log.LogFDetails(logboek.Default, logImageInfoFormat, "created", img.Inspect().Created)
+	log.LogFDetails(logboek.Default, logImageInfoFormat, "tag", tag)
 
 	if prevStageImageSize == 0 {
-		logboek.Default.LogFDetails(logImageInfoFormat, "size", byteCountBinary(img.Inspect().Size))
+		log.LogFDetails(logboek.Default, logImageInfoFormat, "size", byteCountBinary(img.Inspect().Size))
 	} else {
-		logboek.Default.LogFDetails(logImageInfoFormat, "diff", byteCountBinary(img.Inspect().Size-prevStageImageSize))
+		log.LogFDetails(logboek.Default, logImageInfoFormat, "diff", byteCountBinary(img.Inspect().Size-prevStageImageSize))
 	}
 
 	if !isUsingCache {
@@ -714,19 +822,19 @@ func logImageInfo(img imagePkg.ImageInterface, prevStageImageSize int64, isUsing
 		if len(changes) != 0 {
 			fitTextOptions := logboek.FitTextOptions{ExtraIndentWidth: logImageInfoLeftPartWidth + 4}
 			formattedCommands := strings.TrimLeft(logboek.FitText(strings.Join(changes, "\n"), fitTextOptions), " ")
-			logboek.Default.LogFDetails(logImageInfoFormat, "instructions", formattedCommands)
+			log.LogFDetails(logboek.Default, logImageInfoFormat, "instructions", formattedCommands)
 		}
 
-		logImageCommands(img)
+		logImageCommands(log, img)
 	}
 }
 
-func logImageCommands(img imagePkg.ImageInterface) {
+func logImageCommands(log *imageLog, img imagePkg.ImageInterface) {
 	commands := img.Container().UserRunCommands()
 	if len(commands) != 0 {
 		fitTextOptions := logboek.FitTextOptions{ExtraIndentWidth: logImageInfoLeftPartWidth + 4}
 		formattedCommands := strings.TrimLeft(logboek.FitText(strings.Join(commands, "\n"), fitTextOptions), " ")
-		logboek.Default.LogFDetails(logImageInfoFormat, "commands", formattedCommands)
+		log.LogFDetails(logboek.Default, logImageInfoFormat, "commands", formattedCommands)
 	}
 }
 
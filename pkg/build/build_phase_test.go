@@ -0,0 +1,145 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/build/stage"
+	"github.com/flant/werf/pkg/cache_mounts"
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/storage"
+	"github.com/flant/werf/pkg/werf"
+)
+
+type cacheMountsStage struct {
+	stage.Interface
+
+	cacheMounts []*cache_mounts.CacheMount
+}
+
+func (s *cacheMountsStage) GetCacheMounts() []*cache_mounts.CacheMount {
+	return s.cacheMounts
+}
+
+func initBuildPhaseTest(t *testing.T) func() {
+	tmpDir, err := ioutil.TempDir("", "werf-build-phase-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := werf.Init(tmpDir, filepath.Join(tmpDir, "home")); err != nil {
+		t.Fatal(err)
+	}
+	if err := shluz.Init(filepath.Join(tmpDir, "locks")); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		_ = os.RemoveAll(tmpDir)
+	}
+}
+
+func TestBuildPhase_useCacheMounts(t *testing.T) {
+	defer initBuildPhaseTest(t)()
+
+	for _, test := range []struct {
+		sharing             string
+		expectedMaxParallel int
+	}{
+		{cache_mounts.SharingLocked, 1},
+		{cache_mounts.SharingShared, 2},
+	} {
+		conveyor := &Conveyor{StorageLockManager: &storage.FileLockManager{}}
+
+		var mutex sync.Mutex
+		var parallel, maxParallel int
+		var wg sync.WaitGroup
+		errs := make(chan error, 2)
+
+		for _, imageName := range []string{"backend", "frontend"} {
+			stg := &cacheMountsStage{cacheMounts: []*cache_mounts.CacheMount{
+				cache_mounts.NewCacheMount("project", imageName, &config.Mount{Id: "apt", Sharing: test.sharing}),
+			}}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				phase := &BuildPhase{BasePhase: BasePhase{Conveyor: conveyor}}
+				release, err := phase.useCacheMounts(stg)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer release()
+
+				mutex.Lock()
+				parallel++
+				if parallel > maxParallel {
+					maxParallel = parallel
+				}
+				mutex.Unlock()
+
+				time.Sleep(100 * time.Millisecond)
+
+				mutex.Lock()
+				parallel--
+				mutex.Unlock()
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		if maxParallel != test.expectedMaxParallel {
+			t.Errorf("%s cache: stages using the cache at the same time:\n[EXPECTED]: %d\n[GOT]: %d", test.sharing, test.expectedMaxParallel, maxParallel)
+		}
+	}
+}
+
+// cacheMountsLockManager records the order of the cache mount locks
+type cacheMountsLockManager struct {
+	storage.FileLockManager
+
+	lockedCacheMounts []string
+}
+
+func (lockManager *cacheMountsLockManager) LockCacheMount(projectName, cacheMountName string) error {
+	lockManager.lockedCacheMounts = append(lockManager.lockedCacheMounts, cacheMountName)
+	return lockManager.FileLockManager.LockCacheMount(projectName, cacheMountName)
+}
+
+func TestBuildPhase_useCacheMounts_order(t *testing.T) {
+	defer initBuildPhaseTest(t)()
+
+	// images declare the same locked caches in a different order, the locks are taken in the same order to prevent deadlocks
+	for _, ids := range [][]string{{"apt", "go"}, {"go", "apt"}} {
+		stg := &cacheMountsStage{}
+		for _, id := range ids {
+			stg.cacheMounts = append(stg.cacheMounts, cache_mounts.NewCacheMount("project", "", &config.Mount{Id: id, Sharing: cache_mounts.SharingLocked}))
+		}
+
+		lockManager := &cacheMountsLockManager{}
+		phase := &BuildPhase{BasePhase: BasePhase{Conveyor: &Conveyor{StorageLockManager: lockManager}}}
+		release, err := phase.useCacheMounts(stg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+
+		expected := []string{"apt", "go"}
+		if !reflect.DeepEqual(lockManager.lockedCacheMounts, expected) {
+			t.Errorf("%v cache mounts lock order:\n[EXPECTED]: %v\n[GOT]: %v", ids, expected, lockManager.lockedCacheMounts)
+		}
+	}
+}
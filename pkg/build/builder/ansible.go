@@ -16,18 +16,21 @@ import (
 	"github.com/flant/logboek"
 
 	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/stapel"
 	"github.com/flant/werf/pkg/util"
 )
 
 type Ansible struct {
-	config *config.Ansible
-	extra  *Extra
+	config  *config.Ansible
+	extra   *Extra
+	content *ansibleContent
 }
 
 type Extra struct {
 	ContainerWerfPath string
 	TmpPath           string
+	ProjectDir        string
 }
 
 func NewAnsibleBuilder(config *config.Ansible, extra *Extra) *Ansible {
@@ -44,13 +47,13 @@ func (b *Ansible) Install(container Container) error       { return b.stage("Ins
 func (b *Ansible) BeforeSetup(container Container) error   { return b.stage("BeforeSetup", container) }
 func (b *Ansible) Setup(container Container) error         { return b.stage("Setup", container) }
 
-func (b *Ansible) BeforeInstallChecksum() string { return b.stageChecksum("BeforeInstall") }
-func (b *Ansible) InstallChecksum() string       { return b.stageChecksum("Install") }
-func (b *Ansible) BeforeSetupChecksum() string   { return b.stageChecksum("BeforeSetup") }
-func (b *Ansible) SetupChecksum() string         { return b.stageChecksum("Setup") }
+func (b *Ansible) BeforeInstallChecksum() (string, error) { return b.stageChecksum("BeforeInstall") }
+func (b *Ansible) InstallChecksum() (string, error)       { return b.stageChecksum("Install") }
+func (b *Ansible) BeforeSetupChecksum() (string, error)   { return b.stageChecksum("BeforeSetup") }
+func (b *Ansible) SetupChecksum() (string, error)         { return b.stageChecksum("Setup") }
 
 func (b *Ansible) isEmptyStage(userStageName string) bool {
-	return b.stageChecksum(userStageName) == ""
+	return len(b.stageTasks(userStageName)) == 0 && b.stageVersionChecksum(userStageName) == ""
 }
 
 func (b *Ansible) stage(userStageName string, container Container) error {
@@ -58,6 +61,15 @@ func (b *Ansible) stage(userStageName string, container Container) error {
 		return nil
 	}
 
+	if b.isContentDefined() {
+		content, err := b.resolveContent()
+		if err != nil {
+			return err
+		}
+
+		container.AddVolume(content.volumes(b.extra.ContainerWerfPath)...)
+	}
+
 	if err := b.createStageWorkDirStructure(userStageName); err != nil {
 		return err
 	}
@@ -91,7 +103,7 @@ func (b *Ansible) stage(userStageName string, container Container) error {
 		fmt.Sprintf("%s:%s:rw", stageHostTmpDir, b.containerTmpDir()),
 	)
 
-	containerName, err := stapel.GetOrCreateContainer()
+	containerName, err := image.GetContainerBackend().GetOrCreateStapelContainer()
 	if err != nil {
 		return err
 	}
@@ -112,18 +124,18 @@ func (b *Ansible) stage(userStageName string, container Container) error {
 	return nil
 }
 
-func (b *Ansible) stageChecksum(userStageName string) string {
+func (b *Ansible) stageChecksum(userStageName string) (string, error) {
 	var checksumArgs []string
 
 	for _, task := range b.stageTasks(userStageName) {
 		output, err := yaml.Marshal(task.Config)
 		if err != nil {
-			panic(fmt.Sprintf("runtime err: %s", err))
+			return "", err
 		}
 
 		jsonOutput, err := ghodssYaml.YAMLToJSON(output)
 		if err != nil {
-			panic(fmt.Sprintf("runtime err: %s", err))
+			return "", err
 		}
 		checksumArgs = append(checksumArgs, string(jsonOutput))
 	}
@@ -140,11 +152,17 @@ func (b *Ansible) stageChecksum(userStageName string) string {
 		checksumArgs = append(checksumArgs, stageVersionChecksum)
 	}
 
-	if len(checksumArgs) != 0 {
-		return util.Sha256Hash(checksumArgs...)
-	} else {
-		return ""
+	if len(checksumArgs) == 0 {
+		return "", nil
 	}
+
+	if contentChecksum, err := b.contentChecksum(userStageName); err != nil {
+		return "", err
+	} else if contentChecksum != "" {
+		checksumArgs = append(checksumArgs, contentChecksum)
+	}
+
+	return util.Sha256Hash(checksumArgs...), nil
 }
 
 func (b *Ansible) stageVersionChecksum(userStageName string) string {
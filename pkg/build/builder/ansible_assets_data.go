@@ -3,6 +3,7 @@ package builder
 import (
 	"fmt"
 	"path"
+	"strings"
 
 	"github.com/flant/werf/pkg/build/builder/ansible"
 	"github.com/flant/werf/pkg/stapel"
@@ -14,6 +15,7 @@ func (b *Ansible) assetsAnsibleCfg() string {
 	sudoBinPath := stapel.SudoBinPath()
 	localTmpDirPath := path.Join(b.containerTmpDir(), "local")
 	remoteTmpDirPath := path.Join(b.containerTmpDir(), "remote")
+	contentDefaults := b.assetsAnsibleCfgContentDefaults()
 
 	format := `[defaults]
 inventory = %[1]s
@@ -31,13 +33,34 @@ local_tmp = %[3]s
 remote_tmp = %[4]s
 ; keep ansiballz for debug
 ;keep_remote_files = 1
-[privilege_escalation]
+%[6]s[privilege_escalation]
 become = yes
 become_method = sudo
 become_exe = %[5]s
 become_flags = -E -H`
 
-	return fmt.Sprintf(format, hostsPath, callbackPluginsPath, localTmpDirPath, remoteTmpDirPath, sudoBinPath)
+	return fmt.Sprintf(format, hostsPath, callbackPluginsPath, localTmpDirPath, remoteTmpDirPath, sudoBinPath, contentDefaults)
+}
+
+// assetsAnsibleCfgContentDefaults returns the paths of the project roles and library directories and the resolved requirements,
+// which are mounted by the stage
+func (b *Ansible) assetsAnsibleCfgContentDefaults() string {
+	if b.content == nil {
+		return ""
+	}
+
+	var defaults string
+	if paths := b.content.containerRolesPaths(b.extra.ContainerWerfPath); len(paths) != 0 {
+		defaults += fmt.Sprintf("roles_path = %s\n", strings.Join(paths, ":"))
+	}
+	if paths := b.content.containerLibraryPaths(b.extra.ContainerWerfPath); len(paths) != 0 {
+		defaults += fmt.Sprintf("library = %s\n", strings.Join(paths, ":"))
+	}
+	if paths := b.content.containerCollectionsPaths(b.extra.ContainerWerfPath); len(paths) != 0 {
+		defaults += fmt.Sprintf("collections_paths = %s\n", strings.Join(paths, ":"))
+	}
+
+	return defaults
 }
 
 func (b *Ansible) assetsHosts() string {
@@ -0,0 +1,209 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/ansible_galaxy"
+	"github.com/flant/werf/pkg/util"
+	"github.com/flant/werf/pkg/werf"
+)
+
+// ansibleContent is the project roles and library directories and the resolved requirements,
+// which are mounted into the stage container
+type ansibleContent struct {
+	rolesDirs    []string
+	libraryDirs  []string
+	requirements []*ansible_galaxy.Content
+	checksum     string
+}
+
+func (b *Ansible) isContentDefined() bool {
+	return len(b.config.Roles) != 0 || len(b.config.Library) != 0 || b.config.Requirements != ""
+}
+
+// resolveContent resolves the requirements and calculates the content checksum once for the builder
+func (b *Ansible) resolveContent() (*ansibleContent, error) {
+	if b.content != nil {
+		return b.content, nil
+	}
+
+	content := &ansibleContent{}
+	var checksumArgs []string
+
+	for _, dirs := range []struct {
+		directive string
+		paths     []string
+		hostDirs  *[]string
+	}{
+		{"roles", b.config.Roles, &content.rolesDirs},
+		{"library", b.config.Library, &content.libraryDirs},
+	} {
+		for _, p := range dirs.paths {
+			dir := filepath.Join(b.extra.ProjectDir, p)
+			if exists, err := util.DirExists(dir); err != nil {
+				return nil, err
+			} else if !exists {
+				return nil, fmt.Errorf("ansible %s directory %s not found in the project directory", dirs.directive, p)
+			}
+
+			checksum, err := util.DirChecksum(dir)
+			if err != nil {
+				return nil, fmt.Errorf("unable to calculate ansible %s directory %s checksum: %s", dirs.directive, p, err)
+			}
+
+			*dirs.hostDirs = append(*dirs.hostDirs, dir)
+			checksumArgs = append(checksumArgs, dirs.directive, p, checksum)
+		}
+	}
+
+	if b.config.Requirements != "" {
+		requirements, err := ansible_galaxy.ReadRequirements(filepath.Join(b.extra.ProjectDir, b.config.Requirements))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ansible requirements: %s", err)
+		}
+
+		localRoles, err := localRoleNames(content.rolesDirs)
+		if err != nil {
+			return nil, err
+		}
+
+		content.requirements, err = ansible_galaxy.Resolve(requirements, ansible_galaxy.ResolveOptions{
+			CacheDir:   filepath.Join(werf.GetLocalCacheDir(), "ansible_galaxy"),
+			Server:     os.Getenv("WERF_ANSIBLE_GALAXY_SERVER"),
+			LocalRoles: localRoles,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve ansible requirements %s: %s", b.config.Requirements, err)
+		}
+
+		for _, c := range content.requirements {
+			checksumArgs = append(checksumArgs, "requirements", c.Name, strconv.FormatBool(c.Collection), c.Checksum)
+		}
+	}
+
+	if len(checksumArgs) != 0 {
+		content.checksum = util.Sha256Hash(checksumArgs...)
+	}
+
+	b.content = content
+
+	return content, nil
+}
+
+// localRoleNames returns the roles of the project roles directories, which can be the dependencies of the galaxy roles
+func localRoleNames(rolesDirs []string) ([]string, error) {
+	var names []string
+	for _, dir := range rolesDirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if info.IsDir() {
+				names = append(names, info.Name())
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// volumes returns the volumes of the project roles and library directories and the resolved requirements:
+// galaxy roles and collections are mounted by ansible-galaxy install layout
+func (c *ansibleContent) volumes(containerWerfPath string) []string {
+	var volumes []string
+
+	for ind, dir := range c.rolesDirs {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", dir, path.Join(containerRolesDir(containerWerfPath), strconv.Itoa(ind))))
+	}
+
+	for ind, dir := range c.libraryDirs {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", dir, path.Join(containerLibraryDir(containerWerfPath), strconv.Itoa(ind))))
+	}
+
+	for _, r := range c.requirements {
+		var containerDir string
+		if r.Collection {
+			containerDir = path.Join(containerGalaxyDir(containerWerfPath), "ansible_collections", strings.Replace(r.Name, ".", "/", 1))
+		} else {
+			containerDir = path.Join(containerGalaxyDir(containerWerfPath), "roles", r.Name)
+		}
+
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", r.Dir, containerDir))
+	}
+
+	return volumes
+}
+
+func (c *ansibleContent) containerRolesPaths(containerWerfPath string) []string {
+	var paths []string
+	for ind := range c.rolesDirs {
+		paths = append(paths, path.Join(containerRolesDir(containerWerfPath), strconv.Itoa(ind)))
+	}
+
+	for _, r := range c.requirements {
+		if !r.Collection {
+			paths = append(paths, path.Join(containerGalaxyDir(containerWerfPath), "roles"))
+			break
+		}
+	}
+
+	return paths
+}
+
+func (c *ansibleContent) containerLibraryPaths(containerWerfPath string) []string {
+	var paths []string
+	for ind := range c.libraryDirs {
+		paths = append(paths, path.Join(containerLibraryDir(containerWerfPath), strconv.Itoa(ind)))
+	}
+
+	return paths
+}
+
+func (c *ansibleContent) containerCollectionsPaths(containerWerfPath string) []string {
+	for _, r := range c.requirements {
+		if r.Collection {
+			return []string{containerGalaxyDir(containerWerfPath)}
+		}
+	}
+
+	return nil
+}
+
+func (b *Ansible) contentChecksum(userStageName string) (string, error) {
+	if !b.isContentDefined() {
+		return "", nil
+	}
+
+	content, err := b.resolveContent()
+	if err != nil {
+		return "", err
+	}
+
+	if debugUserStageChecksum() {
+		logboek.Debug.LogFHighlight("DEBUG: %s stage ansible roles, library and requirements checksum %v\n", userStageName, content.checksum)
+	}
+
+	return content.checksum, nil
+}
+
+func containerRolesDir(containerWerfPath string) string {
+	return path.Join(containerWerfPath, "ansible-roles")
+}
+
+func containerLibraryDir(containerWerfPath string) string {
+	return path.Join(containerWerfPath, "ansible-library")
+}
+
+func containerGalaxyDir(containerWerfPath string) string {
+	return path.Join(containerWerfPath, "ansible-galaxy")
+}
@@ -11,10 +11,10 @@ type Builder interface {
 	Install(container Container) error
 	BeforeSetup(container Container) error
 	Setup(container Container) error
-	BeforeInstallChecksum() string
-	InstallChecksum() string
-	BeforeSetupChecksum() string
-	SetupChecksum() string
+	BeforeInstallChecksum() (string, error)
+	InstallChecksum() (string, error)
+	BeforeSetupChecksum() (string, error)
+	SetupChecksum() (string, error)
 }
 
 type Container interface {
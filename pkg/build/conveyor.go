@@ -11,6 +11,8 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/cli/cli/command/image/build"
 	"github.com/docker/docker/pkg/fileutils"
@@ -28,6 +30,7 @@ import (
 	"github.com/flant/werf/pkg/images_manager"
 	"github.com/flant/werf/pkg/logging"
 	"github.com/flant/werf/pkg/path_matcher"
+	"github.com/flant/werf/pkg/platform"
 	"github.com/flant/werf/pkg/storage"
 	"github.com/flant/werf/pkg/tag_strategy"
 	"github.com/flant/werf/pkg/util"
@@ -44,6 +47,7 @@ type Conveyor struct {
 
 	baseImagesRepoIdsCache map[string]string
 	baseImagesRepoErrCache map[string]error
+	baseImagesMutex        sync.Mutex
 
 	sshAuthSock string
 
@@ -63,11 +67,32 @@ type Conveyor struct {
 	StagesStorageCache storage.StagesStorageCache
 	StorageLockManager storage.LockManager
 
-	onTerminateFuncs []func() error
-	importServers    map[string]import_server.ImportServer
+	onTerminateFuncs   []func() error
+	importServers      map[string]import_server.ImportServer
+	importServersMutex sync.Mutex
+
+	parallelTasksLimit int64
+
+	platform string
+
+	report *BuildReport
+
+	// mutex guards conveyor maps, which are shared between images processed in parallel
+	mutex sync.Mutex
 }
 
-func NewConveyor(werfConfig *config.WerfConfig, imageNamesToProcess []string, projectDir, baseTmpDir, sshAuthSock string) *Conveyor {
+type ConveyorOptions struct {
+	// StagesStorageCache defaults to the file cache in the werf local cache dir
+	StagesStorageCache storage.StagesStorageCache
+	// ParallelTasksLimit is the max number of images processed simultaneously, 0 or 1 means sequential processing
+	ParallelTasksLimit int64
+	// Platform is the target platform (OS/ARCH[/VARIANT]) of all images, empty means the docker daemon platform
+	Platform string
+	// Report collects stages and published images of the conveyor run, nil means no report
+	Report *BuildReport
+}
+
+func NewConveyor(werfConfig *config.WerfConfig, imageNamesToProcess []string, projectDir, baseTmpDir, sshAuthSock string, stagesStorage storage.StagesStorage, storageLockManager storage.LockManager, opts ConveyorOptions) *Conveyor {
 	c := &Conveyor{
 		werfConfig:          werfConfig,
 		imageNamesToProcess: imageNamesToProcess,
@@ -89,19 +114,37 @@ func NewConveyor(werfConfig *config.WerfConfig, imageNamesToProcess []string, pr
 		tmpDir:                          filepath.Join(baseTmpDir, string(util.GenerateConsistentRandomString(10))),
 		importServers:                   make(map[string]import_server.ImportServer),
 
-		StagesStorage:      &storage.LocalStagesStorage{},
-		StorageLockManager: &storage.FileLockManager{},
-		StagesStorageCache: storage.NewFileStagesStorageCache(filepath.Join(werf.GetLocalCacheDir(), "stages_storage")),
+		StagesStorage:      stagesStorage,
+		StorageLockManager: storageLockManager,
+		StagesStorageCache: opts.StagesStorageCache,
+
+		parallelTasksLimit: opts.ParallelTasksLimit,
+
+		platform: opts.Platform,
+
+		report: opts.Report,
+	}
+
+	if c.StagesStorageCache == nil {
+		c.StagesStorageCache = storage.NewFileStagesStorageCache(filepath.Join(werf.GetLocalCacheDir(), "stages_storage"))
 	}
 
 	return c
 }
 
 func (c *Conveyor) GetImportServer(imageName string) (import_server.ImportServer, error) {
+	c.importServersMutex.Lock()
+	defer c.importServersMutex.Unlock()
+
 	if srv, hasKey := c.importServers[imageName]; hasKey {
 		return srv, nil
 	}
 
+	// The import server is a docker container with the rsync daemon
+	if !image.IsDockerContainerRuntime() {
+		return nil, fmt.Errorf("imports are not supported by %s container runtime", image.GetContainerBackend().Name())
+	}
+
 	var srv *import_server.RsyncServer
 
 	if err := logboek.Info.LogProcess(fmt.Sprintf("Firing up import rsync server for image %s", imageName), logboek.LevelLogProcessOptions{}, func() error {
@@ -135,6 +178,9 @@ func (c *Conveyor) GetImportServer(imageName string) (import_server.ImportServer
 }
 
 func (c *Conveyor) AppendOnTerminateFunc(f func() error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	c.onTerminateFuncs = append(c.onTerminateFuncs, f)
 }
 
@@ -170,6 +216,9 @@ func (c *Conveyor) Terminate() error {
 }
 
 func (c *Conveyor) GetGitRepoCache(gitRepoName string) *stage.GitRepoCache {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	if _, hasKey := c.gitReposCaches[gitRepoName]; !hasKey {
 		c.gitReposCaches[gitRepoName] = &stage.GitRepoCache{
 			Archives:  make(map[string]git_repo.Archive),
@@ -193,6 +242,8 @@ type TagOptions struct {
 	TagsByGitTag         []string
 	TagsByGitBranch      []string
 	TagsByGitCommit      []string
+	TagsByTemplate       []string
+	TagBySemverGitTags   []string
 	TagByStagesSignature bool
 }
 
@@ -216,7 +267,7 @@ func (c *Conveyor) ShouldBeBuilt() error {
 	return c.runPhases(phases, false)
 }
 
-func (c *Conveyor) GetImageInfoGetters(configImages []*config.StapelImage, configImagesFromDockerfile []*config.ImageFromDockerfile, imagesRepoManager images_manager.ImagesRepoManager, commonTag string, tagStrategy tag_strategy.TagStrategy, withoutRegistry bool) []images_manager.ImageInfoGetter {
+func GetImageInfoGetters(configImages []*config.StapelImage, configImagesFromDockerfile []*config.ImageFromDockerfile, imagesRepoManager images_manager.ImagesRepoManager, commonTag string, tagStrategy tag_strategy.TagStrategy, stagesSignatures *ImagesStagesSignatures, withoutRegistry bool) ([]images_manager.ImageInfoGetter, error) {
 	var images []images_manager.ImageInfoGetter
 
 	var imagesNames []string
@@ -230,29 +281,33 @@ func (c *Conveyor) GetImageInfoGetters(configImages []*config.StapelImage, confi
 	for _, imageName := range imagesNames {
 		var tag string
 		if tagStrategy == tag_strategy.StagesSignature {
-			for _, img := range c.imagesInOrder {
-				if img.GetName() == imageName {
-					tag = img.GetStagesSignature()
-					break
-				}
+			imageTag, err := stagesSignatures.ImageTag(imageName)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get image %s tag: %s", logging.ImageLogName(imageName, false), err)
 			}
+
+			tag = imageTag
 		} else {
 			tag = commonTag
 		}
 
+		if tag == "" {
+			return nil, fmt.Errorf("unable to get image %s tag: empty tag by %s strategy", logging.ImageLogName(imageName, false), tagStrategy)
+		}
+
 		d := &images_manager.ImageInfo{Name: imageName, WithoutRegistry: withoutRegistry, ImagesRepoManager: imagesRepoManager, Tag: tag}
 		images = append(images, d)
 	}
 
-	return images
+	return images, nil
 }
 
-func (c *Conveyor) BuildStages(stageRepo string, opts BuildStagesOptions) error {
+func (c *Conveyor) BuildStages(opts BuildStagesOptions) error {
 	/*var phases []Phase
 	phases = append(phases, NewInitializationPhase())
 	phases = append(phases, NewSignaturesPhase())
 	phases = append(phases, NewPrepareStagesPhase())
-	phases = append(phases, NewBuildStagesPhase(stageRepo, opts))
+	phases = append(phases, NewBuildStagesPhase(opts))
 
 	if err := c.StorageLockManager.LockAllImagesReadOnly(c.projectName()); err != nil {
 		return fmt.Errorf("error locking all images read only: %s", err)
@@ -261,6 +316,10 @@ func (c *Conveyor) BuildStages(stageRepo string, opts BuildStagesOptions) error
 
 	return c.runPhases(phases)*/
 
+	if err := c.checkIntrospectionIsNotParallel(opts); err != nil {
+		return err
+	}
+
 	if err := c.determineStages(); err != nil {
 		return err
 	}
@@ -313,7 +372,11 @@ type BuildAndPublishOptions struct {
 	PublishImagesOptions
 }
 
-func (c *Conveyor) BuildAndPublish(stagesRepo string, imagesRepoManager ImagesRepoManager, opts BuildAndPublishOptions) error {
+func (c *Conveyor) BuildAndPublish(imagesRepoManager ImagesRepoManager, opts BuildAndPublishOptions) error {
+	if err := c.checkIntrospectionIsNotParallel(opts.BuildStagesOptions); err != nil {
+		return err
+	}
+
 	if err := c.determineStages(); err != nil {
 		return err
 	}
@@ -331,7 +394,7 @@ func (c *Conveyor) BuildAndPublish(stagesRepo string, imagesRepoManager ImagesRe
 		phases = append(phases, NewInitializationPhase())
 		phases = append(phases, NewSignaturesPhase())
 		phases = append(phases, NewPrepareStagesPhase())
-		phases = append(phases, NewBuildStagesPhase(stagesRepo, opts.BuildStagesOptions))
+		phases = append(phases, NewBuildStagesPhase(opts.BuildStagesOptions))
 		phases = append(phases, NewPublishImagesPhase(imagesRepoManager, opts.PublishImagesOptions))
 
 		if err := c.StorageLockManager.LockAllImagesReadOnly(c.projectName()); err != nil {
@@ -343,6 +406,18 @@ func (c *Conveyor) BuildAndPublish(stagesRepo string, imagesRepoManager ImagesRe
 	*/
 }
 
+func (c *Conveyor) checkIntrospectionIsNotParallel(opts BuildStagesOptions) error {
+	if c.parallelTasksLimit <= 1 {
+		return nil
+	}
+
+	if len(opts.IntrospectOptions.Targets) > 0 || opts.ImageBuildOptions.IntrospectBeforeError || opts.ImageBuildOptions.IntrospectAfterError {
+		return fmt.Errorf("stages introspection cannot be used when images are processed in parallel (parallel tasks limit %d)", c.parallelTasksLimit)
+	}
+
+	return nil
+}
+
 func (c *Conveyor) determineStages() error {
 	return logboek.Info.LogProcess(
 		"Determining of stages",
@@ -397,31 +472,6 @@ func (c *Conveyor) doDetermineStages() error {
 }
 
 func (c *Conveyor) runPhases(phases []Phase, logImages bool) error {
-	// TODO: Parallelize builds
-	//images (по зависимостям), dependantImagesByStage
-	//dependantImagesByStage строится в InitializationPhase, спросить у stage что она ждет.
-	//Количество воркеров-goroutine ограничено.
-	//Надо распределить images по воркерам.
-	//
-	//for img := range images {
-	//	Goroutine {
-	//		phases = append(phases, NewBuildStage())
-	//
-	//    	for phase = range phases {
-	//            phase.OnStart()
-	//
-	//	    	for stage = range stages {
-	//		    	for img = dependantImagesByStage[stage.name] {
-	//			    	wait <-imgChanMap[img]
-	//				}
-	//				phase.HandleStage(stage)
-	//    		}
-	//		}
-	//
-	//        close(imgChanMap[img])
-	//	} Goroutine
-	//}
-
 	var imagesLogger logboek.Level
 	if logImages {
 		imagesLogger = logboek.Default
@@ -439,52 +489,20 @@ func (c *Conveyor) runPhases(phases []Phase, logImages bool) error {
 		logboek.Debug.LogProcessEnd(logboek.LevelLogProcessEndOptions{})
 	}
 
-	for _, img := range c.imagesInOrder {
-		if err := imagesLogger.LogProcess(img.LogDetailedName(), logboek.LevelLogProcessOptions{Style: img.LogProcessStyle()}, func() error {
-			for _, phase := range phases {
-				logProcessMsg := fmt.Sprintf("Phase %s -- BeforeImageStages()", phase.Name())
-				logboek.Debug.LogProcessStart(logProcessMsg, logboek.LevelLogProcessStartOptions{})
-				if err := phase.BeforeImageStages(img); err != nil {
-					logboek.Debug.LogProcessFail(logboek.LevelLogProcessFailOptions{})
-					return fmt.Errorf("phase %s before image %s stages handler failed: %s", phase.Name(), img.GetLogName(), err)
-				}
-				logboek.Debug.LogProcessEnd(logboek.LevelLogProcessEndOptions{})
-
-				logProcessMsg = fmt.Sprintf("Phase %s -- OnImageStage()", phase.Name())
-				logboek.Debug.LogProcessStart(logProcessMsg, logboek.LevelLogProcessStartOptions{})
-				var newStages []stage.Interface
-				for _, stg := range img.GetStages() {
-					if keepStage, err := phase.OnImageStage(img, stg); err != nil {
-						logboek.Debug.LogProcessFail(logboek.LevelLogProcessFailOptions{})
-						return fmt.Errorf("phase %s on image %s stage %s handler failed: %s", phase.Name(), img.GetLogName(), stg.Name(), err)
-					} else if keepStage {
-						newStages = append(newStages, stg)
-					}
-				}
-				img.SetStages(newStages)
-				logboek.Debug.LogProcessEnd(logboek.LevelLogProcessEndOptions{})
-
-				logProcessMsg = fmt.Sprintf("Phase %s -- AfterImageStages()", phase.Name())
-				logboek.Debug.LogProcessStart(logProcessMsg, logboek.LevelLogProcessStartOptions{})
-				if err := phase.AfterImageStages(img); err != nil {
-					logboek.Debug.LogProcessFail(logboek.LevelLogProcessFailOptions{})
-					return fmt.Errorf("phase %s after image %s stages handler failed: %s", phase.Name(), img.GetLogName(), err)
-				}
-				logboek.Debug.LogProcessEnd(logboek.LevelLogProcessEndOptions{})
+	c.report.addImages(c.imagesInOrder, c.platform)
 
-				logProcessMsg = fmt.Sprintf("Phase %s -- ImageProcessingShouldBeStopped()", phase.Name())
-				logboek.Debug.LogProcessStart(logProcessMsg, logboek.LevelLogProcessStartOptions{})
-				if phase.ImageProcessingShouldBeStopped(img) {
-					logboek.Debug.LogProcessEnd(logboek.LevelLogProcessEndOptions{})
-					return nil
-				}
-				logboek.Debug.LogProcessEnd(logboek.LevelLogProcessEndOptions{})
-			}
-
-			return nil
-		}); err != nil {
+	if c.parallelTasksLimit > 1 && len(c.imagesInOrder) > 1 {
+		if err := c.runImagesPhasesInParallel(phases, imagesLogger); err != nil {
 			return err
 		}
+	} else {
+		for _, img := range c.imagesInOrder {
+			if err := imagesLogger.LogProcess(img.LogDetailedName(), logboek.LevelLogProcessOptions{Style: img.LogProcessStyle()}, func() error {
+				return c.runImagePhases(img, phases, nil)
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
 	for _, phase := range phases {
@@ -502,6 +520,195 @@ func (c *Conveyor) runPhases(phases []Phase, logImages bool) error {
 	return nil
 }
 
+func (c *Conveyor) runImagePhases(img *Image, phases []Phase, log *imageLog) error {
+	for _, phase := range phases {
+		logProcessMsg := fmt.Sprintf("Phase %s -- BeforeImageStages()", phase.Name())
+		log.LogProcessStart(logboek.Debug, logProcessMsg, logboek.LevelLogProcessStartOptions{})
+		if err := phase.BeforeImageStages(img); err != nil {
+			log.LogProcessFail(logboek.Debug, logboek.LevelLogProcessFailOptions{})
+			return fmt.Errorf("phase %s before image %s stages handler failed: %s", phase.Name(), img.GetLogName(), err)
+		}
+		log.LogProcessEnd(logboek.Debug, logboek.LevelLogProcessEndOptions{})
+
+		logProcessMsg = fmt.Sprintf("Phase %s -- OnImageStage()", phase.Name())
+		log.LogProcessStart(logboek.Debug, logProcessMsg, logboek.LevelLogProcessStartOptions{})
+		var newStages []stage.Interface
+		for _, stg := range img.GetStages() {
+			if keepStage, err := phase.OnImageStage(img, stg); err != nil {
+				log.LogProcessFail(logboek.Debug, logboek.LevelLogProcessFailOptions{})
+				return fmt.Errorf("phase %s on image %s stage %s handler failed: %s", phase.Name(), img.GetLogName(), stg.Name(), err)
+			} else if keepStage {
+				newStages = append(newStages, stg)
+			}
+		}
+		img.SetStages(newStages)
+		log.LogProcessEnd(logboek.Debug, logboek.LevelLogProcessEndOptions{})
+
+		logProcessMsg = fmt.Sprintf("Phase %s -- AfterImageStages()", phase.Name())
+		log.LogProcessStart(logboek.Debug, logProcessMsg, logboek.LevelLogProcessStartOptions{})
+		if err := phase.AfterImageStages(img); err != nil {
+			log.LogProcessFail(logboek.Debug, logboek.LevelLogProcessFailOptions{})
+			return fmt.Errorf("phase %s after image %s stages handler failed: %s", phase.Name(), img.GetLogName(), err)
+		}
+		log.LogProcessEnd(logboek.Debug, logboek.LevelLogProcessEndOptions{})
+
+		logProcessMsg = fmt.Sprintf("Phase %s -- ImageProcessingShouldBeStopped()", phase.Name())
+		log.LogProcessStart(logboek.Debug, logProcessMsg, logboek.LevelLogProcessStartOptions{})
+		if phase.ImageProcessingShouldBeStopped(img) {
+			log.LogProcessEnd(logboek.Debug, logboek.LevelLogProcessEndOptions{})
+			return nil
+		}
+		log.LogProcessEnd(logboek.Debug, logboek.LevelLogProcessEndOptions{})
+	}
+
+	return nil
+}
+
+type imagePhasesResult struct {
+	img      *Image
+	log      *imageLog
+	err      error
+	skipped  bool
+	duration time.Duration
+}
+
+// runImagesPhasesInParallel processes each image in a separate goroutine as soon as all images it depends on
+// (base image, base artifact and imports, see config.WerfConfig.ImageTree) are processed, no more than
+// parallelTasksLimit images at once.
+//
+// logboek state is global and cannot be split between goroutines, so the log is switched to the quiet level
+// while image goroutines are running. The phase clones record the log of each image into its own imageLog:
+// the progress line is printed when the image is done and the recorded logs are replayed in the images order,
+// as the images processed one by one are logged, after all goroutines are done.
+// The log of packages below the phases (git repos, stage builders) is not recorded.
+func (c *Conveyor) runImagesPhasesInParallel(phases []Phase, imagesLogger logboek.Level) error {
+	dependencies := c.getImagesDependencies()
+
+	doneByImage := make(map[string]chan struct{})
+	for _, img := range c.imagesInOrder {
+		doneByImage[img.GetName()] = make(chan struct{})
+	}
+
+	stopCh := make(chan struct{})
+	tasksCh := make(chan struct{}, c.parallelTasksLimit)
+	resultsCh := make(chan imagePhasesResult, len(c.imagesInOrder))
+
+	logEnabled := imagesLogger.IsAccepted()
+	logStream := imagesLogger.Stream()
+	savedLogLevel := currentLogLevel()
+	logboek.SetQuietLevel()
+
+	for _, img := range c.imagesInOrder {
+		log := newImageLog(savedLogLevel)
+		imgPhases := make([]Phase, len(phases))
+		for ind, phase := range phases {
+			imgPhases[ind] = phase.Clone(log)
+		}
+
+		go func(img *Image, imgPhases []Phase, log *imageLog) {
+			for _, dependencyName := range dependencies[img.GetName()] {
+				select {
+				case <-doneByImage[dependencyName]:
+				case <-stopCh:
+					resultsCh <- imagePhasesResult{img: img, skipped: true}
+					return
+				}
+			}
+
+			select {
+			case tasksCh <- struct{}{}:
+			case <-stopCh:
+				resultsCh <- imagePhasesResult{img: img, skipped: true}
+				return
+			}
+
+			startedAt := time.Now()
+			err := c.runImagePhases(img, imgPhases, log)
+			<-tasksCh
+
+			if err == nil {
+				close(doneByImage[img.GetName()])
+			}
+
+			resultsCh <- imagePhasesResult{img: img, log: log, err: err, duration: time.Since(startedAt)}
+		}(img, imgPhases, log)
+	}
+
+	resultByImage := make(map[string]imagePhasesResult)
+	var firstErr error
+	for range c.imagesInOrder {
+		res := <-resultsCh
+		resultByImage[res.img.GetName()] = res
+
+		if res.err != nil && firstErr == nil {
+			firstErr = res.err
+			close(stopCh)
+		}
+
+		// the failed image is reported regardless of the log level
+		if res.skipped || !logEnabled && res.err == nil {
+			continue
+		}
+
+		var status string
+		if res.err != nil {
+			status = logboek.StyleByName(logboek.FailStyleName).Colorize("(failed in %.2f seconds)", res.duration.Seconds())
+		} else {
+			status = logboek.DetailsStyle().Colorize("(%.2f seconds)", res.duration.Seconds())
+		}
+
+		_, _ = fmt.Fprintf(logStream, "%s %s\n", res.img.LogProcessStyle().Colorize("%s", res.img.LogDetailedName()), status)
+	}
+
+	logboek.SetLevel(savedLogLevel)
+
+	for _, img := range c.imagesInOrder {
+		res := resultByImage[img.GetName()]
+		if res.skipped {
+			continue
+		}
+
+		_ = imagesLogger.LogProcess(img.LogDetailedName(), logboek.LevelLogProcessOptions{Style: img.LogProcessStyle()}, func() error {
+			res.log.Replay()
+			return res.err
+		})
+	}
+
+	return firstErr
+}
+
+func (c *Conveyor) getImagesDependencies() map[string][]string {
+	dependencies := make(map[string][]string)
+
+	for _, img := range c.imagesInOrder {
+		var imageConfig config.ImageInterface
+		if img.isArtifact {
+			imageConfig = c.werfConfig.GetArtifact(img.GetName())
+		} else {
+			imageConfig = c.werfConfig.GetImage(img.GetName())
+		}
+
+		for _, relatedImageConfig := range c.werfConfig.ImageTree(imageConfig) {
+			if relatedImageConfig.GetName() != img.GetName() {
+				dependencies[img.GetName()] = append(dependencies[img.GetName()], relatedImageConfig.GetName())
+			}
+		}
+	}
+
+	return dependencies
+}
+
+func currentLogLevel() logboek.Level {
+	for _, level := range []logboek.Level{logboek.Debug, logboek.Info, logboek.Default, logboek.Warn, logboek.Error} {
+		if level.IsAccepted() {
+			return level
+		}
+	}
+
+	// logboek quiet level is not exported
+	return logboek.Error - 1
+}
+
 /*
 TODO: locks and log
 func (c *Conveyor) runPhases(phases []Phase) error {
@@ -519,23 +726,39 @@ func (c *Conveyor) runPhases(phases []Phase) error {
 }
 */
 
+func (c *Conveyor) GetPlatform() string {
+	return c.platform
+}
+
 func (c *Conveyor) projectName() string {
 	return c.werfConfig.Meta.Project
 }
 
 func (c *Conveyor) GetStageImage(name string) *image.StageImage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	return c.stageImages[name]
 }
 
 func (c *Conveyor) UnsetStageImage(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	delete(c.stageImages, name)
 }
 
 func (c *Conveyor) SetStageImage(stageImage *image.StageImage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	c.stageImages[stageImage.Name()] = stageImage
 }
 
 func (c *Conveyor) GetOrCreateStageImage(fromImage *image.StageImage, name string) *image.StageImage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	if img, ok := c.stageImages[name]; ok {
 		return img
 	}
@@ -548,10 +771,16 @@ func (c *Conveyor) GetOrCreateStageImage(fromImage *image.StageImage, name strin
 // imagesBySignature needed only for Build phase to detect that image object has already been prepared
 // with build instructions. Image should never be prepared multiple times.
 func (c *Conveyor) GetImageBySignature(signature string) image.ImageInterface {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	return c.imagesBySignature[signature]
 }
 
 func (c *Conveyor) SetImageBySignature(signature string, img image.ImageInterface) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	c.imagesBySignature[signature] = img
 }
 
@@ -578,10 +807,16 @@ func (c *Conveyor) GetImageLastStageImageID(imageName string) string {
 }
 
 func (c *Conveyor) SetBuildingGitStage(imageName string, stageName stage.StageName) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	c.buildingGitStageNameByImageName[imageName] = stageName
 }
 
 func (c *Conveyor) GetBuildingGitStage(imageName string) stage.StageName {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	stageName, ok := c.buildingGitStageNameByImageName[imageName]
 	if !ok {
 		return ""
@@ -627,7 +862,7 @@ func handleImageFromName(from string, fromLatest bool, image *Image, c *Conveyor
 	image.baseImageName = from
 
 	if fromLatest {
-		if _, err := image.getFromBaseImageIdFromRegistry(c, image.baseImageName); err != nil {
+		if _, err := image.getFromBaseImageIdFromRegistry(c, nil, image.baseImageName); err != nil {
 			return err
 		}
 	}
@@ -688,7 +923,20 @@ func getImageConfigsToProcess(c *Conveyor) []config.ImageInterface {
 		}
 	}
 
-	return imageConfigsToProcess
+	if c.platform == "" {
+		return imageConfigsToProcess
+	}
+
+	var platformImageConfigs []config.ImageInterface
+	for _, imageConfig := range imageConfigsToProcess {
+		if platform.Contains(imageConfig.GetPlatforms(), c.platform) {
+			platformImageConfigs = append(platformImageConfigs, imageConfig)
+		} else {
+			logboek.Info.LogLnDetails(fmt.Sprintf("Image %s is skipped for platform %s", logging.ImageLogName(imageConfig.GetName(), false), c.platform))
+		}
+	}
+
+	return platformImageConfigs
 }
 
 func isNotInArr(arr []config.ImageInterface, obj config.ImageInterface) bool {
@@ -714,6 +962,8 @@ func initStages(image *Image, imageInterfaceConfig config.StapelImageInterface,
 		ImageTmpDir:      c.GetImageTmpDir(imageBaseConfig.Name),
 		ContainerWerfDir: c.containerWerfDir,
 		ProjectName:      c.werfConfig.Meta.Project,
+		ProjectDir:       c.projectDir,
+		Platform:         c.platform,
 	}
 
 	gitArchiveStageOptions := &stage.NewGitArchiveStageOptions{
@@ -816,6 +1066,8 @@ func generateGitMappings(imageBaseConfig *config.StapelImageBase, c *Conveyor) (
 			c.remoteGitRepos[remoteGitMappingConfig.Name] = remoteGitRepo
 		}
 
+		remoteGitRepo.Paths = append(remoteGitRepo.Paths, remoteGitMappingConfig.GitMappingAdd())
+
 		gitMappings = append(gitMappings, gitRemoteArtifactInit(remoteGitMappingConfig, remoteGitRepo, imageBaseConfig.Name, c))
 	}
 
@@ -971,6 +1223,7 @@ func baseGitMappingInit(local *config.GitLocalExport, imageName string, c *Conve
 		Owner:              local.Owner,
 		Group:              local.Group,
 		StagesDependencies: stageDependencies,
+		LFS:                local.LFS,
 	}
 
 	return gitMapping
@@ -1104,6 +1357,8 @@ func prepareImageBasedOnImageFromDockerfile(imageFromDockerfileConfig *config.Im
 		return nil, err
 	}
 
+	removeDockerfileRunMountFlags(p.AST)
+
 	dockerStages, dockerMetaArgs, err := instructions.Parse(p.AST)
 	if err != nil {
 		return nil, err
@@ -1148,6 +1403,11 @@ func prepareImageBasedOnImageFromDockerfile(imageFromDockerfileConfig *config.Im
 		ProjectName: c.werfConfig.Meta.Project,
 	}
 
+	secrets, err := resolveDockerfileSecretsPaths(imageFromDockerfileConfig.Secrets, c.projectDir)
+	if err != nil {
+		return nil, err
+	}
+
 	dockerfileStage := stage.GenerateDockerfileStage(
 		stage.NewDockerRunArgs(
 			dockerfilePath,
@@ -1155,6 +1415,12 @@ func prepareImageBasedOnImageFromDockerfile(imageFromDockerfileConfig *config.Im
 			contextDir,
 			imageFromDockerfileConfig.Args,
 			imageFromDockerfileConfig.AddHost,
+			resolveDockerfileSSHPaths(imageFromDockerfileConfig.SSH, c.projectDir),
+			secrets,
+			imageFromDockerfileConfig.Network,
+			imageFromDockerfileConfig.CacheFrom,
+			imageFromDockerfileConfig.Labels,
+			c.platform,
 		),
 		stage.NewDockerStages(dockerStages, dockerArgsHash, dockerTargetIndex),
 		stage.NewContextChecksum(c.projectDir, dockerignorePathMatcher, localGitRepo),
@@ -1168,6 +1434,84 @@ func prepareImageBasedOnImageFromDockerfile(imageFromDockerfileConfig *config.Im
 	return img, nil
 }
 
+// removeDockerfileRunMountFlags removes RUN --mount flags (BuildKit experimental syntax, which is used by ssh and secrets),
+// the vendored dockerfile instructions parser does not support them.
+// The original instruction line, mount flags included, is still the part of the stage signature
+func removeDockerfileRunMountFlags(node *parser.Node) {
+	for _, child := range node.Children {
+		if child.Value != "run" {
+			continue
+		}
+
+		var flags []string
+		for _, flag := range child.Flags {
+			if !strings.HasPrefix(flag, "--mount=") {
+				flags = append(flags, flag)
+			}
+		}
+		child.Flags = flags
+	}
+}
+
+// resolveDockerfileSecretsPaths makes src paths of the secrets (id=ID,src=PATH) relative to the project directory absolute
+func resolveDockerfileSecretsPaths(secrets []string, projectDir string) ([]string, error) {
+	var result []string
+	for _, secret := range secrets {
+		var fields []string
+		for _, field := range strings.Split(secret, ",") {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) == 2 && (parts[0] == "src" || parts[0] == "source") {
+				path := resolveProjectPath(parts[1], projectDir)
+
+				if exist, err := util.FileExists(path); err != nil {
+					return nil, err
+				} else if !exist {
+					return nil, fmt.Errorf("secret file %s is not found", path)
+				}
+
+				field = fmt.Sprintf("%s=%s", parts[0], path)
+			}
+
+			fields = append(fields, field)
+		}
+
+		result = append(result, strings.Join(fields, ","))
+	}
+
+	return result, nil
+}
+
+// resolveDockerfileSSHPaths makes key paths of the ssh option (default|ID[=SOCKET|KEY[,KEY]]) relative to the project directory absolute
+func resolveDockerfileSSHPaths(sshList []string, projectDir string) []string {
+	var result []string
+	for _, ssh := range sshList {
+		parts := strings.SplitN(ssh, "=", 2)
+		if len(parts) != 2 {
+			result = append(result, ssh)
+			continue
+		}
+
+		var paths []string
+		for _, path := range strings.Split(parts[1], ",") {
+			paths = append(paths, resolveProjectPath(path, projectDir))
+		}
+
+		result = append(result, fmt.Sprintf("%s=%s", parts[0], strings.Join(paths, ",")))
+	}
+
+	return result
+}
+
+func resolveProjectPath(path, projectDir string) string {
+	if strings.HasPrefix(path, "~") {
+		return util.ExpandPath(path)
+	} else if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(projectDir, path)
+}
+
 func resolveDockerStagesFromValue(stages []instructions.Stage) {
 	nameToIndex := make(map[string]string)
 	for i, s := range stages {
@@ -117,7 +117,7 @@ func (i *Image) GetBaseImage() *image.StageImage {
 	return i.baseImage
 }
 
-func (i *Image) PrepareBaseImage(c *Conveyor) error {
+func (i *Image) PrepareBaseImage(c *Conveyor, log *imageLog) error {
 	fromImage := i.stages[0].GetImage()
 
 	if fromImage.IsExists() {
@@ -129,12 +129,12 @@ func (i *Image) PrepareBaseImage(c *Conveyor) error {
 	}
 
 	if i.baseImage.IsExists() {
-		baseImageRepoId, err := i.getFromBaseImageIdFromRegistry(c, i.baseImage.Name())
+		baseImageRepoId, err := i.getFromBaseImageIdFromRegistry(c, log, i.baseImage.Name())
 		if baseImageRepoId == i.baseImage.ID() || err != nil {
 			if err != nil {
-				logboek.LogWarnF("WARNING: cannot get base image id (%s): %s\n", i.baseImage.Name(), err)
-				logboek.LogWarnF("WARNING: using existing image %s without pull\n", i.baseImage.Name())
-				logboek.Warn.LogOptionalLn()
+				log.LogWarnF("WARNING: cannot get base image id (%s): %s\n", i.baseImage.Name(), err)
+				log.LogWarnF("WARNING: using existing image %s without pull\n", i.baseImage.Name())
+				log.LogOptionalLn(logboek.Warn)
 			}
 
 			return nil
@@ -142,8 +142,8 @@ func (i *Image) PrepareBaseImage(c *Conveyor) error {
 	}
 
 	logProcessOptions := logboek.LevelLogProcessOptions{Style: logboek.HighlightStyle()}
-	return logboek.Default.LogProcess("Pulling base image", logProcessOptions, func() error {
-		if err := i.baseImage.Pull(); err != nil {
+	return log.LogProcess(logboek.Default, "Pulling base image", logProcessOptions, func() error {
+		if err := i.baseImage.PullForPlatform(c.platform); err != nil {
 			return err
 		}
 
@@ -155,7 +155,7 @@ func (i *Image) PrepareBaseImage(c *Conveyor) error {
 	})
 }
 
-func (i *Image) getFromBaseImageIdFromRegistry(c *Conveyor, baseImageName string) (string, error) {
+func (i *Image) getFromBaseImageIdFromRegistry(c *Conveyor, log *imageLog, baseImageName string) (string, error) {
 	if i.baseImageRepoId != "" {
 		return i.baseImageRepoId, nil
 	} else if cachedBaseImageRepoId, exist := c.baseImagesRepoIdsCache[baseImageName]; exist {
@@ -167,9 +167,9 @@ func (i *Image) getFromBaseImageIdFromRegistry(c *Conveyor, baseImageName string
 
 	var fetchedBaseImageRepoId string
 	processMsg := fmt.Sprintf("Trying to get from base image id from registry (%s)", baseImageName)
-	if err := logboek.Info.LogProcessInline(processMsg, logboek.LevelLogProcessInlineOptions{}, func() error {
+	if err := log.LogProcessInline(logboek.Info, processMsg, logboek.LevelLogProcessInlineOptions{}, func() error {
 		var fetchImageIdErr error
-		fetchedBaseImageRepoId, fetchImageIdErr = docker_registry.ImageId(baseImageName)
+		fetchedBaseImageRepoId, fetchImageIdErr = docker_registry.PlatformImageId(baseImageName, c.platform)
 		if fetchImageIdErr != nil {
 			c.baseImagesRepoErrCache[baseImageName] = fetchImageIdErr
 			return fmt.Errorf("can not get base image id from registry (%s): %s", baseImageName, fetchImageIdErr)
@@ -0,0 +1,274 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/flant/logboek"
+)
+
+// imageLog records the log of the image processed in parallel with other images.
+//
+// logboek state (level, streams, indent, tag and process borders) is global and cannot be shared by goroutines,
+// so that the image goroutine records the log entries and the entries are replayed into logboek in the images order
+// after all image goroutines are done (see Conveyor.runImagesPhasesInParallel).
+// The nil imageLog logs directly into logboek as the images processed one by one do.
+type imageLog struct {
+	level logboek.Level
+
+	mutex   sync.Mutex
+	entries []func()
+}
+
+func newImageLog(level logboek.Level) *imageLog {
+	return &imageLog{level: level}
+}
+
+func (l *imageLog) IsAccepted(level logboek.Level) bool {
+	if l == nil {
+		return level.IsAccepted()
+	}
+
+	return level <= l.level
+}
+
+func (l *imageLog) LogF(level logboek.Level, format string, a ...interface{}) {
+	if l == nil {
+		level.LogF(format, a...)
+		return
+	}
+
+	if l.IsAccepted(level) {
+		msg := formatImageLogMsg(format, a...)
+		l.add(func() { level.LogF("%s", msg) })
+	}
+}
+
+func (l *imageLog) LogFDetails(level logboek.Level, format string, a ...interface{}) {
+	if l == nil {
+		level.LogFDetails(format, a...)
+		return
+	}
+
+	if l.IsAccepted(level) {
+		msg := formatImageLogMsg(format, a...)
+		l.add(func() { level.LogFDetails("%s", msg) })
+	}
+}
+
+func (l *imageLog) LogFHighlight(level logboek.Level, format string, a ...interface{}) {
+	if l == nil {
+		level.LogFHighlight(format, a...)
+		return
+	}
+
+	if l.IsAccepted(level) {
+		msg := formatImageLogMsg(format, a...)
+		l.add(func() { level.LogFHighlight("%s", msg) })
+	}
+}
+
+func (l *imageLog) LogWarnF(format string, a ...interface{}) {
+	if l == nil {
+		logboek.LogWarnF(format, a...)
+		return
+	}
+
+	if l.IsAccepted(logboek.Warn) {
+		msg := formatImageLogMsg(format, a...)
+		l.add(func() { logboek.LogWarnF("%s", msg) })
+	}
+}
+
+func (l *imageLog) LogOptionalLn(level logboek.Level) {
+	if l == nil {
+		level.LogOptionalLn()
+		return
+	}
+
+	l.add(level.LogOptionalLn)
+}
+
+func (l *imageLog) LogProcess(level logboek.Level, msg string, options logboek.LevelLogProcessOptions, f func() error) error {
+	if l == nil {
+		return level.LogProcess(msg, options, f)
+	}
+
+	entries, err := l.record(f)
+	l.add(func() {
+		_ = level.LogProcess(msg, options, func() error {
+			replayImageLogEntries(entries)
+			return err
+		})
+	})
+
+	return err
+}
+
+func (l *imageLog) LogProcessInline(level logboek.Level, msg string, options logboek.LevelLogProcessInlineOptions, f func() error) error {
+	if l == nil {
+		return level.LogProcessInline(msg, options, f)
+	}
+
+	entries, err := l.record(f)
+	l.add(func() {
+		_ = level.LogProcessInline(msg, options, func() error {
+			replayImageLogEntries(entries)
+			return err
+		})
+	})
+
+	return err
+}
+
+func (l *imageLog) LogBlock(level logboek.Level, msg string, options logboek.LevelLogBlockOptions, f func() error) error {
+	if l == nil {
+		return level.LogBlock(msg, options, f)
+	}
+
+	entries, err := l.record(f)
+	l.add(func() {
+		_ = level.LogBlock(msg, options, func() error {
+			replayImageLogEntries(entries)
+			return err
+		})
+	})
+
+	return err
+}
+
+func (l *imageLog) LogProcessStart(level logboek.Level, msg string, options logboek.LevelLogProcessStartOptions) {
+	if l == nil {
+		level.LogProcessStart(msg, options)
+		return
+	}
+
+	if l.IsAccepted(level) {
+		l.add(func() { level.LogProcessStart(msg, options) })
+	}
+}
+
+func (l *imageLog) LogProcessEnd(level logboek.Level, options logboek.LevelLogProcessEndOptions) {
+	if l == nil {
+		level.LogProcessEnd(options)
+		return
+	}
+
+	if l.IsAccepted(level) {
+		l.add(func() { level.LogProcessEnd(options) })
+	}
+}
+
+func (l *imageLog) LogProcessFail(level logboek.Level, options logboek.LevelLogProcessFailOptions) {
+	if l == nil {
+		level.LogProcessFail(options)
+		return
+	}
+
+	if l.IsAccepted(level) {
+		l.add(func() { level.LogProcessFail(options) })
+	}
+}
+
+func (l *imageLog) WithIndent(f func() error) error {
+	if l == nil {
+		return logboek.WithIndent(f)
+	}
+
+	entries, err := l.record(f)
+	l.add(func() {
+		_ = logboek.WithIndent(func() error {
+			replayImageLogEntries(entries)
+			return nil
+		})
+	})
+
+	return err
+}
+
+func (l *imageLog) WithTag(value string, style *logboek.Style, f func() error) error {
+	if l == nil {
+		return logboek.WithTag(value, style, f)
+	}
+
+	entries, err := l.record(f)
+	l.add(func() {
+		_ = logboek.WithTag(value, style, func() error {
+			replayImageLogEntries(entries)
+			return nil
+		})
+	})
+
+	return err
+}
+
+// OutStream and ErrStream record the output of the image containers and builds,
+// the output is written by docker cli goroutines
+func (l *imageLog) OutStream() io.Writer {
+	return imageLogStream{log: l, stream: logboek.GetOutStream}
+}
+
+func (l *imageLog) ErrStream() io.Writer {
+	return imageLogStream{log: l, stream: logboek.GetErrStream}
+}
+
+// Replay logs the recorded entries into logboek, it should not be called while image goroutines are running
+func (l *imageLog) Replay() {
+	l.mutex.Lock()
+	entries := l.entries
+	l.mutex.Unlock()
+
+	replayImageLogEntries(entries)
+}
+
+func (l *imageLog) add(entry func()) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = append(l.entries, entry)
+}
+
+// record runs f and returns the entries logged by f, which are replayed inside the process, the block or the indent
+func (l *imageLog) record(f func() error) ([]func(), error) {
+	l.mutex.Lock()
+	savedEntries := l.entries
+	l.entries = nil
+	l.mutex.Unlock()
+
+	err := f()
+
+	l.mutex.Lock()
+	entries := l.entries
+	l.entries = savedEntries
+	l.mutex.Unlock()
+
+	return entries, err
+}
+
+// formatImageLogMsg formats the message as logboek does: the format without arguments is logged as is
+func formatImageLogMsg(format string, a ...interface{}) string {
+	if len(a) == 0 {
+		return format
+	}
+
+	return fmt.Sprintf(format, a...)
+}
+
+func replayImageLogEntries(entries []func()) {
+	for _, entry := range entries {
+		entry()
+	}
+}
+
+type imageLogStream struct {
+	log    *imageLog
+	stream func() io.Writer
+}
+
+func (s imageLogStream) Write(p []byte) (int, error) {
+	data := append([]byte{}, p...)
+	s.log.add(func() { _, _ = s.stream().Write(data) })
+
+	return len(p), nil
+}
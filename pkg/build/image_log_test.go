@@ -0,0 +1,79 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/flant/logboek"
+)
+
+func TestImageLog_Replay(t *testing.T) {
+	logFunc := func(log *imageLog) error {
+		log.LogFHighlight(logboek.Default, "Use cache image for %s\n", "stage")
+		log.LogF(logboek.Info, "Skipped on default level\n")
+
+		return log.LogProcess(logboek.Default, "Building stage", logboek.LevelLogProcessOptions{WithoutElapsedTime: true}, func() error {
+			_ = log.WithIndent(func() error {
+				log.LogFDetails(logboek.Default, "image: %s\n", "image")
+				return nil
+			})
+			log.LogF(logboek.Default, "%d%%\n", 100)
+
+			return fmt.Errorf("build failed")
+		})
+	}
+
+	var directErr, recordedErr error
+	direct := captureDefaultLog(func() { directErr = logFunc(nil) })
+
+	log := newImageLog(logboek.Default)
+	if recorded := captureDefaultLog(func() { recordedErr = logFunc(log) }); recorded != "" {
+		t.Errorf("recorded log should not be written:\n%s", recorded)
+	}
+
+	if fmt.Sprintf("%v", recordedErr) != fmt.Sprintf("%v", directErr) {
+		t.Errorf("error:\n[EXPECTED]: %v\n[GOT]: %v", directErr, recordedErr)
+	}
+
+	if replayed := captureDefaultLog(log.Replay); replayed != direct {
+		t.Errorf("replayed log:\n[EXPECTED]:\n%s\n[GOT]:\n%s", direct, replayed)
+	}
+}
+
+func TestImageLog_OutStream(t *testing.T) {
+	log := newImageLog(logboek.Default)
+
+	var wg sync.WaitGroup
+	_ = log.LogProcess(logboek.Default, "Building stage", logboek.LevelLogProcessOptions{WithoutElapsedTime: true}, func() error {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = log.OutStream().Write([]byte("output\n"))
+			}()
+		}
+		wg.Wait()
+
+		return nil
+	})
+
+	if entries := len(log.entries); entries != 1 {
+		t.Errorf("the output should be recorded into the process:\n[EXPECTED]: %d\n[GOT]: %d", 1, entries)
+	}
+}
+
+func captureDefaultLog(f func()) string {
+	var buf bytes.Buffer
+
+	// reset the optional line break left by the previous process
+	_ = logboek.WithIndent(func() error { return nil })
+
+	logboek.Default.SetStream(&buf)
+	defer logboek.Default.ResetStream()
+
+	f()
+
+	return buf.String()
+}
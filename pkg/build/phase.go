@@ -1,6 +1,8 @@
 package build
 
-import "github.com/flant/werf/pkg/build/stage"
+import (
+	"github.com/flant/werf/pkg/build/stage"
+)
 
 type Phase interface {
 	Name() string
@@ -10,8 +12,13 @@ type Phase interface {
 	OnImageStage(img *Image, stg stage.Interface) (bool, error)
 	AfterImageStages(img *Image) error
 	ImageProcessingShouldBeStopped(img *Image) bool
+	// Clone returns the phase instance to process a single image when images are processed in parallel,
+	// the instance records the image log into the log
+	Clone(log *imageLog) Phase
 }
 
 type BasePhase struct {
 	Conveyor *Conveyor
+	// log is set for the phase instance processing a single image in parallel with other images
+	log *imageLog
 }
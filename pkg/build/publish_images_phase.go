@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Masterminds/semver"
+
 	"github.com/flant/logboek"
 
 	"github.com/flant/werf/pkg/build/stage"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/platform"
 	"github.com/flant/werf/pkg/tag_strategy"
 	"github.com/flant/werf/pkg/util"
 )
@@ -19,12 +22,14 @@ func NewPublishImagesPhase(c *Conveyor, imagesRepoManager ImagesRepoManager, opt
 		tag_strategy.GitBranch: opts.TagsByGitBranch,
 		tag_strategy.GitTag:    opts.TagsByGitTag,
 		tag_strategy.GitCommit: opts.TagsByGitCommit,
+		tag_strategy.Template:  opts.TagsByTemplate,
 	}
 	return &PublishImagesPhase{
-		BasePhase:            BasePhase{c},
+		BasePhase:            BasePhase{Conveyor: c},
 		ImagesToPublish:      opts.ImagesToPublish,
 		TagsByScheme:         tagsByScheme,
 		TagByStagesSignature: opts.TagByStagesSignature,
+		SemverGitTags:        opts.TagBySemverGitTags,
 		ImageRepoManager:     imagesRepoManager,
 	}
 }
@@ -34,6 +39,7 @@ type PublishImagesPhase struct {
 	ImagesToPublish      []string
 	TagsByScheme         map[tag_strategy.TagStrategy][]string
 	TagByStagesSignature bool
+	SemverGitTags        []string
 	ImageRepoManager     ImagesRepoManager
 }
 
@@ -41,6 +47,12 @@ func (phase *PublishImagesPhase) Name() string {
 	return "publish"
 }
 
+func (phase *PublishImagesPhase) Clone(log *imageLog) Phase {
+	clone := *phase
+	clone.log = log
+	return &clone
+}
+
 func (phase *PublishImagesPhase) BeforeImages() error {
 	return nil
 }
@@ -204,12 +216,13 @@ func (phase *PublishImagesPhase) publishImage(img *Image) error {
 	for _, strategy := range nonEmptySchemeInOrder {
 		imageMetaTags := phase.TagsByScheme[strategy]
 
-		if err := logboek.Info.LogProcess(
+		if err := phase.log.LogProcess(
+			logboek.Info,
 			fmt.Sprintf("%s tagging strategy", string(strategy)),
 			logboek.LevelLogProcessOptions{Style: logboek.HighlightStyle()},
 			func() error {
 				for _, imageMetaTag := range imageMetaTags {
-					if err := phase.publishImageByTag(img, imageMetaTag, strategy, existingTags); err != nil {
+					if err := phase.publishImageByTag(img, imageMetaTag, strategy, existingTags, publishImageByTagOptions{}); err != nil {
 						return fmt.Errorf("error publishing image %s by tag %s: %s", img.GetName(), imageMetaTag, err)
 					}
 				}
@@ -222,12 +235,13 @@ func (phase *PublishImagesPhase) publishImage(img *Image) error {
 	}
 
 	if phase.TagByStagesSignature {
-		if err := logboek.Info.LogProcess(
+		if err := phase.log.LogProcess(
+			logboek.Info,
 			fmt.Sprintf("%s tagging strategy", tag_strategy.StagesSignature),
 			logboek.LevelLogProcessOptions{Style: logboek.HighlightStyle()},
 			func() error {
 
-				if err := phase.publishImageByTag(img, img.GetStagesSignature(), tag_strategy.StagesSignature, existingTags); err != nil {
+				if err := phase.publishImageByTag(img, img.GetStagesSignature(), tag_strategy.StagesSignature, existingTags, publishImageByTagOptions{}); err != nil {
 					return fmt.Errorf("error publishing image %s by image signature %s: %s", img.GetName(), img.GetStagesSignature(), err)
 				}
 
@@ -238,25 +252,89 @@ func (phase *PublishImagesPhase) publishImage(img *Image) error {
 		}
 	}
 
+	if len(phase.SemverGitTags) > 0 {
+		if err := phase.log.LogProcess(
+			logboek.Info,
+			fmt.Sprintf("%s tagging strategy", tag_strategy.Semver),
+			logboek.LevelLogProcessOptions{Style: logboek.HighlightStyle()},
+			func() error {
+				for _, gitTag := range phase.SemverGitTags {
+					if err := phase.publishImageBySemverGitTag(img, gitTag, existingTags); err != nil {
+						return fmt.Errorf("error publishing image %s by semver git tag %s: %s", img.GetName(), gitTag, err)
+					}
+				}
+
+				return nil
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (phase *PublishImagesPhase) publishImageBySemverGitTag(img *Image, gitTag string, existingTags []string) error {
+	version, err := tag_strategy.ParseSemverGitTag(gitTag)
+	if err != nil {
+		return err
+	}
+
+	for _, imageMetaTag := range tag_strategy.SemverTags(version) {
+		if err := phase.publishImageByTag(img, imageMetaTag, tag_strategy.Semver, existingTags, publishImageByTagOptions{
+			SemverVersion: version,
+			ExtraLabels: map[string]string{
+				image.WerfTagSemverLabel:       tag_strategy.SemverFullTag(version),
+				image.WerfTagSemverGitTagLabel: gitTag,
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (phase *PublishImagesPhase) fetchExistingTags(imageRepository string) (existingTags []string, err error) {
 	logProcessMsg := fmt.Sprintf("Fetching existing repo tags")
-	_ = logboek.Info.LogProcessInline(logProcessMsg, logboek.LevelLogProcessInlineOptions{}, func() error {
+	_ = phase.log.LogProcessInline(logboek.Info, logProcessMsg, logboek.LevelLogProcessInlineOptions{}, func() error {
 		existingTags, err = docker_registry.Tags(imageRepository)
 		return nil
 	})
-	logboek.Info.LogOptionalLn()
+	phase.log.LogOptionalLn(logboek.Info)
 
 	return existingTags, err
 }
 
-func (phase *PublishImagesPhase) publishImageByTag(img *Image, imageMetaTag string, tagStrategy tag_strategy.TagStrategy, initialExistingTagsList []string) error {
+type publishImageByTagOptions struct {
+	ExtraLabels map[string]string
+
+	// SemverVersion prevents moving the existing tag, which is published by the newer version, to the older one
+	SemverVersion *semver.Version
+}
+
+func (phase *PublishImagesPhase) publishImageByTag(img *Image, imageMetaTag string, tagStrategy tag_strategy.TagStrategy, initialExistingTagsList []string, opts publishImageByTagOptions) error {
 	imageRepository := phase.ImageRepoManager.ImageRepo(img.GetName())
 	lastStageImage := img.GetLastNonEmptyStage().GetImage()
-	imageName := phase.ImageRepoManager.ImageRepoWithTag(img.GetName(), imageMetaTag)
-	imageTag := phase.ImageRepoManager.ImageRepoTag(img.GetName(), imageMetaTag)
+
+	// the image of the platform is published by the platform tag and then added to the manifest list by the meta tag,
+	// stages signature is different for each platform, so that the manifest list for the stages-signature strategy
+	// is published by the multi-platform stages signature after all platforms (ImagesStagesSignatures.PublishManifestLists)
+	var manifestListName string
+	repoMetaTag := imageMetaTag
+	if phase.Conveyor.platform != "" && tagStrategy != tag_strategy.StagesSignature {
+		manifestListName = phase.ImageRepoManager.ImageRepoWithTag(img.GetName(), imageMetaTag)
+		repoMetaTag = platform.ImageMetaTag(imageMetaTag, phase.Conveyor.platform)
+	}
+
+	imageName := phase.ImageRepoManager.ImageRepoWithTag(img.GetName(), repoMetaTag)
+	imageTag := phase.ImageRepoManager.ImageRepoTag(img.GetName(), repoMetaTag)
+
+	if isNewer, err := phase.checkTagIsPublishedByNewerSemver(initialExistingTagsList, imageName, imageTag, opts.SemverVersion); err != nil {
+		return err
+	} else if isNewer {
+		return nil
+	}
 
 	alreadyExists, err := phase.checkImageAlreadyExists(initialExistingTagsList, imageName, imageTag, lastStageImage)
 	if err != nil {
@@ -264,17 +342,21 @@ func (phase *PublishImagesPhase) publishImageByTag(img *Image, imageMetaTag stri
 	}
 
 	if alreadyExists {
-		logboek.Default.LogFHighlight("%s tag %s is up-to-date\n", strings.Title(string(tagStrategy)), imageTag)
+		phase.log.LogFHighlight(logboek.Default, "%s tag %s is up-to-date\n", strings.Title(string(tagStrategy)), imageTag)
 
-		_ = logboek.WithIndent(func() error {
-			logboek.Default.LogFDetails("images-repo: %s\n", imageRepository)
-			logboek.Default.LogFDetails("      image: %s\n", imageName)
-			return nil
-		})
+		if phase.log.IsAccepted(logboek.Default) {
+			_ = phase.log.WithIndent(func() error {
+				phase.log.LogFDetails(logboek.Default, "images-repo: %s\n", imageRepository)
+				phase.log.LogFDetails(logboek.Default, "      image: %s\n", imageName)
+				return nil
+			})
+		}
 
-		logboek.LogOptionalLn()
+		phase.log.LogOptionalLn(logboek.Default)
 
-		return nil
+		phase.Conveyor.report.addImageTag(img, phase.Conveyor.platform, imageName)
+
+		return phase.publishManifestList(img, manifestListName, imageName)
 	}
 
 	publishImage := image.NewImage(phase.Conveyor.GetStageImage(lastStageImage.Name()), imageName)
@@ -286,6 +368,12 @@ func (phase *PublishImagesPhase) publishImageByTag(img *Image, imageMetaTag stri
 		image.WerfImageNameLabel:   img.GetName(),
 		image.WerfImageTagLabel:    imageMetaTag,
 	})
+	if phase.Conveyor.platform != "" {
+		publishImage.Container().ServiceCommitChangeOptions().AddLabel(map[string]string{image.WerfPlatformLabel: phase.Conveyor.platform})
+	}
+	if len(opts.ExtraLabels) > 0 {
+		publishImage.Container().ServiceCommitChangeOptions().AddLabel(opts.ExtraLabels)
+	}
 
 	successInfoSectionFunc := func() {
 		_ = logboek.WithIndent(func() error {
@@ -295,8 +383,9 @@ func (phase *PublishImagesPhase) publishImageByTag(img *Image, imageMetaTag stri
 		})
 	}
 
+	var isPublishedByNewerSemver bool
 	publishingFunc := func() error {
-		if err := logboek.Info.LogProcess("Building final image with meta information", logboek.LevelLogProcessOptions{}, func() error {
+		if err := phase.log.LogProcess(logboek.Info, "Building final image with meta information", logboek.LevelLogProcessOptions{}, func() error {
 			if err := publishImage.Build(image.BuildOptions{}); err != nil {
 				return fmt.Errorf("error building %s with tagging strategy '%s': %s", imageName, tagStrategy, err)
 			}
@@ -317,22 +406,32 @@ func (phase *PublishImagesPhase) publishImageByTag(img *Image, imageMetaTag stri
 			return fmt.Errorf("error fetching existing tags from image repository %s: %s", phase.ImageRepoManager.ImageRepo(img.GetName()), err)
 		}
 
+		if isNewer, err := phase.checkTagIsPublishedByNewerSemver(existingTags, imageName, imageTag, opts.SemverVersion); err != nil {
+			return err
+		} else if isNewer {
+			isPublishedByNewerSemver = true
+			return nil
+		}
+
 		alreadyExists, err := phase.checkImageAlreadyExists(existingTags, imageName, imageTag, lastStageImage)
 		if err != nil {
 			return fmt.Errorf("error checking image %s already exists in the images repo: %s", img.GetName(), err)
 		}
 
 		if alreadyExists {
-			logboek.Default.LogFHighlight("%s tag %s is up-to-date\n", strings.Title(string(tagStrategy)), imageTag)
-			_ = logboek.WithIndent(func() error {
-				logboek.Info.LogFDetails("discarding newly built image %s\n", publishImage.MustGetBuiltId())
-				logboek.Default.LogFDetails("images-repo: %s\n", imageRepository)
-				logboek.Default.LogFDetails("      image: %s\n", imageName)
+			phase.log.LogFHighlight(logboek.Default, "%s tag %s is up-to-date\n", strings.Title(string(tagStrategy)), imageTag)
 
-				return nil
-			})
+			if phase.log.IsAccepted(logboek.Default) {
+				_ = phase.log.WithIndent(func() error {
+					phase.log.LogFDetails(logboek.Info, "discarding newly built image %s\n", publishImage.MustGetBuiltId())
+					phase.log.LogFDetails(logboek.Default, "images-repo: %s\n", imageRepository)
+					phase.log.LogFDetails(logboek.Default, "      image: %s\n", imageName)
+
+					return nil
+				})
+			}
 
-			logboek.LogOptionalLn()
+			phase.log.LogOptionalLn(logboek.Default)
 
 			return nil
 		}
@@ -344,13 +443,58 @@ func (phase *PublishImagesPhase) publishImageByTag(img *Image, imageMetaTag stri
 		return nil
 	}
 
-	return logboek.Default.LogProcess(
+	if err := phase.log.LogProcess(
+		logboek.Default,
 		fmt.Sprintf("Publishing image %s by %s tag %s", img.LogName(), tagStrategy, imageTag),
 		logboek.LevelLogProcessOptions{
 			SuccessInfoSectionFunc: successInfoSectionFunc,
 			Style:                  logboek.HighlightStyle(),
 		},
-		publishingFunc)
+		publishingFunc); err != nil {
+		return err
+	}
+
+	if isPublishedByNewerSemver {
+		return nil
+	}
+
+	phase.Conveyor.report.addImageTag(img, phase.Conveyor.platform, imageName)
+
+	return phase.publishManifestList(img, manifestListName, imageName)
+}
+
+func (phase *PublishImagesPhase) publishManifestList(img *Image, manifestListName, platformImageName string) error {
+	if manifestListName == "" {
+		return nil
+	}
+
+	return phase.log.LogProcess(
+		logboek.Default,
+		fmt.Sprintf("Adding image %s platform %s to manifest list", img.LogName(), phase.Conveyor.platform),
+		logboek.LevelLogProcessOptions{
+			SuccessInfoSectionFunc: func() {
+				_ = logboek.WithIndent(func() error {
+					logboek.Default.LogFDetails("manifest list: %s\n", manifestListName)
+					logboek.Default.LogFDetails("        image: %s\n", platformImageName)
+					return nil
+				})
+			},
+		},
+		func() error {
+			if err := phase.Conveyor.StorageLockManager.LockImage(manifestListName); err != nil {
+				return fmt.Errorf("error locking image %s: %s", manifestListName, err)
+			}
+			defer phase.Conveyor.StorageLockManager.UnlockImage(manifestListName)
+
+			if err := docker_registry.AddToManifestList(manifestListName, platformImageName, phase.Conveyor.platform); err != nil {
+				return fmt.Errorf("error publishing manifest list %s: %s", manifestListName, err)
+			}
+
+			phase.Conveyor.report.addImageTag(img, phase.Conveyor.platform, manifestListName)
+
+			return nil
+		},
+	)
 }
 
 func (phase *PublishImagesPhase) checkImageAlreadyExists(existingTags []string, imageName, imageTag string, lastStageImage image.ImageInterface) (bool, error) {
@@ -366,10 +510,39 @@ func (phase *PublishImagesPhase) checkImageAlreadyExists(existingTags []string,
 	}
 
 	logProcessMsg := fmt.Sprintf("Getting existing tag %s parent id", imageTag)
-	err = logboek.Info.LogProcessInline(logProcessMsg, logboek.LevelLogProcessInlineOptions{}, getImageParentIDFunc)
+	err = phase.log.LogProcessInline(logboek.Info, logProcessMsg, logboek.LevelLogProcessInlineOptions{}, getImageParentIDFunc)
 	if err != nil {
 		return false, fmt.Errorf("unable to get image %s parent id: %s", imageName, err)
 	}
 
 	return lastStageImage.ID() == parentID, nil
 }
+
+func (phase *PublishImagesPhase) checkTagIsPublishedByNewerSemver(existingTags []string, imageName, imageTag string, version *semver.Version) (bool, error) {
+	if version == nil || !util.IsStringsContainValue(existingTags, imageTag) {
+		return false, nil
+	}
+
+	configFile, err := docker_registry.ImageConfigFile(imageName)
+	if err != nil {
+		return false, fmt.Errorf("unable to get image %s config: %s", imageName, err)
+	}
+
+	existingVersionLabel, ok := configFile.Config.Labels[image.WerfTagSemverLabel]
+	if !ok {
+		return false, nil
+	}
+
+	existingVersion, err := semver.NewVersion(existingVersionLabel)
+	if err != nil {
+		phase.log.LogWarnF("WARNING: Ignoring bad %s label value %q of the image %s: %s\n", image.WerfTagSemverLabel, existingVersionLabel, imageName, err)
+		return false, nil
+	}
+
+	if existingVersion.GreaterThan(version) {
+		phase.log.LogWarnF("WARNING: Semver tag %s is not moved to the older version %s: the tag is published by the version %s\n", imageTag, tag_strategy.SemverFullTag(version), existingVersionLabel)
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,132 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BuildReport is the machine-readable result of the build and publish phases,
+// the same report can be shared by conveyors of different platforms
+type BuildReport struct {
+	Images []*ImageReport `json:"images"`
+
+	mutex sync.Mutex
+}
+
+type ImageReport struct {
+	Name            string         `json:"name"`
+	IsArtifact      bool           `json:"isArtifact"`
+	Platform        string         `json:"platform,omitempty"`
+	StagesSignature string         `json:"stagesSignature,omitempty"`
+	ImageName       string         `json:"imageName,omitempty"`
+	ImageID         string         `json:"imageId,omitempty"`
+	Size            int64          `json:"size,omitempty"`
+	Stages          []*StageReport `json:"stages"`
+	Tags            []string       `json:"tags,omitempty"`
+}
+
+type StageReport struct {
+	Name            string  `json:"name"`
+	Signature       string  `json:"signature"`
+	ImageName       string  `json:"imageName"`
+	ImageID         string  `json:"imageId"`
+	CacheHit        bool    `json:"cacheHit"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Size            int64   `json:"size"`
+	// SizeDelta is the size difference with the previous stage image
+	SizeDelta int64 `json:"sizeDelta"`
+}
+
+func (report *BuildReport) WriteFile(path string) error {
+	report.mutex.Lock()
+	data, err := json.MarshalIndent(report, "", "  ")
+	report.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create dir %s: %s", filepath.Dir(path), err)
+	}
+
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write build report %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// imageReport must be called with locked mutex
+func (report *BuildReport) imageReport(img *Image, platform string) *ImageReport {
+	for _, imageReport := range report.Images {
+		if imageReport.Name == img.GetName() && imageReport.IsArtifact == img.isArtifact && imageReport.Platform == platform {
+			return imageReport
+		}
+	}
+
+	imageReport := &ImageReport{Name: img.GetName(), IsArtifact: img.isArtifact, Platform: platform, Stages: []*StageReport{}}
+	report.Images = append(report.Images, imageReport)
+
+	return imageReport
+}
+
+func (report *BuildReport) addImages(images []*Image, platform string) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	for _, img := range images {
+		report.imageReport(img, platform)
+	}
+}
+
+func (report *BuildReport) addStage(img *Image, platform string, stageReport *StageReport) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	imageReport := report.imageReport(img, platform)
+	imageReport.Stages = append(imageReport.Stages, stageReport)
+}
+
+func (report *BuildReport) setImageResult(img *Image, platform, stagesSignature, imageName, imageID string, size int64) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	imageReport := report.imageReport(img, platform)
+	imageReport.StagesSignature = stagesSignature
+	imageReport.ImageName = imageName
+	imageReport.ImageID = imageID
+	imageReport.Size = size
+}
+
+func (report *BuildReport) addImageTag(img *Image, platform, tag string) {
+	if report == nil {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	imageReport := report.imageReport(img, platform)
+	for _, t := range imageReport.Tags {
+		if t == tag {
+			return
+		}
+	}
+	imageReport.Tags = append(imageReport.Tags, tag)
+}
@@ -0,0 +1,115 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildReport_WriteFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "werf-build-report-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	img := &Image{name: "backend"}
+	artifact := &Image{name: "assets", isArtifact: true}
+
+	report := &BuildReport{}
+	report.addImages([]*Image{artifact, img}, "")
+
+	report.addStage(img, "", &StageReport{
+		Name:            "from",
+		Signature:       "sig-from",
+		ImageName:       "werf-stages-storage/project:sig-from",
+		ImageID:         "sha256:from",
+		CacheHit:        true,
+		DurationSeconds: 0.5,
+		Size:            100,
+		SizeDelta:       100,
+	})
+	report.addStage(img, "", &StageReport{
+		Name:            "install",
+		Signature:       "sig-install",
+		ImageName:       "werf-stages-storage/project:sig-install",
+		ImageID:         "sha256:install",
+		DurationSeconds: 12.25,
+		Size:            150,
+		SizeDelta:       50,
+	})
+	report.setImageResult(img, "", "sig-install", "werf-stages-storage/project:sig-install", "sha256:install", 150)
+	report.addImageTag(img, "", "registry.example.com/backend:master")
+	report.addImageTag(img, "", "registry.example.com/backend:v1.0.0")
+	report.addImageTag(img, "", "registry.example.com/backend:master")
+
+	path := filepath.Join(tmpDir, "report", "build.json")
+	if err := report.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{
+  "images": [
+    {
+      "name": "assets",
+      "isArtifact": true,
+      "stages": []
+    },
+    {
+      "name": "backend",
+      "isArtifact": false,
+      "stagesSignature": "sig-install",
+      "imageName": "werf-stages-storage/project:sig-install",
+      "imageId": "sha256:install",
+      "size": 150,
+      "stages": [
+        {
+          "name": "from",
+          "signature": "sig-from",
+          "imageName": "werf-stages-storage/project:sig-from",
+          "imageId": "sha256:from",
+          "cacheHit": true,
+          "durationSeconds": 0.5,
+          "size": 100,
+          "sizeDelta": 100
+        },
+        {
+          "name": "install",
+          "signature": "sig-install",
+          "imageName": "werf-stages-storage/project:sig-install",
+          "imageId": "sha256:install",
+          "cacheHit": false,
+          "durationSeconds": 12.25,
+          "size": 150,
+          "sizeDelta": 50
+        }
+      ],
+      "tags": [
+        "registry.example.com/backend:master",
+        "registry.example.com/backend:v1.0.0"
+      ]
+    }
+  ]
+}
+`
+
+	if string(data) != expected {
+		t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", expected, string(data))
+	}
+}
+
+func TestBuildReport_Nil(t *testing.T) {
+	var report *BuildReport
+
+	img := &Image{name: "backend"}
+	report.addImages([]*Image{img}, "")
+	report.addStage(img, "", &StageReport{Name: "from"})
+	report.setImageResult(img, "", "sig", "name", "id", 1)
+	report.addImageTag(img, "", "tag")
+}
@@ -2,6 +2,7 @@ package build
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/flant/logboek"
 	"github.com/flant/werf/pkg/build/stage"
@@ -13,27 +14,49 @@ type ShouldBeBuiltPhase struct {
 	IsBadDockerfileImageExists bool
 	BadImages                  []*Image
 	BadStagesByImage           map[string][]stage.Interface
+
+	// parent is set for the clone processing a single image, the clone result is merged into the parent
+	parent *ShouldBeBuiltPhase
+	mutex  sync.Mutex
 }
 
 func NewShouldBeBuiltPhase(c *Conveyor) *ShouldBeBuiltPhase {
-	return &ShouldBeBuiltPhase{BasePhase: BasePhase{c}, BadStagesByImage: make(map[string][]stage.Interface)}
+	return &ShouldBeBuiltPhase{BasePhase: BasePhase{Conveyor: c}, BadStagesByImage: make(map[string][]stage.Interface)}
 }
 
 func (phase *ShouldBeBuiltPhase) Name() string {
 	return "shouldBeBuilt"
 }
 
+func (phase *ShouldBeBuiltPhase) Clone(log *imageLog) Phase {
+	clone := NewShouldBeBuiltPhase(phase.Conveyor)
+	clone.log = log
+	clone.parent = phase
+	return clone
+}
+
 func (phase *ShouldBeBuiltPhase) BeforeImageStages(img *Image) error {
 	return nil
 }
 
 func (phase *ShouldBeBuiltPhase) AfterImageStages(img *Image) error {
-	if len(phase.BadStagesByImage[img.GetName()]) > 0 {
-		phase.BadImages = append(phase.BadImages, img)
+	badStages := phase.BadStagesByImage[img.GetName()]
+	if len(badStages) == 0 {
+		return nil
+	}
 
-		if !phase.IsBadDockerfileImageExists {
-			phase.IsBadDockerfileImageExists = img.isDockerfileImage
-		}
+	result := phase
+	if phase.parent != nil {
+		result = phase.parent
+		result.mutex.Lock()
+		defer result.mutex.Unlock()
+
+		result.BadStagesByImage[img.GetName()] = badStages
+	}
+
+	result.BadImages = append(result.BadImages, img)
+	if !result.IsBadDockerfileImageExists {
+		result.IsBadDockerfileImageExists = img.isDockerfileImage
 	}
 
 	return nil
@@ -11,6 +11,7 @@ import (
 	"github.com/flant/werf/pkg/storage"
 
 	"github.com/flant/logboek"
+	"github.com/flant/werf/pkg/cache_mounts"
 	"github.com/flant/werf/pkg/config"
 	imagePkg "github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/slug"
@@ -64,6 +65,8 @@ type NewBaseStageOptions struct {
 	ImageTmpDir      string
 	ContainerWerfDir string
 	ProjectName      string
+	ProjectDir       string
+	Platform         string
 }
 
 func newBaseStage(name StageName, options *NewBaseStageOptions) *BaseStage {
@@ -74,6 +77,7 @@ func newBaseStage(name StageName, options *NewBaseStageOptions) *BaseStage {
 	s.imageTmpDir = options.ImageTmpDir
 	s.containerWerfDir = options.ContainerWerfDir
 	s.projectName = options.ProjectName
+	s.platform = options.Platform
 	return s
 }
 
@@ -87,6 +91,7 @@ type BaseStage struct {
 	containerWerfDir string
 	configMounts     []*config.Mount
 	projectName      string
+	platform         string
 }
 
 func (s *BaseStage) LogDetailedName() string {
@@ -232,6 +237,8 @@ func (s *BaseStage) PrepareImage(_ Conveyor, prevBuiltImage, image imagePkg.Imag
 		return fmt.Errorf("error adding mounts volumes: %s", err)
 	}
 
+	s.addCacheMountVolumes(image)
+
 	return nil
 }
 
@@ -243,6 +250,29 @@ func (s *BaseStage) PreRunHook(_ Conveyor) error {
 	return nil
 }
 
+func (s *BaseStage) GetCacheMounts() []*cache_mounts.CacheMount {
+	var cacheMounts []*cache_mounts.CacheMount
+	for _, mountCfg := range s.configMounts {
+		if mountCfg.Type == "cache" {
+			cacheMounts = append(cacheMounts, cache_mounts.NewCacheMount(s.projectName, s.imageName, mountCfg))
+		}
+	}
+
+	return cacheMounts
+}
+
+// addCacheMountVolumes binds cache mounts dirs, the dirs are created when the stage is built (cache_mounts.CacheMount.Use)
+func (s *BaseStage) addCacheMountVolumes(image imagePkg.ImageInterface) {
+	for _, mountCfg := range s.configMounts {
+		if mountCfg.Type != "cache" {
+			continue
+		}
+
+		cacheMount := cache_mounts.NewCacheMount(s.projectName, s.imageName, mountCfg)
+		image.Container().RunOptions().AddVolume(fmt.Sprintf("%s:%s", cacheMount.DataDir(), path.Join("/", path.Clean(mountCfg.To))))
+	}
+}
+
 func (s *BaseStage) getServiceMounts(prevBuiltImage imagePkg.ImageInterface) map[string][]string {
 	return mergeMounts(s.getServiceMountsFromLabels(prevBuiltImage), s.getServiceMountsFromConfig())
 }
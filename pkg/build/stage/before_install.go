@@ -26,7 +26,7 @@ type BeforeInstallStage struct {
 }
 
 func (s *BeforeInstallStage) GetDependencies(_ Conveyor, _, _ image.ImageInterface) (string, error) {
-	return s.builder.BeforeInstallChecksum(), nil
+	return s.builder.BeforeInstallChecksum()
 }
 
 func (s *BeforeInstallStage) PrepareImage(c Conveyor, prevBuiltImage, image image.ImageInterface) error {
@@ -32,7 +32,12 @@ func (s *BeforeSetupStage) GetDependencies(_ Conveyor, _, _ image.ImageInterface
 		return "", err
 	}
 
-	return util.Sha256Hash(s.builder.BeforeSetupChecksum(), stageDependenciesChecksum), nil
+	checksum, err := s.builder.BeforeSetupChecksum()
+	if err != nil {
+		return "", err
+	}
+
+	return util.Sha256Hash(checksum, stageDependenciesChecksum), nil
 }
 
 func (s *BeforeSetupStage) PrepareImage(c Conveyor, prevBuiltImage, image image.ImageInterface) error {
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -43,22 +44,38 @@ type DockerfileStage struct {
 	*BaseStage
 }
 
-func NewDockerRunArgs(dockerfilePath, target, context string, buildArgs map[string]interface{}, addHost []string) *DockerRunArgs {
+func NewDockerRunArgs(dockerfilePath, target, context string, buildArgs map[string]interface{}, addHost, ssh, secrets []string, network string, cacheFrom []string, labels map[string]string, platform string) *DockerRunArgs {
 	return &DockerRunArgs{
 		dockerfilePath: dockerfilePath,
 		target:         target,
 		context:        context,
 		buildArgs:      buildArgs,
 		addHost:        addHost,
+		ssh:            ssh,
+		secrets:        secrets,
+		network:        network,
+		cacheFrom:      cacheFrom,
+		labels:         labels,
+		platform:       platform,
 	}
 }
 
+// DockerRunArgs are passed to the docker build as is.
+// Only addHost, labels and platform are the part of the stage signature:
+// ssh, secrets, network and cacheFrom do not change the result image,
+// and the secret files contents must not get into the signature anyway
 type DockerRunArgs struct {
 	dockerfilePath string
 	target         string
 	context        string
 	buildArgs      map[string]interface{}
 	addHost        []string
+	ssh            []string
+	secrets        []string
+	network        string
+	cacheFrom      []string
+	labels         map[string]string
+	platform       string
 }
 
 func NewDockerStages(dockerStages []instructions.Stage, dockerArgsHash map[string]string, dockerTargetStageIndex int) *DockerStages {
@@ -110,6 +127,11 @@ func (s *DockerfileStage) GetDependencies(_ Conveyor, _, _ image.ImageInterface)
 		var dependencies []string
 
 		dependencies = append(dependencies, s.addHost...)
+		dependencies = append(dependencies, s.labelsDependencies()...)
+
+		if s.DockerRunArgs.platform != "" {
+			dependencies = append(dependencies, s.DockerRunArgs.platform)
+		}
 
 		resolvedBaseName, err := shlex.ProcessWord(stage.BaseName, dockerMetaArgsString)
 		if err != nil {
@@ -181,8 +203,28 @@ func (s *DockerfileStage) GetDependencies(_ Conveyor, _, _ image.ImageInterface)
 	return util.Sha256Hash(stagesDependencies[s.dockerTargetStageIndex]...), nil
 }
 
+func (s *DockerfileStage) labelsDependencies() []string {
+	var keys []string
+	for key := range s.labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var dependencies []string
+	for _, key := range keys {
+		dependencies = append(dependencies, fmt.Sprintf("%s=%s", key, s.labels[key]))
+	}
+
+	return dependencies
+}
+
 func (s *DockerfileStage) PrepareImage(c Conveyor, prevBuiltImage, img image.ImageInterface) error {
 	img.DockerfileImageBuilder().AppendBuildArgs(s.DockerBuildArgs()...)
+
+	if len(s.ssh) != 0 || len(s.secrets) != 0 {
+		img.DockerfileImageBuilder().EnableBuildKit()
+	}
+
 	return nil
 }
 
@@ -207,6 +249,30 @@ func (s *DockerfileStage) DockerBuildArgs() []string {
 		result = append(result, fmt.Sprintf("--add-host=%s", addHost))
 	}
 
+	for _, ssh := range s.ssh {
+		result = append(result, fmt.Sprintf("--ssh=%s", ssh))
+	}
+
+	for _, secret := range s.secrets {
+		result = append(result, fmt.Sprintf("--secret=%s", secret))
+	}
+
+	if s.network != "" {
+		result = append(result, fmt.Sprintf("--network=%s", s.network))
+	}
+
+	for _, cacheFrom := range s.cacheFrom {
+		result = append(result, fmt.Sprintf("--cache-from=%s", cacheFrom))
+	}
+
+	if s.DockerRunArgs.platform != "" {
+		result = append(result, fmt.Sprintf("--platform=%s", s.DockerRunArgs.platform))
+	}
+
+	for key, value := range s.labels {
+		result = append(result, fmt.Sprintf("--label=%s=%s", key, value))
+	}
+
 	result = append(result, s.context)
 
 	return result
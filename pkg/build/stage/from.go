@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/flant/werf/pkg/cache_mounts"
 	"github.com/flant/werf/pkg/config"
 	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/stapel"
@@ -56,6 +57,10 @@ func (s *FromStage) GetDependencies(c Conveyor, prevImage, _ image.ImageInterfac
 		args = append(args, s.baseImageRepoIdOrNone)
 	}
 
+	if s.platform != "" {
+		args = append(args, s.platform)
+	}
+
 	for _, mount := range s.configMounts {
 		args = append(args, filepath.ToSlash(filepath.Clean(mount.From)), path.Clean(mount.To), mount.Type)
 	}
@@ -69,6 +74,11 @@ func (s *FromStage) GetDependencies(c Conveyor, prevImage, _ image.ImageInterfac
 	return util.Sha256Hash(args...), nil
 }
 
+// GetCacheMounts returns nothing: cache mounts are not bound on the from stage
+func (s *FromStage) GetCacheMounts() []*cache_mounts.CacheMount {
+	return nil
+}
+
 func (s *FromStage) PrepareImage(_ Conveyor, prevBuiltImage, image image.ImageInterface) error {
 	serviceMounts := s.getServiceMounts(prevBuiltImage)
 	s.addServiceMountsLabels(serviceMounts, image)
@@ -54,6 +54,12 @@ func (s *GitLatestPatchStage) GetDependencies(_ Conveyor, _, prevBuiltImage imag
 		}
 
 		args = append(args, patchContent)
+
+		lfsOids, err := gitMapping.GetPatchLFSOids(prevBuiltImage)
+		if err != nil {
+			return "", fmt.Errorf("error getting lfs objects of patch between previous built image %s and current commit for git mapping %s: %s", prevBuiltImage.Name(), gitMapping.Name, err)
+		}
+		args = append(args, lfsOids...)
 	}
 
 	return util.Sha256Hash(args...), nil
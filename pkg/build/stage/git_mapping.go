@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/flant/logboek"
 
@@ -20,10 +21,13 @@ import (
 	"github.com/flant/werf/pkg/util"
 )
 
+// GitRepoCache is shared by git mappings of all images using the repo, which are processed in parallel
 type GitRepoCache struct {
 	Patches   map[string]git_repo.Patch
 	Checksums map[string]git_repo.Checksum
 	Archives  map[string]git_repo.Archive
+
+	mutex sync.Mutex
 }
 
 func objectToHashKey(obj interface{}) string {
@@ -35,6 +39,9 @@ func objectToHashKey(obj interface{}) string {
 }
 
 func (cache *GitRepoCache) Terminate() error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
 	for _, patch := range cache.Patches {
 		_ = os.RemoveAll(patch.GetFilePath())
 	}
@@ -62,6 +69,8 @@ type GitMapping struct {
 	IncludePaths       []string
 	ExcludePaths       []string
 	StagesDependencies map[StageName][]string
+	// LFS enables resolving of Git LFS pointer files into the objects they point to
+	LFS bool
 
 	PatchesDir           string
 	ContainerPatchesDir  string
@@ -103,6 +112,9 @@ func (gm *GitMapping) GitRepo() git_repo.GitRepo {
 }
 
 func (gm *GitMapping) getOrCreateChecksum(opts git_repo.ChecksumOptions) (git_repo.Checksum, error) {
+	gm.GitRepoCache.mutex.Lock()
+	defer gm.GitRepoCache.mutex.Unlock()
+
 	if _, hasKey := gm.GitRepoCache.Checksums[objectToHashKey(opts)]; !hasKey {
 		checksum, err := gm.GitRepo().Checksum(opts)
 		if err != nil {
@@ -114,6 +126,9 @@ func (gm *GitMapping) getOrCreateChecksum(opts git_repo.ChecksumOptions) (git_re
 }
 
 func (gm *GitMapping) getOrCreateArchive(opts git_repo.ArchiveOptions) (git_repo.Archive, error) {
+	gm.GitRepoCache.mutex.Lock()
+	defer gm.GitRepoCache.mutex.Unlock()
+
 	if _, hasKey := gm.GitRepoCache.Archives[objectToHashKey(opts)]; !hasKey {
 		archive, err := gm.createArchive(opts)
 		if err != nil {
@@ -146,6 +161,9 @@ func (gm *GitMapping) createArchive(opts git_repo.ArchiveOptions) (git_repo.Arch
 }
 
 func (gm *GitMapping) getOrCreatePatch(opts git_repo.PatchOptions) (git_repo.Patch, error) {
+	gm.GitRepoCache.mutex.Lock()
+	defer gm.GitRepoCache.mutex.Unlock()
+
 	if _, hasKey := gm.GitRepoCache.Patches[objectToHashKey(opts)]; !hasKey {
 		patch, err := gm.createPatch(opts)
 		if err != nil {
@@ -320,7 +338,8 @@ func (gm *GitMapping) baseApplyPatchCommand(fromCommit, toCommit string, prevBui
 		return nil, nil
 	}
 
-	if patch.HasBinary() {
+	// Git LFS pointers are replaced with the objects from the archive
+	if patch.HasBinary() || (gm.LFS && len(patch.GetLFSPaths()) > 0) {
 		pathsListFile, err := gm.preparePatchPathsListFile(patchOpts, patch)
 		if err != nil {
 			return nil, fmt.Errorf("cannot create patch paths list file: %s", err)
@@ -385,6 +404,7 @@ func (gm *GitMapping) baseApplyPatchCommand(fromCommit, toCommit string, prevBui
 		archiveOpts := git_repo.ArchiveOptions{
 			FilterOptions: gm.getRepoFilterOptions(),
 			Commit:        toCommit,
+			WithLFS:       gm.LFS,
 		}
 
 		archive, err := gm.getOrCreateArchive(archiveOpts)
@@ -506,6 +526,7 @@ func (gm *GitMapping) baseApplyArchiveCommand(commit string, image image.ImageIn
 	archiveOpts := git_repo.ArchiveOptions{
 		FilterOptions: gm.getRepoFilterOptions(),
 		Commit:        commit,
+		WithLFS:       gm.LFS,
 	}
 
 	archive, err := gm.getOrCreateArchive(archiveOpts)
@@ -594,7 +615,12 @@ func (gm *GitMapping) PatchSize(fromCommit string) (int64, error) {
 		return 0, fmt.Errorf("unable to stat temporary patch file `%s`: %s", patch.GetFilePath(), err)
 	}
 
-	return fileInfo.Size(), nil
+	size := fileInfo.Size()
+	if gm.LFS {
+		size += patch.GetLFSObjectsSize()
+	}
+
+	return size, nil
 }
 
 func (gm *GitMapping) GetFullName() string {
@@ -630,6 +656,11 @@ func (gm *GitMapping) GetParamshash() string {
 	parts = append(parts, ":::")
 	parts = append(parts, gm.Commit)
 
+	if gm.LFS {
+		parts = append(parts, ":::")
+		parts = append(parts, "lfs")
+	}
+
 	for _, part := range parts {
 		_, err = hash.Write([]byte(part))
 		if err != nil {
@@ -675,6 +706,36 @@ func (gm *GitMapping) GetPatchContent(prevBuiltImage image.ImageInterface) (stri
 	return string(data), nil
 }
 
+// GetPatchLFSOids returns oids of Git LFS objects the patch pointers point to
+func (gm *GitMapping) GetPatchLFSOids(prevBuiltImage image.ImageInterface) ([]string, error) {
+	if !gm.LFS {
+		return nil, nil
+	}
+
+	fromCommit, toCommit, err := gm.GetCommitsToPatch(prevBuiltImage)
+	if err != nil {
+		return nil, err
+	}
+	if fromCommit == toCommit {
+		return nil, nil
+	}
+
+	patchOpts := git_repo.PatchOptions{
+		FilterOptions: gm.getRepoFilterOptions(),
+		FromCommit:    fromCommit,
+		ToCommit:      toCommit,
+	}
+	patch, err := gm.getOrCreatePatch(patchOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	oids := append([]string{}, patch.GetLFSOids()...)
+	sort.Strings(oids)
+
+	return oids, nil
+}
+
 func (gm *GitMapping) IsPatchEmpty(prevBuiltImage image.ImageInterface) (bool, error) {
 	fromCommit, toCommit, err := gm.GetCommitsToPatch(prevBuiltImage)
 	if err != nil {
@@ -712,6 +773,7 @@ func (gm *GitMapping) IsEmpty() (bool, error) {
 	archiveOpts := git_repo.ArchiveOptions{
 		FilterOptions: gm.getRepoFilterOptions(),
 		Commit:        commit,
+		WithLFS:       gm.LFS,
 	}
 
 	archive, err := gm.getOrCreateArchive(archiveOpts)
@@ -0,0 +1,86 @@
+package stage
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/flant/werf/pkg/git_repo"
+)
+
+type countingGitRepo struct {
+	git_repo.GitRepo
+
+	patches, archives, checksums int32
+}
+
+func (repo *countingGitRepo) GetName() string {
+	return "own"
+}
+
+func (repo *countingGitRepo) CreatePatch(git_repo.PatchOptions) (git_repo.Patch, error) {
+	atomic.AddInt32(&repo.patches, 1)
+	return &fakePatch{}, nil
+}
+
+func (repo *countingGitRepo) CreateArchive(git_repo.ArchiveOptions) (git_repo.Archive, error) {
+	atomic.AddInt32(&repo.archives, 1)
+	return &fakeArchive{}, nil
+}
+
+func (repo *countingGitRepo) Checksum(git_repo.ChecksumOptions) (git_repo.Checksum, error) {
+	atomic.AddInt32(&repo.checksums, 1)
+	return nil, nil
+}
+
+type fakePatch struct {
+	git_repo.Patch
+}
+
+type fakeArchive struct {
+	git_repo.Archive
+}
+
+func TestGitMapping_sharedGitRepoCache(t *testing.T) {
+	repo := &countingGitRepo{}
+	cache := &GitRepoCache{
+		Patches:   make(map[string]git_repo.Patch),
+		Checksums: make(map[string]git_repo.Checksum),
+		Archives:  make(map[string]git_repo.Archive),
+	}
+
+	// git mappings of two images using the same repo are processed in parallel
+	gitMappings := []*GitMapping{
+		{GitRepoInterface: repo, GitRepoCache: cache, Add: "/app"},
+		{GitRepoInterface: repo, GitRepoCache: cache, Add: "/app"},
+	}
+
+	var wg sync.WaitGroup
+	for _, gm := range gitMappings {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(gm *GitMapping, commit string) {
+				defer wg.Done()
+
+				filterOptions := gm.getRepoFilterOptions()
+				if _, err := gm.getOrCreateChecksum(git_repo.ChecksumOptions{FilterOptions: filterOptions, Commit: commit}); err != nil {
+					t.Error(err)
+				}
+				if _, err := gm.getOrCreateArchive(git_repo.ArchiveOptions{FilterOptions: filterOptions, Commit: commit}); err != nil {
+					t.Error(err)
+				}
+				if _, err := gm.getOrCreatePatch(git_repo.PatchOptions{FilterOptions: filterOptions, FromCommit: "base", ToCommit: commit}); err != nil {
+					t.Error(err)
+				}
+			}(gm, fmt.Sprintf("commit-%d", i%2))
+		}
+	}
+	wg.Wait()
+
+	for name, count := range map[string]int32{"patches": repo.patches, "archives": repo.archives, "checksums": repo.checksums} {
+		if count != 2 {
+			t.Errorf("%s:\n[EXPECTED]: %v\n[GOT]: %v", name, 2, count)
+		}
+	}
+}
@@ -32,7 +32,12 @@ func (s *InstallStage) GetDependencies(_ Conveyor, _, _ image.ImageInterface) (s
 		return "", err
 	}
 
-	return util.Sha256Hash(s.builder.InstallChecksum(), stageDependenciesChecksum), nil
+	checksum, err := s.builder.InstallChecksum()
+	if err != nil {
+		return "", err
+	}
+
+	return util.Sha256Hash(checksum, stageDependenciesChecksum), nil
 }
 
 func (s *InstallStage) PrepareImage(c Conveyor, prevBuiltImage, image image.ImageInterface) error {
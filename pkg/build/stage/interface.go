@@ -1,6 +1,7 @@
 package stage
 
 import (
+	"github.com/flant/werf/pkg/cache_mounts"
 	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/storage"
 )
@@ -30,4 +31,6 @@ type Interface interface {
 	GetGitMappings() []*GitMapping
 
 	SelectCacheImage(images []*storage.ImageInfo) (*storage.ImageInfo, error)
+
+	GetCacheMounts() []*cache_mounts.CacheMount
 }
@@ -32,7 +32,12 @@ func (s *SetupStage) GetDependencies(_ Conveyor, _, _ image.ImageInterface) (str
 		return "", err
 	}
 
-	return util.Sha256Hash(s.builder.SetupChecksum(), stageDependenciesChecksum), nil
+	checksum, err := s.builder.SetupChecksum()
+	if err != nil {
+		return "", err
+	}
+
+	return util.Sha256Hash(checksum, stageDependenciesChecksum), nil
 }
 
 func (s *SetupStage) PrepareImage(c Conveyor, prevBuiltImage, image image.ImageInterface) error {
@@ -12,7 +12,7 @@ import (
 
 func getBuilder(imageBaseConfig *config.StapelImageBase, baseStageOptions *NewBaseStageOptions) builder.Builder {
 	var b builder.Builder
-	extra := &builder.Extra{ContainerWerfPath: baseStageOptions.ContainerWerfDir, TmpPath: baseStageOptions.ImageTmpDir}
+	extra := &builder.Extra{ContainerWerfPath: baseStageOptions.ContainerWerfDir, TmpPath: baseStageOptions.ImageTmpDir, ProjectDir: baseStageOptions.ProjectDir}
 	if imageBaseConfig.Shell != nil {
 		b = builder.NewShellBuilder(imageBaseConfig.Shell, extra)
 	} else if imageBaseConfig.Ansible != nil {
@@ -0,0 +1,140 @@
+package build
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/storage"
+	"github.com/flant/werf/pkg/util"
+)
+
+// ImagesStagesSignatures collects stages signatures of the images built for each platform by conveyors of different platforms.
+// Stages signature differs for each platform, so that the images of platforms published by the stages-signature tagging strategy
+// are combined into the manifest list by the multi-platform stages signature
+type ImagesStagesSignatures struct {
+	// signatures by platform by image name
+	signatures map[string]map[string]string
+
+	mutex sync.Mutex
+}
+
+func NewImagesStagesSignatures() *ImagesStagesSignatures {
+	return &ImagesStagesSignatures{signatures: make(map[string]map[string]string)}
+}
+
+// Add collects stages signatures of the conveyor images, the signatures should be calculated by the conveyor
+func (s *ImagesStagesSignatures) Add(c *Conveyor) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, img := range c.imagesInOrder {
+		if img.isArtifact || img.GetStagesSignature() == "" {
+			continue
+		}
+
+		if _, exists := s.signatures[img.GetName()]; !exists {
+			s.signatures[img.GetName()] = make(map[string]string)
+		}
+
+		s.signatures[img.GetName()][c.platform] = img.GetStagesSignature()
+	}
+}
+
+// ImageTag returns the stages-signature tag of the image: the stages signature of the image built without the platform
+// or the multi-platform stages signature of the manifest list
+func (s *ImagesStagesSignatures) ImageTag(imageName string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	signatureByPlatform, exists := s.signatures[imageName]
+	if !exists {
+		return "", fmt.Errorf("stages signature of image %s is not calculated", imageName)
+	}
+
+	if signature, exists := signatureByPlatform[""]; exists {
+		return signature, nil
+	}
+
+	return MultiPlatformStagesSignature(signatureByPlatform), nil
+}
+
+// PublishManifestLists publishes the manifest list of the platform images by the multi-platform stages signature for each image,
+// empty imagesToPublish means all images
+func (s *ImagesStagesSignatures) PublishManifestLists(imagesRepoManager ImagesRepoManager, storageLockManager storage.LockManager, imagesToPublish []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var imagesNames []string
+	for imageName, signatureByPlatform := range s.signatures {
+		if _, exists := signatureByPlatform[""]; exists {
+			continue
+		}
+
+		if len(imagesToPublish) != 0 && !util.IsStringsContainValue(imagesToPublish, imageName) {
+			continue
+		}
+
+		imagesNames = append(imagesNames, imageName)
+	}
+	sort.Strings(imagesNames)
+
+	for _, imageName := range imagesNames {
+		signatureByPlatform := s.signatures[imageName]
+		manifestListName := imagesRepoManager.ImageRepoWithTag(imageName, MultiPlatformStagesSignature(signatureByPlatform))
+
+		if err := logboek.Default.LogProcess(
+			fmt.Sprintf("Publishing image %s manifest list by multi-platform stages signature", imageName),
+			logboek.LevelLogProcessOptions{
+				SuccessInfoSectionFunc: func() {
+					_ = logboek.WithIndent(func() error {
+						logboek.Default.LogFDetails("manifest list: %s\n", manifestListName)
+						return nil
+					})
+				},
+			},
+			func() error {
+				if err := storageLockManager.LockImage(manifestListName); err != nil {
+					return fmt.Errorf("error locking image %s: %s", manifestListName, err)
+				}
+				defer storageLockManager.UnlockImage(manifestListName)
+
+				for _, platform := range sortedPlatforms(signatureByPlatform) {
+					platformImageName := imagesRepoManager.ImageRepoWithTag(imageName, signatureByPlatform[platform])
+					if err := docker_registry.AddToManifestList(manifestListName, platformImageName, platform); err != nil {
+						return fmt.Errorf("error publishing manifest list %s: %s", manifestListName, err)
+					}
+				}
+
+				return nil
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MultiPlatformStagesSignature is calculated by the stages signatures of all platforms the image is built for
+func MultiPlatformStagesSignature(signatureByPlatform map[string]string) string {
+	var args []string
+	for _, platform := range sortedPlatforms(signatureByPlatform) {
+		args = append(args, platform, signatureByPlatform[platform])
+	}
+
+	return util.Sha3_224Hash(args...)
+}
+
+func sortedPlatforms(signatureByPlatform map[string]string) []string {
+	var platforms []string
+	for platform := range signatureByPlatform {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	return platforms
+}
@@ -0,0 +1,30 @@
+package build
+
+import "testing"
+
+func TestImagesStagesSignatures_ImageTag(t *testing.T) {
+	s := NewImagesStagesSignatures()
+	s.signatures["backend"] = map[string]string{"": "sig"}
+	s.signatures["frontend"] = map[string]string{"linux/arm64": "sig-arm64", "linux/amd64": "sig-amd64"}
+
+	if tag, err := s.ImageTag("backend"); err != nil {
+		t.Fatal(err)
+	} else if tag != "sig" {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", "sig", tag)
+	}
+
+	expected := MultiPlatformStagesSignature(map[string]string{"linux/amd64": "sig-amd64", "linux/arm64": "sig-arm64"})
+	if tag, err := s.ImageTag("frontend"); err != nil {
+		t.Fatal(err)
+	} else if tag != expected {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, tag)
+	}
+
+	if otherTag := MultiPlatformStagesSignature(map[string]string{"linux/amd64": "sig-arm64", "linux/arm64": "sig-amd64"}); otherTag == expected {
+		t.Errorf("multi-platform stages signature should depend on the platform of each signature")
+	}
+
+	if _, err := s.ImageTag("unknown"); err == nil {
+		t.Errorf("expected error for the image without stages signatures")
+	}
+}
@@ -0,0 +1,148 @@
+package cache_mounts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/slug"
+	"github.com/flant/werf/pkg/werf"
+)
+
+const (
+	SharingShared  = "shared"
+	SharingLocked  = "locked"
+	SharingPrivate = "private"
+
+	lastUsedAtFile = "werf_last_used_at"
+	dataDir        = "data"
+)
+
+// CacheMount is the host directory of the cache mount, the same cache is used by all stages with the same project, id and image (for private sharing)
+type CacheMount struct {
+	ProjectName string
+	Id          string
+	Sharing     string
+	ImageName   string
+}
+
+func NewCacheMount(projectName, imageName string, mountCfg *config.Mount) *CacheMount {
+	m := &CacheMount{ProjectName: projectName, Id: mountCfg.Id, Sharing: mountCfg.Sharing}
+	if m.Sharing == SharingPrivate {
+		m.ImageName = imageName
+	}
+
+	return m
+}
+
+func GetCachesDir() string {
+	return filepath.Join(werf.GetSharedContextDir(), "mounts", "caches", "projects")
+}
+
+// Name identifies the cache among caches of the project
+func (m *CacheMount) Name() string {
+	if m.ImageName != "" {
+		return slug.Slug(fmt.Sprintf("%s-%s", m.Id, m.ImageName))
+	}
+
+	return slug.Slug(m.Id)
+}
+
+func (m *CacheMount) Dir() string {
+	return filepath.Join(GetCachesDir(), m.ProjectName, m.Name())
+}
+
+// DataDir is mounted into the build container
+func (m *CacheMount) DataDir() string {
+	return filepath.Join(m.Dir(), dataDir)
+}
+
+// ShouldBeLocked reports whether stages using the cache should be serialized
+func (m *CacheMount) ShouldBeLocked() bool {
+	return m.Sharing == SharingLocked || m.Sharing == SharingPrivate
+}
+
+// Use marks the cache as used by the current process until Release is called, the used cache cannot be removed by GC
+func (m *CacheMount) Use() error {
+	if err := werf.HostLock(usageLockName(m.ProjectName, m.Name()), shluz.LockOptions{ReadOnly: true}); err != nil {
+		return fmt.Errorf("shluz lock %s error: %s", usageLockName(m.ProjectName, m.Name()), err)
+	}
+
+	if err := m.touch(); err != nil {
+		_ = m.Release()
+		return err
+	}
+
+	return nil
+}
+
+func (m *CacheMount) touch() error {
+	if err := os.MkdirAll(m.DataDir(), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating cache mount dir %s: %s", m.DataDir(), err)
+	}
+
+	path := filepath.Join(m.Dir(), lastUsedAtFile)
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", time.Now().Unix())), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %s", path, err)
+	}
+
+	return nil
+}
+
+func (m *CacheMount) Release() error {
+	return werf.HostUnlock(usageLockName(m.ProjectName, m.Name()))
+}
+
+func usageLockName(projectName, name string) string {
+	return fmt.Sprintf("cache_mount.%s.%s", projectName, name)
+}
+
+type CacheMountStats struct {
+	ProjectName string
+	Name        string
+	Path        string
+	Size        int64
+	LastUsedAt  time.Time
+}
+
+func getCacheMountStats(projectName, name string) (*CacheMountStats, error) {
+	stats := &CacheMountStats{ProjectName: projectName, Name: name, Path: filepath.Join(GetCachesDir(), projectName, name)}
+
+	lastUsedAtPath := filepath.Join(stats.Path, lastUsedAtFile)
+	if data, err := ioutil.ReadFile(lastUsedAtPath); err == nil {
+		timestamp, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad timestamp in %s: %s", lastUsedAtPath, err)
+		}
+		stats.LastUsedAt = time.Unix(timestamp, 0)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading %s: %s", lastUsedAtPath, err)
+	}
+
+	if err := filepath.Walk(stats.Path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files created by the build container might be inaccessible for the current user
+			if os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			stats.Size += info.Size()
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to calculate %s size: %s", stats.Path, err)
+	}
+
+	return stats, nil
+}
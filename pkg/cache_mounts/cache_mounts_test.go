@@ -0,0 +1,74 @@
+package cache_mounts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/werf"
+)
+
+func TestGetCacheMountsStats(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "werf-cache-mounts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := werf.Init(tmpDir, filepath.Join(tmpDir, "home")); err != nil {
+		t.Fatal(err)
+	}
+	if err := shluz.Init(filepath.Join(tmpDir, "locks")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []struct {
+		projectName string
+		imageName   string
+		mount       *config.Mount
+		lastUsedAt  int64
+		dataSize    int
+	}{
+		{"app", "backend", &config.Mount{Id: "apt", Sharing: SharingShared}, 300, 10},
+		{"app", "frontend", &config.Mount{Id: "npm", Sharing: SharingPrivate}, 100, 20},
+		{"web", "web", &config.Mount{Id: "apt", Sharing: SharingLocked}, 200, 30},
+	} {
+		cacheMount := NewCacheMount(e.projectName, e.imageName, e.mount)
+		if err := cacheMount.Use(); err != nil {
+			t.Fatal(err)
+		}
+		if err := cacheMount.Release(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(cacheMount.DataDir(), "file"), make([]byte, e.dataSize), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		lastUsedAtPath := filepath.Join(cacheMount.Dir(), lastUsedAtFile)
+		if err := ioutil.WriteFile(lastUsedAtPath, []byte(fmt.Sprintf("%d\n", e.lastUsedAt)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := GetCacheMountsStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, s := range stats {
+		got = append(got, fmt.Sprintf("%s/%s %d %d", s.ProjectName, s.Name, s.Size, s.LastUsedAt.Unix()))
+	}
+
+	// The size includes the last usage time file
+	expected := []string{"app/npm-frontend 24 100", "web/apt 34 200", "app/apt 14 300"}
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", expected) {
+		t.Errorf("cache mounts stats:\n[EXPECTED]:\n%v\n[GOT]:\n%v", expected, got)
+	}
+}
@@ -0,0 +1,124 @@
+package cache_mounts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-units"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/util"
+	"github.com/flant/werf/pkg/werf"
+)
+
+// GetCacheMountsStats returns stats of cache mounts of all projects sorted by the last usage time
+func GetCacheMountsStats() ([]*CacheMountStats, error) {
+	projectInfos, err := ioutil.ReadDir(GetCachesDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading dir %s: %s", GetCachesDir(), err)
+	}
+
+	var res []*CacheMountStats
+	for _, projectInfo := range projectInfos {
+		if !projectInfo.IsDir() {
+			continue
+		}
+
+		projectDir := filepath.Join(GetCachesDir(), projectInfo.Name())
+		infos, err := ioutil.ReadDir(projectDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dir %s: %s", projectDir, err)
+		}
+
+		for _, info := range infos {
+			if !info.IsDir() {
+				continue
+			}
+
+			stats, err := getCacheMountStats(projectInfo.Name(), info.Name())
+			if err != nil {
+				return nil, err
+			}
+
+			res = append(res, stats)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastUsedAt.Before(res[j].LastUsedAt)
+	})
+
+	return res, nil
+}
+
+// GC removes least recently used cache mounts until the total size of cache mounts on the host does not exceed maxSize, cache mounts used by running builds are skipped
+func GC(maxSize int64, dryRun bool) error {
+	return logboek.LogProcess("Running GC for cache mounts", logboek.LogProcessOptions{}, func() error { return gc(maxSize, dryRun) })
+}
+
+func gc(maxSize int64, dryRun bool) error {
+	cacheMountsStats, err := GetCacheMountsStats()
+	if err != nil {
+		return fmt.Errorf("cannot get cache mounts stats: %s", err)
+	}
+
+	var totalSize int64
+	for _, stats := range cacheMountsStats {
+		totalSize += stats.Size
+	}
+
+	logboek.LogF("Total size of cache mounts is %s, the limit is %s\n", units.HumanSize(float64(totalSize)), units.HumanSize(float64(maxSize)))
+
+	var pathsToRemove []string
+	for _, stats := range cacheMountsStats {
+		if totalSize <= maxSize {
+			break
+		}
+
+		lockName := usageLockName(stats.ProjectName, stats.Name)
+		isLocked, err := werf.TryHostLock(lockName, shluz.TryLockOptions{})
+		if err != nil {
+			return fmt.Errorf("shluz lock %s error: %s", lockName, err)
+		}
+
+		if !isLocked {
+			logboek.Debug.LogF("Cache mount %s is used by another werf process, skipping\n", stats.Path)
+			continue
+		}
+
+		// The lock is held until the end of the cleanup to prevent using the cache being removed
+		defer werf.HostUnlock(lockName)
+
+		logboek.LogLn(stats.Path)
+		pathsToRemove = append(pathsToRemove, stats.Path)
+		totalSize -= stats.Size
+	}
+
+	if dryRun || len(pathsToRemove) == 0 {
+		return nil
+	}
+
+	if runtime.GOOS == "windows" {
+		for _, path := range pathsToRemove {
+			if err := os.RemoveAll(path); err != nil {
+				return fmt.Errorf("unable to remove cache mount %s: %s", path, err)
+			}
+		}
+	} else {
+		// Files in the cache mount are created by the build container and might be owned by root
+		if err := util.RemoveHostDirsWithLinuxContainer(werf.GetSharedContextDir(), pathsToRemove); err != nil {
+			return fmt.Errorf("unable to remove cache mounts %s: %s", strings.Join(pathsToRemove, ", "), err)
+		}
+	}
+
+	return nil
+}
@@ -7,15 +7,22 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/go-units"
+	"github.com/gosuri/uitable"
 
 	"github.com/flant/logboek"
 	"github.com/flant/shluz"
+	"github.com/flant/werf/pkg/cache_mounts"
+	"github.com/flant/werf/pkg/git_repo"
 	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/tmp_manager"
+	"github.com/flant/werf/pkg/werf"
 )
 
 type HostCleanupOptions struct {
 	DryRun bool
+	// CacheMountsMaxSize is the total size limit of cache mounts of all projects on the host
+	CacheMountsMaxSize int64
 }
 
 func HostCleanup(options HostCleanupOptions) error {
@@ -26,7 +33,7 @@ func HostCleanup(options HostCleanupOptions) error {
 		DryRun:         options.DryRun,
 	}
 
-	return shluz.WithLock("host-cleanup", shluz.LockOptions{Timeout: time.Second * 600}, func() error {
+	return werf.WithHostLock("host-cleanup", shluz.LockOptions{Timeout: time.Second * 600}, func() error {
 		if err := logboek.LogProcess("Running cleanup for docker containers created by werf", logboek.LogProcessOptions{}, func() error {
 			return safeContainersCleanup(commonOptions)
 		}); err != nil {
@@ -39,16 +46,60 @@ func HostCleanup(options HostCleanupOptions) error {
 			return nil
 		}
 
-		return shluz.WithLock("gc", shluz.LockOptions{}, func() error {
+		if err := werf.WithHostLock("gc", shluz.LockOptions{}, func() error {
 			if err := tmp_manager.GC(commonOptions.DryRun); err != nil {
 				return fmt.Errorf("tmp files gc failed: %s", err)
 			}
 
 			return nil
-		})
+		}); err != nil {
+			return err
+		}
+
+		if err := cache_mounts.GC(options.CacheMountsMaxSize, commonOptions.DryRun); err != nil {
+			return fmt.Errorf("cache mounts gc failed: %s", err)
+		}
+
+		return logboek.LogProcess("Remote git clones", logboek.LogProcessOptions{}, logRemoteGitClonesStats)
 	})
 }
 
+func logRemoteGitClonesStats() error {
+	clonesStats, err := git_repo.GetRemoteClonesStats()
+	if err != nil {
+		return fmt.Errorf("cannot get remote git clones stats: %s", err)
+	}
+
+	if len(clonesStats) == 0 {
+		logboek.LogLn("No remote git clones found")
+		return nil
+	}
+
+	now := time.Now()
+
+	t := uitable.New()
+	t.MaxColWidth = uint(logboek.ContentWidth())
+	t.AddRow("URL", "SIZE", "LAST USED", "HISTORY", "BLOBS")
+	for _, stats := range clonesStats {
+		history := "full"
+		if stats.Depth != 0 {
+			history = fmt.Sprintf("%d commits", stats.Depth)
+		}
+
+		blobs := "all"
+		if stats.IsPartial {
+			blobs = "on demand"
+		}
+
+		lastUsed := units.HumanDuration(now.Sub(stats.LastUsedAt)) + " ago"
+
+		t.AddRow(stats.Url, units.HumanSize(float64(stats.Size)), lastUsed, history, blobs)
+	}
+	logboek.LogLn(t.String())
+
+	return nil
+}
+
 func safeDanglingImagesCleanup(options CommonOptions) error {
 	images, err := werfImagesByFilterSet(danglingFilterSet())
 	if err != nil {
@@ -60,7 +111,7 @@ func safeDanglingImagesCleanup(options CommonOptions) error {
 	for _, img := range images {
 		if imgName, hasKey := img.Labels[image.WerfDockerImageName]; hasKey {
 			imageLockName := image.ImageLockName(imgName)
-			isLocked, err := shluz.TryLock(imageLockName, shluz.TryLockOptions{})
+			isLocked, err := werf.TryHostLock(imageLockName, shluz.TryLockOptions{})
 			if err != nil {
 				return fmt.Errorf("failed to lock %s for image %s: %s", imageLockName, imgName, err)
 			}
@@ -70,7 +121,7 @@ func safeDanglingImagesCleanup(options CommonOptions) error {
 				continue
 			}
 
-			shluz.Unlock(imageLockName) // no need to hold a lock
+			werf.HostUnlock(imageLockName) // no need to hold a lock
 
 			imagesToRemove = append(imagesToRemove, img)
 		} else {
@@ -112,7 +163,7 @@ func safeContainersCleanup(options CommonOptions) error {
 
 		err := func() error {
 			containerLockName := image.ContainerLockName(containerName)
-			isLocked, err := shluz.TryLock(containerLockName, shluz.TryLockOptions{})
+			isLocked, err := werf.TryHostLock(containerLockName, shluz.TryLockOptions{})
 			if err != nil {
 				return fmt.Errorf("failed to lock %s for container %s: %s", containerLockName, logContainerName(container), err)
 			}
@@ -121,7 +172,7 @@ func safeContainersCleanup(options CommonOptions) error {
 				logboek.Default.LogFDetails("Ignore container %s used by another process\n", logContainerName(container))
 				return nil
 			}
-			defer shluz.Unlock(containerLockName)
+			defer werf.HostUnlock(containerLockName)
 
 			if err := containersRemove([]types.Container{container}, options); err != nil {
 				return fmt.Errorf("failed to remove container %s: %s", logContainerName(container), err)
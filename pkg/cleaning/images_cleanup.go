@@ -13,11 +13,15 @@ import (
 	"github.com/flant/logboek"
 
 	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/config"
 	"github.com/flant/werf/pkg/docker_registry"
 	"github.com/flant/werf/pkg/image"
 	"github.com/flant/werf/pkg/logging"
 	"github.com/flant/werf/pkg/slug"
 	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util"
+	"github.com/flant/werf/pkg/werf"
 )
 
 type ImagesCleanupPolicies struct {
@@ -38,6 +42,18 @@ type ImagesCleanupPolicies struct {
 
 	StagesSignatureStrategyHasExpiryPeriod bool // No expiration by default!
 	StagesSignatureStrategyExpiryPeriod    time.Duration
+
+	SemverStrategyHasLimit bool // No limit by default!
+	SemverStrategyLimit    int64
+
+	SemverStrategyHasExpiryPeriod bool // No expiration by default!
+	SemverStrategyExpiryPeriod    time.Duration
+
+	TemplateStrategyHasLimit bool // No limit by default!
+	TemplateStrategyLimit    int64
+
+	TemplateStrategyHasExpiryPeriod bool // No expiration by default!
+	TemplateStrategyExpiryPeriod    time.Duration
 }
 
 type ImagesCleanupOptions struct {
@@ -45,7 +61,11 @@ type ImagesCleanupOptions struct {
 	LocalGit                  GitRepo
 	KubernetesContextsClients map[string]kubernetes.Interface
 	WithoutKube               bool
+	KubernetesImagesOptions   KubernetesImagesOptions
 	Policies                  ImagesCleanupPolicies
+
+	// Rules from the werf.yaml cleanup section replace the Policies when specified
+	Rules []*config.CleanupRule
 }
 
 func ImagesCleanup(options ImagesCleanupOptions) error {
@@ -60,7 +80,7 @@ func ImagesCleanup(options ImagesCleanupOptions) error {
 
 func imagesCleanup(options ImagesCleanupOptions) error {
 	imagesCleanupLockName := fmt.Sprintf("images-cleanup.%s", options.CommonRepoOptions.ImagesRepoManager.ImagesRepo())
-	return shluz.WithLock(imagesCleanupLockName, shluz.LockOptions{Timeout: time.Second * 600}, func() error {
+	return werf.WithHostLock(imagesCleanupLockName, shluz.LockOptions{Timeout: time.Second * 600}, func() error {
 		repoImagesByImageName, err := repoImagesByImageName(options.CommonRepoOptions)
 		if err != nil {
 			return err
@@ -69,7 +89,7 @@ func imagesCleanup(options ImagesCleanupOptions) error {
 		if options.LocalGit != nil {
 			if !options.WithoutKube {
 				if err := logboek.LogProcess("Skipping repo images that are being used in Kubernetes", logboek.LogProcessOptions{}, func() error {
-					repoImagesByImageName, err = exceptRepoImagesByWhitelist(repoImagesByImageName, options.KubernetesContextsClients)
+					repoImagesByImageName, err = exceptRepoImagesByWhitelist(repoImagesByImageName, options.KubernetesContextsClients, options.KubernetesImagesOptions)
 					return err
 				}); err != nil {
 					return err
@@ -82,17 +102,36 @@ func imagesCleanup(options ImagesCleanupOptions) error {
 					logProcessMessage,
 					logboek.LevelLogProcessOptions{Style: logboek.HighlightStyle()},
 					func() error {
+						var report *cleanupRulesReport
+						var keptRepoImages []docker_registry.RepoImage
+						if len(options.Rules) != 0 {
+							report = newCleanupRulesReport(imageName)
+							keptRepoImages, repoImages, err = exceptRepoImagesByAlwaysKeepRules(imageName, repoImages, options.Rules, report)
+							if err != nil {
+								return err
+							}
+						}
+
 						repoImages, err = repoImagesCleanupByNonexistentGitPrimitive(repoImages, options)
 						if err != nil {
 							return err
 						}
 
-						repoImages, err = repoImagesCleanupByPolicies(repoImages, options)
-						if err != nil {
-							return err
+						if len(options.Rules) != 0 {
+							repoImages, err = repoImagesCleanupByRules(imageName, repoImages, options, report)
+							if err != nil {
+								return err
+							}
+
+							report.print(options.CommonRepoOptions.DryRun)
+						} else {
+							repoImages, err = repoImagesCleanupByPolicies(repoImages, options)
+							if err != nil {
+								return err
+							}
 						}
 
-						repoImagesByImageName[imageName] = repoImages
+						repoImagesByImageName[imageName] = append(repoImages, keptRepoImages...)
 
 						return nil
 					},
@@ -106,11 +145,11 @@ func imagesCleanup(options ImagesCleanupOptions) error {
 	})
 }
 
-func exceptRepoImagesByWhitelist(repoImagesByImageName map[string][]docker_registry.RepoImage, kubernetesContextsClients map[string]kubernetes.Interface) (map[string][]docker_registry.RepoImage, error) {
+func exceptRepoImagesByWhitelist(repoImagesByImageName map[string][]docker_registry.RepoImage, kubernetesContextsClients map[string]kubernetes.Interface, kubernetesImagesOptions KubernetesImagesOptions) (map[string][]docker_registry.RepoImage, error) {
 	var deployedDockerImagesNames []string
 	for contextName, kubernetesClient := range kubernetesContextsClients {
 		if err := logboek.LogProcessInline(fmt.Sprintf("Getting deployed docker images (context %s)", contextName), logboek.LogProcessInlineOptions{}, func() error {
-			kubernetesClientDeployedDockerImagesNames, err := deployedDockerImages(kubernetesClient)
+			kubernetesClientDeployedDockerImagesNames, err := deployedDockerImages(kubernetesClient, kubernetesImagesOptions)
 			if err != nil {
 				return fmt.Errorf("cannot get deployed images: %s", err)
 			}
@@ -188,6 +227,17 @@ Loop:
 			} else {
 				nonexistentGitTagRepoImages = append(nonexistentGitTagRepoImages, repoImage)
 			}
+		case string(tag_strategy.Semver):
+			gitTag, ok := labels[image.WerfTagSemverGitTagLabel]
+			if !ok {
+				continue Loop
+			}
+
+			if util.IsStringsContainValue(gitTags, gitTag) {
+				continue Loop
+			} else {
+				nonexistentGitTagRepoImages = append(nonexistentGitTagRepoImages, repoImage)
+			}
 		case string(tag_strategy.GitBranch):
 			if repoImageMetaTagMatch(repoImageMetaTag, gitBranches...) {
 				continue Loop
@@ -271,8 +321,16 @@ func repoImageMetaTagMatch(imageMetaTag string, matches ...string) bool {
 	return false
 }
 
-func repoImagesCleanupByPolicies(repoImages []docker_registry.RepoImage, options ImagesCleanupOptions) ([]docker_registry.RepoImage, error) {
-	var repoImagesWithGitTagScheme, repoImagesWithGitCommitScheme, repoImagesWithStagesSignatureScheme []docker_registry.RepoImage
+// repoImagesByTagStrategy groups repo images by the tagging strategy label.
+// MAJOR and MAJOR.MINOR alias tags share the image with the full version tag,
+// so only full version tags, which are not referenced by aliases, are subject to the semver policies.
+// Meta tags are compared, because the repo tag of the monorepo image is prefixed with the image name
+func repoImagesByTagStrategy(repoImages []docker_registry.RepoImage) (map[tag_strategy.TagStrategy][]docker_registry.RepoImage, error) {
+	res := map[tag_strategy.TagStrategy][]docker_registry.RepoImage{}
+
+	var repoImagesWithSemverScheme []docker_registry.RepoImage
+	var repoImagesWithSemverSchemeVersions []string
+	semverAliasedVersions := map[string]bool{}
 
 	for _, repoImage := range repoImages {
 		labels, err := repoImageLabels(repoImage)
@@ -285,16 +343,41 @@ func repoImagesCleanupByPolicies(repoImages []docker_registry.RepoImage, options
 			continue
 		}
 
-		switch strategy {
-		case string(tag_strategy.GitTag):
-			repoImagesWithGitTagScheme = append(repoImagesWithGitTagScheme, repoImage)
-		case string(tag_strategy.GitCommit):
-			repoImagesWithGitCommitScheme = append(repoImagesWithGitCommitScheme, repoImage)
-		case string(tag_strategy.StagesSignature):
-			repoImagesWithStagesSignatureScheme = append(repoImagesWithStagesSignatureScheme, repoImage)
+		if strategy == string(tag_strategy.Semver) {
+			repoImageMetaTag, ok := labels[image.WerfImageTagLabel]
+			if !ok {
+				repoImageMetaTag = repoImage.Tag
+			}
+
+			version := labels[image.WerfTagSemverLabel]
+			if repoImageMetaTag == version {
+				repoImagesWithSemverScheme = append(repoImagesWithSemverScheme, repoImage)
+				repoImagesWithSemverSchemeVersions = append(repoImagesWithSemverSchemeVersions, version)
+			} else {
+				semverAliasedVersions[version] = true
+			}
+
+			continue
+		}
+
+		res[tag_strategy.TagStrategy(strategy)] = append(res[tag_strategy.TagStrategy(strategy)], repoImage)
+	}
+
+	for ind, repoImage := range repoImagesWithSemverScheme {
+		if !semverAliasedVersions[repoImagesWithSemverSchemeVersions[ind]] {
+			res[tag_strategy.Semver] = append(res[tag_strategy.Semver], repoImage)
 		}
 	}
 
+	return res, nil
+}
+
+func repoImagesCleanupByPolicies(repoImages []docker_registry.RepoImage, options ImagesCleanupOptions) ([]docker_registry.RepoImage, error) {
+	repoImagesByStrategy, err := repoImagesByTagStrategy(repoImages)
+	if err != nil {
+		return nil, err
+	}
+
 	cleanupByPolicyOptions := repoImagesCleanupByPolicyOptions{
 		hasLimit:          options.Policies.GitTagStrategyHasLimit,
 		limit:             options.Policies.GitTagStrategyLimit,
@@ -304,8 +387,7 @@ func repoImagesCleanupByPolicies(repoImages []docker_registry.RepoImage, options
 		commonRepoOptions: options.CommonRepoOptions,
 	}
 
-	var err error
-	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesWithGitTagScheme, cleanupByPolicyOptions)
+	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesByStrategy[tag_strategy.GitTag], cleanupByPolicyOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -319,7 +401,7 @@ func repoImagesCleanupByPolicies(repoImages []docker_registry.RepoImage, options
 		commonRepoOptions: options.CommonRepoOptions,
 	}
 
-	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesWithGitCommitScheme, cleanupByPolicyOptions)
+	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesByStrategy[tag_strategy.GitCommit], cleanupByPolicyOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -333,7 +415,35 @@ func repoImagesCleanupByPolicies(repoImages []docker_registry.RepoImage, options
 		commonRepoOptions: options.CommonRepoOptions,
 	}
 
-	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesWithStagesSignatureScheme, cleanupByPolicyOptions)
+	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesByStrategy[tag_strategy.StagesSignature], cleanupByPolicyOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanupByPolicyOptions = repoImagesCleanupByPolicyOptions{
+		hasLimit:          options.Policies.SemverStrategyHasLimit,
+		limit:             options.Policies.SemverStrategyLimit,
+		hasExpiryPeriod:   options.Policies.SemverStrategyHasExpiryPeriod,
+		expiryPeriod:      options.Policies.SemverStrategyExpiryPeriod,
+		schemeName:        string(tag_strategy.Semver),
+		commonRepoOptions: options.CommonRepoOptions,
+	}
+
+	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesByStrategy[tag_strategy.Semver], cleanupByPolicyOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanupByPolicyOptions = repoImagesCleanupByPolicyOptions{
+		hasLimit:          options.Policies.TemplateStrategyHasLimit,
+		limit:             options.Policies.TemplateStrategyLimit,
+		hasExpiryPeriod:   options.Policies.TemplateStrategyHasExpiryPeriod,
+		expiryPeriod:      options.Policies.TemplateStrategyExpiryPeriod,
+		schemeName:        string(tag_strategy.Template),
+		commonRepoOptions: options.CommonRepoOptions,
+	}
+
+	repoImages, err = repoImagesCleanupByPolicy(repoImages, repoImagesByStrategy[tag_strategy.Template], cleanupByPolicyOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -420,7 +530,7 @@ func repoImagesCleanupByPolicy(repoImages, repoImagesWithScheme []docker_registr
 	return repoImages, nil
 }
 
-func deployedDockerImages(kubernetesClient kubernetes.Interface) ([]string, error) {
+func deployedDockerImages(kubernetesClient kubernetes.Interface, options KubernetesImagesOptions) ([]string, error) {
 	var deployedDockerImages []string
 
 	images, err := getPodsImages(kubernetesClient)
@@ -479,6 +589,24 @@ func deployedDockerImages(kubernetesClient kubernetes.Interface) ([]string, erro
 
 	deployedDockerImages = append(deployedDockerImages, images...)
 
+	if options.KeepHelmReleaseRevisions > 0 {
+		images, err = getHelmReleasesHistoryImages(kubernetesClient, options)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get helm releases history images: %s", err)
+		}
+
+		deployedDockerImages = append(deployedDockerImages, images...)
+	}
+
+	for _, resourceImagesPath := range options.ResourcesImagesPaths {
+		images, err = getResourcesImages(kubernetesClient, resourceImagesPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get %s images: %s", resourceImagesPath.GroupVersionResource.String(), err)
+		}
+
+		deployedDockerImages = append(deployedDockerImages, images...)
+	}
+
 	return deployedDockerImages, nil
 }
 
@@ -0,0 +1,230 @@
+package cleaning
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/jsonpath"
+	rspb "k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage/driver"
+
+	"github.com/flant/werf/pkg/deploy/helm"
+)
+
+type KubernetesImagesOptions struct {
+	// KeepHelmReleaseRevisions protects images of the last N revisions of every helm release (0 disables)
+	KeepHelmReleaseRevisions    int64
+	HelmReleaseStorageNamespace string
+	HelmReleaseStorageType      string
+
+	ResourcesImagesPaths []ResourceImagesPath
+}
+
+// ResourceImagesPath is a JSONPath to the images of the custom resources,
+// e.g. argoproj.io/v1alpha1/rollouts={.spec.template.spec.containers[*].image}
+type ResourceImagesPath struct {
+	GroupVersionResource schema.GroupVersionResource
+	JSONPath             string
+}
+
+func (p ResourceImagesPath) String() string {
+	return fmt.Sprintf("%s=%s", strings.TrimPrefix(strings.Join([]string{p.GroupVersionResource.Group, p.GroupVersionResource.Version, p.GroupVersionResource.Resource}, "/"), "/"), p.JSONPath)
+}
+
+// ParseResourceImagesPath parses GROUP/VERSION/RESOURCE=JSONPATH (VERSION/RESOURCE=JSONPATH for the core group)
+func ParseResourceImagesPath(value string) (ResourceImagesPath, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return ResourceImagesPath{}, fmt.Errorf("bad resource images path %q: expected GROUP/VERSION/RESOURCE=JSONPATH", value)
+	}
+
+	var gvr schema.GroupVersionResource
+	resourceParts := strings.Split(parts[0], "/")
+	switch len(resourceParts) {
+	case 2:
+		gvr = schema.GroupVersionResource{Version: resourceParts[0], Resource: resourceParts[1]}
+	case 3:
+		gvr = schema.GroupVersionResource{Group: resourceParts[0], Version: resourceParts[1], Resource: resourceParts[2]}
+	default:
+		return ResourceImagesPath{}, fmt.Errorf("bad resource images path %q: expected GROUP/VERSION/RESOURCE=JSONPATH", value)
+	}
+
+	for _, part := range resourceParts {
+		if part == "" {
+			return ResourceImagesPath{}, fmt.Errorf("bad resource images path %q: expected GROUP/VERSION/RESOURCE=JSONPATH", value)
+		}
+	}
+
+	path := parts[1]
+	if !strings.HasPrefix(path, "{") {
+		path = fmt.Sprintf("{%s}", path)
+	}
+
+	if err := jsonpath.New("images").Parse(path); err != nil {
+		return ResourceImagesPath{}, fmt.Errorf("bad resource images path %q: %s", value, err)
+	}
+
+	return ResourceImagesPath{GroupVersionResource: gvr, JSONPath: path}, nil
+}
+
+func getHelmReleasesHistoryImages(kubernetesClient kubernetes.Interface, options KubernetesImagesOptions) ([]string, error) {
+	var releaseStorage driver.Driver
+	switch options.HelmReleaseStorageType {
+	case helm.SecretStorage:
+		releaseStorage = driver.NewSecrets(kubernetesClient.CoreV1().Secrets(options.HelmReleaseStorageNamespace))
+	case helm.Helm3Storage:
+		// Helm 3 releases are stored in the namespaces of the releases, images of releases of all namespaces are kept
+		releaseStorage = helm.NewHelm3Secrets(kubernetesClient.CoreV1().Secrets(metav1.NamespaceAll))
+	default:
+		releaseStorage = driver.NewConfigMaps(kubernetesClient.CoreV1().ConfigMaps(options.HelmReleaseStorageNamespace))
+	}
+
+	releases, err := releaseStorage.List(func(_ *rspb.Release) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, release := range lastHelmReleasesRevisions(releases, options.KeepHelmReleaseRevisions) {
+		manifests := []string{release.Manifest}
+		for _, hook := range release.Hooks {
+			manifests = append(manifests, hook.Manifest)
+		}
+
+		for _, manifest := range manifests {
+			manifestImages, err := manifestImages(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse release %s revision %d manifest: %s", release.Name, release.Version, err)
+			}
+
+			images = append(images, manifestImages...)
+		}
+	}
+
+	return images, nil
+}
+
+func lastHelmReleasesRevisions(releases []*rspb.Release, revisionsNumber int64) []*rspb.Release {
+	releasesByName := map[string][]*rspb.Release{}
+	for _, release := range releases {
+		releasesByName[release.Name] = append(releasesByName[release.Name], release)
+	}
+
+	var result []*rspb.Release
+	for _, releaseRevisions := range releasesByName {
+		sort.Slice(releaseRevisions, func(i, j int) bool {
+			return releaseRevisions[i].Version > releaseRevisions[j].Version
+		})
+
+		if int64(len(releaseRevisions)) > revisionsNumber {
+			releaseRevisions = releaseRevisions[:revisionsNumber]
+		}
+
+		result = append(result, releaseRevisions...)
+	}
+
+	return result
+}
+
+// manifestImages returns values of all image fields of the manifest yaml documents
+func manifestImages(manifest string) ([]string, error) {
+	var images []string
+
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(manifest)))
+	for {
+		var obj interface{}
+		if err := decoder.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		images = append(images, objectImages(obj)...)
+	}
+
+	return images, nil
+}
+
+func objectImages(obj interface{}) []string {
+	var images []string
+
+	switch value := obj.(type) {
+	case map[interface{}]interface{}:
+		for key, fieldValue := range value {
+			if key == "image" {
+				if image, ok := fieldValue.(string); ok {
+					images = append(images, image)
+					continue
+				}
+			}
+
+			images = append(images, objectImages(fieldValue)...)
+		}
+	case []interface{}:
+		for _, item := range value {
+			images = append(images, objectImages(item)...)
+		}
+	}
+
+	return images
+}
+
+func getResourcesImages(kubernetesClient kubernetes.Interface, resourceImagesPath ResourceImagesPath) ([]string, error) {
+	gvr := resourceImagesPath.GroupVersionResource
+
+	var absPath []string
+	if gvr.Group == "" {
+		absPath = []string{"/api", gvr.Version, gvr.Resource}
+	} else {
+		absPath = []string{"/apis", gvr.Group, gvr.Version, gvr.Resource}
+	}
+
+	data, err := kubernetesClient.Discovery().RESTClient().Get().AbsPath(absPath...).DoRaw()
+	if err != nil {
+		// the resource may be not installed in the cluster
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	list := struct {
+		Items []interface{} `json:"items"`
+	}{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal %s list: %s", gvr.String(), err)
+	}
+
+	jp := jsonpath.New("images").AllowMissingKeys(true)
+	if err := jp.Parse(resourceImagesPath.JSONPath); err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, item := range list.Items {
+		results, err := jp.FindResults(item)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range results {
+			for _, value := range result {
+				if image, ok := value.Interface().(string); ok {
+					images = append(images, image)
+				}
+			}
+		}
+	}
+
+	return images, nil
+}
@@ -0,0 +1,117 @@
+package cleaning
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	rspb "k8s.io/helm/pkg/proto/hapi/release"
+)
+
+func TestParseResourceImagesPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		result ResourceImagesPath
+	}{
+		{
+			name:  "group",
+			value: "argoproj.io/v1alpha1/rollouts={.spec.template.spec.containers[*].image}",
+			result: ResourceImagesPath{
+				GroupVersionResource: schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"},
+				JSONPath:             "{.spec.template.spec.containers[*].image}",
+			},
+		},
+		{
+			name:  "coreGroup",
+			value: "v1/replicationcontrollers=.spec.template.spec.containers[*].image",
+			result: ResourceImagesPath{
+				GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "replicationcontrollers"},
+				JSONPath:             "{.spec.template.spec.containers[*].image}",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ParseResourceImagesPath(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(result, test.result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.result, result)
+			}
+		})
+	}
+}
+
+func TestParseResourceImagesPathBadValue(t *testing.T) {
+	for _, value := range []string{"", "rollouts", "argoproj.io/v1alpha1/rollouts", "argoproj.io/v1alpha1/rollouts=", "a/b/c/d={.image}", "argoproj.io//rollouts={.image}", "v1/pods={.spec.containers[*}"} {
+		if _, err := ParseResourceImagesPath(value); err == nil {
+			t.Errorf("expected error for value %q", value)
+		}
+	}
+}
+
+func TestManifestImages(t *testing.T) {
+	manifest := `
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: registry/app:init
+      containers:
+      - name: app
+        image: registry/app:1
+---
+# Source: chart/templates/empty.yaml
+---
+apiVersion: batch/v1
+kind: Job
+spec:
+  template:
+    spec:
+      containers:
+      - name: job
+        image: registry/job:1
+`
+
+	result, err := manifestImages(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(result)
+
+	expected := []string{"registry/app:1", "registry/app:init", "registry/job:1"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, result)
+	}
+}
+
+func TestLastHelmReleasesRevisions(t *testing.T) {
+	var releases []*rspb.Release
+	for _, name := range []string{"app", "db"} {
+		for version := int32(1); version <= 4; version++ {
+			releases = append(releases, &rspb.Release{Name: name, Version: version})
+		}
+	}
+	releases = append(releases, &rspb.Release{Name: "single", Version: 1})
+
+	var result []string
+	for _, release := range lastHelmReleasesRevisions(releases, 2) {
+		result = append(result, fmt.Sprintf("%s.v%d", release.Name, release.Version))
+	}
+	sort.Strings(result)
+
+	expected := []string{"app.v3", "app.v4", "db.v3", "db.v4", "single.v1"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, result)
+	}
+}
@@ -0,0 +1,176 @@
+package cleaning
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/logging"
+	"github.com/flant/werf/pkg/tag_strategy"
+)
+
+type cleanupRulesReport struct {
+	imageName string
+	records   []*cleanupRuleReportRecord
+}
+
+type cleanupRuleReportRecord struct {
+	rule    *config.CleanupRule
+	kept    []string
+	removed []string
+}
+
+func newCleanupRulesReport(imageName string) *cleanupRulesReport {
+	return &cleanupRulesReport{imageName: imageName}
+}
+
+func (report *cleanupRulesReport) addRecord(rule *config.CleanupRule, kept, removed []docker_registry.RepoImage) {
+	record := &cleanupRuleReportRecord{rule: rule}
+
+	for _, repoImage := range kept {
+		record.kept = append(record.kept, repoImage.Tag)
+	}
+
+	for _, repoImage := range removed {
+		record.removed = append(record.removed, repoImage.Tag)
+	}
+
+	report.records = append(report.records, record)
+}
+
+func (report *cleanupRulesReport) print(dryRun bool) {
+	if len(report.records) == 0 {
+		return
+	}
+
+	blockMessage := fmt.Sprintf("Cleanup rules report for image %s", logging.ImageLogName(report.imageName, false))
+	removedTitle := "removed"
+	if dryRun {
+		blockMessage += " (dry run)"
+		removedTitle = "would be removed"
+	}
+
+	_ = logboek.Default.LogBlock(blockMessage, logboek.LevelLogBlockOptions{}, func() error {
+		for ind, record := range report.records {
+			logboek.LogF("Rule #%d: %s\n", ind+1, record.rule.String())
+			logboek.Default.LogFDetails("  kept: %s\n", cleanupRulesReportTagsString(record.kept))
+			logboek.Default.LogFDetails("  %s: %s\n", removedTitle, cleanupRulesReportTagsString(record.removed))
+		}
+
+		return nil
+	})
+}
+
+func cleanupRulesReportTagsString(tags []string) string {
+	if len(tags) == 0 {
+		return "-"
+	}
+
+	return strings.Join(tags, ", ")
+}
+
+// exceptRepoImagesByAlwaysKeepRules returns repo images which meta tags match alwaysKeep rules patterns and the rest repo images
+func exceptRepoImagesByAlwaysKeepRules(imageName string, repoImages []docker_registry.RepoImage, rules []*config.CleanupRule, report *cleanupRulesReport) ([]docker_registry.RepoImage, []docker_registry.RepoImage, error) {
+	var keptRepoImages []docker_registry.RepoImage
+
+	for _, rule := range rules {
+		if len(rule.AlwaysKeep) == 0 || !rule.IsImageMatched(imageName) {
+			continue
+		}
+
+		var ruleKeptRepoImages []docker_registry.RepoImage
+		for _, repoImage := range repoImages {
+			labels, err := repoImageLabels(repoImage)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			repoImageMetaTag, ok := labels[image.WerfImageTagLabel]
+			if !ok {
+				repoImageMetaTag = repoImage.Tag
+			}
+
+			for _, pattern := range rule.AlwaysKeep {
+				if pattern.MatchString(repoImageMetaTag) {
+					ruleKeptRepoImages = append(ruleKeptRepoImages, repoImage)
+					break
+				}
+			}
+		}
+
+		report.addRecord(rule, ruleKeptRepoImages, nil)
+
+		keptRepoImages = append(keptRepoImages, ruleKeptRepoImages...)
+		repoImages = exceptRepoImages(repoImages, ruleKeptRepoImages...)
+	}
+
+	return keptRepoImages, repoImages, nil
+}
+
+// repoImagesCleanupByRules applies werf.yaml cleanup rules instead of the tagging strategies policies.
+// Rules are evaluated in order, each repo image is handled by the first matching rule
+func repoImagesCleanupByRules(imageName string, repoImages []docker_registry.RepoImage, options ImagesCleanupOptions, report *cleanupRulesReport) ([]docker_registry.RepoImage, error) {
+	repoImagesByStrategy, err := repoImagesByTagStrategy(repoImages)
+	if err != nil {
+		return nil, err
+	}
+
+	handledRepoImages := map[string]bool{}
+
+	for _, rule := range options.Rules {
+		if len(rule.AlwaysKeep) != 0 || !rule.IsImageMatched(imageName) {
+			continue
+		}
+
+		var ruleRepoImages []docker_registry.RepoImage
+		for _, repoImage := range repoImagesByStrategy[tag_strategy.TagStrategy(rule.TagStrategy)] {
+			if handledRepoImages[repoImage.Tag] {
+				continue
+			}
+
+			if rule.Branch != nil {
+				labels, err := repoImageLabels(repoImage)
+				if err != nil {
+					return nil, err
+				}
+
+				repoImageMetaTag, ok := labels[image.WerfImageTagLabel]
+				if !ok {
+					repoImageMetaTag = repoImage.Tag
+				}
+
+				if !rule.Branch.MatchString(repoImageMetaTag) {
+					continue
+				}
+			}
+
+			handledRepoImages[repoImage.Tag] = true
+			ruleRepoImages = append(ruleRepoImages, repoImage)
+		}
+
+		cleanupByPolicyOptions := repoImagesCleanupByPolicyOptions{
+			hasLimit:          rule.HasKeepLast,
+			limit:             rule.KeepLast,
+			hasExpiryPeriod:   rule.HasExpiryPeriod,
+			expiryPeriod:      rule.ExpiryPeriod,
+			schemeName:        fmt.Sprintf("cleanup rule (%s)", rule.String()),
+			commonRepoOptions: options.CommonRepoOptions,
+		}
+
+		resultRepoImages, err := repoImagesCleanupByPolicy(repoImages, ruleRepoImages, cleanupByPolicyOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		removedRepoImages := exceptRepoImages(repoImages, resultRepoImages...)
+		report.addRecord(rule, exceptRepoImages(ruleRepoImages, removedRepoImages...), removedRepoImages)
+
+		repoImages = resultRepoImages
+	}
+
+	return repoImages, nil
+}
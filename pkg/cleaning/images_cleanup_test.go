@@ -0,0 +1,114 @@
+package cleaning
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/tag_strategy"
+)
+
+func testRepoImage(t *testing.T, tag string, labels map[string]string) docker_registry.RepoImage {
+	configFile, err := empty.Image.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile = configFile.DeepCopy()
+	configFile.Config.Labels = labels
+
+	img, err := mutate.ConfigFile(empty.Image, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return docker_registry.RepoImage{Repository: "registry.example.com/project", Tag: tag, Image: img}
+}
+
+func TestRepoImagesByTagStrategy(t *testing.T) {
+	semverLabels := func(metaTag, version string) map[string]string {
+		return map[string]string{
+			image.WerfTagStrategyLabel: string(tag_strategy.Semver),
+			image.WerfImageTagLabel:    metaTag,
+			image.WerfTagSemverLabel:   version,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		tagPrefix  string
+		semverTags []string
+	}{
+		{name: "singleRepo", semverTags: []string{"1.1.0"}},
+		{name: "monorepo", tagPrefix: "backend-", semverTags: []string{"backend-1.1.0"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repoImages := []docker_registry.RepoImage{
+				testRepoImage(t, test.tagPrefix+"1.2.3", semverLabels("1.2.3", "1.2.3")),
+				testRepoImage(t, test.tagPrefix+"1.2", semverLabels("1.2", "1.2.3")),
+				testRepoImage(t, test.tagPrefix+"1", semverLabels("1", "1.2.3")),
+				testRepoImage(t, test.tagPrefix+"1.1.0", semverLabels("1.1.0", "1.1.0")),
+				testRepoImage(t, test.tagPrefix+"master", map[string]string{
+					image.WerfTagStrategyLabel: string(tag_strategy.GitBranch),
+					image.WerfImageTagLabel:    "master",
+				}),
+			}
+
+			res, err := repoImagesByTagStrategy(repoImages)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var semverTags []string
+			for _, repoImage := range res[tag_strategy.Semver] {
+				semverTags = append(semverTags, repoImage.Tag)
+			}
+
+			if !reflect.DeepEqual(semverTags, test.semverTags) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.semverTags, semverTags)
+			}
+
+			if len(res[tag_strategy.GitBranch]) != 1 || res[tag_strategy.GitBranch][0].Tag != test.tagPrefix+"master" {
+				t.Errorf("expected git branch image %smaster, got %v", test.tagPrefix, res[tag_strategy.GitBranch])
+			}
+		})
+	}
+}
+
+func TestExceptRepoImagesByAlwaysKeepRules(t *testing.T) {
+	rules := []*config.CleanupRule{{AlwaysKeep: []*regexp.Regexp{regexp.MustCompile(`^release-`)}}}
+
+	repoImages := []docker_registry.RepoImage{
+		testRepoImage(t, "backend-release-1", map[string]string{image.WerfImageTagLabel: "release-1"}),
+		testRepoImage(t, "backend-master", map[string]string{image.WerfImageTagLabel: "master"}),
+		testRepoImage(t, "release-2", map[string]string{}),
+	}
+
+	kept, rest, err := exceptRepoImagesByAlwaysKeepRules("backend", repoImages, rules, newCleanupRulesReport("backend"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keptTags, restTags []string
+	for _, repoImage := range kept {
+		keptTags = append(keptTags, repoImage.Tag)
+	}
+	for _, repoImage := range rest {
+		restTags = append(restTags, repoImage.Tag)
+	}
+
+	if expected := []string{"backend-release-1", "release-2"}; !reflect.DeepEqual(keptTags, expected) {
+		t.Errorf("kept:\n[EXPECTED]: %v\n[GOT]: %v", expected, keptTags)
+	}
+
+	if expected := []string{"backend-master"}; !reflect.DeepEqual(restTags, expected) {
+		t.Errorf("rest:\n[EXPECTED]: %v\n[GOT]: %v", expected, restTags)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/flant/werf/pkg/storage"
+	"github.com/flant/werf/pkg/werf"
 
 	"github.com/docker/docker/api/types"
 
@@ -56,7 +57,7 @@ func stagesCleanup(options StagesCleanupOptions) error {
 	}
 
 	projectStagesCleanupLockName := fmt.Sprintf("stages-cleanup.%s", commonProjectOptions.ProjectName)
-	return shluz.WithLock(projectStagesCleanupLockName, shluz.LockOptions{Timeout: time.Second * 600}, func() error {
+	return werf.WithHostLock(projectStagesCleanupLockName, shluz.LockOptions{Timeout: time.Second * 600}, func() error {
 		repoImages, err := repoImages(commonRepoOptions)
 		if err != nil {
 			return err
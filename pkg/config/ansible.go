@@ -10,6 +10,11 @@ type Ansible struct {
 	InstallCacheVersion       string
 	BeforeSetupCacheVersion   string
 	SetupCacheVersion         string
+	// Roles and Library are the project directories with ansible roles and custom modules
+	Roles   []string
+	Library []string
+	// Requirements is the project requirements.yml with galaxy roles and collections, which are resolved at build time
+	Requirements string
 
 	raw *rawAnsible
 }
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Cleanup struct {
+	Rules []*CleanupRule
+}
+
+// CleanupRule is applied to the tags of the Images (all images if empty).
+// Rule either keeps tags matching AlwaysKeep patterns
+// or limits tags published with the TagStrategy (with the git-branch tagging strategy and matching Branch regexp)
+// by the number of the last tags and by the expiry period
+type CleanupRule struct {
+	Images []string
+
+	Branch      *regexp.Regexp
+	TagStrategy string
+
+	HasKeepLast bool
+	KeepLast    int64
+
+	HasExpiryPeriod bool
+	ExpiryPeriod    time.Duration
+
+	AlwaysKeep []*regexp.Regexp
+
+	raw *rawCleanupRule
+}
+
+func (r *CleanupRule) IsImageMatched(imageName string) bool {
+	if len(r.Images) == 0 {
+		return true
+	}
+
+	for _, name := range r.Images {
+		if name == imageName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *CleanupRule) String() string {
+	var parts []string
+
+	if len(r.Images) != 0 {
+		parts = append(parts, fmt.Sprintf("images %s", strings.Join(r.Images, ", ")))
+	}
+
+	if len(r.AlwaysKeep) != 0 {
+		var patterns []string
+		for _, pattern := range r.AlwaysKeep {
+			patterns = append(patterns, pattern.String())
+		}
+
+		parts = append(parts, fmt.Sprintf("always keep %s", strings.Join(patterns, ", ")))
+
+		return strings.Join(parts, ", ")
+	}
+
+	if r.Branch != nil {
+		parts = append(parts, fmt.Sprintf("branch /%s/", r.Branch.String()))
+	} else {
+		parts = append(parts, fmt.Sprintf("tagStrategy %s", r.TagStrategy))
+	}
+
+	if r.HasKeepLast {
+		parts = append(parts, fmt.Sprintf("keep last %d", r.KeepLast))
+	}
+
+	if r.HasExpiryPeriod {
+		parts = append(parts, fmt.Sprintf("expiry %d days", int64(r.ExpiryPeriod/(time.Hour*24))))
+	}
+
+	return strings.Join(parts, ", ")
+}
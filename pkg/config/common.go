@@ -5,6 +5,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/flant/werf/pkg/platform"
 	"github.com/flant/werf/pkg/util"
 )
 
@@ -71,6 +72,16 @@ func oneOrNone(conditions []bool) bool {
 	return true
 }
 
+func validatePlatforms(platforms []string, configSection interface{}, doc *doc) error {
+	for _, p := range platforms {
+		if err := platform.Validate(p); err != nil {
+			return newDetailedConfigError(fmt.Sprintf("invalid platform `%s`: expected `OS/ARCH[/VARIANT]` (e.g. `linux/amd64` or `linux/arm64/v8`)!", p), configSection, doc)
+		}
+	}
+
+	return nil
+}
+
 func InterfaceToStringArray(stringOrStringArray interface{}, configSection interface{}, doc *doc) ([]string, error) {
 	if stringOrStringArray == nil {
 		return []string{}, nil
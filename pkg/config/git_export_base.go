@@ -8,6 +8,7 @@ import (
 type GitExportBase struct {
 	*GitExport
 	StageDependencies *StageDependencies
+	LFS               bool
 }
 
 func (c *ExportBase) GitMappingAdd() string {
@@ -7,6 +7,12 @@ type ImageFromDockerfile struct {
 	Target     string
 	Args       map[string]interface{}
 	AddHost    []string
+	SSH        []string
+	Secrets    []string
+	Network    string
+	CacheFrom  []string
+	Labels     map[string]string
+	Platform   []string
 
 	raw *rawImageFromDockerfile
 }
@@ -14,3 +20,7 @@ type ImageFromDockerfile struct {
 func (c *ImageFromDockerfile) GetName() string {
 	return c.Name
 }
+
+func (c *ImageFromDockerfile) GetPlatforms() []string {
+	return c.Platform
+}
@@ -4,4 +4,6 @@ type Meta struct {
 	ConfigVersion   int
 	Project         string
 	DeployTemplates DeployTemplates
+	Cleanup         Cleanup
+	Secrets         Secrets
 }
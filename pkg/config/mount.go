@@ -9,6 +9,10 @@ type Mount struct {
 	From string
 	Type string
 
+	// Id and Sharing are set only for the cache mount: caches with the same id are shared between images of the project
+	Id      string
+	Sharing string
+
 	raw *rawMount
 }
 
@@ -19,8 +23,14 @@ func (c *Mount) validate() error {
 		if c.From == "" {
 			return newDetailedConfigError("`fromPath: PATH` absolute or relative path required for mount!", c.raw, c.raw.rawStapelImage.doc)
 		}
+	} else if c.Type == "cache" {
+		if c.Id == "" {
+			return newDetailedConfigError("`id: ID` required for cache mount!", c.raw, c.raw.rawStapelImage.doc)
+		} else if c.Sharing != "shared" && c.Sharing != "locked" && c.Sharing != "private" {
+			return newDetailedConfigError(fmt.Sprintf("invalid `sharing: %s` for cache mount: expected `shared`, `locked` or `private`!", c.Sharing), c.raw, c.raw.rawStapelImage.doc)
+		}
 	} else if c.Type != "tmp_dir" && c.Type != "build_dir" {
-		return newDetailedConfigError(fmt.Sprintf("invalid `from: %s` for mount: expected `tmp_dir` or `build_dir`!", c.Type), c.raw, c.raw.rawStapelImage.doc)
+		return newDetailedConfigError(fmt.Sprintf("invalid `from: %s` for mount: expected `tmp_dir`, `build_dir` or `cache`!", c.Type), c.raw, c.raw.rawStapelImage.doc)
 	}
 	return nil
 }
@@ -490,6 +490,10 @@ func prepareWerfConfig(rawImages []*rawStapelImage, rawImagesFromDockerfile []*r
 		return nil, err
 	}
 
+	if err := werfConfig.validateImagesPlatforms(); err != nil {
+		return nil, err
+	}
+
 	return werfConfig, nil
 }
 
@@ -517,7 +521,10 @@ func splitByMetaAndRawImages(docs []*doc) (*Meta, []*rawStapelImage, []*rawImage
 				return nil, nil, nil, newYamlUnmarshalError(err, doc)
 			}
 
-			resultMeta = rawMeta.toMeta()
+			resultMeta, err = rawMeta.toMeta()
+			if err != nil {
+				return nil, nil, nil, err
+			}
 		} else if isImageFromDockerfileDoc(raw) {
 			imageFromDockerfile := &rawImageFromDockerfile{doc: doc}
 			err := yaml.UnmarshalStrict(doc.Content, &imageFromDockerfile)
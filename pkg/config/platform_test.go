@@ -0,0 +1,143 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type platformEntry struct {
+	config            string
+	expectedPlatforms map[string][]string
+	expectedError     bool
+}
+
+var _ = DescribeTable("parsing images platform", func(e platformEntry) {
+	docs, err := splitByDocs("project: test\nconfigVersion: 1\n---\n"+e.config, "werf.yaml")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	var werfConfig *WerfConfig
+	meta, rawStapelImages, rawImagesFromDockerfile, err := splitByMetaAndRawImages(docs)
+	if err == nil {
+		werfConfig, err = prepareWerfConfig(rawStapelImages, rawImagesFromDockerfile, meta)
+	}
+
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+		return
+	}
+	Ω(err).ShouldNot(HaveOccurred())
+
+	for name, expectedPlatforms := range e.expectedPlatforms {
+		var platforms []string
+		if image := werfConfig.GetImage(name); image != nil {
+			platforms = image.GetPlatforms()
+		} else {
+			platforms = werfConfig.GetArtifact(name).GetPlatforms()
+		}
+
+		Ω(platforms).Should(Equal(expectedPlatforms))
+	}
+},
+	Entry("stapel image and dockerfile image", platformEntry{
+		config: `
+image: app
+from: alpine
+platform: [linux/amd64, linux/arm64/v8]
+---
+image: web
+dockerfile: Dockerfile
+platform: linux/arm64
+`,
+		expectedPlatforms: map[string][]string{
+			"app": {"linux/amd64", "linux/arm64/v8"},
+			"web": {"linux/arm64"},
+		},
+	}),
+	Entry("image based on image without platform", platformEntry{
+		config: `
+artifact: builder
+from: golang
+---
+image: app
+fromImageArtifact: builder
+platform: linux/arm64
+`,
+		expectedPlatforms: map[string][]string{
+			"builder": {},
+			"app":     {"linux/arm64"},
+		},
+	}),
+	Entry("bad platform", platformEntry{
+		config: `
+image: app
+from: alpine
+platform: arm64
+`,
+		expectedError: true,
+	}),
+	Entry("import from artifact with other platform", platformEntry{
+		config: `
+artifact: builder
+from: golang
+platform: linux/amd64
+---
+image: app
+from: alpine
+platform: [linux/amd64, linux/arm64]
+import:
+- artifact: builder
+  add: /app
+  to: /app
+  after: install
+`,
+		expectedError: true,
+	}),
+	Entry("from image with other platform", platformEntry{
+		config: `
+image: base
+dockerfile: Dockerfile
+platform: linux/amd64
+---
+image: app
+fromImage: base
+platform: linux/arm64
+`,
+		expectedError: true,
+	}))
+
+type werfConfigPlatformsEntry struct {
+	config            string
+	expectedPlatforms []string
+}
+
+var _ = DescribeTable("collecting werf config platforms", func(e werfConfigPlatformsEntry) {
+	docs, err := splitByDocs("project: test\nconfigVersion: 1\n---\n"+e.config, "werf.yaml")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	meta, rawStapelImages, rawImagesFromDockerfile, err := splitByMetaAndRawImages(docs)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	werfConfig, err := prepareWerfConfig(rawStapelImages, rawImagesFromDockerfile, meta)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	Ω(werfConfig.GetPlatforms()).Should(Equal(e.expectedPlatforms))
+},
+	Entry("without platforms", werfConfigPlatformsEntry{
+		config: `
+image: app
+from: alpine
+`,
+		expectedPlatforms: nil,
+	}),
+	Entry("unique platforms in order", werfConfigPlatformsEntry{
+		config: `
+image: app
+from: alpine
+platform: [linux/amd64, linux/arm64]
+---
+image: web
+dockerfile: Dockerfile
+platform: [linux/arm64, linux/arm/v7]
+`,
+		expectedPlatforms: []string{"linux/amd64", "linux/arm64", "linux/arm/v7"},
+	}))
@@ -1,5 +1,11 @@
 package config
 
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
 type rawAnsible struct {
 	BeforeInstall             []rawAnsibleTask `yaml:"beforeInstall"`
 	Install                   []rawAnsibleTask `yaml:"install"`
@@ -10,6 +16,9 @@ type rawAnsible struct {
 	InstallCacheVersion       string           `yaml:"installCacheVersion,omitempty"`
 	BeforeSetupCacheVersion   string           `yaml:"beforeSetupCacheVersion,omitempty"`
 	SetupCacheVersion         string           `yaml:"setupCacheVersion,omitempty"`
+	Roles                     interface{}      `yaml:"roles,omitempty"`
+	Library                   interface{}      `yaml:"library,omitempty"`
+	Requirements              string           `yaml:"requirements,omitempty"`
 
 	rawImage *rawStapelImage `yaml:"-"` // parent
 
@@ -33,9 +42,22 @@ func (c *rawAnsible) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
+	// tasks are validated after the whole section is parsed, because supported modules depend on roles, library and requirements
+	for _, tasks := range [][]rawAnsibleTask{c.BeforeInstall, c.Install, c.BeforeSetup, c.Setup} {
+		for ind := range tasks {
+			if err := tasks[ind].validate(); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
+func (c *rawAnsible) rolesDefined() bool {
+	return c.Roles != nil || c.Requirements != ""
+}
+
 func (c *rawAnsible) toDirective() (ansible *Ansible, err error) {
 	ansible = &Ansible{}
 
@@ -44,6 +66,15 @@ func (c *rawAnsible) toDirective() (ansible *Ansible, err error) {
 	ansible.InstallCacheVersion = c.InstallCacheVersion
 	ansible.BeforeSetupCacheVersion = c.BeforeSetupCacheVersion
 	ansible.SetupCacheVersion = c.SetupCacheVersion
+	ansible.Requirements = c.Requirements
+
+	if ansible.Roles, err = InterfaceToStringArray(c.Roles, c, c.rawImage.doc); err != nil {
+		return nil, err
+	}
+
+	if ansible.Library, err = InterfaceToStringArray(c.Library, c, c.rawImage.doc); err != nil {
+		return nil, err
+	}
 
 	for ind := range c.BeforeInstall {
 		if ansibleTask, err := c.BeforeInstall[ind].toDirective(); err != nil {
@@ -87,9 +118,30 @@ func (c *rawAnsible) toDirective() (ansible *Ansible, err error) {
 }
 
 func (c *rawAnsible) validateDirective(ansible *Ansible) (err error) {
+	for _, roles := range ansible.Roles {
+		if !isProjectPath(roles) {
+			return newDetailedConfigError(fmt.Sprintf("ansible `roles` `%s` should be relative to the project directory!", roles), c, c.rawImage.doc)
+		}
+	}
+
+	for _, library := range ansible.Library {
+		if !isProjectPath(library) {
+			return newDetailedConfigError(fmt.Sprintf("ansible `library` `%s` should be relative to the project directory!", library), c, c.rawImage.doc)
+		}
+	}
+
+	if ansible.Requirements != "" && !isProjectPath(ansible.Requirements) {
+		return newDetailedConfigError(fmt.Sprintf("ansible `requirements` `%s` should be relative to the project directory!", ansible.Requirements), c, c.rawImage.doc)
+	}
+
 	if err := ansible.validate(); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func isProjectPath(p string) bool {
+	cleanPath := path.Clean(p)
+	return isRelativePath(p) && cleanPath != ".." && !strings.HasPrefix(cleanPath, "../")
+}
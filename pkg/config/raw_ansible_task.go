@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -30,30 +32,137 @@ func (c *rawAnsibleTask) UnmarshalYAML(unmarshal func(interface{}) error) error
 		return err
 	}
 
-	if !c.blockDefined() {
-		check := false
-		for _, supportedModule := range supportedModules() {
-			if c.Fields[supportedModule] != nil {
-				if check {
-					return newDetailedConfigError("invalid ansible task!", c, c.rawAnsible.rawImage.doc)
-				} else {
-					check = true
+	return nil
+}
+
+func (c *rawAnsibleTask) validate() error {
+	if c.blockDefined() {
+		for _, tasks := range [][]rawAnsibleTask{c.Block, c.Rescue, c.Always} {
+			for ind := range tasks {
+				if err := tasks[ind].validate(); err != nil {
+					return err
 				}
 			}
 		}
 
-		if !check {
-			var supportedModulesString string
-			for _, supportedModule := range supportedModules() {
-				supportedModulesString += fmt.Sprintf("* %s\n", supportedModule)
+		return nil
+	}
+
+	modules := supportedModules()
+	if c.rawAnsible.rolesDefined() {
+		modules = append(modules, roleModules()...)
+	}
+
+	check := false
+	for _, supportedModule := range modules {
+		if c.Fields[supportedModule] != nil || c.Fields[builtinModulesPrefix+supportedModule] != nil {
+			if check {
+				return newDetailedConfigError("invalid ansible task!", c, c.rawAnsible.rawImage.doc)
+			} else {
+				check = true
 			}
-			return newConfigError(fmt.Sprintf("unsupported ansible task!\n\n%s\nSupported modules list:\n%s\n%s", dumpConfigSection(c), supportedModulesString, dumpConfigDoc(c.rawAnsible.rawImage.doc)))
 		}
 	}
 
+	if !check && !c.customModuleDefined() {
+		var supportedModulesString string
+		for _, supportedModule := range modules {
+			supportedModulesString += fmt.Sprintf("* %s\n", supportedModule)
+		}
+		return newConfigError(fmt.Sprintf("unsupported ansible task!\n\n%s\nSupported modules list:\n%s\n%s", dumpConfigSection(c), supportedModulesString, dumpConfigDoc(c.rawAnsible.rawImage.doc)))
+	}
+
 	return nil
 }
 
+const builtinModulesPrefix = "ansible.builtin."
+
+var moduleNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// customModuleDefined checks the module of the task that is not in the supported modules list:
+// the module name is allowed with library directories and the fully qualified collection module name (namespace.collection.module) is allowed with requirements
+func (c *rawAnsibleTask) customModuleDefined() bool {
+	for key := range c.Fields {
+		if isAnsibleTaskKeyword(key) {
+			continue
+		}
+
+		parts := strings.Split(key, ".")
+		switch {
+		case len(parts) == 1 && moduleNameRegexp.MatchString(key):
+			if c.rawAnsible.Library != nil {
+				return true
+			}
+		case len(parts) == 3 && key != builtinModulesPrefix+parts[2]:
+			if c.rawAnsible.Requirements != "" && moduleNameRegexp.MatchString(parts[0]) && moduleNameRegexp.MatchString(parts[1]) && moduleNameRegexp.MatchString(parts[2]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isAnsibleTaskKeyword(key string) bool {
+	if strings.HasPrefix(key, "with_") {
+		return true
+	}
+
+	for _, keyword := range ansibleTaskKeywords() {
+		if key == keyword {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ansibleTaskKeywords() []string {
+	return []string{
+		"action",
+		"any_errors_fatal",
+		"args",
+		"async",
+		"become",
+		"become_exe",
+		"become_flags",
+		"become_method",
+		"become_user",
+		"changed_when",
+		"check_mode",
+		"collections",
+		"connection",
+		"debugger",
+		"delay",
+		"delegate_facts",
+		"delegate_to",
+		"diff",
+		"environment",
+		"failed_when",
+		"ignore_errors",
+		"ignore_unreachable",
+		"local_action",
+		"loop",
+		"loop_control",
+		"module_defaults",
+		"name",
+		"no_log",
+		"notify",
+		"poll",
+		"port",
+		"register",
+		"remote_user",
+		"retries",
+		"run_once",
+		"tags",
+		"throttle",
+		"timeout",
+		"until",
+		"vars",
+		"when",
+	}
+}
+
 func (c *rawAnsibleTask) blockDefined() bool {
 	return c.Block != nil || c.Rescue != nil || c.Always != nil
 }
@@ -151,6 +260,11 @@ func supportedModules() []string {
 	return modules
 }
 
+// roleModules are supported when ansible roles or requirements are specified
+func roleModules() []string {
+	return []string{"include_role", "import_role"}
+}
+
 func (c *rawAnsibleTask) toDirective() (*AnsibleTask, error) {
 	ansibleTask := &AnsibleTask{}
 
@@ -0,0 +1,206 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type ansibleEntry struct {
+	config               string
+	expectedRoles        []string
+	expectedLibrary      []string
+	expectedRequirements string
+	expectedError        bool
+}
+
+var _ = DescribeTable("parsing ansible roles, library and requirements", func(e ansibleEntry) {
+	docs, err := splitByDocs("project: test\nconfigVersion: 1\n---\n"+e.config, "werf.yaml")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	var werfConfig *WerfConfig
+	meta, rawStapelImages, rawImagesFromDockerfile, err := splitByMetaAndRawImages(docs)
+	if err == nil {
+		werfConfig, err = prepareWerfConfig(rawStapelImages, rawImagesFromDockerfile, meta)
+	}
+
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+		return
+	}
+	Ω(err).ShouldNot(HaveOccurred())
+
+	ansible := werfConfig.StapelImages[0].Ansible
+	Ω(ansible.Roles).Should(Equal(e.expectedRoles))
+	Ω(ansible.Library).Should(Equal(e.expectedLibrary))
+	Ω(ansible.Requirements).Should(Equal(e.expectedRequirements))
+},
+	Entry("inline tasks", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - shell: echo
+`,
+		expectedRoles:   []string{},
+		expectedLibrary: []string{},
+	}),
+	Entry("roles, library and requirements", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - include_role:
+      name: nginx
+  - block:
+    - my_module:
+        name: app
+  - community.general.ini_file:
+      path: /etc/app.ini
+  roles: ansible/roles
+  library:
+  - ansible/library
+  - vendor/library
+  requirements: ansible/requirements.yml
+`,
+		expectedRoles:        []string{"ansible/roles"},
+		expectedLibrary:      []string{"ansible/library", "vendor/library"},
+		expectedRequirements: "ansible/requirements.yml",
+	}),
+	Entry("role task without roles", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - include_role:
+      name: nginx
+`,
+		expectedError: true,
+	}),
+	Entry("custom module without library", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - block:
+    - my_module:
+        name: app
+  roles: ansible/roles
+`,
+		expectedError: true,
+	}),
+	Entry("builtin module by the fully qualified name", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - name: install app
+    ansible.builtin.shell: echo
+    become: true
+`,
+		expectedRoles:   []string{},
+		expectedLibrary: []string{},
+	}),
+	Entry("unsupported builtin module by the fully qualified name", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - ansible.builtin.service:
+      name: app
+  requirements: ansible/requirements.yml
+`,
+		expectedError: true,
+	}),
+	Entry("collection module with requirements", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - name: configure app
+    community.general.ini_file:
+      path: /etc/app.ini
+    when: true
+  requirements: ansible/requirements.yml
+`,
+		expectedRoles:        []string{},
+		expectedLibrary:      []string{},
+		expectedRequirements: "ansible/requirements.yml",
+	}),
+	Entry("collection module without requirements", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - community.general.ini_file:
+      path: /etc/app.ini
+  library: ansible/library
+`,
+		expectedError: true,
+	}),
+	Entry("custom module with requirements only", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - my_module:
+      name: app
+  requirements: ansible/requirements.yml
+`,
+		expectedError: true,
+	}),
+	Entry("task keywords only with library", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - name: nothing
+    when: true
+  library: ansible/library
+`,
+		expectedError: true,
+	}),
+	Entry("several supported modules in the task", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - shell: echo
+    command: echo
+  library: ansible/library
+`,
+		expectedError: true,
+	}),
+	Entry("absolute roles path", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - include_role:
+      name: nginx
+  roles: /etc/ansible/roles
+`,
+		expectedError: true,
+	}),
+	Entry("library outside the project", ansibleEntry{
+		config: `
+image: app
+from: alpine
+ansible:
+  install:
+  - my_module: {}
+  library: ../library
+`,
+		expectedError: true,
+	}))
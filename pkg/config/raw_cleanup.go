@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/flant/werf/pkg/tag_strategy"
+)
+
+type rawCleanup struct {
+	Rules []*rawCleanupRule `yaml:"rules,omitempty"`
+
+	rawMeta *rawMeta
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+func (c *rawCleanup) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawMeta); ok {
+		c.rawMeta = parent
+	}
+
+	parentStack.Push(c)
+	type plain rawCleanup
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, nil, c.rawMeta.doc); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *rawCleanup) toCleanup() (Cleanup, error) {
+	cleanup := Cleanup{}
+
+	for _, rawRule := range c.Rules {
+		rule, err := rawRule.toCleanupRule()
+		if err != nil {
+			return Cleanup{}, err
+		}
+
+		cleanup.Rules = append(cleanup.Rules, rule)
+	}
+
+	return cleanup, nil
+}
+
+type rawCleanupRule struct {
+	Images      interface{} `yaml:"images,omitempty"`
+	Branch      *string     `yaml:"branch,omitempty"`
+	TagStrategy *string     `yaml:"tagStrategy,omitempty"`
+	KeepLast    *int64      `yaml:"keepLast,omitempty"`
+	ExpiryDays  *int64      `yaml:"expiryDays,omitempty"`
+	AlwaysKeep  interface{} `yaml:"alwaysKeep,omitempty"`
+
+	rawCleanup *rawCleanup
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+var cleanupRuleTagStrategies = []tag_strategy.TagStrategy{
+	tag_strategy.Custom,
+	tag_strategy.GitTag,
+	tag_strategy.GitBranch,
+	tag_strategy.GitCommit,
+	tag_strategy.StagesSignature,
+	tag_strategy.Semver,
+	tag_strategy.Template,
+}
+
+func (c *rawCleanupRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawCleanup); ok {
+		c.rawCleanup = parent
+	}
+
+	parentStack.Push(c)
+	type plain rawCleanupRule
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, c.doc()); err != nil {
+		return err
+	}
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *rawCleanupRule) doc() *doc {
+	return c.rawCleanup.rawMeta.doc
+}
+
+func (c *rawCleanupRule) validate() error {
+	if c.AlwaysKeep != nil {
+		if c.Branch != nil || c.TagStrategy != nil || c.KeepLast != nil || c.ExpiryDays != nil {
+			return newDetailedConfigError("cleanup rule with `alwaysKeep` cannot have `branch`, `tagStrategy`, `keepLast` or `expiryDays`!", c, c.doc())
+		}
+
+		patterns, err := InterfaceToStringArray(c.AlwaysKeep, c, c.doc())
+		if err != nil {
+			return err
+		}
+
+		for _, pattern := range patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return newDetailedConfigError(fmt.Sprintf("invalid `alwaysKeep` regexp `%s`: %s", pattern, err), c, c.doc())
+			}
+		}
+
+		return nil
+	}
+
+	if c.Branch != nil && c.TagStrategy != nil {
+		return newDetailedConfigError("cleanup rule cannot have both `branch` and `tagStrategy`!", c, c.doc())
+	} else if c.Branch == nil && c.TagStrategy == nil {
+		return newDetailedConfigError("cleanup rule should have `branch`, `tagStrategy` or `alwaysKeep`!", c, c.doc())
+	}
+
+	if c.Branch != nil {
+		if _, err := regexp.Compile(*c.Branch); err != nil {
+			return newDetailedConfigError(fmt.Sprintf("invalid `branch` regexp `%s`: %s", *c.Branch, err), c, c.doc())
+		}
+	}
+
+	if c.TagStrategy != nil {
+		isValid := false
+		for _, strategy := range cleanupRuleTagStrategies {
+			if string(strategy) == *c.TagStrategy {
+				isValid = true
+				break
+			}
+		}
+
+		if !isValid {
+			return newDetailedConfigError(fmt.Sprintf("invalid `tagStrategy` `%s`: expected one of %v!", *c.TagStrategy, cleanupRuleTagStrategies), c, c.doc())
+		}
+	}
+
+	if c.KeepLast == nil && c.ExpiryDays == nil {
+		return newDetailedConfigError("cleanup rule should have `keepLast` or `expiryDays`!", c, c.doc())
+	} else if c.KeepLast != nil && *c.KeepLast < 0 {
+		return newDetailedConfigError("`keepLast` cannot be negative!", c, c.doc())
+	} else if c.ExpiryDays != nil && *c.ExpiryDays < 0 {
+		return newDetailedConfigError("`expiryDays` cannot be negative!", c, c.doc())
+	}
+
+	return nil
+}
+
+func (c *rawCleanupRule) toCleanupRule() (*CleanupRule, error) {
+	rule := &CleanupRule{raw: c}
+
+	images, err := InterfaceToStringArray(c.Images, c, c.doc())
+	if err != nil {
+		return nil, err
+	}
+	rule.Images = images
+
+	if c.AlwaysKeep != nil {
+		patterns, err := InterfaceToStringArray(c.AlwaysKeep, c, c.doc())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pattern := range patterns {
+			rule.AlwaysKeep = append(rule.AlwaysKeep, regexp.MustCompile(pattern))
+		}
+
+		return rule, nil
+	}
+
+	if c.Branch != nil {
+		rule.Branch = regexp.MustCompile(*c.Branch)
+		rule.TagStrategy = string(tag_strategy.GitBranch)
+	} else {
+		rule.TagStrategy = *c.TagStrategy
+	}
+
+	if c.KeepLast != nil {
+		rule.HasKeepLast = true
+		rule.KeepLast = *c.KeepLast
+	}
+
+	if c.ExpiryDays != nil {
+		rule.HasExpiryPeriod = true
+		rule.ExpiryPeriod = time.Hour * 24 * time.Duration(*c.ExpiryDays)
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+type cleanupEntry struct {
+	metaDoc       string
+	expectedRules []string
+	expectedError bool
+}
+
+var _ = DescribeTable("parsing meta cleanup rules", func(e cleanupEntry) {
+	parentStack = util.NewStack()
+
+	d := &doc{Content: []byte(e.metaDoc), RenderFilePath: "werf.yaml"}
+	meta := &rawMeta{doc: d}
+	err := yaml.UnmarshalStrict(d.Content, &meta)
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+		return
+	}
+	Ω(err).ShouldNot(HaveOccurred())
+
+	resultMeta, err := meta.toMeta()
+	Ω(err).ShouldNot(HaveOccurred())
+
+	var rules []string
+	for _, rule := range resultMeta.Cleanup.Rules {
+		rules = append(rules, rule.String())
+	}
+	Ω(rules).Should(Equal(e.expectedRules))
+},
+	Entry("rules", cleanupEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+cleanup:
+  rules:
+  - alwaysKeep: ["^v1\\.", "^production$"]
+  - images: backend
+    branch: ^feature/
+    keepLast: 3
+  - tagStrategy: git-commit
+    expiryDays: 14
+    keepLast: 10
+`,
+		expectedRules: []string{
+			"always keep ^v1\\., ^production$",
+			"images backend, branch /^feature//, keep last 3",
+			"tagStrategy git-commit, keep last 10, expiry 14 days",
+		},
+	}),
+	Entry("branch and tagStrategy", cleanupEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+cleanup:
+  rules:
+  - branch: ^feature/
+    tagStrategy: git-branch
+    keepLast: 3
+`,
+		expectedError: true,
+	}),
+	Entry("unknown tagStrategy", cleanupEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+cleanup:
+  rules:
+  - tagStrategy: git-unknown
+    keepLast: 3
+`,
+		expectedError: true,
+	}),
+	Entry("without limits", cleanupEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+cleanup:
+  rules:
+  - tagStrategy: git-tag
+`,
+		expectedError: true,
+	}),
+	Entry("alwaysKeep with limits", cleanupEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+cleanup:
+  rules:
+  - alwaysKeep: ^v1
+    keepLast: 3
+`,
+		expectedError: true,
+	}),
+	Entry("bad regexp", cleanupEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+cleanup:
+  rules:
+  - branch: "feature/("
+    keepLast: 3
+`,
+		expectedError: true,
+	}))
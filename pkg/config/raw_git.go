@@ -12,6 +12,7 @@ type rawGit struct {
 	Commit                                          string                `yaml:"commit,omitempty"`
 	RawStageDependencies                            *rawStageDependencies `yaml:"stageDependencies,omitempty"`
 	HerebyIAdmitThatBranchMightBreakReproducibility bool                  `yaml:"herebyIAdmitThatBranchMightBreakReproducibility,omitempty"`
+	LFS                                             bool                  `yaml:"lfs,omitempty"`
 
 	rawStapelImage *rawStapelImage `yaml:"-"` // parent
 
@@ -104,6 +105,8 @@ func (c *rawGit) toGitLocalExportDirective() (gitLocalExport *GitLocalExport, er
 		}
 	}
 
+	gitLocalExport.LFS = c.LFS
+
 	gitLocalExport.raw = c
 
 	if err := c.validateGitLocalExportDirective(gitLocalExport); err != nil {
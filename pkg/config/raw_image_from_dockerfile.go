@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 )
 
 type rawImageFromDockerfile struct {
@@ -12,6 +13,12 @@ type rawImageFromDockerfile struct {
 	Target     string                 `yaml:"target,omitempty"`
 	Args       map[string]interface{} `yaml:"args,omitempty"`
 	AddHost    interface{}            `yaml:"addHost,omitempty"`
+	SSH        interface{}            `yaml:"ssh,omitempty"`
+	Secrets    interface{}            `yaml:"secrets,omitempty"`
+	Network    string                 `yaml:"network,omitempty"`
+	CacheFrom  interface{}            `yaml:"cacheFrom,omitempty"`
+	Labels     map[string]interface{} `yaml:"labels,omitempty"`
+	Platform   interface{}            `yaml:"platform,omitempty"`
 
 	doc *doc `yaml:"-"` // parent
 
@@ -62,6 +69,33 @@ func (c *rawImageFromDockerfile) UnmarshalYAML(unmarshal func(interface{}) error
 	return nil
 }
 
+func (c *rawImageFromDockerfile) validateSecrets(secrets []string) error {
+	for _, secret := range secrets {
+		var id, src string
+		for _, field := range strings.Split(secret, ",") {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				return newDetailedConfigError(fmt.Sprintf("invalid secret `%s`: expected `id=ID,src=PATH`!", secret), c, c.doc)
+			}
+
+			switch parts[0] {
+			case "id":
+				id = parts[1]
+			case "src", "source":
+				src = parts[1]
+			default:
+				return newDetailedConfigError(fmt.Sprintf("invalid secret `%s`: unexpected field `%s`, expected `id=ID,src=PATH`!", secret, parts[0]), c, c.doc)
+			}
+		}
+
+		if id == "" || src == "" {
+			return newDetailedConfigError(fmt.Sprintf("invalid secret `%s`: expected `id=ID,src=PATH`!", secret), c, c.doc)
+		}
+	}
+
+	return nil
+}
+
 func (c *rawImageFromDockerfile) toImageFromDockerfileDirectives() (images []*ImageFromDockerfile, err error) {
 	for _, imageName := range c.Images {
 		if image, err := c.toImageFromDockerfileDirective(imageName); err != nil {
@@ -88,6 +122,43 @@ func (c *rawImageFromDockerfile) toImageFromDockerfileDirective(imageName string
 		image.AddHost = addHost
 	}
 
+	if ssh, err := InterfaceToStringArray(c.SSH, c, c.doc); err != nil {
+		return nil, err
+	} else {
+		image.SSH = ssh
+	}
+
+	if cacheFrom, err := InterfaceToStringArray(c.CacheFrom, c, c.doc); err != nil {
+		return nil, err
+	} else {
+		image.CacheFrom = cacheFrom
+	}
+
+	if secrets, err := InterfaceToStringArray(c.Secrets, c, c.doc); err != nil {
+		return nil, err
+	} else if err := c.validateSecrets(secrets); err != nil {
+		return nil, err
+	} else {
+		image.Secrets = secrets
+	}
+
+	image.Network = c.Network
+
+	if len(c.Labels) != 0 {
+		image.Labels = map[string]string{}
+		for key, value := range c.Labels {
+			image.Labels[key] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	if platforms, err := InterfaceToStringArray(c.Platform, c, c.doc); err != nil {
+		return nil, err
+	} else if err := validatePlatforms(platforms, c, c.doc); err != nil {
+		return nil, err
+	} else {
+		image.Platform = platforms
+	}
+
 	image.raw = c
 
 	return image, nil
@@ -0,0 +1,46 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type secretEntry struct {
+	secret        string
+	expectedValid bool
+}
+
+var _ = DescribeTable("validating dockerfile image secrets", func(e secretEntry) {
+	c := &rawImageFromDockerfile{doc: &doc{RenderFilePath: "werf.yaml"}}
+
+	err := c.validateSecrets([]string{e.secret})
+	if e.expectedValid {
+		Ω(err).ShouldNot(HaveOccurred())
+	} else {
+		Ω(err).Should(HaveOccurred())
+	}
+},
+	Entry("id and src", secretEntry{
+		"id=npmrc,src=.npmrc",
+		true,
+	}),
+	Entry("id and source", secretEntry{
+		"source=/home/user/.npmrc,id=npmrc",
+		true,
+	}),
+	Entry("without src", secretEntry{
+		"id=npmrc",
+		false,
+	}),
+	Entry("without id", secretEntry{
+		"src=.npmrc",
+		false,
+	}),
+	Entry("unknown field", secretEntry{
+		"id=npmrc,src=.npmrc,mode=0600",
+		false,
+	}),
+	Entry("bad format", secretEntry{
+		".npmrc",
+		false,
+	}))
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/flant/werf/pkg/secret"
 	"github.com/flant/werf/pkg/slug"
 )
 
@@ -11,6 +12,8 @@ type rawMeta struct {
 	ConfigVersion   *int               `yaml:"configVersion,omitempty"`
 	Project         *string            `yaml:"project,omitempty"`
 	DeployTemplates rawDeployTemplates `yaml:"deploy,omitempty"`
+	Cleanup         *rawCleanup        `yaml:"cleanup,omitempty"`
+	Secrets         *rawSecrets        `yaml:"secrets,omitempty"`
 
 	doc *doc `yaml:"-"` // parent
 
@@ -45,7 +48,7 @@ func (c *rawMeta) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-func (c *rawMeta) toMeta() *Meta {
+func (c *rawMeta) toMeta() (*Meta, error) {
 	meta := &Meta{}
 
 	if c.ConfigVersion != nil {
@@ -63,5 +66,23 @@ func (c *rawMeta) toMeta() *Meta {
 
 	meta.DeployTemplates = c.DeployTemplates.toDeployTemplates()
 
-	return meta
+	if c.Cleanup != nil {
+		cleanup, err := c.Cleanup.toCleanup()
+		if err != nil {
+			return nil, err
+		}
+		meta.Cleanup = cleanup
+	}
+
+	if c.Secrets != nil {
+		secrets, err := c.Secrets.toSecrets()
+		if err != nil {
+			return nil, err
+		}
+		meta.Secrets = secrets
+	} else {
+		meta.Secrets = Secrets{Backend: secret.AesBackend}
+	}
+
+	return meta, nil
 }
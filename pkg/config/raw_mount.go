@@ -6,6 +6,8 @@ type rawMount struct {
 	To       string `yaml:"to,omitempty"`
 	From     string `yaml:"from,omitempty"`
 	FromPath string `yaml:"fromPath,omitempty"`
+	Id       string `yaml:"id,omitempty"`
+	Sharing  string `yaml:"sharing,omitempty"`
 
 	rawStapelImage *rawStapelImage `yaml:"-"` // parent
 
@@ -33,6 +35,8 @@ func (c *rawMount) toDirective() (mount *Mount, err error) {
 	mount = &Mount{}
 	mount.To = c.To
 	mount.From = c.FromPath
+	mount.Id = c.Id
+	mount.Sharing = c.Sharing
 
 	if c.From == "" {
 		mount.Type = "custom_dir"
@@ -40,6 +44,10 @@ func (c *rawMount) toDirective() (mount *Mount, err error) {
 		mount.Type = c.From
 	}
 
+	if mount.Type == "cache" && mount.Sharing == "" {
+		mount.Sharing = "shared"
+	}
+
 	mount.raw = c
 
 	if err := c.validateDirective(mount); err != nil {
@@ -54,6 +62,10 @@ func (c *rawMount) validateDirective(mount *Mount) (err error) {
 		return newDetailedConfigError(fmt.Sprintf("cannot use `from: %s` and `fromPath: %s` at the same time for mount!", c.From, c.FromPath), c, c.rawStapelImage.doc)
 	}
 
+	if c.From != "cache" && (c.Id != "" || c.Sharing != "") {
+		return newDetailedConfigError("`id: ID` and `sharing: MODE` can be used only with `from: cache` mount!", c, c.rawStapelImage.doc)
+	}
+
 	if err := mount.validate(); err != nil {
 		return err
 	}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type mountEntry struct {
+	config         string
+	expectedMounts []Mount
+	expectedError  bool
+}
+
+var _ = DescribeTable("parsing image mounts", func(e mountEntry) {
+	docs, err := splitByDocs("project: test\nconfigVersion: 1\n---\n"+e.config, "werf.yaml")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	var werfConfig *WerfConfig
+	meta, rawStapelImages, rawImagesFromDockerfile, err := splitByMetaAndRawImages(docs)
+	if err == nil {
+		werfConfig, err = prepareWerfConfig(rawStapelImages, rawImagesFromDockerfile, meta)
+	}
+
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+		return
+	}
+	Ω(err).ShouldNot(HaveOccurred())
+
+	var mounts []Mount
+	for _, mount := range werfConfig.StapelImages[0].Mount {
+		mounts = append(mounts, Mount{To: mount.To, From: mount.From, Type: mount.Type, Id: mount.Id, Sharing: mount.Sharing})
+	}
+
+	Ω(mounts).Should(Equal(e.expectedMounts))
+},
+	Entry("cache mounts", mountEntry{
+		config: `
+image: app
+from: alpine
+mount:
+- from: cache
+  id: apt
+  to: /var/cache/apt
+- from: cache
+  id: npm
+  sharing: locked
+  to: /root/.npm
+- from: build_dir
+  to: /var/lib/apt/lists
+`,
+		expectedMounts: []Mount{
+			{To: "/var/cache/apt", Type: "cache", Id: "apt", Sharing: "shared"},
+			{To: "/root/.npm", Type: "cache", Id: "npm", Sharing: "locked"},
+			{To: "/var/lib/apt/lists", Type: "build_dir"},
+		},
+	}),
+	Entry("cache mount without id", mountEntry{
+		config: `
+image: app
+from: alpine
+mount:
+- from: cache
+  to: /var/cache/apt
+`,
+		expectedError: true,
+	}),
+	Entry("bad cache mount sharing", mountEntry{
+		config: `
+image: app
+from: alpine
+mount:
+- from: cache
+  id: apt
+  sharing: exclusive
+  to: /var/cache/apt
+`,
+		expectedError: true,
+	}),
+	Entry("id for build_dir mount", mountEntry{
+		config: `
+image: app
+from: alpine
+mount:
+- from: build_dir
+  id: apt
+  to: /var/cache/apt
+`,
+		expectedError: true,
+	}))
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/flant/werf/pkg/secret"
+)
+
+type rawSecrets struct {
+	Backend       *string     `yaml:"backend,omitempty"`
+	Recipients    interface{} `yaml:"recipients,omitempty"`
+	PublicKeyring *string     `yaml:"publicKeyring,omitempty"`
+
+	rawMeta *rawMeta
+
+	UnsupportedAttributes map[string]interface{} `yaml:",inline"`
+}
+
+var secretsBackends = []string{secret.AesBackend, secret.AgeBackend, secret.PgpBackend}
+
+func (c *rawSecrets) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if parent, ok := parentStack.Peek().(*rawMeta); ok {
+		c.rawMeta = parent
+	}
+
+	parentStack.Push(c)
+	type plain rawSecrets
+	err := unmarshal((*plain)(c))
+	parentStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverflow(c.UnsupportedAttributes, c, c.rawMeta.doc); err != nil {
+		return err
+	}
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *rawSecrets) backend() string {
+	if c.Backend == nil {
+		return secret.AesBackend
+	}
+
+	return *c.Backend
+}
+
+func (c *rawSecrets) validate() error {
+	isValid := false
+	for _, backend := range secretsBackends {
+		if backend == c.backend() {
+			isValid = true
+			break
+		}
+	}
+
+	if !isValid {
+		return newDetailedConfigError(fmt.Sprintf("invalid secrets `backend` `%s`: expected one of %v!", c.backend(), secretsBackends), c, c.rawMeta.doc)
+	}
+
+	recipients, err := InterfaceToStringArray(c.Recipients, c, c.rawMeta.doc)
+	if err != nil {
+		return err
+	}
+
+	switch c.backend() {
+	case secret.AesBackend:
+		if len(recipients) != 0 || c.PublicKeyring != nil {
+			return newDetailedConfigError("secrets `recipients` and `publicKeyring` cannot be used with the aes backend!", c, c.rawMeta.doc)
+		}
+	case secret.AgeBackend:
+		if len(recipients) == 0 {
+			return newDetailedConfigError("secrets `recipients` required for the age backend!", c, c.rawMeta.doc)
+		}
+
+		if c.PublicKeyring != nil {
+			return newDetailedConfigError("secrets `publicKeyring` can be used only with the pgp backend!", c, c.rawMeta.doc)
+		}
+	case secret.PgpBackend:
+		if len(recipients) == 0 {
+			return newDetailedConfigError("secrets `recipients` required for the pgp backend!", c, c.rawMeta.doc)
+		}
+
+		if c.PublicKeyring == nil || *c.PublicKeyring == "" {
+			return newDetailedConfigError("secrets `publicKeyring` required for the pgp backend!", c, c.rawMeta.doc)
+		}
+
+		if !isRelativePath(*c.PublicKeyring) {
+			return newDetailedConfigError(fmt.Sprintf("secrets `publicKeyring` `%s` should be relative to the project directory!", *c.PublicKeyring), c, c.rawMeta.doc)
+		}
+	}
+
+	return nil
+}
+
+func (c *rawSecrets) toSecrets() (Secrets, error) {
+	secrets := Secrets{Backend: c.backend()}
+
+	recipients, err := InterfaceToStringArray(c.Recipients, c, c.rawMeta.doc)
+	if err != nil {
+		return Secrets{}, err
+	}
+	secrets.Recipients = recipients
+
+	if c.PublicKeyring != nil {
+		secrets.PublicKeyring = *c.PublicKeyring
+	}
+
+	return secrets, nil
+}
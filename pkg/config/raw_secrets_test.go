@@ -0,0 +1,109 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+type secretsEntry struct {
+	metaDoc         string
+	expectedSecrets Secrets
+	expectedError   bool
+}
+
+var _ = DescribeTable("parsing meta secrets", func(e secretsEntry) {
+	parentStack = util.NewStack()
+
+	d := &doc{Content: []byte(e.metaDoc), RenderFilePath: "werf.yaml"}
+	meta := &rawMeta{doc: d}
+	err := yaml.UnmarshalStrict(d.Content, &meta)
+	if e.expectedError {
+		Ω(err).Should(HaveOccurred())
+		return
+	}
+	Ω(err).ShouldNot(HaveOccurred())
+
+	resultMeta, err := meta.toMeta()
+	Ω(err).ShouldNot(HaveOccurred())
+	Ω(resultMeta.Secrets).Should(Equal(e.expectedSecrets))
+},
+	Entry("default", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+`,
+		expectedSecrets: Secrets{Backend: "aes"},
+	}),
+	Entry("age", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+secrets:
+  backend: age
+  recipients:
+  - age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+`,
+		expectedSecrets: Secrets{Backend: "age", Recipients: []string{"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"}},
+	}),
+	Entry("pgp", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+secrets:
+  backend: pgp
+  recipients: alice@example.com
+  publicKeyring: .werf/pgp_public_keyring.asc
+`,
+		expectedSecrets: Secrets{Backend: "pgp", Recipients: []string{"alice@example.com"}, PublicKeyring: ".werf/pgp_public_keyring.asc"},
+	}),
+	Entry("unknown backend", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+secrets:
+  backend: vault
+`,
+		expectedError: true,
+	}),
+	Entry("age without recipients", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+secrets:
+  backend: age
+`,
+		expectedError: true,
+	}),
+	Entry("aes with recipients", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+secrets:
+  recipients: alice@example.com
+`,
+		expectedError: true,
+	}),
+	Entry("pgp without publicKeyring", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+secrets:
+  backend: pgp
+  recipients: alice@example.com
+`,
+		expectedError: true,
+	}),
+	Entry("pgp with absolute publicKeyring", secretsEntry{
+		metaDoc: `
+project: test
+configVersion: 1
+secrets:
+  backend: pgp
+  recipients: alice@example.com
+  publicKeyring: /home/alice/.gnupg/pubring.asc
+`,
+		expectedError: true,
+	}))
@@ -21,6 +21,7 @@ type rawStapelImage struct {
 	RawDocker                                           *rawDocker   `yaml:"docker,omitempty"`
 	RawImport                                           []*rawImport `yaml:"import,omitempty"`
 	AsLayers                                            bool         `yaml:"asLayers,omitempty"`
+	Platform                                            interface{}  `yaml:"platform,omitempty"`
 
 	doc *doc `yaml:"-"` // parent
 
@@ -675,7 +676,26 @@ func (c *rawStapelImage) toBaseStapelImageBaseDirective(name string) (imageBase
 
 	imageBase.Git = &GitManager{}
 
+	if platforms, err := c.toPlatforms(); err != nil {
+		return nil, err
+	} else {
+		imageBase.Platform = platforms
+	}
+
 	imageBase.raw = c
 
 	return imageBase, nil
 }
+
+func (c *rawStapelImage) toPlatforms() ([]string, error) {
+	platforms, err := InterfaceToStringArray(c.Platform, nil, c.doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validatePlatforms(platforms, nil, c.doc); err != nil {
+		return nil, err
+	}
+
+	return platforms, nil
+}
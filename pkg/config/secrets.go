@@ -0,0 +1,12 @@
+package config
+
+// Secrets defines the backend of the helm secrets:
+// aes backend uses the shared secret key,
+// age and pgp backends encrypt data for the Recipients, so that everyone can decrypt data with the own key
+type Secrets struct {
+	Backend    string
+	Recipients []string
+
+	// PublicKeyring is the project path to the armored or binary keyring with the public keys of the pgp Recipients
+	PublicKeyring string
+}
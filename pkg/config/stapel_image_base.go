@@ -17,6 +17,7 @@ type StapelImageBase struct {
 	Ansible                                             *Ansible
 	Mount                                               []*Mount
 	Import                                              []*Import
+	Platform                                            []string
 
 	raw *rawStapelImage
 }
@@ -25,6 +26,10 @@ func (c *StapelImageBase) GetName() string {
 	return c.Name
 }
 
+func (c *StapelImageBase) GetPlatforms() []string {
+	return c.Platform
+}
+
 func (c *StapelImageBase) imports() []*Import {
 	return c.Import
 }
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/flant/werf/pkg/platform"
 )
 
 type WerfConfig struct {
@@ -77,6 +79,31 @@ func (c *WerfConfig) GetArtifact(imageName string) *StapelImageArtifact {
 	return nil
 }
 
+// GetPlatforms returns all platforms specified for the images and artifacts in the order of appearance
+func (c *WerfConfig) GetPlatforms() []string {
+	var images []ImageInterface
+	images = append(images, c.GetAllImages()...)
+	for _, artifact := range c.Artifacts {
+		images = append(images, artifact)
+	}
+
+	var platforms []string
+	for _, image := range images {
+	PlatformsLoop:
+		for _, p := range image.GetPlatforms() {
+			for _, existingPlatform := range platforms {
+				if existingPlatform == p {
+					continue PlatformsLoop
+				}
+			}
+
+			platforms = append(platforms, p)
+		}
+	}
+
+	return platforms
+}
+
 func (c *WerfConfig) exportsAutoExcluding() error {
 	for _, image := range c.StapelImages {
 		if err := image.exportsAutoExcluding(); err != nil {
@@ -273,6 +300,51 @@ func (c *WerfConfig) validateInfiniteLoopBetweenRelatedImages() error {
 	return nil
 }
 
+func (c *WerfConfig) validateImagesPlatforms() error {
+	for _, image := range c.GetAllImages() {
+		if err := c.validateImagePlatforms(image); err != nil {
+			return err
+		}
+	}
+
+	for _, artifact := range c.Artifacts {
+		if err := c.validateImagePlatforms(artifact); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateImagePlatforms checks that every image or artifact the image is based on can be built for each image platform
+func (c *WerfConfig) validateImagePlatforms(interf ImageInterface) error {
+	if len(interf.GetPlatforms()) == 0 {
+		return nil
+	}
+
+	for _, relatedImage := range c.ImageTree(interf) {
+		if relatedImage == interf {
+			continue
+		}
+
+		for _, p := range interf.GetPlatforms() {
+			if !platform.Contains(relatedImage.GetPlatforms(), p) {
+				var doc *doc
+				switch i := interf.(type) {
+				case StapelImageInterface:
+					doc = i.ImageBaseConfig().raw.doc
+				case *ImageFromDockerfile:
+					doc = i.raw.doc
+				}
+
+				return newDetailedConfigError(fmt.Sprintf("platform `%s` of image `%s` is not supported by related image `%s` (platform: %s)!", p, interf.GetName(), relatedImage.GetName(), strings.Join(relatedImage.GetPlatforms(), ", ")), nil, doc)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (c *WerfConfig) ImageTree(interf ImageInterface) (tree []ImageInterface) {
 	switch i := interf.(type) {
 	case StapelImageInterface:
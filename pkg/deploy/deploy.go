@@ -35,6 +35,7 @@ type DeployOptions struct {
 	UserExtraLabels      map[string]string
 	IgnoreSecretKey      bool
 	ThreeWayMergeMode    helm.ThreeWayMergeModeType
+	PrometheusUrl        string
 }
 
 func Deploy(projectDir string, imagesRepoManager images_manager.ImagesRepoManager, images []images_manager.ImageInfoGetter, release, namespace, commonTag string, tagStrategy tag_strategy.TagStrategy, werfConfig *config.WerfConfig, helmReleaseStorageNamespace, helmReleaseStorageType string, opts DeployOptions) error {
@@ -49,7 +50,7 @@ func Deploy(projectDir string, imagesRepoManager images_manager.ImagesRepoManage
 		logboek.LogF("Helm release storage type: %s\n", helmReleaseStorageType)
 		logboek.LogF("Helm release name: %s\n", release)
 
-		m, err := GetSafeSecretManager(projectDir, opts.SecretValues, opts.IgnoreSecretKey)
+		m, err := GetSafeSecretManager(projectDir, werfConfig.Meta.Secrets, opts.SecretValues, opts.IgnoreSecretKey)
 		if err != nil {
 			return err
 		}
@@ -98,6 +99,7 @@ func Deploy(projectDir string, imagesRepoManager images_manager.ImagesRepoManage
 				Values:    opts.Values,
 			},
 			ThreeWayMergeMode: opts.ThreeWayMergeMode,
+			PrometheusUrl:     opts.PrometheusUrl,
 		})
 	})
 
@@ -0,0 +1,74 @@
+package deploy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/config"
+	"github.com/flant/werf/pkg/deploy/helm"
+	"github.com/flant/werf/pkg/deploy/werf_chart"
+	"github.com/flant/werf/pkg/images_manager"
+	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util/secretvalues"
+)
+
+type DiffOptions struct {
+	RenderOptions
+
+	Live   bool
+	Output helm.DiffOutputType
+}
+
+// RunDiff renders the chart the same way as Deploy does and prints the changes the deploy would make
+func RunDiff(out io.Writer, projectDir string, werfConfig *config.WerfConfig, imagesRepoManager images_manager.ImagesRepoManager, images []images_manager.ImageInfoGetter, commonTag string, tagStrategy tag_strategy.TagStrategy, opts DiffOptions) error {
+	logboek.Debug.LogF("Diff options: %#v\n", opts)
+
+	m, err := GetSafeSecretManager(projectDir, werfConfig.Meta.Secrets, opts.SecretValues, opts.IgnoreSecretKey)
+	if err != nil {
+		return err
+	}
+
+	serviceValues, err := GetServiceValues(werfConfig.Meta.Project, imagesRepoManager, opts.Namespace, commonTag, tagStrategy, images, ServiceValuesOptions{Env: opts.Env})
+	if err != nil {
+		return fmt.Errorf("error creating service values: %s", err)
+	}
+
+	projectChartDir := filepath.Join(projectDir, werf_chart.ProjectHelmChartDirName)
+	werfChart, err := PrepareWerfChart(werfConfig.Meta.Project, projectChartDir, opts.Env, m, opts.SecretValues, serviceValues)
+	if err != nil {
+		return err
+	}
+	helm.SetReleaseLogSecretValuesToMask(werfChart.SecretValuesToMask)
+
+	werfChart.MergeExtraAnnotations(opts.UserExtraAnnotations)
+	werfChart.MergeExtraLabels(opts.UserExtraLabels)
+
+	helm.WerfTemplateEngine.InitWerfEngineExtraTemplatesFunctions(werfChart.DecodedSecretFilesData)
+	patchLoadChartfile(werfChart.Name)
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := helm.WerfTemplateEngineWithExtraAnnotationsAndLabels(werfChart.ExtraAnnotations, werfChart.ExtraLabels, func() error {
+		return helm.Render(
+			buf,
+			werfChart.ChartDir,
+			opts.ReleaseName,
+			opts.Namespace,
+			append(werfChart.Values, opts.Values...),
+			werfChart.SecretValues,
+			append(werfChart.Set, opts.Set...),
+			append(werfChart.SetString, opts.SetString...),
+			helm.RenderOptions{ShowNotes: false})
+	}); err != nil {
+		return fmt.Errorf("%s", secretvalues.MaskSecretValuesInString(werfChart.SecretValuesToMask, err.Error()))
+	}
+
+	if err := helm.Diff(out, opts.ReleaseName, opts.Namespace, buf.String(), helm.DiffOptions{Live: opts.Live, Output: opts.Output}); err != nil {
+		return fmt.Errorf("%s", secretvalues.MaskSecretValuesInString(werfChart.SecretValuesToMask, err.Error()))
+	}
+
+	return nil
+}
@@ -0,0 +1,328 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/logboek"
+)
+
+const (
+	defaultAnalysisDuration = time.Minute
+	defaultAnalysisInterval = 10 * time.Second
+)
+
+var analysisThresholdOperators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// analysisThreshold is the condition each value of the analysis query should meet
+type analysisThreshold struct {
+	Operator string
+	Value    float64
+}
+
+func (t analysisThreshold) Check(value float64) bool {
+	switch t.Operator {
+	case "<":
+		return value < t.Value
+	case "<=":
+		return value <= t.Value
+	case ">":
+		return value > t.Value
+	case ">=":
+		return value >= t.Value
+	case "==":
+		return value == t.Value
+	case "!=":
+		return value != t.Value
+	}
+
+	panic(fmt.Sprintf("unexpected threshold operator %q", t.Operator))
+}
+
+func (t analysisThreshold) String() string {
+	return fmt.Sprintf("%s %s", t.Operator, strconv.FormatFloat(t.Value, 'g', -1, 64))
+}
+
+func parseAnalysisThreshold(value string) (analysisThreshold, error) {
+	value = strings.TrimSpace(value)
+
+	for _, operator := range analysisThresholdOperators {
+		if !strings.HasPrefix(value, operator) {
+			continue
+		}
+
+		thresholdValue, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(value, operator)), 64)
+		if err != nil {
+			return analysisThreshold{}, fmt.Errorf("number expected after %s", operator)
+		}
+
+		return analysisThreshold{Operator: operator, Value: thresholdValue}, nil
+	}
+
+	return analysisThreshold{}, fmt.Errorf("OPERATOR NUMBER expected, where OPERATOR is one of %v", analysisThresholdOperators)
+}
+
+// analysisSpec describes the PromQL query evaluated periodically during the duration after the release resources are ready
+type analysisSpec struct {
+	ResourceName string
+	Query        string
+	Threshold    analysisThreshold
+	Duration     time.Duration
+	Interval     time.Duration
+}
+
+func getAnalysisSpecs(templates ChartTemplates) ([]*analysisSpec, error) {
+	var specs []*analysisSpec
+	for _, t := range templates {
+		spec, err := parseAnalysisSpec(t)
+		if err != nil {
+			return nil, err
+		}
+
+		if spec != nil {
+			specs = append(specs, spec)
+		}
+	}
+
+	return specs, nil
+}
+
+func parseAnalysisSpec(t Template) (*analysisSpec, error) {
+	resourceName := fmt.Sprintf("%s/%s", strings.ToLower(t.Kind), t.Metadata.Name)
+	annotations := t.Metadata.Annotations
+
+	query, hasQuery := annotations[AnalysisQueryAnnoName]
+	if !hasQuery {
+		for _, annoName := range []string{AnalysisThresholdAnnoName, AnalysisDurationAnnoName, AnalysisIntervalAnnoName} {
+			if _, hasKey := annotations[annoName]; hasKey {
+				return nil, fmt.Errorf("%s annotation %s cannot be used without %s", resourceName, annoName, AnalysisQueryAnnoName)
+			}
+		}
+
+		return nil, nil
+	}
+
+	spec := &analysisSpec{
+		ResourceName: resourceName,
+		Query:        query,
+		Duration:     defaultAnalysisDuration,
+		Interval:     defaultAnalysisInterval,
+	}
+
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%s annotation %s: PromQL query expected", resourceName, AnalysisQueryAnnoName)
+	}
+
+	thresholdValue, hasThreshold := annotations[AnalysisThresholdAnnoName]
+	if !hasThreshold {
+		return nil, fmt.Errorf("%s annotation %s is required for %s", resourceName, AnalysisThresholdAnnoName, AnalysisQueryAnnoName)
+	}
+
+	threshold, err := parseAnalysisThreshold(thresholdValue)
+	if err != nil {
+		return nil, fmt.Errorf("%s annotation %s with invalid value %s: %s", resourceName, AnalysisThresholdAnnoName, thresholdValue, err)
+	}
+	spec.Threshold = threshold
+
+	for annoName, duration := range map[string]*time.Duration{AnalysisDurationAnnoName: &spec.Duration, AnalysisIntervalAnnoName: &spec.Interval} {
+		value, hasKey := annotations[annoName]
+		if !hasKey {
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s annotation %s with invalid value %s: positive duration expected", resourceName, annoName, value)
+		}
+		*duration = d
+	}
+
+	return spec, nil
+}
+
+// runAnalysis evaluates queries of all specs at the same time, the first threshold breach fails the analysis.
+// The analysis fails if it is not finished before the deploy deadline, zero deadline means no timeout
+func runAnalysis(prometheusUrl string, specs []*analysisSpec, deadline time.Time) error {
+	if prometheusUrl == "" {
+		return fmt.Errorf("prometheus url is required for %s annotation: specify --prometheus-url option ($WERF_PROMETHEUS_URL)", AnalysisQueryAnnoName)
+	}
+
+	ctx := context.Background()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	client := &prometheusClient{Url: prometheusUrl, HttpClient: &http.Client{Timeout: 30 * time.Second}}
+
+	start := time.Now()
+	nextChecks := make([]time.Time, len(specs))
+	for ind := range nextChecks {
+		nextChecks[ind] = start
+	}
+
+	for {
+		var nextCheck time.Time
+		for ind, spec := range specs {
+			if nextChecks[ind].IsZero() {
+				continue
+			}
+
+			if !time.Now().Before(nextChecks[ind]) {
+				if err := checkAnalysisSpec(ctx, client, spec); err != nil {
+					if ctx.Err() != nil {
+						return fmt.Errorf("deploy timeout exceeded: analysis is not finished")
+					}
+					return err
+				}
+
+				if time.Since(start) >= spec.Duration {
+					nextChecks[ind] = time.Time{}
+					continue
+				}
+
+				nextChecks[ind] = nextChecks[ind].Add(spec.Interval)
+				if end := start.Add(spec.Duration); nextChecks[ind].After(end) {
+					nextChecks[ind] = end
+				}
+			}
+
+			if nextCheck.IsZero() || nextChecks[ind].Before(nextCheck) {
+				nextCheck = nextChecks[ind]
+			}
+		}
+
+		if nextCheck.IsZero() {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(nextCheck))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("deploy timeout exceeded: analysis is not finished")
+		case <-timer.C:
+		}
+	}
+}
+
+func checkAnalysisSpec(ctx context.Context, client *prometheusClient, spec *analysisSpec) error {
+	values, err := client.Query(ctx, spec.Query)
+	if err != nil {
+		return fmt.Errorf("%s analysis query failed: %s", spec.ResourceName, err)
+	}
+
+	if len(values) == 0 {
+		logboek.Info.LogFDetails("%s: query returned no data\n", spec.ResourceName)
+		return nil
+	}
+
+	for _, value := range values {
+		if !spec.Threshold.Check(value) {
+			return fmt.Errorf("%s analysis failed: query %q value %s does not meet threshold %s", spec.ResourceName, spec.Query, strconv.FormatFloat(value, 'g', -1, 64), spec.Threshold)
+		}
+	}
+
+	logboek.Default.LogFDetails("%s: %v %s\n", spec.ResourceName, values, spec.Threshold)
+
+	return nil
+}
+
+type prometheusClient struct {
+	Url        string
+	HttpClient *http.Client
+}
+
+type prometheusQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Query evaluates the instant query, values of vector samples are sorted
+func (c *prometheusClient) Query(ctx context.Context, query string) ([]float64, error) {
+	queryUrl := fmt.Sprintf("%s/api/v1/query?%s", strings.TrimSuffix(c.Url, "/"), url.Values{"query": []string{query}}.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, queryUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HttpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var queryResponse prometheusQueryResponse
+	if err := json.Unmarshal(body, &queryResponse); err != nil {
+		return nil, fmt.Errorf("bad response %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if queryResponse.Status != "success" {
+		return nil, fmt.Errorf("%s: %s", resp.Status, queryResponse.Error)
+	}
+
+	var samples [][]interface{}
+	switch queryResponse.Data.ResultType {
+	case "scalar":
+		var sample []interface{}
+		if err := json.Unmarshal(queryResponse.Data.Result, &sample); err != nil {
+			return nil, fmt.Errorf("bad scalar result: %s", err)
+		}
+		samples = append(samples, sample)
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(queryResponse.Data.Result, &vector); err != nil {
+			return nil, fmt.Errorf("bad vector result: %s", err)
+		}
+
+		for _, s := range vector {
+			samples = append(samples, s.Value)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported result type %q: scalar or vector expected", queryResponse.Data.ResultType)
+	}
+
+	var values []float64
+	for _, sample := range samples {
+		if len(sample) != 2 {
+			return nil, fmt.Errorf("bad sample %v: [timestamp, value] expected", sample)
+		}
+
+		valueStr, ok := sample[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("bad sample value %v: string expected", sample[1])
+		}
+
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad sample value %q: %s", valueStr, err)
+		}
+
+		values = append(values, value)
+	}
+
+	sort.Float64s(values)
+
+	return values, nil
+}
@@ -0,0 +1,244 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakePrometheus struct {
+	mux     sync.Mutex
+	results map[string][]string
+	queries []string
+}
+
+func (p *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if r.URL.Path != "/api/v1/query" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query().Get("query")
+	p.queries = append(p.queries, query)
+
+	results, ok := p.results[query]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"status":"error","errorType":"bad_data","error":"unknown query %s"}`, query)
+		return
+	}
+
+	// The last result is returned when all results are used
+	result := results[0]
+	if len(results) > 1 {
+		p.results[query] = results[1:]
+	}
+
+	fmt.Fprintf(w, `{"status":"success","data":%s}`, result)
+}
+
+func vectorResult(values ...string) string {
+	var samples []string
+	for ind, value := range values {
+		samples = append(samples, fmt.Sprintf(`{"metric":{"pod":"pod-%d"},"value":[1583150000.123,%q]}`, ind, value))
+	}
+
+	return fmt.Sprintf(`{"resultType":"vector","result":[%s]}`, strings.Join(samples, ","))
+}
+
+func TestRunAnalysis(t *testing.T) {
+	tests := []struct {
+		name          string
+		results       map[string][]string
+		specs         []*analysisSpec
+		expectedError string
+	}{
+		{
+			name: "threshold is met",
+			results: map[string][]string{
+				"error_rate": {vectorResult("0.01", "0.02")},
+				"up":         {`{"resultType":"scalar","result":[1583150000.123,"1"]}`},
+			},
+			specs: []*analysisSpec{
+				{ResourceName: "deployment/app", Query: "error_rate", Threshold: analysisThreshold{"<", 0.05}},
+				{ResourceName: "deployment/app", Query: "up", Threshold: analysisThreshold{"==", 1}},
+			},
+		},
+		{
+			name: "no data",
+			results: map[string][]string{
+				"error_rate": {vectorResult()},
+			},
+			specs: []*analysisSpec{
+				{ResourceName: "deployment/app", Query: "error_rate", Threshold: analysisThreshold{"<", 0.05}},
+			},
+		},
+		{
+			name: "threshold is breached during the analysis",
+			results: map[string][]string{
+				"error_rate": {vectorResult("0.01"), vectorResult("0.01"), vectorResult("0.01", "0.5")},
+			},
+			specs: []*analysisSpec{
+				{ResourceName: "deployment/app", Query: "error_rate", Threshold: analysisThreshold{"<=", 0.05}},
+			},
+			expectedError: `deployment/app analysis failed: query "error_rate" value 0.5 does not meet threshold <= 0.05`,
+		},
+		{
+			name:    "query error",
+			results: map[string][]string{},
+			specs: []*analysisSpec{
+				{ResourceName: "deployment/app", Query: "bad_query", Threshold: analysisThreshold{">", 0}},
+			},
+			expectedError: "deployment/app analysis query failed: 400 Bad Request: unknown query bad_query",
+		},
+	}
+
+	for _, test := range tests {
+		prometheus := &fakePrometheus{results: test.results}
+		server := httptest.NewServer(prometheus)
+
+		for _, spec := range test.specs {
+			spec.Duration = 50 * time.Millisecond
+			spec.Interval = 10 * time.Millisecond
+		}
+
+		err := runAnalysis(server.URL, test.specs, time.Time{})
+		server.Close()
+
+		var gotError string
+		if err != nil {
+			gotError = err.Error()
+		}
+
+		if gotError != test.expectedError {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expectedError, gotError)
+		}
+
+		if test.expectedError == "" && len(prometheus.queries) < 5*len(test.specs) {
+			t.Errorf("%s: queries should be evaluated during the whole duration, got %d queries", test.name, len(prometheus.queries))
+		}
+	}
+}
+
+func TestRunAnalysis_DeployTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.Handler
+		expectedError string
+	}{
+		{
+			name:          "analysis duration exceeds the deploy timeout",
+			handler:       &fakePrometheus{results: map[string][]string{"error_rate": {vectorResult("0.01")}}},
+			expectedError: "deploy timeout exceeded: analysis is not finished",
+		},
+		{
+			name: "query hangs until the deploy timeout",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			}),
+			expectedError: "deploy timeout exceeded: analysis is not finished",
+		},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(test.handler)
+
+		specs := []*analysisSpec{
+			{ResourceName: "deployment/app", Query: "error_rate", Threshold: analysisThreshold{"<", 0.05}, Duration: time.Minute, Interval: 10 * time.Millisecond},
+		}
+
+		start := time.Now()
+		err := runAnalysis(server.URL, specs, start.Add(100*time.Millisecond))
+		elapsed := time.Since(start)
+		server.Close()
+
+		var gotError string
+		if err != nil {
+			gotError = err.Error()
+		}
+
+		if gotError != test.expectedError {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expectedError, gotError)
+		}
+
+		if elapsed > 5*time.Second {
+			t.Errorf("%s: analysis should be stopped at the deploy deadline, stopped in %s", test.name, elapsed)
+		}
+	}
+}
+
+func TestParseAnalysisSpec(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:        "no analysis",
+			annotations: map[string]string{},
+			expected:    "<nil>",
+		},
+		{
+			name: "defaults",
+			annotations: map[string]string{
+				AnalysisQueryAnnoName:     "sum(rate(errors[1m]))",
+				AnalysisThresholdAnnoName: "< 5",
+			},
+			expected: `"sum(rate(errors[1m]))" < 5 1m0s 10s`,
+		},
+		{
+			name: "duration and interval",
+			annotations: map[string]string{
+				AnalysisQueryAnnoName:     "up",
+				AnalysisThresholdAnnoName: ">=1",
+				AnalysisDurationAnnoName:  "5m",
+				AnalysisIntervalAnnoName:  "30s",
+			},
+			expected: `"up" >= 1 5m0s 30s`,
+		},
+		{
+			name: "threshold without operator",
+			annotations: map[string]string{
+				AnalysisQueryAnnoName:     "up",
+				AnalysisThresholdAnnoName: "1",
+			},
+			expectedError: "deployment/app annotation werf.io/analysis-threshold with invalid value 1: OPERATOR NUMBER expected, where OPERATOR is one of [<= >= == != < >]",
+		},
+		{
+			name: "threshold without query",
+			annotations: map[string]string{
+				AnalysisThresholdAnnoName: "< 1",
+			},
+			expectedError: "deployment/app annotation werf.io/analysis-threshold cannot be used without werf.io/analysis-query",
+		},
+	}
+
+	for _, test := range tests {
+		template := Template{Kind: "Deployment"}
+		template.Metadata.Name = "app"
+		template.Metadata.Annotations = test.annotations
+
+		spec, err := parseAnalysisSpec(template)
+
+		var got, gotError string
+		if err != nil {
+			gotError = err.Error()
+		} else if spec == nil {
+			got = "<nil>"
+		} else {
+			got = fmt.Sprintf("%q %s %s %s", spec.Query, spec.Threshold, spec.Duration, spec.Interval)
+		}
+
+		if got != test.expected || gotError != test.expectedError {
+			t.Errorf("%s:\n[EXPECTED]:\n%s%s\n[GOT]:\n%s%s", test.name, test.expected, test.expectedError, got, gotError)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/ghodss/yaml"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/helm/pkg/releaseutil"
+
+	"github.com/flant/kubedog/pkg/kube"
+
+	"github.com/flant/werf/pkg/true_git/xdiff"
+	"github.com/flant/werf/pkg/util/secretvalues"
+)
+
+type DiffOutputType string
+
+const (
+	TextDiffOutput DiffOutputType = "text"
+	JsonDiffOutput DiffOutputType = "json"
+)
+
+type ResourceChange string
+
+const (
+	AddedResourceChange     ResourceChange = "added"
+	RemovedResourceChange   ResourceChange = "removed"
+	ChangedResourceChange   ResourceChange = "changed"
+	UnchangedResourceChange ResourceChange = "unchanged"
+)
+
+const diffContextLines = 3
+
+// Live object fields that are managed by the cluster and never present in the chart
+var liveMetadataFieldsToRemove = []string{"uid", "resourceVersion", "generation", "creationTimestamp", "selfLink", "managedFields"}
+
+type ResourceDiff struct {
+	Kind      string         `json:"kind"`
+	Name      string         `json:"name"`
+	Namespace string         `json:"namespace,omitempty"`
+	Change    ResourceChange `json:"change"`
+	Diff      string         `json:"diff,omitempty"`
+}
+
+type DiffOptions struct {
+	// Live objects of the cluster are compared with the rendered chart instead of the latest release revision
+	Live   bool
+	Output DiffOutputType
+}
+
+type diffManifest struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Data      string
+
+	// object with masked secret values
+	obj map[string]interface{}
+	// secret values by field path are used only to detect changes and never printed
+	secretValues map[string]string
+}
+
+const (
+	maskedSecretValue        = "***"
+	maskedChangedSecretValue = "*** (changed)"
+)
+
+func newDiffManifest(kind, name, namespace string, obj map[string]interface{}) (*diffManifest, error) {
+	m := &diffManifest{Kind: kind, Name: name, Namespace: namespace, obj: obj}
+	if kind == "Secret" {
+		m.secretValues = maskSecretData(obj)
+	}
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m.Data = string(data)
+
+	return m, nil
+}
+
+// maskSecretData replaces all values of the Secret data and stringData with the mask and returns original values
+func maskSecretData(obj map[string]interface{}) map[string]string {
+	secretValues := map[string]string{}
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := obj[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for key, value := range values {
+			secretValues[field+"."+key] = fmt.Sprintf("%v", value)
+			values[key] = maskedSecretValue
+		}
+	}
+
+	return secretValues
+}
+
+// markChangedSecretValues distinguishes masked values that differ from the values of the old manifest
+func (m *diffManifest) markChangedSecretValues(oldManifest *diffManifest) error {
+	var isChanged bool
+	for path, value := range m.secretValues {
+		oldValue, hasKey := oldManifest.secretValues[path]
+		if !hasKey || oldValue == value {
+			continue
+		}
+
+		parts := strings.SplitN(path, ".", 2)
+		m.obj[parts[0]].(map[string]interface{})[parts[1]] = maskedChangedSecretValue
+		isChanged = true
+	}
+
+	if !isChanged {
+		return nil
+	}
+
+	data, err := yaml.Marshal(m.obj)
+	if err != nil {
+		return err
+	}
+	m.Data = string(data)
+
+	return nil
+}
+
+func (m *diffManifest) ID() string {
+	return fmt.Sprintf("%s/%s/%s", m.Kind, m.Namespace, m.Name)
+}
+
+// Diff compares the rendered chart manifests with the manifests of the latest release revision or live objects
+func Diff(out io.Writer, releaseName, namespace, renderedManifests string, opts DiffOptions) error {
+	newManifests, err := parseDiffManifests(renderedManifests, namespace)
+	if err != nil {
+		return fmt.Errorf("unable to parse chart templates: %s", err)
+	}
+
+	revision, revisionManifests, err := getLatestRevisionDiffManifests(releaseName, namespace)
+	if err != nil {
+		return err
+	}
+
+	oldManifests := revisionManifests
+	oldLabel := fmt.Sprintf("revision %d", revision)
+	if revision == 0 {
+		oldLabel = "no release"
+	}
+
+	if opts.Live {
+		oldManifests, err = getLiveDiffManifests(newManifests, revisionManifests)
+		if err != nil {
+			return err
+		}
+		oldLabel = "live"
+	}
+
+	resourceDiffs, err := diffManifests(oldManifests, newManifests, oldLabel, "rendered")
+	if err != nil {
+		return err
+	}
+
+	for _, d := range resourceDiffs {
+		d.Diff = secretvalues.MaskSecretValuesInString(releaseLogSecretValuesToMask, d.Diff)
+	}
+
+	switch opts.Output {
+	case JsonDiffOutput:
+		return printJsonDiff(out, resourceDiffs)
+	default:
+		return printTextDiff(out, resourceDiffs)
+	}
+}
+
+func getLatestRevisionDiffManifests(releaseName, namespace string) (int32, map[string]*diffManifest, error) {
+	resp, err := releaseHistory(releaseName, releaseHistoryOptions{Max: 1})
+	if err != nil {
+		if isReleaseNotFoundError(err) {
+			return 0, map[string]*diffManifest{}, nil
+		}
+
+		return 0, nil, fmt.Errorf("unable to get release %s history: %s", releaseName, err)
+	}
+
+	var revision int32
+	for _, r := range resp.Releases {
+		if r.Version > revision {
+			revision = r.Version
+		}
+	}
+
+	if revision == 0 {
+		return 0, map[string]*diffManifest{}, nil
+	}
+
+	rawTemplates, err := getRawTemplatesFromRevision(releaseName, revision)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to get release %s revision %d: %s", releaseName, revision, err)
+	}
+
+	manifests, err := parseDiffManifests(rawTemplates, namespace)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to parse revision templates: %s", err)
+	}
+
+	return revision, manifests, nil
+}
+
+// getLiveDiffManifests gets live objects for all resources that would be created, changed or removed by deploy
+func getLiveDiffManifests(newManifests, revisionManifests map[string]*diffManifest) (map[string]*diffManifest, error) {
+	resources, err := newLiveResources()
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover cluster resources: %s", err)
+	}
+
+	liveManifests := map[string]*diffManifest{}
+	for _, manifests := range []map[string]*diffManifest{newManifests, revisionManifests} {
+		for id, m := range manifests {
+			if _, hasKey := liveManifests[id]; hasKey {
+				continue
+			}
+
+			liveManifest, err := resources.Get(m)
+			if err != nil {
+				return nil, err
+			}
+
+			if liveManifest != nil {
+				liveManifests[id] = liveManifest
+			}
+		}
+	}
+
+	return liveManifests, nil
+}
+
+type liveResources struct {
+	resources map[string]metav1.APIResource
+	groups    map[string]schema.GroupVersion
+}
+
+func newLiveResources() (*liveResources, error) {
+	lists, err := kube.Kubernetes.Discovery().ServerPreferredResources()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &liveResources{resources: map[string]metav1.APIResource{}, groups: map[string]schema.GroupVersion{}}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, resource := range list.APIResources {
+			if len(resource.Verbs) == 0 {
+				continue
+			}
+
+			if _, hasKey := r.resources[resource.Kind]; !hasKey {
+				r.resources[resource.Kind] = resource
+				r.groups[resource.Kind] = gv
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Get returns nil when the object does not exist
+func (r *liveResources) Get(m *diffManifest) (*diffManifest, error) {
+	resource, hasKey := r.resources[m.Kind]
+	if !hasKey {
+		return nil, fmt.Errorf("unable to find resource for %s", m.Kind)
+	}
+
+	gvr := r.groups[m.Kind].WithResource(resource.Name)
+
+	var res dynamic.ResourceInterface
+	if resource.Namespaced {
+		res = kube.DynamicClient.Resource(gvr).Namespace(m.Namespace)
+	} else {
+		res = kube.DynamicClient.Resource(gvr)
+	}
+
+	obj, err := res.Get(m.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("unable to get %s/%s: %s", strings.ToLower(m.Kind), m.Name, err)
+	}
+
+	content := obj.UnstructuredContent()
+	delete(content, "status")
+
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, field := range liveMetadataFieldsToRemove {
+			delete(metadata, field)
+		}
+
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+
+	liveManifest, err := newDiffManifest(m.Kind, m.Name, m.Namespace, content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal %s/%s: %s", strings.ToLower(m.Kind), m.Name, err)
+	}
+
+	return liveManifest, nil
+}
+
+// parseDiffManifests splits manifests by resources, the data of each resource is normalized to make the diff independent of formatting and keys order
+func parseDiffManifests(rawManifests, namespace string) (map[string]*diffManifest, error) {
+	manifests := map[string]*diffManifest{}
+
+	for _, doc := range releaseutil.SplitManifests(rawManifests) {
+		jsonData, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, fmt.Errorf("%s\n\n%s", err, doc)
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal(jsonData, &obj); err != nil {
+			return nil, fmt.Errorf("%s\n\n%s", err, doc)
+		}
+
+		if obj == nil {
+			continue
+		}
+
+		kind, _ := obj["kind"].(string)
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if name == "" {
+			continue
+		}
+
+		resourceNamespace, _ := metadata["namespace"].(string)
+		if resourceNamespace == "" {
+			resourceNamespace = namespace
+		}
+
+		m, err := newDiffManifest(kind, name, resourceNamespace, obj)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests[m.ID()] = m
+	}
+
+	return manifests, nil
+}
+
+func diffManifests(oldManifests, newManifests map[string]*diffManifest, oldLabel, newLabel string) ([]*ResourceDiff, error) {
+	var ids []string
+	for id := range oldManifests {
+		ids = append(ids, id)
+	}
+	for id := range newManifests {
+		if _, hasKey := oldManifests[id]; !hasKey {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var resourceDiffs []*ResourceDiff
+	for _, id := range ids {
+		oldManifest, newManifest := oldManifests[id], newManifests[id]
+
+		d := &ResourceDiff{}
+		var oldData, newData string
+		switch {
+		case oldManifest == nil:
+			d.Change = AddedResourceChange
+			newData = newManifest.Data
+		case newManifest == nil:
+			d.Change = RemovedResourceChange
+			oldData = oldManifest.Data
+		default:
+			if err := newManifest.markChangedSecretValues(oldManifest); err != nil {
+				return nil, fmt.Errorf("unable to marshal %s/%s: %s", strings.ToLower(newManifest.Kind), newManifest.Name, err)
+			}
+
+			oldData, newData = oldManifest.Data, newManifest.Data
+			if oldData == newData {
+				d.Change = UnchangedResourceChange
+			} else {
+				d.Change = ChangedResourceChange
+			}
+		}
+
+		m := newManifest
+		if m == nil {
+			m = oldManifest
+		}
+		d.Kind, d.Name, d.Namespace = m.Kind, m.Name, m.Namespace
+
+		if d.Change != UnchangedResourceChange {
+			hunks := xdiff.Diff([]byte(oldData), []byte(newData), diffContextLines)
+			d.Diff = fmt.Sprintf("--- %s\n+++ %s\n%s", oldLabel, newLabel, hunks)
+		}
+
+		resourceDiffs = append(resourceDiffs, d)
+	}
+
+	return resourceDiffs, nil
+}
+
+func printJsonDiff(out io.Writer, resourceDiffs []*ResourceDiff) error {
+	if resourceDiffs == nil {
+		resourceDiffs = []*ResourceDiff{}
+	}
+
+	data, err := json.MarshalIndent(resourceDiffs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
+
+func printTextDiff(out io.Writer, resourceDiffs []*ResourceDiff) error {
+	changes := map[ResourceChange]int{}
+
+	for _, d := range resourceDiffs {
+		changes[d.Change]++
+		if d.Change == UnchangedResourceChange {
+			continue
+		}
+
+		header := fmt.Sprintf("%s/%s", strings.ToLower(d.Kind), d.Name)
+		if d.Namespace != "" {
+			header += fmt.Sprintf(" (namespace %s)", d.Namespace)
+		}
+		header += fmt.Sprintf(" %s", d.Change)
+
+		if _, err := fmt.Fprintf(out, "%s\n%s\n", color.New(color.Bold).Sprint(header), colorizeDiff(d.Diff)); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(out, "%d added, %d changed, %d removed, %d unchanged\n", changes[AddedResourceChange], changes[ChangedResourceChange], changes[RemovedResourceChange], changes[UnchangedResourceChange])
+	return err
+}
+
+func colorizeDiff(diff string) string {
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for ind, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++"):
+			lines[ind] = color.New(color.Bold).Sprint(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[ind] = color.New(color.FgCyan).Sprint(line)
+		case strings.HasPrefix(line, "+"):
+			lines[ind] = color.New(color.FgGreen).Sprint(line)
+		case strings.HasPrefix(line, "-"):
+			lines[ind] = color.New(color.FgRed).Sprint(line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,166 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiffManifests(t *testing.T) {
+	tests := []struct {
+		name         string
+		oldManifests string
+		newManifests string
+		expected     string
+	}{
+		{
+			name: "formatting and keys order are ignored",
+			oldManifests: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  b: "2"
+  a: "1"
+`,
+			newManifests: `
+---
+# Source: chart/templates/config.yaml
+kind: ConfigMap
+apiVersion: v1
+metadata: {name: config}
+data: {a: "1", b: "2"}
+`,
+			expected: "configmap/config unchanged\n",
+		},
+		{
+			name: "added, changed and removed resources",
+			oldManifests: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  a: "1"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: old
+  namespace: other
+`,
+			newManifests: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  a: "2"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: new
+`,
+			expected: `configmap/config changed
+--- revision 1
++++ rendered
+@@ -1,6 +1,6 @@
+ apiVersion: v1
+ data:
+-  a: "1"
++  a: "2"
+ kind: ConfigMap
+ metadata:
+   name: config
+secret/new added
+--- revision 1
++++ rendered
+@@ -0,0 +1,4 @@
++apiVersion: v1
++kind: Secret
++metadata:
++  name: new
+service/old removed
+--- revision 1
++++ rendered
+@@ -1,5 +0,0 @@
+-apiVersion: v1
+-kind: Service
+-metadata:
+-  name: old
+-  namespace: other
+`,
+		},
+		{
+			name: "secret values are masked",
+			oldManifests: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: secret
+data:
+  password: c2VjcmV0MQ==
+  token: dG9rZW4=
+stringData:
+  config: "key: value1"
+`,
+			newManifests: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: secret
+data:
+  password: c2VjcmV0Mg==
+  token: dG9rZW4=
+  user: dXNlcg==
+stringData:
+  config: "key: value2"
+`,
+			expected: `secret/secret changed
+--- revision 1
++++ rendered
+@@ -1,9 +1,10 @@
+ apiVersion: v1
+ data:
+-  password: '***'
++  password: '*** (changed)'
+   token: '***'
++  user: '***'
+ kind: Secret
+ metadata:
+   name: secret
+ stringData:
+-  config: '***'
++  config: '*** (changed)'
+`,
+		},
+	}
+
+	for _, test := range tests {
+		oldManifests, err := parseDiffManifests(test.oldManifests, "ns")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		newManifests, err := parseDiffManifests(test.newManifests, "ns")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		resourceDiffs, err := diffManifests(oldManifests, newManifests, "revision 1", "rendered")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		var got string
+		for _, d := range resourceDiffs {
+			got += fmt.Sprintf("%s/%s %s\n%s", strings.ToLower(d.Kind), d.Name, d.Change, d.Diff)
+		}
+
+		if got != test.expected {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,638 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage/driver"
+	storageerrors "k8s.io/helm/pkg/storage/errors"
+	"k8s.io/helm/pkg/timeconv"
+)
+
+const (
+	Helm3SecretsDriverName = "Helm3Secret"
+
+	helm3ReleaseSecretType       = "helm.sh/release.v1"
+	helm3ReleaseSecretNamePrefix = "sh.helm.release.v1."
+	helm3ReleaseOwner            = "helm"
+)
+
+var (
+	_ driver.Driver = (*Helm3Secrets)(nil)
+
+	helm3ReleaseStatusByCode = map[release.Status_Code]string{
+		release.Status_UNKNOWN:          "unknown",
+		release.Status_DEPLOYED:         "deployed",
+		release.Status_DELETED:          "uninstalled",
+		release.Status_SUPERSEDED:       "superseded",
+		release.Status_FAILED:           "failed",
+		release.Status_DELETING:         "uninstalling",
+		release.Status_PENDING_INSTALL:  "pending-install",
+		release.Status_PENDING_UPGRADE:  "pending-upgrade",
+		release.Status_PENDING_ROLLBACK: "pending-rollback",
+	}
+
+	helm3HookEventByEvent = map[release.Hook_Event]string{
+		release.Hook_UNKNOWN:              "unknown",
+		release.Hook_PRE_INSTALL:          "pre-install",
+		release.Hook_POST_INSTALL:         "post-install",
+		release.Hook_PRE_DELETE:           "pre-delete",
+		release.Hook_POST_DELETE:          "post-delete",
+		release.Hook_PRE_UPGRADE:          "pre-upgrade",
+		release.Hook_POST_UPGRADE:         "post-upgrade",
+		release.Hook_PRE_ROLLBACK:         "pre-rollback",
+		release.Hook_POST_ROLLBACK:        "post-rollback",
+		release.Hook_RELEASE_TEST_SUCCESS: "test",
+		release.Hook_RELEASE_TEST_FAILURE: "test-failure",
+		release.Hook_CRD_INSTALL:          "crd-install",
+	}
+
+	helm3HookDeletePolicyByPolicy = map[release.Hook_DeletePolicy]string{
+		release.Hook_SUCCEEDED:            "hook-succeeded",
+		release.Hook_FAILED:               "hook-failed",
+		release.Hook_BEFORE_HOOK_CREATION: "before-hook-creation",
+	}
+)
+
+// Helm3Secrets is the release storage driver compatible with Helm 3: each release revision is stored
+// in the release namespace as the sh.helm.release.v1.NAME.vVERSION secret.
+// The driver is scoped to the namespace of the secrets client, like the Helm 3 driver
+type Helm3Secrets struct {
+	Client corev1.SecretInterface
+	Log    func(string, ...interface{})
+}
+
+func NewHelm3Secrets(client corev1.SecretInterface) *Helm3Secrets {
+	return &Helm3Secrets{
+		Client: client,
+		Log:    func(_ string, _ ...interface{}) {},
+	}
+}
+
+func (secrets *Helm3Secrets) Name() string {
+	return Helm3SecretsDriverName
+}
+
+func (secrets *Helm3Secrets) Get(key string) (*release.Release, error) {
+	obj, err := secrets.getSecret(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rls, err := decodeHelm3Release(obj)
+	if err != nil {
+		secrets.Log("get: failed to decode data %q: %s", key, err)
+		return nil, err
+	}
+
+	return rls, nil
+}
+
+func (secrets *Helm3Secrets) List(filter func(*release.Release) bool) ([]*release.Release, error) {
+	list, err := secrets.listSecrets(map[string]string{"owner": helm3ReleaseOwner})
+	if err != nil {
+		secrets.Log("list: failed to list: %s", err)
+		return nil, err
+	}
+
+	var results []*release.Release
+	for _, item := range list {
+		rls, err := decodeHelm3Release(&item)
+		if err != nil {
+			secrets.Log("list: failed to decode release %q: %s", item.Name, err)
+			continue
+		}
+
+		if filter(rls) {
+			results = append(results, rls)
+		}
+	}
+
+	return results, nil
+}
+
+// Query translates Helm 2 storage labels (NAME, OWNER, STATUS, VERSION) into Helm 3 ones
+func (secrets *Helm3Secrets) Query(labels map[string]string) ([]*release.Release, error) {
+	helm3Labels := map[string]string{}
+	for k, v := range labels {
+		switch k {
+		case "OWNER":
+			helm3Labels["owner"] = helm3ReleaseOwner
+		case "STATUS":
+			code, hasKey := release.Status_Code_value[v]
+			if !hasKey {
+				return nil, fmt.Errorf("invalid release status %q", v)
+			}
+			helm3Labels["status"] = helm3ReleaseStatusByCode[release.Status_Code(code)]
+		default:
+			helm3Labels[strings.ToLower(k)] = v
+		}
+	}
+
+	list, err := secrets.listSecrets(helm3Labels)
+	if err != nil {
+		secrets.Log("query: failed to query with labels: %s", err)
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, storageerrors.ErrReleaseNotFound(labels["NAME"])
+	}
+
+	var results []*release.Release
+	for _, item := range list {
+		rls, err := decodeHelm3Release(&item)
+		if err != nil {
+			secrets.Log("query: failed to decode release %q: %s", item.Name, err)
+			continue
+		}
+		results = append(results, rls)
+	}
+
+	return results, nil
+}
+
+func (secrets *Helm3Secrets) Create(key string, rls *release.Release) error {
+	obj, err := newHelm3ReleaseSecret(key, rls)
+	if err != nil {
+		secrets.Log("create: failed to encode release %q: %s", rls.Name, err)
+		return err
+	}
+	obj.Labels["createdAt"] = strconv.Itoa(int(time.Now().Unix()))
+
+	if _, err := secrets.Client.Create(obj); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return storageerrors.ErrReleaseExists(key)
+		}
+
+		secrets.Log("create: failed to create: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (secrets *Helm3Secrets) Update(key string, rls *release.Release) error {
+	obj, err := newHelm3ReleaseSecret(key, rls)
+	if err != nil {
+		secrets.Log("update: failed to encode release %q: %s", rls.Name, err)
+		return err
+	}
+	obj.Labels["modifiedAt"] = strconv.Itoa(int(time.Now().Unix()))
+
+	if _, err := secrets.Client.Update(obj); err != nil {
+		secrets.Log("update: failed to update: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (secrets *Helm3Secrets) Delete(key string) (*release.Release, error) {
+	obj, err := secrets.getSecret(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rls, err := decodeHelm3Release(obj)
+	if err != nil {
+		secrets.Log("delete: failed to decode data %q: %s", key, err)
+		return nil, err
+	}
+
+	if err := secrets.Client.Delete(obj.Name, &metav1.DeleteOptions{}); err != nil {
+		return rls, err
+	}
+
+	return rls, nil
+}
+
+func (secrets *Helm3Secrets) getSecret(key string) (*v1.Secret, error) {
+	if _, _, err := parseReleaseStorageKey(key); err != nil {
+		return nil, err
+	}
+
+	obj, err := secrets.Client.Get(helm3ReleaseSecretNamePrefix+key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, storageerrors.ErrReleaseNotFound(key)
+		}
+
+		secrets.Log("get: failed to get %q: %s", key, err)
+		return nil, err
+	}
+
+	if string(obj.Type) != helm3ReleaseSecretType {
+		return nil, storageerrors.ErrReleaseNotFound(key)
+	}
+
+	return obj, nil
+}
+
+func (secrets *Helm3Secrets) listSecrets(labels map[string]string) ([]v1.Secret, error) {
+	ls := kblabels.Set{}
+	for k, v := range labels {
+		if errs := validation.IsValidLabelValue(v); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid label value: %q: %s", v, strings.Join(errs, "; "))
+		}
+		ls[k] = v
+	}
+
+	list, err := secrets.Client.List(metav1.ListOptions{LabelSelector: ls.AsSelector().String()})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []v1.Secret
+	for _, item := range list.Items {
+		if string(item.Type) == helm3ReleaseSecretType {
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+// parseReleaseStorageKey splits the storage key NAME.vVERSION
+func parseReleaseStorageKey(key string) (string, string, error) {
+	ind := strings.LastIndex(key, ".v")
+	if ind == -1 {
+		return "", "", storageerrors.ErrInvalidKey(key)
+	}
+
+	if _, err := strconv.Atoi(key[ind+2:]); err != nil {
+		return "", "", storageerrors.ErrInvalidKey(key)
+	}
+
+	return key[:ind], key[ind+2:], nil
+}
+
+func newHelm3ReleaseSecret(key string, rls *release.Release) (*v1.Secret, error) {
+	data, err := encodeHelm3Release(rls)
+	if err != nil {
+		return nil, err
+	}
+
+	status := helm3ReleaseStatusByCode[release.Status_UNKNOWN]
+	if rls.Info != nil && rls.Info.Status != nil {
+		status = helm3ReleaseStatusByCode[rls.Info.Status.Code]
+	}
+
+	annotations := map[string]string{}
+	if rls.ThreeWayMergeEnabled {
+		annotations[driver.ThreeWayMergeEnabledAnnotation] = "true"
+	}
+	if rls.ResourcesHasOwnerReleaseName {
+		annotations[driver.ResourcesHasOwnerReleaseNameAnnotation] = "true"
+	}
+
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      helm3ReleaseSecretNamePrefix + key,
+			Namespace: rls.Namespace,
+			Labels: map[string]string{
+				"name":    rls.Name,
+				"owner":   helm3ReleaseOwner,
+				"status":  status,
+				"version": strconv.Itoa(int(rls.Version)),
+			},
+			Annotations: annotations,
+		},
+		Type: helm3ReleaseSecretType,
+		Data: map[string][]byte{"release": []byte(data)},
+	}, nil
+}
+
+// helm3Release is the JSON representation of the release used by Helm 3 (helm.sh/helm/v3/pkg/release)
+type helm3Release struct {
+	Name      string                 `json:"name,omitempty"`
+	Info      *helm3ReleaseInfo      `json:"info,omitempty"`
+	Chart     *helm3Chart            `json:"chart,omitempty"`
+	Config    map[string]interface{} `json:"config,omitempty"`
+	Manifest  string                 `json:"manifest,omitempty"`
+	Hooks     []*helm3Hook           `json:"hooks,omitempty"`
+	Version   int                    `json:"version,omitempty"`
+	Namespace string                 `json:"namespace,omitempty"`
+}
+
+type helm3ReleaseInfo struct {
+	FirstDeployed time.Time `json:"first_deployed,omitempty"`
+	LastDeployed  time.Time `json:"last_deployed,omitempty"`
+	Deleted       time.Time `json:"deleted"`
+	Description   string    `json:"description,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Notes         string    `json:"notes,omitempty"`
+}
+
+type helm3Chart struct {
+	Metadata  *chart.Metadata        `json:"metadata"`
+	Templates []*helm3File           `json:"templates"`
+	Values    map[string]interface{} `json:"values"`
+	Files     []*helm3File           `json:"files"`
+}
+
+type helm3File struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+type helm3Hook struct {
+	Name           string             `json:"name,omitempty"`
+	Kind           string             `json:"kind,omitempty"`
+	Path           string             `json:"path,omitempty"`
+	Manifest       string             `json:"manifest,omitempty"`
+	Events         []string           `json:"events,omitempty"`
+	LastRun        helm3HookExecution `json:"last_run,omitempty"`
+	Weight         int                `json:"weight,omitempty"`
+	DeletePolicies []string           `json:"delete_policies,omitempty"`
+}
+
+type helm3HookExecution struct {
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+	Phase       string    `json:"phase"`
+}
+
+// encodeHelm3Release returns base64 encoded gzipped JSON of the release as Helm 3 does
+func encodeHelm3Release(rls *release.Release) (string, error) {
+	r, err := toHelm3Release(rls)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(b); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decodeHelm3Release(obj *v1.Secret) (*release.Release, error) {
+	b, err := base64.StdEncoding.DecodeString(string(obj.Data["release"]))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > 3 && bytes.Equal(b[0:3], []byte{0x1f, 0x8b, 0x08}) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var r helm3Release
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	rls, err := fromHelm3Release(&r)
+	if err != nil {
+		return nil, err
+	}
+
+	rls.ThreeWayMergeEnabled = obj.Annotations[driver.ThreeWayMergeEnabledAnnotation] == "true"
+	rls.ResourcesHasOwnerReleaseName = obj.Annotations[driver.ResourcesHasOwnerReleaseNameAnnotation] == "true"
+
+	return rls, nil
+}
+
+func toHelm3Release(rls *release.Release) (*helm3Release, error) {
+	r := &helm3Release{
+		Name:      rls.Name,
+		Manifest:  rls.Manifest,
+		Version:   int(rls.Version),
+		Namespace: rls.Namespace,
+	}
+
+	if rls.Info != nil {
+		r.Info = &helm3ReleaseInfo{
+			FirstDeployed: fromTimestamp(rls.Info.FirstDeployed),
+			LastDeployed:  fromTimestamp(rls.Info.LastDeployed),
+			Deleted:       fromTimestamp(rls.Info.Deleted),
+			Description:   rls.Info.Description,
+			Status:        helm3ReleaseStatusByCode[release.Status_UNKNOWN],
+		}
+
+		if rls.Info.Status != nil {
+			r.Info.Status = helm3ReleaseStatusByCode[rls.Info.Status.Code]
+			r.Info.Notes = rls.Info.Status.Notes
+		}
+	}
+
+	if rls.Config != nil {
+		config, err := rawValuesToMap(rls.Config.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("bad release config: %s", err)
+		}
+		r.Config = config
+	}
+
+	if rls.Chart != nil {
+		c := &helm3Chart{Metadata: rls.Chart.Metadata}
+
+		for _, t := range rls.Chart.Templates {
+			c.Templates = append(c.Templates, &helm3File{Name: t.Name, Data: t.Data})
+		}
+
+		for _, f := range rls.Chart.Files {
+			c.Files = append(c.Files, &helm3File{Name: f.TypeUrl, Data: f.Value})
+		}
+
+		if rls.Chart.Values != nil {
+			values, err := rawValuesToMap(rls.Chart.Values.Raw)
+			if err != nil {
+				return nil, fmt.Errorf("bad chart values: %s", err)
+			}
+			c.Values = values
+		}
+
+		r.Chart = c
+	}
+
+	for _, h := range rls.Hooks {
+		hook := &helm3Hook{
+			Name:     h.Name,
+			Kind:     h.Kind,
+			Path:     h.Path,
+			Manifest: h.Manifest,
+			Weight:   int(h.Weight),
+		}
+
+		for _, event := range h.Events {
+			hook.Events = append(hook.Events, helm3HookEventByEvent[event])
+		}
+
+		for _, policy := range h.DeletePolicies {
+			hook.DeletePolicies = append(hook.DeletePolicies, helm3HookDeletePolicyByPolicy[policy])
+		}
+
+		if lastRun := fromTimestamp(h.LastRun); !lastRun.IsZero() {
+			hook.LastRun = helm3HookExecution{StartedAt: lastRun, CompletedAt: lastRun, Phase: "Succeeded"}
+		}
+
+		r.Hooks = append(r.Hooks, hook)
+	}
+
+	return r, nil
+}
+
+func fromHelm3Release(r *helm3Release) (*release.Release, error) {
+	rls := &release.Release{
+		Name:      r.Name,
+		Manifest:  r.Manifest,
+		Version:   int32(r.Version),
+		Namespace: r.Namespace,
+	}
+
+	if r.Info != nil {
+		rls.Info = &release.Info{
+			FirstDeployed: toTimestamp(r.Info.FirstDeployed),
+			LastDeployed:  toTimestamp(r.Info.LastDeployed),
+			Deleted:       toTimestamp(r.Info.Deleted),
+			Description:   r.Info.Description,
+			Status: &release.Status{
+				Code:  release.Status_UNKNOWN,
+				Notes: r.Info.Notes,
+			},
+		}
+
+		for code, status := range helm3ReleaseStatusByCode {
+			if status == r.Info.Status {
+				rls.Info.Status.Code = code
+			}
+		}
+	}
+
+	raw, err := mapToRawValues(r.Config)
+	if err != nil {
+		return nil, fmt.Errorf("bad release config: %s", err)
+	}
+	rls.Config = &chart.Config{Raw: raw}
+
+	if r.Chart != nil {
+		c := &chart.Chart{Metadata: r.Chart.Metadata}
+
+		for _, t := range r.Chart.Templates {
+			c.Templates = append(c.Templates, &chart.Template{Name: t.Name, Data: t.Data})
+		}
+
+		for _, f := range r.Chart.Files {
+			c.Files = append(c.Files, &any.Any{TypeUrl: f.Name, Value: f.Data})
+		}
+
+		raw, err := mapToRawValues(r.Chart.Values)
+		if err != nil {
+			return nil, fmt.Errorf("bad chart values: %s", err)
+		}
+		c.Values = &chart.Config{Raw: raw}
+
+		rls.Chart = c
+	}
+
+	for _, h := range r.Hooks {
+		hook := &release.Hook{
+			Name:     h.Name,
+			Kind:     h.Kind,
+			Path:     h.Path,
+			Manifest: h.Manifest,
+			Weight:   int32(h.Weight),
+			LastRun:  toTimestamp(h.LastRun.CompletedAt),
+		}
+
+		for _, event := range h.Events {
+			for e, helm3Event := range helm3HookEventByEvent {
+				// Helm 3 prior to 3.0.0 used test-success event name
+				if helm3Event == event || (event == "test-success" && e == release.Hook_RELEASE_TEST_SUCCESS) {
+					hook.Events = append(hook.Events, e)
+				}
+			}
+		}
+
+		for _, policy := range h.DeletePolicies {
+			for p, helm3Policy := range helm3HookDeletePolicyByPolicy {
+				if helm3Policy == policy {
+					hook.DeletePolicies = append(hook.DeletePolicies, p)
+				}
+			}
+		}
+
+		rls.Hooks = append(rls.Hooks, hook)
+	}
+
+	return rls, nil
+}
+
+func rawValuesToMap(raw string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func mapToRawValues(values map[string]interface{}) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	raw, err := yaml.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
+}
+
+func fromTimestamp(ts *timestamp.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+
+	return timeconv.Time(ts).UTC()
+}
+
+func toTimestamp(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timeconv.Timestamp(t)
+}
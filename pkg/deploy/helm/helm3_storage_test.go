@@ -0,0 +1,193 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage/driver"
+	"k8s.io/helm/pkg/timeconv"
+
+	"github.com/flant/kubedog/pkg/kube"
+)
+
+func newTestRelease(name, namespace string, version int32, code release.Status_Code) *release.Release {
+	deployed := timeconv.Timestamp(time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC))
+
+	return &release.Release{
+		Name:      name,
+		Namespace: namespace,
+		Version:   version,
+		Info: &release.Info{
+			Status:        &release.Status{Code: code, Notes: "notes"},
+			FirstDeployed: deployed,
+			LastDeployed:  deployed,
+			Description:   "Install complete",
+		},
+		Chart: &chart.Chart{
+			Metadata:  &chart.Metadata{Name: "app", Version: "0.1.0", ApiVersion: "v1"},
+			Templates: []*chart.Template{{Name: "templates/cm.yaml", Data: []byte("kind: ConfigMap")}},
+			Values:    &chart.Config{Raw: "replicas: 1\n"},
+		},
+		Config:   &chart.Config{Raw: "global:\n  env: production\n"},
+		Manifest: "---\nkind: ConfigMap\n",
+		Hooks: []*release.Hook{{
+			Name:           "migrate",
+			Kind:           "Job",
+			Events:         []release.Hook_Event{release.Hook_PRE_INSTALL, release.Hook_PRE_UPGRADE},
+			DeletePolicies: []release.Hook_DeletePolicy{release.Hook_BEFORE_HOOK_CREATION},
+			Weight:         -5,
+		}},
+		ThreeWayMergeEnabled: true,
+	}
+}
+
+func TestHelm3Secrets(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	secrets := NewHelm3Secrets(client.CoreV1().Secrets("app-production"))
+	otherSecrets := NewHelm3Secrets(client.CoreV1().Secrets("other"))
+
+	for _, rls := range []*release.Release{
+		newTestRelease("app", "app-production", 1, release.Status_SUPERSEDED),
+		newTestRelease("app", "app-production", 2, release.Status_DEPLOYED),
+	} {
+		if err := secrets.Create(releaseStorageKey(rls.Name, rls.Version), rls); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := otherSecrets.Create("other.v1", newTestRelease("other", "other", 1, release.Status_DEPLOYED)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Releases of other namespaces are not visible
+	if all, err := secrets.List(func(*release.Release) bool { return true }); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 2 {
+		t.Errorf("list: expected 2 revisions of the namespace, got %d", len(all))
+	}
+
+	if _, err := secrets.Get("other.v1"); err == nil || !isReleaseNotFoundError(err) {
+		t.Errorf("release of other namespace: expected not found error, got %v", err)
+	}
+
+	obj, err := client.CoreV1().Secrets("app-production").Get("sh.helm.release.v1.app.v2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("%s %s %s %s %s", obj.Type, obj.Labels["name"], obj.Labels["owner"], obj.Labels["status"], obj.Labels["version"])
+	if expected := "helm.sh/release.v1 app helm deployed 2"; got != expected {
+		t.Errorf("secret:\n[EXPECTED]:\n%s\n[GOT]:\n%s", expected, got)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(obj.Data["release"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var helm3Rls map[string]interface{}
+	if err := json.Unmarshal(data, &helm3Rls); err != nil {
+		t.Fatal(err)
+	}
+
+	got = fmt.Sprintf("%v %v %v %v", helm3Rls["info"].(map[string]interface{})["status"], helm3Rls["config"], helm3Rls["chart"].(map[string]interface{})["values"], helm3Rls["hooks"].([]interface{})[0].(map[string]interface{})["events"])
+	if expected := "deployed map[global:map[env:production]] map[replicas:1] [pre-install pre-upgrade]"; got != expected {
+		t.Errorf("release json:\n[EXPECTED]:\n%s\n[GOT]:\n%s", expected, got)
+	}
+
+	rls, err := secrets.Get("app.v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = fmt.Sprintf("%s %s %d %s %s %s %v %s %v %v", rls.Name, rls.Namespace, rls.Version, rls.Info.Status.Code, timeconv.String(rls.Info.LastDeployed), rls.Config.Raw, rls.Hooks[0].Events, rls.Chart.Templates[0].Name, rls.Hooks[0].DeletePolicies, rls.ThreeWayMergeEnabled)
+	if expected := fmt.Sprintf("app app-production 2 DEPLOYED %s global:\n  env: production\n [PRE_INSTALL PRE_UPGRADE] templates/cm.yaml [BEFORE_HOOK_CREATION] true", timeconv.String(newTestRelease("", "", 0, 0).Info.LastDeployed)); got != expected {
+		t.Errorf("release:\n[EXPECTED]:\n%s\n[GOT]:\n%s", expected, got)
+	}
+
+	history, err := secrets.Query(map[string]string{"NAME": "app", "OWNER": "TILLER"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Errorf("history: expected 2 revisions, got %d", len(history))
+	}
+
+	deployed, err := secrets.Query(map[string]string{"NAME": "app", "OWNER": "TILLER", "STATUS": "DEPLOYED"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployed) != 1 || deployed[0].Version != 2 {
+		t.Errorf("deployed: expected revision 2, got %v", deployed)
+	}
+
+	if _, err := secrets.Delete("app.v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := secrets.Get("app.v1"); err == nil || !isReleaseNotFoundError(err) {
+		t.Errorf("deleted release: expected not found error, got %v", err)
+	}
+}
+
+func TestMigrateReleaseToHelm3(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	kube.Kubernetes = client
+
+	helm2Storage := driver.NewConfigMaps(client.CoreV1().ConfigMaps("kube-system"))
+	for _, rls := range []*release.Release{
+		newTestRelease("app", "app-production", 1, release.Status_SUPERSEDED),
+		newTestRelease("app", "app-production", 2, release.Status_DEPLOYED),
+	} {
+		if err := helm2Storage.Create(releaseStorageKey(rls.Name, rls.Version), rls); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := MigrateReleaseToHelm3("app", "kube-system", ConfigMapStorage, MigrateReleaseOptions{DeleteHelm2Release: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := client.CoreV1().Secrets("app-production").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, item := range list.Items {
+		got = append(got, fmt.Sprintf("%s=%s", item.Name, item.Labels["status"]))
+	}
+	if expected := "[sh.helm.release.v1.app.v1=superseded sh.helm.release.v1.app.v2=deployed]"; fmt.Sprintf("%v", got) != expected {
+		t.Errorf("migrated secrets:\n[EXPECTED]:\n%s\n[GOT]:\n%v", expected, got)
+	}
+
+	if _, err := helm2Storage.Query(map[string]string{"NAME": "app", "OWNER": "TILLER"}); err == nil || !isReleaseNotFoundError(err) {
+		t.Errorf("helm 2 release should be deleted, got %v", err)
+	}
+
+	expectedError := "release app already exists in Helm 3 release storage in namespace app-production"
+	if err := helm2Storage.Create("app.v1", newTestRelease("app", "app-production", 1, release.Status_DEPLOYED)); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateReleaseToHelm3("app", "kube-system", ConfigMapStorage, MigrateReleaseOptions{}); err == nil || err.Error() != expectedError {
+		t.Errorf("second migration:\n[EXPECTED]:\n%s\n[GOT]:\n%v", expectedError, err)
+	}
+}
@@ -0,0 +1,105 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage/driver"
+
+	"github.com/flant/kubedog/pkg/kube"
+	"github.com/flant/logboek"
+)
+
+type MigrateReleaseOptions struct {
+	DeleteHelm2Release bool
+	DryRun             bool
+}
+
+// MigrateReleaseToHelm3 copies all revisions of the release from the Helm 2 release storage into Helm 3 release secrets
+func MigrateReleaseToHelm3(releaseName, helmReleaseStorageNamespace, helmReleaseStorageType string, opts MigrateReleaseOptions) error {
+	var helm2Storage driver.Driver
+	switch helmReleaseStorageType {
+	case ConfigMapStorage:
+		helm2Storage = driver.NewConfigMaps(kube.Kubernetes.CoreV1().ConfigMaps(helmReleaseStorageNamespace))
+	case SecretStorage:
+		helm2Storage = driver.NewSecrets(kube.Kubernetes.CoreV1().Secrets(helmReleaseStorageNamespace))
+	default:
+		return fmt.Errorf("bad helm release storage type '%s' of the release to migrate: use one of '%s' or '%s'", helmReleaseStorageType, ConfigMapStorage, SecretStorage)
+	}
+
+	releases, err := helm2Storage.Query(map[string]string{"NAME": releaseName, "OWNER": "TILLER"})
+	if err != nil {
+		if isReleaseNotFoundError(err) {
+			return fmt.Errorf("release %s not found in %s release storage in namespace %s", releaseName, helmReleaseStorageType, helmReleaseStorageNamespace)
+		}
+
+		return fmt.Errorf("unable to get release %s history: %s", releaseName, err)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].Version < releases[j].Version
+	})
+
+	// Helm 3 stores all revisions of the release in the release namespace
+	namespace := releases[len(releases)-1].Namespace
+	for _, rls := range releases {
+		if rls.Namespace != namespace {
+			return fmt.Errorf("release %s revision %d namespace %s differs from the latest revision namespace %s", releaseName, rls.Version, rls.Namespace, namespace)
+		}
+	}
+
+	helm3Storage := NewHelm3Secrets(kube.Kubernetes.CoreV1().Secrets(namespace))
+
+	if _, err := helm3Storage.Query(map[string]string{"NAME": releaseName, "OWNER": "TILLER"}); err == nil {
+		return fmt.Errorf("release %s already exists in Helm 3 release storage in namespace %s", releaseName, namespace)
+	} else if !isReleaseNotFoundError(err) {
+		return fmt.Errorf("unable to check release %s in Helm 3 release storage: %s", releaseName, err)
+	}
+
+	logProcessMsg := fmt.Sprintf("Migrating release %s to Helm 3 release storage", releaseName)
+	if opts.DryRun {
+		logProcessMsg += " (dry run)"
+	}
+
+	return logboek.Default.LogProcess(logProcessMsg, logboek.LevelLogProcessOptions{}, func() error {
+		for _, rls := range releases {
+			logboek.Default.LogFDetails("revision %d: %s (namespace %s)\n", rls.Version, releaseStatusName(rls), rls.Namespace)
+
+			if opts.DryRun {
+				continue
+			}
+
+			if err := helm3Storage.Create(releaseStorageKey(rls.Name, rls.Version), rls); err != nil {
+				return fmt.Errorf("unable to create release %s revision %d: %s", rls.Name, rls.Version, err)
+			}
+		}
+
+		if !opts.DeleteHelm2Release || opts.DryRun {
+			return nil
+		}
+
+		for _, rls := range releases {
+			if _, err := helm2Storage.Delete(releaseStorageKey(rls.Name, rls.Version)); err != nil {
+				return fmt.Errorf("unable to delete release %s revision %d from %s release storage: %s", rls.Name, rls.Version, helmReleaseStorageType, err)
+			}
+		}
+
+		logboek.Default.LogFDetails("Deleted %d revisions from %s release storage in namespace %s\n", len(releases), helmReleaseStorageType, helmReleaseStorageNamespace)
+
+		return nil
+	})
+}
+
+// releaseStorageKey is the same as the key used by tiller release storage
+func releaseStorageKey(name string, version int32) string {
+	return fmt.Sprintf("%s.v%d", name, version)
+}
+
+func releaseStatusName(rls *release.Release) string {
+	if rls.Info == nil || rls.Info.Status == nil {
+		return release.Status_UNKNOWN.String()
+	}
+
+	return rls.Info.Status.Code.String()
+}
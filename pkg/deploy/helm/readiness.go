@@ -0,0 +1,304 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/flant/kubedog/pkg/trackers/rollout/multitrack"
+	"github.com/flant/logboek"
+)
+
+var readinessPollPeriod = 2 * time.Second
+
+// readinessRule matches either the status condition (Type=Status) or the value of the JSONPath expression ({.path}=value)
+type readinessRule struct {
+	ConditionType string
+	JsonPath      *jsonpath.JSONPath
+	Expression    string
+	Value         string
+}
+
+func parseConditionRule(value string) (*readinessRule, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return nil, fmt.Errorf("Type=Status expected")
+	}
+
+	return &readinessRule{ConditionType: strings.TrimSpace(parts[0]), Value: strings.TrimSpace(parts[1])}, nil
+}
+
+func parseJsonPathRule(value string) (*readinessRule, error) {
+	ind := strings.LastIndex(value, "}")
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") || ind == -1 || !strings.HasPrefix(value[ind+1:], "=") {
+		return nil, fmt.Errorf("{.jsonpath}=value expected")
+	}
+
+	expression := strings.TrimSpace(value[:ind+1])
+	jp := jsonpath.New("").AllowMissingKeys(true)
+	if err := jp.Parse(expression); err != nil {
+		return nil, err
+	}
+
+	return &readinessRule{JsonPath: jp, Expression: expression, Value: strings.TrimSpace(value[ind+2:])}, nil
+}
+
+// Match reports whether the object matches the rule and describes the current state of the matched field
+func (rule *readinessRule) Match(obj map[string]interface{}) (bool, string, error) {
+	if rule.JsonPath != nil {
+		results, err := rule.JsonPath.FindResults(obj)
+		if err != nil {
+			return false, "", err
+		}
+
+		var values []string
+		for _, result := range results {
+			for _, v := range result {
+				values = append(values, fmt.Sprintf("%v", v.Interface()))
+			}
+		}
+
+		for _, v := range values {
+			if v == rule.Value {
+				return true, fmt.Sprintf("%s=%s", rule.Expression, v), nil
+			}
+		}
+
+		return false, fmt.Sprintf("%s=%s", rule.Expression, strings.Join(values, ",")), nil
+	}
+
+	status, _ := obj["status"].(map[string]interface{})
+	conditions, _ := status["conditions"].([]interface{})
+	for _, c := range conditions {
+		condition, _ := c.(map[string]interface{})
+		if fmt.Sprintf("%v", condition["type"]) != rule.ConditionType {
+			continue
+		}
+
+		state := fmt.Sprintf("%s=%v", rule.ConditionType, condition["status"])
+		if message, _ := condition["message"].(string); message != "" {
+			state = fmt.Sprintf("%s (%s)", state, message)
+		} else if reason, _ := condition["reason"].(string); reason != "" {
+			state = fmt.Sprintf("%s (%s)", state, reason)
+		}
+
+		return fmt.Sprintf("%v", condition["status"]) == rule.Value, state, nil
+	}
+
+	return false, fmt.Sprintf("%s condition not found", rule.ConditionType), nil
+}
+
+// readinessSpec describes the resource of arbitrary kind, which is ready when all ready rules match and failed when any failed rule matches
+type readinessSpec struct {
+	ResourceName string
+	Ready        []*readinessRule
+	Failed       []*readinessRule
+	Timeout      time.Duration
+	FailMode     multitrack.FailMode
+	NonBlocking  bool
+
+	Get func() (map[string]interface{}, error)
+}
+
+func parseReadinessSpec(resourceName string, annotations map[string]string) (*readinessSpec, error) {
+	spec := &readinessSpec{ResourceName: resourceName}
+
+	for _, annoName := range []string{ReadyConditionAnnoName, ReadyJsonPathAnnoName, FailedConditionAnnoName, FailedJsonPathAnnoName} {
+		annoValue, hasKey := annotations[annoName]
+		if !hasKey {
+			continue
+		}
+
+		var rule *readinessRule
+		var err error
+		switch annoName {
+		case ReadyConditionAnnoName, FailedConditionAnnoName:
+			rule, err = parseConditionRule(annoValue)
+		default:
+			rule, err = parseJsonPathRule(annoValue)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation %s with invalid value %s: %s", resourceName, annoName, annoValue, err)
+		}
+
+		switch annoName {
+		case ReadyConditionAnnoName, ReadyJsonPathAnnoName:
+			spec.Ready = append(spec.Ready, rule)
+		default:
+			spec.Failed = append(spec.Failed, rule)
+		}
+	}
+
+	if len(spec.Ready) == 0 {
+		for _, annoName := range []string{FailedConditionAnnoName, FailedJsonPathAnnoName, ReadyTimeoutAnnoName} {
+			if _, hasKey := annotations[annoName]; hasKey {
+				return nil, fmt.Errorf("%s annotation %s cannot be used without %s or %s", resourceName, annoName, ReadyConditionAnnoName, ReadyJsonPathAnnoName)
+			}
+		}
+
+		return nil, nil
+	}
+
+	if annoValue, hasKey := annotations[ReadyTimeoutAnnoName]; hasKey {
+		timeout, err := time.ParseDuration(annoValue)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("%s annotation %s with invalid value %s: positive duration expected", resourceName, ReadyTimeoutAnnoName, annoValue)
+		}
+
+		spec.Timeout = timeout
+	}
+
+	spec.FailMode = multitrack.FailWholeDeployProcessImmediately
+	if annoValue, hasKey := annotations[FailModeAnnoName]; hasKey {
+		values := []multitrack.FailMode{multitrack.IgnoreAndContinueDeployProcess, multitrack.FailWholeDeployProcessImmediately}
+		spec.FailMode = ""
+		for _, value := range values {
+			if value == multitrack.FailMode(annoValue) {
+				spec.FailMode = value
+			}
+		}
+
+		if spec.FailMode == "" {
+			return nil, fmt.Errorf("%s annotation %s with invalid value %s: choose one of %v", resourceName, FailModeAnnoName, annoValue, values)
+		}
+	}
+
+	spec.NonBlocking = annotations[TrackTerminationModeAnnoName] == string(multitrack.NonBlocking)
+
+	return spec, nil
+}
+
+// makeReadinessSpec prepares readiness spec for the resource of the kind not supported by multitrack, nil is returned when no readiness rules are set
+func makeReadinessSpec(info *resource.Info) (*readinessSpec, error) {
+	accessor, err := meta.Accessor(info.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := parseReadinessSpec(fmt.Sprintf("%s/%s", strings.ToLower(info.Mapping.GroupVersionKind.Kind), info.Name), accessor.GetAnnotations())
+	if err != nil || spec == nil {
+		return nil, err
+	}
+
+	spec.Get = func() (map[string]interface{}, error) {
+		obj, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, info.Name, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if u, ok := obj.(runtime.Unstructured); ok {
+			return u.UnstructuredContent(), nil
+		}
+
+		return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	}
+
+	return spec, nil
+}
+
+// trackReadiness polls resources until all of them are ready, the failure of the resource stops tracking unless fail mode is IgnoreAndContinueDeployProcess
+func trackReadiness(specs []*readinessSpec, timeout, statusProgressPeriod time.Duration) error {
+	start := time.Now()
+	lastStatusProgress := start
+
+	active := map[*readinessSpec]string{}
+	for _, spec := range specs {
+		if spec.NonBlocking {
+			logboek.Default.LogFDetails("%s: non blocking tracking, skipped\n", spec.ResourceName)
+			continue
+		}
+
+		active[spec] = ""
+	}
+
+	for len(active) != 0 {
+		for _, spec := range specs {
+			if _, isActive := active[spec]; !isActive {
+				continue
+			}
+
+			ready, failedReason, state, err := checkReadinessSpec(spec)
+			if err != nil {
+				return err
+			}
+			active[spec] = state
+
+			if failedReason == "" {
+				specTimeout := spec.Timeout
+				if specTimeout == 0 {
+					specTimeout = timeout
+				}
+
+				if !ready && specTimeout != 0 && time.Since(start) >= specTimeout {
+					failedReason = fmt.Sprintf("not ready after %s: %s", specTimeout, state)
+				}
+			}
+
+			if failedReason != "" {
+				if spec.FailMode != multitrack.IgnoreAndContinueDeployProcess {
+					return fmt.Errorf("%s failed: %s", spec.ResourceName, failedReason)
+				}
+
+				logboek.LogWarnF("WARNING: %s failed: %s\n", spec.ResourceName, failedReason)
+				delete(active, spec)
+			} else if ready {
+				logboek.Default.LogFDetails("%s ready: %s\n", spec.ResourceName, state)
+				delete(active, spec)
+			}
+		}
+
+		if len(active) == 0 {
+			break
+		}
+
+		if statusProgressPeriod > 0 && time.Since(lastStatusProgress) >= statusProgressPeriod {
+			lastStatusProgress = time.Now()
+			for _, spec := range specs {
+				if state, isActive := active[spec]; isActive {
+					logboek.Default.LogFDetails("%s: %s\n", spec.ResourceName, state)
+				}
+			}
+		}
+
+		time.Sleep(readinessPollPeriod)
+	}
+
+	return nil
+}
+
+func checkReadinessSpec(spec *readinessSpec) (bool, string, string, error) {
+	obj, err := spec.Get()
+	if err != nil {
+		return false, "", "", fmt.Errorf("unable to get %s: %s", spec.ResourceName, err)
+	}
+
+	for _, rule := range spec.Failed {
+		matched, state, err := rule.Match(obj)
+		if err != nil {
+			return false, "", "", fmt.Errorf("%s: %s", spec.ResourceName, err)
+		}
+
+		if matched {
+			return false, state, state, nil
+		}
+	}
+
+	var states []string
+	ready := true
+	for _, rule := range spec.Ready {
+		matched, state, err := rule.Match(obj)
+		if err != nil {
+			return false, "", "", fmt.Errorf("%s: %s", spec.ResourceName, err)
+		}
+
+		ready = ready && matched
+		states = append(states, state)
+	}
+
+	return ready, "", strings.Join(states, ", "), nil
+}
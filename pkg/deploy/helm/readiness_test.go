@@ -0,0 +1,170 @@
+package helm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestParseReadinessSpec(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+	}{
+		{
+			name:        "no rules",
+			annotations: map[string]string{"werf.io/fail-mode": "IgnoreAndContinueDeployProcess"},
+			expected:    "<nil>",
+		},
+		{
+			name: "condition and jsonpath rules",
+			annotations: map[string]string{
+				"werf.io/ready-condition":        "Ready=True",
+				"werf.io/failed-jsonpath":        `{.status.conditions[?(@.type=="Issuing")].reason}=Failed`,
+				"werf.io/ready-timeout":          "5m",
+				"werf.io/fail-mode":              "IgnoreAndContinueDeployProcess",
+				"werf.io/track-termination-mode": "NonBlocking",
+			},
+			expected: `ready: [Ready=True] failed: [{.status.conditions[?(@.type=="Issuing")].reason}=Failed] timeout: 5m0s fail-mode: IgnoreAndContinueDeployProcess non-blocking: true`,
+		},
+		{
+			name:        "invalid condition",
+			annotations: map[string]string{"werf.io/ready-condition": "Ready"},
+			expected:    "certificate/app annotation werf.io/ready-condition with invalid value Ready: Type=Status expected",
+		},
+		{
+			name:        "invalid jsonpath",
+			annotations: map[string]string{"werf.io/ready-jsonpath": ".status.phase=Running"},
+			expected:    "certificate/app annotation werf.io/ready-jsonpath with invalid value .status.phase=Running: {.jsonpath}=value expected",
+		},
+		{
+			name:        "failed rule without ready rule",
+			annotations: map[string]string{"werf.io/failed-condition": "Failed=True"},
+			expected:    "certificate/app annotation werf.io/failed-condition cannot be used without werf.io/ready-condition or werf.io/ready-jsonpath",
+		},
+		{
+			name:        "invalid timeout",
+			annotations: map[string]string{"werf.io/ready-condition": "Ready=True", "werf.io/ready-timeout": "5"},
+			expected:    "certificate/app annotation werf.io/ready-timeout with invalid value 5: positive duration expected",
+		},
+	}
+
+	for _, test := range tests {
+		spec, err := parseReadinessSpec("certificate/app", test.annotations)
+
+		var got string
+		switch {
+		case err != nil:
+			got = err.Error()
+		case spec == nil:
+			got = "<nil>"
+		default:
+			describeRules := func(rules []*readinessRule) []string {
+				var res []string
+				for _, rule := range rules {
+					if rule.JsonPath != nil {
+						res = append(res, fmt.Sprintf("%s=%s", rule.Expression, rule.Value))
+					} else {
+						res = append(res, fmt.Sprintf("%s=%s", rule.ConditionType, rule.Value))
+					}
+				}
+				return res
+			}
+
+			got = fmt.Sprintf("ready: %v failed: %v timeout: %s fail-mode: %s non-blocking: %v", describeRules(spec.Ready), describeRules(spec.Failed), spec.Timeout, spec.FailMode, spec.NonBlocking)
+		}
+
+		if got != test.expected {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestTrackReadiness(t *testing.T) {
+	readinessPollPeriod = time.Millisecond
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		states      []string
+		expectedErr string
+	}{
+		{
+			name:        "ready condition",
+			annotations: map[string]string{"werf.io/ready-condition": "Ready=True"},
+			states: []string{
+				`{}`,
+				`{"status": {"conditions": [{"type": "Ready", "status": "False", "reason": "Issuing"}]}}`,
+				`{"status": {"conditions": [{"type": "Ready", "status": "True"}]}}`,
+			},
+		},
+		{
+			name:        "ready jsonpath",
+			annotations: map[string]string{"werf.io/ready-jsonpath": "{.status.phase}=Running", "werf.io/failed-jsonpath": "{.status.phase}=Failed"},
+			states: []string{
+				`{"status": {"phase": "Pending"}}`,
+				`{"status": {"phase": "Running"}}`,
+			},
+		},
+		{
+			name:        "failed condition",
+			annotations: map[string]string{"werf.io/ready-condition": "Ready=True", "werf.io/failed-condition": "Failed=True"},
+			states: []string{
+				`{"status": {"conditions": [{"type": "Ready", "status": "False"}]}}`,
+				`{"status": {"conditions": [{"type": "Ready", "status": "False"}, {"type": "Failed", "status": "True", "message": "quota exceeded"}]}}`,
+			},
+			expectedErr: "certificate/app failed: Failed=True (quota exceeded)",
+		},
+		{
+			name:        "ignored failure",
+			annotations: map[string]string{"werf.io/ready-condition": "Ready=True", "werf.io/failed-condition": "Failed=True", "werf.io/fail-mode": "IgnoreAndContinueDeployProcess"},
+			states: []string{
+				`{"status": {"conditions": [{"type": "Failed", "status": "True"}]}}`,
+			},
+		},
+		{
+			name:        "timeout",
+			annotations: map[string]string{"werf.io/ready-jsonpath": "{.status.phase}=Running", "werf.io/ready-timeout": "10ms"},
+			states: []string{
+				`{"status": {"phase": "Pending"}}`,
+			},
+			expectedErr: "certificate/app failed: not ready after 10ms: {.status.phase}=Pending",
+		},
+	}
+
+	for _, test := range tests {
+		spec, err := parseReadinessSpec("certificate/app", test.annotations)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		states := test.states
+		spec.Get = func() (map[string]interface{}, error) {
+			var obj map[string]interface{}
+			if err := yaml.Unmarshal([]byte(states[0]), &obj); err != nil {
+				return nil, err
+			}
+
+			// The last state is returned when all states are used
+			if len(states) > 1 {
+				states = states[1:]
+			}
+
+			return obj, nil
+		}
+
+		err = trackReadiness([]*readinessSpec{spec}, time.Minute, 0)
+
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != test.expectedErr {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expectedErr, got)
+		}
+	}
+}
@@ -15,7 +15,6 @@ import (
 
 	"github.com/flant/kubedog/pkg/kube"
 	"github.com/flant/logboek"
-	"github.com/flant/shluz"
 	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
 )
@@ -36,6 +35,24 @@ const (
 
 	ShowEventsAnnoName = "werf.io/show-service-messages"
 
+	RolloutStrategyAnnoName         = "werf.io/rollout-strategy"
+	RolloutStableDeploymentAnnoName = "werf.io/rollout-stable-deployment"
+	RolloutStepsAnnoName            = "werf.io/rollout-steps"
+	RolloutStepPauseAnnoName        = "werf.io/rollout-step-pause"
+
+	AnalysisQueryAnnoName     = "werf.io/analysis-query"
+	AnalysisThresholdAnnoName = "werf.io/analysis-threshold"
+	AnalysisDurationAnnoName  = "werf.io/analysis-duration"
+	AnalysisIntervalAnnoName  = "werf.io/analysis-interval"
+
+	WeightAnnoName = "werf.io/weight"
+
+	ReadyConditionAnnoName  = "werf.io/ready-condition"
+	ReadyJsonPathAnnoName   = "werf.io/ready-jsonpath"
+	FailedConditionAnnoName = "werf.io/failed-condition"
+	FailedJsonPathAnnoName  = "werf.io/failed-jsonpath"
+	ReadyTimeoutAnnoName    = "werf.io/ready-timeout"
+
 	HelmHookAnnoName = "helm.sh/hook"
 )
 
@@ -50,6 +67,14 @@ var (
 		ShowLogsOnlyForContainers,
 		ShowLogsUntilAnnoName,
 		ShowEventsAnnoName,
+		RolloutStrategyAnnoName,
+		RolloutStableDeploymentAnnoName,
+		RolloutStepsAnnoName,
+		RolloutStepPauseAnnoName,
+		AnalysisQueryAnnoName,
+		AnalysisThresholdAnnoName,
+		AnalysisDurationAnnoName,
+		AnalysisIntervalAnnoName,
 		helm_kube.SetReplicasOnlyOnCreationAnnotation,
 		helm_kube.SetResourcesOnlyOnCreationAnnotation,
 	}
@@ -168,12 +193,10 @@ type ChartOptions struct {
 	Debug             bool
 	ThreeWayMergeMode ThreeWayMergeModeType
 
-	ChartValuesOptions
-}
+	// PrometheusUrl is the endpoint analysis queries are evaluated against
+	PrometheusUrl string
 
-func withLockedHelmRelease(releaseName string, f func() error) error {
-	lockName := fmt.Sprintf("helm_release.%s-kube_context.%s", releaseName, helmSettings.KubeContext)
-	return shluz.WithLock(lockName, shluz.LockOptions{}, f)
+	ChartValuesOptions
 }
 
 func DeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptions) error {
@@ -342,48 +365,7 @@ func doDeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptio
 					isRollbackAttempt = true
 				}
 
-				var templatesFromRevision ChartTemplates
-				logProcessMsg := fmt.Sprintf("Getting templates from release revision %d", latestSuccessfullyDeployedRevision)
-				if err := logboek.Info.LogProcessInline(logProcessMsg, logboek.LevelLogProcessInlineOptions{}, func() error {
-					templatesFromRevision, latestSuccessfullyDeployedReleaseRevisionErr = GetTemplatesFromReleaseRevision(releaseName, latestSuccessfullyDeployedRevision)
-					return latestSuccessfullyDeployedReleaseRevisionErr
-				}); err != nil {
-					return fmt.Errorf("get templates from release revision failed: %s", err)
-				}
-
-				rollbackFunc := func() error {
-					releaseRollbackOpts := ReleaseRollbackOptions{
-						releaseRollbackOptions: releaseRollbackOptions{
-							Timeout:       int64(opts.Timeout / time.Second),
-							CleanupOnFail: true,
-							DryRun:        opts.DryRun,
-						},
-					}
-
-					var err error
-					for i := 0; i < 5; i++ {
-						logboek.LogF("Running helm rollback (%d try)...\n", i+1)
-
-						err = ReleaseRollback(
-							releaseName,
-							latestSuccessfullyDeployedRevision,
-							opts.ThreeWayMergeMode,
-							releaseRollbackOpts,
-						)
-
-						if err == nil {
-							return nil
-						}
-					}
-
-					if err != nil {
-						return fmt.Errorf("release rollback to revision %d failed: %s", latestSuccessfullyDeployedRevision, err)
-					}
-
-					panic("unexpected")
-				}
-
-				return runDeployProcess(releaseName, namespace, opts, templatesFromRevision, rollbackFunc)
+				return rollbackReleaseToRevision(releaseName, namespace, opts, latestSuccessfullyDeployedRevision)
 			}); err != nil {
 				return err
 			}
@@ -486,9 +468,124 @@ func doDeployHelmChart(chartPath, releaseName, namespace string, opts ChartOptio
 		return err
 	}
 
+	rolloutSpecs, err := getRolloutSpecs(templatesFromChart, namespace)
+	if err != nil {
+		return err
+	}
+
+	analysisSpecs, err := getAnalysisSpecs(templatesFromChart)
+	if err != nil {
+		return err
+	}
+
+	if (len(rolloutSpecs) > 0 || len(analysisSpecs) > 0) && !opts.DryRun {
+		deployFunc = withPostDeployChecks(releaseName, namespace, opts, deployFunc, func(deadline time.Time) error {
+			if err := runRollouts(rolloutSpecs, deadline); err != nil {
+				return fmt.Errorf("rollout failed: %s", err)
+			}
+
+			if len(analysisSpecs) > 0 {
+				if err := logboek.LogProcess("Running release analysis", logboek.LogProcessOptions{}, func() error {
+					return runAnalysis(opts.PrometheusUrl, analysisSpecs, deadline)
+				}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		deployFunc = withPausedRolloutStableDeployments(rolloutSpecs, deployFunc)
+	}
+
 	return runDeployProcess(releaseName, namespace, opts, templatesFromChart, deployFunc)
 }
 
+// withPostDeployChecks runs rollouts and analysis after the release is deployed within the deploy timeout,
+// the release is rolled back to the latest successfully deployed revision if checks fail
+func withPostDeployChecks(releaseName, namespace string, opts ChartOptions, deployFunc func() error, checksFunc func(deadline time.Time) error) func() error {
+	return func() error {
+		var deadline time.Time
+		if opts.Timeout > 0 {
+			deadline = time.Now().Add(opts.Timeout)
+		}
+
+		latestSuccessfullyDeployedRevision, err := latestSuccessfullyDeployedReleaseRevision(releaseName)
+		if err != nil && err != ErrNoSuccessfullyDeployedReleaseRevisionFound && !isReleaseNotFoundError(err) {
+			return fmt.Errorf("get latest successfully deployed release revision failed: %s", err)
+		}
+
+		if err := deployFunc(); err != nil {
+			return err
+		}
+
+		checksErr := checksFunc(deadline)
+		if checksErr == nil {
+			return nil
+		}
+
+		if latestSuccessfullyDeployedRevision == 0 {
+			return checksErr
+		}
+
+		logProcessMsg := fmt.Sprintf("Rolling back release to revision %d", latestSuccessfullyDeployedRevision)
+		if err := logboek.LogProcess(logProcessMsg, logboek.LogProcessOptions{}, func() error {
+			return rollbackReleaseToRevision(releaseName, namespace, opts, latestSuccessfullyDeployedRevision)
+		}); err != nil {
+			return fmt.Errorf("%s\n%s", checksErr, err)
+		}
+
+		return fmt.Errorf("%s\nrelease was rolled back to revision %d", checksErr, latestSuccessfullyDeployedRevision)
+	}
+}
+
+// rollbackReleaseToRevision rolls the release back and waits for the resources of the revision
+func rollbackReleaseToRevision(releaseName, namespace string, opts ChartOptions, revision int32) error {
+	var templatesFromRevision ChartTemplates
+	logProcessMsg := fmt.Sprintf("Getting templates from release revision %d", revision)
+	if err := logboek.Info.LogProcessInline(logProcessMsg, logboek.LevelLogProcessInlineOptions{}, func() error {
+		var err error
+		templatesFromRevision, err = GetTemplatesFromReleaseRevision(releaseName, revision)
+		return err
+	}); err != nil {
+		return fmt.Errorf("get templates from release revision failed: %s", err)
+	}
+
+	rollbackFunc := func() error {
+		releaseRollbackOpts := ReleaseRollbackOptions{
+			releaseRollbackOptions: releaseRollbackOptions{
+				Timeout:       int64(opts.Timeout / time.Second),
+				CleanupOnFail: true,
+				DryRun:        opts.DryRun,
+			},
+		}
+
+		var err error
+		for i := 0; i < 5; i++ {
+			logboek.LogF("Running helm rollback (%d try)...\n", i+1)
+
+			err = ReleaseRollback(
+				releaseName,
+				revision,
+				opts.ThreeWayMergeMode,
+				releaseRollbackOpts,
+			)
+
+			if err == nil {
+				return nil
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("release rollback to revision %d failed: %s", revision, err)
+		}
+
+		panic("unexpected")
+	}
+
+	return runDeployProcess(releaseName, namespace, opts, templatesFromRevision, rollbackFunc)
+}
+
 func latestSuccessfullyDeployedReleaseRevision(releaseName string) (int32, error) {
 	resp, err := releaseHistory(releaseName, releaseHistoryOptions{})
 	if err != nil {
@@ -0,0 +1,150 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/storage"
+	"github.com/flant/werf/pkg/werf"
+)
+
+const (
+	ReleaseLockOwnerAnnoName       = "werf.io/release-lock-owner"
+	ReleaseLockPipelineUrlAnnoName = "werf.io/release-lock-pipeline-url"
+)
+
+// releaseLock is set when helm is initialized with kube
+var releaseLock *releaseLockOptions
+
+type releaseLockOptions struct {
+	KubeClient kubernetes.Interface
+	Namespace  string
+	// Enabled means that the cluster-side release lock is taken during deploy and dismiss
+	Enabled bool
+	Timeout time.Duration
+}
+
+func initReleaseLock(kubeClient kubernetes.Interface, namespace string, enabled bool, timeout time.Duration) {
+	releaseLock = &releaseLockOptions{KubeClient: kubeClient, Namespace: namespace, Enabled: enabled, Timeout: timeout}
+}
+
+// newReleaseLockManager creates the lock manager with the unique holder identity for each lock,
+// so that the release lock cannot be acquired again by the holder
+func newReleaseLockManager() *storage.KubernetesLockManager {
+	lockManager := storage.NewKubernetesLockManager(releaseLock.KubeClient, releaseLock.Namespace)
+	lockManager.Timeout = releaseLock.Timeout
+	lockManager.Annotations = releaseLockAnnotations()
+
+	return lockManager
+}
+
+func withLockedHelmRelease(releaseName string, f func() error) error {
+	lockName := fmt.Sprintf("helm_release.%s-kube_context.%s", releaseName, helmSettings.KubeContext)
+	return werf.WithHostLock(lockName, shluz.LockOptions{}, func() error {
+		if releaseLock == nil || !releaseLock.Enabled {
+			return f()
+		}
+
+		// The local lock serializes werf processes on the same host, the cluster lock serializes different hosts
+		lockManager := newReleaseLockManager()
+		releaseLockName := releaseClusterLockName(releaseName)
+		if err := lockManager.Lock(releaseLockName); err != nil {
+			return fmt.Errorf("unable to lock release %s: %s", releaseName, err)
+		}
+		defer func() {
+			if err := lockManager.Unlock(releaseLockName); err != nil {
+				logboek.LogWarnF("WARNING: unable to unlock release %s: %s\n", releaseName, err)
+			}
+		}()
+
+		return f()
+	})
+}
+
+// UnlockRelease removes the cluster-side lock of the release held by any werf process, it is used to remove stale locks
+func UnlockRelease(releaseName string) error {
+	if releaseLock == nil {
+		return fmt.Errorf("release lock is not initialized")
+	}
+
+	lease, err := newReleaseLockManager().ForceUnlock(releaseClusterLockName(releaseName))
+	if err != nil {
+		return fmt.Errorf("unable to unlock release %s: %s", releaseName, err)
+	}
+
+	if lease == nil {
+		logboek.Default.LogF("Release %s is not locked\n", releaseName)
+		return nil
+	}
+
+	logboek.Default.LogF("Release %s has been unlocked\n", releaseName)
+	if lease.Spec.HolderIdentity != nil {
+		logboek.Default.LogFDetails("holder: %s\n", *lease.Spec.HolderIdentity)
+	}
+	for _, annoName := range []string{ReleaseLockOwnerAnnoName, ReleaseLockPipelineUrlAnnoName} {
+		if value := lease.Annotations[annoName]; value != "" {
+			logboek.Default.LogFDetails("%s: %s\n", strings.TrimPrefix(annoName, "werf.io/release-lock-"), value)
+		}
+	}
+	if lease.Spec.AcquireTime != nil {
+		logboek.Default.LogFDetails("acquired: %s\n", lease.Spec.AcquireTime.String())
+	}
+
+	return nil
+}
+
+func releaseClusterLockName(releaseName string) string {
+	return fmt.Sprintf("helm_release.%s", releaseName)
+}
+
+// releaseLockAnnotations describe the holder of the release lock, both annotations are always set to replace values of the previous holder
+func releaseLockAnnotations() map[string]string {
+	return map[string]string{
+		ReleaseLockOwnerAnnoName:       releaseLockOwner(),
+		ReleaseLockPipelineUrlAnnoName: releaseLockPipelineUrl(),
+	}
+}
+
+func releaseLockOwner() string {
+	for _, envName := range []string{"GITLAB_USER_LOGIN", "GITHUB_ACTOR"} {
+		if value := os.Getenv(envName); value != "" {
+			return value
+		}
+	}
+
+	var owner string
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		owner = fmt.Sprintf("%s@%s", owner, hostname)
+	}
+
+	return owner
+}
+
+func releaseLockPipelineUrl() string {
+	if value := os.Getenv("CI_PIPELINE_URL"); value != "" {
+		return value
+	}
+
+	if repository, runID := os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"); repository != "" && runID != "" {
+		serverUrl := os.Getenv("GITHUB_SERVER_URL")
+		if serverUrl == "" {
+			serverUrl = "https://github.com"
+		}
+
+		return fmt.Sprintf("%s/%s/actions/runs/%s", serverUrl, repository, runID)
+	}
+
+	return ""
+}
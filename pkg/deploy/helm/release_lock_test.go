@@ -0,0 +1,75 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flant/shluz"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/flant/werf/pkg/werf"
+)
+
+func TestWithLockedHelmRelease(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "werf-release-lock-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := werf.Init(filepath.Join(tmpDir, "tmp"), filepath.Join(tmpDir, "home")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shluz.Init(filepath.Join(tmpDir, "locks")); err != nil {
+		t.Fatal(err)
+	}
+
+	oldReleaseLock := releaseLock
+	defer func() { releaseLock = oldReleaseLock }()
+
+	for _, enabled := range []bool{false, true} {
+		client := fake.NewSimpleClientset()
+		initReleaseLock(client, "kube-system", enabled, 0)
+
+		var leasesDuringDeploy int
+		var owner string
+		if err := withLockedHelmRelease("app", func() error {
+			leases, err := client.CoordinationV1().Leases("kube-system").List(metav1.ListOptions{})
+			if err != nil {
+				return err
+			}
+
+			leasesDuringDeploy = len(leases.Items)
+			if len(leases.Items) != 0 {
+				owner = leases.Items[0].Annotations[ReleaseLockOwnerAnnoName]
+			}
+
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		expectedLeases := 0
+		if enabled {
+			expectedLeases = 1
+		}
+
+		if leasesDuringDeploy != expectedLeases {
+			t.Errorf("enabled %v: leases during deploy:\n[EXPECTED]: %d\n[GOT]: %d", enabled, expectedLeases, leasesDuringDeploy)
+		}
+
+		if enabled && owner != releaseLockOwner() {
+			t.Errorf("lock owner:\n[EXPECTED]: %s\n[GOT]: %s", releaseLockOwner(), owner)
+		}
+
+		if leases, err := client.CoordinationV1().Leases("kube-system").List(metav1.ListOptions{}); err != nil {
+			t.Fatal(err)
+		} else if len(leases.Items) != 0 {
+			t.Errorf("enabled %v: lease should be deleted after deploy, got %d leases", enabled, len(leases.Items))
+		}
+	}
+}
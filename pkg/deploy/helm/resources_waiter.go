@@ -16,7 +16,6 @@ import (
 	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	appsv1beta2 "k8s.io/api/apps/v1beta2"
 	batchv1 "k8s.io/api/batch/v1"
-	v1 "k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -42,10 +41,15 @@ func extractSpecReplicas(specReplicas *int32) int {
 
 func (waiter *ResourcesWaiter) WaitForResources(timeout time.Duration, created helmKube.Result) error {
 	specs := multitrack.MultitrackSpecs{}
+	var readinessSpecs []*readinessSpec
 
 	for _, v := range created {
 		switch value := asVersioned(v).(type) {
 		case *appsv1.Deployment:
+			if isPausedRolloutStableDeployment(v.Namespace, v.Name) {
+				continue
+			}
+
 			spec, err := makeMultitrackSpec(&value.ObjectMeta, allowedFailuresCountOptions{multiplier: extractSpecReplicas(value.Spec.Replicas), defaultPerReplica: 1}, "deploy")
 			if err != nil {
 				return fmt.Errorf("cannot track %s %s: %s", value.Kind, value.Name, err)
@@ -54,6 +58,10 @@ func (waiter *ResourcesWaiter) WaitForResources(timeout time.Duration, created h
 				specs.Deployments = append(specs.Deployments, *spec)
 			}
 		case *appsv1beta1.Deployment:
+			if isPausedRolloutStableDeployment(v.Namespace, v.Name) {
+				continue
+			}
+
 			spec, err := makeMultitrackSpec(&value.ObjectMeta, allowedFailuresCountOptions{multiplier: extractSpecReplicas(value.Spec.Replicas), defaultPerReplica: 1}, "deploy")
 			if err != nil {
 				return fmt.Errorf("cannot track %s %s: %s", value.Kind, value.Name, err)
@@ -62,6 +70,10 @@ func (waiter *ResourcesWaiter) WaitForResources(timeout time.Duration, created h
 				specs.Deployments = append(specs.Deployments, *spec)
 			}
 		case *appsv1beta2.Deployment:
+			if isPausedRolloutStableDeployment(v.Namespace, v.Name) {
+				continue
+			}
+
 			spec, err := makeMultitrackSpec(&value.ObjectMeta, allowedFailuresCountOptions{multiplier: extractSpecReplicas(value.Spec.Replicas), defaultPerReplica: 1}, "deploy")
 			if err != nil {
 				return fmt.Errorf("cannot track %s %s: %s", value.Kind, value.Name, err)
@@ -70,6 +82,10 @@ func (waiter *ResourcesWaiter) WaitForResources(timeout time.Duration, created h
 				specs.Deployments = append(specs.Deployments, *spec)
 			}
 		case *extensions.Deployment:
+			if isPausedRolloutStableDeployment(v.Namespace, v.Name) {
+				continue
+			}
+
 			spec, err := makeMultitrackSpec(&value.ObjectMeta, allowedFailuresCountOptions{multiplier: extractSpecReplicas(value.Spec.Replicas), defaultPerReplica: 1}, "deploy")
 			if err != nil {
 				return fmt.Errorf("cannot track %s %s: %s", value.Kind, value.Name, err)
@@ -139,24 +155,42 @@ func (waiter *ResourcesWaiter) WaitForResources(timeout time.Duration, created h
 			if spec != nil {
 				specs.Jobs = append(specs.Jobs, *spec)
 			}
-		case *v1.ReplicationController:
-		case *extensions.ReplicaSet:
-		case *appsv1beta2.ReplicaSet:
-		case *appsv1.ReplicaSet:
-		case *v1.PersistentVolumeClaim:
-		case *v1.Service:
+		default:
+			spec, err := makeReadinessSpec(v)
+			if err != nil {
+				return fmt.Errorf("cannot track %s %s: %s", v.Mapping.GroupVersionKind.Kind, v.Name, err)
+			}
+			if spec != nil {
+				readinessSpecs = append(readinessSpecs, spec)
+			}
 		}
 	}
 
 	logboek.LogOptionalLn()
 	return logboek.LogProcess("Waiting for release resources to become ready", logboek.LogProcessOptions{}, func() error {
-		return multitrack.Multitrack(kube.Kubernetes, specs, multitrack.MultitrackOptions{
+		start := time.Now()
+
+		if err := multitrack.Multitrack(kube.Kubernetes, specs, multitrack.MultitrackOptions{
 			StatusProgressPeriod: waiter.StatusProgressPeriod,
 			Options: tracker.Options{
 				Timeout:      timeout,
 				LogsFromTime: waiter.LogsFromTime,
 			},
-		})
+		}); err != nil {
+			return err
+		}
+
+		if len(readinessSpecs) == 0 {
+			return nil
+		}
+
+		// Resources of other kinds share the timeout with resources tracked by multitrack
+		readinessTimeout := timeout
+		if timeout != 0 {
+			readinessTimeout = timeout - time.Since(start)
+		}
+
+		return trackReadiness(readinessSpecs, readinessTimeout, waiter.StatusProgressPeriod)
 	})
 }
 
@@ -339,7 +373,19 @@ func (waiter *ResourcesWaiter) WatchUntilReady(namespace string, reader io.Reade
 			})
 
 		default:
-			logboek.Default.LogFDetails("Will not track helm hook %s/%s: %s kind not supported for tracking\n", strings.ToLower(kind), name, kind)
+			spec, err := makeReadinessSpec(info)
+			if err != nil {
+				return fmt.Errorf("cannot track %s %s: %s", kind, name, err)
+			}
+
+			if spec == nil {
+				logboek.Default.LogFDetails("Will not track helm hook %s/%s: %s kind not supported for tracking\n", strings.ToLower(kind), name, kind)
+				continue
+			}
+
+			return logboek.LogProcess(fmt.Sprintf("Waiting for helm hook %s readiness", spec.ResourceName), logboek.LogProcessOptions{}, func() error {
+				return trackReadiness([]*readinessSpec{spec}, timeout, waiter.HooksStatusProgressPeriod)
+			})
 		}
 	}
 
@@ -0,0 +1,407 @@
+package helm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/kubedog/pkg/kube"
+	"github.com/flant/kubedog/pkg/tracker"
+	"github.com/flant/kubedog/pkg/trackers/rollout/multitrack"
+	"github.com/flant/logboek"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	helm_kube "k8s.io/helm/pkg/kube"
+)
+
+type RolloutStrategy string
+
+const (
+	CanaryRolloutStrategy    RolloutStrategy = "canary"
+	BlueGreenRolloutStrategy RolloutStrategy = "blue-green"
+)
+
+var defaultCanaryRolloutSteps = []int{25, 50, 100}
+
+type rolloutStep struct {
+	// Weight is the percent of replicas moved to the new deployment
+	Weight int
+	// Pause is the time to wait before the next step
+	Pause time.Duration
+}
+
+// rolloutSpec describes the staged shift of replicas from the stable deployment to the new one
+type rolloutSpec struct {
+	Strategy         RolloutStrategy
+	Namespace        string
+	Deployment       string
+	StableDeployment string
+	Annotations      map[string]string
+	Steps            []rolloutStep
+}
+
+func getRolloutSpecs(templates ChartTemplates, namespace string) ([]*rolloutSpec, error) {
+	deployments := map[string]bool{}
+	for _, t := range templates.Deployments() {
+		deployments[t.Namespace(namespace)+"/"+t.Metadata.Name] = true
+	}
+
+	var specs []*rolloutSpec
+	for _, t := range templates.Deployments() {
+		spec, err := parseRolloutSpec(t, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		if spec == nil {
+			continue
+		}
+
+		if !deployments[spec.Namespace+"/"+spec.StableDeployment] {
+			return nil, fmt.Errorf("deploy/%s annotation %s: stable deploy/%s not found in the chart", spec.Deployment, RolloutStableDeploymentAnnoName, spec.StableDeployment)
+		}
+
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+func parseRolloutSpec(t Template, namespace string) (*rolloutSpec, error) {
+	annotations := t.Metadata.Annotations
+
+	strategyValue, hasStrategy := annotations[RolloutStrategyAnnoName]
+	if !hasStrategy {
+		for _, annoName := range []string{RolloutStableDeploymentAnnoName, RolloutStepsAnnoName, RolloutStepPauseAnnoName} {
+			if _, hasKey := annotations[annoName]; hasKey {
+				return nil, fmt.Errorf("deploy/%s annotation %s cannot be used without %s", t.Metadata.Name, annoName, RolloutStrategyAnnoName)
+			}
+		}
+
+		return nil, nil
+	}
+
+	spec := &rolloutSpec{
+		Namespace:        t.Namespace(namespace),
+		Deployment:       t.Metadata.Name,
+		StableDeployment: annotations[RolloutStableDeploymentAnnoName],
+		Annotations:      annotations,
+	}
+
+	switch strategy := RolloutStrategy(strategyValue); strategy {
+	case CanaryRolloutStrategy, BlueGreenRolloutStrategy:
+		spec.Strategy = strategy
+	default:
+		return nil, fmt.Errorf("deploy/%s annotation %s with invalid value %s: choose one of %v", t.Metadata.Name, RolloutStrategyAnnoName, strategyValue, []RolloutStrategy{CanaryRolloutStrategy, BlueGreenRolloutStrategy})
+	}
+
+	if spec.StableDeployment == "" {
+		return nil, fmt.Errorf("deploy/%s annotation %s is required for %s rollout", t.Metadata.Name, RolloutStableDeploymentAnnoName, spec.Strategy)
+	} else if spec.StableDeployment == spec.Deployment {
+		return nil, fmt.Errorf("deploy/%s annotation %s: stable deployment cannot be the deployment itself", t.Metadata.Name, RolloutStableDeploymentAnnoName)
+	}
+
+	// The new deployment replicas are managed by the rollout, the release upgrade should not reset them
+	if annotations[helm_kube.SetReplicasOnlyOnCreationAnnotation] != "true" {
+		return nil, fmt.Errorf("deploy/%s annotation %s=true is required for rollout", t.Metadata.Name, helm_kube.SetReplicasOnlyOnCreationAnnotation)
+	}
+
+	var defaultPause time.Duration
+	if value, hasKey := annotations[RolloutStepPauseAnnoName]; hasKey {
+		pause, err := time.ParseDuration(value)
+		if err != nil || pause < 0 {
+			return nil, fmt.Errorf("deploy/%s annotation %s with invalid value %s: positive duration expected", t.Metadata.Name, RolloutStepPauseAnnoName, value)
+		}
+		defaultPause = pause
+	}
+
+	switch spec.Strategy {
+	case CanaryRolloutStrategy:
+		if value, hasKey := annotations[RolloutStepsAnnoName]; hasKey {
+			steps, err := parseRolloutSteps(value, defaultPause)
+			if err != nil {
+				return nil, fmt.Errorf("deploy/%s annotation %s with invalid value %s: %s", t.Metadata.Name, RolloutStepsAnnoName, value, err)
+			}
+			spec.Steps = steps
+		} else {
+			for _, weight := range defaultCanaryRolloutSteps {
+				spec.Steps = append(spec.Steps, rolloutStep{Weight: weight, Pause: defaultPause})
+			}
+		}
+	case BlueGreenRolloutStrategy:
+		if _, hasKey := annotations[RolloutStepsAnnoName]; hasKey {
+			return nil, fmt.Errorf("deploy/%s annotation %s cannot be used for %s rollout", t.Metadata.Name, RolloutStepsAnnoName, spec.Strategy)
+		}
+
+		// The new deployment is scaled up completely, the stable one is promoted after the pause
+		spec.Steps = []rolloutStep{{Weight: 100, Pause: defaultPause}}
+	}
+
+	return spec, nil
+}
+
+// parseRolloutSteps parses comma separated steps WEIGHT[:PAUSE], e.g. 10:5m,50:10m,100
+func parseRolloutSteps(value string, defaultPause time.Duration) ([]rolloutStep, error) {
+	var steps []rolloutStep
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		step := rolloutStep{Pause: defaultPause}
+
+		weightValue := part
+		if ind := strings.Index(part, ":"); ind != -1 {
+			weightValue = part[:ind]
+
+			pause, err := time.ParseDuration(part[ind+1:])
+			if err != nil || pause < 0 {
+				return nil, fmt.Errorf("bad pause of step %q: positive duration expected", part)
+			}
+			step.Pause = pause
+		}
+
+		weight, err := strconv.Atoi(weightValue)
+		if err != nil || weight <= 0 || weight > 100 {
+			return nil, fmt.Errorf("bad weight of step %q: integer percent from 1 to 100 expected", part)
+		}
+
+		if len(steps) > 0 && weight <= steps[len(steps)-1].Weight {
+			return nil, fmt.Errorf("bad weight of step %q: weights should increase", part)
+		}
+
+		step.Weight = weight
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// pausedRolloutStableDeployments are the stable deployments paused by werf during the deploy process:
+// the release upgrade changes the pod template of the paused stable deployment without rolling it out,
+// the new version is rolled out by the promotion step of the rollout
+var pausedRolloutStableDeployments = map[string]bool{}
+
+func isPausedRolloutStableDeployment(namespace, name string) bool {
+	return pausedRolloutStableDeployments[namespace+"/"+name]
+}
+
+// withPausedRolloutStableDeployments pauses existing stable deployments before the release is deployed and resumes them
+// after the rollouts are done or the release is rolled back.
+// The rollout of a stable deployment, which does not exist yet, is skipped: the deployment is created by the release
+func withPausedRolloutStableDeployments(specs []*rolloutSpec, deployFunc func() error) func() error {
+	return func() error {
+		defer func() {
+			for _, spec := range specs {
+				if !isPausedRolloutStableDeployment(spec.Namespace, spec.StableDeployment) {
+					continue
+				}
+
+				if err := resumeRolloutStableDeployment(spec); err != nil {
+					logboek.LogWarnF("WARNING: %s\n", err)
+				}
+			}
+		}()
+
+		for _, spec := range specs {
+			if _, err := kube.Kubernetes.AppsV1().Deployments(spec.Namespace).Get(spec.StableDeployment, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("cannot get deploy/%s: %s", spec.StableDeployment, err)
+			}
+
+			logboek.Default.LogFDetails("Pausing deploy/%s until %s rollout\n", spec.StableDeployment, spec.Strategy)
+			if err := patchDeployment(spec.Namespace, spec.StableDeployment, `{"spec":{"paused":true}}`); err != nil {
+				return fmt.Errorf("cannot pause deploy/%s: %s", spec.StableDeployment, err)
+			}
+
+			pausedRolloutStableDeployments[spec.Namespace+"/"+spec.StableDeployment] = true
+		}
+
+		return deployFunc()
+	}
+}
+
+func resumeRolloutStableDeployment(spec *rolloutSpec) error {
+	logboek.Default.LogFDetails("Resuming deploy/%s\n", spec.StableDeployment)
+	if err := patchDeployment(spec.Namespace, spec.StableDeployment, `{"spec":{"paused":false}}`); err != nil {
+		return fmt.Errorf("cannot resume deploy/%s: %s", spec.StableDeployment, err)
+	}
+
+	delete(pausedRolloutStableDeployments, spec.Namespace+"/"+spec.StableDeployment)
+
+	return nil
+}
+
+func runRollouts(specs []*rolloutSpec, deadline time.Time) error {
+	for _, spec := range specs {
+		if !isPausedRolloutStableDeployment(spec.Namespace, spec.StableDeployment) {
+			logboek.LogInfoF("Skipping %s rollout of deploy/%s: stable deploy/%s is created by the release\n", spec.Strategy, spec.Deployment, spec.StableDeployment)
+			continue
+		}
+
+		logProcessMsg := fmt.Sprintf("Running %s rollout from deploy/%s to deploy/%s", spec.Strategy, spec.StableDeployment, spec.Deployment)
+		if err := logboek.LogProcess(logProcessMsg, logboek.LogProcessOptions{}, func() error {
+			return runRollout(spec, deadline)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runRollout shifts replicas from the paused stable deployment to the new one step by step,
+// then promotes the stable deployment: resumes it with the new pod template and all replicas and scales the new deployment down.
+// Replicas of both deployments are restored if a step fails
+func runRollout(spec *rolloutSpec, deadline time.Time) error {
+	deployments := kube.Kubernetes.AppsV1().Deployments(spec.Namespace)
+
+	deployment, err := deployments.Get(spec.Deployment, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot get deploy/%s: %s", spec.Deployment, err)
+	}
+
+	stableDeployment, err := deployments.Get(spec.StableDeployment, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot get deploy/%s: %s", spec.StableDeployment, err)
+	}
+
+	// Replicas are shifted between deployments, the total number is not changed
+	initialReplicas := extractSpecReplicas(deployment.Spec.Replicas)
+	initialStableReplicas := extractSpecReplicas(stableDeployment.Spec.Replicas)
+	totalReplicas := initialReplicas + initialStableReplicas
+	logboek.Default.LogFDetails("total-replicas: %d\n", totalReplicas)
+
+	for ind, step := range spec.Steps {
+		replicas, stableReplicas := rolloutStepReplicas(spec.Strategy, totalReplicas, initialStableReplicas, step.Weight)
+
+		logProcessMsg := fmt.Sprintf("Step %d/%d: %d%% of replicas", ind+1, len(spec.Steps), step.Weight)
+		if err := logboek.LogProcess(logProcessMsg, logboek.LogProcessOptions{}, func() error {
+			if err := scaleDeployment(spec.Namespace, spec.Deployment, replicas); err != nil {
+				return err
+			}
+
+			if err := waitForRolloutDeployment(spec.Namespace, spec.Deployment, spec.Annotations, replicas, deadline); err != nil {
+				return err
+			}
+
+			if err := scaleDeployment(spec.Namespace, spec.StableDeployment, stableReplicas); err != nil {
+				return err
+			}
+
+			return pauseRollout(step.Pause, deadline)
+		}); err != nil {
+			stepErr := fmt.Errorf("%s rollout step %d failed: %s", spec.Strategy, ind+1, err)
+
+			if err := scaleDeployment(spec.Namespace, spec.StableDeployment, initialStableReplicas); err != nil {
+				stepErr = fmt.Errorf("%s\nrestore replicas failed: %s", stepErr, err)
+			}
+
+			if err := scaleDeployment(spec.Namespace, spec.Deployment, initialReplicas); err != nil {
+				stepErr = fmt.Errorf("%s\nrestore replicas failed: %s", stepErr, err)
+			}
+
+			return stepErr
+		}
+	}
+
+	if err := logboek.LogProcess(fmt.Sprintf("Promoting deploy/%s", spec.StableDeployment), logboek.LogProcessOptions{}, func() error {
+		if err := resumeRolloutStableDeployment(spec); err != nil {
+			return err
+		}
+
+		if err := scaleDeployment(spec.Namespace, spec.StableDeployment, totalReplicas); err != nil {
+			return err
+		}
+
+		if err := waitForRolloutDeployment(spec.Namespace, spec.StableDeployment, spec.Annotations, totalReplicas, deadline); err != nil {
+			return err
+		}
+
+		return scaleDeployment(spec.Namespace, spec.Deployment, 0)
+	}); err != nil {
+		return fmt.Errorf("%s rollout promotion failed: %s", spec.Strategy, err)
+	}
+
+	return nil
+}
+
+// rolloutStepReplicas returns replicas of the new and the stable deployments on the step with the weight:
+// the blue-green rollout keeps the stable deployment replicas until the promotion
+func rolloutStepReplicas(strategy RolloutStrategy, totalReplicas, stableReplicas, weight int) (int, int) {
+	replicas := int(math.Ceil(float64(totalReplicas*weight) / 100))
+
+	if strategy == BlueGreenRolloutStrategy {
+		return replicas, stableReplicas
+	}
+
+	return replicas, totalReplicas - replicas
+}
+
+// rolloutTimeout returns the time left until the deploy timeout, zero deadline means no timeout
+func rolloutTimeout(deadline time.Time) (time.Duration, error) {
+	if deadline.IsZero() {
+		return 0, nil
+	}
+
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return 0, fmt.Errorf("deploy timeout exceeded")
+	}
+
+	return timeout, nil
+}
+
+func pauseRollout(pause time.Duration, deadline time.Time) error {
+	if pause == 0 {
+		return nil
+	}
+
+	if timeout, err := rolloutTimeout(deadline); err != nil {
+		return err
+	} else if timeout != 0 && pause > timeout {
+		return fmt.Errorf("pause %s exceeds the deploy timeout: %s left", pause, timeout.Round(time.Second))
+	}
+
+	logboek.Default.LogFDetails("Pausing for %s\n", pause)
+	time.Sleep(pause)
+
+	return nil
+}
+
+func scaleDeployment(namespace, name string, replicas int) error {
+	logboek.Default.LogFDetails("Scaling deploy/%s to %d replicas\n", name, replicas)
+
+	if err := patchDeployment(namespace, name, fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)); err != nil {
+		return fmt.Errorf("cannot scale deploy/%s: %s", name, err)
+	}
+
+	return nil
+}
+
+func patchDeployment(namespace, name, patch string) error {
+	_, err := kube.Kubernetes.AppsV1().Deployments(namespace).Patch(name, types.MergePatchType, []byte(patch))
+	return err
+}
+
+func waitForRolloutDeployment(namespace, name string, annotations map[string]string, replicas int, deadline time.Time) error {
+	timeout, err := rolloutTimeout(deadline)
+	if err != nil {
+		return err
+	}
+
+	multitrackSpec, err := prepareMultitrackSpec(name, "deploy", namespace, annotations, allowedFailuresCountOptions{multiplier: replicas, defaultPerReplica: 1})
+	if err != nil {
+		return err
+	}
+
+	return multitrack.Multitrack(kube.Kubernetes, multitrack.MultitrackSpecs{Deployments: []multitrack.MultitrackSpec{*multitrackSpec}}, multitrack.MultitrackOptions{
+		StatusProgressPeriod: resourcesWaiter.StatusProgressPeriod,
+		Options: tracker.Options{
+			Timeout:      timeout,
+			LogsFromTime: resourcesWaiter.LogsFromTime,
+		},
+	})
+}
@@ -0,0 +1,275 @@
+package helm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	helm_kube "k8s.io/helm/pkg/kube"
+)
+
+func rolloutTemplate(name string, annotations map[string]string) Template {
+	t := Template{Version: "apps/v1", Kind: "Deployment"}
+	t.Metadata.Name = name
+	t.Metadata.Annotations = annotations
+
+	return t
+}
+
+func TestParseRolloutSteps(t *testing.T) {
+	tests := []struct {
+		value         string
+		expected      []rolloutStep
+		expectedError string
+	}{
+		{
+			value:    "25,50,100",
+			expected: []rolloutStep{{Weight: 25, Pause: time.Minute}, {Weight: 50, Pause: time.Minute}, {Weight: 100, Pause: time.Minute}},
+		},
+		{
+			value:    "10:5m, 50:10m,100",
+			expected: []rolloutStep{{Weight: 10, Pause: 5 * time.Minute}, {Weight: 50, Pause: 10 * time.Minute}, {Weight: 100, Pause: time.Minute}},
+		},
+		{
+			value:    "30:0s",
+			expected: []rolloutStep{{Weight: 30}},
+		},
+		{value: "0,100", expectedError: "bad weight of step \"0\""},
+		{value: "50,101", expectedError: "bad weight of step \"101\""},
+		{value: "50,50", expectedError: "weights should increase"},
+		{value: "a", expectedError: "bad weight of step \"a\""},
+		{value: "10:5", expectedError: "bad pause of step \"10:5\""},
+		{value: "10:-5m", expectedError: "bad pause of step \"10:-5m\""},
+	}
+
+	for _, test := range tests {
+		steps, err := parseRolloutSteps(test.value, time.Minute)
+		if test.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("%s:\n[EXPECTED]: %s\n[GOT]: %v", test.value, test.expectedError, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.value, err)
+		} else if !reflect.DeepEqual(steps, test.expected) {
+			t.Errorf("%s:\n[EXPECTED]: %v\n[GOT]: %v", test.value, test.expected, steps)
+		}
+	}
+}
+
+func TestParseRolloutSpec(t *testing.T) {
+	tests := []struct {
+		name          string
+		template      Template
+		expected      *rolloutSpec
+		expectedError string
+	}{
+		{
+			name:     "no rollout",
+			template: rolloutTemplate("app", map[string]string{"werf.io/track-termination-mode": "NonBlocking"}),
+		},
+		{
+			name: "canary with default steps",
+			template: rolloutTemplate("app-canary", map[string]string{
+				RolloutStrategyAnnoName:                       "canary",
+				RolloutStableDeploymentAnnoName:               "app",
+				RolloutStepPauseAnnoName:                      "30s",
+				helm_kube.SetReplicasOnlyOnCreationAnnotation: "true",
+			}),
+			expected: &rolloutSpec{
+				Strategy:         CanaryRolloutStrategy,
+				Namespace:        "ns",
+				Deployment:       "app-canary",
+				StableDeployment: "app",
+				Steps:            []rolloutStep{{Weight: 25, Pause: 30 * time.Second}, {Weight: 50, Pause: 30 * time.Second}, {Weight: 100, Pause: 30 * time.Second}},
+			},
+		},
+		{
+			name: "canary with steps",
+			template: rolloutTemplate("app-canary", map[string]string{
+				RolloutStrategyAnnoName:                       "canary",
+				RolloutStableDeploymentAnnoName:               "app",
+				RolloutStepsAnnoName:                          "10:5m,100",
+				helm_kube.SetReplicasOnlyOnCreationAnnotation: "true",
+			}),
+			expected: &rolloutSpec{
+				Strategy:         CanaryRolloutStrategy,
+				Namespace:        "ns",
+				Deployment:       "app-canary",
+				StableDeployment: "app",
+				Steps:            []rolloutStep{{Weight: 10, Pause: 5 * time.Minute}, {Weight: 100}},
+			},
+		},
+		{
+			name: "blue-green",
+			template: rolloutTemplate("app-green", map[string]string{
+				RolloutStrategyAnnoName:                       "blue-green",
+				RolloutStableDeploymentAnnoName:               "app",
+				RolloutStepPauseAnnoName:                      "1m",
+				helm_kube.SetReplicasOnlyOnCreationAnnotation: "true",
+			}),
+			expected: &rolloutSpec{
+				Strategy:         BlueGreenRolloutStrategy,
+				Namespace:        "ns",
+				Deployment:       "app-green",
+				StableDeployment: "app",
+				Steps:            []rolloutStep{{Weight: 100, Pause: time.Minute}},
+			},
+		},
+		{
+			name:          "rollout annotation without strategy",
+			template:      rolloutTemplate("app-canary", map[string]string{RolloutStepsAnnoName: "50,100"}),
+			expectedError: "cannot be used without",
+		},
+		{
+			name: "invalid strategy",
+			template: rolloutTemplate("app-canary", map[string]string{
+				RolloutStrategyAnnoName:         "linear",
+				RolloutStableDeploymentAnnoName: "app",
+			}),
+			expectedError: "invalid value linear",
+		},
+		{
+			name: "no stable deployment",
+			template: rolloutTemplate("app-canary", map[string]string{
+				RolloutStrategyAnnoName: "canary",
+			}),
+			expectedError: RolloutStableDeploymentAnnoName + " is required",
+		},
+		{
+			name: "stable deployment is the deployment itself",
+			template: rolloutTemplate("app", map[string]string{
+				RolloutStrategyAnnoName:         "canary",
+				RolloutStableDeploymentAnnoName: "app",
+			}),
+			expectedError: "stable deployment cannot be the deployment itself",
+		},
+		{
+			name: "replicas are set on each upgrade",
+			template: rolloutTemplate("app-canary", map[string]string{
+				RolloutStrategyAnnoName:         "canary",
+				RolloutStableDeploymentAnnoName: "app",
+			}),
+			expectedError: helm_kube.SetReplicasOnlyOnCreationAnnotation + "=true is required",
+		},
+		{
+			name: "steps of blue-green",
+			template: rolloutTemplate("app-green", map[string]string{
+				RolloutStrategyAnnoName:                       "blue-green",
+				RolloutStableDeploymentAnnoName:               "app",
+				RolloutStepsAnnoName:                          "50,100",
+				helm_kube.SetReplicasOnlyOnCreationAnnotation: "true",
+			}),
+			expectedError: "cannot be used for blue-green rollout",
+		},
+		{
+			name: "invalid pause",
+			template: rolloutTemplate("app-canary", map[string]string{
+				RolloutStrategyAnnoName:                       "canary",
+				RolloutStableDeploymentAnnoName:               "app",
+				RolloutStepPauseAnnoName:                      "5",
+				helm_kube.SetReplicasOnlyOnCreationAnnotation: "true",
+			}),
+			expectedError: RolloutStepPauseAnnoName + " with invalid value 5",
+		},
+	}
+
+	for _, test := range tests {
+		spec, err := parseRolloutSpec(test.template, "ns")
+		if test.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("%s:\n[EXPECTED]: %s\n[GOT]: %v", test.name, test.expectedError, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+
+		if spec != nil {
+			spec.Annotations = nil
+		}
+
+		if !reflect.DeepEqual(spec, test.expected) {
+			t.Errorf("%s:\n[EXPECTED]: %+v\n[GOT]: %+v", test.name, test.expected, spec)
+		}
+	}
+}
+
+func TestRolloutStepReplicas(t *testing.T) {
+	tests := []struct {
+		strategy               RolloutStrategy
+		totalReplicas          int
+		stableReplicas         int
+		weights                []int
+		expectedReplicas       []int
+		expectedStableReplicas []int
+	}{
+		{
+			strategy:               CanaryRolloutStrategy,
+			totalReplicas:          4,
+			stableReplicas:         4,
+			weights:                []int{25, 50, 100},
+			expectedReplicas:       []int{1, 2, 4},
+			expectedStableReplicas: []int{3, 2, 0},
+		},
+		{
+			strategy:               CanaryRolloutStrategy,
+			totalReplicas:          3,
+			stableReplicas:         3,
+			weights:                []int{10, 50, 90},
+			expectedReplicas:       []int{1, 2, 3},
+			expectedStableReplicas: []int{2, 1, 0},
+		},
+		{
+			strategy:               CanaryRolloutStrategy,
+			totalReplicas:          0,
+			stableReplicas:         0,
+			weights:                []int{50, 100},
+			expectedReplicas:       []int{0, 0},
+			expectedStableReplicas: []int{0, 0},
+		},
+		{
+			strategy:               BlueGreenRolloutStrategy,
+			totalReplicas:          5,
+			stableReplicas:         4,
+			weights:                []int{100},
+			expectedReplicas:       []int{5},
+			expectedStableReplicas: []int{4},
+		},
+	}
+
+	for _, test := range tests {
+		var replicas, stableReplicas []int
+		for _, weight := range test.weights {
+			r, s := rolloutStepReplicas(test.strategy, test.totalReplicas, test.stableReplicas, weight)
+			replicas = append(replicas, r)
+			stableReplicas = append(stableReplicas, s)
+		}
+
+		if !reflect.DeepEqual(replicas, test.expectedReplicas) || !reflect.DeepEqual(stableReplicas, test.expectedStableReplicas) {
+			t.Errorf("%s %d replicas by %v:\n[EXPECTED]: %v %v\n[GOT]: %v %v", test.strategy, test.totalReplicas, test.weights, test.expectedReplicas, test.expectedStableReplicas, replicas, stableReplicas)
+		}
+	}
+}
+
+func TestPauseRollout(t *testing.T) {
+	if err := pauseRollout(time.Hour, time.Now().Add(time.Minute)); err == nil || !strings.Contains(err.Error(), "exceeds the deploy timeout") {
+		t.Errorf("\n[EXPECTED]: pause exceeds the deploy timeout\n[GOT]: %v", err)
+	}
+
+	if err := pauseRollout(time.Millisecond, time.Now().Add(-time.Second)); err == nil || !strings.Contains(err.Error(), "deploy timeout exceeded") {
+		t.Errorf("\n[EXPECTED]: deploy timeout exceeded\n[GOT]: %v", err)
+	}
+
+	if err := pauseRollout(time.Millisecond, time.Time{}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
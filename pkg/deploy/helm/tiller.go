@@ -20,6 +20,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/helm/pkg/chartutil"
 	"k8s.io/helm/pkg/helm"
 	helm_env "k8s.io/helm/pkg/helm/environment"
@@ -62,6 +63,7 @@ var (
 
 	ConfigMapStorage = "configmap"
 	SecretStorage    = "secret"
+	Helm3Storage     = "helm3"
 
 	LoadChartfileFunc = func(chartPath string) (*chart.Chart, error) {
 		return chartutil.Load(chartPath)
@@ -96,6 +98,14 @@ type InitOptions struct {
 
 	ReleasesMaxHistory int
 
+	// ReleaseLock enables the cluster-side release lock
+	ReleaseLock bool
+	// ReleaseLockTimeout limits the time of waiting for the cluster-side release lock, 0 means waiting forever
+	ReleaseLockTimeout time.Duration
+
+	// ReleaseNamespace scopes the Helm 3 release storage, the namespace of the kube context is used by default
+	ReleaseNamespace string
+
 	WithoutKube bool
 }
 
@@ -134,7 +144,7 @@ func Init(options InitOptions) error {
 	}
 	kubeClient.SetResourcesWaiter(resourcesWaiter)
 
-	tillerSettings.KubeClient = kubeClient
+	tillerSettings.KubeClient = &WeightedKubeClient{Client: kubeClient}
 	tillerSettings.EngineYard[WerfTemplateEngineName] = WerfTemplateEngine
 
 	clientset, err := kubeClient.KubernetesClientSet()
@@ -142,16 +152,26 @@ func Init(options InitOptions) error {
 		return err
 	}
 
+	releaseNamespace := options.ReleaseNamespace
+	if options.HelmReleaseStorageType == Helm3Storage && releaseNamespace == "" {
+		kubeContextConfigFlags := genericclioptions.NewConfigFlags(true)
+		kubeContextConfigFlags.Context = &helmSettings.KubeContext
+		kubeContextConfigFlags.KubeConfig = &helmSettings.KubeConfig
+
+		releaseNamespace, _, err = kubeContextConfigFlags.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return fmt.Errorf("unable to get namespace of the kube context: %s", err)
+		}
+	}
+
 	if options.InitNamespace {
-		if _, err := clientset.CoreV1().Namespaces().Get(options.HelmReleaseStorageNamespace, metav1.GetOptions{}); err != nil {
-			if kubeErrors.IsNotFound(err) {
-				if _, err := clientset.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: options.HelmReleaseStorageNamespace}}); err != nil {
-					return fmt.Errorf("unable to create helm release storage namespace '%s': %s", options.HelmReleaseStorageNamespace, err)
-				}
+		if err := initHelmReleaseStorageNamespace(clientset, options.HelmReleaseStorageNamespace); err != nil {
+			return err
+		}
 
-				logboek.Default.LogFDetails("Created helm release storage namespace '%s'\n", options.HelmReleaseStorageNamespace)
-			} else {
-				return fmt.Errorf("unable to initialize helm release storage in namespace '%s': %s", options.HelmReleaseStorageNamespace, err)
+		if options.HelmReleaseStorageType == Helm3Storage {
+			if err := initHelmReleaseStorageNamespace(clientset, releaseNamespace); err != nil {
+				return err
 			}
 		}
 	}
@@ -184,10 +204,27 @@ func Init(options InitOptions) error {
 			msg := fmt.Sprintf(fmt.Sprintf("Release storage: %s", f), args...)
 			releaseLogMessages = append(releaseLogMessages, msg)
 		}
+	case Helm3Storage:
+		secrets := NewHelm3Secrets(clientset.CoreV1().Secrets(releaseNamespace))
+		secrets.Log = func(f string, args ...interface{}) {
+			msg := fmt.Sprintf(fmt.Sprintf("Helm 3 secrets release storage driver: %s", f), args...)
+			releaseLogMessages = append(releaseLogMessages, msg)
+		}
+		tillerSettings.Releases = storage.Init(secrets)
+		tillerSettings.Releases.Log = func(f string, args ...interface{}) {
+			msg := fmt.Sprintf(fmt.Sprintf("Release storage: %s", f), args...)
+			releaseLogMessages = append(releaseLogMessages, msg)
+		}
+
+		if options.ReleasesMaxHistory > 0 {
+			tillerSettings.Releases.MaxHistory = options.ReleasesMaxHistory
+		}
 	default:
 		return fmt.Errorf("unknown helm release storage type '%s'", options.HelmReleaseStorageType)
 	}
 
+	initReleaseLock(clientset, options.HelmReleaseStorageNamespace, options.ReleaseLock, options.ReleaseLockTimeout)
+
 	tillerReleaseServer = tiller.NewReleaseServer(tillerSettings, clientset, false)
 	tillerReleaseServer.Log = func(f string, args ...interface{}) {
 		msg := fmt.Sprintf(fmt.Sprintf("Release server: %s", f), args...)
@@ -197,6 +234,22 @@ func Init(options InitOptions) error {
 	return nil
 }
 
+func initHelmReleaseStorageNamespace(clientset kubernetes.Interface, namespace string) error {
+	if _, err := clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{}); err != nil {
+		if kubeErrors.IsNotFound(err) {
+			if _, err := clientset.CoreV1().Namespaces().Create(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}); err != nil {
+				return fmt.Errorf("unable to create helm release storage namespace '%s': %s", namespace, err)
+			}
+
+			logboek.Default.LogFDetails("Created helm release storage namespace '%s'\n", namespace)
+		} else {
+			return fmt.Errorf("unable to initialize helm release storage in namespace '%s': %s", namespace, err)
+		}
+	}
+
+	return nil
+}
+
 type releaseContentOptions struct {
 	Version int32
 }
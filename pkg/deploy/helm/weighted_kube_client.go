@@ -0,0 +1,210 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/helm/pkg/kube"
+
+	"github.com/flant/logboek"
+)
+
+// WeightedKubeClient applies regular release resources in groups ordered by werf.io/weight annotation,
+// each group is applied and waited for readiness before the next one
+type WeightedKubeClient struct {
+	*kube.Client
+}
+
+func (c *WeightedKubeClient) CreateWithOptions(namespace string, reader io.Reader, opts kube.CreateOptions) error {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	target, err := parseWeightedManifests(string(data))
+	if err != nil {
+		return err
+	}
+
+	groups := groupWeightedManifests(target)
+	if len(groups) <= 1 {
+		return c.Client.CreateWithOptions(namespace, bytes.NewReader(data), opts)
+	}
+
+	for i, group := range groups {
+		groupOpts := opts
+		if i != len(groups)-1 {
+			groupOpts.ShouldWait = true
+		}
+
+		if err := logboek.Default.LogProcess(fmt.Sprintf("Creating resources with weight %d", group.Weight), logboek.LevelLogProcessOptions{}, func() error {
+			return c.Client.CreateWithOptions(namespace, bytes.NewBufferString(joinWeightedManifests(group.Manifests)), groupOpts)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *WeightedKubeClient) UpdateWithOptions(namespace string, originalReader, targetReader io.Reader, opts kube.UpdateOptions) error {
+	originalData, err := ioutil.ReadAll(originalReader)
+	if err != nil {
+		return err
+	}
+
+	targetData, err := ioutil.ReadAll(targetReader)
+	if err != nil {
+		return err
+	}
+
+	target, err := parseWeightedManifests(string(targetData))
+	if err != nil {
+		return err
+	}
+
+	groups := groupWeightedManifests(target)
+	if len(groups) <= 1 {
+		return c.Client.UpdateWithOptions(namespace, bytes.NewReader(originalData), bytes.NewReader(targetData), opts)
+	}
+
+	original, err := parseWeightedManifests(string(originalData))
+	if err != nil {
+		return err
+	}
+
+	originalGroups := groupOriginalManifests(original, groups)
+	for i, group := range groups {
+		groupOpts := opts
+		if i != len(groups)-1 {
+			groupOpts.ShouldWait = true
+		}
+
+		if err := logboek.Default.LogProcess(fmt.Sprintf("Updating resources with weight %d", group.Weight), logboek.LevelLogProcessOptions{}, func() error {
+			return c.Client.UpdateWithOptions(namespace, bytes.NewBufferString(joinWeightedManifests(originalGroups[i])), bytes.NewBufferString(joinWeightedManifests(group.Manifests)), groupOpts)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type weightedManifest struct {
+	Id       string
+	Weight   int
+	Manifest string
+}
+
+type weightedManifestsGroup struct {
+	Weight    int
+	Manifests []weightedManifest
+}
+
+// manifestsSeparator is the same as the separator used by releaseutil.SplitManifests, which loses the manifests order
+var manifestsSeparator = regexp.MustCompile("(?:^|\\s*\n)---\\s*")
+
+func parseWeightedManifests(manifests string) ([]weightedManifest, error) {
+	var result []weightedManifest
+
+	for _, doc := range manifestsSeparator.Split(manifests, -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		var obj struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name        string            `yaml:"name"`
+				Namespace   string            `yaml:"namespace"`
+				Annotations map[string]string `yaml:"annotations"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, fmt.Errorf("unable to parse manifest: %s", err)
+		}
+
+		if obj.Kind == "" {
+			continue
+		}
+
+		var weight int
+		if value, hasKey := obj.Metadata.Annotations[WeightAnnoName]; hasKey {
+			intValue, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s annotation %s with invalid value %s: integer expected", strings.ToLower(obj.Kind), obj.Metadata.Name, WeightAnnoName, value)
+			}
+
+			weight = intValue
+		}
+
+		result = append(result, weightedManifest{
+			Id:       fmt.Sprintf("%s/%s/%s", strings.ToLower(obj.Kind), obj.Metadata.Namespace, obj.Metadata.Name),
+			Weight:   weight,
+			Manifest: doc,
+		})
+	}
+
+	return result, nil
+}
+
+func joinWeightedManifests(manifests []weightedManifest) string {
+	var docs []string
+	for _, m := range manifests {
+		docs = append(docs, m.Manifest)
+	}
+
+	return strings.Join(docs, "\n---\n")
+}
+
+// groupWeightedManifests groups manifests by weight in ascending order, the order of manifests inside the group is preserved
+func groupWeightedManifests(manifests []weightedManifest) []weightedManifestsGroup {
+	var groups []weightedManifestsGroup
+
+	for _, m := range manifests {
+		ind := sort.Search(len(groups), func(i int) bool {
+			return groups[i].Weight >= m.Weight
+		})
+
+		if ind == len(groups) || groups[ind].Weight != m.Weight {
+			groups = append(groups, weightedManifestsGroup{})
+			copy(groups[ind+1:], groups[ind:])
+			groups[ind] = weightedManifestsGroup{Weight: m.Weight}
+		}
+
+		groups[ind].Manifests = append(groups[ind].Manifests, m)
+	}
+
+	return groups
+}
+
+// groupOriginalManifests matches original manifests with the target groups,
+// original manifests that are not in the target go to the last group to be deleted after all groups are applied
+func groupOriginalManifests(original []weightedManifest, groups []weightedManifestsGroup) [][]weightedManifest {
+	groupIndByTargetId := map[string]int{}
+	for i, group := range groups {
+		for _, m := range group.Manifests {
+			groupIndByTargetId[m.Id] = i
+		}
+	}
+
+	originalGroups := make([][]weightedManifest, len(groups))
+	for _, m := range original {
+		ind, isTarget := groupIndByTargetId[m.Id]
+		if !isTarget {
+			ind = len(groups) - 1
+		}
+
+		originalGroups[ind] = append(originalGroups[ind], m)
+	}
+
+	return originalGroups
+}
@@ -0,0 +1,141 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func describeWeightedManifests(manifests []weightedManifest) string {
+	var ids []string
+	for _, m := range manifests {
+		ids = append(ids, m.Id)
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func TestGroupWeightedManifests(t *testing.T) {
+	tests := []struct {
+		name      string
+		original  string
+		target    string
+		expected  string
+		expectErr string
+	}{
+		{
+			name: "no weights",
+			target: `
+kind: ConfigMap
+metadata:
+  name: config
+---
+kind: Deployment
+metadata:
+  name: app
+`,
+			expected: "0: [configmap//config,deployment//app] original: []",
+		},
+		{
+			name: "weighted groups",
+			target: `
+# Source: chart/templates/app.yaml
+kind: Deployment
+metadata:
+  name: app
+---
+kind: StatefulSet
+metadata:
+  name: db
+  annotations:
+    werf.io/weight: "-10"
+---
+kind: CustomResourceDefinition
+metadata:
+  name: crd
+  annotations:
+    werf.io/weight: "-20"
+---
+kind: Service
+metadata:
+  name: app
+  namespace: other
+`,
+			expected: "-20: [customresourcedefinition//crd] original: []\n-10: [statefulset//db] original: []\n0: [deployment//app,service/other/app] original: []",
+		},
+		{
+			name: "original resources",
+			original: `
+kind: StatefulSet
+metadata:
+  name: db
+---
+kind: Deployment
+metadata:
+  name: removed
+---
+kind: Deployment
+metadata:
+  name: app
+`,
+			target: `
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    werf.io/weight: "10"
+---
+kind: StatefulSet
+metadata:
+  name: db
+  annotations:
+    werf.io/weight: "-10"
+---
+kind: ConfigMap
+metadata:
+  name: config
+`,
+			expected: "-10: [statefulset//db] original: [statefulset//db]\n0: [configmap//config] original: []\n10: [deployment//app] original: [deployment//removed,deployment//app]",
+		},
+		{
+			name: "invalid weight",
+			target: `
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    werf.io/weight: "first"
+`,
+			expectErr: "deployment/app annotation werf.io/weight with invalid value first: integer expected",
+		},
+	}
+
+	for _, test := range tests {
+		original, err := parseWeightedManifests(test.original)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		target, err := parseWeightedManifests(test.target)
+		if test.expectErr != "" {
+			if err == nil || err.Error() != test.expectErr {
+				t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%v", test.name, test.expectErr, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		groups := groupWeightedManifests(target)
+		originalGroups := groupOriginalManifests(original, groups)
+
+		var lines []string
+		for i, group := range groups {
+			lines = append(lines, fmt.Sprintf("%d: [%s] original: [%s]", group.Weight, describeWeightedManifests(group.Manifests), describeWeightedManifests(originalGroups[i])))
+		}
+
+		if got := strings.Join(lines, "\n"); got != test.expected {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expected, got)
+		}
+	}
+}
@@ -30,7 +30,7 @@ type RenderOptions struct {
 func RunRender(out io.Writer, projectDir string, werfConfig *config.WerfConfig, imagesRepoManager images_manager.ImagesRepoManager, images []images_manager.ImageInfoGetter, commonTag string, tagStrategy tag_strategy.TagStrategy, opts RenderOptions) error {
 	logboek.Debug.LogF("Render options: %#v\n", opts)
 
-	m, err := GetSafeSecretManager(projectDir, opts.SecretValues, opts.IgnoreSecretKey)
+	m, err := GetSafeSecretManager(projectDir, werfConfig.Meta.Secrets, opts.SecretValues, opts.IgnoreSecretKey)
 	if err != nil {
 		return err
 	}
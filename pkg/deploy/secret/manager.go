@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/flant/werf/pkg/config"
 	"github.com/flant/werf/pkg/secret"
 	"github.com/flant/werf/pkg/util"
 	"github.com/flant/werf/pkg/werf"
@@ -23,22 +24,36 @@ func GenerateSecretKey() ([]byte, error) {
 	return secret.GenerateAexSecretKey()
 }
 
-func GetManager(projectDir string) (Manager, error) {
-	var m Manager
-	var key []byte
-	var err error
+// GetManager returns manager for the project secrets backend (aes backend is used by default)
+func GetManager(projectDir string, secretsConfig config.Secrets) (Manager, error) {
+	switch secretsConfig.Backend {
+	case secret.AgeBackend:
+		identities, err := GetAgeIdentities()
+		if err != nil {
+			return nil, err
+		}
 
-	key, err = GetSecretKey(projectDir)
-	if err != nil {
-		return nil, err
-	}
+		return NewAgeManager(secretsConfig.Recipients, identities)
+	case secret.PgpBackend:
+		publicKeyring, err := ioutil.ReadFile(filepath.Join(projectDir, secretsConfig.PublicKeyring))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read pgp public keyring: %s", err)
+		}
 
-	m, err = NewManager(key)
-	if err != nil {
-		return nil, err
-	}
+		secretKeyring, err := GetPgpSecretKeyring()
+		if err != nil {
+			return nil, err
+		}
 
-	return m, nil
+		return NewPgpManager(secretsConfig.Recipients, publicKeyring, secretKeyring, []byte(os.Getenv("WERF_SECRET_PGP_PASSPHRASE")))
+	default:
+		key, err := GetSecretKey(projectDir)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewManager(key)
+	}
 }
 
 func GetSecretKey(projectDir string) ([]byte, error) {
@@ -95,6 +110,37 @@ func GetSecretKey(projectDir string) ([]byte, error) {
 	return secretKey, nil
 }
 
+// GetAgeIdentities returns the content of the age identity file, identities are only required for decryption
+func GetAgeIdentities() ([]byte, error) {
+	if identity := os.Getenv("WERF_SECRET_AGE_IDENTITY"); identity != "" {
+		return []byte(identity), nil
+	}
+
+	return readOptionalSecretFile(os.Getenv("WERF_SECRET_AGE_IDENTITY_FILE"), filepath.Join(werf.GetHomeDir(), "age_identity"))
+}
+
+// GetPgpSecretKeyring returns the content of the pgp secret keyring, secret keys are only required for decryption
+func GetPgpSecretKeyring() ([]byte, error) {
+	return readOptionalSecretFile(os.Getenv("WERF_SECRET_PGP_KEYRING"), filepath.Join(werf.GetHomeDir(), "pgp_secret_keyring"))
+}
+
+func readOptionalSecretFile(path, defaultPath string) ([]byte, error) {
+	if path == "" {
+		exist, err := util.FileExists(defaultPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exist {
+			return nil, nil
+		}
+
+		path = defaultPath
+	}
+
+	return ioutil.ReadFile(path)
+}
+
 func NewManager(key []byte) (Manager, error) {
 	ss, err := secret.NewSecret(key)
 	if err != nil {
@@ -104,6 +150,24 @@ func NewManager(key []byte) (Manager, error) {
 	return newBaseManager(ss)
 }
 
+func NewAgeManager(recipients []string, identities []byte) (Manager, error) {
+	ss, err := secret.NewAgeSecret(recipients, identities)
+	if err != nil {
+		return nil, fmt.Errorf("check age recipients and identities: %s", err)
+	}
+
+	return newBaseManager(ss)
+}
+
+func NewPgpManager(recipients []string, publicKeyring, secretKeyring, passphrase []byte) (Manager, error) {
+	ss, err := secret.NewPgpSecret(recipients, publicKeyring, secretKeyring, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("check pgp recipients and keyrings: %s", err)
+	}
+
+	return newBaseManager(ss)
+}
+
 func NewSafeManager() (Manager, error) {
 	return newBaseManager(nil)
 }
@@ -6,11 +6,12 @@ import (
 
 	"github.com/flant/logboek"
 
+	"github.com/flant/werf/pkg/config"
 	"github.com/flant/werf/pkg/deploy/secret"
 	"github.com/flant/werf/pkg/deploy/werf_chart"
 )
 
-func GetSafeSecretManager(projectDir string, secretValues []string, ignoreSecretKey bool) (secret.Manager, error) {
+func GetSafeSecretManager(projectDir string, secretsConfig config.Secrets, secretValues []string, ignoreSecretKey bool) (secret.Manager, error) {
 	isSecretsExists := false
 	if _, err := os.Stat(filepath.Join(projectDir, werf_chart.ProjectHelmChartDirName, werf_chart.SecretDirName)); !os.IsNotExist(err) {
 		isSecretsExists = true
@@ -28,12 +29,7 @@ func GetSafeSecretManager(projectDir string, secretValues []string, ignoreSecret
 			return secret.NewSafeManager()
 		}
 
-		key, err := secret.GetSecretKey(projectDir)
-		if err != nil {
-			return nil, err
-		}
-
-		return secret.NewManager(key)
+		return secret.GetManager(projectDir, secretsConfig)
 	} else {
 		return secret.NewSafeManager()
 	}
@@ -61,6 +61,10 @@ func GetServiceValues(projectName string, imagesRepoManager images_manager.Image
 		ciInfo["is_custom_tag"] = true
 	case tag_strategy.StagesSignature:
 		ciInfo["is_tag_by_stages_signatures"] = true
+	case tag_strategy.Semver:
+		ciInfo["is_semver_tag"] = true
+	case tag_strategy.Template:
+		ciInfo["is_template_tag"] = true
 	}
 
 	imagesInfo := make(map[string]interface{})
@@ -80,7 +84,7 @@ func GetServiceValues(projectName string, imagesRepoManager images_manager.Image
 		imageData["docker_image"] = image.GetImageName()
 		imageData["docker_tag"] = image.GetImageTag()
 
-		if tagStrategy == tag_strategy.GitBranch || tagStrategy == tag_strategy.Custom {
+		if tagStrategy == tag_strategy.GitBranch || tagStrategy == tag_strategy.Custom || tagStrategy == tag_strategy.Template {
 			setKey := func(key, value string) {
 				if value == "" {
 					imageData[key] = TemplateEmptyValue
@@ -1,6 +1,8 @@
 package docker
 
 import (
+	"io"
+
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/cli/cli/command/container"
 	"github.com/docker/docker/api/types"
@@ -82,6 +84,12 @@ func CliRun_LiveOutput(args ...string) error {
 	return doCliRun(liveOutputCli, args...)
 }
 
+func CliRun_ProvidedOutput(stdoutWriter, stderrWriter io.Writer, args ...string) error {
+	return callCliWithProvidedOutput(stdoutWriter, stderrWriter, func(c *command.DockerCli) error {
+		return doCliRun(c, args...)
+	})
+}
+
 func CliRun_RecordedOutput(args ...string) (string, error) {
 	return callCliWithRecordedOutput(func(c *command.DockerCli) error {
 		return doCliRun(c, args...)
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"io"
 	"strings"
 	"time"
 
@@ -238,8 +239,40 @@ func CliBuild_LiveOutput(args ...string) error {
 	return doCliBuild(liveOutputCli, args...)
 }
 
+func CliBuild_ProvidedOutput(stdoutWriter, stderrWriter io.Writer, args ...string) error {
+	return callCliWithProvidedOutput(stdoutWriter, stderrWriter, func(c *command.DockerCli) error {
+		return doCliBuild(c, args...)
+	})
+}
+
 func CliBuild_RecordedOutput(args ...string) (string, error) {
 	return callCliWithRecordedOutput(func(c *command.DockerCli) error {
 		return doCliBuild(c, args...)
 	})
 }
+
+// buildKitCli selects the BuildKit builder for the build command regardless of the daemon default builder,
+// so that the builder is chosen per build without changing the DOCKER_BUILDKIT environment variable
+type buildKitCli struct {
+	*command.DockerCli
+}
+
+func (c buildKitCli) ServerInfo() command.ServerInfo {
+	serverInfo := c.DockerCli.ServerInfo()
+	serverInfo.BuildkitVersion = types.BuilderBuildKit
+	return serverInfo
+}
+
+func doCliBuildKit(c *command.DockerCli, args ...string) error {
+	return prepareCliCmd(image.NewBuildCommand(buildKitCli{c}), args...).Execute()
+}
+
+func CliBuildKit_LiveOutput(args ...string) error {
+	return doCliBuildKit(liveOutputCli, args...)
+}
+
+func CliBuildKit_ProvidedOutput(stdoutWriter, stderrWriter io.Writer, args ...string) error {
+	return callCliWithProvidedOutput(stdoutWriter, stderrWriter, func(c *command.DockerCli) error {
+		return doCliBuildKit(c, args...)
+	})
+}
@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/cli/cli/command"
+)
+
+func TestBuildKitCli(t *testing.T) {
+	if _, isSet := os.LookupEnv("DOCKER_BUILDKIT"); isSet {
+		t.Skip("DOCKER_BUILDKIT is set")
+	}
+
+	c, err := command.NewDockerCli()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		cli      command.Cli
+		expected bool
+	}{
+		{c, false},
+		{buildKitCli{c}, true},
+	} {
+		enabled, err := command.BuildKitEnabled(test.cli.ServerInfo())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if enabled != test.expected {
+			t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.expected, enabled)
+		}
+	}
+}
@@ -131,6 +131,15 @@ func callCliWithRecordedOutput(commandCaller func(c *command.DockerCli) error) (
 	}
 }
 
+func callCliWithProvidedOutput(stdoutWriter, stderrWriter io.Writer, commandCaller func(c *command.DockerCli) error) error {
+	c, err := getRecordingOutputCli(stdoutWriter, stderrWriter)
+	if err != nil {
+		return fmt.Errorf("unable to create docker cli: %s", err)
+	}
+
+	return commandCaller(c)
+}
+
 func getRecordingOutputCli(stdoutWriter, stderrWriter io.Writer) (*command.DockerCli, error) {
 	return newDockerCli([]command.DockerCliOption{
 		command.WithOutputStream(stdoutWriter),
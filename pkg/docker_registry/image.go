@@ -0,0 +1,64 @@
+package docker_registry
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ParseReference parses the image reference with the registry options (weak validation, insecure registry)
+func ParseReference(reference string) (name.Reference, error) {
+	ref, err := name.ParseReference(reference, parseReferenceOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	return ref, nil
+}
+
+// PullImage returns the image for the platform from the manifest list (or the image itself),
+// empty platform means the platform of the registry client (linux/amd64)
+func PullImage(reference, platform string) (v1.Image, error) {
+	if platform == "" {
+		img, _, err := image(reference)
+		return img, err
+	}
+
+	v1Platform, err := parsePlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image(reference, remote.WithPlatform(v1Platform))
+	if err != nil {
+		return nil, err
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if configFile.OS != v1Platform.OS || configFile.Architecture != v1Platform.Architecture {
+		return nil, fmt.Errorf("image %q is not available for platform %s", reference, platform)
+	}
+
+	return img, nil
+}
+
+// PushImage writes the image to the registry by the reference
+func PushImage(reference string, img v1.Image) error {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return err
+	}
+
+	if err := remote.Write(ref, img, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(getHttpTransport())); err != nil {
+		return fmt.Errorf("writing image %q: %v", ref, err)
+	}
+
+	return nil
+}
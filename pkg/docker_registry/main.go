@@ -161,6 +161,40 @@ func ImageId(reference string) (string, error) {
 	return manifest.Config.Digest.String(), nil
 }
 
+// PlatformImageId returns the id of the platform image from the manifest list (or the id of the image itself),
+// empty platform means the platform of the registry client (linux/amd64)
+func PlatformImageId(reference, platform string) (string, error) {
+	if platform == "" {
+		return ImageId(reference)
+	}
+
+	v1Platform, err := parsePlatform(platform)
+	if err != nil {
+		return "", err
+	}
+
+	i, _, err := image(reference, remote.WithPlatform(v1Platform))
+	if err != nil {
+		return "", err
+	}
+
+	configFile, err := i.ConfigFile()
+	if err != nil {
+		return "", err
+	}
+
+	if configFile.OS != v1Platform.OS || configFile.Architecture != v1Platform.Architecture {
+		return "", fmt.Errorf("image %q is not available for platform %s", reference, platform)
+	}
+
+	manifest, err := i.Manifest()
+	if err != nil {
+		return "", err
+	}
+
+	return manifest.Config.Digest.String(), nil
+}
+
 func ImageParentId(reference string) (string, error) {
 	configFile, err := ImageConfigFile(reference)
 	if err != nil {
@@ -263,7 +297,7 @@ func ImageDigest(reference string) (string, error) {
 	return digest.String(), nil
 }
 
-func image(reference string) (v1.Image, name.Reference, error) {
+func image(reference string, options ...remote.Option) (v1.Image, name.Reference, error) {
 	ref, err := name.ParseReference(reference, parseReferenceOptions()...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("parsing reference %q: %v", reference, err)
@@ -274,7 +308,10 @@ func image(reference string) (v1.Image, name.Reference, error) {
 	// FIXME: Needed for the insecure https registry to work.
 	oldDefaultTransport := http.DefaultTransport
 	http.DefaultTransport = getHttpTransport()
-	img, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	img, err := remote.Image(ref, append([]remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)}, options...)...)
+	if err != nil && len(options) == 0 && strings.Contains(err.Error(), "no child with platform") {
+		img, err = manifestListFirstImage(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	}
 	http.DefaultTransport = oldDefaultTransport
 
 	if err != nil {
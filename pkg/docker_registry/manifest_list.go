@@ -0,0 +1,137 @@
+package docker_registry
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/flant/werf/pkg/platform"
+)
+
+// AddToManifestList puts the platform image into the manifest list by the reference,
+// the manifest list entry of the same platform is replaced, other entries are kept.
+// The manifest list is created when the reference does not exist or points to an image
+func AddToManifestList(reference, platformImageReference, platform string) error {
+	v1Platform, err := parsePlatform(platform)
+	if err != nil {
+		return err
+	}
+
+	ref, err := name.ParseReference(reference, parseReferenceOptions()...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", reference, err)
+	}
+
+	platformImage, _, err := image(platformImageReference)
+	if err != nil {
+		return err
+	}
+
+	platformImageDigest, err := platformImage.Digest()
+	if err != nil {
+		return err
+	}
+
+	options := []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithTransport(getHttpTransport())}
+
+	var addenda []mutate.IndexAddendum
+
+	existingManifests, existingIndex, err := getManifestListManifests(ref, options...)
+	if err != nil {
+		return err
+	}
+
+	for _, desc := range existingManifests {
+		if desc.Platform != nil && isSamePlatform(*desc.Platform, v1Platform) {
+			if desc.Digest == platformImageDigest {
+				return nil
+			}
+
+			continue
+		}
+
+		img, err := existingIndex.Image(desc.Digest)
+		if err != nil {
+			return fmt.Errorf("reading manifest list %q entry %s: %v", ref, desc.Digest, err)
+		}
+
+		addenda = append(addenda, mutate.IndexAddendum{Add: img, Descriptor: desc})
+	}
+
+	addenda = append(addenda, mutate.IndexAddendum{
+		Add:        platformImage,
+		Descriptor: v1.Descriptor{Platform: &v1Platform},
+	})
+
+	index := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.DockerManifestList), addenda...)
+	if err := remote.WriteIndex(ref, index, options...); err != nil {
+		return fmt.Errorf("writing manifest list %q: %v", ref, err)
+	}
+
+	return nil
+}
+
+func getManifestListManifests(ref name.Reference, options ...remote.Option) ([]v1.Descriptor, v1.ImageIndex, error) {
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		if transportErr, ok := err.(*transport.Error); ok && transportErr.StatusCode == http.StatusNotFound {
+			return nil, nil, nil
+		}
+
+		return nil, nil, fmt.Errorf("reading %q: %v", ref, err)
+	}
+
+	switch desc.MediaType {
+	case types.DockerManifestList, types.OCIImageIndex:
+	default:
+		return nil, nil, nil
+	}
+
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading manifest list %q: %v", ref, err)
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading manifest list %q: %v", ref, err)
+	}
+
+	return indexManifest.Manifests, index, nil
+}
+
+// manifestListFirstImage returns the first image of the manifest list,
+// it is used when the manifest list does not contain the image of the default platform (linux/amd64)
+func manifestListFirstImage(ref name.Reference, options ...remote.Option) (v1.Image, error) {
+	manifests, index, err := getManifestListManifests(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("manifest list %q is empty", ref)
+	}
+
+	return index.Image(manifests[0].Digest)
+}
+
+func parsePlatform(p string) (v1.Platform, error) {
+	os, arch, variant, err := platform.Parse(p)
+	if err != nil {
+		return v1.Platform{}, err
+	}
+
+	return v1.Platform{OS: os, Architecture: arch, Variant: variant}, nil
+}
+
+func isSamePlatform(a, b v1.Platform) bool {
+	return a.OS == b.OS && a.Architecture == b.Architecture && a.Variant == b.Variant
+}
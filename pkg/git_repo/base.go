@@ -9,13 +9,10 @@ import (
 	"regexp"
 	"strings"
 
-	"gopkg.in/src-d/go-billy.v4/osfs"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
-	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
-	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 
 	"github.com/flant/logboek"
 	"github.com/flant/werf/pkg/git_repo/ls_tree"
@@ -234,8 +231,14 @@ func (repo *Base) createPatch(repoPath, gitDir, workTreeCacheDir string, opts Pa
 }
 
 func HasSubmodulesInCommit(commit *object.Commit) (bool, error) {
-	_, err := commit.File(".gitmodules")
-	if err == object.ErrFileNotFound {
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+
+	// The tree entry is checked instead of the file: blobs might be missing in partial clones
+	_, err = tree.FindEntry(".gitmodules")
+	if err == object.ErrEntryNotFound {
 		return false, nil
 	}
 	if err != nil {
@@ -293,6 +296,16 @@ func (repo *Base) createArchive(repoPath, gitDir, workTreeCacheDir string, opts
 		return nil, fmt.Errorf("error creating archive for commit `%s`: %s", opts.Commit, err)
 	}
 
+	if err := fileHandler.Close(); err != nil {
+		return nil, fmt.Errorf("cannot close archive file: %s", err)
+	}
+
+	if opts.WithLFS && !desc.IsEmpty {
+		if err := resolveArchiveLFSPointers(repository, gitDir, commit, archive.GetFilePath()); err != nil {
+			return nil, fmt.Errorf("error resolving lfs objects for commit `%s`: %s", opts.Commit, err)
+		}
+	}
+
 	archive.Descriptor = desc
 
 	return archive, nil
@@ -411,7 +424,7 @@ func (repo *Base) checksumWithLsTree(repoPath, gitDir, workTreeCacheDir string,
 	}
 
 	err = true_git.WithWorkTree(gitDir, workTreeCacheDir, opts.Commit, true_git.WithWorkTreeOptions{HasSubmodules: hasSubmodules}, func(worktreeDir string) error {
-		repositoryWithPreparedWorktree, err := GitOpenWithCustomWorktreeDir(gitDir, worktreeDir)
+		repositoryWithPreparedWorktree, err := true_git.OpenWorkTreeRepository(gitDir, worktreeDir, opts.Commit)
 		if err != nil {
 			return err
 		}
@@ -481,9 +494,3 @@ func (repo *Base) checksumWithLsTree(repoPath, gitDir, workTreeCacheDir string,
 
 	return checksum, nil
 }
-
-func GitOpenWithCustomWorktreeDir(gitDir string, worktreeDir string) (*git.Repository, error) {
-	worktreeFilesystem := osfs.New(worktreeDir)
-	storage := filesystem.NewStorage(osfs.New(gitDir), cache.NewObjectLRUDefault())
-	return git.Open(storage, worktreeFilesystem)
-}
@@ -19,6 +19,8 @@ type PatchOptions struct {
 type ArchiveOptions struct {
 	FilterOptions
 	Commit string
+	// WithLFS replaces Git LFS pointer files with the objects they point to
+	WithLFS bool
 }
 
 type ChecksumOptions struct {
@@ -64,6 +66,9 @@ type Patch interface {
 	HasBinary() bool
 	GetPaths() []string
 	GetBinaryPaths() []string
+	GetLFSPaths() []string
+	GetLFSOids() []string
+	GetLFSObjectsSize() int64
 }
 
 type Archive interface {
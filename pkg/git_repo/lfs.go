@@ -0,0 +1,706 @@
+package git_repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/logboek"
+	"gopkg.in/src-d/go-git.v4"
+	gitConfig "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/flant/werf/pkg/ssh_agent"
+	"github.com/flant/werf/pkg/true_git"
+)
+
+// lfsPointerMaxSize is the max size of Git LFS pointer files, bigger files are never pointers
+const lfsPointerMaxSize = 1024
+
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+var lfsOidRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+var lfsHttpTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	TLSHandshakeTimeout:   30 * time.Second,
+	ResponseHeaderTimeout: 60 * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+}
+
+// lfsBatchHttpClient is used for the batch API requests, lfsObjectHttpClient is used for the object downloads,
+// which may take a long time for big objects
+var (
+	lfsBatchHttpClient  = &http.Client{Transport: lfsHttpTransport, Timeout: 2 * time.Minute}
+	lfsObjectHttpClient = &http.Client{Transport: lfsHttpTransport, Timeout: 60 * time.Minute}
+)
+
+type lfsPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// parseLFSPointer returns nil if the data is not a Git LFS pointer file
+func parseLFSPointer(data []byte) *lfsPointer {
+	if len(data) > lfsPointerMaxSize || !bytes.HasPrefix(data, []byte(true_git.LFSPointerVersion+"\n")) {
+		return nil
+	}
+
+	pointer := &lfsPointer{Size: -1}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, true_git.LFSPointerOidPrefix):
+			pointer.Oid = strings.TrimPrefix(line, true_git.LFSPointerOidPrefix)
+		case strings.HasPrefix(line, true_git.LFSPointerSizePrefix):
+			size, err := strconv.ParseInt(strings.TrimPrefix(line, true_git.LFSPointerSizePrefix), 10, 64)
+			if err != nil {
+				return nil
+			}
+			pointer.Size = size
+		}
+	}
+
+	if !lfsOidRegexp.MatchString(pointer.Oid) || pointer.Size < 0 {
+		return nil
+	}
+
+	return pointer
+}
+
+// lfsObjectPath returns the path of the object in the Git LFS store of the repository
+func lfsObjectPath(gitDir, oid string) string {
+	return filepath.Join(gitDir, "lfs", "objects", oid[0:2], oid[2:4], oid)
+}
+
+func isLFSObjectExists(gitDir string, pointer *lfsPointer) (bool, error) {
+	stat, err := os.Stat(lfsObjectPath(gitDir, pointer.Oid))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("cannot access lfs object %s: %s", pointer.Oid, err)
+	}
+
+	return stat.Size() == pointer.Size, nil
+}
+
+// resolveArchiveLFSPointers replaces Git LFS pointer files of the archive with the objects they point to.
+// Objects are taken from the lfs store of the repository, missing objects are downloaded into the store.
+func resolveArchiveLFSPointers(repository *git.Repository, gitDir string, commit *object.Commit, archivePath string) error {
+	pointers, err := archiveLFSPointers(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	var missingPointers []*lfsPointer
+	for _, pointer := range pointers {
+		if exists, err := isLFSObjectExists(gitDir, pointer); err != nil {
+			return err
+		} else if !exists {
+			missingPointers = append(missingPointers, pointer)
+		}
+	}
+
+	if len(missingPointers) > 0 {
+		endpoint, err := lfsEndpoint(repository, commit)
+		if err != nil {
+			return err
+		}
+
+		if err := fetchLFSObjects(gitDir, endpoint, missingPointers); err != nil {
+			return err
+		}
+	}
+
+	return rewriteArchiveWithLFSObjects(gitDir, archivePath)
+}
+
+func archiveLFSPointers(archivePath string) (map[string]*lfsPointer, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive %s: %s", archivePath, err)
+	}
+	defer f.Close()
+
+	pointers := map[string]*lfsPointer{}
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read archive %s: %s", archivePath, err)
+		}
+
+		if header.Typeflag != tar.TypeReg || header.Size > lfsPointerMaxSize {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read archive %s: %s", archivePath, err)
+		}
+
+		if pointer := parseLFSPointer(data); pointer != nil {
+			pointers[pointer.Oid] = pointer
+		}
+	}
+
+	return pointers, nil
+}
+
+func rewriteArchiveWithLFSObjects(gitDir, archivePath string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("cannot open archive %s: %s", archivePath, err)
+	}
+	defer f.Close()
+
+	tmpArchivePath := archivePath + ".lfs"
+	tmpFile, err := os.Create(tmpArchivePath)
+	if err != nil {
+		return fmt.Errorf("cannot create archive %s: %s", tmpArchivePath, err)
+	}
+	defer os.RemoveAll(tmpArchivePath)
+	defer tmpFile.Close()
+
+	tr := tar.NewReader(f)
+	tw := tar.NewWriter(tmpFile)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("cannot read archive %s: %s", archivePath, err)
+		}
+
+		var pointer *lfsPointer
+		var data []byte
+		if header.Typeflag == tar.TypeReg && header.Size <= lfsPointerMaxSize {
+			data, err = ioutil.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("cannot read archive %s: %s", archivePath, err)
+			}
+			pointer = parseLFSPointer(data)
+		}
+
+		if pointer != nil {
+			logboek.Debug.LogF("Replacing lfs pointer %s with object %s\n", header.Name, pointer.Oid)
+			header.Size = pointer.Size
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("cannot write archive %s: %s", tmpArchivePath, err)
+		}
+
+		switch {
+		case pointer != nil:
+			if err := copyLFSObject(tw, gitDir, pointer); err != nil {
+				return err
+			}
+		case data != nil:
+			_, err = tw.Write(data)
+		default:
+			_, err = io.Copy(tw, tr)
+		}
+
+		if err != nil {
+			return fmt.Errorf("cannot write archive %s: %s", tmpArchivePath, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("cannot write archive %s: %s", tmpArchivePath, err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("cannot write archive %s: %s", tmpArchivePath, err)
+	}
+
+	if err := os.Rename(tmpArchivePath, archivePath); err != nil {
+		return fmt.Errorf("cannot rename %s to %s: %s", tmpArchivePath, archivePath, err)
+	}
+
+	return nil
+}
+
+func copyLFSObject(w io.Writer, gitDir string, pointer *lfsPointer) error {
+	objectPath := lfsObjectPath(gitDir, pointer.Oid)
+
+	f, err := os.Open(objectPath)
+	if err != nil {
+		return fmt.Errorf("cannot open lfs object %s: %s", pointer.Oid, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("cannot copy lfs object %s: %s", pointer.Oid, err)
+	}
+
+	return nil
+}
+
+type lfsEndpointDescriptor struct {
+	Url string
+	// Header is sent with the batch API requests instead of the url userinfo and the git credentials
+	Header map[string]string
+	// SSH is the ssh remote which provides Url and Header by git-lfs-authenticate command
+	SSH *lfsSSHEndpoint
+	// StoreDir is the lfs store of the local repository the objects are copied from instead of the download
+	StoreDir string
+}
+
+type lfsSSHEndpoint struct {
+	UserAndHost string
+	Port        string
+	Path        string
+}
+
+// lfsEndpoint resolves the Git LFS server the same way git-lfs does:
+// lfs.url and remote.origin.lfsurl options of the repository config and .lfsconfig of the commit,
+// otherwise the endpoint is derived from the origin url
+func lfsEndpoint(repository *git.Repository, commit *object.Commit) (*lfsEndpointDescriptor, error) {
+	cfg, err := repository.Config()
+	if err != nil {
+		return nil, fmt.Errorf("cannot access repo config: %s", err)
+	}
+
+	rawConfigs := []*gitConfig.Config{cfg.Raw}
+
+	if file, err := commit.File(".lfsconfig"); err == nil {
+		content, err := file.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read .lfsconfig of commit %s: %s", commit.Hash, err)
+		}
+
+		lfsConfig := gitConfig.New()
+		if err := gitConfig.NewDecoder(strings.NewReader(content)).Decode(lfsConfig); err != nil {
+			return nil, fmt.Errorf("cannot parse .lfsconfig of commit %s: %s", commit.Hash, err)
+		}
+
+		rawConfigs = append(rawConfigs, lfsConfig)
+	} else if err != object.ErrFileNotFound {
+		return nil, fmt.Errorf("cannot get .lfsconfig of commit %s: %s", commit.Hash, err)
+	}
+
+	for _, rawConfig := range rawConfigs {
+		if value := rawConfig.Section("lfs").Option("url"); value != "" {
+			return &lfsEndpointDescriptor{Url: value}, nil
+		}
+
+		if value := rawConfig.Section("remote").Subsection("origin").Option("lfsurl"); value != "" {
+			return &lfsEndpointDescriptor{Url: value}, nil
+		}
+	}
+
+	originCfg, hasKey := cfg.Remotes["origin"]
+	if !hasKey || len(originCfg.URLs) == 0 {
+		return nil, fmt.Errorf("cannot resolve lfs endpoint: neither lfs.url nor origin remote are configured")
+	}
+
+	return lfsEndpointByRemoteUrl(originCfg.URLs[0])
+}
+
+var scpLikeUrlRegexp = regexp.MustCompile(`^((?:[^@/]+@)?([^:/]+)):(.+)$`)
+
+func lfsEndpointByRemoteUrl(remoteUrl string) (*lfsEndpointDescriptor, error) {
+	var sshEndpoint *lfsSSHEndpoint
+	var host string
+
+	if u, err := url.Parse(remoteUrl); err == nil && u.Scheme != "" {
+		switch u.Scheme {
+		case "http", "https":
+			u.Path = strings.TrimSuffix(u.Path, "/")
+			if !strings.HasSuffix(u.Path, ".git") {
+				u.Path += ".git"
+			}
+			u.Path += "/info/lfs"
+			return &lfsEndpointDescriptor{Url: u.String()}, nil
+		case "ssh", "git+ssh", "ssh+git":
+			host = u.Hostname()
+			sshEndpoint = &lfsSSHEndpoint{UserAndHost: u.Hostname(), Port: u.Port(), Path: u.Path}
+			if u.User != nil {
+				sshEndpoint.UserAndHost = fmt.Sprintf("%s@%s", u.User.Username(), u.Hostname())
+			}
+		case "file":
+			return lfsEndpointByLocalPath(u.Path), nil
+		default:
+			return nil, fmt.Errorf("cannot resolve lfs endpoint for remote url %s: unsupported scheme %s", remoteUrl, u.Scheme)
+		}
+	} else if filepath.IsAbs(remoteUrl) {
+		return lfsEndpointByLocalPath(remoteUrl), nil
+	} else if match := scpLikeUrlRegexp.FindStringSubmatch(remoteUrl); match != nil {
+		host = match[2]
+		sshEndpoint = &lfsSSHEndpoint{UserAndHost: match[1], Path: match[3]}
+	} else {
+		return nil, fmt.Errorf("cannot resolve lfs endpoint for remote url %s", remoteUrl)
+	}
+
+	urlPath := strings.Trim(sshEndpoint.Path, "/")
+	if !strings.HasSuffix(urlPath, ".git") {
+		urlPath += ".git"
+	}
+
+	return &lfsEndpointDescriptor{Url: fmt.Sprintf("https://%s/%s/info/lfs", host, urlPath), SSH: sshEndpoint}, nil
+}
+
+type lfsSSHAuthenticateResponse struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// lfsSSHAuthenticate gets the endpoint url and the authorization header the same way git-lfs does for ssh remotes:
+// by git-lfs-authenticate command of the git server, ssh command is taken from GIT_SSH_COMMAND or GIT_SSH
+func lfsSSHAuthenticate(endpoint *lfsSSHEndpoint) (*lfsSSHAuthenticateResponse, error) {
+	var args []string
+	if endpoint.Port != "" {
+		args = append(args, "-p", endpoint.Port)
+	}
+	args = append(args, endpoint.UserAndHost, "git-lfs-authenticate", strings.TrimPrefix(endpoint.Path, "/"), "download")
+
+	var cmd *exec.Cmd
+	if sshCommand := os.Getenv("GIT_SSH_COMMAND"); sshCommand != "" {
+		cmd = exec.Command("sh", append([]string{"-c", sshCommand + ` "$@"`, sshCommand}, args...)...)
+	} else if sshCommand := os.Getenv("GIT_SSH"); sshCommand != "" {
+		cmd = exec.Command(sshCommand, args...)
+	} else {
+		cmd = exec.Command("ssh", append([]string{"-o", "BatchMode=yes"}, args...)...)
+	}
+
+	cmd.Env = os.Environ()
+	if ssh_agent.SSHAuthSock != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("SSH_AUTH_SOCK=%s", ssh_agent.SSHAuthSock))
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git-lfs-authenticate via ssh %s failed: %s: %s", endpoint.UserAndHost, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var res lfsSSHAuthenticateResponse
+	if err := json.Unmarshal(output, &res); err != nil {
+		return nil, fmt.Errorf("bad git-lfs-authenticate response from %s: %s", endpoint.UserAndHost, err)
+	}
+
+	return &res, nil
+}
+
+func lfsEndpointByLocalPath(repoPath string) *lfsEndpointDescriptor {
+	gitDir := repoPath
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err == nil {
+		gitDir = filepath.Join(repoPath, ".git")
+	}
+
+	return &lfsEndpointDescriptor{StoreDir: gitDir}
+}
+
+func fetchLFSObjects(gitDir string, endpoint *lfsEndpointDescriptor, pointers []*lfsPointer) error {
+	sort.Slice(pointers, func(i, j int) bool { return pointers[i].Oid < pointers[j].Oid })
+
+	if endpoint.StoreDir != "" {
+		for _, pointer := range pointers {
+			if err := copyLFSObjectFromStore(gitDir, endpoint.StoreDir, pointer); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if endpoint.SSH != nil {
+		if res, err := lfsSSHAuthenticate(endpoint.SSH); err != nil {
+			logboek.LogWarnF("WARNING: %s, using %s\n", err, endpoint.Url)
+		} else {
+			if res.Href != "" {
+				endpoint.Url = res.Href
+			}
+			endpoint.Header = res.Header
+		}
+	}
+
+	endpointName := endpoint.Url
+	if u, err := url.Parse(endpoint.Url); err == nil {
+		u.User = nil
+		endpointName = u.String()
+	}
+
+	return logboek.Default.LogProcess(fmt.Sprintf("Downloading %d lfs objects from %s", len(pointers), endpointName), logboek.LevelLogProcessOptions{}, func() error {
+		return downloadLFSObjects(gitDir, endpoint, pointers)
+	})
+}
+
+func copyLFSObjectFromStore(gitDir, storeDir string, pointer *lfsPointer) error {
+	f, err := os.Open(lfsObjectPath(storeDir, pointer.Oid))
+	if err != nil {
+		return fmt.Errorf("lfs object %s not found in %s: %s", pointer.Oid, storeDir, err)
+	}
+	defer f.Close()
+
+	return saveLFSObject(gitDir, pointer, f)
+}
+
+type lfsBatchRequest struct {
+	Operation string        `json:"operation"`
+	Transfers []string      `json:"transfers"`
+	Objects   []*lfsPointer `json:"objects"`
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		lfsPointer
+		Actions struct {
+			Download *struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// downloadLFSObjects downloads objects using the Git LFS batch API and the basic transfer adapter
+func downloadLFSObjects(gitDir string, endpointDesc *lfsEndpointDescriptor, pointers []*lfsPointer) error {
+	endpoint, err := url.Parse(endpointDesc.Url)
+	if err != nil {
+		return fmt.Errorf("bad lfs endpoint %s: %s", endpointDesc.Url, err)
+	}
+
+	userinfo := endpoint.User
+	endpoint.User = nil
+
+	body, err := json.Marshal(lfsBatchRequest{Operation: "download", Transfers: []string{"basic"}, Objects: pointers})
+	if err != nil {
+		return err
+	}
+
+	batchUrl := strings.TrimSuffix(endpoint.String(), "/") + "/objects/batch"
+	doBatchRequest := func(userinfo *url.Userinfo) (*http.Response, error) {
+		req, err := http.NewRequest("POST", batchUrl, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", lfsMediaType)
+		req.Header.Set("Content-Type", lfsMediaType)
+		setLFSRequestAuth(req, endpointDesc.Header, userinfo)
+
+		resp, err := lfsBatchHttpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("lfs batch request to %s failed: %s", endpoint, err)
+		}
+
+		return resp, nil
+	}
+
+	resp, err := doBatchRequest(userinfo)
+	if err != nil {
+		return err
+	}
+	defer func() { resp.Body.Close() }()
+
+	// the server requires credentials which are not specified in the url, so that the git credential helpers are asked the same way git-lfs does
+	if resp.StatusCode == http.StatusUnauthorized && userinfo == nil && len(endpointDesc.Header) == 0 {
+		if credentials, err := gitCredentialFill(endpoint); err != nil {
+			logboek.Info.LogF("Cannot get git credentials for %s: %s\n", endpoint, err)
+		} else {
+			resp.Body.Close()
+
+			userinfo = credentials
+			if resp, err = doBatchRequest(userinfo); err != nil {
+				return err
+			}
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("lfs batch request to %s failed: %s: %s", endpoint, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var batchResponse lfsBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batchResponse); err != nil {
+		return fmt.Errorf("bad lfs batch response from %s: %s", endpoint, err)
+	}
+
+	pointerByOid := map[string]*lfsPointer{}
+	for _, pointer := range pointers {
+		pointerByOid[pointer.Oid] = pointer
+	}
+
+	for _, obj := range batchResponse.Objects {
+		pointer, isRequested := pointerByOid[obj.Oid]
+		if !isRequested {
+			continue
+		}
+
+		if obj.Error != nil {
+			return fmt.Errorf("cannot download lfs object %s: %d %s", obj.Oid, obj.Error.Code, obj.Error.Message)
+		}
+
+		if obj.Actions.Download == nil {
+			return fmt.Errorf("cannot download lfs object %s: no download action in lfs batch response", obj.Oid)
+		}
+
+		logboek.Info.LogF("Downloading lfs object %s (%d bytes)\n", pointer.Oid, pointer.Size)
+
+		if err := downloadLFSObject(gitDir, pointer, obj.Actions.Download.Href, obj.Actions.Download.Header, endpointDesc.Header, userinfo); err != nil {
+			return err
+		}
+	}
+
+	for _, pointer := range pointers {
+		if exists, err := isLFSObjectExists(gitDir, pointer); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("lfs object %s is missing in lfs batch response from %s", pointer.Oid, endpoint)
+		}
+	}
+
+	return nil
+}
+
+func downloadLFSObject(gitDir string, pointer *lfsPointer, href string, header, endpointHeader map[string]string, userinfo *url.Userinfo) error {
+	req, err := http.NewRequest("GET", href, nil)
+	if err != nil {
+		return fmt.Errorf("bad lfs object %s href %s: %s", pointer.Oid, href, err)
+	}
+
+	if len(header) > 0 {
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+	} else {
+		setLFSRequestAuth(req, endpointHeader, userinfo)
+	}
+
+	resp, err := lfsObjectHttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot download lfs object %s: %s", pointer.Oid, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot download lfs object %s: %s", pointer.Oid, resp.Status)
+	}
+
+	return saveLFSObject(gitDir, pointer, resp.Body)
+}
+
+func setLFSRequestAuth(req *http.Request, header map[string]string, userinfo *url.Userinfo) {
+	if len(header) > 0 {
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+
+		return
+	}
+
+	if userinfo == nil {
+		return
+	}
+
+	password, _ := userinfo.Password()
+	req.SetBasicAuth(userinfo.Username(), password)
+}
+
+// gitCredentialFill gets the credentials for the url from the git credential helpers without prompting
+func gitCredentialFill(u *url.URL) (*url.Userinfo, error) {
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git credential fill failed: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var username, password string
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(line, "username="):
+			username = strings.TrimPrefix(line, "username=")
+		case strings.HasPrefix(line, "password="):
+			password = strings.TrimPrefix(line, "password=")
+		}
+	}
+
+	if username == "" && password == "" {
+		return nil, fmt.Errorf("no credentials found")
+	}
+
+	return url.UserPassword(username, password), nil
+}
+
+// saveLFSObject verifies the object content and puts it into the lfs store of the repository
+func saveLFSObject(gitDir string, pointer *lfsPointer, r io.Reader) error {
+	objectPath := lfsObjectPath(gitDir, pointer.Oid)
+	if err := os.MkdirAll(filepath.Dir(objectPath), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create dir %s: %s", filepath.Dir(objectPath), err)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(objectPath), pointer.Oid)
+	if err != nil {
+		return fmt.Errorf("unable to create tmp file for lfs object %s: %s", pointer.Oid, err)
+	}
+	defer os.RemoveAll(tmpFile.Name())
+	defer tmpFile.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hash), r)
+	if err != nil {
+		return fmt.Errorf("cannot save lfs object %s: %s", pointer.Oid, err)
+	}
+
+	if oid := hex.EncodeToString(hash.Sum(nil)); oid != pointer.Oid || size != pointer.Size {
+		return fmt.Errorf("bad lfs object %s: got object %s of %d bytes, expected %d bytes", pointer.Oid, oid, size, pointer.Size)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("cannot save lfs object %s: %s", pointer.Oid, err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), objectPath); err != nil {
+		return fmt.Errorf("cannot save lfs object %s: %s", pointer.Oid, err)
+	}
+
+	return nil
+}
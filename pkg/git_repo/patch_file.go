@@ -38,3 +38,15 @@ func (p *PatchFile) GetPaths() []string {
 func (p *PatchFile) GetBinaryPaths() []string {
 	return p.Descriptor.BinaryPaths
 }
+
+func (p *PatchFile) GetLFSPaths() []string {
+	return p.Descriptor.LFSPaths
+}
+
+func (p *PatchFile) GetLFSOids() []string {
+	return p.Descriptor.LFSOids
+}
+
+func (p *PatchFile) GetLFSObjectsSize() int64 {
+	return p.Descriptor.LFSObjectsSize
+}
@@ -2,11 +2,14 @@ package git_repo
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/flant/werf/pkg/true_git"
+	"github.com/flant/werf/pkg/werf"
 
 	"github.com/flant/werf/pkg/slug"
 
@@ -20,10 +23,16 @@ import (
 	"github.com/flant/shluz"
 )
 
+// remoteCloneDepth is the initial depth of shallow clones, the history is deepened on demand
+const remoteCloneDepth = 50
+
 type Remote struct {
 	Base
 	Url      string
 	IsDryRun bool
+
+	// Paths limits the work tree of the partial clone to the paths used by git mappings, empty paths mean the whole tree
+	Paths []string
 }
 
 func (repo *Remote) GetClonePath() string {
@@ -47,7 +56,39 @@ func (repo *Remote) IsEmpty() (bool, error) {
 }
 
 func (repo *Remote) IsAncestor(ancestorCommit, descendantCommit string) (bool, error) {
-	return true_git.IsAncestor(ancestorCommit, descendantCommit, repo.GetClonePath())
+	shallowCommits, err := true_git.ShallowCommits(repo.GetClonePath())
+	if err != nil {
+		return false, err
+	}
+
+	if len(shallowCommits) == 0 {
+		return true_git.IsAncestor(ancestorCommit, descendantCommit, repo.GetClonePath())
+	}
+
+	for _, commit := range []string{ancestorCommit, descendantCommit} {
+		if exist, err := repo.IsCommitExists(commit); err != nil {
+			return false, err
+		} else if !exist {
+			return false, nil
+		}
+	}
+
+	for {
+		isAncestor, isHistoryComplete, err := isAncestorInShallowClone(repo.GetClonePath(), ancestorCommit, descendantCommit)
+		if err != nil {
+			return false, err
+		}
+
+		if isAncestor || isHistoryComplete {
+			return isAncestor, nil
+		}
+
+		if isDeepened, err := repo.deepen(); err != nil {
+			return false, err
+		} else if !isDeepened {
+			return false, nil
+		}
+	}
 }
 
 func (repo *Remote) CloneAndFetch() error {
@@ -55,11 +96,14 @@ func (repo *Remote) CloneAndFetch() error {
 	if err != nil {
 		return err
 	}
-	if isCloned {
-		return nil
+
+	if !isCloned {
+		if err := repo.Fetch(); err != nil {
+			return err
+		}
 	}
 
-	return repo.Fetch()
+	return repo.updateLastUsedAt()
 }
 
 func (repo *Remote) isCloneExists() (bool, error) {
@@ -87,7 +131,11 @@ func (repo *Remote) Clone() (bool, error) {
 		return false, err
 	}
 	if exists {
-		return false, nil
+		if isManaged, err := repo.isManagedClone(); err != nil {
+			return false, err
+		} else if !isManaged || true_git.IsPartialCloneSupported() {
+			return false, nil
+		}
 	}
 
 	return true, repo.withRemoteRepoLock(func() error {
@@ -96,7 +144,20 @@ func (repo *Remote) Clone() (bool, error) {
 			return err
 		}
 		if exists {
-			return nil
+			isManaged, err := repo.isManagedClone()
+			if err != nil {
+				return err
+			}
+
+			if !isManaged || true_git.IsPartialCloneSupported() {
+				return nil
+			}
+
+			logboek.Default.LogFDetails("Remove partial clone %s: it requires git backend and git >= %s\n", repo.GetClonePath(), true_git.MinGitVersionWithPartialCloneConstraintValue)
+
+			if err := os.RemoveAll(repo.GetClonePath()); err != nil {
+				return fmt.Errorf("unable to remove %s: %s", repo.GetClonePath(), err)
+			}
 		}
 
 		logboek.Default.LogFDetails("Clone %s\n", repo.Url)
@@ -113,12 +174,22 @@ func (repo *Remote) Clone() (bool, error) {
 		// Ensure cleanup on failure
 		defer os.RemoveAll(tmpPath)
 
-		_, err = git.PlainClone(tmpPath, true, &git.CloneOptions{
-			URL:               repo.Url,
-			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-		})
-		if err != nil {
-			return err
+		if true_git.IsPartialCloneSupported() {
+			if err := true_git.Clone(repo.Url, tmpPath, true_git.CloneOptions{Depth: remoteCloneDepth, WithoutBlobs: true}); err != nil {
+				return err
+			}
+
+			if err := setManagedCloneDepth(tmpPath, remoteCloneDepth); err != nil {
+				return err
+			}
+		} else {
+			_, err = git.PlainClone(tmpPath, true, &git.CloneOptions{
+				URL:               repo.Url,
+				RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+			})
+			if err != nil {
+				return err
+			}
 		}
 
 		if err := os.Rename(tmpPath, repo.GetClonePath()); err != nil {
@@ -152,14 +223,32 @@ func (repo *Remote) Fetch() error {
 		}
 	}
 
+	isManaged, err := repo.isManagedClone()
+	if err != nil {
+		return err
+	}
+
 	return repo.withRemoteRepoLock(func() error {
+		logboek.Default.LogFDetails("Fetch remote %s of %s\n", remoteName, repo.Url)
+
+		if isManaged {
+			depth, err := getManagedCloneDepth(repo.GetClonePath())
+			if err != nil {
+				return err
+			}
+
+			if err := true_git.Fetch(repo.GetClonePath(), true_git.FetchOptions{Depth: depth}); err != nil {
+				return fmt.Errorf("cannot fetch remote `%s` of repo `%s`: %s", remoteName, repo.String(), err)
+			}
+
+			return nil
+		}
+
 		rawRepo, err := git.PlainOpen(repo.GetClonePath())
 		if err != nil {
 			return fmt.Errorf("cannot open repo: %s", err)
 		}
 
-		logboek.Default.LogFDetails("Fetch remote %s of %s\n", remoteName, repo.Url)
-
 		err = rawRepo.Fetch(&git.FetchOptions{RemoteName: remoteName, Force: true, Tags: git.AllTags})
 		if err != nil && err != git.NoErrAlreadyUpToDate {
 			return fmt.Errorf("cannot fetch remote `%s` of repo `%s`: %s", remoteName, repo.String(), err)
@@ -271,42 +360,215 @@ func (repo *Remote) TagCommit(tag string) (string, error) {
 	return res, nil
 }
 
-func (repo *Remote) CreatePatch(opts PatchOptions) (Patch, error) {
-	workTreeDir, err := repo.getWorkTreeDir()
+func (repo *Remote) CreatePatch(opts PatchOptions) (patch Patch, err error) {
+	err = repo.withWorkTreeUsage([]string{opts.FromCommit, opts.ToCommit}, func(workTreeDir string) error {
+		patch, err = repo.createPatch(repo.GetClonePath(), repo.GetClonePath(), workTreeDir, opts)
+		return err
+	})
+
+	return
+}
+
+func (repo *Remote) CreateArchive(opts ArchiveOptions) (archive Archive, err error) {
+	err = repo.withWorkTreeUsage([]string{opts.Commit}, func(workTreeDir string) error {
+		archive, err = repo.createArchive(repo.GetClonePath(), repo.GetClonePath(), workTreeDir, opts)
+		return err
+	})
+
+	return
+}
+
+func (repo *Remote) Checksum(opts ChecksumOptions) (checksum Checksum, err error) {
+	err = repo.withWorkTreeUsage([]string{opts.Commit}, func(workTreeDir string) error {
+		_ = logboek.Debug.LogProcess(
+			"Calculating checksum",
+			logboek.LevelLogProcessOptions{},
+			func() error {
+				checksum, err = repo.checksumWithLsTree(repo.GetClonePath(), repo.GetClonePath(), workTreeDir, opts)
+				return nil
+			},
+		)
+
+		return err
+	})
+
+	return
+}
+
+func (repo *Remote) IsCommitExists(commit string) (bool, error) {
+	exist, err := repo.isCommitExists(repo.GetClonePath(), repo.GetClonePath(), commit)
+	if err != nil || exist {
+		return exist, err
+	}
+
+	shallowCommits, err := true_git.ShallowCommits(repo.GetClonePath())
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	return repo.createPatch(repo.GetClonePath(), repo.GetClonePath(), workTreeDir, opts)
+
+	if len(shallowCommits) == 0 || repo.IsDryRun {
+		return false, nil
+	}
+
+	// The commit might be older than the history of the shallow clone
+	if err := repo.withRemoteRepoLock(func() error {
+		logboek.Default.LogFDetails("Fetch commit %s of %s\n", commit, repo.Url)
+		return true_git.Fetch(repo.GetClonePath(), true_git.FetchOptions{Depth: 1, Commit: commit})
+	}); err != nil {
+		logboek.Info.LogFDetails("Cannot fetch commit %s of %s: %s\n", commit, repo.Url, err)
+	}
+
+	return repo.isCommitExists(repo.GetClonePath(), repo.GetClonePath(), commit)
 }
 
-func (repo *Remote) CreateArchive(opts ArchiveOptions) (Archive, error) {
-	workTreeDir, err := repo.getWorkTreeDir()
-	if err != nil {
-		return nil, err
+// ensureCommitExists deepens the history of the shallow clone until the commit is found:
+// the server might not allow to fetch the commit itself
+func (repo *Remote) ensureCommitExists(commit string) error {
+	for {
+		if exist, err := repo.IsCommitExists(commit); err != nil {
+			return err
+		} else if exist {
+			return nil
+		}
+
+		if isDeepened, err := repo.deepen(); err != nil {
+			return err
+		} else if !isDeepened {
+			return fmt.Errorf("commit `%s` not found in repo `%s`", commit, repo.String())
+		}
 	}
-	return repo.createArchive(repo.GetClonePath(), repo.GetClonePath(), workTreeDir, opts)
 }
 
-func (repo *Remote) Checksum(opts ChecksumOptions) (checksum Checksum, err error) {
+// deepen doubles the history depth of the shallow clone, false result means that the clone already has the whole history
+func (repo *Remote) deepen() (bool, error) {
+	isManaged, err := repo.isManagedClone()
+	if err != nil || !isManaged {
+		return false, err
+	}
+
+	var isDeepened bool
+	err = repo.withRemoteRepoLock(func() error {
+		depth, err := getManagedCloneDepth(repo.GetClonePath())
+		if err != nil {
+			return err
+		}
+
+		shallowCommits, err := true_git.ShallowCommits(repo.GetClonePath())
+		if err != nil {
+			return err
+		}
+
+		if depth == 0 || len(shallowCommits) == 0 {
+			return setManagedCloneDepth(repo.GetClonePath(), 0)
+		}
+
+		depth *= 2
+		logboek.Default.LogFDetails("Deepen %s history to %d commits\n", repo.Url, depth)
+
+		if err := true_git.Fetch(repo.GetClonePath(), true_git.FetchOptions{Depth: depth}); err != nil {
+			return fmt.Errorf("cannot deepen repo `%s`: %s", repo.String(), err)
+		}
+
+		newShallowCommits, err := true_git.ShallowCommits(repo.GetClonePath())
+		if err != nil {
+			return err
+		}
+
+		if len(newShallowCommits) == 0 {
+			depth = 0
+		}
+
+		// Commits fetched separately stay shallow if they are not reachable from branches
+		isDeepened = strings.Join(newShallowCommits, " ") != strings.Join(shallowCommits, " ")
+
+		return setManagedCloneDepth(repo.GetClonePath(), depth)
+	})
+
+	return isDeepened, err
+}
+
+// withWorkTreeUsage ensures that the commits are fetched and the work tree paths are up to date,
+// the paths are not changed by other werf processes until the function is done
+func (repo *Remote) withWorkTreeUsage(commits []string, f func(workTreeDir string) error) error {
+	for _, commit := range commits {
+		if err := repo.ensureCommitExists(commit); err != nil {
+			return err
+		}
+	}
+
 	workTreeDir, err := repo.getWorkTreeDir()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	_ = logboek.Debug.LogProcess(
-		"Calculating checksum",
-		logboek.LevelLogProcessOptions{},
-		func() error {
-			checksum, err = repo.checksumWithLsTree(repo.GetClonePath(), repo.GetClonePath(), workTreeDir, opts)
-			return nil
-		},
-	)
+	if isManaged, err := repo.isManagedClone(); err != nil {
+		return err
+	} else if !isManaged {
+		return f(workTreeDir)
+	}
 
-	return
+	return repo.withSparseCheckoutPaths(func() error {
+		return f(workTreeDir)
+	})
 }
 
-func (repo *Remote) IsCommitExists(commit string) (bool, error) {
-	return repo.isCommitExists(repo.GetClonePath(), repo.GetClonePath(), commit)
+// withSparseCheckoutPaths runs the function while the sparse checkout of the shared clone is limited to the repo paths:
+// processes with the same paths share the lock, the paths are changed only when no one uses the clone
+func (repo *Remote) withSparseCheckoutPaths(f func() error) error {
+	lockName := fmt.Sprintf("remote_git_mapping_sparse_checkout.%s", repo.Name)
+
+	for {
+		var isUpToDate bool
+		if err := werf.WithHostLock(lockName, shluz.LockOptions{Timeout: 600 * time.Second, ReadOnly: true}, func() error {
+			var err error
+			isUpToDate, err = true_git.IsSparseCheckoutPathsUpToDate(repo.GetClonePath(), repo.Paths)
+			if err != nil || !isUpToDate {
+				return err
+			}
+
+			return f()
+		}); err != nil || isUpToDate {
+			return err
+		}
+
+		if err := werf.WithHostLock(lockName, shluz.LockOptions{Timeout: 600 * time.Second}, func() error {
+			return repo.withRemoteRepoLock(func() error {
+				return true_git.SetSparseCheckoutPaths(repo.GetClonePath(), repo.Paths)
+			})
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// isManagedClone reports whether the clone is the shallow partial clone which history is deepened on demand
+func (repo *Remote) isManagedClone() (bool, error) {
+	cfgPath := filepath.Join(repo.GetClonePath(), "config")
+	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to access %s: %s", cfgPath, err)
+	}
+
+	cfg, err := ini.Load(cfgPath)
+	if err != nil {
+		return false, fmt.Errorf("cannot load repo `%s` config: %s", repo.String(), err)
+	}
+
+	return cfg.Section("werf").HasKey("depth"), nil
+}
+
+func (repo *Remote) updateLastUsedAt() error {
+	if repo.IsDryRun {
+		return nil
+	}
+
+	path := filepath.Join(repo.GetClonePath(), remoteCloneLastUsedAtFile)
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", time.Now().Unix())), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %s", path, err)
+	}
+
+	return nil
 }
 
 func (repo *Remote) getWorkTreeDir() (string, error) {
@@ -320,7 +582,7 @@ func (repo *Remote) getWorkTreeDir() (string, error) {
 
 func (repo *Remote) withRemoteRepoLock(f func() error) error {
 	lockName := fmt.Sprintf("remote_git_mapping.%s", repo.Name)
-	return shluz.WithLock(lockName, shluz.LockOptions{Timeout: 600 * time.Second}, f)
+	return werf.WithHostLock(lockName, shluz.LockOptions{Timeout: 600 * time.Second}, f)
 }
 
 func (repo *Remote) TagsList() ([]string, error) {
@@ -0,0 +1,218 @@
+package git_repo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"github.com/flant/werf/pkg/true_git"
+)
+
+const (
+	remoteCloneLastUsedAtFile = "werf_last_used_at"
+
+	// commitTimeSlop is the tolerated clock skew between committers
+	commitTimeSlop = 24 * time.Hour
+)
+
+type RemoteCloneStats struct {
+	Url        string
+	Path       string
+	Size       int64
+	LastUsedAt time.Time
+	// Depth is the history depth of the shallow clone, 0 means the whole history
+	Depth     int
+	IsPartial bool
+}
+
+// GetRemoteClonesStats returns stats of remote repositories clones in the git repos cache sorted by the last usage time
+func GetRemoteClonesStats() ([]*RemoteCloneStats, error) {
+	remoteDir := filepath.Join(GetGitRepoCacheDir(), "remote")
+
+	infos, err := ioutil.ReadDir(remoteDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading dir %s: %s", remoteDir, err)
+	}
+
+	var res []*RemoteCloneStats
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			continue
+		}
+
+		stats, err := getRemoteCloneStats(filepath.Join(remoteDir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, stats)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastUsedAt.Before(res[j].LastUsedAt)
+	})
+
+	return res, nil
+}
+
+func getRemoteCloneStats(clonePath string) (*RemoteCloneStats, error) {
+	stats := &RemoteCloneStats{Path: clonePath}
+
+	cfgPath := filepath.Join(clonePath, "config")
+	cfg, err := ini.Load(cfgPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load repo %s config: %s", clonePath, err)
+	}
+
+	stats.Url = cfg.Section("remote \"origin\"").Key("url").String()
+	stats.IsPartial = cfg.Section("remote \"origin\"").Key("promisor").MustBool(false)
+
+	shallowCommits, err := true_git.ShallowCommits(clonePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(shallowCommits) != 0 {
+		if stats.Depth, err = getManagedCloneDepth(clonePath); err != nil {
+			return nil, err
+		}
+	}
+
+	lastUsedAtPath := filepath.Join(clonePath, remoteCloneLastUsedAtFile)
+	if data, err := ioutil.ReadFile(lastUsedAtPath); err == nil {
+		timestamp, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad timestamp in %s: %s", lastUsedAtPath, err)
+		}
+		stats.LastUsedAt = time.Unix(timestamp, 0)
+	} else if os.IsNotExist(err) {
+		// Clones made before the last usage time was recorded
+		info, err := os.Stat(cfgPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to access %s: %s", cfgPath, err)
+		}
+		stats.LastUsedAt = info.ModTime()
+	} else {
+		return nil, fmt.Errorf("error reading %s: %s", lastUsedAtPath, err)
+	}
+
+	if err := filepath.Walk(clonePath, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			stats.Size += info.Size()
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to calculate %s size: %s", clonePath, err)
+	}
+
+	return stats, nil
+}
+
+func getManagedCloneDepth(clonePath string) (int, error) {
+	cfgPath := filepath.Join(clonePath, "config")
+
+	cfg, err := ini.Load(cfgPath)
+	if err != nil {
+		return 0, fmt.Errorf("cannot load repo %s config: %s", clonePath, err)
+	}
+
+	depth, err := cfg.Section("werf").Key("depth").Int()
+	if err != nil {
+		return 0, fmt.Errorf("bad werf.depth in repo %s config: %s", clonePath, err)
+	}
+
+	return depth, nil
+}
+
+func setManagedCloneDepth(clonePath string, depth int) error {
+	cfgPath := filepath.Join(clonePath, "config")
+
+	cfg, err := ini.Load(cfgPath)
+	if err != nil {
+		return fmt.Errorf("cannot load repo %s config: %s", clonePath, err)
+	}
+
+	cfg.Section("werf").Key("depth").SetValue(strconv.Itoa(depth))
+
+	if err := cfg.SaveTo(cfgPath); err != nil {
+		return fmt.Errorf("cannot save repo %s config: %s", clonePath, err)
+	}
+
+	return nil
+}
+
+// isAncestorInShallowClone walks the history of the descendant commit down to the ancestor commit date,
+// the history is not complete if the walk reaches commits which parents are not fetched
+func isAncestorInShallowClone(clonePath, ancestorCommit, descendantCommit string) (isAncestor bool, isHistoryComplete bool, err error) {
+	repository, err := git.PlainOpen(clonePath)
+	if err != nil {
+		return false, false, fmt.Errorf("cannot open repo %s: %s", clonePath, err)
+	}
+
+	shallowHashes, err := repository.Storer.Shallow()
+	if err != nil {
+		return false, false, fmt.Errorf("cannot get repo %s shallow commits: %s", clonePath, err)
+	}
+
+	isShallow := map[plumbing.Hash]bool{}
+	for _, hash := range shallowHashes {
+		isShallow[hash] = true
+	}
+
+	ancestor, err := repository.CommitObject(plumbing.NewHash(ancestorCommit))
+	if err != nil {
+		return false, false, fmt.Errorf("bad commit `%s`: %s", ancestorCommit, err)
+	}
+	minCommitTime := ancestor.Committer.When.Add(-commitTimeSlop)
+
+	isHistoryComplete = true
+	visited := map[plumbing.Hash]bool{}
+	queue := []plumbing.Hash{plumbing.NewHash(descendantCommit)}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+
+		if visited[hash] {
+			continue
+		}
+		visited[hash] = true
+
+		if hash == ancestor.Hash {
+			return true, true, nil
+		}
+
+		commit, err := repository.CommitObject(hash)
+		if err != nil {
+			return false, false, fmt.Errorf("bad commit `%s`: %s", hash, err)
+		}
+
+		if commit.Committer.When.Before(minCommitTime) {
+			continue
+		}
+
+		if isShallow[hash] {
+			isHistoryComplete = false
+			continue
+		}
+
+		queue = append(queue, commit.ParentHashes...)
+	}
+
+	return false, isHistoryComplete, nil
+}
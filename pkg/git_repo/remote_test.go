@@ -0,0 +1,210 @@
+package git_repo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/true_git"
+	"github.com/flant/werf/pkg/werf"
+)
+
+func runTestGit(t *testing.T, dir string, env []string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, output)
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+func testCommitEnv(n int) []string {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(n) * time.Hour).Format(time.RFC3339)
+	return []string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}
+}
+
+// prepareTestRemote creates the origin repository with the history longer than the initial shallow clone depth:
+// master has the commits and side branch is forked from the second commit
+func prepareTestRemote(t *testing.T, commitsNumber int) (*Remote, []string, string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary is required")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "werf-git-repo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreEnv := setTestEnv(t, map[string]string{
+		"HOME":                tmpDir,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_AUTHOR_NAME":     "werf",
+		"GIT_AUTHOR_EMAIL":    "werf@example.com",
+		"GIT_COMMITTER_NAME":  "werf",
+		"GIT_COMMITTER_EMAIL": "werf@example.com",
+		"WERF_GIT_BACKEND":    "",
+	})
+
+	cleanup := func() {
+		restoreEnv()
+		_ = os.RemoveAll(tmpDir)
+	}
+
+	if err := werf.Init(filepath.Join(tmpDir, "tmp"), filepath.Join(tmpDir, "home")); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	if err := shluz.Init(filepath.Join(tmpDir, "locks")); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	if err := true_git.Init(true_git.Options{Out: ioutil.Discard, Err: ioutil.Discard}); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	if !true_git.IsPartialCloneSupported() {
+		cleanup()
+		t.Skipf("git >= %s is required", true_git.MinGitVersionWithPartialCloneConstraintValue)
+	}
+
+	originDir := filepath.Join(tmpDir, "origin")
+	runTestGit(t, tmpDir, nil, "init", "-q", originDir)
+	runTestGit(t, originDir, nil, "config", "uploadpack.allowFilter", "true")
+
+	var commits []string
+	for i := 0; i < commitsNumber; i++ {
+		if err := ioutil.WriteFile(filepath.Join(originDir, fmt.Sprintf("file%d", i%3)), []byte(fmt.Sprintf("%d\n", i)), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		runTestGit(t, originDir, nil, "add", "-A")
+		runTestGit(t, originDir, testCommitEnv(i), "commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+		commits = append(commits, runTestGit(t, originDir, nil, "rev-parse", "HEAD"))
+	}
+
+	runTestGit(t, originDir, nil, "checkout", "-q", "-b", "side", commits[1])
+	runTestGit(t, originDir, testCommitEnv(commitsNumber), "commit", "-q", "--allow-empty", "-m", "side")
+	sideCommit := runTestGit(t, originDir, nil, "rev-parse", "HEAD")
+	runTestGit(t, originDir, nil, "checkout", "-q", "master")
+
+	repo := &Remote{Base: Base{Name: "origin"}, Url: "file://" + originDir}
+	if _, err := repo.Clone(); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return repo, commits, sideCommit, cleanup
+}
+
+func TestRemote_IsAncestorDeepensShallowClone(t *testing.T) {
+	repo, commits, sideCommit, cleanup := prepareTestRemote(t, remoteCloneDepth*2+10)
+	defer cleanup()
+
+	if shallowCommits, err := true_git.ShallowCommits(repo.GetClonePath()); err != nil {
+		t.Fatal(err)
+	} else if len(shallowCommits) == 0 {
+		t.Fatalf("expected the shallow clone")
+	}
+
+	tests := []struct {
+		name                             string
+		ancestorCommit, descendantCommit string
+		expected                         bool
+	}{
+		{name: "recent ancestor", ancestorCommit: commits[len(commits)-2], descendantCommit: commits[len(commits)-1], expected: true},
+		{name: "ancestor out of the shallow history", ancestorCommit: commits[0], descendantCommit: commits[len(commits)-1], expected: true},
+		{name: "descendant", ancestorCommit: commits[len(commits)-1], descendantCommit: commits[0], expected: false},
+		{name: "forked branch", ancestorCommit: sideCommit, descendantCommit: commits[len(commits)-1], expected: false},
+		{name: "fork point", ancestorCommit: commits[1], descendantCommit: sideCommit, expected: true},
+	}
+
+	for _, test := range tests {
+		isAncestor, err := repo.IsAncestor(test.ancestorCommit, test.descendantCommit)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if isAncestor != test.expected {
+			t.Errorf("%s:\n[EXPECTED]: %v\n[GOT]: %v", test.name, test.expected, isAncestor)
+		}
+	}
+
+	depth, err := getManagedCloneDepth(repo.GetClonePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shallowCommits, err := true_git.ShallowCommits(repo.GetClonePath()); err != nil {
+		t.Fatal(err)
+	} else if depth != 0 || len(shallowCommits) != 0 {
+		t.Errorf("expected the whole history to be fetched, got depth %d and shallow commits %v", depth, shallowCommits)
+	}
+}
+
+func TestRemote_withSparseCheckoutPaths(t *testing.T) {
+	repo, _, _, cleanup := prepareTestRemote(t, 3)
+	defer cleanup()
+
+	repoA := &Remote{Base: repo.Base, Url: repo.Url, Paths: []string{"file0"}}
+	repoB := &Remote{Base: repo.Base, Url: repo.Url, Paths: []string{"file1"}}
+
+	var mutex sync.Mutex
+	var events []string
+	addEvent := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+
+	use := func(r *Remote, name string, started chan struct{}) error {
+		return r.withSparseCheckoutPaths(func() error {
+			addEvent(name + " start")
+			if started != nil {
+				close(started)
+			}
+
+			time.Sleep(200 * time.Millisecond)
+
+			if isUpToDate, err := true_git.IsSparseCheckoutPathsUpToDate(r.GetClonePath(), r.Paths); err != nil {
+				return err
+			} else if !isUpToDate {
+				return fmt.Errorf("sparse checkout paths of %s are changed during usage", name)
+			}
+
+			addEvent(name + " end")
+
+			return nil
+		})
+	}
+
+	started := make(chan struct{})
+	errs := make(chan error, 2)
+	go func() { errs <- use(repoA, "A", started) }()
+	<-started
+	go func() { errs <- use(repoB, "B", nil) }()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expected := []string{"A start", "A end", "B start", "B end"}; strings.Join(events, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", expected, events)
+	}
+}
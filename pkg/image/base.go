@@ -5,9 +5,6 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
-
-	"github.com/flant/werf/pkg/docker"
 )
 
 type base struct {
@@ -56,18 +53,14 @@ func (i *base) ResetInspect() error {
 func (i *base) GetInspect() (*types.ImageInspect, error) {
 	if i.inspect == nil {
 		if err := i.resetInspect(); err != nil {
-			if client.IsErrNotFound(err) {
-				return nil, nil
-			} else {
-				return nil, err
-			}
+			return nil, err
 		}
 	}
 	return i.inspect, nil
 }
 
 func (i *base) resetInspect() error {
-	inspect, err := docker.ImageInspect(i.name)
+	inspect, err := containerBackend.GetImageInspect(i.name)
 	if err != nil {
 		return err
 	}
@@ -81,7 +74,7 @@ func (i *base) unsetInspect() {
 }
 
 func (i *base) Untag() error {
-	if err := docker.CliRmi(i.name, "--force"); err != nil {
+	if err := containerBackend.Rmi(i.name, true); err != nil {
 		return err
 	}
 
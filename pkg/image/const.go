@@ -9,6 +9,9 @@ const (
 	WerfImageTagLabel       = "werf-image-tag"
 	WerfDockerImageName     = "werf-docker-image-name"
 	WerfStageSignatureLabel = "werf-stage-signature"
+	WerfPlatformLabel       = "werf-platform"
+
+	WerfManagedImageNameLabel = "werf-managed-image-name"
 
 	WerfMountTmpDirLabel          = "werf-mount-type-tmp-dir"
 	WerfMountBuildDirLabel        = "werf-mount-type-build-dir"
@@ -18,6 +21,9 @@ const (
 
 	WerfTagStrategyLabel = "werf-tag-strategy"
 
+	WerfTagSemverLabel       = "werf-tag-semver"
+	WerfTagSemverGitTagLabel = "werf-tag-semver-git-tag"
+
 	BuildCacheVersion = "1.1"
 
 	StageContainerNamePrefix = "werf.build."
@@ -31,4 +37,8 @@ const (
 	ManagedImageRecord_ImageFormat     = "werf-managed-images/%s:%s"
 
 	RepoImageStageTagFormat = "image-stage-%s"
+
+	RepoStageImageFormat = "%s:%s-%s"
+
+	RepoManagedImageRecord_ImageTagPrefix = "managed-image-"
 )
@@ -0,0 +1,57 @@
+package image
+
+import (
+	"io"
+
+	"github.com/docker/docker/api/types"
+)
+
+const DockerContainerRuntime = "docker"
+
+// ContainerBackend runs stage containers of the stapel builder and manages local images of stages
+type ContainerBackend interface {
+	// Name of the container runtime is used in messages and to check features, which are available only with docker
+	Name() string
+
+	// GetImageInspect returns nil without error when the image does not exist
+	GetImageInspect(ref string) (*types.ImageInspect, error)
+	// CreateImage creates the empty image
+	CreateImage(ref string) error
+	// Pull pulls the image for the platform (OS/ARCH[/VARIANT]) from the manifest list or the image itself when platform is empty
+	Pull(ref, platform string) error
+	Push(ref string) error
+	Tag(ref, newRef string) error
+	Rmi(ref string, force bool) error
+
+	// GetOrCreateStapelContainer returns the container name to use stapel volume by volumes-from run option
+	GetOrCreateStapelContainer() (string, error)
+	RunContainer(opts RunContainerOptions) error
+	// CommitContainer creates the image from the container with the changes from options and returns the image id
+	CommitContainer(name string, opts *StageImageContainerOptions) (string, error)
+	RemoveContainer(name string) error
+}
+
+type RunContainerOptions struct {
+	Name    string
+	ImageId string
+	Options *StageImageContainerOptions
+	// Args are passed to the entrypoint from options
+	Args []string
+	// OutStream and ErrStream receive the container output instead of the log streams when set
+	OutStream io.Writer
+	ErrStream io.Writer
+}
+
+var containerBackend ContainerBackend = &DockerBackend{}
+
+func SetContainerBackend(backend ContainerBackend) {
+	containerBackend = backend
+}
+
+func GetContainerBackend() ContainerBackend {
+	return containerBackend
+}
+
+func IsDockerContainerRuntime() bool {
+	return containerBackend.Name() == DockerContainerRuntime
+}
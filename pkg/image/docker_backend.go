@@ -0,0 +1,105 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+
+	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/stapel"
+)
+
+// DockerBackend runs stage containers by the docker daemon
+type DockerBackend struct{}
+
+func (backend *DockerBackend) Name() string {
+	return DockerContainerRuntime
+}
+
+func (backend *DockerBackend) GetImageInspect(ref string) (*types.ImageInspect, error) {
+	inspect, err := docker.ImageInspect(ref)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return inspect, nil
+}
+
+func (backend *DockerBackend) CreateImage(ref string) error {
+	return docker.CreateImage(ref)
+}
+
+// Pull with platform requires docker daemon with experimental features enabled
+func (backend *DockerBackend) Pull(ref, platform string) error {
+	if platform == "" {
+		return docker.CliPullWithRetries(ref)
+	}
+
+	return docker.CliPullWithRetries("--platform", platform, ref)
+}
+
+func (backend *DockerBackend) Push(ref string) error {
+	return docker.CliPushWithRetries(ref)
+}
+
+func (backend *DockerBackend) Tag(ref, newRef string) error {
+	return docker.CliTag(ref, newRef)
+}
+
+func (backend *DockerBackend) Rmi(ref string, force bool) error {
+	if force {
+		return docker.CliRmi(ref, "--force")
+	}
+
+	return docker.CliRmi(ref)
+}
+
+func (backend *DockerBackend) GetOrCreateStapelContainer() (string, error) {
+	return stapel.GetOrCreateContainer()
+}
+
+func (backend *DockerBackend) RunContainer(opts RunContainerOptions) error {
+	runArgs, err := dockerRunArgs(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.OutStream != nil {
+		return docker.CliRun_ProvidedOutput(opts.OutStream, opts.ErrStream, runArgs...)
+	}
+
+	return docker.CliRun_LiveOutput(runArgs...)
+}
+
+func (backend *DockerBackend) CommitContainer(name string, opts *StageImageContainerOptions) (string, error) {
+	commitChanges, err := opts.prepareCommitChanges()
+	if err != nil {
+		return "", err
+	}
+
+	return docker.ContainerCommit(name, types.ContainerCommitOptions{Changes: commitChanges})
+}
+
+func (backend *DockerBackend) RemoveContainer(name string) error {
+	return docker.ContainerRemove(name, types.ContainerRemoveOptions{})
+}
+
+func dockerRunArgs(opts RunContainerOptions) ([]string, error) {
+	var args []string
+	args = append(args, fmt.Sprintf("--name=%s", opts.Name))
+
+	runArgs, err := opts.Options.toRunArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, runArgs...)
+	args = append(args, opts.ImageId)
+	args = append(args, opts.Args...)
+
+	return args, nil
+}
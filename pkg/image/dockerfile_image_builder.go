@@ -11,6 +11,7 @@ import (
 type DockerfileImageBuilder struct {
 	temporalId string
 	isBuilt    bool
+	buildKit   bool
 	BuildArgs  []string
 }
 
@@ -29,10 +30,26 @@ func (b *DockerfileImageBuilder) AppendBuildArgs(buildArgs ...string) {
 	b.BuildArgs = append(b.BuildArgs, buildArgs...)
 }
 
-func (b *DockerfileImageBuilder) Build() error {
+// EnableBuildKit is required for --ssh and --secret build options
+func (b *DockerfileImageBuilder) EnableBuildKit() {
+	b.buildKit = true
+}
+
+func (b *DockerfileImageBuilder) Build(options BuildOptions) error {
 	buildArgs := append(b.BuildArgs, fmt.Sprintf("--tag=%s", b.temporalId))
 
-	if err := docker.CliBuild_LiveOutput(buildArgs...); err != nil {
+	var err error
+	switch {
+	case b.buildKit && options.OutStream != nil:
+		err = docker.CliBuildKit_ProvidedOutput(options.OutStream, options.ErrStream, buildArgs...)
+	case b.buildKit:
+		err = docker.CliBuildKit_LiveOutput(buildArgs...)
+	case options.OutStream != nil:
+		err = docker.CliBuild_ProvidedOutput(options.OutStream, options.ErrStream, buildArgs...)
+	default:
+		err = docker.CliBuild_LiveOutput(buildArgs...)
+	}
+	if err != nil {
 		return err
 	}
 
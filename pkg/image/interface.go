@@ -1,10 +1,18 @@
 package image
 
-import "github.com/docker/docker/api/types"
+import (
+	"io"
+
+	"github.com/docker/docker/api/types"
+)
 
 type BuildOptions struct {
 	IntrospectBeforeError bool
 	IntrospectAfterError  bool
+
+	// OutStream and ErrStream receive the build output instead of the log streams when set
+	OutStream io.Writer
+	ErrStream io.Writer
 }
 
 type ImageInterface interface {
@@ -20,6 +28,7 @@ type ImageInterface interface {
 	SyncDockerState() error
 
 	Pull() error
+	Push() error
 	Untag() error
 
 	// TODO: build specifics for stapel builder and dockerfile builder
@@ -10,7 +10,8 @@ import (
 	"github.com/flant/logboek"
 
 	"github.com/flant/shluz"
-	"github.com/flant/werf/pkg/docker"
+
+	"github.com/flant/werf/pkg/werf"
 )
 
 type StageImage struct {
@@ -84,14 +85,18 @@ func (i *StageImage) SyncDockerState() error {
 
 func (i *StageImage) Build(options BuildOptions) error {
 	if i.dockerfileImageBuilder != nil {
-		return i.dockerfileImageBuilder.Build()
+		if !IsDockerContainerRuntime() {
+			return fmt.Errorf("dockerfile image build is not supported by %s container runtime", containerBackend.Name())
+		}
+
+		return i.dockerfileImageBuilder.Build(options)
 	}
 
 	containerLockName := ContainerLockName(i.container.Name())
-	if err := shluz.Lock(containerLockName, shluz.LockOptions{}); err != nil {
+	if err := werf.HostLock(containerLockName, shluz.LockOptions{}); err != nil {
 		return fmt.Errorf("failed to lock %s: %s", containerLockName, err)
 	}
-	defer shluz.Unlock(containerLockName)
+	defer werf.HostUnlock(containerLockName)
 
 	if debugDockerRunCommand() {
 		runArgs, err := i.container.prepareRunArgs()
@@ -106,7 +111,7 @@ func (i *StageImage) Build(options BuildOptions) error {
 		}
 	}
 
-	if containerRunErr := i.container.run(); containerRunErr != nil {
+	if containerRunErr := i.container.run(options); containerRunErr != nil {
 		if strings.HasPrefix(containerRunErr.Error(), "container run failed") {
 			if options.IntrospectBeforeError {
 				logboek.Default.LogFDetails("Launched command: %s\n", strings.Join(i.container.prepareAllRunCommands(), " && "))
@@ -193,7 +198,7 @@ func (i *StageImage) TagBuiltImage(name string) error {
 	if err != nil {
 		return err
 	}
-	return docker.CliTag(buildImageId, i.name)
+	return containerBackend.Tag(buildImageId, i.name)
 }
 
 func (i *StageImage) Tag(name string) error {
@@ -201,11 +206,23 @@ func (i *StageImage) Tag(name string) error {
 	if err != nil {
 		return err
 	}
-	return docker.CliTag(imageId, name)
+	return containerBackend.Tag(imageId, name)
 }
 
 func (i *StageImage) Pull() error {
-	if err := docker.CliPullWithRetries(i.name); err != nil {
+	if err := containerBackend.Pull(i.name, ""); err != nil {
+		return err
+	}
+
+	i.base.unsetInspect()
+
+	return nil
+}
+
+// PullForPlatform pulls the image for the platform (OS/ARCH[/VARIANT]) from the manifest list,
+// docker container runtime requires docker daemon with experimental features enabled
+func (i *StageImage) PullForPlatform(platform string) error {
+	if err := containerBackend.Pull(i.name, platform); err != nil {
 		return err
 	}
 
@@ -215,13 +232,13 @@ func (i *StageImage) Pull() error {
 }
 
 func (i *StageImage) Push() error {
-	return docker.CliPushWithRetries(i.name)
+	return containerBackend.Push(i.name)
 }
 
 func (i *StageImage) Import(name string) error {
 	importedImage := newBaseImage(name)
 
-	if err := docker.CliPullWithRetries(name); err != nil {
+	if err := containerBackend.Pull(name, ""); err != nil {
 		return err
 	}
 
@@ -230,11 +247,11 @@ func (i *StageImage) Import(name string) error {
 		return err
 	}
 
-	if err := docker.CliTag(importedImageId, i.name); err != nil {
+	if err := containerBackend.Tag(importedImageId, i.name); err != nil {
 		return err
 	}
 
-	if err := docker.CliRmi(name); err != nil {
+	if err := containerBackend.Rmi(name, false); err != nil {
 		return err
 	}
 
@@ -249,13 +266,13 @@ func (i *StageImage) Export(name string) error {
 	}
 
 	if err := logboek.Info.LogProcess(fmt.Sprintf("Pushing %s", name), logboek.LevelLogProcessOptions{}, func() error {
-		return docker.CliPushWithRetries(name)
+		return containerBackend.Push(name)
 	}); err != nil {
 		return err
 	}
 
 	if err := logboek.Info.LogProcess(fmt.Sprintf("Untagging %s", name), logboek.LevelLogProcessOptions{}, func() error {
-		return docker.CliRmi(name)
+		return containerBackend.Rmi(name, false)
 	}); err != nil {
 		return err
 	}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/docker/docker/api/types"
-
 	"github.com/flant/logboek"
 	"github.com/flant/werf/pkg/docker"
 	"github.com/flant/werf/pkg/stapel"
@@ -66,33 +64,33 @@ func (c *StageImageContainer) ServiceCommitChangeOptions() ContainerOptions {
 }
 
 func (c *StageImageContainer) prepareRunArgs() ([]string, error) {
-	var args []string
-	args = append(args, fmt.Sprintf("--name=%s", c.name))
-
-	runOptions, err := c.prepareRunOptions()
+	runContainerOptions, err := c.prepareRunContainerOptions()
 	if err != nil {
 		return nil, err
 	}
 
-	runArgs, err := runOptions.toRunArgs()
+	return dockerRunArgs(runContainerOptions)
+}
+
+func (c *StageImageContainer) prepareRunContainerOptions() (RunContainerOptions, error) {
+	runOptions, err := c.prepareRunOptions()
 	if err != nil {
-		return nil, err
+		return RunContainerOptions{}, err
 	}
 
-	setColumnsEnv := fmt.Sprintf("--env=COLUMNS=%d", logboek.ContentWidth())
-	runArgs = append(runArgs, setColumnsEnv)
+	runOptions.Env["COLUMNS"] = fmt.Sprintf("%d", logboek.ContentWidth())
 
 	fromImageId, err := c.image.fromImage.MustGetId()
 	if err != nil {
-		return nil, err
+		return RunContainerOptions{}, err
 	}
 
-	args = append(args, runArgs...)
-	args = append(args, fromImageId)
-	args = append(args, "-ec")
-	args = append(args, c.prepareRunCommand())
-
-	return args, nil
+	return RunContainerOptions{
+		Name:    c.name,
+		ImageId: fromImageId,
+		Options: runOptions,
+		Args:    []string{"-ec", c.prepareRunCommand()},
+	}, nil
 }
 
 func (c *StageImageContainer) prepareRunCommand() string {
@@ -194,7 +192,7 @@ func (c *StageImageContainer) prepareServiceRunOptions() (*StageImageContainerOp
 	serviceRunOptions.Entrypoint = stapel.BashBinPath()
 	serviceRunOptions.User = "0:0"
 
-	stapelContainerName, err := stapel.GetOrCreateContainer()
+	stapelContainerName, err := containerBackend.GetOrCreateStapelContainer()
 	if err != nil {
 		return nil, err
 	}
@@ -208,19 +206,6 @@ func (c *StageImageContainer) prepareIntrospectOptions() (*StageImageContainerOp
 	return c.prepareRunOptions()
 }
 
-func (c *StageImageContainer) prepareCommitChanges() ([]string, error) {
-	commitOptions, err := c.prepareCommitOptions()
-	if err != nil {
-		return nil, err
-	}
-
-	commitChanges, err := commitOptions.prepareCommitChanges()
-	if err != nil {
-		return nil, err
-	}
-	return commitChanges, nil
-}
-
 func (c *StageImageContainer) prepareCommitOptions() (*StageImageContainerOptions, error) {
 	inheritedCommitOptions, err := c.prepareInheritedCommitOptions()
 	if err != nil {
@@ -260,13 +245,15 @@ func (c *StageImageContainer) prepareInheritedCommitOptions() (*StageImageContai
 	return inheritedOptions, nil
 }
 
-func (c *StageImageContainer) run() error {
-	runArgs, err := c.prepareRunArgs()
+func (c *StageImageContainer) run(options BuildOptions) error {
+	runContainerOptions, err := c.prepareRunContainerOptions()
 	if err != nil {
 		return err
 	}
+	runContainerOptions.OutStream = options.OutStream
+	runContainerOptions.ErrStream = options.ErrStream
 
-	if err := docker.CliRun_LiveOutput(runArgs...); err != nil {
+	if err := containerBackend.RunContainer(runContainerOptions); err != nil {
 		return fmt.Errorf("container run failed: %s", err.Error())
 	}
 
@@ -274,6 +261,10 @@ func (c *StageImageContainer) run() error {
 }
 
 func (c *StageImageContainer) introspect() error {
+	if !IsDockerContainerRuntime() {
+		return fmt.Errorf("stage introspection is not supported by %s container runtime", containerBackend.Name())
+	}
+
 	runArgs, err := c.prepareIntrospectArgs()
 	if err != nil {
 		return err
@@ -289,6 +280,10 @@ func (c *StageImageContainer) introspect() error {
 }
 
 func (c *StageImageContainer) introspectBefore() error {
+	if !IsDockerContainerRuntime() {
+		return fmt.Errorf("stage introspection is not supported by %s container runtime", containerBackend.Name())
+	}
+
 	runArgs, err := c.prepareIntrospectBeforeArgs()
 	if err != nil {
 		return err
@@ -315,20 +310,14 @@ func IsStartContainerErr(err error) bool {
 }
 
 func (c *StageImageContainer) commit() (string, error) {
-	commitChanges, err := c.prepareCommitChanges()
-	if err != nil {
-		return "", err
-	}
-
-	commitOptions := types.ContainerCommitOptions{Changes: commitChanges}
-	id, err := docker.ContainerCommit(c.name, commitOptions)
+	commitOptions, err := c.prepareCommitOptions()
 	if err != nil {
 		return "", err
 	}
 
-	return id, nil
+	return containerBackend.CommitContainer(c.name, commitOptions)
 }
 
 func (c *StageImageContainer) rm() error {
-	return docker.ContainerRemove(c.name, types.ContainerRemoveOptions{})
+	return containerBackend.RemoveContainer(c.name)
 }
@@ -0,0 +1,226 @@
+package images_archive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/platform"
+	"github.com/flant/werf/pkg/tag_strategy"
+)
+
+const (
+	OCILayoutFormat     = "oci-layout"
+	DockerArchiveFormat = "docker-archive"
+)
+
+type ArchiveImage struct {
+	// Ref is the name of the published image (IMAGES_REPO/IMAGE_NAME:TAG)
+	Ref   string
+	Image v1.Image
+}
+
+func (i *ArchiveImage) Labels() (map[string]string, error) {
+	configFile, err := i.Image.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return configFile.Config.Labels, nil
+}
+
+// WriteArchive writes the images into the OCI image layout directory or the docker-archive tarball,
+// werf labels of the image are also added to the annotations of the OCI layout index
+func WriteArchive(path, format string, images []*ArchiveImage) error {
+	switch format {
+	case OCILayoutFormat:
+		return writeOCILayout(path, images)
+	case DockerArchiveFormat:
+		return writeDockerArchive(path, images)
+	default:
+		return fmt.Errorf("unknown archive format %q: %s or %s expected", format, OCILayoutFormat, DockerArchiveFormat)
+	}
+}
+
+// ReadArchive reads the OCI image layout directory or the docker-archive tarball
+func ReadArchive(path string) ([]*ArchiveImage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return readOCILayout(path)
+	}
+
+	return readDockerArchive(path)
+}
+
+func writeOCILayout(path string, images []*ArchiveImage) error {
+	if entries, err := ioutil.ReadDir(path); err == nil && len(entries) != 0 {
+		return fmt.Errorf("directory %s is not empty", path)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	p, err := layout.Write(path, empty.Index)
+	if err != nil {
+		return err
+	}
+
+	for _, img := range images {
+		labels, err := img.Labels()
+		if err != nil {
+			return err
+		}
+
+		annotations := map[string]string{imagespec.AnnotationRefName: img.Ref}
+		for key, value := range labels {
+			if strings.HasPrefix(key, image.WerfLabel) {
+				annotations[key] = value
+			}
+		}
+
+		if err := p.AppendImage(img.Image, layout.WithAnnotations(annotations)); err != nil {
+			return fmt.Errorf("unable to write image %s: %s", img.Ref, err)
+		}
+	}
+
+	return nil
+}
+
+func readOCILayout(path string) ([]*ArchiveImage, error) {
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*ArchiveImage
+	for _, desc := range indexManifest.Manifests {
+		ref := desc.Annotations[imagespec.AnnotationRefName]
+		if ref == "" {
+			continue
+		}
+
+		img, err := p.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read image %s: %s", ref, err)
+		}
+
+		images = append(images, &ArchiveImage{Ref: ref, Image: img})
+	}
+
+	return images, nil
+}
+
+func writeDockerArchive(path string, images []*ArchiveImage) error {
+	refToImage := map[name.Reference]v1.Image{}
+	for _, img := range images {
+		tag, err := name.NewTag(img.Ref, name.WeakValidation)
+		if err != nil {
+			return err
+		}
+
+		refToImage[tag] = img.Image
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return tarball.MultiRefWriteToFile(path, refToImage)
+}
+
+func readDockerArchive(path string) ([]*ArchiveImage, error) {
+	manifest, err := readDockerArchiveManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*ArchiveImage
+	for _, desc := range manifest {
+		for _, repoTag := range desc.RepoTags {
+			tag, err := name.NewTag(repoTag, name.WeakValidation)
+			if err != nil {
+				return nil, err
+			}
+
+			img, err := tarball.ImageFromPath(path, &tag)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read image %s: %s", repoTag, err)
+			}
+
+			images = append(images, &ArchiveImage{Ref: repoTag, Image: img})
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool { return images[i].Ref < images[j].Ref })
+
+	return images, nil
+}
+
+func readDockerArchiveManifest(path string) (tarball.Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s is not a docker-archive: manifest.json not found", path)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if hdr.Name != "manifest.json" {
+			continue
+		}
+
+		var manifest tarball.Manifest
+		if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("bad docker-archive manifest.json: %s", err)
+		}
+
+		return manifest, nil
+	}
+}
+
+// PublishedTag returns the tag, which the image is published by with the labels,
+// the image of the platform is published by the platform tag and added to the manifest list by the meta tag
+func PublishedTag(labels map[string]string) (tag string, manifestListTag string) {
+	metaTag := labels[image.WerfImageTagLabel]
+	targetPlatform := labels[image.WerfPlatformLabel]
+
+	if targetPlatform != "" && labels[image.WerfTagStrategyLabel] != string(tag_strategy.StagesSignature) {
+		return platform.ImageMetaTag(metaTag, targetPlatform), metaTag
+	}
+
+	return metaTag, ""
+}
@@ -0,0 +1,128 @@
+package images_archive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/flant/werf/pkg/image"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-images-archive-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imagesNames := []string{"backend", "frontend"}
+
+	var images []*ArchiveImage
+	for _, imageName := range imagesNames {
+		img, err := random.Image(256, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		configFile, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		configFile = configFile.DeepCopy()
+		configFile.Config.Labels = map[string]string{
+			image.WerfImageLabel:     "true",
+			image.WerfImageNameLabel: imageName,
+			image.WerfImageTagLabel:  "v1",
+			"maintainer":             "werf",
+		}
+
+		if img, err = mutate.ConfigFile(img, configFile); err != nil {
+			t.Fatal(err)
+		}
+
+		images = append(images, &ArchiveImage{Ref: fmt.Sprintf("registry.example.com/project/%s:v1", imageName), Image: img})
+	}
+
+	for _, format := range []string{OCILayoutFormat, DockerArchiveFormat} {
+		path := filepath.Join(dir, format)
+		if err := WriteArchive(path, format, images); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		got, err := ReadArchive(path)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		if len(got) != len(images) {
+			t.Fatalf("%s: %d images expected, got %d", format, len(images), len(got))
+		}
+
+		for i := range images {
+			if got[i].Ref != images[i].Ref {
+				t.Errorf("%s: image ref:\n[EXPECTED]:\n%s\n[GOT]:\n%s", format, images[i].Ref, got[i].Ref)
+			}
+
+			expectedId, err := images[i].Image.ConfigName()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotId, err := got[i].Image.ConfigName()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if gotId != expectedId {
+				t.Errorf("%s: image %s id:\n[EXPECTED]:\n%s\n[GOT]:\n%s", format, images[i].Ref, expectedId, gotId)
+			}
+
+			labels, err := got[i].Labels()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if labels[image.WerfImageNameLabel] != imagesNames[i] {
+				t.Errorf("%s: image %s labels are lost: %v", format, images[i].Ref, labels)
+			}
+		}
+	}
+
+	if err := WriteArchive(filepath.Join(dir, OCILayoutFormat), OCILayoutFormat, images); err == nil {
+		t.Errorf("writing into not empty directory should fail")
+	}
+}
+
+func TestPublishedTag(t *testing.T) {
+	tests := []struct {
+		labels                  map[string]string
+		expectedTag             string
+		expectedManifestListTag string
+	}{
+		{
+			labels:      map[string]string{image.WerfImageTagLabel: "master", image.WerfTagStrategyLabel: "git-branch"},
+			expectedTag: "master",
+		},
+		{
+			labels:                  map[string]string{image.WerfImageTagLabel: "master", image.WerfTagStrategyLabel: "git-branch", image.WerfPlatformLabel: "linux/arm64"},
+			expectedTag:             "master-linux-arm64",
+			expectedManifestListTag: "master",
+		},
+		{
+			labels:      map[string]string{image.WerfImageTagLabel: "b2b4c9bd", image.WerfTagStrategyLabel: "stages-signature", image.WerfPlatformLabel: "linux/arm64"},
+			expectedTag: "b2b4c9bd",
+		},
+	}
+
+	for _, test := range tests {
+		tag, manifestListTag := PublishedTag(test.labels)
+		if tag != test.expectedTag || manifestListTag != test.expectedManifestListTag {
+			t.Errorf("published tag for %v:\n[EXPECTED]:\n%s %q\n[GOT]:\n%s %q", test.labels, test.expectedTag, test.expectedManifestListTag, tag, manifestListTag)
+		}
+	}
+}
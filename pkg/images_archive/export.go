@@ -0,0 +1,138 @@
+package images_archive
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/tag_strategy"
+	"github.com/flant/werf/pkg/util"
+)
+
+type ImagesRepoManager interface {
+	ImagesRepo() string
+	ImageRepo(imageName string) string
+	ImageRepoWithTag(imageName, tag string) string
+}
+
+type ExportOptions struct {
+	ImagesRepoManager ImagesRepoManager
+	ImagesNames       []string
+	Path              string
+	Format            string
+	Tags              TagSelection
+}
+
+// TagSelection selects the exported images by the tagging options of the publish, all published images are exported when the selection is empty
+type TagSelection struct {
+	// TagsByStrategy are the meta tags of the strategies, semver strategy is selected by the full versions (MAJOR.MINOR.PATCH[-PRERELEASE])
+	TagsByStrategy map[tag_strategy.TagStrategy][]string
+	// StagesSignature selects all images published by the stages-signature strategy, because the signatures are not known without the build
+	StagesSignature bool
+}
+
+func (selection TagSelection) IsEmpty() bool {
+	if selection.StagesSignature {
+		return false
+	}
+
+	for _, tags := range selection.TagsByStrategy {
+		if len(tags) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Matches checks the tagging strategy and the tag, which the image is published by with the labels
+func (selection TagSelection) Matches(labels map[string]string) bool {
+	if selection.IsEmpty() {
+		return true
+	}
+
+	strategy := tag_strategy.TagStrategy(labels[image.WerfTagStrategyLabel])
+	switch strategy {
+	case tag_strategy.StagesSignature:
+		return selection.StagesSignature
+	case tag_strategy.Semver:
+		return util.IsStringsContainValue(selection.TagsByStrategy[strategy], labels[image.WerfTagSemverLabel])
+	default:
+		return util.IsStringsContainValue(selection.TagsByStrategy[strategy], labels[image.WerfImageTagLabel])
+	}
+}
+
+// Export writes the images published by werf into the archive, manifest lists are not exported,
+// because the images of the platforms are exported by the platform tags and manifest lists are created by Import,
+// only the images matching the tag selection are exported when it is not empty
+func Export(options ExportOptions) error {
+	var images []*ArchiveImage
+
+	if err := logboek.LogProcess("Getting published images", logboek.LogProcessOptions{}, func() error {
+		imagesNamesByRepo := map[string][]string{}
+		for _, imageName := range options.ImagesNames {
+			repo := options.ImagesRepoManager.ImageRepo(imageName)
+			imagesNamesByRepo[repo] = append(imagesNamesByRepo[repo], imageName)
+		}
+
+		var repos []string
+		for repo := range imagesNamesByRepo {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+
+		for _, repo := range repos {
+			repoImages, err := docker_registry.ImagesByWerfImageLabel(repo, "true")
+			if err != nil {
+				return err
+			}
+
+			for _, repoImage := range repoImages {
+				img := &ArchiveImage{Ref: fmt.Sprintf("%s:%s", repoImage.Repository, repoImage.Tag), Image: repoImage.Image}
+
+				labels, err := img.Labels()
+				if err != nil {
+					return err
+				}
+
+				imageName := labels[image.WerfImageNameLabel]
+				if !util.IsStringsContainValue(imagesNamesByRepo[repo], imageName) {
+					continue
+				}
+
+				if tag, _ := PublishedTag(labels); options.ImagesRepoManager.ImageRepoWithTag(imageName, tag) != img.Ref {
+					continue
+				}
+
+				if !options.Tags.Matches(labels) {
+					continue
+				}
+
+				images = append(images, img)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(images) == 0 {
+		if !options.Tags.IsEmpty() {
+			return fmt.Errorf("no published images matching the tag options found in the images repo %s", options.ImagesRepoManager.ImagesRepo())
+		}
+
+		return fmt.Errorf("no published images found in the images repo %s", options.ImagesRepoManager.ImagesRepo())
+	}
+
+	return logboek.Default.LogProcess(fmt.Sprintf("Writing %s archive %s", options.Format, options.Path), logboek.LevelLogProcessOptions{}, func() error {
+		for _, img := range images {
+			logboek.Default.LogFDetails("image: %s\n", img.Ref)
+		}
+
+		return WriteArchive(options.Path, options.Format, images)
+	})
+}
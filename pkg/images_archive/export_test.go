@@ -0,0 +1,66 @@
+package images_archive
+
+import (
+	"testing"
+
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/tag_strategy"
+)
+
+func TestTagSelection_Matches(t *testing.T) {
+	selection := TagSelection{
+		TagsByStrategy: map[tag_strategy.TagStrategy][]string{
+			tag_strategy.GitBranch: {"master"},
+			tag_strategy.Semver:    {"1.2.3"},
+		},
+	}
+
+	tests := []struct {
+		labels   map[string]string
+		expected bool
+	}{
+		{
+			labels:   map[string]string{image.WerfImageTagLabel: "master", image.WerfTagStrategyLabel: "git-branch"},
+			expected: true,
+		},
+		{
+			labels:   map[string]string{image.WerfImageTagLabel: "master", image.WerfTagStrategyLabel: "git-branch", image.WerfPlatformLabel: "linux/arm64"},
+			expected: true,
+		},
+		{
+			labels:   map[string]string{image.WerfImageTagLabel: "feature", image.WerfTagStrategyLabel: "git-branch"},
+			expected: false,
+		},
+		{
+			labels:   map[string]string{image.WerfImageTagLabel: "master", image.WerfTagStrategyLabel: "custom"},
+			expected: false,
+		},
+		{
+			labels:   map[string]string{image.WerfImageTagLabel: "1.2", image.WerfTagStrategyLabel: "semver", image.WerfTagSemverLabel: "1.2.3"},
+			expected: true,
+		},
+		{
+			labels:   map[string]string{image.WerfImageTagLabel: "1.2", image.WerfTagStrategyLabel: "semver", image.WerfTagSemverLabel: "1.2.4"},
+			expected: false,
+		},
+		{
+			labels:   map[string]string{image.WerfImageTagLabel: "b2b4c9bd", image.WerfTagStrategyLabel: "stages-signature"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := selection.Matches(test.labels); got != test.expected {
+			t.Errorf("%v:\n[EXPECTED]: %v\n[GOT]: %v", test.labels, test.expected, got)
+		}
+	}
+
+	stagesSignatureLabels := map[string]string{image.WerfImageTagLabel: "b2b4c9bd", image.WerfTagStrategyLabel: "stages-signature"}
+	if !(TagSelection{StagesSignature: true}).Matches(stagesSignatureLabels) {
+		t.Errorf("stages-signature selection should match all images published by stages-signature strategy")
+	}
+
+	if !(TagSelection{}).Matches(stagesSignatureLabels) {
+		t.Errorf("empty selection should match all images")
+	}
+}
@@ -0,0 +1,94 @@
+package images_archive
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/util"
+)
+
+type ImportOptions struct {
+	ImagesRepoManager ImagesRepoManager
+	// ImagesNames limits the imported images, all images from the archive are imported when empty
+	ImagesNames []string
+	Path        string
+}
+
+// Import pushes the images from the archive into the images repo: the tags are made by the werf labels of the image
+// for the images repo and the mode, so that the images are published the same way as by werf publish
+func Import(options ImportOptions) error {
+	images, err := ReadArchive(options.Path)
+	if err != nil {
+		return fmt.Errorf("unable to read archive %s: %s", options.Path, err)
+	}
+
+	for _, img := range images {
+		labels, err := img.Labels()
+		if err != nil {
+			return err
+		}
+
+		if labels[image.WerfImageLabel] != "true" || labels[image.WerfImageTagLabel] == "" {
+			logboek.LogWarnF("WARNING: Image %s was skipped: the image is not published by werf\n", img.Ref)
+			continue
+		}
+
+		imageName := labels[image.WerfImageNameLabel]
+		if len(options.ImagesNames) != 0 && !util.IsStringsContainValue(options.ImagesNames, imageName) {
+			continue
+		}
+
+		if err := importImage(img, labels, options.ImagesRepoManager); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func importImage(img *ArchiveImage, labels map[string]string, imagesRepoManager ImagesRepoManager) error {
+	imageName := labels[image.WerfImageNameLabel]
+	tag, manifestListTag := PublishedTag(labels)
+	newRef := imagesRepoManager.ImageRepoWithTag(imageName, tag)
+
+	return logboek.Default.LogProcess(fmt.Sprintf("Importing image %s", newRef), logboek.LevelLogProcessOptions{
+		SuccessInfoSectionFunc: func() {
+			_ = logboek.WithIndent(func() error {
+				logboek.Default.LogFDetails("archive image: %s\n", img.Ref)
+				logboek.Default.LogFDetails("        image: %s\n", newRef)
+				return nil
+			})
+		},
+	}, func() error {
+		configFile, err := img.Image.ConfigFile()
+		if err != nil {
+			return err
+		}
+
+		configFile = configFile.DeepCopy()
+		configFile.Config.Labels[image.WerfDockerImageName] = newRef
+
+		newImage, err := mutate.ConfigFile(img.Image, configFile)
+		if err != nil {
+			return err
+		}
+
+		if err := docker_registry.PushImage(newRef, newImage); err != nil {
+			return err
+		}
+
+		if manifestListTag != "" {
+			manifestListRef := imagesRepoManager.ImageRepoWithTag(imageName, manifestListTag)
+			if err := docker_registry.AddToManifestList(manifestListRef, newRef, labels[image.WerfPlatformLabel]); err != nil {
+				return fmt.Errorf("error publishing manifest list %s: %s", manifestListRef, err)
+			}
+		}
+
+		return nil
+	})
+}
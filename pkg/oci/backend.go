@@ -0,0 +1,445 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/stapel"
+	"github.com/flant/werf/pkg/tmp_manager"
+	"github.com/flant/werf/pkg/werf"
+)
+
+const (
+	ContainerRuntime = "oci"
+
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// Backend runs stage containers by the rootless runc without docker daemon:
+// images are stored in the OCI image layout in the local cache dir and pushed straight to the registry,
+// container changes are committed as the layer with the diff of the container rootfs
+type Backend struct {
+	layout   *Layout
+	runcPath string
+	stateDir string
+	ids      idMappings
+
+	mutex      sync.Mutex
+	containers map[string]*runContainer
+}
+
+type runContainer struct {
+	bundleDir   string
+	imageId     string
+	snapshot    map[string]fileState
+	mountpoints []string
+}
+
+// NewBackend should be called after werf.Init, runc binary is searched in the PATH or specified by $WERF_RUNC_PATH
+func NewBackend() (*Backend, error) {
+	runcPath := os.Getenv("WERF_RUNC_PATH")
+	if runcPath == "" {
+		path, err := exec.LookPath("runc")
+		if err != nil {
+			return nil, fmt.Errorf("runc is required by %s container runtime: %s", ContainerRuntime, err)
+		}
+		runcPath = path
+	}
+
+	l, err := NewLayout(filepath.Join(werf.GetLocalCacheDir(), "oci", "layout"))
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := lookupIDMappings()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{
+		layout:     l,
+		runcPath:   runcPath,
+		stateDir:   filepath.Join(werf.GetServiceDir(), "oci", "runc"),
+		ids:        ids,
+		containers: map[string]*runContainer{},
+	}, nil
+}
+
+func (backend *Backend) Name() string {
+	return ContainerRuntime
+}
+
+func (backend *Backend) GetImageInspect(ref string) (*types.ImageInspect, error) {
+	img, err := backend.layout.GetImage(ref)
+	if err != nil || img == nil {
+		return nil, err
+	}
+
+	configName, err := img.ConfigName()
+	if err != nil {
+		return nil, err
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	// the size of compressed layers
+	var size int64
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+
+	refs, err := backend.layout.GetImageRefs(configName.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return newImageInspect(configName.String(), refs, configFile, size), nil
+}
+
+func (backend *Backend) CreateImage(ref string) error {
+	img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		Created:      v1.Time{Time: time.Now()},
+		RootFS:       v1.RootFS{Type: "layers"},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = backend.layout.StoreImage(img, ref)
+	return err
+}
+
+func (backend *Backend) Pull(ref, platform string) error {
+	img, err := docker_registry.PullImage(ref, platform)
+	if err != nil {
+		return err
+	}
+
+	if _, err := backend.layout.StoreImage(img, ref); err != nil {
+		return fmt.Errorf("unable to store image %s: %s", ref, err)
+	}
+
+	return nil
+}
+
+func (backend *Backend) Push(ref string) error {
+	img, err := backend.layout.GetImage(ref)
+	if err != nil {
+		return err
+	}
+	if img == nil {
+		return fmt.Errorf("no such image: %s", ref)
+	}
+
+	return docker_registry.PushImage(ref, img)
+}
+
+func (backend *Backend) Tag(ref, newRef string) error {
+	return backend.layout.Tag(ref, newRef)
+}
+
+// Rmi removes the ref from the layout, images are not used by containers after commit, so force is not needed
+func (backend *Backend) Rmi(ref string, _ bool) error {
+	return backend.layout.Untag(ref)
+}
+
+// GetOrCreateStapelContainer returns the stapel image name, which is handled by RunContainer as volumes-from option
+func (backend *Backend) GetOrCreateStapelContainer() (string, error) {
+	if _, err := getOrCreateStapelDir(); err != nil {
+		return "", err
+	}
+
+	return stapel.ImageName(), nil
+}
+
+func (backend *Backend) RunContainer(opts image.RunContainerOptions) error {
+	img, err := backend.layout.GetImage(opts.ImageId)
+	if err != nil {
+		return err
+	}
+	if img == nil {
+		return fmt.Errorf("no such image: %s", opts.ImageId)
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return err
+	}
+
+	mounts, err := backend.prepareMounts(opts.Options)
+	if err != nil {
+		return err
+	}
+
+	bundleDir, err := ioutil.TempDir(werf.GetTmpDir(), tmp_manager.CommonPrefix+"oci-container-")
+	if err != nil {
+		return err
+	}
+
+	c := &runContainer{bundleDir: bundleDir, imageId: opts.ImageId}
+	backend.mutex.Lock()
+	backend.containers[opts.Name] = c
+	backend.mutex.Unlock()
+
+	rootfsDir := filepath.Join(bundleDir, "rootfs")
+	if err := os.MkdirAll(rootfsDir, 0755); err != nil {
+		return err
+	}
+
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	if err := unpackRootfs(rc, rootfsDir, ""); err != nil {
+		return fmt.Errorf("unable to unpack image %s: %s", opts.ImageId, err)
+	}
+
+	if c.snapshot, err = snapshotRootfs(rootfsDir); err != nil {
+		return err
+	}
+
+	user, err := parseUser(opts.Options.User, rootfsDir, backend.ids)
+	if err != nil {
+		return err
+	}
+
+	env := mergeEnv(configFile.Config.Env, opts.Options.Env)
+	if !hasEnv(env, "PATH") {
+		env = append(env, "PATH="+defaultPath)
+	}
+
+	args, err := parseEntrypoint(opts.Options.Entrypoint, configFile.Config.Entrypoint)
+	if err != nil {
+		return err
+	}
+	args = append(args, opts.Args...)
+
+	cwd := opts.Options.Workdir
+	if cwd == "" {
+		cwd = "/"
+	}
+
+	spec := newRuntimeSpec(runtimeSpecOptions{
+		Args:       args,
+		Env:        env,
+		Cwd:        cwd,
+		Mounts:     mounts,
+		User:       user,
+		IDMappings: backend.ids,
+	})
+
+	for _, m := range spec.Mounts {
+		c.mountpoints = append(c.mountpoints, m.Destination)
+	}
+
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, "config.json"), data, 0644); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(backend.runcPath, "--root", backend.stateDir, "run", "--bundle", bundleDir, opts.Name)
+	cmd.Stdout = logboek.GetOutStream()
+	cmd.Stderr = logboek.GetErrStream()
+	if opts.OutStream != nil {
+		cmd.Stdout = opts.OutStream
+		cmd.Stderr = opts.ErrStream
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("runc run failed: %s", err)
+	}
+
+	return nil
+}
+
+func (backend *Backend) CommitContainer(name string, opts *image.StageImageContainerOptions) (string, error) {
+	c, err := backend.getContainer(name)
+	if err != nil {
+		return "", err
+	}
+
+	rootfsDir := filepath.Join(c.bundleDir, "rootfs")
+	removeMountpoints(rootfsDir, c.snapshot, c.mountpoints)
+
+	layerPath := filepath.Join(c.bundleDir, "layer.tar")
+	f, err := os.Create(layerPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeRootfsDiff(rootfsDir, c.snapshot, backend.ids, f); err != nil {
+		f.Close()
+		return "", fmt.Errorf("unable to write container %s changes: %s", name, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	layer, err := tarball.LayerFromFile(layerPath)
+	if err != nil {
+		return "", err
+	}
+
+	baseImg, err := backend.layout.GetImage(c.imageId)
+	if err != nil {
+		return "", err
+	}
+	if baseImg == nil {
+		return "", fmt.Errorf("no such image: %s", c.imageId)
+	}
+
+	now := v1.Time{Time: time.Now()}
+
+	img, err := mutate.Append(baseImg, mutate.Addendum{Layer: layer, History: v1.History{Created: now, CreatedBy: "werf stage"}})
+	if err != nil {
+		return "", err
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return "", err
+	}
+	configFile = configFile.DeepCopy()
+	configFile.Created = now
+
+	if err := applyCommitOptions(&configFile.Config, opts); err != nil {
+		return "", err
+	}
+
+	if img, err = mutate.ConfigFile(img, configFile); err != nil {
+		return "", err
+	}
+
+	return backend.layout.StoreImage(img, "")
+}
+
+func (backend *Backend) RemoveContainer(name string) error {
+	c, err := backend.getContainer(name)
+	if err != nil {
+		return err
+	}
+
+	backend.mutex.Lock()
+	delete(backend.containers, name)
+	backend.mutex.Unlock()
+
+	return removeAll(c.bundleDir)
+}
+
+func (backend *Backend) prepareMounts(opts *image.StageImageContainerOptions) ([]specs.Mount, error) {
+	var mounts []specs.Mount
+
+	for _, volumesFrom := range opts.VolumesFrom {
+		if volumesFrom != stapel.ImageName() {
+			return nil, fmt.Errorf("volumes from container %s are not supported by %s container runtime", volumesFrom, ContainerRuntime)
+		}
+
+		stapelDir, err := getOrCreateStapelDir()
+		if err != nil {
+			return nil, err
+		}
+
+		mounts = append(mounts, specs.Mount{Destination: stapelVolume, Type: "none", Source: stapelDir, Options: []string{"rbind", "ro"}})
+	}
+
+	for _, volume := range opts.Volume {
+		m, err := parseVolume(volume)
+		if err != nil {
+			return nil, err
+		}
+
+		// docker creates the host directory of the volume
+		if _, err := os.Stat(m.Source); os.IsNotExist(err) {
+			if err := os.MkdirAll(m.Source, os.ModePerm); err != nil {
+				return nil, err
+			}
+		}
+
+		mounts = append(mounts, m)
+	}
+
+	return mounts, nil
+}
+
+func (backend *Backend) getContainer(name string) (*runContainer, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	c, exists := backend.containers[name]
+	if !exists {
+		return nil, fmt.Errorf("no such container: %s", name)
+	}
+
+	return c, nil
+}
+
+func parseEntrypoint(entrypoint string, imageEntrypoint []string) ([]string, error) {
+	if entrypoint == "" {
+		return append([]string{}, imageEntrypoint...), nil
+	}
+
+	if strings.HasPrefix(entrypoint, "[") {
+		var args []string
+		if err := json.Unmarshal([]byte(entrypoint), &args); err != nil {
+			return nil, fmt.Errorf("bad entrypoint %q: %s", entrypoint, err)
+		}
+		return args, nil
+	}
+
+	return []string{entrypoint}, nil
+}
+
+func hasEnv(env []string, name string) bool {
+	for _, e := range env {
+		if strings.HasPrefix(e, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeAll removes the container files, which could be not writable for the owner
+func removeAll(dir string) error {
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && info.Mode().Perm()&0700 != 0700 {
+			_ = os.Chmod(path, info.Mode().Perm()|0700)
+		}
+		return nil
+	})
+
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,194 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/werf"
+)
+
+const testPasswd = "app:x:1000:1001::/home/app:/bin/sh\n"
+
+// fakeRunc changes the container rootfs as the container root: $5 is the bundle dir of "runc --root DIR run --bundle DIR NAME"
+const fakeRunc = `#!/bin/sh
+echo changed >> "$5/rootfs/home/app/config"
+echo new > "$5/rootfs/home/app/new"
+`
+
+func TestBackend_CommitContainerOwners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-oci-backend-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := werf.Init(dir, filepath.Join(dir, "home")); err != nil {
+		t.Fatal(err)
+	}
+	if err := shluz.Init(filepath.Join(dir, "locks")); err != nil {
+		t.Fatal(err)
+	}
+
+	xattrTestFile := filepath.Join(dir, "xattr")
+	writeTestFile(t, xattrTestFile, "")
+	if err := setXattr(xattrTestFile, rootlessOwnerXattr, marshalRootlessOwner(1, 1)); err != nil {
+		t.Skipf("user xattrs are not supported: %s", err)
+	}
+
+	runcPath := filepath.Join(dir, "runc")
+	if err := ioutil.WriteFile(runcPath, []byte(fakeRunc), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostUid, hostGid := uint32(os.Getuid()), uint32(os.Getgid())
+	backend := &Backend{
+		layout:     l,
+		runcPath:   runcPath,
+		stateDir:   filepath.Join(dir, "state"),
+		ids:        newIDMappings(hostUid, hostGid, &idRange{Start: 100000, Size: 65536}, &idRange{Start: 200000, Size: 65536}),
+		containers: map[string]*runContainer{},
+	}
+
+	layerPath := filepath.Join(dir, "base.tar")
+	writeTestTar(t, layerPath, []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0755},
+		{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0644, Size: int64(len(testPasswd))},
+		{Typeflag: tar.TypeDir, Name: "home/app/", Mode: 0755, Uid: 1000, Gid: 1001},
+		{Typeflag: tar.TypeReg, Name: "home/app/config", Mode: 0644, Uid: 1000, Gid: 1001, Size: int64(len(testPasswd))},
+	})
+
+	layer, err := tarball.LayerFromFile(layerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.StoreImage(img, "base"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.RunContainer(image.RunContainerOptions{
+		Name:    "container",
+		ImageId: "base",
+		Options: &image.StageImageContainerOptions{User: "app"},
+		Args:    []string{"/bin/true"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := backend.getContainer("container")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(c.bundleDir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spec specs.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := (specs.User{UID: 1000, GID: 1001}); fmt.Sprintf("%+v", spec.Process.User) != fmt.Sprintf("%+v", expected) {
+		t.Errorf("container user:\n[EXPECTED]: %+v\n[GOT]: %+v", expected, spec.Process.User)
+	}
+
+	expectedUidMappings := []specs.LinuxIDMapping{{ContainerID: 0, HostID: hostUid, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}}
+	if fmt.Sprintf("%v", spec.Linux.UIDMappings) != fmt.Sprintf("%v", expectedUidMappings) {
+		t.Errorf("uid mappings:\n[EXPECTED]: %v\n[GOT]: %v", expectedUidMappings, spec.Linux.UIDMappings)
+	}
+
+	imageId, err := backend.CommitContainer("container", &image.StageImageContainerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.RemoveContainer("container"); err != nil {
+		t.Fatal(err)
+	}
+
+	committedImg, err := l.GetImage(imageId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := committedImg.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := layers[len(layers)-1].Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var got []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, fmt.Sprintf("%s %d:%d", hdr.Name, hdr.Uid, hdr.Gid))
+	}
+
+	expected := []string{
+		"home/app/config 1000:1001",
+		"home/app/new 0:0",
+	}
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", expected) {
+		t.Errorf("committed layer:\n[EXPECTED]:\n%v\n[GOT]:\n%v", expected, got)
+	}
+}
+
+func writeTestTar(t *testing.T, path string, headers []*tar.Header) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size != 0 {
+			if _, err := tw.Write([]byte(testPasswd)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
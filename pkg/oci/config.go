@@ -0,0 +1,265 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/flant/werf/pkg/image"
+)
+
+// applyCommitOptions changes the image config the same way as docker commit with the changes from image.StageImageContainerOptions
+func applyCommitOptions(config *v1.Config, opts *image.StageImageContainerOptions) error {
+	for _, volume := range opts.Volume {
+		volumes, err := parseJsonOrFields(volume)
+		if err != nil {
+			return fmt.Errorf("bad volume %q: %s", volume, err)
+		}
+
+		for _, v := range volumes {
+			if config.Volumes == nil {
+				config.Volumes = map[string]struct{}{}
+			}
+			config.Volumes[v] = struct{}{}
+		}
+	}
+
+	for _, expose := range opts.Expose {
+		for _, e := range strings.Fields(expose) {
+			if !strings.Contains(e, "/") {
+				e += "/tcp"
+			}
+
+			if config.ExposedPorts == nil {
+				config.ExposedPorts = map[string]struct{}{}
+			}
+			config.ExposedPorts[e] = struct{}{}
+		}
+	}
+
+	config.Env = mergeEnv(config.Env, opts.Env)
+
+	if len(opts.Label) != 0 && config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	for key, value := range opts.Label {
+		config.Labels[key] = value
+	}
+
+	if opts.Workdir != "" {
+		config.WorkingDir = opts.Workdir
+	}
+
+	if opts.User != "" {
+		config.User = opts.User
+	}
+
+	// the empty entrypoint resets the entrypoint and the cmd of the base image
+	if opts.Entrypoint != "" {
+		entrypoint, err := parseCommand(opts.Entrypoint)
+		if err != nil {
+			return fmt.Errorf("bad entrypoint %q: %s", opts.Entrypoint, err)
+		}
+		config.Entrypoint = entrypoint
+	} else {
+		config.Entrypoint = nil
+	}
+
+	if opts.Cmd != "" {
+		cmd, err := parseCommand(opts.Cmd)
+		if err != nil {
+			return fmt.Errorf("bad cmd %q: %s", opts.Cmd, err)
+		}
+		config.Cmd = cmd
+	} else if opts.Entrypoint == "" {
+		config.Cmd = nil
+	}
+
+	if opts.HealthCheck != "" {
+		healthcheck, err := parseHealthCheck(opts.HealthCheck)
+		if err != nil {
+			return fmt.Errorf("bad healthcheck %q: %s", opts.HealthCheck, err)
+		}
+		config.Healthcheck = healthcheck
+	}
+
+	return nil
+}
+
+func mergeEnv(env []string, newEnv map[string]string) []string {
+	var result []string
+	for _, e := range env {
+		if _, exists := newEnv[strings.SplitN(e, "=", 2)[0]]; !exists {
+			result = append(result, e)
+		}
+	}
+
+	var keys []string
+	for key := range newEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result = append(result, fmt.Sprintf("%s=%s", key, newEnv[key]))
+	}
+
+	return result
+}
+
+// parseCommand parses the exec form (JSON array) and the shell form of CMD and ENTRYPOINT instructions
+func parseCommand(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		var command []string
+		if err := json.Unmarshal([]byte(value), &command); err != nil {
+			return nil, err
+		}
+		return command, nil
+	}
+
+	return []string{"/bin/sh", "-c", value}, nil
+}
+
+func parseJsonOrFields(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		var values []string
+		if err := json.Unmarshal([]byte(value), &values); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+
+	return strings.Fields(value), nil
+}
+
+// parseHealthCheck parses the HEALTHCHECK instruction value: [OPTIONS] CMD command or NONE
+func parseHealthCheck(value string) (*v1.HealthConfig, error) {
+	healthcheck := &v1.HealthConfig{}
+
+	rest := strings.TrimSpace(value)
+	for strings.HasPrefix(rest, "--") {
+		parts := strings.SplitN(rest, " ", 2)
+		option := strings.SplitN(strings.TrimPrefix(parts[0], "--"), "=", 2)
+		if len(option) != 2 {
+			return nil, fmt.Errorf("bad option %q", parts[0])
+		}
+
+		switch option[0] {
+		case "interval", "timeout", "start-period":
+			d, err := time.ParseDuration(option[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad option %q: %s", parts[0], err)
+			}
+
+			switch option[0] {
+			case "interval":
+				healthcheck.Interval = d
+			case "timeout":
+				healthcheck.Timeout = d
+			default:
+				healthcheck.StartPeriod = d
+			}
+		case "retries":
+			retries, err := strconv.Atoi(option[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad option %q: %s", parts[0], err)
+			}
+			healthcheck.Retries = retries
+		default:
+			return nil, fmt.Errorf("unknown option %q", parts[0])
+		}
+
+		if len(parts) == 1 {
+			rest = ""
+		} else {
+			rest = strings.TrimSpace(parts[1])
+		}
+	}
+
+	parts := strings.SplitN(rest, " ", 2)
+	switch strings.ToUpper(parts[0]) {
+	case "NONE":
+		healthcheck.Test = []string{"NONE"}
+	case "CMD":
+		if len(parts) == 1 {
+			return nil, fmt.Errorf("command is not specified")
+		}
+
+		command := strings.TrimSpace(parts[1])
+		if strings.HasPrefix(command, "[") {
+			var args []string
+			if err := json.Unmarshal([]byte(command), &args); err != nil {
+				return nil, err
+			}
+			healthcheck.Test = append([]string{"CMD"}, args...)
+		} else {
+			healthcheck.Test = []string{"CMD-SHELL", command}
+		}
+	default:
+		return nil, fmt.Errorf("NONE or CMD expected")
+	}
+
+	return healthcheck, nil
+}
+
+// newImageInspect makes the docker image inspect from the image config, which is used by werf stages
+func newImageInspect(imageId string, refs []string, configFile *v1.ConfigFile, size int64) *types.ImageInspect {
+	inspect := &types.ImageInspect{
+		ID:           imageId,
+		RepoTags:     refs,
+		Created:      configFile.Created.Format(time.RFC3339Nano),
+		Author:       configFile.Author,
+		Architecture: configFile.Architecture,
+		Os:           configFile.OS,
+		Size:         size,
+		VirtualSize:  size,
+	}
+
+	config := configFile.Config
+	inspect.Config = &container.Config{
+		User:       config.User,
+		Env:        config.Env,
+		Cmd:        config.Cmd,
+		Entrypoint: config.Entrypoint,
+		WorkingDir: config.WorkingDir,
+		Labels:     config.Labels,
+		StopSignal: config.StopSignal,
+		Shell:      config.Shell,
+	}
+
+	if len(config.ExposedPorts) != 0 {
+		inspect.Config.ExposedPorts = nat.PortSet{}
+		for port := range config.ExposedPorts {
+			inspect.Config.ExposedPorts[nat.Port(port)] = struct{}{}
+		}
+	}
+
+	if len(config.Volumes) != 0 {
+		inspect.Config.Volumes = map[string]struct{}{}
+		for volume := range config.Volumes {
+			inspect.Config.Volumes[volume] = struct{}{}
+		}
+	}
+
+	if config.Healthcheck != nil {
+		inspect.Config.Healthcheck = &container.HealthConfig{
+			Test:        config.Healthcheck.Test,
+			Interval:    config.Healthcheck.Interval,
+			Timeout:     config.Healthcheck.Timeout,
+			StartPeriod: config.Healthcheck.StartPeriod,
+			Retries:     config.Healthcheck.Retries,
+		}
+	}
+
+	return inspect
+}
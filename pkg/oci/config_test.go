@@ -0,0 +1,74 @@
+package oci
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/flant/werf/pkg/image"
+)
+
+func TestApplyCommitOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   v1.Config
+		opts     image.StageImageContainerOptions
+		expected v1.Config
+	}{
+		{
+			name:   "inherited entrypoint and cmd",
+			config: v1.Config{Env: []string{"PATH=/bin", "LANG=C"}, Entrypoint: []string{"/entrypoint.sh"}, Cmd: []string{"run"}},
+			opts: image.StageImageContainerOptions{
+				Env:        map[string]string{"LANG": "C.UTF-8", "APP": "1"},
+				Label:      map[string]string{"werf-image": "true"},
+				Entrypoint: `["/entrypoint.sh"]`,
+				Cmd:        `["run"]`,
+				Workdir:    "/app",
+				User:       "0:0",
+			},
+			expected: v1.Config{
+				Env:        []string{"PATH=/bin", "APP=1", "LANG=C.UTF-8"},
+				Labels:     map[string]string{"werf-image": "true"},
+				Entrypoint: []string{"/entrypoint.sh"},
+				Cmd:        []string{"run"},
+				WorkingDir: "/app",
+				User:       "0:0",
+			},
+		},
+		{
+			name:   "empty entrypoint resets cmd",
+			config: v1.Config{Entrypoint: []string{"/entrypoint.sh"}, Cmd: []string{"run"}},
+			opts:   image.StageImageContainerOptions{},
+		},
+		{
+			name:   "shell form, volumes, exposes and healthcheck",
+			config: v1.Config{},
+			opts: image.StageImageContainerOptions{
+				Cmd:         "nginx -g 'daemon off;'",
+				Volume:      []string{"/data", `["/cache", "/logs"]`},
+				Expose:      []string{"80", "53/udp"},
+				HealthCheck: "--interval=5s --retries=3 CMD curl -f http://localhost/",
+			},
+			expected: v1.Config{
+				Cmd:          []string{"/bin/sh", "-c", "nginx -g 'daemon off;'"},
+				Volumes:      map[string]struct{}{"/data": {}, "/cache": {}, "/logs": {}},
+				ExposedPorts: map[string]struct{}{"80/tcp": {}, "53/udp": {}},
+				Healthcheck:  &v1.HealthConfig{Test: []string{"CMD-SHELL", "curl -f http://localhost/"}, Interval: 5000000000, Retries: 3},
+			},
+		},
+	} {
+		config := tc.config
+		opts := tc.opts
+		if err := applyCommitOptions(&config, &opts); err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+
+		expected, _ := json.Marshal(tc.expected)
+		got, _ := json.Marshal(config)
+		if string(expected) != string(got) {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", tc.name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package oci
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// idMappings map the current user to the container root and the subordinate ids of the user to the container ids starting from 1
+type idMappings struct {
+	Uid []specs.LinuxIDMapping
+	Gid []specs.LinuxIDMapping
+}
+
+type idRange struct {
+	Start uint32
+	Size  uint32
+}
+
+func newIDMappings(hostUid, hostGid uint32, subUids, subGids *idRange) idMappings {
+	ids := idMappings{
+		Uid: []specs.LinuxIDMapping{{ContainerID: 0, HostID: hostUid, Size: 1}},
+		Gid: []specs.LinuxIDMapping{{ContainerID: 0, HostID: hostGid, Size: 1}},
+	}
+
+	if subUids != nil && subGids != nil {
+		ids.Uid = append(ids.Uid, specs.LinuxIDMapping{ContainerID: 1, HostID: subUids.Start, Size: subUids.Size})
+		ids.Gid = append(ids.Gid, specs.LinuxIDMapping{ContainerID: 1, HostID: subGids.Start, Size: subGids.Size})
+	}
+
+	return ids
+}
+
+// lookupIDMappings uses the subordinate ids of the current user from /etc/subuid and /etc/subgid,
+// the ranges are mapped by runc with newuidmap and newgidmap, so only the container root is available without these binaries
+func lookupIDMappings() (idMappings, error) {
+	hostUid, hostGid := uint32(os.Getuid()), uint32(os.Getgid())
+	ids := newIDMappings(hostUid, hostGid, nil, nil)
+
+	for _, name := range []string{"newuidmap", "newgidmap"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return ids, nil
+		}
+	}
+
+	var userName string
+	if u, err := user.Current(); err == nil {
+		userName = u.Username
+	}
+
+	subUids, err := lookupSubordinateIDs("/etc/subuid", userName, hostUid)
+	if err != nil {
+		return idMappings{}, err
+	}
+
+	subGids, err := lookupSubordinateIDs("/etc/subgid", userName, hostUid)
+	if err != nil {
+		return idMappings{}, err
+	}
+
+	return newIDMappings(hostUid, hostGid, subUids, subGids), nil
+}
+
+func lookupSubordinateIDs(path, userName string, uid uint32) (*idRange, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := parseSubordinateIDs(f, userName, uid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	return r, nil
+}
+
+// parseSubordinateIDs returns the first range of the user (login name or uid) in the subuid or subgid format
+func parseSubordinateIDs(r io.Reader, userName string, uid uint32) (*idRange, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Split(line, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("bad line %q", line)
+		}
+
+		if parts[0] != userName && parts[0] != strconv.FormatUint(uint64(uid), 10) {
+			continue
+		}
+
+		start, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad line %q: %s", line, err)
+		}
+
+		size, err := strconv.ParseUint(parts[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad line %q: %s", line, err)
+		}
+
+		if size == 0 {
+			continue
+		}
+
+		return &idRange{Start: uint32(start), Size: uint32(size)}, nil
+	}
+
+	return nil, scanner.Err()
+}
+
+// containerOwner maps the host owner of the rootfs file to the container owner,
+// the owner not mapped into the container is replaced by root
+func (ids idMappings) containerOwner(hostUid, hostGid uint32) (uint32, uint32) {
+	return toContainerID(ids.Uid, hostUid), toContainerID(ids.Gid, hostGid)
+}
+
+func toContainerID(mappings []specs.LinuxIDMapping, hostID uint32) uint32 {
+	for _, m := range mappings {
+		if hostID >= m.HostID && hostID-m.HostID < m.Size {
+			return m.ContainerID + hostID - m.HostID
+		}
+	}
+
+	return 0
+}
+
+func isContainerIDMapped(mappings []specs.LinuxIDMapping, id uint32) bool {
+	for _, m := range mappings {
+		if id >= m.ContainerID && id-m.ContainerID < m.Size {
+			return true
+		}
+	}
+
+	return false
+}
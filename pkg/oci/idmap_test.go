@@ -0,0 +1,131 @@
+package oci
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSubordinateIDs(t *testing.T) {
+	data := `# comment
+builder:100000:65536
+1001:300000:0
+1001:200000:1000
+`
+
+	for _, test := range []struct {
+		userName string
+		uid      uint32
+		expected *idRange
+	}{
+		{"builder", 1000, &idRange{Start: 100000, Size: 65536}},
+		{"other", 1001, &idRange{Start: 200000, Size: 1000}},
+		{"other", 1002, nil},
+	} {
+		r, err := parseSubordinateIDs(strings.NewReader(data), test.userName, test.uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprintf("%+v", r) != fmt.Sprintf("%+v", test.expected) {
+			t.Errorf("%s (%d):\n[EXPECTED]: %+v\n[GOT]: %+v", test.userName, test.uid, test.expected, r)
+		}
+	}
+
+	if _, err := parseSubordinateIDs(strings.NewReader("builder:100000"), "builder", 1000); err == nil {
+		t.Errorf("expected error for the bad line")
+	}
+}
+
+func TestIDMappings_containerOwner(t *testing.T) {
+	ids := newIDMappings(1000, 1000, &idRange{Start: 100000, Size: 65536}, &idRange{Start: 200000, Size: 65536})
+
+	for _, test := range []struct {
+		hostUid, hostGid uint32
+		expected         string
+	}{
+		{1000, 1000, "0:0"},
+		{100000, 200000, "1:1"},
+		{100999, 200099, "1000:100"},
+		// the ids not mapped into the container
+		{2000, 300000, "0:0"},
+	} {
+		uid, gid := ids.containerOwner(test.hostUid, test.hostGid)
+		if got := fmt.Sprintf("%d:%d", uid, gid); got != test.expected {
+			t.Errorf("%d:%d:\n[EXPECTED]: %s\n[GOT]: %s", test.hostUid, test.hostGid, test.expected, got)
+		}
+	}
+}
+
+func TestRootlessOwner(t *testing.T) {
+	for _, owner := range [][2]uint32{{1000, 1001}, {0, 50}, {70, 0}, {0, 0}} {
+		uid, gid, err := unmarshalRootlessOwner(marshalRootlessOwner(owner[0], owner[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if uid != owner[0] || gid != owner[1] {
+			t.Errorf("\n[EXPECTED]: %d:%d\n[GOT]: %d:%d", owner[0], owner[1], uid, gid)
+		}
+	}
+
+	// umoci marks the id of the rootless user by the noop id
+	if uid, gid, err := unmarshalRootlessOwner(marshalRootlessOwner(noopOwnerID, 33)); err != nil {
+		t.Fatal(err)
+	} else if uid != 0 || gid != 33 {
+		t.Errorf("\n[EXPECTED]: 0:33\n[GOT]: %d:%d", uid, gid)
+	}
+
+	if _, _, err := unmarshalRootlessOwner([]byte{0x0a, 0x01, 0x00}); err == nil {
+		t.Errorf("expected error for the unexpected wire type")
+	}
+}
+
+func TestParseUser(t *testing.T) {
+	rootfsDir, err := ioutil.TempDir("", "werf-oci-user-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfsDir)
+
+	writeTestFile(t, filepath.Join(rootfsDir, "etc/passwd"), "root:x:0:0:root:/root:/bin/sh\napp:x:1000:1001::/home/app:/bin/sh\n")
+	writeTestFile(t, filepath.Join(rootfsDir, "etc/group"), "root:x:0:\nwww:x:33:app\n")
+
+	rootOnly := newIDMappings(1000, 1000, nil, nil)
+	subordinate := newIDMappings(1000, 1000, &idRange{Start: 100000, Size: 65536}, &idRange{Start: 100000, Size: 65536})
+
+	for _, test := range []struct {
+		user          string
+		ids           idMappings
+		expected      string
+		expectedError string
+	}{
+		{user: "", ids: rootOnly, expected: "0:0"},
+		{user: "root", ids: rootOnly, expected: "0:0"},
+		{user: "0:root", ids: rootOnly, expected: "0:0"},
+		{user: "app", ids: rootOnly, expectedError: "only root user is available"},
+		{user: "app", ids: subordinate, expected: "1000:1001"},
+		{user: "app:www", ids: subordinate, expected: "1000:33"},
+		{user: "1000", ids: subordinate, expected: "1000:0"},
+		{user: "100000", ids: subordinate, expectedError: "only root user is available"},
+		{user: "nobody", ids: subordinate, expectedError: "nobody not found in /etc/passwd"},
+	} {
+		user, err := parseUser(test.user, rootfsDir, test.ids)
+		if test.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("%q:\n[EXPECTED]: %s\n[GOT]: %v", test.user, test.expectedError, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.user, err)
+		} else if got := fmt.Sprintf("%d:%d", user.UID, user.GID); got != test.expected {
+			t.Errorf("%q:\n[EXPECTED]: %s\n[GOT]: %s", test.user, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/werf"
+)
+
+const (
+	ImageIdAnnotation = "werf.io/image-id"
+
+	layoutLockName = "oci_layout"
+)
+
+// Layout stores images in the OCI image layout on disk,
+// the image is referenced by the ref name annotation of the index descriptor or by the image id (config digest)
+type Layout struct {
+	path  layout.Path
+	mutex sync.RWMutex
+}
+
+func NewLayout(dir string) (*Layout, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+
+		path, err := layout.Write(dir, empty.Index)
+		if err != nil {
+			return nil, fmt.Errorf("unable to init oci layout %s: %s", dir, err)
+		}
+
+		return &Layout{path: path}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	path, err := layout.FromPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open oci layout %s: %s", dir, err)
+	}
+
+	return &Layout{path: path}, nil
+}
+
+// GetImage returns nil without error when the image does not exist
+func (l *Layout) GetImage(ref string) (v1.Image, error) {
+	var desc *v1.Descriptor
+	if err := l.withIndexReadLock(func() error {
+		var err error
+		desc, err = l.findDescriptor(ref)
+		return err
+	}); err != nil || desc == nil {
+		return nil, err
+	}
+
+	return l.path.Image(desc.Digest)
+}
+
+// GetImageRefs returns all ref names of the image
+func (l *Layout) GetImageRefs(imageId string) ([]string, error) {
+	var indexManifest *v1.IndexManifest
+	if err := l.withIndexReadLock(func() error {
+		var err error
+		indexManifest, err = l.readIndexManifest()
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, desc := range indexManifest.Manifests {
+		if desc.Annotations[ImageIdAnnotation] != imageId {
+			continue
+		}
+
+		if ref := desc.Annotations[imagespec.AnnotationRefName]; ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// StoreImage writes the image blobs and references the image by ref (or only by the image id when ref is empty),
+// the previous image with the same ref loses the ref
+func (l *Layout) StoreImage(img v1.Image, ref string) (string, error) {
+	configName, err := img.ConfigName()
+	if err != nil {
+		return "", err
+	}
+	imageId := configName.String()
+
+	annotations := map[string]string{ImageIdAnnotation: imageId}
+	if ref != "" {
+		annotations[imagespec.AnnotationRefName] = normalizeRef(ref)
+	}
+
+	return imageId, l.withIndexLock(func() error {
+		if err := l.removeDescriptors(func(desc v1.Descriptor) bool {
+			return ref != "" && desc.Annotations[imagespec.AnnotationRefName] == normalizeRef(ref) ||
+				ref == "" && desc.Annotations[ImageIdAnnotation] == imageId && desc.Annotations[imagespec.AnnotationRefName] == ""
+		}); err != nil {
+			return err
+		}
+
+		return l.path.AppendImage(img, layout.WithAnnotations(annotations))
+	})
+}
+
+func (l *Layout) Tag(ref, newRef string) error {
+	return l.withIndexLock(func() error {
+		desc, err := l.findDescriptor(ref)
+		if err != nil {
+			return err
+		}
+		if desc == nil {
+			return fmt.Errorf("no such image: %s", ref)
+		}
+
+		if err := l.removeDescriptors(func(d v1.Descriptor) bool {
+			return d.Annotations[imagespec.AnnotationRefName] == normalizeRef(newRef)
+		}); err != nil {
+			return err
+		}
+
+		newDesc := *desc
+		newDesc.Annotations = map[string]string{
+			ImageIdAnnotation:           desc.Annotations[ImageIdAnnotation],
+			imagespec.AnnotationRefName: normalizeRef(newRef),
+		}
+
+		return l.path.AppendDescriptor(newDesc)
+	})
+}
+
+// Untag removes the ref of the image or all refs of the image when ref is the image id,
+// blobs are not removed and the whole layout directory could be removed to free space
+func (l *Layout) Untag(ref string) error {
+	return l.withIndexLock(func() error {
+		desc, err := l.findDescriptor(ref)
+		if err != nil {
+			return err
+		}
+		if desc == nil {
+			return fmt.Errorf("no such image: %s", ref)
+		}
+
+		if isImageId(ref) {
+			return l.removeDescriptors(func(d v1.Descriptor) bool {
+				return d.Annotations[ImageIdAnnotation] == ref
+			})
+		}
+
+		return l.removeDescriptors(func(d v1.Descriptor) bool {
+			return d.Annotations[imagespec.AnnotationRefName] == normalizeRef(ref)
+		})
+	})
+}
+
+func (l *Layout) findDescriptor(ref string) (*v1.Descriptor, error) {
+	indexManifest, err := l.readIndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range indexManifest.Manifests {
+		desc := indexManifest.Manifests[i]
+
+		if isImageId(ref) {
+			if desc.Annotations[ImageIdAnnotation] == ref {
+				return &desc, nil
+			}
+		} else if desc.Annotations[imagespec.AnnotationRefName] == normalizeRef(ref) {
+			return &desc, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (l *Layout) removeDescriptors(f func(desc v1.Descriptor) bool) error {
+	indexManifest, err := l.readIndexManifest()
+	if err != nil {
+		return err
+	}
+
+	var manifests []v1.Descriptor
+	for _, desc := range indexManifest.Manifests {
+		if !f(desc) {
+			manifests = append(manifests, desc)
+		}
+	}
+
+	if len(manifests) == len(indexManifest.Manifests) {
+		return nil
+	}
+
+	indexManifest.Manifests = manifests
+	data, err := json.MarshalIndent(indexManifest, "", "   ")
+	if err != nil {
+		return err
+	}
+
+	return l.path.WriteFile("index.json", data, os.ModePerm)
+}
+
+func (l *Layout) readIndexManifest() (*v1.IndexManifest, error) {
+	index, err := l.path.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.IndexManifest()
+}
+
+// withIndexLock serializes index.json changes between goroutines and werf processes
+func (l *Layout) withIndexLock(f func() error) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return werf.WithHostLock(layoutLockName, shluz.LockOptions{}, f)
+}
+
+func (l *Layout) withIndexReadLock(f func() error) error {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return werf.WithHostLock(layoutLockName, shluz.LockOptions{ReadOnly: true}, f)
+}
+
+func isImageId(ref string) bool {
+	return strings.HasPrefix(ref, "sha256:")
+}
+
+// normalizeRef makes the same ref name for the different forms of reference (alpine, library/alpine:latest, index.docker.io/library/alpine:latest)
+func normalizeRef(ref string) string {
+	r, err := name.ParseReference(ref, name.WeakValidation)
+	if err != nil {
+		return ref
+	}
+
+	return r.Name()
+}
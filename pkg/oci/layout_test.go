@@ -0,0 +1,83 @@
+package oci
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/flant/shluz"
+)
+
+func TestLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-oci-layout-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := shluz.Init(filepath.Join(dir, "locks")); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imageId, err := l.StoreImage(img, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Tag(imageId, "alpine"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Tag("alpine:latest", "registry.example.com/stages:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := l.GetImageRefs(imageId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"index.docker.io/library/alpine:latest", "registry.example.com/stages:1"}
+	if fmt.Sprintf("%v", refs) != fmt.Sprintf("%v", expected) {
+		t.Errorf("image refs:\n[EXPECTED]:\n%v\n[GOT]:\n%v", expected, refs)
+	}
+
+	if err := l.Untag("registry.example.com/stages:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if i, err := l.GetImage("registry.example.com/stages:1"); err != nil {
+		t.Fatal(err)
+	} else if i != nil {
+		t.Errorf("untagged image should not be found")
+	}
+
+	if i, err := l.GetImage("alpine"); err != nil {
+		t.Fatal(err)
+	} else if i == nil {
+		t.Errorf("image should be found by ref")
+	}
+
+	if err := l.Untag(imageId); err != nil {
+		t.Fatal(err)
+	}
+
+	if i, err := l.GetImage("alpine"); err != nil {
+		t.Fatal(err)
+	} else if i != nil {
+		t.Errorf("image removed by id should not be found by ref")
+	}
+}
@@ -0,0 +1,120 @@
+package oci
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// rootlessOwnerXattr keeps the owner of the rootfs file, which cannot be set by the unprivileged user,
+// the value is the Resource message of github.com/rootless-containers/proto as umoci stores it
+const rootlessOwnerXattr = "user.rootlesscontainers"
+
+// noopOwnerID means the id of the rootless user (the container root)
+const noopOwnerID = math.MaxUint32
+
+func marshalRootlessOwner(uid, gid uint32) []byte {
+	var data []byte
+	for _, field := range []struct {
+		number uint64
+		value  uint32
+	}{{1, uid}, {2, gid}} {
+		// zero values are omitted in proto3
+		if field.value == 0 {
+			continue
+		}
+
+		data = appendUvarint(data, field.number<<3)
+		data = appendUvarint(data, uint64(field.value))
+	}
+
+	return data
+}
+
+func unmarshalRootlessOwner(data []byte) (uint32, uint32, error) {
+	var uid, gid uint32
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, 0, fmt.Errorf("bad %s value", rootlessOwnerXattr)
+		}
+		data = data[n:]
+
+		// only varint fields are expected
+		if key&7 != 0 {
+			return 0, 0, fmt.Errorf("bad %s value: unexpected wire type %d", rootlessOwnerXattr, key&7)
+		}
+
+		value, n := binary.Uvarint(data)
+		if n <= 0 || value > math.MaxUint32 {
+			return 0, 0, fmt.Errorf("bad %s value", rootlessOwnerXattr)
+		}
+		data = data[n:]
+
+		switch key >> 3 {
+		case 1:
+			uid = uint32(value)
+		case 2:
+			gid = uint32(value)
+		}
+	}
+
+	if uid == noopOwnerID {
+		uid = 0
+	}
+	if gid == noopOwnerID {
+		gid = 0
+	}
+
+	return uid, gid, nil
+}
+
+func appendUvarint(data []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(data, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+// setRootlessOwner saves the image owner of the file unpacked by the current user (the container root),
+// symlinks cannot have user xattrs, so the owner of symlinks is not preserved
+func setRootlessOwner(path string, uid, gid uint32) error {
+	if uid == 0 && gid == 0 {
+		return nil
+	}
+
+	if err := setXattr(path, rootlessOwnerXattr, marshalRootlessOwner(uid, gid)); err != nil {
+		return fmt.Errorf("unable to preserve owner %d:%d of %s: %s", uid, gid, path, err)
+	}
+
+	return nil
+}
+
+// fileOwner returns the container owner of the rootfs file:
+// the files of the container root get the owner saved on unpacking, the files of other users are mapped from the subordinate ids
+func fileOwner(path string, hostUid, hostGid uint32, ids idMappings) (uint32, uint32, error) {
+	uid, gid := ids.containerOwner(hostUid, hostGid)
+	if uid != 0 && gid != 0 {
+		return uid, gid, nil
+	}
+
+	data, err := getXattr(path, rootlessOwnerXattr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to get owner of %s: %s", path, err)
+	} else if data == nil {
+		return uid, gid, nil
+	}
+
+	savedUid, savedGid, err := unmarshalRootlessOwner(data)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to get owner of %s: %s", path, err)
+	}
+
+	if uid == 0 {
+		uid = savedUid
+	}
+	if gid == 0 {
+		gid = savedGid
+	}
+
+	return uid, gid, nil
+}
@@ -0,0 +1,45 @@
+// +build linux
+
+package oci
+
+import (
+	"os"
+	"syscall"
+)
+
+func hostOwner(info os.FileInfo) (uint32, uint32) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Uid, stat.Gid
+	}
+
+	return uint32(os.Getuid()), uint32(os.Getgid())
+}
+
+// getXattr returns nil if the file has no such xattr
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err == syscall.ENODATA || err == syscall.ENOTSUP {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, size)
+		n, err := syscall.Getxattr(path, name, data)
+		if err == syscall.ERANGE {
+			// the value is changed between the calls
+			continue
+		} else if err == syscall.ENODATA {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		return data[:n], nil
+	}
+}
+
+func setXattr(path, name string, value []byte) error {
+	return syscall.Setxattr(path, name, value, 0)
+}
@@ -0,0 +1,20 @@
+// +build !linux
+
+package oci
+
+import (
+	"fmt"
+	"os"
+)
+
+func hostOwner(_ os.FileInfo) (uint32, uint32) {
+	return uint32(os.Getuid()), uint32(os.Getgid())
+}
+
+func getXattr(_, _ string) ([]byte, error) {
+	return nil, nil
+}
+
+func setXattr(_, _ string, _ []byte) error {
+	return fmt.Errorf("xattrs are not supported by %s container runtime on this platform", ContainerRuntime)
+}
@@ -0,0 +1,389 @@
+package oci
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const whiteoutPrefix = ".wh."
+
+// unpackRootfs writes the flattened image filesystem tar into the dir without the root privileges:
+// files are owned by the current user and other owners are saved in the xattr, device nodes are skipped,
+// paths can be filtered by the prefix (the prefix is cut from the resulting path)
+func unpackRootfs(r io.Reader, dir, prefix string) error {
+	type dirAttrs struct {
+		path    string
+		mode    os.FileMode
+		modTime time.Time
+	}
+	var dirs []dirAttrs
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("unable to read tar: %s", err)
+		}
+
+		relPath, ok := cutPrefix(hdr.Name, prefix)
+		if !ok {
+			continue
+		}
+
+		path, err := securePath(dir, relPath)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeSymlink, tar.TypeLink:
+		default:
+			// device nodes and fifos cannot be created by the unprivileged user
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		mode := hdr.FileInfo().Mode()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			// directory mode is set after all files are written, because the directory could be not writable
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			if err := setRootlessOwner(path, uint32(hdr.Uid), uint32(hdr.Gid)); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirAttrs{path: path, mode: mode, modTime: hdr.ModTime})
+			continue
+
+		case tar.TypeReg:
+			if err := removeIfExists(path); err != nil {
+				return err
+			}
+
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			if err := setRootlessOwner(path, uint32(hdr.Uid), uint32(hdr.Gid)); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := removeIfExists(path); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+			continue
+
+		case tar.TypeLink:
+			relLinkPath, ok := cutPrefix(hdr.Linkname, prefix)
+			if !ok {
+				continue
+			}
+
+			linkPath, err := securePath(dir, relLinkPath)
+			if err != nil {
+				return err
+			}
+
+			if err := removeIfExists(path); err != nil {
+				return err
+			}
+			if err := os.Link(linkPath, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.Chmod(path, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+		if err := os.Chtimes(path, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err := os.Chmod(d.path, d.mode.Perm()|d.mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type fileState struct {
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+	Link    string
+	// Uid and Gid are the host owner, which is changed when the container changes the owner to the subordinate id
+	Uid uint32
+	Gid uint32
+}
+
+// snapshotRootfs saves the state of the files to find the changes made by the container
+func snapshotRootfs(dir string) (map[string]fileState, error) {
+	snapshot := map[string]fileState{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == dir {
+			return nil
+		}
+
+		state, err := newFileState(path, info)
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		snapshot[filepath.ToSlash(relPath)] = state
+
+		return nil
+	})
+
+	return snapshot, err
+}
+
+// writeRootfsDiff writes the layer tar with the new and changed files and the whiteouts for the removed files,
+// the owners of the files are mapped back to the container ids
+func writeRootfsDiff(dir string, snapshot map[string]fileState, ids idMappings, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	existingPaths := map[string]bool{}
+
+	var changedPaths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == dir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		existingPaths[relPath] = true
+
+		state, err := newFileState(path, info)
+		if err != nil {
+			return err
+		}
+
+		if oldState, exists := snapshot[relPath]; exists {
+			// the modification time of the directory is changed when the content of the directory is changed
+			if info.IsDir() && oldState.Mode == state.Mode {
+				return nil
+			} else if oldState == state {
+				return nil
+			}
+		}
+
+		changedPaths = append(changedPaths, relPath)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var removedPaths []string
+	for relPath := range snapshot {
+		if existingPaths[relPath] {
+			continue
+		}
+
+		// the whiteout of the parent directory removes all files in the directory
+		if parent := filepath.ToSlash(filepath.Dir(relPath)); parent != "." && !existingPaths[parent] {
+			continue
+		}
+
+		removedPaths = append(removedPaths, relPath)
+	}
+	sort.Strings(removedPaths)
+
+	for _, relPath := range removedPaths {
+		whiteoutPath := filepath.ToSlash(filepath.Join(filepath.Dir(relPath), whiteoutPrefix+filepath.Base(relPath)))
+
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     whiteoutPath,
+			Mode:     0600,
+			ModTime:  time.Now(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, relPath := range changedPaths {
+		if err := writeTarEntry(tw, filepath.Join(dir, filepath.FromSlash(relPath)), relPath, ids); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// removeMountpoints removes the mountpoints and the parent directories, which are created by the runtime
+// for the container mounts, so that they do not get into the layer
+func removeMountpoints(dir string, snapshot map[string]fileState, destinations []string) {
+	// nested mountpoints are removed first
+	sorted := append([]string{}, destinations...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, destination := range sorted {
+		for relPath := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+destination)), "/"); relPath != "" && relPath != "."; relPath = filepath.ToSlash(filepath.Dir(relPath)) {
+			if _, exists := snapshot[relPath]; exists {
+				break
+			}
+
+			// the directory is not empty when it contains other mountpoints or the files created by the container
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(relPath))); err != nil && !os.IsNotExist(err) {
+				break
+			}
+		}
+	}
+}
+
+func writeTarEntry(tw *tar.Writer, path, relPath string, ids idMappings) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = relPath
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hostUid, hostGid := hostOwner(info)
+	uid, gid := ids.containerOwner(hostUid, hostGid)
+	// symlinks cannot have user xattrs
+	if info.Mode()&os.ModeSymlink == 0 {
+		if uid, gid, err = fileOwner(path, hostUid, hostGid, ids); err != nil {
+			return err
+		}
+	}
+
+	hdr.Uid, hdr.Gid = int(uid), int(gid)
+	hdr.Uname, hdr.Gname = "", ""
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func newFileState(path string, info os.FileInfo) (fileState, error) {
+	state := fileState{Mode: info.Mode(), Size: info.Size(), ModTime: info.ModTime()}
+	state.Uid, state.Gid = hostOwner(info)
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(path)
+		if err != nil {
+			return fileState{}, err
+		}
+		state.Link = link
+	}
+
+	return state, nil
+}
+
+func cutPrefix(tarPath, prefix string) (string, bool) {
+	p := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+tarPath)), "/")
+	if prefix == "" {
+		return p, p != ""
+	}
+
+	if p == prefix || !strings.HasPrefix(p, prefix+"/") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(p, prefix+"/"), true
+}
+
+// securePath does not allow to write outside the dir by the tar entry path or through the symlink in the path
+func securePath(dir, relPath string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(relPath))
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("bad tar entry path %q", relPath)
+	}
+
+	for parent := filepath.Dir(path); parent != dir && strings.HasPrefix(parent, dir); parent = filepath.Dir(parent) {
+		if info, err := os.Lstat(parent); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("bad tar entry path %q: parent directory is a symlink", relPath)
+		}
+	}
+
+	return path, nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRootfsDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-oci-rootfs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{"etc/os-release", "etc/apt/sources.list", "var/lib/apt/lists/a", "var/lib/apt/lists/b", "usr/bin/true"} {
+		writeTestFile(t, filepath.Join(dir, path), "base")
+	}
+
+	snapshot, err := snapshotRootfs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// container changes
+	if err := os.RemoveAll(filepath.Join(dir, "var/lib/apt/lists")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "etc/os-release")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "etc/apt/sources.list"), "changed")
+	writeTestFile(t, filepath.Join(dir, "app/main.sh"), "new")
+	if err := os.Symlink("/app/main.sh", filepath.Join(dir, "usr/bin/main")); err != nil {
+		t.Fatal(err)
+	}
+
+	// mountpoints created by the runtime
+	if err := os.MkdirAll(filepath.Join(dir, ".werf/stapel"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "tmp/werf-project-data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	removeMountpoints(dir, snapshot, []string{"/.werf/stapel", "/tmp/werf-project-data"})
+
+	var buf bytes.Buffer
+	if err := writeRootfsDiff(dir, snapshot, newIDMappings(uint32(os.Getuid()), uint32(os.Getgid()), nil, nil), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		entry := fmt.Sprintf("%s %d:%d", hdr.Name, hdr.Uid, hdr.Gid)
+		if hdr.Typeflag == tar.TypeSymlink {
+			entry += " -> " + hdr.Linkname
+		}
+		got = append(got, entry)
+	}
+
+	expected := []string{
+		"etc/.wh.os-release 0:0",
+		"var/lib/apt/.wh.lists 0:0",
+		"app/ 0:0",
+		"app/main.sh 0:0",
+		"etc/apt/sources.list 0:0",
+		"usr/bin/main 0:0 -> /app/main.sh",
+	}
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", expected) {
+		t.Errorf("rootfs diff:\n[EXPECTED]:\n%v\n[GOT]:\n%v", expected, got)
+	}
+}
+
+func TestUnpackRootfs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "werf-oci-unpack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: ".werf/stapel/", Mode: 0555},
+		{Typeflag: tar.TypeReg, Name: ".werf/stapel/embedded/bin/bash", Mode: 0755, Size: 4},
+		{Typeflag: tar.TypeSymlink, Name: ".werf/stapel/embedded/bin/sh", Linkname: "bash"},
+		{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0644, Size: 4},
+		{Typeflag: tar.TypeChar, Name: ".werf/stapel/dev/null"},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size != 0 {
+			if _, err := tw.Write([]byte("data")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unpackRootfs(&buf, dir, ".werf/stapel"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == dir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		got = append(got, fmt.Sprintf("%s %s", filepath.ToSlash(relPath), info.Mode()))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"embedded drwxr-xr-x",
+		"embedded/bin drwxr-xr-x",
+		"embedded/bin/bash -rwxr-xr-x",
+		"embedded/bin/sh Lrwxrwxrwx",
+	}
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", expected) {
+		t.Errorf("unpacked files:\n[EXPECTED]:\n%v\n[GOT]:\n%v", expected, got)
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
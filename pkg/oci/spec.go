@@ -0,0 +1,205 @@
+package oci
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// the default capabilities of the docker container, the capabilities are limited by the user namespace
+var defaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+type runtimeSpecOptions struct {
+	Args []string
+	Env  []string
+	Cwd  string
+	// Mounts are the volumes in the docker format (/host/path:/container/path[:ro|rw])
+	Mounts []specs.Mount
+
+	User       specs.User
+	IDMappings idMappings
+}
+
+// newRuntimeSpec makes the spec for the rootless container with the host network (as docker build does),
+// the current user is mapped to the container root and the subordinate ids of the user are mapped to other container users
+func newRuntimeSpec(opts runtimeSpecOptions) *specs.Spec {
+	capabilities := append([]string{}, defaultCapabilities...)
+
+	spec := &specs.Spec{
+		Version: specs.Version,
+		Root: &specs.Root{
+			Path: "rootfs",
+		},
+		Hostname: "werf",
+		Process: &specs.Process{
+			User: opts.User,
+			Args: opts.Args,
+			Env:  opts.Env,
+			Cwd:  opts.Cwd,
+			Capabilities: &specs.LinuxCapabilities{
+				Bounding:    capabilities,
+				Effective:   capabilities,
+				Inheritable: capabilities,
+				Permitted:   capabilities,
+			},
+		},
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			{Destination: "/dev/pts", Type: "devpts", Source: "devpts", Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620"}},
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			{Destination: "/dev/mqueue", Type: "mqueue", Source: "mqueue", Options: []string{"nosuid", "noexec", "nodev"}},
+			// sysfs cannot be mounted without the network namespace
+			{Destination: "/sys", Type: "none", Source: "/sys", Options: []string{"rbind", "nosuid", "noexec", "nodev", "ro"}},
+			{Destination: "/etc/resolv.conf", Type: "none", Source: "/etc/resolv.conf", Options: []string{"rbind", "ro"}},
+			{Destination: "/etc/hosts", Type: "none", Source: "/etc/hosts", Options: []string{"rbind", "ro"}},
+		},
+		Linux: &specs.Linux{
+			UIDMappings: opts.IDMappings.Uid,
+			GIDMappings: opts.IDMappings.Gid,
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.IPCNamespace},
+				{Type: specs.UTSNamespace},
+				{Type: specs.MountNamespace},
+				{Type: specs.UserNamespace},
+			},
+			MaskedPaths: []string{
+				"/proc/acpi",
+				"/proc/kcore",
+				"/proc/keys",
+				"/proc/latency_stats",
+				"/proc/timer_list",
+				"/proc/timer_stats",
+				"/proc/sched_debug",
+				"/proc/scsi",
+				"/sys/firmware",
+			},
+			ReadonlyPaths: []string{
+				"/proc/asound",
+				"/proc/bus",
+				"/proc/fs",
+				"/proc/irq",
+				"/proc/sys",
+				"/proc/sysrq-trigger",
+			},
+		},
+	}
+
+	spec.Mounts = append(spec.Mounts, opts.Mounts...)
+
+	return spec
+}
+
+// parseVolume parses the docker volume option, only bind mounts of the host directories are supported
+func parseVolume(volume string) (specs.Mount, error) {
+	parts := strings.Split(volume, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return specs.Mount{}, fmt.Errorf("bad volume %q: /host/path:/container/path[:ro|rw] expected", volume)
+	}
+
+	if !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) {
+		return specs.Mount{}, fmt.Errorf("bad volume %q: only bind mounts with absolute paths are supported", volume)
+	}
+
+	mode := "rw"
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro", "rw":
+			mode = parts[2]
+		default:
+			return specs.Mount{}, fmt.Errorf("bad volume %q: unsupported mode %q", volume, parts[2])
+		}
+	}
+
+	return specs.Mount{
+		Destination: parts[1],
+		Type:        "none",
+		Source:      parts[0],
+		Options:     []string{"rbind", mode},
+	}, nil
+}
+
+// parseUser parses the user option (user[:group]) as docker does: names are looked up in the container /etc/passwd and /etc/group,
+// the group of the user is used by default, the ids should be mapped into the container
+func parseUser(user, rootfsDir string, ids idMappings) (specs.User, error) {
+	if user == "" {
+		return specs.User{}, nil
+	}
+
+	parts := strings.SplitN(user, ":", 2)
+
+	uid, gid, err := lookupID(parts[0], rootfsDir, "/etc/passwd")
+	if err != nil {
+		return specs.User{}, fmt.Errorf("bad user %q: %s", user, err)
+	}
+
+	if len(parts) == 2 {
+		if gid, _, err = lookupID(parts[1], rootfsDir, "/etc/group"); err != nil {
+			return specs.User{}, fmt.Errorf("bad user %q: %s", user, err)
+		}
+	}
+
+	if !isContainerIDMapped(ids.Uid, uid) || !isContainerIDMapped(ids.Gid, gid) {
+		return specs.User{}, fmt.Errorf("user %q is not supported: only root user is available in the rootless container without subordinate ids of the current user (/etc/subuid, /etc/subgid, newuidmap and newgidmap are required)", user)
+	}
+
+	return specs.User{UID: uid, GID: gid}, nil
+}
+
+// lookupID returns the numeric id or the id and the group id (the fourth field of passwd) of the name in the passwd or group file
+func lookupID(nameOrID, rootfsDir, path string) (uint32, uint32, error) {
+	if id, err := strconv.ParseUint(nameOrID, 10, 32); err == nil {
+		return uint32(id), 0, nil
+	}
+
+	if nameOrID == "root" {
+		return 0, 0, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(rootfsDir, filepath.FromSlash(path)))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] != nameOrID {
+			continue
+		}
+
+		id, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad %s line %q", path, line)
+		}
+
+		var groupID uint64
+		if len(fields) >= 4 {
+			groupID, _ = strconv.ParseUint(fields[3], 10, 32)
+		}
+
+		return uint32(id), uint32(groupID), nil
+	}
+
+	return 0, 0, fmt.Errorf("%s not found in %s", nameOrID, path)
+}
@@ -0,0 +1,70 @@
+package oci
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/slug"
+	"github.com/flant/werf/pkg/stapel"
+	"github.com/flant/werf/pkg/werf"
+)
+
+const stapelVolume = "/.werf/stapel"
+
+// getOrCreateStapelDir unpacks the stapel volume from the stapel image into the local cache dir,
+// the dir is mounted into the container instead of the volumes from the stapel container
+func getOrCreateStapelDir() (string, error) {
+	dir := filepath.Join(werf.GetLocalCacheDir(), "oci", "stapel", slug.Slug(stapel.ImageName()))
+
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	lockName := fmt.Sprintf("oci_stapel.%s", stapel.ImageName())
+	err := werf.WithHostLock(lockName, shluz.LockOptions{}, func() error {
+		if _, err := os.Stat(dir); err == nil {
+			return nil
+		}
+
+		return logboek.Default.LogProcess(fmt.Sprintf("Unpacking stapel image %s", stapel.ImageName()), logboek.LevelLogProcessOptions{}, func() error {
+			img, err := docker_registry.PullImage(stapel.ImageName(), "")
+			if err != nil {
+				return err
+			}
+
+			if err := os.MkdirAll(filepath.Dir(dir), os.ModePerm); err != nil {
+				return err
+			}
+
+			tmpDir, err := ioutil.TempDir(filepath.Dir(dir), "tmp-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(tmpDir)
+
+			rc := mutate.Extract(img)
+			defer rc.Close()
+
+			if err := unpackRootfs(rc, tmpDir, stapelVolume[1:]); err != nil {
+				return fmt.Errorf("unable to unpack stapel image %s: %s", stapel.ImageName(), err)
+			}
+
+			return os.Rename(tmpDir, dir)
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,59 @@
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var partRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Parse splits platform in the OS/ARCH[/VARIANT] format (e.g. linux/amd64, linux/arm64/v8)
+func Parse(platform string) (string, string, string, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", "", "", fmt.Errorf("bad platform '%s': expected OS/ARCH[/VARIANT]", platform)
+	}
+
+	for _, part := range parts {
+		if !partRegexp.MatchString(part) {
+			return "", "", "", fmt.Errorf("bad platform '%s': expected OS/ARCH[/VARIANT] in lower case", platform)
+		}
+	}
+
+	if len(parts) == 2 {
+		return parts[0], parts[1], "", nil
+	}
+
+	return parts[0], parts[1], parts[2], nil
+}
+
+func Validate(platform string) error {
+	_, _, _, err := Parse(platform)
+	return err
+}
+
+// TagSuffix returns platform representation that can be used as a part of docker tag (e.g. linux-arm64-v8)
+func TagSuffix(platform string) string {
+	return strings.Replace(platform, "/", "-", -1)
+}
+
+// ImageMetaTag returns the tag of the platform image, which is combined into the manifest list by the meta tag
+func ImageMetaTag(imageMetaTag, platform string) string {
+	return fmt.Sprintf("%s-%s", imageMetaTag, TagSuffix(platform))
+}
+
+// Contains returns true when the platform is one of the platforms or the platforms list is empty (any platform)
+func Contains(platforms []string, platform string) bool {
+	if len(platforms) == 0 {
+		return true
+	}
+
+	for _, p := range platforms {
+		if p == platform {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,50 @@
+package platform
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		platform        string
+		expectedOS      string
+		expectedArch    string
+		expectedVariant string
+	}{
+		{platform: "linux/amd64", expectedOS: "linux", expectedArch: "amd64"},
+		{platform: "linux/arm64/v8", expectedOS: "linux", expectedArch: "arm64", expectedVariant: "v8"},
+		{platform: "windows/x86_64", expectedOS: "windows", expectedArch: "x86_64"},
+	}
+
+	for _, test := range tests {
+		os, arch, variant, err := Parse(test.platform)
+		if err != nil {
+			t.Fatalf("%s: %s", test.platform, err)
+		}
+
+		if os != test.expectedOS || arch != test.expectedArch || variant != test.expectedVariant {
+			t.Errorf("\n[EXPECTED]: %s %s %s\n[GOT]: %s %s %s", test.expectedOS, test.expectedArch, test.expectedVariant, os, arch, variant)
+		}
+	}
+
+	for _, platform := range []string{"", "linux", "linux/", "linux/arm/v7/extra", "Linux/amd64", "linux/amd 64"} {
+		if err := Validate(platform); err == nil {
+			t.Errorf("expected error for %q", platform)
+		}
+	}
+}
+
+func TestTagSuffix(t *testing.T) {
+	for platform, expected := range map[string]string{
+		"linux/amd64":    "linux-amd64",
+		"linux/arm64/v8": "linux-arm64-v8",
+	} {
+		if got := TagSuffix(platform); got != expected {
+			t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", expected, got)
+		}
+	}
+}
+
+func TestImageMetaTag(t *testing.T) {
+	if got := ImageMetaTag("master", "linux/arm64/v8"); got != "master-linux-arm64-v8" {
+		t.Errorf("\n[EXPECTED]: %s\n[GOT]: %s", "master-linux-arm64-v8", got)
+	}
+}
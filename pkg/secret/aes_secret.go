@@ -134,6 +134,8 @@ func IsExtractDataError(err error) bool {
 	dataErrorPrefixs := []string{
 		"minimum required data length",
 		"encoding/hex: odd length hex string",
+		ageDataErrorPrefix,
+		pgpDataErrorPrefix,
 	}
 
 	for _, prefix := range dataErrorPrefixs {
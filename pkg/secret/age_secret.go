@@ -0,0 +1,109 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// AgeSecret encrypts data for the X25519 recipients in the age v1 format (https://age-encryption.org/v1),
+// so that the data can be decrypted by any recipient with the own identity (including with the age tool)
+type AgeSecret struct {
+	Recipients []age.Recipient
+	Identities []age.Identity
+}
+
+const ageDataErrorPrefix = "bad age data"
+
+// NewAgeSecret creates secret for the age recipients (age1...).
+// Identities data is the content of the age identity file with AGE-SECRET-KEY-1... keys, which is only required for decryption
+func NewAgeSecret(recipients []string, identities []byte) (*AgeSecret, error) {
+	s := &AgeSecret{}
+
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("bad age recipient '%s': %s", recipient, err)
+		}
+
+		s.Recipients = append(s.Recipients, r)
+	}
+
+	for _, line := range strings.Split(string(identities), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		identity, err := age.ParseX25519Identity(line)
+		if err != nil {
+			return nil, fmt.Errorf("bad age identity: X25519 identity AGE-SECRET-KEY-1... expected")
+		}
+
+		s.Identities = append(s.Identities, identity)
+	}
+
+	return s, nil
+}
+
+func (s *AgeSecret) Encrypt(data []byte) ([]byte, error) {
+	if len(s.Recipients) == 0 {
+		return nil, fmt.Errorf("no age recipients specified")
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, s.Recipients...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, hex.EncodedLen(buf.Len()))
+	hex.Encode(result, buf.Bytes())
+
+	return result, nil
+}
+
+func (s *AgeSecret) Decrypt(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	dataToExtract, err := hexToBinary(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Identities) == 0 {
+		return nil, fmt.Errorf("no age identities specified")
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(dataToExtract), s.Identities...)
+	if err != nil {
+		var noIdentityMatchErr *age.NoIdentityMatchError
+		if errors.As(err, &noIdentityMatchErr) {
+			return nil, fmt.Errorf("no identity matched any of the age recipients")
+		}
+
+		return nil, fmt.Errorf("%s: %s", ageDataErrorPrefix, err)
+	}
+
+	result, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ageDataErrorPrefix, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// the age payload is encrypted by chunks
+const ageStreamChunkSize = 64 * 1024
+
+func generateAgeKeyPair(t *testing.T) (string, string) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return identity.String(), identity.Recipient().String()
+}
+
+func TestAgeSecret(t *testing.T) {
+	aliceIdentity, aliceRecipient := generateAgeKeyPair(t)
+	bobIdentity, bobRecipient := generateAgeKeyPair(t)
+
+	encryptionSecret, err := NewAgeSecret([]string{aliceRecipient, bobRecipient}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "short", data: []byte("password")},
+		{name: "chunk", data: bytes.Repeat([]byte("x"), ageStreamChunkSize)},
+		{name: "chunks", data: bytes.Repeat([]byte("x"), ageStreamChunkSize*2+1)},
+	}
+
+	for _, identity := range []string{aliceIdentity, bobIdentity} {
+		decryptionSecret, err := NewAgeSecret(nil, []byte("# created: 2020-01-01T00:00:00Z\n"+identity+"\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				encryptedData, err := encryptionSecret.Encrypt(test.data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				data, err := decryptionSecret.Decrypt(encryptedData)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(data, test.data) {
+					t.Errorf("\n[EXPECTED]: %d bytes\n[GOT]: %d bytes", len(test.data), len(data))
+				}
+			})
+		}
+	}
+}
+
+func TestAgeSecret_negative(t *testing.T) {
+	_, aliceRecipient := generateAgeKeyPair(t)
+	eveIdentity, _ := generateAgeKeyPair(t)
+
+	encryptionSecret, err := NewAgeSecret([]string{aliceRecipient}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedData, err := encryptionSecret.Encrypt([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eveSecret, err := NewAgeSecret(nil, []byte(eveIdentity))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := eveSecret.Decrypt(encryptedData); err == nil {
+		t.Error("expected error for identity that is not a recipient")
+	}
+
+	if _, err := encryptionSecret.Decrypt(encryptedData); err == nil {
+		t.Error("expected error without identities")
+	}
+
+	if _, err := eveSecret.Decrypt([]byte("0011")); err == nil || !IsExtractDataError(err) {
+		t.Errorf("expected extract data error, got: %v", err)
+	}
+}
+
+// testdata/age files are produced by the reference age implementation, filippo.io/age v1.0.0 test vectors
+func TestAgeSecret_referenceVectors(t *testing.T) {
+	readVector := func(name string) []byte {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "age", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	decrypt := func(identitiesFile, name string) ([]byte, error) {
+		s, err := NewAgeSecret(nil, readVector(identitiesFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s.Decrypt([]byte(hex.EncodeToString(readVector(name))))
+	}
+
+	data, err := decrypt("keys.txt", "example.age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Black lives matter."; string(data) != expected {
+		t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", expected, string(data))
+	}
+
+	for _, name := range []string{"good_simple.age", "good_empty_recipient_body.age"} {
+		if _, err := decrypt("default_key.txt", name); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"fail_bad_hmac.age", "fail_large_filekey_x25519.age", "nomatch_x25519.age"} {
+		if _, err := decrypt("default_key.txt", name); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestNewAgeSecret_negative(t *testing.T) {
+	identity, recipient := generateAgeKeyPair(t)
+
+	if _, err := NewAgeSecret([]string{identity}, nil); err == nil {
+		t.Error("expected error for identity specified as recipient")
+	}
+
+	if _, err := NewAgeSecret([]string{recipient[:len(recipient)-1]}, nil); err == nil {
+		t.Error("expected error for recipient with bad checksum")
+	}
+
+	if _, err := NewAgeSecret(nil, []byte(recipient)); err == nil {
+		t.Error("expected error for recipient specified as identity")
+	}
+}
@@ -0,0 +1,187 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	_ "golang.org/x/crypto/ripemd160" // default hash for the keys without preferred hashes
+)
+
+const pgpDataErrorPrefix = "bad pgp data"
+
+// PgpSecret encrypts data for the recipients public keys in the OpenPGP format,
+// so that the data can be decrypted by any recipient with the own secret key (including with gpg)
+type PgpSecret struct {
+	Recipients openpgp.EntityList
+	Keyring    openpgp.EntityList
+	Passphrase []byte
+}
+
+// NewPgpSecret creates secret for the recipients (key ids, fingerprints or emails) from the public keyring.
+// Secret keyring and passphrase are only required for decryption
+func NewPgpSecret(recipients []string, publicKeyring, secretKeyring, passphrase []byte) (*PgpSecret, error) {
+	s := &PgpSecret{Passphrase: passphrase}
+
+	if len(recipients) > 0 {
+		publicEntities, err := ReadPgpKeyring(publicKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read pgp public keyring: %s", err)
+		}
+
+		for _, recipient := range recipients {
+			entity := findPgpEntity(publicEntities, recipient)
+			if entity == nil {
+				return nil, fmt.Errorf("pgp recipient '%s' not found in public keyring", recipient)
+			}
+
+			s.Recipients = append(s.Recipients, entity)
+		}
+	}
+
+	if len(secretKeyring) > 0 {
+		secretEntities, err := ReadPgpKeyring(secretKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read pgp secret keyring: %s", err)
+		}
+
+		s.Keyring = secretEntities
+	}
+
+	return s, nil
+}
+
+// ReadPgpKeyring reads binary or armored (gpg --export --armor) keyring, armored keyring can consist of several blocks
+func ReadPgpKeyring(data []byte) (openpgp.EntityList, error) {
+	beginMarker := []byte("-----BEGIN ")
+	if !bytes.HasPrefix(bytes.TrimSpace(data), beginMarker) {
+		return openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	data = bytes.TrimSpace(data)
+
+	// armor decoder buffers the input, so that blocks should be split before decoding
+	var entities openpgp.EntityList
+	for len(data) > 0 {
+		next := bytes.Index(data[len(beginMarker):], beginMarker)
+		blockData := data
+		if next == -1 {
+			data = nil
+		} else {
+			blockData, data = data[:next+len(beginMarker)], data[next+len(beginMarker):]
+		}
+
+		block, err := armor.Decode(bytes.NewReader(blockData))
+		if err != nil {
+			return nil, err
+		}
+
+		if block.Type != openpgp.PublicKeyType && block.Type != openpgp.PrivateKeyType {
+			return nil, fmt.Errorf("unexpected armor block type '%s'", block.Type)
+		}
+
+		blockEntities, err := openpgp.ReadKeyRing(block.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		entities = append(entities, blockEntities...)
+	}
+
+	return entities, nil
+}
+
+func findPgpEntity(entities openpgp.EntityList, recipient string) *openpgp.Entity {
+	keyId := strings.ToUpper(strings.TrimPrefix(strings.Replace(recipient, " ", "", -1), "0x"))
+
+	for _, entity := range entities {
+		fingerprint := strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]))
+		if fingerprint == keyId || strings.HasSuffix(fingerprint, keyId) && (len(keyId) == 8 || len(keyId) == 16) {
+			return entity
+		}
+
+		for name := range entity.Identities {
+			if strings.Contains(name, fmt.Sprintf("<%s>", recipient)) {
+				return entity
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *PgpSecret) Encrypt(data []byte) ([]byte, error) {
+	if len(s.Recipients) == 0 {
+		return nil, fmt.Errorf("no pgp recipients specified")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w, err := openpgp.Encrypt(buf, s.Recipients, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, hex.EncodedLen(buf.Len()))
+	hex.Encode(result, buf.Bytes())
+
+	return result, nil
+}
+
+func (s *PgpSecret) Decrypt(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	dataToExtract, err := hexToBinary(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Keyring) == 0 {
+		return nil, fmt.Errorf("no pgp secret keys specified")
+	}
+
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if symmetric {
+			return nil, fmt.Errorf("symmetrically encrypted data is not supported")
+		}
+
+		for _, key := range keys {
+			if key.PrivateKey == nil || !key.PrivateKey.Encrypted {
+				continue
+			}
+
+			if len(s.Passphrase) == 0 {
+				return nil, fmt.Errorf("pgp secret key %s is encrypted: passphrase required", key.PrivateKey.KeyIdString())
+			}
+
+			if err := key.PrivateKey.Decrypt(s.Passphrase); err != nil {
+				return nil, fmt.Errorf("unable to decrypt pgp secret key %s: %s", key.PrivateKey.KeyIdString(), err)
+			}
+		}
+
+		return nil, nil
+	}
+
+	md, err := openpgp.ReadMessage(bytes.NewReader(dataToExtract), s.Keyring, prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !md.IsEncrypted {
+		return nil, fmt.Errorf("%s: message is not encrypted", pgpDataErrorPrefix)
+	}
+
+	return ioutil.ReadAll(md.UnverifiedBody)
+}
@@ -0,0 +1,107 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func generatePgpKeyrings(t *testing.T, name, email string) ([]byte, []byte, string) {
+	entity, err := openpgp.NewEntity(name, "", email, &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKeyring := bytes.NewBuffer(nil)
+	w, err := armor.Encode(publicKeyring, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	secretKeyring := bytes.NewBuffer(nil)
+	if err := entity.SerializePrivate(secretKeyring, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return publicKeyring.Bytes(), secretKeyring.Bytes(), strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]))
+}
+
+func TestPgpSecret(t *testing.T) {
+	alicePublicKeyring, aliceSecretKeyring, aliceFingerprint := generatePgpKeyrings(t, "Alice", "alice@example.com")
+	bobPublicKeyring, bobSecretKeyring, _ := generatePgpKeyrings(t, "Bob", "bob@example.com")
+	publicKeyring := append(append([]byte{}, alicePublicKeyring...), bobPublicKeyring...)
+
+	for _, recipients := range [][]string{
+		{aliceFingerprint, "bob@example.com"},
+		{"0x" + aliceFingerprint[24:], "bob@example.com"},
+	} {
+		encryptionSecret, err := NewPgpSecret(recipients, publicKeyring, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encryptedData, err := encryptionSecret.Encrypt([]byte("password"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, secretKeyring := range [][]byte{aliceSecretKeyring, bobSecretKeyring} {
+			decryptionSecret, err := NewPgpSecret(nil, nil, secretKeyring, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := decryptionSecret.Decrypt(encryptedData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != "password" {
+				t.Errorf("\n[EXPECTED]: password\n[GOT]: %s", data)
+			}
+		}
+	}
+}
+
+func TestPgpSecret_negative(t *testing.T) {
+	alicePublicKeyring, _, _ := generatePgpKeyrings(t, "Alice", "alice@example.com")
+	_, eveSecretKeyring, _ := generatePgpKeyrings(t, "Eve", "eve@example.com")
+
+	if _, err := NewPgpSecret([]string{"bob@example.com"}, alicePublicKeyring, nil, nil); err == nil {
+		t.Error("expected error for recipient not found in public keyring")
+	}
+
+	encryptionSecret, err := NewPgpSecret([]string{"alice@example.com"}, alicePublicKeyring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedData, err := encryptionSecret.Encrypt([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eveSecret, err := NewPgpSecret(nil, nil, eveSecretKeyring, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := eveSecret.Decrypt(encryptedData); err == nil {
+		t.Error("expected error for secret key that is not a recipient")
+	}
+
+	if _, err := encryptionSecret.Decrypt(encryptedData); err == nil {
+		t.Error("expected error without secret keys")
+	}
+}
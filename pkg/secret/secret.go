@@ -1,5 +1,11 @@
 package secret
 
+const (
+	AesBackend = "aes"
+	AgeBackend = "age"
+	PgpBackend = "pgp"
+)
+
 type Secret interface {
 	Encrypt(data []byte) ([]byte, error)
 	Decrypt(encodedData []byte) ([]byte, error)
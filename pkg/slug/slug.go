@@ -35,6 +35,15 @@ func Slug(data string) string {
 	return slug(data, slugMaxSize)
 }
 
+// LimitedSlug is Slug with the custom max size
+func LimitedSlug(data string, slugMaxSize int) string {
+	if len(data) == 0 || slugify(data) == data && len(data) < slugMaxSize {
+		return data
+	}
+
+	return slug(data, slugMaxSize)
+}
+
 func Project(name string) string {
 	if shouldNotBeSlugged(name, projectNameRegex, projectNameMaxSize) {
 		return name
@@ -53,6 +53,45 @@ func TestSlug(t *testing.T) {
 	}
 }
 
+func TestLimitedSlug(t *testing.T) {
+	maxSize := 20
+
+	tests := []struct {
+		name   string
+		data   string
+		result string
+	}{
+		{
+			name:   "shouldNotBeSlugged",
+			data:   "data",
+			result: "data",
+		},
+		{
+			name:   "notEqualWithSluggedData",
+			data:   "da/ta",
+			result: "da-ta-afa96f8",
+		},
+		{
+			name:   "maxSizeExceeded",
+			data:   strings.Repeat("x", maxSize+1),
+			result: strings.Repeat("x", maxSize-servicePartSize) + "-42eeeeae",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := LimitedSlug(test.data, maxSize)
+			if test.result != result {
+				t.Errorf("\n[EXPECTED]: %s (%d)\n[GOT]: %s (%d)", test.result, len(test.result), result, len(result))
+			}
+
+			if len(result) > maxSize {
+				t.Errorf("Max size exceeded: [EXPECTED]: %d [GOT]: %d", maxSize, len(result))
+			}
+		})
+	}
+}
+
 func TestDockerTag(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -7,6 +7,7 @@ import (
 	"github.com/flant/logboek"
 	"github.com/flant/shluz"
 	"github.com/flant/werf/pkg/docker"
+	"github.com/flant/werf/pkg/werf"
 )
 
 type container struct {
@@ -37,7 +38,7 @@ func (c *container) CreateIfNotExist() error {
 	}
 
 	if !exist {
-		err := shluz.WithLock(fmt.Sprintf("stapel.container.%s", c.Name), shluz.LockOptions{Timeout: time.Second * 600}, func() error {
+		err := werf.WithHostLock(fmt.Sprintf("stapel.container.%s", c.Name), shluz.LockOptions{Timeout: time.Second * 600}, func() error {
 			return logboek.LogProcess(fmt.Sprintf("Creating container %s from image %s", c.Name, c.ImageName), logboek.LogProcessOptions{}, func() error {
 				exist, err := docker.ContainerExist(c.Name)
 				if err != nil {
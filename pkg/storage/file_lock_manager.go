@@ -2,54 +2,63 @@ package storage
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/werf"
 )
 
+// FileLockManager locks are host locks, which exclude both werf processes on the host and goroutines of the process
 type FileLockManager struct {
+	mutex      sync.Mutex
 	stageLocks []string
 }
 
 func (lockManager *FileLockManager) LockStage(projectName, signature string) error {
-	for _, lockName := range lockManager.stageLocks {
-		if lockName == signature {
-			return nil
-		}
-	}
-
-	if err := shluz.Lock(fmt.Sprintf("%s.%s", projectName, signature), shluz.LockOptions{}); err != nil {
+	lockName := fmt.Sprintf("%s.%s", projectName, signature)
+	if err := werf.HostLock(lockName, shluz.LockOptions{}); err != nil {
 		return err
 	}
 
-	lockManager.stageLocks = append(lockManager.stageLocks, signature)
+	lockManager.mutex.Lock()
+	lockManager.stageLocks = append(lockManager.stageLocks, lockName)
+	lockManager.mutex.Unlock()
 
 	return nil
 }
 
 func (lockManager *FileLockManager) UnlockStage(projectName, signature string) error {
+	lockName := fmt.Sprintf("%s.%s", projectName, signature)
+
+	lockManager.mutex.Lock()
 	ind := -1
-	for i, lockName := range lockManager.stageLocks {
-		if lockName == signature {
+	for i, name := range lockManager.stageLocks {
+		if name == lockName {
 			ind = i
 			break
 		}
 	}
-
 	if ind >= 0 {
-		if err := shluz.Unlock(fmt.Sprintf("%s.%s", projectName, signature)); err != nil {
-			return err
-		}
 		lockManager.stageLocks = append(lockManager.stageLocks[:ind], lockManager.stageLocks[ind+1:]...)
 	}
+	lockManager.mutex.Unlock()
 
-	return nil
+	if ind < 0 {
+		return nil
+	}
+
+	return werf.HostUnlock(lockName)
 }
 
 func (lockManager *FileLockManager) ReleaseAllStageLocks() error {
-	for len(lockManager.stageLocks) > 0 {
-		var lockName string
-		lockName, lockManager.stageLocks = lockManager.stageLocks[0], lockManager.stageLocks[1:]
-		if err := shluz.Unlock(lockName); err != nil {
+	lockManager.mutex.Lock()
+	stageLocks := lockManager.stageLocks
+	lockManager.stageLocks = nil
+	lockManager.mutex.Unlock()
+
+	for _, lockName := range stageLocks {
+		if err := werf.HostUnlock(lockName); err != nil {
 			return err
 		}
 	}
@@ -59,7 +68,7 @@ func (lockManager *FileLockManager) ReleaseAllStageLocks() error {
 
 func (lockManager *FileLockManager) LockAllImagesReadOnly(projectName string) error {
 	lockName := fmt.Sprintf("%s.images", projectName)
-	err := shluz.Lock(lockName, shluz.LockOptions{ReadOnly: true})
+	err := werf.HostLock(lockName, shluz.LockOptions{ReadOnly: true})
 	if err != nil {
 		return fmt.Errorf("shluz lock %s error: %s", lockName, err)
 	}
@@ -68,12 +77,12 @@ func (lockManager *FileLockManager) LockAllImagesReadOnly(projectName string) er
 
 func (lockManager *FileLockManager) UnlockAllImages(projectName string) error {
 	lockName := fmt.Sprintf("%s.images", projectName)
-	return shluz.Unlock(lockName)
+	return werf.HostUnlock(lockName)
 }
 
 func (lockManager *FileLockManager) LockStageCache(projectName, signature string) error {
 	lockName := fmt.Sprintf("%s.%s.cache", projectName, signature)
-	if err := shluz.Lock(lockName, shluz.LockOptions{}); err != nil {
+	if err := werf.HostLock(lockName, shluz.LockOptions{}); err != nil {
 		return fmt.Errorf("shluz lock %s error: %s", lockName, err)
 	}
 	return nil
@@ -81,12 +90,12 @@ func (lockManager *FileLockManager) LockStageCache(projectName, signature string
 
 func (lockManager *FileLockManager) UnlockStageCache(projectName, signature string) error {
 	lockName := fmt.Sprintf("%s.%s.cache", projectName, signature)
-	return shluz.Unlock(lockName)
+	return werf.HostUnlock(lockName)
 }
 
 func (lockManager *FileLockManager) LockImage(imageName string) error {
 	lockName := fmt.Sprintf("%s.image", imageName)
-	if err := shluz.Lock(lockName, shluz.LockOptions{}); err != nil {
+	if err := werf.HostLock(lockName, shluz.LockOptions{}); err != nil {
 		return fmt.Errorf("shluz lock %s error: %s", lockName, err)
 	}
 	return nil
@@ -94,5 +103,18 @@ func (lockManager *FileLockManager) LockImage(imageName string) error {
 
 func (lockManager *FileLockManager) UnlockImage(imageName string) error {
 	lockName := fmt.Sprintf("%s.image", imageName)
-	return shluz.Unlock(lockName)
+	return werf.HostUnlock(lockName)
+}
+
+func (lockManager *FileLockManager) LockCacheMount(projectName, cacheMountName string) error {
+	lockName := fmt.Sprintf("%s.cache_mount.%s", projectName, cacheMountName)
+	if err := werf.HostLock(lockName, shluz.LockOptions{}); err != nil {
+		return fmt.Errorf("shluz lock %s error: %s", lockName, err)
+	}
+	return nil
+}
+
+func (lockManager *FileLockManager) UnlockCacheMount(projectName, cacheMountName string) error {
+	lockName := fmt.Sprintf("%s.cache_mount.%s", projectName, cacheMountName)
+	return werf.HostUnlock(lockName)
 }
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/werf"
+)
+
+func TestFileLockManager_LockStage(t *testing.T) {
+	locksDir, err := ioutil.TempDir("", "werf-file-lock-manager-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(locksDir)
+
+	if err := shluz.Init(locksDir); err != nil {
+		t.Fatal(err)
+	}
+
+	lockManager := &FileLockManager{}
+
+	if err := lockManager.LockStage("project", "signature"); err != nil {
+		t.Fatal(err)
+	}
+
+	lockedCh := make(chan struct{})
+	go func() {
+		if err := lockManager.LockStage("project", "signature"); err != nil {
+			t.Error(err)
+		}
+		close(lockedCh)
+	}()
+
+	select {
+	case <-lockedCh:
+		t.Fatal("expected the stage with the same signature to be locked by one goroutine at a time")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := lockManager.LockStage("project", "other-signature"); err != nil {
+		t.Fatalf("unexpected error locking another signature: %s", err)
+	}
+
+	if err := lockManager.UnlockStage("project", "signature"); err != nil {
+		t.Fatal(err)
+	}
+	<-lockedCh
+
+	if err := lockManager.ReleaseAllStageLocks(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lockName := range []string{"project.signature", "project.other-signature"} {
+		if locked, err := werf.TryHostLock(lockName, shluz.TryLockOptions{}); err != nil || !locked {
+			t.Fatalf("expected released stage lock %s to be acquired: %v %v", lockName, locked, err)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/json"
 
 	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/werf"
 )
 
 type FileStagesStorageCache struct {
@@ -71,12 +73,12 @@ func (cache *FileStagesStorageCache) StoreImagesBySignature(projectName, signatu
 
 func (cache *FileStagesStorageCache) lock() error {
 	// TODO: maybe shluz is an overkill for this kind of locks
-	if err := shluz.Lock(cache.CacheDir, shluz.LockOptions{}); err != nil {
+	if err := werf.HostLock(cache.CacheDir, shluz.LockOptions{}); err != nil {
 		return fmt.Errorf("shluz lock %s failed: %s", cache.CacheDir, err)
 	}
 	return nil
 }
 
 func (cache *FileStagesStorageCache) unlock() error {
-	return shluz.Unlock(cache.CacheDir)
+	return werf.HostUnlock(cache.CacheDir)
 }
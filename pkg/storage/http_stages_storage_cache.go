@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+const (
+	HttpStagesStorageCacheApiPrefix = "/v1/stages-storage-cache"
+
+	DefaultHttpStagesStorageCacheTimeout = 30 * time.Second
+)
+
+// HttpStagesStorageCache stores images by signature on the remote cache server (see NewStagesStorageCacheHandler).
+// GET of /v1/stages-storage-cache/PROJECT/SIGNATURE returns ImageInfosCacheData json or 404 if there is no cache record,
+// PUT of the same path stores ImageInfosCacheData json from the request body.
+type HttpStagesStorageCache struct {
+	Address string
+	Client  *http.Client
+}
+
+func NewHttpStagesStorageCache(address string) *HttpStagesStorageCache {
+	return &HttpStagesStorageCache{
+		Address: strings.TrimSuffix(address, "/"),
+		Client:  &http.Client{Timeout: DefaultHttpStagesStorageCacheTimeout},
+	}
+}
+
+func (cache *HttpStagesStorageCache) GetImagesBySignature(projectName, signature string) (bool, []*ImageInfo, error) {
+	recordUrl := cache.recordUrl(projectName, signature)
+
+	resp, err := cache.Client.Get(recordUrl)
+	if err != nil {
+		return false, nil, fmt.Errorf("error getting %s: %s", recordUrl, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, nil, fmt.Errorf("error getting %s: unexpected response status %q", recordUrl, resp.Status)
+	}
+
+	dataBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, nil, fmt.Errorf("error reading response body of %s: %s", recordUrl, err)
+	}
+
+	res := &ImageInfosCacheData{}
+	if err := json.Unmarshal(dataBytes, res); err != nil {
+		return false, nil, fmt.Errorf("error unmarshalling json from %s: %s", recordUrl, err)
+	}
+
+	return true, res.ImagesDescs, nil
+}
+
+func (cache *HttpStagesStorageCache) StoreImagesBySignature(projectName, signature string, imagesDescs []*ImageInfo) error {
+	recordUrl := cache.recordUrl(projectName, signature)
+
+	dataBytes, err := json.Marshal(ImageInfosCacheData{ImagesDescs: imagesDescs})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, recordUrl, bytes.NewReader(dataBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cache.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error putting %s: %s", recordUrl, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("error putting %s: unexpected response status %q", recordUrl, resp.Status)
+	}
+
+	return nil
+}
+
+func (cache *HttpStagesStorageCache) recordUrl(projectName, signature string) string {
+	return fmt.Sprintf("%s%s/%s/%s", cache.Address, HttpStagesStorageCacheApiPrefix, url.PathEscape(projectName), url.PathEscape(signature))
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type memoryStagesStorageCache struct {
+	records map[string][]*ImageInfo
+}
+
+func (cache *memoryStagesStorageCache) GetImagesBySignature(projectName, signature string) (bool, []*ImageInfo, error) {
+	imagesDescs, exists := cache.records[projectName+"/"+signature]
+	return exists, imagesDescs, nil
+}
+
+func (cache *memoryStagesStorageCache) StoreImagesBySignature(projectName, signature string, imagesDescs []*ImageInfo) error {
+	cache.records[projectName+"/"+signature] = imagesDescs
+	return nil
+}
+
+func TestHttpStagesStorageCache(t *testing.T) {
+	server := httptest.NewServer(NewStagesStorageCacheHandler(&memoryStagesStorageCache{records: make(map[string][]*ImageInfo)}))
+	defer server.Close()
+
+	cache := NewHttpStagesStorageCache(server.URL + "/")
+
+	exists, _, err := cache.GetImagesBySignature("myproject", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("expected no cache record")
+	}
+
+	imagesDescs := []*ImageInfo{
+		{
+			Signature:         "abcd",
+			ImageName:         "werf-stages-storage/myproject:abcd-1583230262",
+			Labels:            map[string]string{"werf": "myproject"},
+			CreatedAtUnixNano: 1583230262000000000,
+		},
+	}
+	if err := cache.StoreImagesBySignature("myproject", "abcd", imagesDescs); err != nil {
+		t.Fatal(err)
+	}
+
+	exists, gotImagesDescs, err := cache.GetImagesBySignature("myproject", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected cache record to exist")
+	}
+	if !reflect.DeepEqual(imagesDescs, gotImagesDescs) {
+		t.Fatalf("expected %#v, got %#v", imagesDescs, gotImagesDescs)
+	}
+
+	if exists, _, err := cache.GetImagesBySignature("otherproject", "abcd"); err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Fatal("expected no cache record for other project")
+	}
+}
+
+func TestStagesStorageCacheHandlerBadPath(t *testing.T) {
+	handler := NewStagesStorageCacheHandler(&memoryStagesStorageCache{records: make(map[string][]*ImageInfo)})
+
+	for _, path := range []string{
+		"/",
+		HttpStagesStorageCacheApiPrefix + "/myproject",
+		HttpStagesStorageCacheApiPrefix + "/myproject/abcd/extra",
+		HttpStagesStorageCacheApiPrefix + "/../abcd",
+		HttpStagesStorageCacheApiPrefix + "/myproject/..",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://cache"+path, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("path %q: expected status %d, got %d", path, http.StatusNotFound, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/flant/logboek"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+const (
+	KubernetesLockNameAnnotation = "werf.io/lock-name"
+
+	DefaultKubernetesLockLeaseDuration = 30 * time.Second
+	DefaultKubernetesLockRetryPeriod   = 2 * time.Second
+)
+
+type KubernetesLockManager struct {
+	KubeClient     kubernetes.Interface
+	Namespace      string
+	HolderIdentity string
+
+	// LeaseDuration is the period after which the lock held by a dead werf process is considered stale.
+	// Held locks are renewed every LeaseDuration/3.
+	LeaseDuration time.Duration
+	RetryPeriod   time.Duration
+	// Timeout limits the time of waiting for the lock, 0 means waiting forever.
+	Timeout time.Duration
+	// Annotations are set on the lease when the lock is acquired to describe the holder.
+	Annotations map[string]string
+
+	mux   sync.Mutex
+	locks map[string]*kubernetesLock
+}
+
+// kubernetesLock excludes goroutines of the process from each other,
+// the lease excludes werf processes
+type kubernetesLock struct {
+	heldCh      chan struct{}
+	stopRenewCh chan struct{}
+}
+
+func NewKubernetesLockManager(kubeClient kubernetes.Interface, namespace string) *KubernetesLockManager {
+	hostname, _ := os.Hostname()
+
+	return &KubernetesLockManager{
+		KubeClient:     kubeClient,
+		Namespace:      namespace,
+		HolderIdentity: fmt.Sprintf("%s.%d.%s", hostname, os.Getpid(), uuid.New().String()),
+		LeaseDuration:  DefaultKubernetesLockLeaseDuration,
+		RetryPeriod:    DefaultKubernetesLockRetryPeriod,
+		locks:          make(map[string]*kubernetesLock),
+	}
+}
+
+func (lockManager *KubernetesLockManager) LockStage(projectName, signature string) error {
+	return lockManager.lock(fmt.Sprintf("%s.%s", projectName, signature))
+}
+
+func (lockManager *KubernetesLockManager) UnlockStage(projectName, signature string) error {
+	return lockManager.unlock(fmt.Sprintf("%s.%s", projectName, signature))
+}
+
+func (lockManager *KubernetesLockManager) LockStageCache(projectName, signature string) error {
+	return lockManager.lock(fmt.Sprintf("%s.%s.cache", projectName, signature))
+}
+
+func (lockManager *KubernetesLockManager) UnlockStageCache(projectName, signature string) error {
+	return lockManager.unlock(fmt.Sprintf("%s.%s.cache", projectName, signature))
+}
+
+func (lockManager *KubernetesLockManager) LockImage(imageName string) error {
+	return lockManager.lock(fmt.Sprintf("%s.image", imageName))
+}
+
+func (lockManager *KubernetesLockManager) UnlockImage(imageName string) error {
+	return lockManager.unlock(fmt.Sprintf("%s.image", imageName))
+}
+
+func (lockManager *KubernetesLockManager) LockCacheMount(projectName, cacheMountName string) error {
+	return lockManager.lock(fmt.Sprintf("%s.cache_mount.%s", projectName, cacheMountName))
+}
+
+func (lockManager *KubernetesLockManager) UnlockCacheMount(projectName, cacheMountName string) error {
+	return lockManager.unlock(fmt.Sprintf("%s.cache_mount.%s", projectName, cacheMountName))
+}
+
+func (lockManager *KubernetesLockManager) Lock(lockName string) error {
+	return lockManager.lock(lockName)
+}
+
+func (lockManager *KubernetesLockManager) Unlock(lockName string) error {
+	return lockManager.unlock(lockName)
+}
+
+// ForceUnlock deletes the lease of the lock regardless of its holder, the deleted lease is returned or nil if the lock is not held
+func (lockManager *KubernetesLockManager) ForceUnlock(lockName string) (*coordinationv1.Lease, error) {
+	leaseName := kubernetesLockLeaseName(lockName)
+	leases := lockManager.KubeClient.CoordinationV1().Leases(lockManager.Namespace)
+
+	lease, err := leases.Get(leaseName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get lease %s/%s: %s", lockManager.Namespace, leaseName, err)
+	}
+
+	if err := leases.Delete(leaseName, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to delete lease %s/%s: %s", lockManager.Namespace, leaseName, err)
+	}
+
+	return lease, nil
+}
+
+func (lockManager *KubernetesLockManager) lock(lockName string) error {
+	startedAt := time.Now()
+
+	l := lockManager.getLock(lockName)
+	if err := lockManager.acquireInProcess(lockName, l); err != nil {
+		return err
+	}
+
+	leaseName := kubernetesLockLeaseName(lockName)
+	waitingMessageShown := false
+
+	for {
+		acquired, holder, err := lockManager.tryAcquire(lockName, leaseName)
+		if err != nil {
+			<-l.heldCh
+			return fmt.Errorf("unable to acquire lock %q (lease %s/%s): %s", lockName, lockManager.Namespace, leaseName, err)
+		}
+
+		if acquired {
+			break
+		}
+
+		if lockManager.Timeout != 0 && time.Since(startedAt) > lockManager.Timeout {
+			<-l.heldCh
+			return fmt.Errorf("lock %q is held by %s: timeout %s exceeded", lockName, holder, lockManager.Timeout)
+		}
+
+		if !waitingMessageShown {
+			logboek.Default.LogF("Waiting for lock %q held by %s\n", lockName, holder)
+			waitingMessageShown = true
+		}
+
+		time.Sleep(lockManager.RetryPeriod)
+	}
+
+	stopRenewCh := make(chan struct{})
+
+	lockManager.mux.Lock()
+	l.stopRenewCh = stopRenewCh
+	lockManager.mux.Unlock()
+
+	go lockManager.renewLoop(lockName, leaseName, stopRenewCh)
+
+	return nil
+}
+
+func (lockManager *KubernetesLockManager) getLock(lockName string) *kubernetesLock {
+	lockManager.mux.Lock()
+	defer lockManager.mux.Unlock()
+
+	l, exists := lockManager.locks[lockName]
+	if !exists {
+		l = &kubernetesLock{heldCh: make(chan struct{}, 1)}
+		lockManager.locks[lockName] = l
+	}
+
+	return l
+}
+
+// acquireInProcess waits for the lock held by another goroutine of the process
+func (lockManager *KubernetesLockManager) acquireInProcess(lockName string, l *kubernetesLock) error {
+	select {
+	case l.heldCh <- struct{}{}:
+		return nil
+	default:
+	}
+
+	logboek.Default.LogF("Waiting for lock %q held by the current process\n", lockName)
+
+	var timeoutCh <-chan time.Time
+	if lockManager.Timeout != 0 {
+		timer := time.NewTimer(lockManager.Timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case l.heldCh <- struct{}{}:
+		return nil
+	case <-timeoutCh:
+		return fmt.Errorf("lock %q is held by the current process: timeout %s exceeded", lockName, lockManager.Timeout)
+	}
+}
+
+func (lockManager *KubernetesLockManager) unlock(lockName string) error {
+	lockManager.mux.Lock()
+	l, exists := lockManager.locks[lockName]
+	var stopRenewCh chan struct{}
+	if exists {
+		stopRenewCh, l.stopRenewCh = l.stopRenewCh, nil
+	}
+	lockManager.mux.Unlock()
+
+	if stopRenewCh == nil {
+		return nil
+	}
+
+	defer func() { <-l.heldCh }()
+
+	close(stopRenewCh)
+
+	leaseName := kubernetesLockLeaseName(lockName)
+
+	lease, err := lockManager.KubeClient.CoordinationV1().Leases(lockManager.Namespace).Get(leaseName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get lease %s/%s: %s", lockManager.Namespace, leaseName, err)
+	}
+
+	if !lockManager.isHolder(lease) {
+		logboek.LogWarnF("WARNING: lock %q has been taken over by %s\n", lockName, leaseHolder(lease))
+		return nil
+	}
+
+	deleteOptions := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &lease.UID, ResourceVersion: &lease.ResourceVersion}}
+	if err := lockManager.KubeClient.CoordinationV1().Leases(lockManager.Namespace).Delete(leaseName, deleteOptions); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete lease %s/%s: %s", lockManager.Namespace, leaseName, err)
+	}
+
+	return nil
+}
+
+func (lockManager *KubernetesLockManager) tryAcquire(lockName, leaseName string) (bool, string, error) {
+	leases := lockManager.KubeClient.CoordinationV1().Leases(lockManager.Namespace)
+
+	lease, err := leases.Get(leaseName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		newLease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        leaseName,
+				Annotations: map[string]string{KubernetesLockNameAnnotation: lockName},
+			},
+		}
+		lockManager.setLeaseHolder(newLease)
+
+		if _, err := leases.Create(newLease); errors.IsAlreadyExists(err) {
+			return false, "", nil
+		} else if err != nil {
+			return false, "", err
+		}
+
+		return true, lockManager.HolderIdentity, nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	prevHolder := leaseHolder(lease)
+	if !lockManager.isHolder(lease) && !isLeaseExpired(lease) {
+		return false, prevHolder, nil
+	}
+
+	lockManager.setLeaseHolder(lease)
+	if _, err := leases.Update(lease); errors.IsConflict(err) {
+		return false, prevHolder, nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	return true, lockManager.HolderIdentity, nil
+}
+
+func (lockManager *KubernetesLockManager) renewLoop(lockName, leaseName string, stopRenewCh chan struct{}) {
+	ticker := time.NewTicker(lockManager.LeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopRenewCh:
+			return
+		case <-ticker.C:
+			if err := lockManager.renew(leaseName); err != nil {
+				logboek.LogWarnF("WARNING: unable to renew lock %q: %s\n", lockName, err)
+			}
+		}
+	}
+}
+
+func (lockManager *KubernetesLockManager) renew(leaseName string) error {
+	leases := lockManager.KubeClient.CoordinationV1().Leases(lockManager.Namespace)
+
+	lease, err := leases.Get(leaseName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !lockManager.isHolder(lease) {
+		return fmt.Errorf("lease %s/%s is held by %s", lockManager.Namespace, leaseName, leaseHolder(lease))
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+
+	_, err = leases.Update(lease)
+	return err
+}
+
+func (lockManager *KubernetesLockManager) setLeaseHolder(lease *coordinationv1.Lease) {
+	now := metav1.NewMicroTime(time.Now())
+	leaseDurationSeconds := int32(lockManager.LeaseDuration / time.Second)
+
+	if len(lockManager.Annotations) != 0 && lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	for k, v := range lockManager.Annotations {
+		lease.Annotations[k] = v
+	}
+
+	lease.Spec.HolderIdentity = &lockManager.HolderIdentity
+	lease.Spec.LeaseDurationSeconds = &leaseDurationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+}
+
+func (lockManager *KubernetesLockManager) isHolder(lease *coordinationv1.Lease) bool {
+	return leaseHolder(lease) == lockManager.HolderIdentity
+}
+
+func leaseHolder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func isLeaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return true
+	}
+
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	expiresAt := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiresAt)
+}
+
+func kubernetesLockLeaseName(lockName string) string {
+	return fmt.Sprintf("werf-lock-%s", util.Sha3_224Hash(lockName))
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestKubernetesLockManager(kubeClient *fake.Clientset) *KubernetesLockManager {
+	lockManager := NewKubernetesLockManager(kubeClient, "werf-synchronization")
+	lockManager.RetryPeriod = 10 * time.Millisecond
+	lockManager.Timeout = 100 * time.Millisecond
+	return lockManager
+}
+
+func TestKubernetesLockManager_LockStage(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	first := newTestKubernetesLockManager(kubeClient)
+	second := newTestKubernetesLockManager(kubeClient)
+
+	if err := first.LockStage("project", "signature"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.LockStage("project", "signature"); err == nil {
+		t.Fatal("expected timeout error for the lock held by the same process")
+	}
+
+	if err := second.LockStage("project", "signature"); err == nil {
+		t.Fatal("expected timeout error for the lock held by another holder")
+	}
+
+	if err := second.LockStage("project", "other-signature"); err != nil {
+		t.Fatalf("unexpected error locking another signature: %s", err)
+	}
+
+	if err := first.UnlockStage("project", "signature"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.LockStage("project", "signature"); err != nil {
+		t.Fatalf("unexpected error locking released signature: %s", err)
+	}
+}
+
+func TestKubernetesLockManager_LocksAreIndependent(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	first := newTestKubernetesLockManager(kubeClient)
+	second := newTestKubernetesLockManager(kubeClient)
+
+	if err := first.LockStage("project", "signature"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.LockStageCache("project", "signature"); err != nil {
+		t.Fatalf("stage cache lock should not conflict with stage lock: %s", err)
+	}
+
+	if err := second.LockImage("registry.example.com/project:tag"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.LockImage("registry.example.com/project:tag"); err == nil {
+		t.Fatal("expected timeout error for the image lock held by another holder")
+	}
+}
+
+func TestKubernetesLockManager_ExpiredLeaseTakeover(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	first := newTestKubernetesLockManager(kubeClient)
+	second := newTestKubernetesLockManager(kubeClient)
+
+	if err := first.LockStage("project", "signature"); err != nil {
+		t.Fatal(err)
+	}
+	close(first.locks["project.signature"].stopRenewCh)
+
+	leaseName := kubernetesLockLeaseName("project.signature")
+	lease, err := kubeClient.CoordinationV1().Leases(first.Namespace).Get(leaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiredRenewTime := metav1.NewMicroTime(time.Now().Add(-2 * first.LeaseDuration))
+	lease.Spec.RenewTime = &expiredRenewTime
+	if _, err := kubeClient.CoordinationV1().Leases(first.Namespace).Update(lease); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.LockStage("project", "signature"); err != nil {
+		t.Fatalf("expected expired lease to be taken over: %s", err)
+	}
+
+	lease, err = kubeClient.CoordinationV1().Leases(first.Namespace).Get(leaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if holder := leaseHolder(lease); holder != second.HolderIdentity {
+		t.Errorf("expected lease holder %q, got %q", second.HolderIdentity, holder)
+	}
+}
+
+func TestKubernetesLockManager_ForceUnlock(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	first := newTestKubernetesLockManager(kubeClient)
+	first.Annotations = map[string]string{"werf.io/release-lock-owner": "first"}
+	second := newTestKubernetesLockManager(kubeClient)
+
+	if lease, err := second.ForceUnlock("release"); err != nil || lease != nil {
+		t.Fatalf("expected no lease for the lock that is not held, got %v: %v", lease, err)
+	}
+
+	if err := first.Lock("release"); err != nil {
+		t.Fatal(err)
+	}
+	close(first.locks["release"].stopRenewCh)
+
+	lease, err := second.ForceUnlock("release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease == nil || lease.Annotations["werf.io/release-lock-owner"] != "first" {
+		t.Fatalf("expected lease annotated with the holder owner, got %v", lease)
+	}
+
+	if err := second.Lock("release"); err != nil {
+		t.Fatalf("unexpected error locking force unlocked lock: %s", err)
+	}
+}
+
+func TestKubernetesLockManager_GoroutinesAreSerialized(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	lockManager := newTestKubernetesLockManager(kubeClient)
+	lockManager.Timeout = 0
+
+	var mux sync.Mutex
+	var holders, maxHolders int
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := lockManager.LockCacheMount("project", "cache"); err != nil {
+				t.Error(err)
+				return
+			}
+
+			mux.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			mux.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mux.Lock()
+			holders--
+			mux.Unlock()
+
+			if err := lockManager.UnlockCacheMount("project", "cache"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxHolders != 1 {
+		t.Errorf("expected the lock to be held by one goroutine at a time, got %d", maxHolders)
+	}
+
+	if l := lockManager.locks["project.cache_mount.cache"]; l.stopRenewCh != nil || len(l.heldCh) != 0 {
+		t.Errorf("expected the released lock without the renew loop")
+	}
+
+	if err := lockManager.UnlockCacheMount("project", "cache"); err != nil {
+		t.Fatalf("unexpected error unlocking the lock that is not held: %s", err)
+	}
+}
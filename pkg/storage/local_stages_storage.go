@@ -13,9 +13,12 @@ import (
 	"github.com/flant/werf/pkg/image"
 )
 
-type LocalStagesStorage struct{}
+const (
+	LocalStorageAddress    = ":local"
+	NamelessImageRecordTag = "__nameless__"
+)
 
-const NamelessImageRecordTag = "__nameless__"
+type LocalStagesStorage struct{}
 
 func makeConfigImageRecordImageName(projectName, imageName string) string {
 	tag := imageName
@@ -85,6 +88,10 @@ func (storage *LocalStagesStorage) GetManagedImages(projectName string) ([]strin
 	return res, nil
 }
 
+func (storage *LocalStagesStorage) ConstructStageImageName(projectName, signature, uniqueID string) string {
+	return fmt.Sprintf(image.LocalImageStageImageFormat, projectName, signature, uniqueID)
+}
+
 func (storage *LocalStagesStorage) GetImagesBySignature(projectName, signature string) ([]*ImageInfo, error) {
 	filterSet := filters.NewArgs()
 	filterSet.Add("reference", fmt.Sprintf(image.LocalImageStageImageNameFormat, projectName))
@@ -125,5 +132,5 @@ func (storage *LocalStagesStorage) StoreStageImage(stageImage image.ImageInterfa
 }
 
 func (storage *LocalStagesStorage) String() string {
-	return ":local"
+	return LocalStorageAddress
 }
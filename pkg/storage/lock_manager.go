@@ -7,6 +7,8 @@ type LockManager interface {
 	UnlockStageCache(projectName, signature string) error
 	LockImage(imageName string) error
 	UnlockImage(imageName string) error
+	LockCacheMount(projectName, cacheMountName string) error
+	UnlockCacheMount(projectName, cacheMountName string) error
 
 	//ReleaseAllStageLocks() error
 	//LockAllImagesReadOnly(projectName string) error
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/slug"
+	"github.com/flant/werf/pkg/werf"
+)
+
+type RepoStagesStorage struct {
+	RepoAddress string
+}
+
+func NewRepoStagesStorage(repoAddress string) *RepoStagesStorage {
+	return &RepoStagesStorage{RepoAddress: repoAddress}
+}
+
+func (storage *RepoStagesStorage) ConstructStageImageName(_, signature, uniqueID string) string {
+	return fmt.Sprintf(image.RepoStageImageFormat, storage.RepoAddress, signature, uniqueID)
+}
+
+func (storage *RepoStagesStorage) GetImagesBySignature(projectName, signature string) ([]*ImageInfo, error) {
+	logboek.Debug.LogF("-- RepoStagesStorage.GetImagesBySignature %s %s\n", projectName, signature)
+
+	tags, err := docker_registry.Tags(storage.RepoAddress)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get repo %s tags: %s", storage.RepoAddress, err)
+	}
+
+	res := []*ImageInfo{}
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, fmt.Sprintf("%s-", signature)) {
+			continue
+		}
+
+		imageName := fmt.Sprintf("%s:%s", storage.RepoAddress, tag)
+		configFile, err := docker_registry.ImageConfigFile(imageName)
+		if err != nil {
+			if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") || strings.Contains(err.Error(), "BLOB_UNKNOWN") {
+				logboek.LogWarnF("WARNING: Broken tag %s was skipped: %s\n", imageName, err)
+				continue
+			}
+			return nil, fmt.Errorf("unable to get image %s config: %s", imageName, err)
+		}
+
+		if configFile.Config.Labels[image.WerfLabel] != projectName {
+			logboek.Debug.LogF("Image %s does not belong to the project %s: skipping\n", imageName, projectName)
+			continue
+		}
+
+		res = append(res, &ImageInfo{
+			ImageName:         imageName,
+			Signature:         signature,
+			Labels:            configFile.Config.Labels,
+			CreatedAtUnixNano: configFile.Created.UnixNano(),
+		})
+	}
+
+	return res, nil
+}
+
+func (storage *RepoStagesStorage) SyncStageImage(stageImage image.ImageInterface) error {
+	if err := stageImage.SyncDockerState(); err != nil {
+		return fmt.Errorf("unable to sync docker state of image %s: %s", stageImage.Name(), err)
+	}
+
+	if stageImage.IsExists() {
+		return nil
+	}
+
+	imageLockName := image.ImageLockName(stageImage.Name())
+	if err := werf.HostLock(imageLockName, shluz.LockOptions{}); err != nil {
+		return fmt.Errorf("failed to lock %s: %s", imageLockName, err)
+	}
+	defer werf.HostUnlock(imageLockName)
+
+	if err := stageImage.SyncDockerState(); err != nil {
+		return fmt.Errorf("unable to sync docker state of image %s: %s", stageImage.Name(), err)
+	} else if stageImage.IsExists() {
+		return nil
+	}
+
+	if err := stageImage.Pull(); err != nil {
+		return fmt.Errorf("unable to pull image %s: %s", stageImage.Name(), err)
+	}
+
+	if err := stageImage.SyncDockerState(); err != nil {
+		return fmt.Errorf("unable to sync docker state of image %s: %s", stageImage.Name(), err)
+	}
+
+	return nil
+}
+
+func (storage *RepoStagesStorage) StoreStageImage(stageImage image.ImageInterface) error {
+	if err := stageImage.TagBuiltImage(stageImage.Name()); err != nil {
+		return fmt.Errorf("unable to tag image %s: %s", stageImage.Name(), err)
+	}
+
+	if err := stageImage.Push(); err != nil {
+		return fmt.Errorf("unable to push image %s: %s", stageImage.Name(), err)
+	}
+
+	if err := stageImage.SyncDockerState(); err != nil {
+		return fmt.Errorf("unable to sync docker state of image %s: %s", stageImage.Name(), err)
+	}
+
+	return nil
+}
+
+func (storage *RepoStagesStorage) AddManagedImage(projectName, imageName string) error {
+	logboek.Debug.LogF("-- RepoStagesStorage.AddManagedImage %s %s\n", projectName, imageName)
+
+	tag := makeRepoManagedImageRecordTag(imageName)
+
+	if exists, err := storage.isTagExist(tag); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	fullImageName := fmt.Sprintf("%s:%s", storage.RepoAddress, tag)
+
+	// the record tag can be slugged, so that the managed image name is kept in the label of the record image
+	recordImage, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		Created:      v1.Time{Time: time.Now()},
+		RootFS:       v1.RootFS{Type: "layers"},
+		Config: v1.Config{
+			Labels: map[string]string{
+				image.WerfLabel:                 projectName,
+				image.WerfManagedImageNameLabel: imageName,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create image %q: %s", fullImageName, err)
+	}
+
+	if err := docker_registry.PushImage(fullImageName, recordImage); err != nil {
+		return fmt.Errorf("unable to push image %q: %s", fullImageName, err)
+	}
+
+	return nil
+}
+
+func (storage *RepoStagesStorage) RmManagedImage(projectName, imageName string) error {
+	logboek.Debug.LogF("-- RepoStagesStorage.RmManagedImage %s %s\n", projectName, imageName)
+
+	tag := makeRepoManagedImageRecordTag(imageName)
+
+	if exists, err := storage.isTagExist(tag); err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+
+	fullImageName := fmt.Sprintf("%s:%s", storage.RepoAddress, tag)
+	if err := docker_registry.ImageDelete(fullImageName); err != nil {
+		return fmt.Errorf("unable to remove image %q: %s", fullImageName, err)
+	}
+
+	return nil
+}
+
+func (storage *RepoStagesStorage) GetManagedImages(projectName string) ([]string, error) {
+	logboek.Debug.LogF("-- RepoStagesStorage.GetManagedImages %s\n", projectName)
+
+	tags, err := docker_registry.Tags(storage.RepoAddress)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get repo %s tags: %s", storage.RepoAddress, err)
+	}
+
+	res := []string{}
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, image.RepoManagedImageRecord_ImageTagPrefix) {
+			continue
+		}
+
+		fullImageName := fmt.Sprintf("%s:%s", storage.RepoAddress, tag)
+		configFile, err := docker_registry.ImageConfigFile(fullImageName)
+		if err != nil {
+			if strings.Contains(err.Error(), "MANIFEST_UNKNOWN") || strings.Contains(err.Error(), "BLOB_UNKNOWN") {
+				logboek.LogWarnF("WARNING: Broken tag %s was skipped: %s\n", fullImageName, err)
+				continue
+			}
+			return nil, fmt.Errorf("unable to get image %s config: %s", fullImageName, err)
+		}
+
+		if managedImageName, hasLabel := configFile.Config.Labels[image.WerfManagedImageNameLabel]; hasLabel {
+			res = append(res, managedImageName)
+			continue
+		}
+
+		// records without the label are created by previous werf versions with the managed image name in the tag
+		managedImageName := strings.TrimPrefix(tag, image.RepoManagedImageRecord_ImageTagPrefix)
+		if managedImageName == NamelessImageRecordTag {
+			res = append(res, "")
+		} else {
+			res = append(res, managedImageName)
+		}
+	}
+
+	return res, nil
+}
+
+func (storage *RepoStagesStorage) String() string {
+	return storage.RepoAddress
+}
+
+func (storage *RepoStagesStorage) isTagExist(tag string) (bool, error) {
+	tags, err := docker_registry.Tags(storage.RepoAddress)
+	if err != nil {
+		return false, fmt.Errorf("unable to get repo %s tags: %s", storage.RepoAddress, err)
+	}
+
+	for _, t := range tags {
+		if t == tag {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// go-containerregistry, which is used to access the repo, does not accept tags longer than 127 chars
+const repoManagedImageRecordTagMaxSize = 127
+
+func makeRepoManagedImageRecordTag(imageName string) string {
+	if imageName == "" {
+		return image.RepoManagedImageRecord_ImageTagPrefix + NamelessImageRecordTag
+	}
+
+	tag := image.RepoManagedImageRecord_ImageTagPrefix + imageName
+	if slug.ValidateDockerTag(tag) == nil && len(tag) <= repoManagedImageRecordTagMaxSize {
+		return tag
+	}
+
+	return slug.LimitedSlug(tag, repoManagedImageRecordTagMaxSize)
+}
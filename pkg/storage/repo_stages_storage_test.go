@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/flant/werf/pkg/docker_registry"
+	"github.com/flant/werf/pkg/image"
+	"github.com/flant/werf/pkg/slug"
+)
+
+// testRegistry adds tags listing and manifests deletion to the in-memory registry of go-containerregistry
+type testRegistry struct {
+	handler http.Handler
+
+	mutex sync.Mutex
+	tags  map[string]map[string]bool
+}
+
+func newTestRegistry() *testRegistry {
+	return &testRegistry{
+		handler: registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))),
+		tags:    make(map[string]map[string]bool),
+	}
+}
+
+func (r *testRegistry) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+
+	if strings.HasSuffix(path, "/tags/list") && req.Method == http.MethodGet {
+		repo := strings.TrimSuffix(path, "/tags/list")
+
+		r.mutex.Lock()
+		tags := []string{}
+		for tag := range r.tags[repo] {
+			tags = append(tags, tag)
+		}
+		r.mutex.Unlock()
+		sort.Strings(tags)
+
+		resp.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(resp).Encode(map[string]interface{}{"name": repo, "tags": tags})
+		return
+	}
+
+	if parts := strings.SplitN(path, "/manifests/", 2); len(parts) == 2 && !strings.HasPrefix(parts[1], "sha256:") {
+		repo, tag := parts[0], parts[1]
+
+		r.mutex.Lock()
+		exists := r.tags[repo][tag]
+		switch req.Method {
+		case http.MethodPut:
+			if r.tags[repo] == nil {
+				r.tags[repo] = make(map[string]bool)
+			}
+			r.tags[repo][tag] = true
+		case http.MethodDelete:
+			delete(r.tags[repo], tag)
+		}
+		r.mutex.Unlock()
+
+		switch {
+		case req.Method == http.MethodDelete:
+			resp.WriteHeader(http.StatusAccepted)
+			return
+		case req.Method != http.MethodPut && !exists:
+			resp.WriteHeader(http.StatusNotFound)
+			_, _ = resp.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"Unknown manifest"}]}`))
+			return
+		}
+	}
+
+	r.handler.ServeHTTP(resp, req)
+}
+
+func newTestRepoStagesStorage(t *testing.T) (*RepoStagesStorage, func()) {
+	server := httptest.NewServer(newTestRegistry())
+	return NewRepoStagesStorage(fmt.Sprintf("%s/myproject", strings.TrimPrefix(server.URL, "http://"))), server.Close
+}
+
+func pushTestImage(t *testing.T, reference string, labels map[string]string, createdAt time.Time) {
+	img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{
+		OS:      "linux",
+		Created: v1.Time{Time: createdAt},
+		RootFS:  v1.RootFS{Type: "layers"},
+		Config:  v1.Config{Labels: labels},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := docker_registry.PushImage(reference, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testStageImage struct {
+	image.ImageInterface
+
+	t         *testing.T
+	name      string
+	labels    map[string]string
+	createdAt time.Time
+}
+
+func (img *testStageImage) Name() string {
+	return img.name
+}
+
+func (img *testStageImage) TagBuiltImage(name string) error {
+	img.name = name
+	return nil
+}
+
+func (img *testStageImage) Push() error {
+	pushTestImage(img.t, img.name, img.labels, img.createdAt)
+	return nil
+}
+
+func (img *testStageImage) SyncDockerState() error {
+	return nil
+}
+
+func TestMakeRepoManagedImageRecordTag(t *testing.T) {
+	longImageName := strings.Repeat("backend", 20)
+
+	tests := []struct {
+		imageName   string
+		expectedTag string
+	}{
+		{"", "managed-image-__nameless__"},
+		{"backend", "managed-image-backend"},
+		{"Back_end.1", "managed-image-Back_end.1"},
+		{"group/backend", "managed-image-group-backend-77981de2"},
+		{longImageName, "managed-image-" + strings.Repeat("backend", 14) + "backen-6a4ca885"},
+	}
+
+	for _, test := range tests {
+		tag := makeRepoManagedImageRecordTag(test.imageName)
+
+		if tag != test.expectedTag {
+			t.Errorf("\n[IMAGE NAME]: %q\n[EXPECTED]: %v\n[GOT]: %v", test.imageName, test.expectedTag, tag)
+		}
+
+		if err := slug.ValidateDockerTag(tag); err != nil || len(tag) > repoManagedImageRecordTagMaxSize {
+			t.Errorf("\n[IMAGE NAME]: %q\n[EXPECTED]: valid docker tag of %d chars max\n[GOT]: %v", test.imageName, repoManagedImageRecordTagMaxSize, tag)
+		}
+
+		if !strings.HasPrefix(tag, image.RepoManagedImageRecord_ImageTagPrefix) {
+			t.Errorf("\n[IMAGE NAME]: %q\n[EXPECTED]: tag with prefix %s\n[GOT]: %v", test.imageName, image.RepoManagedImageRecord_ImageTagPrefix, tag)
+		}
+	}
+}
+
+func TestRepoStagesStorage_ManagedImages(t *testing.T) {
+	storage, closeServer := newTestRepoStagesStorage(t)
+	defer closeServer()
+
+	longImageName := strings.Repeat("backend", 20)
+	imageNames := []string{"", "backend", "group/backend", longImageName}
+
+	for _, imageName := range imageNames {
+		if err := storage.AddManagedImage("myproject", imageName); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the record already exists
+	if err := storage.AddManagedImage("myproject", "backend"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the record created by previous werf versions without the managed image name label
+	pushTestImage(t, storage.RepoAddress+":managed-image-legacy", nil, time.Now())
+
+	managedImages, err := storage.GetManagedImages("myproject")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedManagedImages := append([]string{"legacy"}, imageNames...)
+	sort.Strings(expectedManagedImages)
+	sort.Strings(managedImages)
+	if !reflect.DeepEqual(expectedManagedImages, managedImages) {
+		t.Fatalf("\n[EXPECTED]: %v\n[GOT]: %v", expectedManagedImages, managedImages)
+	}
+
+	for _, imageName := range []string{"group/backend", longImageName, "legacy", "not-exist"} {
+		if err := storage.RmManagedImage("myproject", imageName); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	managedImages, err = storage.GetManagedImages("myproject")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedManagedImages = []string{"", "backend"}
+	sort.Strings(managedImages)
+	if !reflect.DeepEqual(expectedManagedImages, managedImages) {
+		t.Fatalf("\n[EXPECTED]: %v\n[GOT]: %v", expectedManagedImages, managedImages)
+	}
+}
+
+func TestRepoStagesStorage_StageImages(t *testing.T) {
+	storage, closeServer := newTestRepoStagesStorage(t)
+	defer closeServer()
+
+	createdAt := time.Unix(1583230262, 0)
+
+	stageImages := []struct {
+		signature, uniqueID, projectName string
+	}{
+		{"abcd", "1583230262", "myproject"},
+		{"abcd", "1583230263", "myproject"},
+		{"abcd", "1583230264", "otherproject"},
+		{"efgh", "1583230265", "myproject"},
+	}
+
+	for _, stageImage := range stageImages {
+		stageImageName := storage.ConstructStageImageName("myproject", stageImage.signature, stageImage.uniqueID)
+		img := &testStageImage{
+			t:    t,
+			name: stageImageName,
+			labels: map[string]string{
+				image.WerfLabel:               stageImage.projectName,
+				image.WerfStageSignatureLabel: stageImage.signature,
+			},
+			createdAt: createdAt,
+		}
+
+		if err := storage.StoreStageImage(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	imagesInfos, err := storage.GetImagesBySignature("myproject", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedImagesInfos := []*ImageInfo{}
+	for _, uniqueID := range []string{"1583230262", "1583230263"} {
+		expectedImagesInfos = append(expectedImagesInfos, &ImageInfo{
+			ImageName:         fmt.Sprintf("%s:abcd-%s", storage.RepoAddress, uniqueID),
+			Signature:         "abcd",
+			Labels:            map[string]string{image.WerfLabel: "myproject", image.WerfStageSignatureLabel: "abcd"},
+			CreatedAtUnixNano: createdAt.UnixNano(),
+		})
+	}
+	if !reflect.DeepEqual(expectedImagesInfos, imagesInfos) {
+		t.Fatalf("\n[EXPECTED]: %#v\n[GOT]: %#v", expectedImagesInfos, imagesInfos)
+	}
+
+	imagesInfos, err = storage.GetImagesBySignature("myproject", "ijkl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imagesInfos) != 0 {
+		t.Fatalf("\n[EXPECTED]: no images\n[GOT]: %#v", imagesInfos)
+	}
+}
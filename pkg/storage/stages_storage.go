@@ -20,6 +20,7 @@ func (info *ImageInfo) CreatedAt() time.Time {
 type StagesStorage interface {
 	// TODO cleanup GetAllImages() ([]StageImage, error)
 	GetImagesBySignature(projectName, signature string) ([]*ImageInfo, error)
+	ConstructStageImageName(projectName, signature, uniqueID string) string
 
 	// в том числе docker pull из registry + image.SyncDockerState
 	// lock по имени image чтобы не делать 2 раза pull одновременно
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/json"
+
+	"github.com/flant/logboek"
+)
+
+var stagesStorageCacheRecordPathPartRegexp = regexp.MustCompile(`^[a-zA-Z0-9_\-][a-zA-Z0-9_.\-]*$`)
+
+type stagesStorageCacheHandler struct {
+	Cache StagesStorageCache
+
+	mutex sync.RWMutex
+}
+
+// NewStagesStorageCacheHandler serves the HttpStagesStorageCache protocol using the specified cache as a backend
+func NewStagesStorageCacheHandler(cache StagesStorageCache) http.Handler {
+	return &stagesStorageCacheHandler{Cache: cache}
+}
+
+func (handler *stagesStorageCacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	projectName, signature, err := parseStagesStorageCacheRecordPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handler.getImagesBySignature(w, projectName, signature)
+	case http.MethodPut:
+		handler.storeImagesBySignature(w, r, projectName, signature)
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (handler *stagesStorageCacheHandler) getImagesBySignature(w http.ResponseWriter, projectName, signature string) {
+	handler.mutex.RLock()
+	exists, imagesDescs, err := handler.Cache.GetImagesBySignature(projectName, signature)
+	handler.mutex.RUnlock()
+
+	if err != nil {
+		logboek.LogErrorF("Error getting project %s stage %s images: %s\n", projectName, signature, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !exists {
+		http.Error(w, fmt.Sprintf("project %s stage %s images not found", projectName, signature), http.StatusNotFound)
+		return
+	}
+
+	dataBytes, err := json.Marshal(ImageInfosCacheData{ImagesDescs: imagesDescs})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(dataBytes)
+}
+
+func (handler *stagesStorageCacheHandler) storeImagesBySignature(w http.ResponseWriter, r *http.Request, projectName, signature string) {
+	dataBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	data := &ImageInfosCacheData{}
+	if err := json.Unmarshal(dataBytes, data); err != nil {
+		http.Error(w, fmt.Sprintf("error unmarshalling json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	handler.mutex.Lock()
+	err = handler.Cache.StoreImagesBySignature(projectName, signature, data.ImagesDescs)
+	handler.mutex.Unlock()
+
+	if err != nil {
+		logboek.LogErrorF("Error storing project %s stage %s images: %s\n", projectName, signature, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logboek.Info.LogF("Stored project %s stage %s images: %d record(s)\n", projectName, signature, len(data.ImagesDescs))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseStagesStorageCacheRecordPath(path string) (string, string, error) {
+	if !strings.HasPrefix(path, HttpStagesStorageCacheApiPrefix+"/") {
+		return "", "", fmt.Errorf("path %s not found", path)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, HttpStagesStorageCacheApiPrefix+"/"), "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("path %s not found: expected %s/PROJECT/SIGNATURE", path, HttpStagesStorageCacheApiPrefix)
+	}
+
+	for _, part := range parts {
+		if !stagesStorageCacheRecordPathPartRegexp.MatchString(part) {
+			return "", "", fmt.Errorf("path %s not found: bad project name or signature %q", path, part)
+		}
+	}
+
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,40 @@
+package tag_strategy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+var semverGitTagRegexp = regexp.MustCompile(`^v?\d+\.\d+\.\d+(-[0-9A-Za-z\-.]+)?(\+[0-9A-Za-z\-.]+)?$`)
+
+// ParseSemverGitTag parses git tag in the form [v]MAJOR.MINOR.PATCH[-PRERELEASE][+METADATA]
+func ParseSemverGitTag(gitTag string) (*semver.Version, error) {
+	if !semverGitTagRegexp.MatchString(gitTag) {
+		return nil, fmt.Errorf("git tag %q is not a semantic version: expected [v]MAJOR.MINOR.PATCH[-PRERELEASE][+METADATA]", gitTag)
+	}
+
+	return semver.NewVersion(gitTag)
+}
+
+// SemverTags returns docker tags to publish the version by: MAJOR.MINOR.PATCH, MAJOR.MINOR and MAJOR.
+// Pre-release version is published only by the full version tag.
+// Build metadata is not a part of docker tags.
+func SemverTags(version *semver.Version) []string {
+	fullTag := SemverFullTag(version)
+	if version.Prerelease() != "" {
+		return []string{fullTag}
+	}
+
+	return []string{
+		fullTag,
+		fmt.Sprintf("%d.%d", version.Major(), version.Minor()),
+		fmt.Sprintf("%d", version.Major()),
+	}
+}
+
+func SemverFullTag(version *semver.Version) string {
+	return strings.SplitN(version.String(), "+", 2)[0]
+}
@@ -8,4 +8,6 @@ const (
 	GitBranch       TagStrategy = "git-branch"
 	GitCommit       TagStrategy = "git-commit"
 	StagesSignature TagStrategy = "stages-signature"
+	Semver          TagStrategy = "semver"
+	Template        TagStrategy = "template"
 )
@@ -0,0 +1,104 @@
+package tag_strategy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemverTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		gitTag string
+		result []string
+	}{
+		{
+			name:   "release",
+			gitTag: "1.2.3",
+			result: []string{"1.2.3", "1.2", "1"},
+		},
+		{
+			name:   "releaseWithPrefix",
+			gitTag: "v1.2.3",
+			result: []string{"1.2.3", "1.2", "1"},
+		},
+		{
+			name:   "releaseWithMetadata",
+			gitTag: "v1.2.3+build.5",
+			result: []string{"1.2.3", "1.2", "1"},
+		},
+		{
+			name:   "prerelease",
+			gitTag: "v2.0.0-rc.1",
+			result: []string{"2.0.0-rc.1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, err := ParseSemverGitTag(test.gitTag)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result := SemverTags(version); !reflect.DeepEqual(result, test.result) {
+				t.Errorf("\n[EXPECTED]: %v\n[GOT]: %v", test.result, result)
+			}
+		})
+	}
+}
+
+func TestParseSemverGitTagBadTag(t *testing.T) {
+	for _, gitTag := range []string{"", "1.2", "release-1.2.3", "v1.2.3.4", "V1.2.3"} {
+		if _, err := ParseSemverGitTag(gitTag); err == nil {
+			t.Errorf("expected error for git tag %q", gitTag)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	data := TemplateData{
+		GitBranch:      "feature/x",
+		GitCommit:      "0123456789abcdef",
+		GitCommitShort: "01234567",
+		CIPipelineId:   "42",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		result   string
+	}{
+		{
+			name:     "values",
+			template: "{{ .GitCommitShort }}-{{ .CIPipelineId }}",
+			result:   "01234567-42",
+		},
+		{
+			name:     "sprig",
+			template: `{{ .GitBranch | replace "/" "-" }}-{{ .GitCommit | trunc 4 }}`,
+			result:   "feature-x-0123",
+		},
+		{
+			name:     "spaces",
+			template: " {{ .CIPipelineId }}\n",
+			result:   "42",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := RenderTemplate(test.template, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != test.result {
+				t.Errorf("\n[EXPECTED]: %q\n[GOT]: %q", test.result, result)
+			}
+		})
+	}
+
+	if _, err := RenderTemplate("{{ .Unknown }}", data); err == nil {
+		t.Error("expected error for unknown template value")
+	}
+}
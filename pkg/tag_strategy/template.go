@@ -0,0 +1,36 @@
+package tag_strategy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+)
+
+// TemplateData is available in the tag template, e.g. '{{ .GitBranch }}-{{ .CIPipelineId }}'.
+// Sprig functions (http://masterminds.github.io/sprig/) are also available, env function among others.
+type TemplateData struct {
+	GitTag         string
+	GitBranch      string
+	GitCommit      string
+	GitCommitShort string
+
+	CIPipelineId string
+	CIJobId      string
+}
+
+func RenderTemplate(tagTemplate string, data TemplateData) (string, error) {
+	tmpl, err := template.New("tag").Funcs(sprig.TxtFuncMap()).Option("missingkey=error").Parse(tagTemplate)
+	if err != nil {
+		return "", fmt.Errorf("bad tag template %q: %s", tagTemplate, err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("unable to render tag template %q: %s", tagTemplate, err)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -21,7 +21,7 @@ var (
 )
 
 func runGC() error {
-	return shluz.WithLock("gc", shluz.LockOptions{}, func() error {
+	return werf.WithHostLock("gc", shluz.LockOptions{}, func() error {
 		return GC(false)
 	})
 }
@@ -92,7 +92,7 @@ func writeArchive(out io.Writer, gitDir, workTreeCacheDir string, withSubmodules
 		return nil, fmt.Errorf("cannot prepare work tree in cache %s for commit %s: %s", workTreeCacheDir, opts.Commit, err)
 	}
 
-	repository, err := gitOpenWithCustomWorktreeDir(gitDir, workTreeDir)
+	repository, err := OpenWorkTreeRepository(gitDir, workTreeDir, opts.Commit)
 	if err != nil {
 		return nil, fmt.Errorf("git open with custom worktree dir failed: %s", err)
 	}
@@ -0,0 +1,243 @@
+package true_git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+const MinGitVersionWithPartialCloneConstraintValue = "2.25"
+
+type CloneOptions struct {
+	// Depth limits the history to the number of commits from the tip of each branch, 0 means the whole history
+	Depth int
+	// WithoutBlobs makes the partial clone: blobs are not fetched until they are needed
+	WithoutBlobs bool
+}
+
+type FetchOptions struct {
+	// Depth limits the history to the number of commits from the tip of each branch, 0 keeps the current depth
+	Depth int
+	// Commit fetches the single commit instead of branches and tags
+	Commit string
+}
+
+// IsPartialCloneSupported reports whether shallow and partial clones can be made and used:
+// go-git backend cannot fetch missing objects on demand, so the git binary is required
+func IsPartialCloneSupported() bool {
+	if backend != GitBackend {
+		return false
+	}
+
+	constraint, err := semver.NewConstraint(fmt.Sprintf(">= %s", MinGitVersionWithPartialCloneConstraintValue))
+	if err != nil {
+		panic(err)
+	}
+
+	return constraint.Check(gitVersion)
+}
+
+// Clone makes the bare clone of the url which remote branches are stored in refs/remotes/origin/*
+func Clone(url, gitDir string, opts CloneOptions) error {
+	cloneArgs := []string{"clone", "--bare", "--no-single-branch"}
+	if opts.Depth > 0 {
+		cloneArgs = append(cloneArgs, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.WithoutBlobs {
+		cloneArgs = append(cloneArgs, "--filter=blob:none")
+	}
+	cloneArgs = append(cloneArgs, url, gitDir)
+
+	if err := runGitCommand(cloneArgs...); err != nil {
+		return err
+	}
+
+	if err := runGitCommand("--git-dir", gitDir, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		return err
+	}
+
+	return Fetch(gitDir, FetchOptions{Depth: opts.Depth})
+}
+
+// Fetch fetches branches and tags of the origin remote
+func Fetch(gitDir string, opts FetchOptions) error {
+	fetchArgs := []string{"--git-dir", gitDir, "fetch", "--force"}
+
+	if opts.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(opts.Depth))
+	}
+
+	if opts.Commit != "" {
+		fetchArgs = append(fetchArgs, "origin", opts.Commit)
+	} else {
+		fetchArgs = append(fetchArgs, "--tags", "origin")
+	}
+
+	return runGitCommand(fetchArgs...)
+}
+
+// ShallowCommits returns commits which parents are not fetched into the shallow clone,
+// empty result means that the clone has the whole history
+func ShallowCommits(gitDir string) ([]string, error) {
+	shallowPath := filepath.Join(gitDir, "shallow")
+
+	data, err := ioutil.ReadFile(shallowPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", shallowPath, err)
+	}
+
+	var res []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			res = append(res, line)
+		}
+	}
+
+	return res, nil
+}
+
+// IsSparseCheckoutPathsUpToDate reports whether work trees of the repository are limited to the paths by SetSparseCheckoutPaths
+func IsSparseCheckoutPathsUpToDate(gitDir string, paths []string) (bool, error) {
+	sparseCheckoutPath := filepath.Join(gitDir, "info", "sparse-checkout")
+
+	data, err := ioutil.ReadFile(sparseCheckoutPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error reading %s: %s", sparseCheckoutPath, err)
+	}
+
+	return string(data) == sparseCheckoutPatterns(paths), nil
+}
+
+// SetSparseCheckoutPaths limits work trees of the repository to the paths, empty paths mean the whole tree.
+// Parent directories of the paths are checked out without their content,
+// so the submodules the paths are inside of are checked out too.
+// The work tree prepared by WithWorkTree is switched again when the paths are changed.
+func SetSparseCheckoutPaths(gitDir string, paths []string) error {
+	sparseCheckoutPath := filepath.Join(gitDir, "info", "sparse-checkout")
+	patterns := sparseCheckoutPatterns(paths)
+
+	if data, err := ioutil.ReadFile(sparseCheckoutPath); err == nil && string(data) == patterns {
+		return nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s: %s", sparseCheckoutPath, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sparseCheckoutPath), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create dir %s: %s", filepath.Dir(sparseCheckoutPath), err)
+	}
+
+	if err := ioutil.WriteFile(sparseCheckoutPath, []byte(patterns), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %s", sparseCheckoutPath, err)
+	}
+
+	if err := runGitCommand("--git-dir", gitDir, "config", "core.sparseCheckout", "true"); err != nil {
+		return err
+	}
+
+	// Invalidate the work tree: it was checked out with other paths
+	repoToCacheLinkFilePath := filepath.Join(gitDir, "werf_work_tree_cache_dir")
+	if err := os.RemoveAll(repoToCacheLinkFilePath); err != nil {
+		return fmt.Errorf("unable to remove %s: %s", repoToCacheLinkFilePath, err)
+	}
+
+	return nil
+}
+
+func sparseCheckoutPatterns(paths []string) string {
+	if len(paths) == 0 {
+		return "/*\n"
+	}
+
+	included := map[string]bool{}
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+filepath.ToSlash(p)), "/")
+		if p == "" {
+			return "/*\n"
+		}
+		included[p] = true
+	}
+
+	isIncluded := func(p string) bool {
+		for {
+			if included[p] {
+				return true
+			}
+
+			ind := strings.LastIndex(p, "/")
+			if ind == -1 {
+				return false
+			}
+			p = p[:ind]
+		}
+	}
+
+	// .gitmodules is required to check out submodules
+	entries := map[string]bool{".gitmodules": true}
+	parents := map[string]bool{}
+	for p := range included {
+		if ind := strings.LastIndex(p, "/"); ind != -1 && isIncluded(p[:ind]) {
+			continue
+		}
+
+		entries[p] = true
+		for ind := strings.LastIndex(p, "/"); ind != -1; ind = strings.LastIndex(p, "/") {
+			p = p[:ind]
+			entries[p] = true
+			parents[p] = true
+		}
+	}
+
+	var sorted []string
+	for p := range entries {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		iDepth, jDepth := strings.Count(sorted[i], "/"), strings.Count(sorted[j], "/")
+		if iDepth != jDepth {
+			return iDepth < jDepth
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	// The last matching pattern wins: the content of a parent is excluded before deeper entries are included
+	buf := &bytes.Buffer{}
+	for ind, p := range sorted {
+		fmt.Fprintf(buf, "/%s\n", p)
+
+		if ind == len(sorted)-1 || strings.Count(sorted[ind+1], "/") != strings.Count(p, "/") {
+			for _, parent := range sorted {
+				if strings.Count(parent, "/") == strings.Count(p, "/") && parents[parent] {
+					fmt.Fprintf(buf, "!/%s/*\n", parent)
+				}
+			}
+		}
+	}
+
+	return buf.String()
+}
+
+func runGitCommand(args ...string) error {
+	cmd := exec.Command("git", args...)
+
+	output := setCommandRecordingLiveOutput(cmd)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("'git %s' failed: %s:\n%s", strings.Join(args, " "), err, output.String())
+	}
+
+	return nil
+}
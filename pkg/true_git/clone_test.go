@@ -0,0 +1,48 @@
+package true_git
+
+import "testing"
+
+func TestSparseCheckoutPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		expected string
+	}{
+		{
+			name:     "no paths",
+			paths:    nil,
+			expected: "/*\n",
+		},
+		{
+			name:     "root path",
+			paths:    []string{"a", ""},
+			expected: "/*\n",
+		},
+		{
+			name:     "top level paths",
+			paths:    []string{"b", "/a/"},
+			expected: "/.gitmodules\n/a\n/b\n",
+		},
+		{
+			name:  "nested paths",
+			paths: []string{"vendor/lib/src", "a/b", "a/c", "a/b/d"},
+			expected: "/.gitmodules\n" +
+				"/a\n" +
+				"/vendor\n" +
+				"!/a/*\n" +
+				"!/vendor/*\n" +
+				"/a/b\n" +
+				"/a/c\n" +
+				"/vendor/lib\n" +
+				"!/vendor/lib/*\n" +
+				"/vendor/lib/src\n",
+		},
+	}
+
+	for _, test := range tests {
+		got := sparseCheckoutPatterns(test.paths)
+		if got != test.expected {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expected, got)
+		}
+	}
+}
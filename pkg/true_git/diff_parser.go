@@ -18,6 +18,8 @@ func makeDiffParser(out io.Writer, pathMatcher path_matcher.PathMatcher) *diffPa
 		OutLines:    0,
 		Paths:       make([]string, 0),
 		BinaryPaths: make([]string, 0),
+		LFSPaths:    make([]string, 0),
+		LFSOids:     make([]string, 0),
 		state:       unrecognized,
 		lineBuf:     make([]byte, 0, 4096),
 	}
@@ -46,6 +48,12 @@ type diffParser struct {
 	BinaryPaths   []string
 	LastSeenPaths []string
 
+	LFSPaths []string
+	LFSOids  []string
+	// LFSObjectsSize is the total size of objects the pointers point to in the ToCommit
+	LFSObjectsSize int64
+	isLastSeenLFS  bool
+
 	state   parserState
 	lineBuf []byte
 }
@@ -210,7 +218,7 @@ func (p *diffParser) handleDiffLine(line string) error {
 		if strings.HasPrefix(line, "Submodule ") {
 			return p.handleSubmoduleLine(line)
 		}
-		return p.writeOutLine(line)
+		return p.handleDiffBodyLine(line)
 	}
 
 	return nil
@@ -238,6 +246,7 @@ func (p *diffParser) handleDiffBegin(line string) error {
 	trimmedPaths := make(map[string]string)
 
 	p.LastSeenPaths = nil
+	p.isLastSeenLFS = false
 
 	for _, data := range []struct{ PathWithPrefix, Prefix string }{{a, "a/"}, {b, "b/"}} {
 		if strings.HasPrefix(data.PathWithPrefix, "\"") && strings.HasSuffix(data.PathWithPrefix, "\"") {
@@ -357,3 +366,28 @@ func (p *diffParser) handleShortBinaryHeader(line string) error {
 
 	return p.writeOutLine(line)
 }
+
+// handleDiffBodyLine detects Git LFS pointer files: the pointer has 3 lines,
+// so every hunk contains the version line
+func (p *diffParser) handleDiffBodyLine(line string) error {
+	if len(line) > 0 && !strings.HasPrefix(line, "@@ ") {
+		content := line[1:]
+
+		if content == LFSPointerVersion {
+			p.isLastSeenLFS = true
+			for _, path := range p.LastSeenPaths {
+				p.LFSPaths = appendUnique(p.LFSPaths, path)
+			}
+		} else if p.isLastSeenLFS && line[0] != '-' {
+			if strings.HasPrefix(content, LFSPointerOidPrefix) {
+				p.LFSOids = appendUnique(p.LFSOids, strings.TrimPrefix(content, LFSPointerOidPrefix))
+			} else if strings.HasPrefix(content, LFSPointerSizePrefix) {
+				if size, err := strconv.ParseInt(strings.TrimPrefix(content, LFSPointerSizePrefix), 10, 64); err == nil {
+					p.LFSObjectsSize += size
+				}
+			}
+		}
+	}
+
+	return p.writeOutLine(line)
+}
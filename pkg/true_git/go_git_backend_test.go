@@ -0,0 +1,369 @@
+package true_git
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/path_matcher"
+)
+
+// gitFixture is a repository with renames, binary files, mode changes, paths with spaces and a submodule,
+// the same operations of both backends should produce the same output for the commits of the repository
+type gitFixture struct {
+	dir          string
+	gitDir       string
+	commits      []string
+	submoduleDir string
+}
+
+func setTestEnv(t *testing.T, env map[string]string) func() {
+	oldEnv := map[string]*string{}
+	for name, value := range env {
+		if oldValue, exists := os.LookupEnv(name); exists {
+			oldEnv[name] = &oldValue
+		} else {
+			oldEnv[name] = nil
+		}
+
+		if err := os.Setenv(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return func() {
+		for name, oldValue := range oldEnv {
+			if oldValue == nil {
+				_ = os.Unsetenv(name)
+			} else {
+				_ = os.Setenv(name, *oldValue)
+			}
+		}
+	}
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, output)
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+func writeTestFile(t *testing.T, path string, data []byte, perm os.FileMode) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, data, perm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newGitFixture(t *testing.T, tmpDir string) *gitFixture {
+	submoduleDir := filepath.Join(tmpDir, "submodule")
+	runTestGit(t, tmpDir, "init", "-q", submoduleDir)
+	writeTestFile(t, filepath.Join(submoduleDir, "lib.txt"), []byte("lib 1\n"), 0644)
+	runTestGit(t, submoduleDir, "add", "-A")
+	runTestGit(t, submoduleDir, "commit", "-q", "-m", "lib 1")
+
+	dir := filepath.Join(tmpDir, "repo")
+	runTestGit(t, tmpDir, "init", "-q", dir)
+
+	f := &gitFixture{dir: dir, gitDir: filepath.Join(dir, ".git"), submoduleDir: submoduleDir}
+	commit := func(message string) {
+		runTestGit(t, dir, "add", "-A")
+		runTestGit(t, dir, "commit", "-q", "-m", message)
+		f.commits = append(f.commits, runTestGit(t, dir, "rev-parse", "HEAD"))
+	}
+
+	binaryData := []byte{0, 1, 2, 3, 'b', 'i', 'n', 0, 255}
+
+	writeTestFile(t, filepath.Join(dir, "README.md"), []byte("readme\n"), 0644)
+	writeTestFile(t, filepath.Join(dir, "old name.txt"), []byte("line 1\nline 2\nline 3\n"), 0644)
+	writeTestFile(t, filepath.Join(dir, "dir with spaces", "file.txt"), []byte("spaces\n"), 0644)
+	writeTestFile(t, filepath.Join(dir, "script.sh"), []byte("#!/bin/sh\necho ok\n"), 0644)
+	writeTestFile(t, filepath.Join(dir, "data.bin"), binaryData, 0644)
+	commit("initial")
+
+	runTestGit(t, dir, "mv", "old name.txt", "new name.txt")
+	writeTestFile(t, filepath.Join(dir, "dir with spaces", "file.txt"), []byte("spaces\nmore spaces\n"), 0644)
+	writeTestFile(t, filepath.Join(dir, "script.sh"), []byte("#!/bin/sh\necho ok\n"), 0755)
+	writeTestFile(t, filepath.Join(dir, "data.bin"), append(binaryData, 0, 42), 0644)
+	if err := os.Symlink("README.md", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	runTestGit(t, dir, "submodule", "add", "-q", submoduleDir, "modules/lib")
+	commit("rename, binary, mode, spaces and submodule")
+
+	writeTestFile(t, filepath.Join(submoduleDir, "lib.txt"), []byte("lib 1\nlib 2\n"), 0644)
+	writeTestFile(t, filepath.Join(submoduleDir, "lib data.bin"), binaryData, 0644)
+	runTestGit(t, submoduleDir, "add", "-A")
+	runTestGit(t, submoduleDir, "commit", "-q", "-m", "lib 2")
+	runTestGit(t, filepath.Join(dir, "modules", "lib"), "pull", "-q", "origin", "HEAD")
+	writeTestFile(t, filepath.Join(dir, "script.sh"), []byte("#!/bin/sh\necho ok\n"), 0644)
+	commit("update submodule")
+
+	return f
+}
+
+func withTestBackend(name string, f func()) {
+	oldBackend := backend
+	backend = name
+	defer func() { backend = oldBackend }()
+
+	f()
+}
+
+func prepareTestGitBackends(t *testing.T) (*gitFixture, string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary is required")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "werf-true-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreEnv := setTestEnv(t, map[string]string{
+		"HOME":                tmpDir,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_AUTHOR_NAME":     "werf",
+		"GIT_AUTHOR_EMAIL":    "werf@example.com",
+		"GIT_AUTHOR_DATE":     "2020-01-01T00:00:00Z",
+		"GIT_COMMITTER_NAME":  "werf",
+		"GIT_COMMITTER_EMAIL": "werf@example.com",
+		"GIT_COMMITTER_DATE":  "2020-01-01T00:00:00Z",
+		// local submodules are forbidden by default since git 2.38.1
+		"GIT_CONFIG_COUNT":   "1",
+		"GIT_CONFIG_KEY_0":   "protocol.file.allow",
+		"GIT_CONFIG_VALUE_0": "always",
+		"WERF_GIT_BACKEND":   "",
+	})
+
+	cleanup := func() {
+		restoreEnv()
+		_ = os.RemoveAll(tmpDir)
+	}
+
+	if err := shluz.Init(filepath.Join(tmpDir, "locks")); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	if err := Init(Options{Out: ioutil.Discard, Err: ioutil.Discard}); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return newGitFixture(t, tmpDir), tmpDir, cleanup
+}
+
+// normalizeTestArchive drops modification times, which depend on the work tree checkout time
+func normalizeTestArchive(t *testing.T, data []byte) string {
+	res := &strings.Builder{}
+
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(res, "%s %c %o %d %q\n%q\n", header.Name, header.Typeflag, header.Mode, header.Size, header.Linkname, content)
+	}
+
+	return res.String()
+}
+
+// normalizeTestBinaryPatch replaces deflated data of binary patch literals with the inflated data:
+// the go-git backend and git use different deflate implementations, so that the compressed data may differ,
+// but both are inflated into the same content by git apply
+func normalizeTestBinaryPatch(t *testing.T, patch string) string {
+	res := &strings.Builder{}
+
+	lines := strings.SplitAfter(patch, "\n")
+	for i := 0; i < len(lines); i++ {
+		res.WriteString(lines[i])
+		if !strings.HasPrefix(lines[i], "literal ") && !strings.HasPrefix(lines[i], "delta ") {
+			continue
+		}
+
+		deflated := &bytes.Buffer{}
+		for i+1 < len(lines) && strings.TrimSuffix(lines[i+1], "\n") != "" {
+			i++
+			deflated.Write(decodeTestBase85Line(t, strings.TrimSuffix(lines[i], "\n")))
+		}
+
+		zr, err := zlib.NewReader(deflated)
+		if err != nil {
+			t.Fatalf("cannot inflate binary patch data: %s", err)
+		}
+
+		data, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("cannot inflate binary patch data: %s", err)
+		}
+
+		fmt.Fprintf(res, "%x\n", data)
+	}
+
+	return res.String()
+}
+
+func decodeTestBase85Line(t *testing.T, line string) []byte {
+	var n int
+	switch l := line[0]; {
+	case l >= 'A' && l <= 'Z':
+		n = int(l-'A') + 1
+	case l >= 'a' && l <= 'z':
+		n = int(l-'a') + 27
+	default:
+		t.Fatalf("bad binary patch line %q", line)
+	}
+
+	var data []byte
+	for encoded := line[1:]; len(encoded) >= 5; encoded = encoded[5:] {
+		var acc uint32
+		for _, c := range []byte(encoded[:5]) {
+			acc = acc*85 + uint32(strings.IndexByte(base85Alphabet, c))
+		}
+		data = append(data, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+	}
+
+	if len(data) < n {
+		t.Fatalf("bad binary patch line %q", line)
+	}
+
+	return data[:n]
+}
+
+func TestGoGitBackend_SameOutputAsGit(t *testing.T) {
+	fixture, tmpDir, cleanup := prepareTestGitBackends(t)
+	defer cleanup()
+
+	// the same path matchers are used by git_repo for patches and archives
+	patchPathMatcher := path_matcher.NewGitMappingPathMatcher("", nil, nil, false)
+	archivePathMatcher := path_matcher.NewGitMappingPathMatcher("", nil, nil, true)
+
+	type backendOutput struct {
+		patch, archive string
+		paths          []string
+		binaryPaths    []string
+	}
+
+	run := func(backendName string, withSubmodules bool, opts PatchOptions) backendOutput {
+		var res backendOutput
+
+		workTreeCacheDir := filepath.Join(tmpDir, "work_tree_cache", backendName)
+
+		withTestBackend(backendName, func() {
+			patchBuf := bytes.NewBuffer(nil)
+
+			var desc *PatchDescriptor
+			var err error
+			if withSubmodules {
+				desc, err = PatchWithSubmodules(patchBuf, fixture.gitDir, workTreeCacheDir, opts)
+			} else {
+				desc, err = Patch(patchBuf, fixture.gitDir, opts)
+			}
+			if err != nil {
+				t.Fatalf("%s backend patch failed: %s", backendName, err)
+			}
+
+			res = backendOutput{
+				patch:       normalizeTestBinaryPatch(t, patchBuf.String()),
+				paths:       desc.Paths,
+				binaryPaths: desc.BinaryPaths,
+			}
+
+			// the archive of the commit with submodules is only available with submodules
+			if withSubmodules {
+				archiveBuf := bytes.NewBuffer(nil)
+				archiveOpts := ArchiveOptions{Commit: opts.ToCommit, PathMatcher: archivePathMatcher}
+				if _, err := ArchiveWithSubmodules(archiveBuf, fixture.gitDir, workTreeCacheDir, archiveOpts); err != nil {
+					t.Fatalf("%s backend archive failed: %s", backendName, err)
+				}
+
+				res.archive = normalizeTestArchive(t, archiveBuf.Bytes())
+			}
+		})
+
+		return res
+	}
+
+	for i := 1; i < len(fixture.commits); i++ {
+		for _, withSubmodules := range []bool{false, true} {
+			for _, withBinary := range []bool{false, true} {
+				name := fmt.Sprintf("commit %d (submodules: %v, binary: %v)", i, withSubmodules, withBinary)
+				opts := PatchOptions{
+					FromCommit:  fixture.commits[i-1],
+					ToCommit:    fixture.commits[i],
+					PathMatcher: patchPathMatcher,
+					WithBinary:  withBinary,
+				}
+
+				expected := run(GitBackend, withSubmodules, opts)
+				got := run(GoGitBackend, withSubmodules, opts)
+
+				if withSubmodules && (!strings.Contains(expected.patch, "b/modules/lib/lib.txt") || !strings.Contains(expected.archive, "modules/lib/lib.txt")) {
+					t.Fatalf("%s: unexpected fixture output:\n%s\n%s", name, expected.patch, expected.archive)
+				}
+
+				if got.patch != expected.patch {
+					t.Errorf("%s patch:\n[EXPECTED]:\n%s\n[GOT]:\n%s", name, expected.patch, got.patch)
+				}
+
+				if got.archive != expected.archive {
+					t.Errorf("%s archive:\n[EXPECTED]:\n%s\n[GOT]:\n%s", name, expected.archive, got.archive)
+				}
+
+				if fmt.Sprint(got.paths, got.binaryPaths) != fmt.Sprint(expected.paths, expected.binaryPaths) {
+					t.Errorf("%s paths:\n[EXPECTED]: %v %v\n[GOT]: %v %v", name, expected.paths, expected.binaryPaths, got.paths, got.binaryPaths)
+				}
+			}
+		}
+	}
+}
+
+func TestGetHashAbbreviator_InvalidatedByNewObjects(t *testing.T) {
+	fixture, _, cleanup := prepareTestGitBackends(t)
+	defer cleanup()
+
+	a := getHashAbbreviator(newGitStorage(fixture.gitDir))
+	if b := getHashAbbreviator(newGitStorage(fixture.gitDir)); b != a {
+		t.Errorf("expected the cached abbreviator of the unchanged repository")
+	}
+
+	writeTestFile(t, filepath.Join(fixture.dir, "new.txt"), []byte("new\n"), 0644)
+	runTestGit(t, fixture.dir, "add", "new.txt")
+
+	if b := getHashAbbreviator(newGitStorage(fixture.gitDir)); b == a {
+		t.Errorf("expected the new abbreviator after the object is added")
+	}
+}
@@ -0,0 +1,908 @@
+package true_git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage"
+
+	"github.com/flant/werf/pkg/path_matcher"
+	"github.com/flant/werf/pkg/true_git/xdiff"
+)
+
+const (
+	defaultDiffContext = 3
+	entireFileContext  = 999999999
+
+	// git treats blobs bigger than core.bigFileThreshold as binary without looking into the data
+	bigFileThreshold = 512 * 1024 * 1024
+	// git looks for NUL byte in the first 8000 bytes to decide whether the blob is binary
+	binaryCheckSize = 8000
+
+	fallbackAbbrevLen = 7
+	hashHexLen        = 40
+
+	modeTypeMask = 0170000
+)
+
+// emptyDeflatedData is the zlib stream git produces for the empty input with the default core.compression
+var emptyDeflatedData = []byte{0x78, 0x01, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+// goGitDiffRepo is a repository (the main one or a submodule) which trees are compared by goGitDiff
+type goGitDiffRepo struct {
+	storer storage.Storer
+	abbrev *hashAbbreviator
+
+	// prefixA and prefixB are `git diff` src and dst prefixes, submodule paths are included for submodules
+	prefixA, prefixB string
+	// pathPrefix is the path of the repository relative to the main repository
+	pathPrefix string
+
+	withBinary bool
+
+	// modules are submodules of the destination commit
+	modules *config.Modules
+}
+
+// goGitDiff generates the same output as `git diff --submodule=diff|log [--binary] FROM TO` does
+type goGitDiff struct {
+	out         io.Writer
+	pathMatcher path_matcher.PathMatcher
+
+	contextLines   int
+	withSubmodules bool
+}
+
+func writePatchWithGoGit(out io.Writer, gitDir, workTreeCacheDir string, withSubmodules bool, opts PatchOptions) (*PatchDescriptor, error) {
+	if withSubmodules {
+		// submodules commits are fetched into the repository modules storage while preparing the work tree
+		if _, err := prepareWorkTree(gitDir, workTreeCacheDir, opts.ToCommit, withSubmodules); err != nil {
+			return nil, fmt.Errorf("cannot prepare work tree in cache %s for commit %s: %s", workTreeCacheDir, opts.ToCommit, err)
+		}
+	}
+
+	if debugPatch() {
+		fmt.Printf("# go-git diff %s %s (submodules: %v, binary: %v)\n", opts.FromCommit, opts.ToCommit, withSubmodules, opts.WithBinary)
+		out = io.MultiWriter(out, os.Stdout)
+	}
+
+	p := makeDiffParser(out, opts.PathMatcher)
+
+	d := &goGitDiff{
+		out:            diffParserWriter{p},
+		pathMatcher:    opts.PathMatcher,
+		contextLines:   defaultDiffContext,
+		withSubmodules: withSubmodules,
+	}
+	if opts.WithEntireFileContext {
+		d.contextLines = entireFileContext
+	}
+
+	s := newGitStorage(gitDir)
+	r := &goGitDiffRepo{
+		storer:     s,
+		abbrev:     getHashAbbreviator(s),
+		prefixA:    "a/",
+		prefixB:    "b/",
+		withBinary: opts.WithBinary,
+	}
+
+	if err := d.diffCommits(r, plumbing.NewHash(opts.FromCommit), plumbing.NewHash(opts.ToCommit)); err != nil {
+		return nil, fmt.Errorf("diff %s %s failed: %s", opts.FromCommit, opts.ToCommit, err)
+	}
+
+	return newPatchDescriptor(p), nil
+}
+
+type diffParserWriter struct {
+	p *diffParser
+}
+
+func (w diffParserWriter) Write(data []byte) (int, error) {
+	if err := w.p.HandleStdout(data); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (d *goGitDiff) diffCommits(r *goGitDiffRepo, fromCommit, toCommit plumbing.Hash) error {
+	var fromTree *object.Tree
+	if !fromCommit.IsZero() {
+		commit, err := object.GetCommit(r.storer, fromCommit)
+		if err != nil {
+			return fmt.Errorf("cannot get commit %s: %s", fromCommit, err)
+		}
+
+		if fromTree, err = commit.Tree(); err != nil {
+			return fmt.Errorf("cannot get commit %s tree: %s", fromCommit, err)
+		}
+	}
+
+	commit, err := object.GetCommit(r.storer, toCommit)
+	if err != nil {
+		return fmt.Errorf("cannot get commit %s: %s", toCommit, err)
+	}
+
+	toTree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("cannot get commit %s tree: %s", toCommit, err)
+	}
+
+	if r.modules, err = commitModules(commit); err != nil {
+		return err
+	}
+
+	return d.diffTrees(r, "", fromTree, toTree)
+}
+
+func canonMode(mode filemode.FileMode) filemode.FileMode {
+	switch {
+	case mode == filemode.Deprecated:
+		return filemode.Regular
+	case mode&modeTypeMask == filemode.Regular&modeTypeMask && mode&0100 != 0:
+		return filemode.Executable
+	case mode&modeTypeMask == filemode.Regular&modeTypeMask:
+		return filemode.Regular
+	}
+
+	return mode
+}
+
+// entrySortName returns the name used by git to order tree entries: directories are compared as if they end with slash
+func entrySortName(entry *object.TreeEntry) string {
+	if entry.Mode == filemode.Dir {
+		return entry.Name + "/"
+	}
+
+	return entry.Name
+}
+
+func treeEntries(tree *object.Tree) []object.TreeEntry {
+	if tree == nil {
+		return nil
+	}
+
+	return tree.Entries
+}
+
+func (d *goGitDiff) diffTrees(r *goGitDiffRepo, dirPath string, treeA, treeB *object.Tree) error {
+	entriesA, entriesB := treeEntries(treeA), treeEntries(treeB)
+
+	for i, j := 0, 0; i < len(entriesA) || j < len(entriesB); {
+		var entryA, entryB *object.TreeEntry
+
+		switch {
+		case i == len(entriesA):
+			entryB = &entriesB[j]
+			j++
+		case j == len(entriesB):
+			entryA = &entriesA[i]
+			i++
+		default:
+			nameA, nameB := entrySortName(&entriesA[i]), entrySortName(&entriesB[j])
+			if nameA < nameB {
+				entryA = &entriesA[i]
+				i++
+			} else if nameA > nameB {
+				entryB = &entriesB[j]
+				j++
+			} else {
+				entryA, entryB = &entriesA[i], &entriesB[j]
+				i++
+				j++
+			}
+		}
+
+		if err := d.diffEntries(r, dirPath, entryA, entryB); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *goGitDiff) diffEntries(r *goGitDiffRepo, dirPath string, entryA, entryB *object.TreeEntry) error {
+	var name string
+	if entryA != nil {
+		name = entryA.Name
+	} else {
+		name = entryB.Name
+	}
+	entryPath := path.Join(dirPath, name)
+
+	if entryA != nil && entryB != nil {
+		modeA, modeB := canonMode(entryA.Mode), canonMode(entryB.Mode)
+
+		if entryA.Hash == entryB.Hash && modeA == modeB {
+			return nil
+		}
+
+		// a pair which changes the type of the file is split into deletion and creation
+		if modeA&modeTypeMask != modeB&modeTypeMask {
+			if err := d.diffEntries(r, dirPath, entryA, nil); err != nil {
+				return err
+			}
+
+			return d.diffEntries(r, dirPath, nil, entryB)
+		}
+	}
+
+	var mode filemode.FileMode
+	if entryA != nil {
+		mode = entryA.Mode
+	} else {
+		mode = entryB.Mode
+	}
+
+	switch mode {
+	case filemode.Dir:
+		isMatched, shouldWalkThrough := d.pathMatcher.ProcessDirOrSubmodulePath(r.pathPrefix + entryPath)
+		if !isMatched && !shouldWalkThrough {
+			return nil
+		}
+
+		treeA, err := entryTree(r.storer, entryA)
+		if err != nil {
+			return err
+		}
+
+		treeB, err := entryTree(r.storer, entryB)
+		if err != nil {
+			return err
+		}
+
+		return d.diffTrees(r, entryPath, treeA, treeB)
+	case filemode.Submodule:
+		return d.diffSubmodule(r, entryPath, entryA, entryB)
+	default:
+		if !d.pathMatcher.MatchPath(r.pathPrefix + entryPath) {
+			return nil
+		}
+
+		return d.diffFile(r, entryPath, entryA, entryB)
+	}
+}
+
+func entryTree(s storage.Storer, entry *object.TreeEntry) (*object.Tree, error) {
+	if entry == nil {
+		return nil, nil
+	}
+
+	tree, err := object.GetTree(s, entry.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get tree %s: %s", entry.Hash, err)
+	}
+
+	return tree, nil
+}
+
+func entryHash(entry *object.TreeEntry) plumbing.Hash {
+	if entry == nil {
+		return plumbing.ZeroHash
+	}
+
+	return entry.Hash
+}
+
+func (d *goGitDiff) diffSubmodule(r *goGitDiffRepo, submodulePath string, entryA, entryB *object.TreeEntry) error {
+	hashA, hashB := entryHash(entryA), entryHash(entryB)
+
+	var message string
+	if hashA.IsZero() {
+		message = "(new submodule)"
+	} else if hashB.IsZero() {
+		message = "(submodule deleted)"
+	}
+
+	// the submodule is available when it is checked out in the work tree of the destination commit
+	var moduleStorer storage.Storer
+	if d.withSubmodules && !hashB.IsZero() {
+		for _, submodule := range r.modules.Submodules {
+			if submodule.Path != submodulePath {
+				continue
+			}
+
+			s, err := r.storer.Module(submodule.Name)
+			if err != nil {
+				return fmt.Errorf("cannot open submodule %s storage: %s", submodule.Name, err)
+			}
+			moduleStorer = s
+
+			break
+		}
+	}
+
+	var hasCommitA, hasCommitB bool
+	separator := "..."
+	if moduleStorer == nil {
+		if message == "" {
+			message = "(commits not present)"
+		}
+	} else {
+		var err error
+		if hasCommitA, err = storerHasCommit(moduleStorer, hashA); err != nil {
+			return err
+		}
+		if hasCommitB, err = storerHasCommit(moduleStorer, hashB); err != nil {
+			return err
+		}
+
+		if (!hashA.IsZero() && !hasCommitA) || !hasCommitB {
+			message = "(commits not present)"
+		} else if hasCommitA {
+			if isAncestor, err := commitIsAncestor(moduleStorer, hashA, hashB); err != nil {
+				return err
+			} else if isAncestor {
+				separator = ".."
+			} else if isAncestor, err := commitIsAncestor(moduleStorer, hashB, hashA); err != nil {
+				return err
+			} else if isAncestor {
+				separator = ".."
+				message = "(rewind)"
+			}
+		}
+	}
+
+	abbrevA, err := r.abbrev.Abbrev(hashA, 0)
+	if err != nil {
+		return err
+	}
+
+	abbrevB, err := r.abbrev.Abbrev(hashB, 0)
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("Submodule %s %s%s%s", submodulePath, abbrevA, separator, abbrevB)
+	switch {
+	case message == "(rewind)":
+		header += " (rewind):"
+	case message != "":
+		header += " " + message
+	default:
+		header += ":"
+	}
+
+	if _, err := fmt.Fprintln(d.out, header); err != nil {
+		return err
+	}
+
+	if !d.withSubmodules || moduleStorer == nil || !(hasCommitA || hashA.IsZero()) || !hasCommitB {
+		return nil
+	}
+
+	isMatched, shouldWalkThrough := d.pathMatcher.ProcessDirOrSubmodulePath(r.pathPrefix + submodulePath)
+	if !isMatched && !shouldWalkThrough {
+		return nil
+	}
+
+	submoduleRepo := &goGitDiffRepo{
+		storer:     moduleStorer,
+		abbrev:     getHashAbbreviator(moduleStorer),
+		prefixA:    r.prefixA + submodulePath + "/",
+		prefixB:    r.prefixB + submodulePath + "/",
+		pathPrefix: r.pathPrefix + submodulePath + "/",
+	}
+
+	if err := d.diffCommits(submoduleRepo, hashA, hashB); err != nil {
+		return fmt.Errorf("submodule %s: %s", submodulePath, err)
+	}
+
+	return nil
+}
+
+func commitIsAncestor(s storage.Storer, ancestorHash, descendantHash plumbing.Hash) (bool, error) {
+	ancestor, err := object.GetCommit(s, ancestorHash)
+	if err != nil {
+		return false, fmt.Errorf("cannot get commit %s: %s", ancestorHash, err)
+	}
+
+	descendant, err := object.GetCommit(s, descendantHash)
+	if err != nil {
+		return false, fmt.Errorf("cannot get commit %s: %s", descendantHash, err)
+	}
+
+	return ancestor.IsAncestor(descendant)
+}
+
+type diffBlob struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+	data []byte
+
+	isBinary bool
+}
+
+func readDiffBlob(s storage.Storer, entry *object.TreeEntry) (*diffBlob, error) {
+	if entry == nil {
+		return nil, nil
+	}
+
+	blob, err := object.GetBlob(s, entry.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get blob %s: %s", entry.Hash, err)
+	}
+
+	data, err := blobContents(blob)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read blob %s: %s", entry.Hash, err)
+	}
+
+	checkData := data
+	if len(checkData) > binaryCheckSize {
+		checkData = checkData[:binaryCheckSize]
+	}
+
+	return &diffBlob{
+		hash:     entry.Hash,
+		mode:     canonMode(entry.Mode),
+		data:     data,
+		isBinary: blob.Size > bigFileThreshold || bytes.IndexByte(checkData, 0) != -1,
+	}, nil
+}
+
+func blobContents(blob *object.Blob) ([]byte, error) {
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func (d *goGitDiff) diffFile(r *goGitDiffRepo, filePath string, entryA, entryB *object.TreeEntry) error {
+	blobA, err := readDiffBlob(r.storer, entryA)
+	if err != nil {
+		return err
+	}
+
+	blobB, err := readDiffBlob(r.storer, entryB)
+	if err != nil {
+		return err
+	}
+
+	var hashA, hashB plumbing.Hash
+	var modeA, modeB filemode.FileMode
+	var dataA, dataB []byte
+	var isBinary bool
+	if blobA != nil {
+		hashA, modeA, dataA = blobA.hash, blobA.mode, blobA.data
+		isBinary = isBinary || blobA.isBinary
+	}
+	if blobB != nil {
+		hashB, modeB, dataB = blobB.hash, blobB.mode, blobB.data
+		isBinary = isBinary || blobB.isBinary
+	}
+
+	nameA, nameB := quoteTwo(r.prefixA, filePath), quoteTwo(r.prefixB, filePath)
+	labelA, labelB := nameA, nameB
+	if blobA == nil {
+		labelA = "/dev/null"
+	}
+	if blobB == nil {
+		labelB = "/dev/null"
+	}
+
+	header := &bytes.Buffer{}
+	fmt.Fprintf(header, "diff --git %s %s\n", nameA, nameB)
+
+	mustShowHeader := true
+	switch {
+	case blobA == nil:
+		fmt.Fprintf(header, "new file mode %06o\n", uint32(modeB))
+	case blobB == nil:
+		fmt.Fprintf(header, "deleted file mode %06o\n", uint32(modeA))
+	case modeA != modeB:
+		fmt.Fprintf(header, "old mode %06o\n", uint32(modeA))
+		fmt.Fprintf(header, "new mode %06o\n", uint32(modeB))
+	default:
+		mustShowHeader = false
+	}
+
+	if hashA != hashB {
+		abbrevLen := 0
+		if r.withBinary && isBinary {
+			abbrevLen = hashHexLen
+		}
+
+		abbrevA, err := r.abbrev.Abbrev(hashA, abbrevLen)
+		if err != nil {
+			return err
+		}
+
+		abbrevB, err := r.abbrev.Abbrev(hashB, abbrevLen)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(header, "index %s..%s", abbrevA, abbrevB)
+		if modeA == modeB {
+			fmt.Fprintf(header, " %06o", uint32(modeA))
+		}
+		header.WriteString("\n")
+	}
+
+	body := &bytes.Buffer{}
+	if isBinary {
+		if bytes.Equal(dataA, dataB) {
+			if !mustShowHeader {
+				return nil
+			}
+		} else if r.withBinary {
+			body.WriteString("GIT binary patch\n")
+			if err := writeBinaryLiteral(body, dataB); err != nil {
+				return err
+			}
+			if err := writeBinaryLiteral(body, dataA); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(body, "Binary files %s and %s differ\n", labelA, labelB)
+		}
+	} else if hunks := xdiff.Diff(dataA, dataB, d.contextLines); len(hunks) > 0 {
+		fmt.Fprintf(body, "--- %s%s\n", labelA, labelTab(labelA))
+		fmt.Fprintf(body, "+++ %s%s\n", labelB, labelTab(labelB))
+		body.Write(hunks)
+	}
+
+	if _, err := d.out.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	_, err = d.out.Write(body.Bytes())
+	return err
+}
+
+// labelTab returns the tab git appends to the file label containing spaces
+func labelTab(label string) string {
+	if strings.Contains(label, " ") {
+		return "\t"
+	}
+
+	return ""
+}
+
+// quoteTwo is a port of git quote_two with core.quotePath=false:
+// the prefix and the path are quoted as a single C-style string if any of them requires quoting
+func quoteTwo(prefix, filePath string) string {
+	s := prefix + filePath
+
+	mustQuote := false
+	for i := 0; i < len(s); i++ {
+		if cMustQuote(s[i]) {
+			mustQuote = true
+			break
+		}
+	}
+
+	if !mustQuote {
+		return s
+	}
+
+	res := &strings.Builder{}
+	res.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !cMustQuote(c) {
+			res.WriteByte(c)
+			continue
+		}
+
+		res.WriteByte('\\')
+		switch c {
+		case '\a':
+			res.WriteByte('a')
+		case '\b':
+			res.WriteByte('b')
+		case '\t':
+			res.WriteByte('t')
+		case '\n':
+			res.WriteByte('n')
+		case '\v':
+			res.WriteByte('v')
+		case '\f':
+			res.WriteByte('f')
+		case '\r':
+			res.WriteByte('r')
+		case '"', '\\':
+			res.WriteByte(c)
+		default:
+			fmt.Fprintf(res, "%03o", c)
+		}
+	}
+	res.WriteByte('"')
+
+	return res.String()
+}
+
+func cMustQuote(c byte) bool {
+	return c < 0x20 || c == '"' || c == '\\' || c == 0x7f
+}
+
+const base85Alphabet = "0123456789" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"abcdefghijklmnopqrstuvwxyz" +
+	"!#$%&()*+-;<=>?@^_`{|}~"
+
+// writeBinaryLiteral writes the literal part of git binary patch: deflated data encoded in base85 lines
+func writeBinaryLiteral(out *bytes.Buffer, data []byte) error {
+	deflated := emptyDeflatedData
+	if len(data) > 0 {
+		buf := &bytes.Buffer{}
+		zw, err := zlib.NewWriterLevel(buf, zlib.BestSpeed)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return fmt.Errorf("cannot deflate binary data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("cannot deflate binary data: %s", err)
+		}
+		deflated = buf.Bytes()
+	}
+
+	fmt.Fprintf(out, "literal %d\n", len(data))
+
+	for len(deflated) > 0 {
+		n := 52
+		if len(deflated) < n {
+			n = len(deflated)
+		}
+
+		if n <= 26 {
+			out.WriteByte(byte('A' + n - 1))
+		} else {
+			out.WriteByte(byte('a' + n - 27))
+		}
+		encodeBase85(out, deflated[:n])
+		out.WriteByte('\n')
+
+		deflated = deflated[n:]
+	}
+
+	out.WriteByte('\n')
+
+	return nil
+}
+
+func encodeBase85(out *bytes.Buffer, data []byte) {
+	for len(data) > 0 {
+		var acc uint32
+		for shift := 24; shift >= 0; shift -= 8 {
+			acc |= uint32(data[0]) << uint(shift)
+			data = data[1:]
+			if len(data) == 0 {
+				break
+			}
+		}
+
+		var group [5]byte
+		for i := 4; i >= 0; i-- {
+			group[i] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+		out.Write(group[:])
+	}
+}
+
+// hashAbbreviator abbreviates hashes the same way git does with the default core.abbrev:
+// the length depends on the number of packed objects and is extended until the abbreviation is unique
+type hashAbbreviator struct {
+	storer storage.Storer
+
+	// objectsStamp identifies the state of the objects directory the hashes are loaded for
+	objectsStamp string
+
+	loaded bool
+	minLen int
+	hashes []plumbing.Hash
+
+	mutex sync.Mutex
+}
+
+type objectsFilesystemStorer interface {
+	Filesystem() billy.Filesystem
+	ObjectPacks() ([]plumbing.Hash, error)
+	ForEachObjectHash(func(plumbing.Hash) error) error
+}
+
+// hashAbbreviators caches loaded object hashes by the repository directory,
+// so that the objects are not listed again for each patch and submodule until the objects directory is changed
+var hashAbbreviators = struct {
+	byRepoDir map[string]*hashAbbreviator
+	mutex     sync.Mutex
+}{byRepoDir: make(map[string]*hashAbbreviator)}
+
+func newHashAbbreviator(s storage.Storer) *hashAbbreviator {
+	return &hashAbbreviator{storer: s, minLen: fallbackAbbrevLen}
+}
+
+func getHashAbbreviator(s storage.Storer) *hashAbbreviator {
+	fsStorer, ok := s.(objectsFilesystemStorer)
+	if !ok {
+		return newHashAbbreviator(s)
+	}
+
+	stamp, err := objectsDirStamp(fsStorer.Filesystem())
+	if err != nil {
+		return newHashAbbreviator(s)
+	}
+
+	repoDir := fsStorer.Filesystem().Root()
+
+	hashAbbreviators.mutex.Lock()
+	defer hashAbbreviators.mutex.Unlock()
+
+	if a, exists := hashAbbreviators.byRepoDir[repoDir]; exists && a.objectsStamp == stamp {
+		return a
+	}
+
+	a := newHashAbbreviator(s)
+	a.objectsStamp = stamp
+	hashAbbreviators.byRepoDir[repoDir] = a
+
+	return a
+}
+
+// objectsDirStamp is changed when a pack or a loose object is added to or removed from the objects directory:
+// the modification time of the directory is changed when the directory entry is added or removed
+func objectsDirStamp(fs billy.Filesystem) (string, error) {
+	infos, err := fs.ReadDir("objects")
+	if err != nil {
+		return "", err
+	}
+
+	stamp := &strings.Builder{}
+	for _, info := range infos {
+		if info.IsDir() {
+			fmt.Fprintf(stamp, "%s:%d\n", info.Name(), info.ModTime().UnixNano())
+		}
+	}
+
+	return stamp.String(), nil
+}
+
+func (a *hashAbbreviator) load() error {
+	a.loaded = true
+
+	s, ok := a.storer.(objectsFilesystemStorer)
+	if !ok {
+		return nil
+	}
+
+	packs, err := s.ObjectPacks()
+	if err != nil {
+		return fmt.Errorf("cannot get object packs: %s", err)
+	}
+
+	var packedCount int64
+	for _, pack := range packs {
+		idxPath := s.Filesystem().Join("objects", "pack", fmt.Sprintf("pack-%s.idx", pack))
+
+		f, err := s.Filesystem().Open(idxPath)
+		if err != nil {
+			return fmt.Errorf("cannot open %s: %s", idxPath, err)
+		}
+
+		idx := idxfile.NewMemoryIndex()
+		err = idxfile.NewDecoder(f).Decode(idx)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("cannot decode %s: %s", idxPath, err)
+		}
+
+		count, err := idx.Count()
+		if err != nil {
+			return err
+		}
+		packedCount += count
+
+		entries, err := idx.Entries()
+		if err != nil {
+			return err
+		}
+
+		for {
+			entry, err := entries.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				entries.Close()
+				return err
+			}
+
+			a.hashes = append(a.hashes, entry.Hash)
+		}
+		entries.Close()
+	}
+
+	if err := s.ForEachObjectHash(func(hash plumbing.Hash) error {
+		a.hashes = append(a.hashes, hash)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cannot list loose objects: %s", err)
+	}
+
+	sort.Slice(a.hashes, func(i, j int) bool {
+		return bytes.Compare(a.hashes[i][:], a.hashes[j][:]) < 0
+	})
+
+	if l := (bits.Len64(uint64(packedCount)) + 1) / 2; l > a.minLen {
+		a.minLen = l
+	}
+
+	return nil
+}
+
+// Abbrev returns the abbreviated hash, the length is chosen automatically when abbrevLen is 0
+func (a *hashAbbreviator) Abbrev(hash plumbing.Hash, abbrevLen int) (string, error) {
+	hex := hash.String()
+	if abbrevLen == hashHexLen {
+		return hex, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !a.loaded {
+		if err := a.load(); err != nil {
+			return "", err
+		}
+	}
+
+	l := a.minLen
+
+	pos := sort.Search(len(a.hashes), func(i int) bool {
+		return bytes.Compare(a.hashes[i][:], hash[:]) >= 0
+	})
+
+	var neighbours []plumbing.Hash
+	if pos > 0 {
+		neighbours = append(neighbours, a.hashes[pos-1])
+	}
+	for i := pos; i < len(a.hashes); i++ {
+		if a.hashes[i] != hash {
+			neighbours = append(neighbours, a.hashes[i])
+			break
+		}
+	}
+
+	for _, neighbour := range neighbours {
+		if common := commonHexPrefixLen(hex, neighbour.String()); common+1 > l {
+			l = common + 1
+		}
+	}
+
+	if l > hashHexLen {
+		l = hashHexLen
+	}
+
+	return hex[:l], nil
+}
+
+func commonHexPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
@@ -0,0 +1,267 @@
+package true_git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// commitStorer is a view of the repository storage at the commit:
+// HEAD points to the commit, the index and the submodules configuration are taken from the commit tree.
+// The repository opened with the storer looks like the repository checked out at the commit,
+// but neither HEAD nor the index of the real repository are changed.
+type commitStorer struct {
+	storage.Storer
+
+	commit  *object.Commit
+	modules *config.Modules
+
+	// gitlinks are commits of submodules from .gitmodules by submodule name
+	gitlinks map[string]plumbing.Hash
+	// initializedSubmodules are submodules which commits are available in the modules storage
+	initializedSubmodules map[string]*config.Submodule
+}
+
+func newGitStorage(gitDir string) *filesystem.Storage {
+	return filesystem.NewStorage(osfs.New(gitDir), cache.NewObjectLRUDefault())
+}
+
+func newCommitStorer(s storage.Storer, commitHash plumbing.Hash) (*commitStorer, error) {
+	commit, err := object.GetCommit(s, commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get commit %s: %s", commitHash, err)
+	}
+
+	modules, err := commitModules(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &commitStorer{
+		Storer:                s,
+		commit:                commit,
+		modules:               modules,
+		gitlinks:              map[string]plumbing.Hash{},
+		initializedSubmodules: map[string]*config.Submodule{},
+	}
+
+	for name, submodule := range modules.Submodules {
+		hash, exists, err := submoduleCommit(commit, submodule.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			continue
+		}
+
+		cs.gitlinks[name] = hash
+
+		moduleStorer, err := s.Module(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasCommit, err := storerHasCommit(moduleStorer, hash); err != nil {
+			return nil, err
+		} else if hasCommit {
+			submoduleCopy := *submodule
+			cs.initializedSubmodules[name] = &submoduleCopy
+		}
+	}
+
+	return cs, nil
+}
+
+func storerHasCommit(s storage.Storer, hash plumbing.Hash) (bool, error) {
+	if _, err := s.EncodedObject(plumbing.CommitObject, hash); err == plumbing.ErrObjectNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("cannot get commit %s: %s", hash, err)
+	}
+
+	return true, nil
+}
+
+// commitModules returns submodules described in the .gitmodules file of the commit
+func commitModules(commit *object.Commit) (*config.Modules, error) {
+	modules := config.NewModules()
+
+	file, err := commit.File(".gitmodules")
+	if err == object.ErrFileNotFound {
+		return modules, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get .gitmodules of commit %s: %s", commit.Hash, err)
+	}
+
+	data, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read .gitmodules of commit %s: %s", commit.Hash, err)
+	}
+
+	if err := modules.Unmarshal([]byte(data)); err != nil {
+		return nil, fmt.Errorf("cannot parse .gitmodules of commit %s: %s", commit.Hash, err)
+	}
+
+	return modules, nil
+}
+
+// submoduleCommit returns the commit hash the submodule gitlink of the commit tree points to
+func submoduleCommit(commit *object.Commit, submodulePath string) (plumbing.Hash, bool, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+
+	entry, err := tree.FindEntry(submodulePath)
+	if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+		return plumbing.ZeroHash, false, nil
+	} else if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+
+	if entry.Mode != filemode.Submodule {
+		return plumbing.ZeroHash, false, nil
+	}
+
+	return entry.Hash, true, nil
+}
+
+func (s *commitStorer) Reference(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	if name == plumbing.HEAD {
+		return plumbing.NewHashReference(plumbing.HEAD, s.commit.Hash), nil
+	}
+
+	return s.Storer.Reference(name)
+}
+
+func (s *commitStorer) Index() (*index.Index, error) {
+	idx := &index.Index{Version: 2}
+
+	for name, hash := range s.gitlinks {
+		idx.Entries = append(idx.Entries, &index.Entry{
+			Hash: hash,
+			Name: s.modules.Submodules[name].Path,
+			Mode: filemode.Submodule,
+		})
+	}
+
+	return idx, nil
+}
+
+func (s *commitStorer) Config() (*config.Config, error) {
+	cfg, err := s.Storer.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Submodules = map[string]*config.Submodule{}
+	for name, submodule := range s.initializedSubmodules {
+		submoduleCopy := *submodule
+		cfg.Submodules[name] = &submoduleCopy
+	}
+
+	return cfg, nil
+}
+
+func (s *commitStorer) Module(name string) (storage.Storer, error) {
+	hash, ok := s.gitlinks[name]
+	if !ok {
+		return nil, fmt.Errorf("submodule %s not found in commit %s", name, s.commit.Hash)
+	}
+
+	moduleStorer, err := s.Storer.Module(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCommitStorer(moduleStorer, hash)
+}
+
+func openRepositoryAtCommitWithGoGit(gitDir, workTreeDir, commit string) (*git.Repository, error) {
+	storer, err := newCommitStorer(newGitStorage(gitDir), plumbing.NewHash(commit))
+	if err != nil {
+		return nil, err
+	}
+
+	return git.Open(storer, osfs.New(workTreeDir))
+}
+
+// OpenWorkTreeRepository opens the repository with the work tree prepared for the commit by WithWorkTree
+func OpenWorkTreeRepository(gitDir, workTreeDir, commit string) (*git.Repository, error) {
+	if backend == GoGitBackend {
+		return openRepositoryAtCommitWithGoGit(gitDir, workTreeDir, commit)
+	}
+
+	return gitOpenWithCustomWorktreeDir(gitDir, workTreeDir)
+}
+
+func getRealRepoDirWithGoGit(repoDir string) (string, error) {
+	info, err := os.Stat(repoDir)
+	if err != nil {
+		return "", fmt.Errorf("cannot access %s: %s", repoDir, err)
+	}
+
+	if info.IsDir() {
+		return repoDir, nil
+	}
+
+	// .git file of a work tree or a submodule contains the path to the real git dir
+	data, err := ioutil.ReadFile(repoDir)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %s", repoDir, err)
+	}
+
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return "", fmt.Errorf("bad git file %s: expected gitdir: <path>", repoDir)
+	}
+
+	gitDir := filepath.FromSlash(strings.TrimPrefix(line, "gitdir: "))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(repoDir), gitDir)
+	}
+
+	return gitDir, nil
+}
+
+func isAncestorWithGoGit(ancestorCommit, descendantCommit string, gitDir string) (bool, error) {
+	repository, err := git.Open(newGitStorage(gitDir), nil)
+	if err != nil {
+		return false, fmt.Errorf("cannot open repo %s: %s", gitDir, err)
+	}
+
+	var commits []*object.Commit
+	for _, rev := range []string{ancestorCommit, descendantCommit} {
+		hash, err := repository.ResolveRevision(plumbing.Revision(rev))
+		if err == plumbing.ErrReferenceNotFound || err == plumbing.ErrObjectNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("cannot resolve revision %s: %s", rev, err)
+		}
+
+		commit, err := repository.CommitObject(*hash)
+		if err == plumbing.ErrObjectNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("cannot get commit %s: %s", hash, err)
+		}
+
+		commits = append(commits, commit)
+	}
+
+	return commits[0].IsAncestor(commits[1])
+}
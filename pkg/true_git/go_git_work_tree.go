@@ -0,0 +1,276 @@
+package true_git
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage"
+
+	"github.com/flant/logboek"
+)
+
+func switchWorkTreeWithGoGit(repoDir, workTreeDir string, commit string, withSubmodules bool) error {
+	if err := os.RemoveAll(workTreeDir); err != nil {
+		return fmt.Errorf("unable to remove work tree dir %s: %s", workTreeDir, err)
+	}
+
+	if err := os.MkdirAll(workTreeDir, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create work tree dir %s: %s", workTreeDir, err)
+	}
+
+	s := newGitStorage(repoDir)
+
+	originUrl, err := storerOriginUrl(s)
+	if err != nil {
+		return err
+	}
+
+	return checkoutCommitWithGoGit(s, plumbing.NewHash(commit), workTreeDir, withSubmodules, originUrl)
+}
+
+func checkoutCommitWithGoGit(s storage.Storer, commitHash plumbing.Hash, workTreeDir string, withSubmodules bool, originUrl string) error {
+	commit, err := object.GetCommit(s, commitHash)
+	if err != nil {
+		return fmt.Errorf("cannot get commit %s: %s", commitHash, err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("cannot get commit %s tree: %s", commitHash, err)
+	}
+
+	modules, err := commitModules(commit)
+	if err != nil {
+		return err
+	}
+
+	submodulesByPath := map[string]*config.Submodule{}
+	for _, submodule := range modules.Submodules {
+		submodulesByPath[submodule.Path] = submodule
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("cannot walk commit %s tree: %s", commitHash, err)
+		}
+
+		path := filepath.Join(workTreeDir, filepath.FromSlash(name))
+
+		switch entry.Mode {
+		case filemode.Dir:
+			if err := os.MkdirAll(path, os.ModePerm); err != nil {
+				return fmt.Errorf("unable to create dir %s: %s", path, err)
+			}
+		case filemode.Regular, filemode.Deprecated, filemode.Executable:
+			if err := checkoutBlobWithGoGit(s, entry, path); err != nil {
+				return err
+			}
+		case filemode.Symlink:
+			blob, err := object.GetBlob(s, entry.Hash)
+			if err != nil {
+				return fmt.Errorf("cannot get blob %s: %s", entry.Hash, err)
+			}
+
+			target, err := blobContents(blob)
+			if err != nil {
+				return fmt.Errorf("cannot read blob %s: %s", entry.Hash, err)
+			}
+
+			if err := os.Symlink(string(target), path); err != nil {
+				return fmt.Errorf("unable to create symlink %s: %s", path, err)
+			}
+		case filemode.Submodule:
+			if err := os.MkdirAll(path, os.ModePerm); err != nil {
+				return fmt.Errorf("unable to create dir %s: %s", path, err)
+			}
+
+			submodule, ok := submodulesByPath[name]
+			if !withSubmodules || !ok {
+				continue
+			}
+
+			moduleStorer, err := s.Module(submodule.Name)
+			if err != nil {
+				return fmt.Errorf("cannot open submodule %s storage: %s", submodule.Name, err)
+			}
+
+			if err := ensureSubmoduleCommitWithGoGit(moduleStorer, submodule, entry.Hash, originUrl); err != nil {
+				return err
+			}
+
+			submoduleOriginUrl, err := storerOriginUrl(moduleStorer)
+			if err != nil {
+				return err
+			}
+
+			if err := checkoutCommitWithGoGit(moduleStorer, entry.Hash, path, withSubmodules, submoduleOriginUrl); err != nil {
+				return fmt.Errorf("cannot checkout submodule %s: %s", submodule.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkoutBlobWithGoGit(s storage.Storer, entry object.TreeEntry, path string) error {
+	perm := os.FileMode(0666)
+	if entry.Mode == filemode.Executable {
+		perm = 0777
+	}
+
+	blob, err := object.GetBlob(s, entry.Hash)
+	if err != nil {
+		return fmt.Errorf("cannot get blob %s: %s", entry.Hash, err)
+	}
+
+	reader, err := blob.Reader()
+	if err != nil {
+		return fmt.Errorf("cannot read blob %s: %s", entry.Hash, err)
+	}
+	defer reader.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("unable to create file %s: %s", path, err)
+	}
+
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write file %s: %s", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+func storerOriginUrl(s storage.Storer) (string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return "", fmt.Errorf("cannot get repository config: %s", err)
+	}
+
+	if remote, ok := cfg.Remotes[git.DefaultRemoteName]; ok && len(remote.URLs) > 0 {
+		return remote.URLs[0], nil
+	}
+
+	return "", nil
+}
+
+// ensureSubmoduleCommitWithGoGit fetches the submodule into its modules storage the same way `git submodule update` does,
+// if the storage does not contain the commit yet
+func ensureSubmoduleCommitWithGoGit(s storage.Storer, submodule *config.Submodule, commitHash plumbing.Hash, parentOriginUrl string) error {
+	if hasCommit, err := storerHasCommit(s, commitHash); err != nil {
+		return err
+	} else if hasCommit {
+		return nil
+	}
+
+	url, err := resolveSubmoduleUrl(parentOriginUrl, submodule.URL)
+	if err != nil {
+		return fmt.Errorf("cannot resolve submodule %s url: %s", submodule.Name, err)
+	}
+
+	logProcessMsg := fmt.Sprintf("Fetch submodule %s from %s", submodule.Name, url)
+	return logboek.Info.LogProcess(logProcessMsg, logboek.LevelLogProcessOptions{}, func() error {
+		repository, err := git.Open(s, nil)
+		if err == git.ErrRepositoryNotExists {
+			repository, err = git.Init(s, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot open submodule %s repository: %s", submodule.Name, err)
+		}
+
+		if remote, err := repository.Remote(git.DefaultRemoteName); err == nil {
+			if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != url {
+				if err := repository.DeleteRemote(git.DefaultRemoteName); err != nil {
+					return fmt.Errorf("cannot delete submodule %s remote: %s", submodule.Name, err)
+				}
+			}
+		} else if err != git.ErrRemoteNotFound {
+			return fmt.Errorf("cannot get submodule %s remote: %s", submodule.Name, err)
+		}
+
+		if _, err := repository.Remote(git.DefaultRemoteName); err == git.ErrRemoteNotFound {
+			if _, err := repository.CreateRemote(&config.RemoteConfig{
+				Name: git.DefaultRemoteName,
+				URLs: []string{url},
+			}); err != nil {
+				return fmt.Errorf("cannot create submodule %s remote: %s", submodule.Name, err)
+			}
+		}
+
+		err = repository.Fetch(&git.FetchOptions{
+			RemoteName: git.DefaultRemoteName,
+			RefSpecs:   []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+			Tags:       git.AllTags,
+			Force:      true,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("cannot fetch submodule %s: %s", submodule.Name, err)
+		}
+
+		if hasCommit, err := storerHasCommit(s, commitHash); err != nil {
+			return err
+		} else if !hasCommit {
+			return fmt.Errorf("commit %s of submodule %s not found in %s", commitHash, submodule.Name, url)
+		}
+
+		return nil
+	})
+}
+
+// resolveSubmoduleUrl resolves the submodule url relative to the superproject origin url like git does for ./ and ../ urls
+func resolveSubmoduleUrl(parentUrl, url string) (string, error) {
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url, nil
+	}
+
+	if parentUrl == "" {
+		return "", fmt.Errorf("relative url %s requires the superproject origin remote", url)
+	}
+
+	base := strings.TrimSuffix(parentUrl, "/")
+	for {
+		if strings.HasPrefix(url, "./") {
+			url = url[2:]
+		} else if strings.HasPrefix(url, "../") {
+			url = url[3:]
+
+			ind := strings.LastIndexAny(base, "/:")
+			if ind == -1 {
+				return "", fmt.Errorf("cannot strip one component off url %s", base)
+			}
+
+			if base[ind] == ':' {
+				base = base[:ind+1]
+			} else {
+				base = base[:ind]
+			}
+		} else {
+			break
+		}
+	}
+
+	if strings.HasSuffix(base, ":") {
+		return base + url, nil
+	}
+
+	return base + "/" + url, nil
+}
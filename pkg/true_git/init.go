@@ -12,6 +12,11 @@ import (
 	"github.com/Masterminds/semver"
 )
 
+const (
+	GitBackend   = "git"
+	GoGitBackend = "go-git"
+)
+
 const (
 	MinGitVersionConstraintValue               = "1.9"
 	MinGitVersionWithSubmodulesConstraintValue = "2.14"
@@ -30,6 +35,8 @@ var (
 
 	outStream, errStream io.Writer
 	liveGitOutput        bool
+
+	backend string
 )
 
 type Options struct {
@@ -48,6 +55,18 @@ func Init(opts Options) error {
 		errStream = opts.Err
 	}
 
+	backend = os.Getenv("WERF_GIT_BACKEND")
+	switch backend {
+	case "":
+		backend = GitBackend
+	case GitBackend:
+	case GoGitBackend:
+		// go-git backend does not use git binary, so there are no version constraints
+		return nil
+	default:
+		return fmt.Errorf("bad WERF_GIT_BACKEND value %q: expected %s or %s", backend, GitBackend, GoGitBackend)
+	}
+
 	var err error
 
 	v, err := getGitCliVersion()
@@ -145,6 +164,10 @@ func checkVersionConstraints() error {
 }
 
 func checkSubmoduleConstraint() error {
+	if backend == GoGitBackend {
+		return nil
+	}
+
 	constraint, err := semver.NewConstraint(fmt.Sprintf(">= %s", MinGitVersionWithSubmodulesConstraintValue))
 	if err != nil {
 		panic(err)
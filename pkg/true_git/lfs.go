@@ -0,0 +1,8 @@
+package true_git
+
+const (
+	// LFSPointerVersion is the first line of Git LFS pointer files
+	LFSPointerVersion    = "version https://git-lfs.github.com/spec/v1"
+	LFSPointerOidPrefix  = "oid sha256:"
+	LFSPointerSizePrefix = "size "
+)
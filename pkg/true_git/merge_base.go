@@ -7,6 +7,10 @@ import (
 )
 
 func IsAncestor(ancestorCommit, descendantCommit string, gitDir string) (bool, error) {
+	if backend == GoGitBackend {
+		return isAncestorWithGoGit(ancestorCommit, descendantCommit, gitDir)
+	}
+
 	gitArgs := []string{"--git-dir", gitDir, "merge-base", "--is-ancestor", ancestorCommit, descendantCommit}
 	cmd := exec.Command("git", gitArgs...)
 
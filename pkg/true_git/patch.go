@@ -23,6 +23,11 @@ type PatchOptions struct {
 type PatchDescriptor struct {
 	Paths       []string
 	BinaryPaths []string
+	// LFSPaths are paths of Git LFS pointer files, LFSOids are oids of objects the pointers point to in the ToCommit
+	LFSPaths []string
+	LFSOids  []string
+	// LFSObjectsSize is the total size of the objects
+	LFSObjectsSize int64
 }
 
 func PatchWithSubmodules(out io.Writer, gitDir, workTreeCacheDir string, opts PatchOptions) (*PatchDescriptor, error) {
@@ -68,6 +73,10 @@ func writePatch(out io.Writer, gitDir, workTreeCacheDir string, withSubmodules b
 		return nil, fmt.Errorf("provide work tree cache directory to enable submodules!")
 	}
 
+	if backend == GoGitBackend {
+		return writePatchWithGoGit(out, gitDir, workTreeCacheDir, withSubmodules, opts)
+	}
+
 	commonGitOpts := []string{
 		"--git-dir", gitDir,
 		"-c", "diff.renames=false",
@@ -207,9 +216,16 @@ WaitForData:
 		return nil, fmt.Errorf("git diff error: %s\nunrecognized output:\n%s", err, p.UnrecognizedCapture.String())
 	}
 
+	return newPatchDescriptor(p), nil
+}
+
+func newPatchDescriptor(p *diffParser) *PatchDescriptor {
 	desc := &PatchDescriptor{
-		Paths:       p.Paths,
-		BinaryPaths: p.BinaryPaths,
+		Paths:          p.Paths,
+		BinaryPaths:    p.BinaryPaths,
+		LFSPaths:       p.LFSPaths,
+		LFSOids:        p.LFSOids,
+		LFSObjectsSize: p.LFSObjectsSize,
 	}
 
 	if debugPatch() {
@@ -220,9 +236,12 @@ WaitForData:
 		for _, path := range desc.BinaryPaths {
 			fmt.Printf("Binary patch path %s\n", path)
 		}
+		for _, path := range desc.LFSPaths {
+			fmt.Printf("LFS pointer patch path %s\n", path)
+		}
 	}
 
-	return desc, nil
+	return desc
 }
 
 func consumePipeOutput(pipe io.ReadCloser, handleChunk func(data []byte) error) error {
@@ -12,6 +12,8 @@ import (
 
 	"github.com/flant/logboek"
 	"github.com/flant/shluz"
+
+	"github.com/flant/werf/pkg/werf"
 )
 
 type WithWorkTreeOptions struct {
@@ -50,7 +52,7 @@ func WithWorkTree(gitDir, workTreeCacheDir string, commit string, opts WithWorkT
 
 func withWorkTreeCacheLock(workTreeCacheDir string, f func() error) error {
 	lockName := fmt.Sprintf("git_work_tree_cache %s", workTreeCacheDir)
-	return shluz.WithLock(lockName, shluz.LockOptions{Timeout: 600 * time.Second}, f)
+	return werf.WithHostLock(lockName, shluz.LockOptions{Timeout: 600 * time.Second}, f)
 }
 
 func checkIsWorkTreeValid(repoDir, workTreeDir, repoToCacheLinkFilePath string) (bool, error) {
@@ -144,6 +146,10 @@ func prepareWorkTree(repoDir, workTreeCacheDir string, commit string, withSubmod
 		if currentCommit != "" {
 			logboek.Info.LogFDetails("Current commit: %s\n", currentCommit)
 		}
+
+		if backend == GoGitBackend {
+			return switchWorkTreeWithGoGit(repoDir, workTreeDir, commit, withSubmodules)
+		}
 		return switchWorkTree(repoDir, workTreeDir, commit, withSubmodules)
 	}); err != nil {
 		return "", fmt.Errorf("unable to switch work tree %s to commit %s: %s", workTreeDir, commit, err)
@@ -249,6 +255,10 @@ func switchWorkTree(repoDir, workTreeDir string, commit string, withSubmodules b
 }
 
 func GetRealRepoDir(repoDir string) (string, error) {
+	if backend == GoGitBackend {
+		return getRealRepoDirWithGoGit(repoDir)
+	}
+
 	gitArgs := []string{"--git-dir", repoDir, "rev-parse", "--git-dir"}
 
 	cmd := exec.Command("git", gitArgs...)
@@ -0,0 +1,333 @@
+package xdiff
+
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+	indentHeuristicMaxSliding       = 100
+)
+
+// group is a range of changed records [start, end), the group is empty when start == end
+type group struct {
+	start, end int
+}
+
+func groupInit(f *xdfile) group {
+	g := group{}
+	for f.isChanged(g.end) {
+		g.end++
+	}
+	return g
+}
+
+func groupNext(f *xdfile, g *group) bool {
+	if g.end == f.nrec {
+		return false
+	}
+
+	g.start = g.end + 1
+	for g.end = g.start; f.isChanged(g.end); g.end++ {
+	}
+
+	return true
+}
+
+func groupPrevious(f *xdfile, g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+
+	g.end = g.start - 1
+	for g.start = g.end; f.isChanged(g.start - 1); g.start-- {
+	}
+
+	return true
+}
+
+func groupSlideDown(f *xdfile, g *group) bool {
+	if g.end < f.nrec && f.ha[g.start] == f.ha[g.end] {
+		f.setChanged(g.start, false)
+		g.start++
+		f.setChanged(g.end, true)
+		g.end++
+
+		for f.isChanged(g.end) {
+			g.end++
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func groupSlideUp(f *xdfile, g *group) bool {
+	if g.start > 0 && f.ha[g.start-1] == f.ha[g.end-1] {
+		g.start--
+		f.setChanged(g.start, true)
+		g.end--
+		f.setChanged(g.end, false)
+
+		for f.isChanged(g.start - 1) {
+			g.start--
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func groupSyncBroken() {
+	panic("xdiff: group sync broken")
+}
+
+// changeCompact is a port of xdl_change_compact: groups of changes are slid to merge them with adjacent groups,
+// to align them with changes of the other file or, at last, to the position chosen by the indent heuristic
+func changeCompact(f, fo *xdfile) {
+	g := groupInit(f)
+	og := groupInit(fo)
+
+	for {
+		if g.end != g.start {
+			var earliestEnd, endMatchingOther, groupSize int
+
+			// Shift the change up and then down as far as possible, if it bumps into any other changes, merge them
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+
+				for groupSlideUp(f, &g) {
+					if !groupPrevious(fo, &og) {
+						groupSyncBroken()
+					}
+				}
+
+				earliestEnd = g.end
+
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+
+				for groupSlideDown(f, &g) {
+					if !groupNext(fo, &og) {
+						groupSyncBroken()
+					}
+
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			if g.end == earliestEnd {
+				// no shifting was possible
+			} else if endMatchingOther != -1 {
+				// Move the possibly merged group of changes back to line up with the last group of changes from the other file
+				for og.end == og.start {
+					if !groupSlideUp(f, &g) || !groupPrevious(fo, &og) {
+						groupSyncBroken()
+					}
+				}
+			} else {
+				shift := earliestEnd
+				if g.end-groupSize-1 > shift {
+					shift = g.end - groupSize - 1
+				}
+				if g.end-indentHeuristicMaxSliding > shift {
+					shift = g.end - indentHeuristicMaxSliding
+				}
+
+				bestShift := -1
+				var bestScore splitScore
+
+				for ; shift <= g.end; shift++ {
+					score := splitScore{}
+					score.add(measureSplit(f, shift))
+					score.add(measureSplit(f, shift-groupSize))
+
+					if bestShift == -1 || score.cmp(bestScore) <= 0 {
+						bestScore = score
+						bestShift = shift
+					}
+				}
+
+				for g.end > bestShift {
+					if !groupSlideUp(f, &g) || !groupPrevious(fo, &og) {
+						groupSyncBroken()
+					}
+				}
+			}
+		}
+
+		if !groupNext(f, &g) {
+			break
+		}
+		if !groupNext(fo, &og) {
+			groupSyncBroken()
+		}
+	}
+
+	if groupNext(fo, &og) {
+		groupSyncBroken()
+	}
+}
+
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// getIndent returns the indent of the record or -1 if the record contains only whitespaces
+func getIndent(rec []byte) int {
+	ret := 0
+	for _, c := range rec {
+		if !isSpace(c) {
+			return ret
+		} else if c == ' ' {
+			ret++
+		} else if c == '\t' {
+			ret += 8 - ret%8
+		}
+
+		if ret >= maxIndent {
+			return maxIndent
+		}
+	}
+
+	return -1
+}
+
+func measureSplit(f *xdfile, split int) splitMeasurement {
+	m := splitMeasurement{}
+
+	if split >= f.nrec {
+		m.endOfFile = true
+		m.indent = -1
+	} else {
+		m.indent = getIndent(f.recs[split])
+	}
+
+	m.preIndent = -1
+	for i := split - 1; i >= 0; i-- {
+		m.preIndent = getIndent(f.recs[i])
+		if m.preIndent != -1 {
+			break
+		}
+
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	m.postIndent = -1
+	for i := split + 1; i < f.nrec; i++ {
+		m.postIndent = getIndent(f.recs[i])
+		if m.postIndent != -1 {
+			break
+		}
+
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+
+	return m
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+
+	anyBlanks := totalBlank != 0
+
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1:
+	case m.preIndent == -1:
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case indent == m.preIndent:
+	default:
+		if m.postIndent != -1 && m.postIndent > indent {
+			if anyBlanks {
+				s.penalty += relativeOutdentWithBlankPenalty
+			} else {
+				s.penalty += relativeOutdentPenalty
+			}
+		} else {
+			if anyBlanks {
+				s.penalty += relativeDedentWithBlankPenalty
+			} else {
+				s.penalty += relativeDedentPenalty
+			}
+		}
+	}
+}
+
+func (s splitScore) cmp(other splitScore) int {
+	cmpIndents := 0
+	if s.effectiveIndent > other.effectiveIndent {
+		cmpIndents = 1
+	} else if s.effectiveIndent < other.effectiveIndent {
+		cmpIndents = -1
+	}
+
+	return indentWeight*cmpIndents + (s.penalty - other.penalty)
+}
@@ -0,0 +1,271 @@
+package xdiff
+
+import "math"
+
+const (
+	maxCostMin  = 256
+	heurMinCost = 256
+	snakeCnt    = 20
+	kHeur       = 4
+	lineMax     = math.MaxInt64
+)
+
+type algoEnv struct {
+	mxcost   int
+	snakeCnt int
+	heurMin  int
+}
+
+// kvector is a vector indexed by a diagonal number which can be negative
+type kvector struct {
+	data   []int
+	offset int
+}
+
+func (v kvector) get(d int) int {
+	return v.data[d+v.offset]
+}
+
+func (v kvector) set(d, value int) {
+	v.data[d+v.offset] = value
+}
+
+// doDiff is a port of xdl_do_diff: the Myers algorithm with the xdiff heuristics marks changed records of both files
+func doDiff(f1, f2 *xdfile) {
+	ndiags := f1.nreff + f2.nreff + 3
+	kvd := make([]int, 2*ndiags+2)
+
+	kvdf := kvector{data: kvd, offset: f2.nreff + 1}
+	kvdb := kvector{data: kvd, offset: ndiags + f2.nreff + 1}
+
+	env := algoEnv{
+		mxcost:   bogoSqrt(ndiags),
+		snakeCnt: snakeCnt,
+		heurMin:  heurMinCost,
+	}
+	if env.mxcost < maxCostMin {
+		env.mxcost = maxCostMin
+	}
+
+	recsCmp(f1, 0, f1.nreff, f2, 0, f2.nreff, kvdf, kvdb, false, env)
+}
+
+func recsCmp(f1 *xdfile, off1, lim1 int, f2 *xdfile, off2, lim2 int, kvdf, kvdb kvector, needMin bool, env algoEnv) {
+	ha1, ha2 := f1.rha, f2.rha
+
+	// Shrink the box by walking through each diagonal snake (SW and NE)
+	for off1 < lim1 && off2 < lim2 && ha1[off1] == ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && ha1[lim1-1] == ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	// If one dimension is empty, then all records on the other one must be obviously changed
+	if off1 == lim1 {
+		for ; off2 < lim2; off2++ {
+			f2.setChanged(f2.rindex[off2], true)
+		}
+	} else if off2 == lim2 {
+		for ; off1 < lim1; off1++ {
+			f1.setChanged(f1.rindex[off1], true)
+		}
+	} else {
+		i1, i2, minLo, minHi := splitBox(ha1, off1, lim1, ha2, off2, lim2, kvdf, kvdb, needMin, env)
+
+		recsCmp(f1, off1, i1, f2, off2, i2, kvdf, kvdb, minLo, env)
+		recsCmp(f1, i1, lim1, f2, i2, lim2, kvdf, kvdb, minHi, env)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// splitBox is a port of xdl_split: it finds the middle snake of the box or,
+// when the edit cost is too high, a good enough split point
+func splitBox(ha1 []int, off1, lim1 int, ha2 []int, off2, lim2 int, kvdf, kvdb kvector, needMin bool, env algoEnv) (int, int, bool, bool) {
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	kvdf.set(fmid, off1)
+	kvdb.set(bmid, lim1)
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		// Extend the forward diagonal domain by one
+		if fmin > dmin {
+			fmin--
+			kvdf.set(fmin-1, -1)
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			kvdf.set(fmax+1, -1)
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if kvdf.get(d-1) >= kvdf.get(d+1) {
+				i1 = kvdf.get(d-1) + 1
+			} else {
+				i1 = kvdf.get(d + 1)
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > env.snakeCnt {
+				gotSnake = true
+			}
+			kvdf.set(d, i1)
+			if odd && bmin <= d && d <= bmax && kvdb.get(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		// Extend the backward diagonal domain by one
+		if bmin > dmin {
+			bmin--
+			kvdb.set(bmin-1, lineMax)
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			kvdb.set(bmax+1, lineMax)
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if kvdb.get(d-1) < kvdb.get(d+1) {
+				i1 = kvdb.get(d - 1)
+			} else {
+				i1 = kvdb.get(d+1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > env.snakeCnt {
+				gotSnake = true
+			}
+			kvdb.set(d, i1)
+			if !odd && fmin <= d && d <= fmax && i1 <= kvdf.get(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// If the edit cost is above the heuristic trigger and there is a good snake,
+		// sample current diagonals to see if some of them have reached an "interesting" path
+		if gotSnake && ec > env.heurMin {
+			best, spl1, spl2 := 0, 0, 0
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := abs(d - fmid)
+				i1 := kvdf.get(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+
+				if v > kHeur*ec && v > best &&
+					off1+env.snakeCnt <= i1 && i1 < lim1 &&
+					off2+env.snakeCnt <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == env.snakeCnt {
+							best = v
+							spl1, spl2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return spl1, spl2, true, false
+			}
+
+			best = 0
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := abs(d - bmid)
+				i1 := kvdb.get(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+
+				if v > kHeur*ec && v > best &&
+					off1 < i1 && i1 <= lim1-env.snakeCnt &&
+					off2 < i2 && i2 <= lim2-env.snakeCnt {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == env.snakeCnt-1 {
+							best = v
+							spl1, spl2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return spl1, spl2, false, true
+			}
+		}
+
+		// Enough is enough: collect the furthest reaching path using the (i1 + i2) measure
+		if ec >= env.mxcost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := kvdf.get(d)
+				if lim1 < i1 {
+					i1 = lim1
+				}
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+				if fbest < i1+i2 {
+					fbest = i1 + i2
+					fbest1 = i1
+				}
+			}
+
+			bbest, bbest1 := lineMax, lineMax
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := kvdb.get(d)
+				if i1 < off1 {
+					i1 = off1
+				}
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+				if i1+i2 < bbest {
+					bbest = i1 + i2
+					bbest1 = i1
+				}
+			}
+
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
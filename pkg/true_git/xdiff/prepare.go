@@ -0,0 +1,237 @@
+package xdiff
+
+const (
+	maxEqLimit     = 1024
+	simScanWindow  = 100
+	keepDisRunRate = 4
+)
+
+type xdfile struct {
+	recs [][]byte
+	// ha is the equivalence class of each record, equal records have the same class
+	ha   []int
+	nrec int
+
+	dstart, dend int
+
+	// rchg marks changed records, it has sentinels for the indexes -1 and nrec
+	rchg []bool
+
+	// rindex and rha describe the records which take part in the diff algorithm
+	rindex []int
+	rha    []int
+	nreff  int
+}
+
+func (f *xdfile) isChanged(i int) bool {
+	return f.rchg[i+1]
+}
+
+func (f *xdfile) setChanged(i int, value bool) {
+	f.rchg[i+1] = value
+}
+
+type class struct {
+	len1, len2 int
+}
+
+type classifier struct {
+	ids     map[string]int
+	classes []*class
+}
+
+func (c *classifier) classify(rec []byte, pass int) int {
+	id, ok := c.ids[string(rec)]
+	if !ok {
+		id = len(c.classes)
+		c.ids[string(rec)] = id
+		c.classes = append(c.classes, &class{})
+	}
+
+	if pass == 1 {
+		c.classes[id].len1++
+	} else {
+		c.classes[id].len2++
+	}
+
+	return id
+}
+
+func splitRecords(data []byte) [][]byte {
+	var recs [][]byte
+
+	start := 0
+	for i, b := range data {
+		if b == '\n' {
+			recs = append(recs, data[start:i+1])
+			start = i + 1
+		}
+	}
+
+	if start < len(data) {
+		recs = append(recs, data[start:])
+	}
+
+	return recs
+}
+
+func prepareFile(data []byte, cf *classifier, pass int) *xdfile {
+	recs := splitRecords(data)
+
+	f := &xdfile{
+		recs:   recs,
+		ha:     make([]int, len(recs)),
+		nrec:   len(recs),
+		dstart: 0,
+		dend:   len(recs) - 1,
+		rchg:   make([]bool, len(recs)+2),
+		rindex: make([]int, len(recs)+1),
+		rha:    make([]int, len(recs)+1),
+	}
+
+	for i, rec := range recs {
+		f.ha[i] = cf.classify(rec, pass)
+	}
+
+	return f
+}
+
+// prepareEnv is a port of xdl_prepare_env: records are classified, common head and tail records are trimmed
+// and records that cannot match (or are unlikely to match) are excluded from the diff algorithm
+func prepareEnv(a, b []byte) (*xdfile, *xdfile) {
+	cf := &classifier{ids: map[string]int{}}
+
+	f1 := prepareFile(a, cf, 1)
+	f2 := prepareFile(b, cf, 2)
+
+	trimEnds(f1, f2)
+	cleanupRecords(cf, f1, f2)
+
+	return f1, f2
+}
+
+func trimEnds(f1, f2 *xdfile) {
+	lim := f1.nrec
+	if f2.nrec < lim {
+		lim = f2.nrec
+	}
+
+	i := 0
+	for ; i < lim; i++ {
+		if f1.ha[i] != f2.ha[i] {
+			break
+		}
+	}
+
+	f1.dstart, f2.dstart = i, i
+
+	lim -= i
+	j := 0
+	for ; j < lim; j++ {
+		if f1.ha[f1.nrec-1-j] != f2.ha[f2.nrec-1-j] {
+			break
+		}
+	}
+
+	f1.dend = f1.nrec - j - 1
+	f2.dend = f2.nrec - j - 1
+}
+
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+
+	return i
+}
+
+func cleanupRecords(cf *classifier, f1, f2 *xdfile) {
+	dis1 := make([]byte, f1.nrec+1)
+	dis2 := make([]byte, f2.nrec+1)
+
+	markDiscards := func(f *xdfile, dis []byte, matches func(c *class) int) {
+		mlim := bogoSqrt(f.nrec)
+		if mlim > maxEqLimit {
+			mlim = maxEqLimit
+		}
+
+		for i := f.dstart; i <= f.dend; i++ {
+			nm := matches(cf.classes[f.ha[i]])
+			switch {
+			case nm == 0:
+				dis[i] = 0
+			case nm >= mlim:
+				dis[i] = 2
+			default:
+				dis[i] = 1
+			}
+		}
+	}
+
+	markDiscards(f1, dis1, func(c *class) int { return c.len2 })
+	markDiscards(f2, dis2, func(c *class) int { return c.len1 })
+
+	collectReff := func(f *xdfile, dis []byte) {
+		nreff := 0
+		for i := f.dstart; i <= f.dend; i++ {
+			if dis[i] == 1 || (dis[i] == 2 && !cleanMultiMatch(dis, i, f.dstart, f.dend)) {
+				f.rindex[nreff] = i
+				f.rha[nreff] = f.ha[i]
+				nreff++
+			} else {
+				f.setChanged(i, true)
+			}
+		}
+		f.nreff = nreff
+	}
+
+	collectReff(f1, dis1)
+	collectReff(f2, dis2)
+}
+
+// cleanMultiMatch decides whether the multimatch record i should be discarded:
+// it is discarded when it is surrounded by enough records without matches
+func cleanMultiMatch(dis []byte, i, s, e int) bool {
+	if i-s > simScanWindow {
+		s = i - simScanWindow
+	}
+	if e-i > simScanWindow {
+		e = i + simScanWindow
+	}
+
+	rdis0, rpdis0 := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			rdis0++
+		} else if dis[i-r] == 2 {
+			rpdis0++
+		} else {
+			break
+		}
+	}
+
+	if rdis0 == 0 {
+		return false
+	}
+
+	rdis1, rpdis1 := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			rdis1++
+		} else if dis[i+r] == 2 {
+			rpdis1++
+		} else {
+			break
+		}
+	}
+
+	if rdis1 == 0 {
+		return false
+	}
+
+	rdis1 += rdis0
+	rpdis1 += rpdis0
+
+	return rpdis1*keepDisRunRate < rpdis1+rdis1
+}
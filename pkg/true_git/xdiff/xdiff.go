@@ -0,0 +1,237 @@
+// Package xdiff is a port of the git xdiff library: it produces unified diff hunks
+// identical to the ones `git diff` produces with the default myers algorithm and indent heuristic.
+package xdiff
+
+import (
+	"bytes"
+	"strconv"
+)
+
+const (
+	funcLineMaxSize = 80
+	hunkHeaderSize  = 128
+)
+
+type change struct {
+	i1, i2     int
+	chg1, chg2 int
+}
+
+// Diff returns unified diff hunks between a and b with ctxLen lines of context,
+// an empty result means that there are no differences
+func Diff(a, b []byte, ctxLen int) []byte {
+	f1, f2 := prepareEnv(a, b)
+
+	doDiff(f1, f2)
+	changeCompact(f1, f2)
+	changeCompact(f2, f1)
+
+	script := buildScript(f1, f2)
+	if len(script) == 0 {
+		return nil
+	}
+
+	out := &bytes.Buffer{}
+	emitDiff(out, f1, f2, script, ctxLen)
+
+	return out.Bytes()
+}
+
+func buildScript(f1, f2 *xdfile) []change {
+	var script []change
+
+	for i1, i2 := f1.nrec, f2.nrec; i1 >= 0 || i2 >= 0; i1, i2 = i1-1, i2-1 {
+		if f1.isChanged(i1-1) || f2.isChanged(i2-1) {
+			l1 := i1
+			for f1.isChanged(i1 - 1) {
+				i1--
+			}
+
+			l2 := i2
+			for f2.isChanged(i2 - 1) {
+				i2--
+			}
+
+			script = append(script, change{i1: i1, i2: i2, chg1: l1 - i1, chg2: l2 - i2})
+		}
+	}
+
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+
+	return script
+}
+
+// hunkEnd returns the index of the last change which goes to the hunk started with the change with the index first
+func hunkEnd(script []change, first, ctxLen int) int {
+	maxCommon := 2 * ctxLen
+
+	last := first
+	for i := first + 1; i < len(script); i++ {
+		distance := script[i].i1 - (script[i-1].i1 + script[i-1].chg1)
+		if distance > maxCommon {
+			break
+		}
+		last = i
+	}
+
+	return last
+}
+
+func emitDiff(out *bytes.Buffer, f1, f2 *xdfile, script []change, ctxLen int) {
+	funcLinePrev := -1
+	var funcLine []byte
+
+	for first := 0; first < len(script); {
+		last := hunkEnd(script, first, ctxLen)
+		xch, xche := script[first], script[last]
+
+		s1 := xch.i1 - ctxLen
+		if s1 < 0 {
+			s1 = 0
+		}
+		s2 := xch.i2 - ctxLen
+		if s2 < 0 {
+			s2 = 0
+		}
+
+		lctx := ctxLen
+		if rest := f1.nrec - (xche.i1 + xche.chg1); rest < lctx {
+			lctx = rest
+		}
+		if rest := f2.nrec - (xche.i2 + xche.chg2); rest < lctx {
+			lctx = rest
+		}
+
+		e1 := xche.i1 + xche.chg1 + lctx
+		e2 := xche.i2 + xche.chg2 + lctx
+
+		if line, ok := findFuncLine(f1, s1-1, funcLinePrev); ok {
+			funcLine = line
+		}
+		funcLinePrev = s1 - 1
+
+		emitHunkHeader(out, s1+1, e1-s1, s2+1, e2-s2, funcLine)
+
+		for ; s2 < xch.i2; s2++ {
+			emitRecord(out, f2.recs[s2], ' ')
+		}
+
+		s1, s2 = xch.i1, xch.i2
+		for i := first; ; i++ {
+			ch := script[i]
+
+			for ; s1 < ch.i1 && s2 < ch.i2; s1, s2 = s1+1, s2+1 {
+				emitRecord(out, f2.recs[s2], ' ')
+			}
+
+			for s1 = ch.i1; s1 < ch.i1+ch.chg1; s1++ {
+				emitRecord(out, f1.recs[s1], '-')
+			}
+
+			for s2 = ch.i2; s2 < ch.i2+ch.chg2; s2++ {
+				emitRecord(out, f2.recs[s2], '+')
+			}
+
+			if i == last {
+				break
+			}
+
+			s1 = ch.i1 + ch.chg1
+			s2 = ch.i2 + ch.chg2
+		}
+
+		for s2 = xche.i2 + xche.chg2; s2 < e2; s2++ {
+			emitRecord(out, f2.recs[s2], ' ')
+		}
+
+		first = last + 1
+	}
+}
+
+// findFuncLine searches the function line in the records (limit, start] of the first file
+// the same way git does with the default funcname pattern
+func findFuncLine(f *xdfile, start, limit int) ([]byte, bool) {
+	step := 1
+	if start > limit {
+		step = -1
+	}
+
+	for l := start; l != limit && 0 <= l && l < f.nrec; l += step {
+		if line, ok := matchFuncRecord(f.recs[l]); ok {
+			return line, true
+		}
+	}
+
+	return nil, false
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func matchFuncRecord(rec []byte) ([]byte, bool) {
+	if len(rec) == 0 || !(isAlpha(rec[0]) || rec[0] == '_' || rec[0] == '$') {
+		return nil, false
+	}
+
+	if len(rec) > funcLineMaxSize {
+		rec = rec[:funcLineMaxSize]
+	}
+
+	for len(rec) > 0 && isSpace(rec[len(rec)-1]) {
+		rec = rec[:len(rec)-1]
+	}
+
+	return rec, true
+}
+
+func emitHunkHeader(out *bytes.Buffer, s1, c1, s2, c2 int, funcLine []byte) {
+	header := []byte("@@ -")
+
+	if c1 != 0 {
+		header = strconv.AppendInt(header, int64(s1), 10)
+	} else {
+		header = strconv.AppendInt(header, int64(s1-1), 10)
+	}
+	if c1 != 1 {
+		header = append(header, ',')
+		header = strconv.AppendInt(header, int64(c1), 10)
+	}
+
+	header = append(header, " +"...)
+
+	if c2 != 0 {
+		header = strconv.AppendInt(header, int64(s2), 10)
+	} else {
+		header = strconv.AppendInt(header, int64(s2-1), 10)
+	}
+	if c2 != 1 {
+		header = append(header, ',')
+		header = strconv.AppendInt(header, int64(c2), 10)
+	}
+
+	header = append(header, " @@"...)
+
+	if len(funcLine) > 0 {
+		header = append(header, ' ')
+
+		if maxLen := hunkHeaderSize - len(header) - 1; len(funcLine) > maxLen {
+			funcLine = funcLine[:maxLen]
+		}
+		header = append(header, funcLine...)
+	}
+
+	out.Write(header)
+	out.WriteByte('\n')
+}
+
+func emitRecord(out *bytes.Buffer, rec []byte, prefix byte) {
+	out.WriteByte(prefix)
+	out.Write(rec)
+
+	if len(rec) > 0 && rec[len(rec)-1] != '\n' {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
@@ -0,0 +1,85 @@
+package xdiff
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		ctxLen   int
+		expected string
+	}{
+		{
+			name:     "equal",
+			a:        "a\nb\n",
+			b:        "a\nb\n",
+			ctxLen:   3,
+			expected: "",
+		},
+		{
+			name:   "function line",
+			a:      "package main\n\nfunc main() {\n\ta := 1\n\tb := 2\n\tc := 3\n\td := 4\n\te := 5\n\tprintln(a, b, c, d, e)\n}\n",
+			b:      "package main\n\nfunc main() {\n\ta := 1\n\tb := 2\n\tc := 3\n\td := 40\n\te := 5\n\tprintln(a, b, c, d, e)\n}\n",
+			ctxLen: 3,
+			expected: "@@ -4,7 +4,7 @@ func main() {\n" +
+				" \ta := 1\n" +
+				" \tb := 2\n" +
+				" \tc := 3\n" +
+				"-\td := 4\n" +
+				"+\td := 40\n" +
+				" \te := 5\n" +
+				" \tprintln(a, b, c, d, e)\n" +
+				" }\n",
+		},
+		{
+			name:   "no newline at end of file",
+			a:      "one\ntwo",
+			b:      "one\nthree",
+			ctxLen: 3,
+			expected: "@@ -1,2 +1,2 @@\n" +
+				" one\n" +
+				"-two\n" +
+				"\\ No newline at end of file\n" +
+				"+three\n" +
+				"\\ No newline at end of file\n",
+		},
+		{
+			name:   "indent heuristic",
+			a:      "func a() {\n\treturn\n}\n\nfunc c() {\n\treturn\n}\n",
+			b:      "func a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n\nfunc c() {\n\treturn\n}\n",
+			ctxLen: 3,
+			expected: "@@ -2,6 +2,10 @@ func a() {\n" +
+				" \treturn\n" +
+				" }\n" +
+				" \n" +
+				"+func b() {\n" +
+				"+\treturn\n" +
+				"+}\n" +
+				"+\n" +
+				" func c() {\n" +
+				" \treturn\n" +
+				" }\n",
+		},
+		{
+			name:   "separate hunks",
+			a:      "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b:      "0\n2\n3\n4\n5\n6\n7\n8\n9\n11\n",
+			ctxLen: 1,
+			expected: "@@ -1,2 +1,2 @@\n" +
+				"-1\n" +
+				"+0\n" +
+				" 2\n" +
+				"@@ -9,2 +9,2 @@\n" +
+				" 9\n" +
+				"-10\n" +
+				"+11\n",
+		},
+	}
+
+	for _, test := range tests {
+		got := string(Diff([]byte(test.a), []byte(test.b), test.ctxLen))
+		if got != test.expected {
+			t.Errorf("%s:\n[EXPECTED]:\n%s\n[GOT]:\n%s", test.name, test.expected, got)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"golang.org/x/crypto/sha3"
@@ -37,6 +40,55 @@ func MD5Hash(args ...string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// DirChecksum returns the sha256 checksum of the paths, types, executable bits and contents of the files in the dir,
+// other permissions depend on the umask and the checkout, so they do not change the checksum
+func DirChecksum(dir string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			fmt.Fprintf(h, "%s dir\n", filepath.ToSlash(relPath))
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s symlink %s\n", filepath.ToSlash(relPath), link)
+		case info.Mode().IsRegular():
+			fmt.Fprintf(h, "%s file %v %d\n", filepath.ToSlash(relPath), info.Mode()&0111 != 0, info.Size())
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(h, "%s %s\n", filepath.ToSlash(relPath), info.Mode()&os.ModeType)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
 func prepareHashArgs(args ...string) string {
 	return strings.Join(args, ":::")
 }
@@ -0,0 +1,64 @@
+package util_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/flant/werf/pkg/util"
+)
+
+var _ = Describe("dir checksum", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "werf-dir-checksum-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(os.MkdirAll(filepath.Join(dir, "tasks"), 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(dir, "tasks", "main.yml"), []byte("- debug: msg=main\n"), 0644)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(dir, "module.py"), []byte("# module\n"), 0644)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		Ω(os.RemoveAll(dir)).Should(Succeed())
+	})
+
+	checksum := func() string {
+		checksum, err := util.DirChecksum(dir)
+		Ω(err).ShouldNot(HaveOccurred())
+		return checksum
+	}
+
+	It("does not depend on read and write permissions", func() {
+		before := checksum()
+
+		Ω(os.Chmod(filepath.Join(dir, "tasks", "main.yml"), 0600)).Should(Succeed())
+		Ω(os.Chmod(filepath.Join(dir, "tasks"), 0775)).Should(Succeed())
+
+		Ω(checksum()).Should(Equal(before))
+	})
+
+	It("depends on the executable bit", func() {
+		before := checksum()
+
+		Ω(os.Chmod(filepath.Join(dir, "module.py"), 0755)).Should(Succeed())
+
+		Ω(checksum()).ShouldNot(Equal(before))
+	})
+
+	It("depends on the content and the paths", func() {
+		before := checksum()
+
+		Ω(ioutil.WriteFile(filepath.Join(dir, "module.py"), []byte("# changed\n"), 0644)).Should(Succeed())
+		changed := checksum()
+		Ω(changed).ShouldNot(Equal(before))
+
+		Ω(os.Rename(filepath.Join(dir, "module.py"), filepath.Join(dir, "tasks", "module.py"))).Should(Succeed())
+		Ω(checksum()).ShouldNot(Equal(changed))
+	})
+})
@@ -0,0 +1,164 @@
+package werf
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/flant/logboek"
+	"github.com/flant/shluz"
+)
+
+// Host locks are shluz file locks, which exclude werf processes on the host, with the in-process lock in front of them.
+// shluz counts holders of the lock per process and its locks registry is not guarded, so shluz alone lets all goroutines
+// of the process in: goroutines are excluded here and the shluz lock is acquired and released once for all in-process holders.
+
+var (
+	hostLocksMutex sync.Mutex
+	hostLocksCond  = sync.NewCond(&hostLocksMutex)
+	hostLocks      = map[string]*hostLock{}
+)
+
+type hostLock struct {
+	holders  int
+	readOnly bool
+	// busy is set while the shluz lock is being acquired or released
+	busy bool
+}
+
+func (l *hostLock) isAvailable(readOnly bool) bool {
+	if l.busy {
+		return false
+	}
+
+	return l.holders == 0 || (readOnly && l.readOnly)
+}
+
+func HostLock(name string, opts shluz.LockOptions) error {
+	_, err := acquireHostLock(name, opts.ReadOnly, true, func(lock shluz.LockObject) (bool, error) {
+		timeout := opts.Timeout
+		if timeout == 0 {
+			timeout = shluz.DefaultTimeout
+		}
+
+		if err := lock.Lock(timeout, opts.ReadOnly, func(doWait func() error) error {
+			logProcessMsg := fmt.Sprintf("Waiting for locked resource %q", name)
+			return logboek.LogProcessInline(logProcessMsg, logboek.LogProcessInlineOptions{}, doWait)
+		}); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	})
+
+	return err
+}
+
+// TryHostLock does not wait for the lock held by another goroutine or werf process
+func TryHostLock(name string, opts shluz.TryLockOptions) (bool, error) {
+	return acquireHostLock(name, opts.ReadOnly, false, func(lock shluz.LockObject) (bool, error) {
+		return lock.TryLock(opts.ReadOnly)
+	})
+}
+
+func HostUnlock(name string) error {
+	hostLocksMutex.Lock()
+
+	l, exists := hostLocks[name]
+	if !exists || l.holders == 0 {
+		hostLocksMutex.Unlock()
+		return nil
+	}
+
+	if l.holders > 1 {
+		l.holders--
+		hostLocksMutex.Unlock()
+		return nil
+	}
+
+	l.busy = true
+	lock := shluzLockObject(name)
+	hostLocksMutex.Unlock()
+
+	err := lock.Unlock()
+
+	hostLocksMutex.Lock()
+	delete(hostLocks, name)
+	hostLocksCond.Broadcast()
+	hostLocksMutex.Unlock()
+
+	return err
+}
+
+func WithHostLock(name string, opts shluz.LockOptions, f func() error) (resErr error) {
+	if err := HostLock(name, opts); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := HostUnlock(name); err != nil && resErr == nil {
+			resErr = err
+		}
+	}()
+
+	return f()
+}
+
+func acquireHostLock(name string, readOnly, wait bool, acquireFunc func(lock shluz.LockObject) (bool, error)) (bool, error) {
+	hostLocksMutex.Lock()
+
+	var l *hostLock
+	for {
+		var exists bool
+		if l, exists = hostLocks[name]; !exists {
+			l = &hostLock{}
+			hostLocks[name] = l
+		}
+
+		if l.isAvailable(readOnly) {
+			break
+		}
+
+		if !wait {
+			hostLocksMutex.Unlock()
+			return false, nil
+		}
+
+		hostLocksCond.Wait()
+	}
+
+	if l.holders > 0 {
+		l.holders++
+		hostLocksMutex.Unlock()
+		return true, nil
+	}
+
+	l.busy = true
+	lock := shluzLockObject(name)
+	hostLocksMutex.Unlock()
+
+	acquired, err := acquireFunc(lock)
+
+	hostLocksMutex.Lock()
+	l.busy = false
+	if acquired && err == nil {
+		l.holders = 1
+		l.readOnly = readOnly
+	} else {
+		delete(hostLocks, name)
+	}
+	hostLocksCond.Broadcast()
+	hostLocksMutex.Unlock()
+
+	return acquired, err
+}
+
+// shluzLockObject should be called with hostLocksMutex held
+func shluzLockObject(name string) shluz.LockObject {
+	lock, exists := shluz.Locks[name]
+	if !exists {
+		lock = shluz.NewFileLock(name, shluz.LocksDir)
+		shluz.Locks[name] = lock
+	}
+
+	return lock
+}
@@ -0,0 +1,132 @@
+package werf
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flant/shluz"
+)
+
+func initTestShluz(t *testing.T) func() {
+	locksDir, err := ioutil.TempDir("", "werf-host-lock-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shluz.Init(locksDir); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() { _ = os.RemoveAll(locksDir) }
+}
+
+func TestHostLock_GoroutinesAreSerialized(t *testing.T) {
+	defer initTestShluz(t)()
+
+	var mux sync.Mutex
+	var holders, maxHolders int
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := WithHostLock("project.signature", shluz.LockOptions{}, func() error {
+				mux.Lock()
+				holders++
+				if holders > maxHolders {
+					maxHolders = holders
+				}
+				mux.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mux.Lock()
+				holders--
+				mux.Unlock()
+
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxHolders != 1 {
+		t.Errorf("expected the lock to be held by one goroutine at a time, got %d", maxHolders)
+	}
+
+	if len(hostLocks) != 0 {
+		t.Errorf("expected no held locks, got %v", hostLocks)
+	}
+}
+
+func TestHostLock_ReadOnly(t *testing.T) {
+	defer initTestShluz(t)()
+
+	if err := HostLock("cache", shluz.LockOptions{ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, err := TryHostLock("cache", shluz.TryLockOptions{ReadOnly: true}); err != nil || !locked {
+		t.Fatalf("expected read only lock to be shared: %v %v", locked, err)
+	}
+
+	if locked, err := TryHostLock("cache", shluz.TryLockOptions{}); err != nil || locked {
+		t.Fatalf("expected exclusive lock to be held by readers: %v %v", locked, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := HostUnlock("cache"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if locked, err := TryHostLock("cache", shluz.TryLockOptions{}); err != nil || !locked {
+		t.Fatalf("expected exclusive lock to be acquired after readers: %v %v", locked, err)
+	}
+
+	if err := HostUnlock("cache"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHostLock_IsNotReentrant(t *testing.T) {
+	defer initTestShluz(t)()
+
+	if err := HostLock("image", shluz.LockOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, err := TryHostLock("image", shluz.TryLockOptions{}); err != nil || locked {
+		t.Fatalf("expected the lock held in the process not to be acquired again: %v %v", locked, err)
+	}
+
+	acquiredCh := make(chan struct{})
+	go func() {
+		if err := HostLock("image", shluz.LockOptions{}); err != nil {
+			t.Error(err)
+		}
+		close(acquiredCh)
+	}()
+
+	select {
+	case <-acquiredCh:
+		t.Fatal("expected the goroutine to wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := HostUnlock("image"); err != nil {
+		t.Fatal(err)
+	}
+	<-acquiredCh
+
+	if err := HostUnlock("image"); err != nil {
+		t.Fatal(err)
+	}
+}